@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/admin"
+	"github.com/ooyeku/grayv-lsm/internal/metrics"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/spf13/cobra"
+)
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Serve a web UI to browse and edit the data of models",
+	Long: `Serve a web UI listing the registered models and their fields and, with a database, the rows of their
+tables a page at a time, with forms creating, editing and deleting rows.
+
+Models are read from the database, or from the models file given with --file; without a database, only the
+definitions are shown. Encrypted fields are not editable. With a database, the Jobs page monitors the queues
+of the background jobs run by apps: the jobs pending, running and failed, their errors and payloads, with the
+values of sensitive and encrypted fields and of secrets such as passwords and tokens redacted, and buttons
+retrying or cancelling jobs. With --read-only, rows and jobs are listed but not written.
+With metrics enabled in the configuration, Prometheus metrics of the requests, queries and database
+connections of the UI are served on /metrics, or the configured path.
+The UI has no authentication: it listens on the loopback interface by default, and should only be exposed
+behind a proxy that authenticates. Stop serving with Ctrl+C.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runAdmin,
+}
+
+func init() {
+	adminCmd.Flags().String("addr", "127.0.0.1:8081", "Address to listen on")
+	adminCmd.Flags().String("file", "", "Models file to read the definitions from instead of the database")
+	adminCmd.Flags().Bool("read-only", false, "List rows without the forms writing them")
+
+	RootCmd.AddCommand(adminCmd)
+}
+
+func runAdmin(cmd *cobra.Command, args []string) error {
+	addr, _ := cmd.Flags().GetString("addr")
+	file, _ := cmd.Flags().GetString("file")
+	readOnly, _ := cmd.Flags().GetBool("read-only")
+
+	var defs []*model.ModelDefinition
+	options := admin.Options{ReadOnly: readOnly}
+	if cfg != nil && cfg.Metrics.Enabled {
+		options.Metrics = metrics.NewRegistry()
+		options.MetricsPath = cfg.Metrics.Path
+		options.MetricsBuckets = cfg.Metrics.Buckets
+	}
+	conn, err := getDBConnection()
+	switch {
+	case err == nil:
+		defer conn.Close()
+		options.Store = admin.NewDBStore(conn.GetDB())
+		options.Jobs = admin.NewDBJobStore(conn.GetDB())
+		if options.Metrics != nil {
+			metrics.RegisterDBStats(options.Metrics, conn.GetDB())
+		}
+		if file == "" {
+			if defs, err = fetchAllModelDefinitions(conn); err != nil {
+				return err
+			}
+		}
+	case file == "":
+		return err
+	default:
+		log.WithError(err).Warn("Not connected to the database: only the model definitions are shown")
+	}
+	if file != "" {
+		if defs, err = readModelsAtRef("", file); err != nil {
+			return err
+		}
+	}
+
+	server := &http.Server{Addr: addr, Handler: admin.NewServer(defs, options)}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Infof("Serving the admin UI of %d model(s) on http://%s", len(defs), addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
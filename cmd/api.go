@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/mock"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/spf13/cobra"
+)
+
+var apiCmd = &cobra.Command{
+	Use:   "api",
+	Short: "Inspect the HTTP API of Grayv apps",
+}
+
+var apiRoutesCmd = &cobra.Command{
+	Use:   "routes",
+	Short: "List the routes of an app with their handlers and middleware",
+	Long: `Builds and runs "<app> routes list" in the app directory, and prints every route the app registers with
+its method, path, handler and middleware chain: the middleware wrapping every route, as configured by the
+environment, then those of the route, outermost first. Routes matching every method show ANY. Use it to check
+which routes are behind authentication.
+
+The app is the one named by --app, or the only app in the current directory.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runAPIRoutes,
+}
+
+var apiReplayCmd = &cobra.Command{
+	Use:   "replay <recording|dir>...",
+	Short: "Send recorded requests again to a server",
+	Long: `Sends the requests recorded by an app whose RECORD_DIR is set again to the server at --target, in the
+order they were recorded, and compares the status and body of each response with the recorded one. Use it to
+reproduce on a development server a bug reported from staging.
+
+Credentials were redacted when recording: headers holding one are not sent, and --header sets them for the
+target instead, e.g. --header "Authorization: Bearer <token>". Requests whose body was redacted or truncated
+are sent as recorded, and may be rejected.`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runAPIReplay,
+}
+
+var apiMockCmd = &cobra.Command{
+	Use:   "mock [model...]",
+	Short: "Serve fake CRUD endpoints of models, without a database",
+	Long: `Serves fake CRUD endpoints for the named models, or every model, so that frontends can be built against the
+API before the backend is deployed. Each model is served under the name of its table:
+
+  GET /posts          a page of records, as {"items": [...], "total": n, "next_cursor": "..."}, selected
+                      with ?limit=, ?offset= or ?cursor= like the ListPage of the generated repositories
+  POST /posts         creates a record
+  GET /posts/{id}     a record; PUT replaces its fields, PATCH updates the given ones, DELETE deletes it
+
+Records are encoded as the generated models encode them, with values of the kinds set on their fields with
+"model update --fake", or looking like what the names of the fields suggest, and references holding the IDs of
+generated records. The same --seed gives the same records, which "db seed generate" writes as seeds.
+Records written are kept in memory until the server stops, with Ctrl+C.
+
+Models are read from the database, or from the models file given with --file, once at startup.`,
+	SilenceUsage: true,
+	RunE:         runAPIMock,
+}
+
+func init() {
+	apiRoutesCmd.Flags().String("app", "", "Name of the Grayv app to list the routes of")
+	apiMockCmd.Flags().String("addr", "127.0.0.1:8090", "Address to listen on")
+	apiMockCmd.Flags().String("file", "", "Models file to read the definitions from instead of the database")
+	apiMockCmd.Flags().Int("records", mock.DefaultRecords, "Number of records generated per model")
+	apiMockCmd.Flags().Int64("seed", 1, "Seed of the generated values")
+	apiMockCmd.Flags().Duration("latency", 0, "Delay added to every response, e.g. 300ms")
+	apiReplayCmd.Flags().String("target", "http://localhost:8080", "Base URL of the server to send the requests to")
+	apiReplayCmd.Flags().StringArray("header", nil, "Header to set on every request, as \"Name: value\"")
+	apiReplayCmd.Flags().Duration("timeout", 30*time.Second, "Timeout of each request")
+
+	apiCmd.AddCommand(apiRoutesCmd)
+	apiCmd.AddCommand(apiReplayCmd)
+	apiCmd.AddCommand(apiMockCmd)
+	RootCmd.AddCommand(apiCmd)
+}
+
+// apiRoute is a route of an app, as listed by "<app> routes list --json".
+type apiRoute struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Handler     string   `json:"handler"`
+	Middleware  []string `json:"middleware"`
+	Description string   `json:"description"`
+}
+
+func runAPIRoutes(cmd *cobra.Command, args []string) error {
+	appName, _ := cmd.Flags().GetString("app")
+	appDir, err := resolveAppDir(appName)
+	if err != nil {
+		return err
+	}
+	if appDir == "" {
+		return fmt.Errorf("no single Grayv app in the current directory, name one with --app")
+	}
+
+	var stdout, stderr bytes.Buffer
+	list := exec.Command("go", "run", "./cmd", "routes", "list", "--json")
+	list.Dir = appDir
+	list.Stdout, list.Stderr = &stdout, &stderr
+	if err := list.Run(); err != nil {
+		return fmt.Errorf("failed to list the routes of %s: %w\n%s", appDir, err, strings.TrimSpace(stderr.String()))
+	}
+	var routes []apiRoute
+	if err := json.Unmarshal(stdout.Bytes(), &routes); err != nil {
+		return fmt.Errorf("failed to read the routes of %s, which may predate route listing: %w", appDir, err)
+	}
+
+	return printResult(routes, func() {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "METHOD\tPATH\tHANDLER\tMIDDLEWARE\tDESCRIPTION")
+		for _, route := range routes {
+			method, chain := route.Method, strings.Join(route.Middleware, " > ")
+			if method == "" {
+				method = "ANY"
+			}
+			if chain == "" {
+				chain = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", method, route.Path, route.Handler, chain, route.Description)
+		}
+		tw.Flush()
+	})
+}
+
+// redacted is the value of the credentials of recordings.
+const redacted = "[REDACTED]"
+
+// apiRecording is a request recorded by the Record middleware of an app, with its response.
+type apiRecording struct {
+	ID       string      `json:"id"`
+	Time     time.Time   `json:"time"`
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header"`
+	Body     string      `json:"body"`
+	Response struct {
+		Status int    `json:"status"`
+		Body   string `json:"body"`
+	} `json:"response"`
+}
+
+// apiReplay is the outcome of replaying a recording.
+type apiReplay struct {
+	ID             string `json:"id"`
+	Method         string `json:"method"`
+	URL            string `json:"url"`
+	RecordedStatus int    `json:"recorded_status"`
+	Status         int    `json:"status"`
+	SameBody       bool   `json:"same_body"`
+	Error          string `json:"error,omitempty"`
+}
+
+func runAPIReplay(cmd *cobra.Command, args []string) error {
+	target, _ := cmd.Flags().GetString("target")
+	headerFlags, _ := cmd.Flags().GetStringArray("header")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	headers := make(http.Header)
+	for _, header := range headerFlags {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid header %q, expected \"Name: value\"", header)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	recordings, err := loadRecordings(args)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	replays := make([]apiReplay, len(recordings))
+	failed := 0
+	for i, recording := range recordings {
+		replays[i] = replayRecording(cmd, client, strings.TrimSuffix(target, "/"), headers, recording)
+		if replays[i].Error != "" || replays[i].Status != replays[i].RecordedStatus {
+			failed++
+		}
+	}
+
+	err = printResult(replays, func() {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tMETHOD\tURL\tRECORDED\tREPLAYED\tBODY")
+		for _, replay := range replays {
+			status, body := fmt.Sprint(replay.Status), "same"
+			if replay.Error != "" {
+				status, body = "error", replay.Error
+			} else if !replay.SameBody {
+				body = "differs"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", replay.ID, replay.Method, replay.URL, replay.RecordedStatus, status, body)
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d request(s) failed or answered another status", failed, len(replays))
+	}
+	return nil
+}
+
+// loadRecordings reads the recordings of the given files, and of the JSON files of the given directories,
+// ordered by the time they were recorded.
+func loadRecordings(paths []string) ([]apiRecording, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	recordings := make([]apiRecording, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var recording apiRecording
+		if err := json.Unmarshal(data, &recording); err != nil || recording.Method == "" {
+			return nil, fmt.Errorf("%s is not a request recording", file)
+		}
+		recordings = append(recordings, recording)
+	}
+	if len(recordings) == 0 {
+		return nil, fmt.Errorf("no recordings found in %s", strings.Join(paths, ", "))
+	}
+	sort.SliceStable(recordings, func(i, j int) bool { return recordings[i].Time.Before(recordings[j].Time) })
+	return recordings, nil
+}
+
+// replayRecording sends a recorded request to the server at target, without its redacted headers and with
+// headers set, and compares the response with the recorded one.
+func replayRecording(cmd *cobra.Command, client *http.Client, target string, headers http.Header, recording apiRecording) apiReplay {
+	replay := apiReplay{ID: recording.ID, Method: recording.Method, URL: recording.URL, RecordedStatus: recording.Response.Status}
+	req, err := http.NewRequestWithContext(cmd.Context(), recording.Method, target+recording.URL, strings.NewReader(recording.Body))
+	if err != nil {
+		replay.Error = err.Error()
+		return replay
+	}
+	for name, values := range recording.Header {
+		if len(values) == 1 && values[0] == redacted || name == "Content-Length" || name == "Accept-Encoding" {
+			continue
+		}
+		req.Header[name] = values
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		replay.Error = err.Error()
+		return replay
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		replay.Error = err.Error()
+		return replay
+	}
+	replay.Status = resp.StatusCode
+	replay.SameBody = sameBody(recording.Response.Body, body)
+	return replay
+}
+
+// sameBody reports whether a response body matches a recorded one: equal JSON values, or equal text.
+func sameBody(recorded string, body []byte) bool {
+	var a, b interface{}
+	if json.Unmarshal([]byte(recorded), &a) == nil && json.Unmarshal(body, &b) == nil {
+		x, _ := json.Marshal(a)
+		y, _ := json.Marshal(b)
+		return bytes.Equal(x, y)
+	}
+	return strings.TrimSpace(recorded) == strings.TrimSpace(string(body))
+}
+
+// selectModels returns the named models, or every model, read from the database or from a models file.
+func selectModels(file string, names []string) ([]*model.ModelDefinition, error) {
+	var defs []*model.ModelDefinition
+	var err error
+	if file != "" {
+		defs, err = readModelsAtRef("", file)
+	} else {
+		conn, connErr := getDBConnection()
+		if connErr != nil {
+			return nil, fmt.Errorf("failed to get database connection, or pass a models file with --file: %w", connErr)
+		}
+		defs, err = fetchAllModelDefinitions(conn)
+		conn.Close()
+	}
+	if err != nil || len(names) == 0 {
+		return defs, err
+	}
+	return filterModels(defs, names)
+}
+
+// filterModels returns the named models among defs, matched case-insensitively.
+func filterModels(defs []*model.ModelDefinition, names []string) ([]*model.ModelDefinition, error) {
+	byName := make(map[string]*model.ModelDefinition, len(defs))
+	for _, def := range defs {
+		byName[strings.ToLower(def.Name)] = def
+	}
+	selected := make([]*model.ModelDefinition, 0, len(names))
+	for _, name := range names {
+		def, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("model %s not found", name)
+		}
+		selected = append(selected, def)
+	}
+	return selected, nil
+}
+
+func runAPIMock(cmd *cobra.Command, args []string) error {
+	addr, _ := cmd.Flags().GetString("addr")
+	file, _ := cmd.Flags().GetString("file")
+	records, _ := cmd.Flags().GetInt("records")
+	seed, _ := cmd.Flags().GetInt64("seed")
+	latency, _ := cmd.Flags().GetDuration("latency")
+	if records < 1 {
+		return fmt.Errorf("--records must be at least 1")
+	}
+
+	defs, err := selectModels(file, args)
+	if err != nil {
+		return err
+	}
+	if len(defs) == 0 {
+		return fmt.Errorf("no models to serve")
+	}
+
+	handler := mock.NewServer(defs, mock.Options{Records: records, Seed: seed, Latency: latency})
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-cmd.Context().Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Infof("Serving fake endpoints of %d model(s) on http://%s", len(defs), addr)
+	for _, table := range handler.Tables() {
+		log.Infof("  http://%s/%s", addr, table)
+	}
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -1,7 +1,13 @@
 package cmd
 
 import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+
 	"github.com/ooyeku/grayv-lsm/internal/app"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
 	"github.com/spf13/cobra"
 )
 
@@ -27,27 +33,132 @@ var createAppCmd = &cobra.Command{
 	},
 }
 
+var newAppCmd = &cobra.Command{
+	Use:   "new [name]",
+	Short: "Scaffold a new Grayv app ready for go run",
+	Long: `Scaffolds the project layout of a new app in the <name>_grav directory: a Go module with an HTTP server
+in cmd/ ("go run ./cmd" starts it), internal/models for "model generate --app", internal/handlers, migrations/,
+seeds/, and a config.yaml configuring the app's database for the grayv-lsm commands run in the app.
+
+The binary of the app is also its command line (internal/cli): "migrate", "migrate status", "migrate rollback"
+and "seed" apply the migrations and seed files embedded into it, "worker" runs its jobs and "routes list" lists
+its routes, so production containers do not need grayv-lsm. Its go.mod requires the version of grayv-lsm the
+command was installed at; when built from a checkout, run "go mod tidy" in the app first.
+
+The server's handlers are wrapped by the middleware of internal/middleware: request IDs, access logs and
+recovery from panics by default, and gzip and CORS when enabled in the server.middleware section of the
+configuration:
+
+  server:
+    middleware:
+      disable: [logging]
+      gzip: true
+      cors_origins: ["https://app.example.com"]`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		version := libraryVersion()
+		files, err := app.Scaffold(filesystem.NewOSFS(""), args[0], app.Options{Middleware: cfg.Server.Middleware, LibraryVersion: version})
+		if err != nil {
+			return fmt.Errorf("failed to scaffold Grayv app '%s': %w", args[0], err)
+		}
+		return printResult(files, func() {
+			for _, file := range files {
+				log.Infof("Created %s", file)
+			}
+			if version == "" {
+				log.Infof("Grayv app '%s' scaffolded: cd %s_grav && go mod tidy && go run ./cmd", args[0], args[0])
+				return
+			}
+			log.Infof("Grayv app '%s' scaffolded: cd %s_grav && go run ./cmd", args[0], args[0])
+		})
+	},
+}
+
+var etlAppCmd = &cobra.Command{
+	Use:   "etl [pipeline]",
+	Short: "Add an ETL pipeline to a Grayv app",
+	Long: `Adds a pipeline to the app: internal/pipelines/<pipeline>.go registers it with its source, a transform
+function to fill in, and the table its records are loaded into. The first pipeline also adds internal/etl,
+which loads every batch with multi-row INSERTs in the transaction saving the checkpoint of the pipeline in the
+etl_checkpoints table created by "db migrate", and cmd/etl, which runs them:
+
+  go run ./cmd/etl run orders            # resumes after the last batch loaded
+  go run ./cmd/etl run -restart orders
+  go run ./cmd/etl enqueue orders        # runs as a job of internal/jobs
+  go run ./cmd/etl work
+
+The source is data/<pipeline>.csv, or with --source sql the rows of --query against the database in
+SOURCE_DATABASE_URL, in the order of the integer column --key.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appName, _ := cmd.Flags().GetString("app")
+		source, _ := cmd.Flags().GetString("source")
+		query, _ := cmd.Flags().GetString("query")
+		key, _ := cmd.Flags().GetString("key")
+		table, _ := cmd.Flags().GetString("table")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		conflict, _ := cmd.Flags().GetStringSlice("conflict")
+
+		appDir, err := resolveAppDir(appName)
+		if err != nil {
+			return err
+		}
+		if appDir == "" {
+			return fmt.Errorf("specify the app with --app")
+		}
+		files, err := app.ScaffoldETL(filesystem.NewOSFS(""), strings.TrimSuffix(appDir, "_grav"), app.ETLOptions{
+			Pipeline: args[0],
+			Source:   source,
+			Query:    query,
+			Key:      key,
+			Table:    table,
+			Columns:  columns,
+			Conflict: conflict,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add pipeline %s: %w", args[0], err)
+		}
+		return printResult(files, func() {
+			for _, file := range files {
+				log.Infof("Created %s", file)
+			}
+			log.Infof("Pipeline %s added: fill in its transform, then cd %s && go run ./cmd/etl run %s", args[0], appDir, args[0])
+		})
+	},
+}
+
 // listAppsCmd is a variable of type *cobra.Command that represents the "list" command.
 // It is used to list all Grav apps. The command defines a Run function that calls the ListApps method
 // of the appCreator instance to get a list of Grav apps. It then logs the apps or an appropriate message.
 // If any error occurs during the command execution, an error message is logged.
 var listAppsCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all Grayv apps",
-	Run: func(cmd *cobra.Command, args []string) {
+	Use:          "list",
+	Short:        "List all Grayv apps",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		apps, err := appCreator.ListApps()
 		if err != nil {
-			log.WithError(err).Error("Failed to list Grayv apps")
-			return
+			return fmt.Errorf("failed to list Grayv apps: %w", err)
 		}
-		if len(apps) == 0 {
-			log.Info("No Grayv apps found")
-		} else {
-			log.Info("Grayv apps:")
-			for _, app := range apps {
-				log.Infof("- %s", app)
-			}
+		if apps == nil {
+			apps = []string{}
 		}
+		return printResult(apps, func() {
+			if len(apps) == 0 {
+				log.Info("No Grayv apps found")
+			} else {
+				log.Info("Grayv apps:")
+				for _, app := range apps {
+					log.Infof("- %s", app)
+				}
+			}
+		})
 	},
 }
 
@@ -69,7 +180,27 @@ func init() {
 	appCreator = app.NewAppCreator()
 
 	appCmd.AddCommand(createAppCmd)
+	appCmd.AddCommand(newAppCmd)
+	appCmd.AddCommand(etlAppCmd)
 	appCmd.AddCommand(listAppsCmd)
 	appCmd.AddCommand(deleteAppCmd)
 	RootCmd.AddCommand(appCmd)
+
+	etlAppCmd.Flags().String("app", "", "App to add the pipeline to (default the only app of the directory)")
+	etlAppCmd.Flags().String("source", app.ETLSourceCSV, "Source of the records: csv or sql")
+	etlAppCmd.Flags().String("query", "", "Query selecting the rows of an sql source")
+	etlAppCmd.Flags().String("key", "id", "Integer column of --query the rows are extracted in the order of")
+	etlAppCmd.Flags().String("table", "", "Table the records are loaded into (default the name of the pipeline)")
+	etlAppCmd.Flags().StringSlice("columns", []string{}, "Comma-separated list of the columns loaded (default all the columns of the records)")
+	etlAppCmd.Flags().StringSlice("conflict", []string{}, "Comma-separated columns of a unique constraint: records conflicting with a row update it")
+}
+
+// libraryVersion returns the version of grayv-lsm this binary was installed at, which the command line of new
+// apps requires, or "" for a binary built from a checkout.
+func libraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || !strings.HasPrefix(info.Main.Version, "v") {
+		return ""
+	}
+	return info.Main.Version
 }
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/enforcement"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Generate authentication for apps",
+}
+
+var authGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate JWT authentication with a user model",
+	Long: `Generate the JWT authentication of an app: a user model, created with email and passwordhash fields
+unless it exists, its Go code, and an auth package hashing passwords, serving POST /auth/login and
+POST /auth/refresh, and providing the middleware authenticating requests with access tokens.
+
+The user model, the issuer, the environment variable holding the signing key and the lifetimes of the tokens
+are configured in the auth section of the configuration:
+
+  auth:
+    model: User
+    issuer: myapp
+    secret_env: JWT_SECRET
+    access_ttl: 15m
+    refresh_ttl: 720h
+    permissions:
+      posts:
+        create: editor,admin
+        delete: admin
+
+Permissions restrict the actions (create, read, update, delete) on the records of a model, named by model or
+table, to users holding one of the given roles, stored in the roles field of the user model. They take
+precedence over the permissions set on models with "model create/update --permission", and are enforced by
+auth.Require.
+
+The model is written to internal/models and the package to internal/auth, inside the app when --app is given.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runAuthGenerate,
+}
+
+func init() {
+	authGenerateCmd.Flags().String("app", "", "Name of the Grayv app to generate the authentication in")
+
+	authCmd.AddCommand(authGenerateCmd)
+	RootCmd.AddCommand(authCmd)
+}
+
+// authOptions returns the options of the generated authentication configured by cfg.
+func authOptions(cfg config.AuthConfig, outputDir string) (model.AuthOptions, error) {
+	opts := model.AuthOptions{OutputDir: outputDir, Issuer: cfg.Issuer, SecretEnv: cfg.SecretEnv}
+	for _, ttl := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{{"auth.access_ttl", cfg.AccessTTL, &opts.AccessTTL}, {"auth.refresh_ttl", cfg.RefreshTTL, &opts.RefreshTTL}} {
+		if ttl.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(ttl.value)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid %s %q: use a positive duration such as 15m or 720h", ttl.name, ttl.value)
+		}
+		*ttl.dest = d
+	}
+	return opts, nil
+}
+
+// authPermissions returns the permissions of the models, by model name and action: those set on the models,
+// overridden by those configured by cfg, whose models are named by model or table name.
+func authPermissions(cfg config.AuthConfig, defs []*model.ModelDefinition) (map[string]map[string][]string, error) {
+	permissions := make(map[string]map[string][]string)
+	for _, def := range defs {
+		for action, roles := range def.Options.Permissions {
+			if permissions[def.Name] == nil {
+				permissions[def.Name] = make(map[string][]string)
+			}
+			permissions[def.Name][action] = roles
+		}
+	}
+	for name, actions := range cfg.Permissions {
+		var def *model.ModelDefinition
+		for _, d := range defs {
+			if strings.EqualFold(d.Name, name) || model.TableName(d) == name {
+				def = d
+			}
+		}
+		if def == nil {
+			return nil, fmt.Errorf("invalid auth.permissions: unknown model %q", name)
+		}
+		// check validates the configured permissions without changing the model.
+		check := model.ModelDefinition{Name: def.Name}
+		for action, value := range actions {
+			roles := parseRoles(value)
+			if err := check.SetPermission(action, roles); err != nil {
+				return nil, fmt.Errorf("invalid auth.permissions of %s: %w", name, err)
+			}
+			if permissions[def.Name] == nil {
+				permissions[def.Name] = make(map[string][]string)
+			}
+			if len(roles) == 0 {
+				delete(permissions[def.Name], action)
+			} else {
+				permissions[def.Name][action] = roles
+			}
+		}
+	}
+	for name, actions := range permissions {
+		if len(actions) == 0 {
+			delete(permissions, name)
+		}
+	}
+	return permissions, nil
+}
+
+func runAuthGenerate(cmd *cobra.Command, args []string) error {
+	appName, _ := cmd.Flags().GetString("app")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	root := ""
+	if appName != "" {
+		if root, err = resolveAppDir(appName); err != nil {
+			return err
+		}
+	}
+	opts, err := authOptions(cfg.Auth, path.Join(root, "internal", "auth"))
+	if err != nil {
+		return err
+	}
+	modelName := cfg.Auth.Model
+	if modelName == "" {
+		modelName = "User"
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	existing, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return err
+	}
+	if opts.Permissions, err = authPermissions(cfg.Auth, existing); err != nil {
+		return err
+	}
+	var userDef *model.ModelDefinition
+	for _, def := range existing {
+		if def.Name == modelName {
+			userDef = def
+		}
+	}
+	create := userDef == nil
+	if create {
+		userDef = model.NewUserModel(modelName)
+		strategy, err := namingStrategy()
+		if err != nil {
+			return err
+		}
+		if err := userDef.SetTable(strategy.TableName(modelName)); err != nil {
+			return err
+		}
+	} else if err := model.CheckUserModel(userDef); err != nil {
+		return err
+	}
+	if err := enforcePolicies(enforcement.Generate, []*model.ModelDefinition{userDef}, nil); err != nil {
+		return err
+	}
+	if create {
+		if err := createModelDefinition(conn, userDef); err != nil {
+			return fmt.Errorf("failed to create model %s: %w", modelName, err)
+		}
+		log.Infof("Created model %s; create its table with:", modelName)
+		fmt.Print((&model.ModelManager{}).GenerateMigration(userDef))
+	}
+
+	fsys := filesystem.NewOSFS("")
+	manifest, err := loadManifest(fsys)
+	if err != nil {
+		return fmt.Errorf("failed to load generation manifest: %w", err)
+	}
+	defer saveManifest(fsys, manifest)
+
+	authArtifact := model.AuthArtifact(modelName, opts)
+	for _, artifact := range []model.Artifact{model.GoArtifact(modelName, path.Join(root, "internal", "models")), authArtifact} {
+		files, err := generateArtifact(fsys, manifest, artifact, userDef)
+		if err != nil {
+			return fmt.Errorf("failed to generate %s for %s: %w", artifact.Generator, modelName, err)
+		}
+		for _, file := range files {
+			log.Infof("Wrote %s", file.Path)
+		}
+	}
+	if goMod, err := fsys.ReadFile(path.Join(root, "go.mod")); err == nil && !strings.Contains(string(goMod), "golang.org/x/crypto") {
+		log.Warn("The auth package hashes passwords with golang.org/x/crypto/bcrypt; add it with: go get golang.org/x/crypto")
+	}
+	log.Infof("Set %s to a random key of at least 32 bytes, then call auth.New(db), Register its endpoints and wrap handlers with its Middleware",
+		authArtifact.Params["secret_env"])
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/ooyeku/grayv-lsm/pkg/config"
 	"github.com/ooyeku/grayv-lsm/pkg/logging"
 	"github.com/spf13/cobra"
+	"os"
 	"strconv"
 	"strings"
 )
@@ -20,61 +21,213 @@ var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Manage Grayv LSM configuration",
 	Long:  `View or edit the Grayv LSM configuration settings.`,
+	// The config commands load the configuration themselves, so they can fix one that fails to load.
+	Annotations: map[string]string{configOptional: "true"},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a starter configuration file",
+	Long: `Writes a configuration file holding the default settings to the path in GRAVORM_CONFIG_PATH, or to the
+current directory when it is not set. When the path is a directory, the file is named config.<format>.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		force, _ := cmd.Flags().GetBool("force")
+
+		file, err := config.InitConfig(strings.ToLower(format), force)
+		if err != nil {
+			return err
+		}
+		configLogger.Info(fmt.Sprintf("Configuration written to %s", file))
+		return nil
+	},
 }
 
 var configGetCmd = &cobra.Command{
-	Use:   "get [key]",
-	Short: "Get a configuration value",
-	Args:  cobra.ExactArgs(1),
-	Run:   runConfigGet,
+	Use:          "get [key]",
+	Short:        "Get a configuration value",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runConfigGet,
+}
+
+var configDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the configuration with another environment's",
+	Long: `Compares the local effective configuration, with its defaults, with the configuration of another
+environment and lists the settings that differ, by dotted path such as Database.Host. The values of passwords,
+encryption keys and API keys are redacted; secret references are compared as references.
+
+--against reads the other configuration from:
+  NAME                         config.NAME.yaml (.yml, .toml, .json) or .env.NAME next to the local configuration
+  PATH                         a configuration file, or a .env file of GRAYV_* variables
+  k8s:[NAMESPACE/]SECRET[#KEY] a Kubernetes secret, read with kubectl, holding a configuration file or GRAYV_* variables
+  https://...                  a configuration served over HTTP, with the token of --token-env as bearer token
+
+Settings read from environment variables are compared by variable name, e.g. GRAYV_DATABASE_HOST.`,
+	Example: `  grayv-lsm config diff --against prod
+  grayv-lsm config diff --against k8s:prod/grayv-config --ignore 'Database.Host' --exit-code
+  grayv-lsm config diff --against https://config.example.com/grayv.yaml --token-env CONFIG_TOKEN`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runConfigDiff,
+}
+
+var configEnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Render the configuration as environment variables",
+	Long: `Renders the effective configuration, with its defaults, as environment variables named after the settings,
+e.g. GRAYV_DATABASE_HOST for Database.Host, which override the configuration file when set. Lists are
+comma-separated.
+
+--format dotenv renders a .env file; --format k8s renders a Kubernetes ConfigMap holding the settings and a
+Secret holding the passwords, encryption keys and API keys, to load into a container with envFrom. Secrets
+are rendered as configured, as references where they are, unless --resolve-secrets is given.`,
+	Example: `  grayv-lsm config env > .env.prod
+  grayv-lsm config env --format k8s --name grayv --namespace prod | kubectl apply -f -`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runConfigEnv,
 }
 
 var configSetCmd = &cobra.Command{
-	Use:   "set [key] [value]",
-	Short: "Set a configuration value",
-	Args:  cobra.ExactArgs(2),
-	Run:   runConfigSet,
+	Use:          "set [key] [value]",
+	Short:        "Set a configuration value",
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE:         runConfigSet,
 }
 
 func init() {
+	configCmd.AddCommand(configInitCmd)
 	configCmd.AddCommand(configGetCmd)
 	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configDiffCmd)
+	configCmd.AddCommand(configEnvCmd)
 	RootCmd.AddCommand(configCmd)
+
+	configInitCmd.Flags().String("format", "", "Format of the config file: json, yaml, or toml (default json)")
+	configInitCmd.Flags().Bool("force", false, "Overwrite an existing config file")
+	configDiffCmd.Flags().String("against", "", "Environment to compare with: a name, a file, k8s:[NAMESPACE/]SECRET[#KEY] or a URL")
+	configDiffCmd.Flags().StringSlice("ignore", []string{}, "Comma-separated glob patterns of settings not to compare, e.g. \"Databases.*.Host\"")
+	configDiffCmd.Flags().String("token-env", "", "Environment variable holding the bearer token of an HTTP --against")
+	configDiffCmd.Flags().Bool("exit-code", false, "Exit with an error when the configurations differ")
+	configDiffCmd.MarkFlagRequired("against")
+	configEnvCmd.Flags().String("format", "dotenv", "Format to render: dotenv or k8s")
+	configEnvCmd.Flags().String("name", "grayv-config", "Name of the Kubernetes ConfigMap and Secret")
+	configEnvCmd.Flags().String("namespace", "", "Namespace of the Kubernetes ConfigMap and Secret")
+	configEnvCmd.Flags().Bool("resolve-secrets", false, "Render the values secret references resolve to instead of the references")
 }
 
-func runConfigGet(cmd *cobra.Command, args []string) {
+func runConfigGet(cmd *cobra.Command, args []string) error {
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		// TODO: improve this
-		configLogger.Error(fmt.Sprintf("Error loading config: %v", err))
-		return
+		return fmt.Errorf("error loading config: %w", err)
 	}
 
 	value := getConfigValue(cfg, args[0])
-	if value != "" {
-		configLogger.Info(fmt.Sprintf("%s: %s", args[0], value))
-	} else {
-		configLogger.Warn(fmt.Sprintf("Configuration key '%s' not found", args[0]))
+	if value == "" {
+		return fmt.Errorf("configuration key '%s' not found", args[0])
 	}
+	return printResult(map[string]string{"key": args[0], "value": value}, func() {
+		configLogger.Info(fmt.Sprintf("%s: %s", args[0], value))
+	})
 }
 
-func runConfigSet(cmd *cobra.Command, args []string) {
+func runConfigDiff(cmd *cobra.Command, args []string) error {
+	against, _ := cmd.Flags().GetString("against")
+	ignore, _ := cmd.Flags().GetStringSlice("ignore")
+	tokenEnv, _ := cmd.Flags().GetString("token-env")
+	exitCode, _ := cmd.Flags().GetBool("exit-code")
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		configLogger.Error(fmt.Sprintf("Error loading config: %v", err))
-		return
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	token := ""
+	if tokenEnv != "" {
+		if token = os.Getenv(tokenEnv); token == "" {
+			return fmt.Errorf("environment variable %s is not set", tokenEnv)
+		}
+	}
+	other, err := config.LoadEnvironment(against, token)
+	if err != nil {
+		return err
+	}
+	differences, err := config.Diff(cfg, other, ignore)
+	if err != nil {
+		return err
 	}
 
-	if setConfigValue(cfg, args[0], args[1]) {
-		err = config.SaveConfig(cfg)
-		if err != nil {
-			configLogger.Error(fmt.Sprintf("Error saving config: %v", err))
+	if err := printResult(differences, func() {
+		if len(differences) == 0 {
+			configLogger.Info(fmt.Sprintf("The configuration matches %s", other.Name))
 			return
 		}
-		configLogger.Info(fmt.Sprintf("Configuration updated: %s = %s", args[0], args[1]))
-	} else {
-		configLogger.Warn(fmt.Sprintf("Configuration key '%s' not found", args[0]))
+		for _, d := range differences {
+			switch d.Status {
+			case config.DiffChanged:
+				fmt.Printf("~ %s: %s -> %s\n", d.Key, d.Local, d.Other)
+			case config.DiffLocalOnly:
+				fmt.Printf("- %s: %s (not set in %s)\n", d.Key, d.Local, against)
+			case config.DiffOtherOnly:
+				fmt.Printf("+ %s: %s (only set in %s)\n", d.Key, d.Other, against)
+			}
+		}
+		configLogger.Info(fmt.Sprintf("%d setting(s) differ from %s", len(differences), other.Name))
+	}); err != nil {
+		return err
+	}
+	if exitCode && len(differences) > 0 {
+		return fmt.Errorf("the configuration differs from %s", other.Name)
+	}
+	return nil
+}
+
+func runConfigEnv(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	name, _ := cmd.Flags().GetString("name")
+	namespace, _ := cmd.Flags().GetString("namespace")
+	resolveSecrets, _ := cmd.Flags().GetBool("resolve-secrets")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	vars := cfg.EnvVars(resolveSecrets)
+
+	var rendered string
+	switch strings.ToLower(format) {
+	case "dotenv":
+		rendered = config.RenderDotenv(vars)
+	case "k8s":
+		if rendered, err = config.RenderKubernetes(vars, name, namespace); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported format %q (expected \"dotenv\" or \"k8s\")", format)
 	}
+	return printResult(vars, func() {
+		fmt.Print(rendered)
+	})
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	if err := setConfigValue(cfg, args[0], args[1]); err != nil {
+		return err
+	}
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("error saving config: %w", err)
+	}
+	configLogger.Info(fmt.Sprintf("Configuration updated: %s = %s", args[0], args[1]))
+	return nil
 }
 
 func getConfigValue(cfg *config.Config, key string) string {
@@ -89,10 +242,16 @@ func getConfigValue(cfg *config.Config, key string) string {
 		return cfg.Database.User
 	case "database.password":
 		return cfg.Database.Password
+	case "database.passwordfile":
+		return cfg.Database.PasswordFile
 	case "database.name":
 		return cfg.Database.Name
 	case "database.sslmode":
 		return cfg.Database.SSLMode
+	case "database.statementtimeout":
+		return cfg.Database.StatementTimeout
+	case "database.slowquerythreshold":
+		return cfg.Database.SlowQueryThreshold
 	case "server.host":
 		return cfg.Server.Host
 	case "server.port":
@@ -101,46 +260,79 @@ func getConfigValue(cfg *config.Config, key string) string {
 		return cfg.Logging.Level
 	case "logging.file":
 		return cfg.Logging.File
+	case "logging.format":
+		return cfg.Logging.Format
+	case "logging.maxsize":
+		return fmt.Sprintf("%d", cfg.Logging.MaxSize)
+	case "logging.maxage":
+		return cfg.Logging.MaxAge
+	case "logging.maxbackups":
+		return fmt.Sprintf("%d", cfg.Logging.MaxBackups)
 	case "database.containername":
 		return cfg.Database.ContainerName
+	case "naming.tables":
+		return cfg.Naming.Tables
 	default:
 		return ""
 	}
 }
 
-func setConfigValue(cfg *config.Config, key, value string) bool {
+// setConfigValue sets the setting of the configuration named by key, returning an error for an unknown key, or
+// a value that is not a number for a numeric setting.
+func setConfigValue(cfg *config.Config, key, value string) error {
 	switch strings.ToLower(key) {
 	case "database.driver":
 		cfg.Database.Driver = value
 	case "database.host":
 		cfg.Database.Host = value
 	case "database.port":
-		cfg.Database.Port = parseInt(value)
+		return setInt(&cfg.Database.Port, key, value)
 	case "database.user":
 		cfg.Database.User = value
 	case "database.password":
 		cfg.Database.Password = value
+	case "database.passwordfile":
+		cfg.Database.PasswordFile = value
 	case "database.name":
 		cfg.Database.Name = value
 	case "database.sslmode":
 		cfg.Database.SSLMode = value
+	case "database.statementtimeout":
+		cfg.Database.StatementTimeout = value
+	case "database.slowquerythreshold":
+		cfg.Database.SlowQueryThreshold = value
 	case "server.host":
 		cfg.Server.Host = value
 	case "server.port":
-		cfg.Server.Port = parseInt(value)
+		return setInt(&cfg.Server.Port, key, value)
 	case "logging.level":
 		cfg.Logging.Level = value
 	case "logging.file":
 		cfg.Logging.File = value
+	case "logging.format":
+		cfg.Logging.Format = value
+	case "logging.maxsize":
+		return setInt(&cfg.Logging.MaxSize, key, value)
+	case "logging.maxage":
+		cfg.Logging.MaxAge = value
+	case "logging.maxbackups":
+		return setInt(&cfg.Logging.MaxBackups, key, value)
 	case "database.containername":
 		cfg.Database.ContainerName = value
+	case "naming.tables":
+		cfg.Naming.Tables = value
 	default:
-		return false
+		return fmt.Errorf("configuration key '%s' not found", key)
 	}
-	return true
+	return nil
 }
 
-func parseInt(value string) int {
-	i, _ := strconv.Atoi(value)
-	return i
+// setInt sets the numeric setting named by key to value, which must be an integer.
+func setInt(setting *int, key, value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid value %q of %s: expected an integer", value, key)
+	}
+	*setting = i
+	return nil
 }
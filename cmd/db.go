@@ -1,18 +1,37 @@
 package cmd
 
 import (
+	"context"
+	"database/sql"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
 
 	"fmt"
+	"github.com/ooyeku/grayv-lsm/internal/database/datadiff"
+	"github.com/ooyeku/grayv-lsm/internal/database/ephemeral"
+	"github.com/ooyeku/grayv-lsm/internal/database/export"
+	"github.com/ooyeku/grayv-lsm/internal/database/hot"
+	"github.com/ooyeku/grayv-lsm/internal/database/integrity"
+	"github.com/ooyeku/grayv-lsm/internal/database/keyrotation"
 	"github.com/ooyeku/grayv-lsm/internal/database/lsm"
 	"github.com/ooyeku/grayv-lsm/internal/database/migration"
+	"github.com/ooyeku/grayv-lsm/internal/database/multidb"
+	"github.com/ooyeku/grayv-lsm/internal/database/sample"
 	"github.com/ooyeku/grayv-lsm/internal/database/seed"
+	"github.com/ooyeku/grayv-lsm/internal/database/sessions"
+	"github.com/ooyeku/grayv-lsm/internal/database/transfer"
+	"github.com/ooyeku/grayv-lsm/internal/model"
 	"github.com/ooyeku/grayv-lsm/internal/orm"
 	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/ooyeku/grayv-lsm/pkg/encryption"
+	"github.com/ooyeku/grayv-lsm/pkg/logging"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 var dbManager *lsm.DBLifecycleManager
@@ -27,13 +46,48 @@ func init() {
 	})
 	log.SetOutput(os.Stdout)
 	log.SetLevel(logrus.InfoLevel)
-	var err error
-	cfg, err = config.LoadConfig()
+	logging.Register(log)
+}
+
+// configOptional is the annotation of the commands that run without the configuration, or load it themselves
+// such as those of "config", which must be able to fix a configuration that fails to load.
+const configOptional = "config_optional"
+
+// loadConfig loads the configuration into cfg, creating dbManager and registering the custom field types it
+// configures. It runs before a command does rather than at startup, so that the secrets the configuration
+// references are not resolved for --help or mistyped commands; the error it returns is only reported for the
+// commands that need the configuration, see requiresConfig.
+func loadConfig(cmd *cobra.Command) error {
+	if cfg != nil {
+		return nil
+	}
+	loaded, err := config.LoadConfig()
 	if err != nil {
-		log.WithError(err).Error("Error loading config")
-	} else {
-		dbManager = lsm.NewDBLifecycleManager(cfg)
+		if !requiresConfig(cmd) {
+			log.WithError(err).Debug("Error loading config")
+			return nil
+		}
+		return fmt.Errorf("error loading config: %w", err)
 	}
+	cfg = loaded
+	dbManager = lsm.NewDBLifecycleManager(cfg)
+	registerCustomTypes(cfg)
+	return nil
+}
+
+// requiresConfig reports whether cmd needs the configuration: it and its parents are not annotated with
+// configOptional, and it is not one of the help and completion commands of cobra.
+func requiresConfig(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		switch c.Name() {
+		case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+			return false
+		}
+		if c.Annotations[configOptional] == "true" {
+			return false
+		}
+	}
+	return true
 }
 
 var dbCmd = &cobra.Command{
@@ -90,75 +144,114 @@ var removeCmd = &cobra.Command{
 	},
 }
 
+// dbStatus is the result of the status command.
+type dbStatus struct {
+	Status  string               `json:"status"`
+	Running bool                 `json:"running"`
+	Empty   bool                 `json:"empty,omitempty"`
+	Metrics *orm.DatabaseMetrics `json:"metrics,omitempty"`
+}
+
 var statusCmd = &cobra.Command{
-	Use:   "status",
-	Short: "Check the health and status of the database",
-	Run: func(cmd *cobra.Command, args []string) {
+	Use:          "status",
+	Short:        "Check the health and status of the database",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		status, err := dbManager.GetStatus()
 		if err != nil {
-			log.WithError(err).Error("Error checking database status")
-			return
+			return fmt.Errorf("error checking database status: %w", err)
 		}
+		result := dbStatus{Status: status, Running: strings.Contains(status, "Container is running")}
 
-		log.Info(status)
-
-		if strings.Contains(status, "Container is running") {
+		if result.Running {
 			conn, err := orm.NewConnection(&cfg.Database)
 			if err != nil {
-				log.WithError(err).Error("Error connecting to database")
-				return
+				return fmt.Errorf("error connecting to database: %w", err)
 			}
 			defer conn.Close()
 
-			metrics, err := conn.GetDatabaseMetrics()
+			result.Metrics, err = conn.GetDatabaseMetrics()
 			if err != nil {
-				if strings.Contains(err.Error(), "converting NULL to float64 is unsupported") {
-					log.Info("Database is empty. No tables or data found.")
-				} else {
-					log.WithError(err).Error("Error fetching database metrics")
+				if !strings.Contains(err.Error(), "converting NULL to float64 is unsupported") {
+					return fmt.Errorf("error fetching database metrics: %w", err)
 				}
-				return
+				result.Metrics, result.Empty = nil, true
 			}
-
-			log.Info("Database Metrics:")
-			log.Infof("- Number of tables: %d", metrics.TableCount)
-			log.Infof("- Database size: %s", metrics.DatabaseSize)
-			log.Infof("- Active connections: %d", metrics.ActiveConnections)
-			log.Infof("- Uptime: %s", metrics.Uptime)
-			log.Infof("- Transactions (commits/rollbacks): %d/%d", metrics.Commits, metrics.Rollbacks)
-			log.Infof("- Cache hit ratio: %.2f%%", metrics.CacheHitRatio)
-			log.Infof("- Slow queries (last hour): %d", metrics.SlowQueryCount)
 		}
+
+		return printResult(result, func() {
+			log.Info(status)
+			if result.Empty {
+				log.Info("Database is empty. No tables or data found.")
+			}
+			if metrics := result.Metrics; metrics != nil {
+				log.Info("Database Metrics:")
+				log.Infof("- Number of tables: %d", metrics.TableCount)
+				log.Infof("- Database size: %s", metrics.DatabaseSize)
+				log.Infof("- Active connections: %d", metrics.ActiveConnections)
+				log.Infof("- Uptime: %s", metrics.Uptime)
+				log.Infof("- Transactions (commits/rollbacks): %d/%d", metrics.Commits, metrics.Rollbacks)
+				log.Infof("- Cache hit ratio: %.2f%%", metrics.CacheHitRatio)
+				log.Infof("- Slow queries (last hour): %d", metrics.SlowQueryCount)
+			}
+		})
 	},
 }
 
 var seedCmd = &cobra.Command{
-	Use:   "seed",
-	Short: "Seed the database with initial data",
-	Run: func(cmd *cobra.Command, args []string) {
-		err := withDBConnection(func(conn *orm.Connection) error {
-			seeder := seed.NewSeeder(conn.GetDB())
-			if err := seeder.LoadSeeds(); err != nil {
-				return fmt.Errorf("error loading seeds: %w", err)
-			}
-			return seeder.Seed()
-		})
-		if err != nil {
-			log.WithError(err).Error("Error seeding database")
-		} else {
-			log.Info("Database seeded successfully")
+	Use:          "seed",
+	Short:        "Seed the database with initial data",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		workers, _ := cmd.Flags().GetInt("workers")
+		if workers < 1 {
+			return fmt.Errorf("--workers must be at least 1")
+		}
+		run := seedDatabaseWith(dir, workers)
+		steps := []multidb.Step{{Name: "seed", Run: run}}
+		if ephemeralDB, _ := cmd.Flags().GetBool("ephemeral"); ephemeralDB {
+			// The tables of the seeds do not exist in the empty database yet.
+			steps = append([]multidb.Step{{Name: "migrate", Run: migrateDatabase}}, steps...)
+		}
+		if handled, err := runOnTargets(cmd, steps); handled {
+			return err
 		}
+
+		if err := withDBConnection(cmd.Context(), run); err != nil {
+			return fmt.Errorf("error seeding database: %w", err)
+		}
+		log.Info("Database seeded successfully")
+		return nil
 	},
 }
 
 var migrateCmd = &cobra.Command{
-	Use:   "migrate",
-	Short: "Run database migrations",
-	Run: func(cmd *cobra.Command, args []string) {
+	Use:          "migrate",
+	Short:        "Run database migrations",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		withSeed, _ := cmd.Flags().GetBool("seed")
+		phaseName, _ := cmd.Flags().GetString("phase")
+		migrate := migrateDatabase
+		if phaseName != "" {
+			phase, err := migration.ParsePhase(phaseName)
+			if err != nil {
+				return err
+			}
+			migrate = migrateDatabasePhase(phase)
+		}
+		steps := []multidb.Step{{Name: "migrate", Run: migrate}}
+		if withSeed {
+			steps = append(steps, multidb.Step{Name: "seed", Run: seedDatabase})
+		}
+		if handled, err := runOnTargets(cmd, steps); handled {
+			return err
+		}
+
 		conn, err := orm.NewConnection(&cfg.Database)
 		if err != nil {
-			log.WithError(err).Error("Error connecting to database")
-			return
+			return fmt.Errorf("error connecting to database: %w", err)
 		}
 		defer func(conn *orm.Connection) {
 			err := conn.Close()
@@ -167,22 +260,208 @@ var migrateCmd = &cobra.Command{
 			}
 		}(conn)
 
-		migrator := migration.NewMigrator(conn.GetDB(), log)
-		err = migrator.LoadMigrations()
+		if err := migrate(cmd.Context(), conn); err != nil {
+			if phaseName != "" {
+				return fmt.Errorf("error running %s migrations: %w", phaseName, err)
+			}
+			return fmt.Errorf("error running migrations: %w", err)
+		}
+		log.Info("Database migrations completed successfully")
+		writeSchemaSnapshot(cmd, conn)
+
+		if withSeed {
+			if err := seedDatabase(cmd.Context(), conn); err != nil {
+				return fmt.Errorf("error seeding database: %w", err)
+			}
+			log.Info("Database seeded successfully")
+		}
+		return nil
+	},
+}
+
+// migrateLintResult is the result of the migrate lint command.
+type migrateLintResult struct {
+	Migrations []migrationPhase `json:"migrations"`
+	Issues     []migrationIssue `json:"issues"`
+}
+
+type migrationPhase struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+}
+
+type migrationIssue struct {
+	Migration string `json:"migration"`
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+}
+
+var migrateLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check migrations for dangerous operations before they run",
+	Long: `Lists every migration with its expand/contract phase and reports, without running them:
+  - errors: breaking the previous application version in a phase where it may still be running
+    (expand-contract), dropping a table or column (drop-table, drop-column), truncating a table (truncate),
+    adding a NOT NULL column without a default (not-null-without-default),
+  - warnings: operations holding a lock on a table for as long as they scan or rewrite it, such as creating an
+    index without CONCURRENTLY (index-not-concurrent), setting a column NOT NULL (set-not-null), adding a
+    constraint that is checked or builds an index (validating-constraint), or rewriting a table (rewrite-table),
+  - infos: constraints added NOT VALID, to validate in a later migration (not-valid-constraint).
+Operations on tables created by the same migration are not reported, except drops. A migration allows a rule
+it breaks on purpose with an "-- Allow: drop-column" directive. The command fails on errors, and with --strict,
+meant for CI, on warnings too.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		strict, _ := cmd.Flags().GetBool("strict")
+
+		migrator := migration.NewMigrator(nil, log)
+		if dir != "" {
+			migrator = migration.NewMigratorDir(nil, log, dir)
+		}
+		if err := migrator.LoadMigrations(); err != nil {
+			return fmt.Errorf("error loading migrations: %w", err)
+		}
+
+		issues := append(migrator.LintPhases(), migrator.LintSafety()...)
+		result := migrateLintResult{Migrations: []migrationPhase{}, Issues: []migrationIssue{}}
+		for _, m := range migrator.Migrations() {
+			result.Migrations = append(result.Migrations, migrationPhase{Name: m.Name, Phase: string(m.Phase)})
+		}
+		failing := 0
+		for _, issue := range issues {
+			result.Issues = append(result.Issues, migrationIssue{Migration: issue.Migration, Rule: issue.Rule,
+				Severity: string(issue.Severity), Message: issue.Message})
+			if issue.Severity == migration.SeverityError || strict && issue.Severity == migration.SeverityWarning {
+				failing++
+			}
+		}
+
+		err := printResult(result, func() {
+			for _, m := range result.Migrations {
+				log.Infof("- %s (%s)", m.Name, m.Phase)
+			}
+			for _, issue := range issues {
+				switch issue.Severity {
+				case migration.SeverityError:
+					log.Errorf("%s [%s]", issue, issue.Rule)
+				case migration.SeverityWarning:
+					log.Warnf("%s [%s]", issue, issue.Rule)
+				default:
+					log.Infof("%s [%s]", issue, issue.Rule)
+				}
+			}
+			if len(issues) == 0 {
+				log.Info("Migrations are safe to run")
+			}
+		})
 		if err != nil {
-			log.WithError(err).Error("Error loading migrations")
-			return
+			return err
 		}
+		if failing > 0 {
+			return fmt.Errorf("%d migration issue(s) found", failing)
+		}
+		return nil
+	},
+}
 
-		err = migrator.Migrate()
+var migrateImpactCmd = &cobra.Command{
+	Use:   "impact",
+	Short: "Estimate the impact of the pending migrations before applying them",
+	Long: `Estimates the impact of applying the pending migrations, without running them: for every statement, the
+table it alters, the lock it holds until the migration commits, whether it rewrites or scans the table, the
+size of the table from the catalog statistics and, for UPDATE, DELETE and INSERT, the rows EXPLAIN expects it
+to write. Statements that rewrite or scan a table larger than --large-table under a lock blocking writes, or
+that write more than --large-update rows, need a maintenance window. Run ANALYZE first for fresh statistics.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		largeTable, _ := cmd.Flags().GetInt64("large-table")
+		largeUpdate, _ := cmd.Flags().GetInt64("large-update")
+
+		conn, err := getDBConnection()
 		if err != nil {
-			log.WithError(err).Error("Error running migrations")
-		} else {
-			log.Info("Database migrations completed successfully")
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		migrator := migration.NewMigrator(conn.GetDB(), log)
+		if err := migrator.LoadMigrations(); err != nil {
+			return fmt.Errorf("error loading migrations: %w", err)
+		}
+		pending, err := migrator.PendingMigrations(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("error listing pending migrations: %w", err)
+		}
+		impact, err := migration.EstimateImpact(cmd.Context(), migration.NewCatalog(conn.GetDB()), pending,
+			migration.ImpactOptions{LargeTableBytes: largeTable << 20, LargeUpdateRows: largeUpdate})
+		if err != nil {
+			return err
 		}
+		return printResult(impact, func() {
+			if len(pending) == 0 {
+				log.Info("No pending migrations")
+				return
+			}
+			if len(impact.Statements) > 0 {
+				tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "MIGRATION\tTABLE\tOPERATION\tLOCK\tBLOCKS\tEFFECT\tROWS\tSIZE")
+				for _, si := range impact.Statements {
+					blocks := "-"
+					if migration.BlocksReads(si.Lock) {
+						blocks = "reads, writes"
+					} else if migration.BlocksWrites(si.Lock) {
+						blocks = "writes"
+					}
+					effect := "brief"
+					switch {
+					case si.Rewrite:
+						effect = "rewrite"
+					case si.Scan:
+						effect = "scan"
+					case si.AffectedRows > 0:
+						effect = fmt.Sprintf("writes ~%d rows", si.AffectedRows)
+					case si.AffectedRows < 0:
+						effect = "writes ? rows"
+					}
+					rows, size := strconv.FormatInt(si.Rows, 10), formatBytes(si.Bytes)
+					if si.NewTable {
+						rows, size = "new", "new"
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", si.Migration, si.Table, si.Operation, si.Lock, blocks, effect, rows, size)
+				}
+				tw.Flush()
+			}
+			for _, si := range impact.Statements {
+				if si.Window != "" {
+					log.Warnf("%s: %s %s %s", si.Migration, si.Operation, si.Table, si.Window)
+				}
+			}
+			if impact.MaintenanceWindow {
+				log.Warnf("Schedule a maintenance window to apply the %d pending migration(s)", len(pending))
+			} else {
+				log.Infof("The %d pending migration(s) need no maintenance window: their locks are brief or do not block writes", len(pending))
+			}
+		})
 	},
 }
 
+// formatBytes formats a size in bytes with a binary unit, e.g. 1.5 GB.
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
 var rollbackCmd = &cobra.Command{
 	Use:   "rollback [steps]",
 	Short: "Rollback database migrations",
@@ -217,23 +496,24 @@ var rollbackCmd = &cobra.Command{
 			return
 		}
 
-		err = migrator.Rollback(steps)
+		err = recordRun("rollback", func() error { return migrator.Rollback(cmd.Context(), steps) })
 		if err != nil {
 			log.WithError(err).Error("Error rolling back migrations")
 		} else {
 			log.Infof("Rolled back %d migration(s) successfully", steps)
+			writeSchemaSnapshot(cmd, conn)
 		}
 	},
 }
 
 var listTablesCmd = &cobra.Command{
-	Use:   "list-tables",
-	Short: "List all tables in the database",
-	Run: func(cmd *cobra.Command, args []string) {
+	Use:          "list-tables",
+	Short:        "List all tables in the database",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		conn, err := orm.NewConnection(&cfg.Database)
 		if err != nil {
-			log.WithError(err).Error("Error connecting to database")
-			return
+			return fmt.Errorf("error connecting to database: %w", err)
 		}
 		defer func(conn *orm.Connection) {
 			err := conn.Close()
@@ -244,21 +524,707 @@ var listTablesCmd = &cobra.Command{
 
 		tables, err := conn.ListTables()
 		if err != nil {
-			log.WithError(err).Error("Error listing tables")
-			return
+			return fmt.Errorf("error listing tables: %w", err)
 		}
+		if tables == nil {
+			tables = []string{}
+		}
+
+		return printResult(tables, func() {
+			if len(tables) == 0 {
+				log.Info("No tables found in the database")
+			} else {
+				log.Info("Tables in the database:")
+				for _, table := range tables {
+					log.Infof("- %s", table)
+				}
+			}
+		})
+	},
+}
+
+// tableDiffSummary counts the rows of a table that differ between the databases compared by data-diff.
+type tableDiffSummary struct {
+	Table   string `json:"table"`
+	Missing int    `json:"only_in_from"`
+	Extra   int    `json:"only_in_against"`
+	Changed int    `json:"changed"`
+}
 
+var dataDiffCmd = &cobra.Command{
+	Use:   "data-diff",
+	Short: "Compare the rows of lookup tables between two configured databases",
+	Long: `Compares the rows of the tables matching --tables between the database given with --from (the primary
+database by default) and the one given with --against, matching rows by primary key. With --sql, a script
+that makes the --against database match the --from database is written to the given file ("-" for stdout).`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		patterns, _ := cmd.Flags().GetStringSlice("tables")
+		from, _ := cmd.Flags().GetString("from")
+		against, _ := cmd.Flags().GetString("against")
+		sqlFile, _ := cmd.Flags().GetString("sql")
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		sourceConfig, err := cfg.LookupDatabase(from)
+		if err != nil {
+			return err
+		}
+		targetConfig, err := cfg.LookupDatabase(against)
+		if err != nil {
+			return err
+		}
+
+		source, err := orm.NewConnection(sourceConfig)
+		if err != nil {
+			return fmt.Errorf("error connecting to %s: %w", from, err)
+		}
+		defer source.Close()
+		target, err := orm.NewConnection(targetConfig)
+		if err != nil {
+			return fmt.Errorf("error connecting to %s: %w", against, err)
+		}
+		defer target.Close()
+
+		tables, err := source.ListTables()
+		if err != nil {
+			return fmt.Errorf("error listing tables of %s: %w", from, err)
+		}
+		tables, err = datadiff.MatchTables(tables, patterns)
+		if err != nil {
+			return err
+		}
 		if len(tables) == 0 {
-			log.Info("No tables found in the database")
-		} else {
-			log.Info("Tables in the database:")
-			for _, table := range tables {
-				log.Infof("- %s", table)
+			return fmt.Errorf("no tables of %s match %v", from, patterns)
+		}
+
+		if sqlFile == "-" && outputFormat == outputJSON {
+			return fmt.Errorf("--sql - cannot be combined with --output json; write the script to a file")
+		}
+
+		var diffs []*datadiff.TableDiff
+		summary := []tableDiffSummary{}
+		for _, table := range tables {
+			sourceData, err := datadiff.LoadTable(source.GetDB(), table)
+			if err != nil {
+				return err
+			}
+			targetData, err := datadiff.LoadTable(target.GetDB(), table)
+			if err != nil {
+				return fmt.Errorf("%s: %w", against, err)
+			}
+			diff, err := datadiff.Diff(sourceData, targetData)
+			if err != nil {
+				return err
+			}
+			diffs = append(diffs, diff)
+			summary = append(summary, tableDiffSummary{Table: table, Missing: len(diff.Missing), Extra: len(diff.Extra), Changed: len(diff.Changed)})
+		}
+		err = printResult(summary, func() {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "TABLE\tONLY IN "+strings.ToUpper(from)+"\tONLY IN "+strings.ToUpper(against)+"\tCHANGED")
+			for _, s := range summary {
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", s.Table, s.Missing, s.Extra, s.Changed)
+			}
+			tw.Flush()
+		})
+		if err != nil {
+			return err
+		}
+
+		if sqlFile == "" {
+			return nil
+		}
+		if sqlFile == "-" {
+			return datadiff.WriteSyncSQL(os.Stdout, diffs)
+		}
+		file, err := os.Create(sqlFile)
+		if err != nil {
+			return fmt.Errorf("error creating sync script: %w", err)
+		}
+		defer file.Close()
+		if err := datadiff.WriteSyncSQL(file, diffs); err != nil {
+			return fmt.Errorf("error writing sync script: %w", err)
+		}
+		log.Infof("Sync script for %s written to %s", against, sqlFile)
+		return nil
+	},
+}
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List transactions open longer than a threshold",
+	Long: `Lists the sessions of the database holding a transaction open for longer than --threshold, oldest first,
+with their state, the age of the transaction and of its last statement, and the statement's text. Sessions
+"idle in transaction" hold a transaction without running anything, which usually points to a leaked
+connection. Generated apps that set models.TagQueries tag their statements with the code calling the
+repository, reported as the caller; models.MonitorTransactions reports the same transactions at runtime.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		threshold, _ := cmd.Flags().GetDuration("threshold")
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		open, err := sessions.List(cmd.Context(), conn.GetDB(), threshold)
+		if err != nil {
+			return fmt.Errorf("failed to list sessions: %w", err)
+		}
+		return printResult(open, func() {
+			if len(open) == 0 {
+				log.Infof("No transaction open for longer than %s", threshold)
+				return
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "PID\tSTATE\tTRANSACTION\tSTATEMENT\tCALLER\tQUERY")
+			for _, s := range open {
+				query := strings.Join(strings.Fields(s.Query), " ")
+				if len(query) > 60 {
+					query = query[:57] + "..."
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", s.PID, s.State, s.TransactionAge, s.QueryAge, s.Caller, query)
+			}
+			tw.Flush()
+		})
+	},
+}
+
+var hotCmd = &cobra.Command{
+	Use:   "hot",
+	Short: "Show the busiest tables and queries over a sampling window",
+	Long: `Samples the statistics of the database for --window and lists the busiest tables, by scans and rows
+written, and, when the pg_stat_statements extension is installed, the queries that took the most time. Tables
+read mostly by sequential scans are candidates for an index, and tables read much more than written for a
+cache. Generated apps also count the reads and writes of their repositories per table, see models.Stats.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		window, _ := cmd.Flags().GetDuration("window")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		log.Infof("Sampling for %s", window)
+		report, err := hot.Sample(cmd.Context(), conn.GetDB(), window, limit)
+		if err != nil {
+			return fmt.Errorf("failed to sample activity: %w", err)
+		}
+		return printResult(report, func() {
+			if len(report.Tables) == 0 {
+				log.Infof("No table activity in %s", window)
+			} else {
+				tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "TABLE\tSEQ SCANS\tINDEX SCANS\tROWS READ\tINSERTS\tUPDATES\tDELETES")
+				for _, t := range report.Tables {
+					fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", t.Table, t.SeqScans, t.IdxScans, t.RowsRead, t.Inserts, t.Updates, t.Deletes)
+				}
+				tw.Flush()
+			}
+			if !report.Statements {
+				log.Info("Install the pg_stat_statements extension to also list the busiest queries")
+				return
+			}
+			if len(report.Queries) > 0 {
+				fmt.Println()
+				tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "CALLS\tTOTAL\tMEAN\tQUERY")
+				for _, q := range report.Queries {
+					query := strings.Join(strings.Fields(q.Query), " ")
+					if len(query) > 80 {
+						query = query[:77] + "..."
+					}
+					fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", q.Calls, q.Time.Round(time.Microsecond), q.Mean().Round(time.Microsecond), query)
+				}
+				tw.Flush()
+			}
+		})
+	},
+}
+
+var checkIntegrityCmd = &cobra.Command{
+	Use:   "check-integrity",
+	Short: "Find rows breaking the relations and unique or non-nullable fields of models",
+	Long: `Scans the tables of every model (or of the models given with --models) for orphaned rows, whose field
+references a missing row, NULLs in non-nullable fields, and duplicate values of unique fields. The database does
+not enforce these for legacy data loaded before the constraints were added; run this before adding them. With
+--fix-script, a script fixing the rows is written to the given file ("-" for stdout) for review: orphan
+references are set to NULL or their rows deleted, NULLs set to the field default or their rows deleted, and
+duplicates deleted, keeping the oldest row. The command fails when issues are found.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modelNames, _ := cmd.Flags().GetStringSlice("models")
+		fixScript, _ := cmd.Flags().GetString("fix-script")
+		if fixScript == "-" && outputFormat == outputJSON {
+			return fmt.Errorf("--fix-script - cannot be combined with --output json; write the script to a file")
+		}
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		modelDefs, err := fetchAllModelDefinitions(conn)
+		if err != nil {
+			return err
+		}
+		checks, err := integrity.Checks(modelDefs)
+		if err != nil {
+			return err
+		}
+		if len(modelNames) > 0 {
+			var selected []integrity.Check
+			for _, check := range checks {
+				if contains(modelNames, check.Model) {
+					selected = append(selected, check)
+				}
+			}
+			checks = selected
+		}
+
+		issues, err := integrity.Run(cmd.Context(), conn.GetDB(), checks)
+		if err != nil {
+			return err
+		}
+		err = printResult(issues, func() {
+			if len(issues) == 0 {
+				log.Infof("No integrity issues found in %d checks", len(checks))
+				return
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "KIND\tTABLE\tCOLUMN\tROWS")
+			for _, issue := range issues {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", issue.Kind, issue.Table, issue.Column, issue.Rows)
 			}
+			tw.Flush()
+		})
+		if err != nil || len(issues) == 0 {
+			return err
+		}
+
+		if fixScript == "-" {
+			if err := integrity.WriteFixScript(os.Stdout, issues); err != nil {
+				return err
+			}
+		} else if fixScript != "" {
+			file, err := os.Create(fixScript)
+			if err != nil {
+				return fmt.Errorf("error creating fix script: %w", err)
+			}
+			defer file.Close()
+			if err := integrity.WriteFixScript(file, issues); err != nil {
+				return fmt.Errorf("error writing fix script: %w", err)
+			}
+			log.Infof("Fix script written to %s", fixScript)
+		}
+		return fmt.Errorf("found %d integrity issue(s)", len(issues))
+	},
+}
+
+var rotateKeysCmd = &cobra.Command{
+	Use:   "rotate-keys",
+	Short: "Re-encrypt an encrypted model field under a new key",
+	Long: `Re-encrypts the values of an encrypted field (see "model update --encrypt-fields") under the key given
+with --key, the primary encryption key by default, in batches that are committed one at a time. Values stored
+in plaintext are encrypted. The keys the values are currently encrypted with must stay configured, so that
+applications reading the field keep working while the rotation runs. An interrupted rotation resumes where it
+stopped when run again; values written concurrently with the old key are rotated by the next run.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modelName, _ := cmd.Flags().GetString("model")
+		fieldName, _ := cmd.Flags().GetString("field")
+		keyID, _ := cmd.Flags().GetString("key")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		keyring, err := encryption.NewKeyring(cfg.Encryption.Keys, cfg.Encryption.Primary)
+		if err != nil {
+			return fmt.Errorf("invalid encryption config: %w", err)
+		}
+		if keyID == "" {
+			keyID = keyring.Primary()
+		}
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		modelDef, err := fetchModelDefinition(conn, modelName)
+		if err != nil {
+			return err
+		}
+		field := modelDef.Field(fieldName)
+		if field == nil {
+			return fmt.Errorf("model %s has no field %s", modelDef.Name, fieldName)
+		}
+		if !field.Encrypted {
+			return fmt.Errorf("field %s of model %s is not encrypted", field.Name, modelDef.Name)
+		}
+
+		table, column := model.TableName(modelDef), model.ColumnName(field)
+		rotator := &keyrotation.Rotator{
+			Store:     keyrotation.NewPostgresStore(conn.GetDB(), table, column),
+			Keyring:   keyring,
+			KeyID:     keyID,
+			BatchSize: batchSize,
+			OnProgress: func(p keyrotation.Progress) {
+				log.Infof("Rotated %d/%d values of %s.%s", p.Rotated, p.Total, table, column)
+			},
+		}
+		progress, err := rotator.Run(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("rotation of %s.%s stopped after %d values, run the command again to resume: %w",
+				table, column, progress.Rotated, err)
 		}
+		if progress.Skipped > 0 {
+			log.Warnf("%d values of %s.%s changed during the rotation; run the command again to rotate them",
+				progress.Skipped, table, column)
+		}
+		log.Infof("Rotated %d values of %s.%s to key %s", progress.Rotated, table, column, keyID)
+		return nil
 	},
 }
 
+var transferCmd = &cobra.Command{
+	Use:   "transfer",
+	Short: "Copy the tables of models to another database, possibly of another engine",
+	Long: `Copies the tables of every model (or of the models given with --models) from the configured Postgres
+database to the database given with --to and --to-dsn: the tables are created from the model definitions and
+their rows copied in batches, converting values to the types of the target. SQLite stores booleans as 0 or 1,
+times as RFC 3339 text and arrays as JSON. SQLite databases are written through the sqlite3 shell, which must
+be on the PATH. With --script, the SQL statements are written to a file instead, e.g. to build test fixtures.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		dsn, _ := cmd.Flags().GetString("to-dsn")
+		script, _ := cmd.Flags().GetString("script")
+		modelNames, _ := cmd.Flags().GetStringSlice("models")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+
+		if from != "postgres" {
+			return fmt.Errorf("unsupported source %q: only postgres databases can be transferred from", from)
+		}
+		dialect, err := transfer.DialectFor(to)
+		if err != nil {
+			return err
+		}
+		if (dsn == "") == (script == "") {
+			return fmt.Errorf("specify either --to-dsn or --script")
+		}
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		modelDefs, err := fetchAllModelDefinitions(conn)
+		if err != nil {
+			return err
+		}
+		if len(modelNames) > 0 {
+			var selected []*model.ModelDefinition
+			for _, name := range modelNames {
+				modelDef, err := fetchModelDefinition(conn, name)
+				if err != nil {
+					return err
+				}
+				selected = append(selected, modelDef)
+			}
+			modelDefs = selected
+		}
+
+		target, closeTarget, err := openTransferTarget(to, dsn, script, dialect)
+		if err != nil {
+			return err
+		}
+		t := &transfer.Transfer{
+			Source:    conn.GetDB(),
+			Target:    target,
+			BatchSize: batchSize,
+			OnProgress: func(table string, copied int) {
+				log.Infof("Copied %d rows of %s", copied, table)
+			},
+		}
+		copied, err := t.Run(cmd.Context(), modelDefs)
+		if closeErr := closeTarget(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		return printResult(copied, func() {
+			for _, modelDef := range modelDefs {
+				table := model.TableName(modelDef)
+				log.Infof("%s: %d rows", table, copied[table])
+			}
+			log.Infof("Transferred %d tables to %s", len(modelDefs), to)
+		})
+	},
+}
+
+// openTransferTarget opens the target of "db transfer": the script file when script is set, otherwise the database at dsn. SQLite databases are written through the sqlite3 shell unless a Go
+// SQLite driver is linked in. The returned function closes the target and reports whether it accepted
+// everything written to it.
+func openTransferTarget(driver, dsn, script string, dialect transfer.Dialect) (transfer.Target, func() error, error) {
+	if script != "" {
+		file, err := os.Create(script)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create script: %w", err)
+		}
+		return transfer.NewScriptTarget(file, dialect), file.Close, nil
+	}
+
+	if _, isSQLite := dialect.(transfer.SQLite); isSQLite {
+		if driver = registeredSQLiteDriver(); driver == "" {
+			shell := exec.Command("sqlite3", "-bail", dsn)
+			shell.Stdout, shell.Stderr = os.Stderr, os.Stderr
+			stdin, err := shell.StdinPipe()
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := shell.Start(); err != nil {
+				return nil, nil, fmt.Errorf("failed to start the sqlite3 shell: %w", err)
+			}
+			return transfer.NewScriptTarget(stdin, dialect), func() error {
+				stdin.Close()
+				if err := shell.Wait(); err != nil {
+					return fmt.Errorf("sqlite3 failed: %w", err)
+				}
+				return nil
+			}, nil
+		}
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to connect to the target database: %w", err)
+	}
+	return transfer.NewDBTarget(db, dialect), db.Close, nil
+}
+
+var sampleCmd = &cobra.Command{
+	Use:   "sample",
+	Short: "Copy a referentially consistent sample of the data of another configured database",
+	Long: `Samples --percent percent of the rows of every model in the configured database given with --from, adds
+the rows they reference through field references (and the rows those reference, and so on), and copies them
+into the database given with --to (the primary database by default). Missing tables are created; sampled rows
+replace local rows of the same ID. With --anonymize, sensitive fields are overwritten as "privacy erase
+--mode anonymize" does before the rows are committed.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		percent, _ := cmd.Flags().GetFloat64("percent")
+		anonymize, _ := cmd.Flags().GetBool("anonymize")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		if from == to {
+			return fmt.Errorf("--from and --to must be different databases")
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		sourceConfig, err := cfg.LookupDatabase(from)
+		if err != nil {
+			return err
+		}
+		targetConfig, err := cfg.LookupDatabase(to)
+		if err != nil {
+			return err
+		}
+
+		source, err := orm.NewConnection(sourceConfig)
+		if err != nil {
+			return fmt.Errorf("error connecting to %s: %w", from, err)
+		}
+		defer source.Close()
+		target, err := orm.NewConnection(targetConfig)
+		if err != nil {
+			return fmt.Errorf("error connecting to %s: %w", to, err)
+		}
+		defer target.Close()
+
+		modelDefs, err := fetchAllModelDefinitions(source)
+		if err != nil {
+			return err
+		}
+		ids, err := sample.Select(cmd.Context(), sample.NewDBSource(source.GetDB()), modelDefs, percent)
+		if err != nil {
+			return err
+		}
+
+		t := &transfer.Transfer{
+			Source:    source.GetDB(),
+			Target:    sample.NewTarget(target.GetDB(), anonymize),
+			BatchSize: batchSize,
+			IDs:       ids,
+		}
+		copied, err := t.Run(cmd.Context(), modelDefs)
+		if err != nil {
+			return err
+		}
+
+		return printResult(copied, func() {
+			for _, modelDef := range modelDefs {
+				table := model.TableName(modelDef)
+				log.Infof("%s: %d rows", table, copied[table])
+			}
+			log.Infof("Sampled %d tables of %s into %s", len(modelDefs), from, to)
+		})
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the rows of a model as a CSV file or an Excel workbook",
+	Long: `Writes the rows of the model given with --model, ordered by ID, to a CSV file or an Excel workbook, with
+the columns given with --columns in that order, or every column. The format is taken from the extension of
+--out unless given with --format; --out defaults to the table name and "-" writes to stdout.
+
+Numbers and times of CSV files are formatted for --locale (en-US by default; --decimal-separator,
+--delimiter and --date-format, a Go time layout, override it), and times are written in --time-zone. Excel
+workbooks hold numbers and times as typed cells, which spreadsheet applications display in the locale of their
+user. Text starting like a formula is prefixed with a quote in CSV files. Encrypted fields are decrypted with
+the keys of the encryption configuration, if any.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modelName, _ := cmd.Flags().GetString("model")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		format, _ := cmd.Flags().GetString("format")
+		out, _ := cmd.Flags().GetString("out")
+		localeName, _ := cmd.Flags().GetString("locale")
+		decimalSeparator, _ := cmd.Flags().GetString("decimal-separator")
+		delimiter, _ := cmd.Flags().GetString("delimiter")
+		dateFormat, _ := cmd.Flags().GetString("date-format")
+		timeZone, _ := cmd.Flags().GetString("time-zone")
+		bom, _ := cmd.Flags().GetBool("bom")
+
+		if format == "" {
+			format = export.CSV
+			if strings.EqualFold(filepath.Ext(out), ".xlsx") {
+				format = export.XLSX
+			}
+		}
+		locale, ok := export.Locales[localeName]
+		if !ok {
+			return fmt.Errorf("unknown locale %q: use one of %s", localeName, strings.Join(export.LocaleNames(), ", "))
+		}
+		if decimalSeparator != "" {
+			locale.DecimalSeparator = decimalSeparator
+		}
+		if delimiter != "" {
+			if len([]rune(delimiter)) != 1 {
+				return fmt.Errorf("invalid delimiter %q: use a single character", delimiter)
+			}
+			locale.Delimiter = []rune(delimiter)[0]
+		}
+		if dateFormat != "" {
+			locale.DateFormat = dateFormat
+		}
+		location, err := time.LoadLocation(timeZone)
+		if err != nil {
+			return fmt.Errorf("invalid time zone: %w", err)
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		// Without keys, encrypted fields are exported as stored.
+		var keyring *encryption.Keyring
+		if len(cfg.Encryption.Keys) > 0 {
+			if keyring, err = encryption.NewKeyring(cfg.Encryption.Keys, cfg.Encryption.Primary); err != nil {
+				return fmt.Errorf("invalid encryption config: %w", err)
+			}
+		}
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		modelDef, err := fetchModelDefinition(conn, modelName)
+		if err != nil {
+			return err
+		}
+		options := export.Options{
+			Format:   format,
+			Columns:  columns,
+			Locale:   locale,
+			Location: location,
+			BOM:      bom,
+			Keyring:  keyring,
+		}
+		if _, err := export.Columns(modelDef, columns); err != nil {
+			return err
+		}
+
+		if out == "-" {
+			resultPrinted = true
+			_, err := export.Export(cmd.Context(), conn.GetDB(), modelDef, os.Stdout, options)
+			return err
+		}
+		if out == "" {
+			out = model.TableName(modelDef) + "." + format
+		}
+		file, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("failed to create export: %w", err)
+		}
+		exported, err := export.Export(cmd.Context(), conn.GetDB(), modelDef, file, options)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(out)
+			return err
+		}
+		return printResult(map[string]interface{}{"file": out, "rows": exported}, func() {
+			log.Infof("Exported %d rows of %s to %s", exported, model.TableName(modelDef), out)
+		})
+	},
+}
+
+// registeredSQLiteDriver returns the name of the Go SQLite driver linked into the binary, if any.
+func registeredSQLiteDriver() string {
+	for _, name := range sql.Drivers() {
+		if name == "sqlite" || name == "sqlite3" {
+			return name
+		}
+	}
+	return ""
+}
+
 func init() {
 	dbCmd.AddCommand(buildCmd)
 	dbCmd.AddCommand(startCmd)
@@ -267,12 +1233,227 @@ func init() {
 	dbCmd.AddCommand(statusCmd)
 	dbCmd.AddCommand(seedCmd)
 	dbCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateLintCmd)
+	migrateCmd.AddCommand(migrateImpactCmd)
 	dbCmd.AddCommand(rollbackCmd)
 	dbCmd.AddCommand(listTablesCmd)
+	dbCmd.AddCommand(dataDiffCmd)
+	dbCmd.AddCommand(checkIntegrityCmd)
+	dbCmd.AddCommand(sessionsCmd)
+	dbCmd.AddCommand(hotCmd)
+	dbCmd.AddCommand(rotateKeysCmd)
+	dbCmd.AddCommand(transferCmd)
+	dbCmd.AddCommand(sampleCmd)
+	dbCmd.AddCommand(exportCmd)
 	RootCmd.AddCommand(dbCmd)
+
+	for _, c := range []*cobra.Command{migrateCmd, seedCmd} {
+		c.Flags().StringSlice("targets", []string{}, "Comma-separated list of configured databases to run against (use \"default\" for the primary database)")
+		c.Flags().Bool("all-targets", false, "Run against every configured database")
+		c.Flags().Int("parallel", 4, "Maximum number of databases to process concurrently")
+		c.Flags().Bool("ephemeral", false, "Run against a disposable Postgres container, removed afterwards, instead of a configured database")
+		c.Flags().String("ephemeral-image", ephemeral.DefaultImage, "Docker image of the --ephemeral database")
+	}
+	migrateCmd.Flags().Bool("seed", false, "Seed the database after migrating")
+	seedCmd.Flags().String("dir", "", "Also execute the seed files of a project directory, such as seeds")
+	seedCmd.Flags().Int("workers", 1, "Maximum number of parallel groups of seeds executed concurrently")
+	migrateLintCmd.Flags().String("dir", "", "Lint the migrations of a project directory, such as migrations, instead of the embedded ones")
+	migrateLintCmd.Flags().Bool("strict", false, "Also fail on warnings, for CI")
+	migrateImpactCmd.Flags().Int64("large-table", migration.DefaultLargeTableBytes>>20, "Size in MB past which rewriting or scanning a table under a lock blocking writes needs a maintenance window")
+	migrateImpactCmd.Flags().Int64("large-update", migration.DefaultLargeUpdateRows, "Number of rows past which an UPDATE, DELETE or INSERT needs a maintenance window")
+	dataDiffCmd.Flags().StringSlice("tables", []string{}, "Comma-separated glob patterns of the tables to compare, e.g. \"lookup_*\" (all tables when empty)")
+	dataDiffCmd.Flags().String("from", config.DefaultDatabaseName, "Configured database holding the reference rows")
+	dataDiffCmd.Flags().String("against", "", "Configured database to compare with the reference")
+	dataDiffCmd.Flags().String("sql", "", "Write a script syncing --against to --from to this file (\"-\" for stdout)")
+	dataDiffCmd.MarkFlagRequired("against")
+	hotCmd.Flags().Duration("window", 10*time.Second, "How long to sample the database activity")
+	hotCmd.Flags().Int("limit", 10, "Number of tables and queries to list (0 for all)")
+	sessionsCmd.Flags().Duration("threshold", 30*time.Second, "List transactions open for at least this long")
+	checkIntegrityCmd.Flags().StringSlice("models", []string{}, "Comma-separated list of the models to check (all when empty)")
+	checkIntegrityCmd.Flags().String("fix-script", "", "Write a script fixing the issues to this file (\"-\" for stdout)")
+	rotateKeysCmd.Flags().String("model", "", "Model holding the encrypted field")
+	rotateKeysCmd.Flags().String("field", "", "Encrypted field to re-encrypt")
+	rotateKeysCmd.Flags().String("key", "", "ID of the key to re-encrypt under (default the primary key)")
+	rotateKeysCmd.Flags().Int("batch-size", 500, "Number of rows re-encrypted per transaction")
+	rotateKeysCmd.MarkFlagRequired("model")
+	rotateKeysCmd.MarkFlagRequired("field")
+	transferCmd.Flags().String("from", "postgres", "Driver of the source database, the configured database")
+	transferCmd.Flags().String("to", "", "Driver of the target database: postgres or sqlite")
+	transferCmd.Flags().String("to-dsn", "", "Connection string of the target database (the file of a SQLite database)")
+	transferCmd.Flags().String("script", "", "Write the SQL statements of the target to this file instead")
+	transferCmd.Flags().StringSlice("models", []string{}, "Comma-separated list of the models to transfer (all when empty)")
+	transferCmd.Flags().Int("batch-size", 1000, "Number of rows copied per batch")
+	transferCmd.MarkFlagRequired("to")
+	sampleCmd.Flags().String("from", "", "Configured database to sample, e.g. staging")
+	sampleCmd.Flags().String("to", config.DefaultDatabaseName, "Configured database to copy the sample into")
+	sampleCmd.Flags().Float64("percent", 1, "Percentage of the rows of every model to sample")
+	sampleCmd.Flags().Bool("anonymize", false, "Overwrite the sensitive fields of the copied rows")
+	sampleCmd.Flags().Int("batch-size", 1000, "Number of rows copied per batch")
+	sampleCmd.MarkFlagRequired("from")
+	exportCmd.Flags().String("model", "", "Model whose rows are exported, e.g. Invoice")
+	exportCmd.Flags().StringSlice("columns", []string{}, "Comma-separated list of the columns to export, in order (all when empty)")
+	exportCmd.Flags().String("format", "", "Format of the export: csv or xlsx (default from the extension of --out, else csv)")
+	exportCmd.Flags().String("out", "", "File to write the export to, \"-\" for stdout (default <table>.<format>)")
+	exportCmd.Flags().String("locale", export.DefaultLocale, "Locale of the numbers and times of CSV files: "+strings.Join(export.LocaleNames(), ", "))
+	exportCmd.Flags().String("decimal-separator", "", "Decimal separator of CSV numbers, overriding the locale")
+	exportCmd.Flags().String("delimiter", "", "Field delimiter of CSV files, overriding the locale")
+	exportCmd.Flags().String("date-format", "", "Go layout of CSV times, e.g. 2006-01-02, overriding the locale")
+	exportCmd.Flags().String("time-zone", "UTC", "Time zone times are written in, e.g. Europe/Berlin or Local")
+	exportCmd.Flags().Bool("bom", false, "Start CSV files with a UTF-8 byte order mark, for Excel")
+	exportCmd.MarkFlagRequired("model")
+	migrateCmd.Flags().String("phase", "", "Only apply migrations of the given expand/contract phase: \"expand\" before deploying, \"contract\" after")
+}
+
+// migrateDatabase loads the embedded migrations and applies the pending ones on the given connection.
+func migrateDatabase(ctx context.Context, conn *orm.Connection) error {
+	migrator := migration.NewMigrator(conn.GetDB(), log)
+	if err := migrator.LoadMigrations(); err != nil {
+		return fmt.Errorf("error loading migrations: %w", err)
+	}
+	if err := enforceMigrationPolicies(ctx, conn, migrator, ""); err != nil {
+		return err
+	}
+	return recordRun("migrate", func() error { return migrator.Migrate(ctx) })
+}
+
+// migrateDatabasePhase returns a step that loads the embedded migrations and applies the pending ones of the
+// given expand/contract phase.
+func migrateDatabasePhase(phase migration.Phase) func(ctx context.Context, conn *orm.Connection) error {
+	return func(ctx context.Context, conn *orm.Connection) error {
+		migrator := migration.NewMigrator(conn.GetDB(), log)
+		if err := migrator.LoadMigrations(); err != nil {
+			return fmt.Errorf("error loading migrations: %w", err)
+		}
+		if err := enforceMigrationPolicies(ctx, conn, migrator, phase); err != nil {
+			return err
+		}
+		return recordRun("migrate", func() error { return migrator.MigratePhase(ctx, phase) })
+	}
+}
+
+// seedDatabase loads the embedded seeds and executes them on the given connection.
+func seedDatabase(ctx context.Context, conn *orm.Connection) error {
+	return runSeeders(ctx, conn, seed.NewSeeder(conn.GetDB()))
+}
+
+// seedDatabaseWith returns the step executing the embedded seeds and then the seed files of dir, if not empty,
+// executing up to workers parallel groups of seeds concurrently.
+func seedDatabaseWith(dir string, workers int) func(context.Context, *orm.Connection) error {
+	return func(ctx context.Context, conn *orm.Connection) error {
+		seeders := []*seed.Seeder{seed.NewSeeder(conn.GetDB())}
+		if dir != "" {
+			seeders = append(seeders, seed.NewSeederDir(conn.GetDB(), dir))
+		}
+		for _, seeder := range seeders {
+			seeder.SetWorkers(workers)
+		}
+		return runSeeders(ctx, conn, seeders...)
+	}
+}
+
+// runSeeders loads the seeds of the seeders and executes them in turn, as a single run. HTTP seeds may insert
+// rows of the stored models.
+func runSeeders(ctx context.Context, conn *orm.Connection, seeders ...*seed.Seeder) error {
+	modelsTable, err := modelsTableExists(ctx, conn)
+	if err != nil {
+		return err
+	}
+	var modelDefs []*model.ModelDefinition
+	if modelsTable {
+		if modelDefs, err = fetchAllModelDefinitions(conn); err != nil {
+			return err
+		}
+	}
+	for _, seeder := range seeders {
+		if err := seeder.LoadSeeds(); err != nil {
+			return fmt.Errorf("error loading seeds: %w", err)
+		}
+		seeder.SetModels(modelDefs)
+	}
+	return recordRun("seed", func() error {
+		for _, seeder := range seeders {
+			if err := seeder.Seed(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// runOnTargets applies the steps to the databases selected with --targets or --all-targets, or to a disposable
+// database with --ephemeral, running up to --parallel databases concurrently, and prints a summary matrix. It
+// reports handled=false without doing anything when no targets were selected, so the caller can fall back to
+// the primary database. The returned error is non-nil when the targets could not be resolved or any of them
+// failed, so that a partially applied run exits with a non-zero status.
+func runOnTargets(cmd *cobra.Command, steps []multidb.Step) (handled bool, err error) {
+	names, _ := cmd.Flags().GetStringSlice("targets")
+	all, _ := cmd.Flags().GetBool("all-targets")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	ephemeralDB, _ := cmd.Flags().GetBool("ephemeral")
+	if len(names) == 0 && !all && !ephemeralDB {
+		return false, nil
+	}
+
+	var targets []multidb.Target
+	if ephemeralDB {
+		if len(names) > 0 || all {
+			return true, fmt.Errorf("--ephemeral cannot be combined with --targets or --all-targets")
+		}
+		image, _ := cmd.Flags().GetString("ephemeral-image")
+		container, err := startEphemeralDatabase(cmd.Context(), image)
+		if err != nil {
+			return true, err
+		}
+		defer func() {
+			if err := container.Stop(); err != nil {
+				log.WithError(err).Warn("Failed to remove the ephemeral database")
+			}
+		}()
+		targets = []multidb.Target{{Name: "ephemeral", Config: container.Database}}
+	} else {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return true, fmt.Errorf("error loading config: %w", err)
+		}
+		if targets, err = multidb.ResolveTargets(cfg, names, all); err != nil {
+			return true, fmt.Errorf("error resolving target databases: %w", err)
+		}
+	}
+
+	log.Infof("Running %d step(s) on %d database(s) with parallelism %d", len(steps), len(targets), parallel)
+	results := multidb.Run(cmd.Context(), targets, steps, parallel)
+	if err := multidb.WriteSummary(os.Stdout, steps, results); err != nil {
+		log.WithError(err).Error("Error writing summary")
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return true, fmt.Errorf("%d of %d database(s) failed", failed, len(results))
+	}
+	log.Infof("All %d database(s) completed successfully", len(results))
+	return true, nil
+}
+
+// startEphemeralDatabase starts a disposable Postgres container for --ephemeral, waiting up to two minutes for
+// its database, pulling the image included.
+func startEphemeralDatabase(ctx context.Context, image string) (*ephemeral.Container, error) {
+	log.Infof("Starting an ephemeral %s database...", image)
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	container, err := ephemeral.Start(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Ephemeral database started in container %.12s, it is removed once the command completes", container.ID)
+	return container, nil
 }
 
-func withDBConnection(action func(*orm.Connection) error) error {
+func withDBConnection(ctx context.Context, action func(context.Context, *orm.Connection) error) error {
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		return fmt.Errorf("error loading config: %w", err)
@@ -284,5 +1465,5 @@ func withDBConnection(action func(*orm.Connection) error) error {
 	}
 	defer conn.Close()
 
-	return action(conn)
+	return action(ctx, conn)
 }
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/anonymize"
+	"github.com/ooyeku/grayv-lsm/internal/database/sample"
+	"github.com/ooyeku/grayv-lsm/internal/database/transfer"
+	"github.com/ooyeku/grayv-lsm/internal/database/truncate"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var anonymizeCmd = &cobra.Command{
+	Use:   "anonymize",
+	Short: "Rewrite the sensitive columns of a copy of the database with fake values",
+	Long: `Rewrites the columns listed in the --rules file with deterministic fake values, in a single transaction,
+in the configured database given with --to, which must not be the primary database. With --from, the tables
+of the models of another configured database, such as a production snapshot, are first copied into --to; when
+copying or rewriting fails, the copied tables are truncated so no original values are left in --to. Fake values
+are derived from the original values and the secret in the environment variable named by the rules
+(ANONYMIZE_SECRET by default), so equal values stay equal across columns and runs. Sensitive fields of models
+not covered by the rules are reported. Asks for confirmation unless --yes is given.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runAnonymize,
+}
+
+func init() {
+	anonymizeCmd.Flags().String("rules", "", "YAML file mapping the columns of tables to strategies: "+fmt.Sprint(anonymize.Strategies))
+	anonymizeCmd.Flags().String("from", "", "Configured database whose model tables are copied into --to first")
+	anonymizeCmd.Flags().String("to", "", "Configured database to anonymize, other than the primary database")
+	anonymizeCmd.Flags().Int("batch-size", 1000, "Number of rows copied per batch")
+	anonymizeCmd.Flags().Bool("yes", false, "Anonymize without asking for confirmation")
+	anonymizeCmd.MarkFlagRequired("rules")
+	anonymizeCmd.MarkFlagRequired("to")
+
+	dbCmd.AddCommand(anonymizeCmd)
+}
+
+// anonymizeResult is the result of the anonymize command.
+type anonymizeResult struct {
+	Copied    map[string]int   `json:"copied,omitempty"`
+	Rewritten map[string]int64 `json:"rewritten"`
+	Uncovered []string         `json:"uncovered,omitempty"`
+}
+
+func runAnonymize(cmd *cobra.Command, args []string) error {
+	rulesPath, _ := cmd.Flags().GetString("rules")
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	if to == config.DefaultDatabaseName {
+		return fmt.Errorf("--to must name a copy of the database, not the primary database")
+	}
+	if from == to {
+		return fmt.Errorf("--from and --to must be different databases")
+	}
+
+	rules, err := anonymize.LoadRules(rulesPath)
+	if err != nil {
+		return err
+	}
+	secret, err := rules.Secret()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	targetConfig, err := cfg.LookupDatabase(to)
+	if err != nil {
+		return err
+	}
+	if targetConfig.Host == cfg.Database.Host && targetConfig.Port == cfg.Database.Port && targetConfig.Name == cfg.Database.Name {
+		return fmt.Errorf("database %s is the primary database; --to must name a copy of it", to)
+	}
+	target, err := orm.NewConnection(targetConfig)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", to, err)
+	}
+	defer target.Close()
+
+	question := fmt.Sprintf("Rewrite the sensitive columns of database %s?", to)
+	if from != "" {
+		question = fmt.Sprintf("Copy the model tables of %s into %s, replacing rows of the same ID, and rewrite their sensitive columns? "+
+			"The tables are truncated if this fails.", from, to)
+	}
+	if err := confirmDestructive(cmd, question); err != nil {
+		return err
+	}
+
+	var result anonymizeResult
+	var modelDefs []*model.ModelDefinition
+	if from != "" {
+		sourceConfig, err := cfg.LookupDatabase(from)
+		if err != nil {
+			return err
+		}
+		source, err := orm.NewConnection(sourceConfig)
+		if err != nil {
+			return fmt.Errorf("error connecting to %s: %w", from, err)
+		}
+		defer source.Close()
+
+		if modelDefs, err = fetchAllModelDefinitions(source); err != nil {
+			return err
+		}
+		t := &transfer.Transfer{
+			Source:    source.GetDB(),
+			Target:    sample.NewTarget(target.GetDB(), false),
+			BatchSize: batchSize,
+		}
+		if result.Copied, err = t.Run(cmd.Context(), modelDefs); err != nil {
+			return discardCopy(cmd, target, to, result.Copied, err)
+		}
+	} else if exists, err := modelsTableExists(cmd.Context(), target); err != nil {
+		return err
+	} else if exists {
+		if modelDefs, err = fetchAllModelDefinitions(target); err != nil {
+			return err
+		}
+	}
+
+	if result.Rewritten, err = rules.Run(cmd.Context(), target.GetDB(), secret); err != nil {
+		if from != "" {
+			return discardCopy(cmd, target, to, result.Copied, err)
+		}
+		return err
+	}
+	result.Uncovered = rules.Uncovered(modelDefs)
+
+	return printResult(result, func() {
+		tables := make([]string, 0, len(result.Rewritten))
+		for table := range result.Rewritten {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			log.Infof("%s: %d rows rewritten", table, result.Rewritten[table])
+		}
+		for _, column := range result.Uncovered {
+			log.Warnf("Sensitive column %s is not covered by the rules", column)
+		}
+		log.Infof("Anonymized %d tables of %s", len(tables), to)
+	})
+}
+
+// discardCopy truncates the tables copied into the target database before anonymizing them failed with cause,
+// so that none of the original values are left there, and returns cause, or an error saying the tables still
+// hold the original values when truncating them fails too.
+func discardCopy(cmd *cobra.Command, target *orm.Connection, to string, copied map[string]int, cause error) error {
+	tables := make([]string, 0, len(copied))
+	for table := range copied {
+		tables = append(tables, table)
+	}
+	if len(tables) == 0 {
+		return cause
+	}
+	catalog, err := truncate.LoadCatalog(cmd.Context(), target.GetDB())
+	if err == nil {
+		if tables, err = truncate.Plan(catalog, tables, true); err == nil {
+			err = truncate.Truncate(cmd.Context(), target.GetDB(), tables, false)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w; the copied tables of %s still hold the original values and could not be truncated, "+
+			"empty them now: %v", cause, to, err)
+	}
+	log.Warnf("Truncated the copied tables of %s: %s", to, strings.Join(tables, ", "))
+	return cause
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/dedupe"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/spf13/cobra"
+)
+
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Find and merge duplicate records of a model",
+	Long: `Finds the records of --model sharing the values of the --by fields, compared as lowercase text with
+--ignore-case; records of models scoped to tenants only duplicate records of the same tenant. In each group,
+the record --strategy keeps, the one updated last (newest) or created first (oldest), is kept and the others
+are merged into it: the references of other models to them, declared with field references, are moved to the
+record kept, and they are deleted.
+
+Without --apply, the groups are listed with the references that would move. With --apply, each group is
+merged in its own transaction, stopping at the first group that fails, e.g. on a unique constraint of a
+referencing table.`,
+	Example: `  grayv-lsm db dedupe --model Contact --by email --strategy newest
+  grayv-lsm db dedupe --model Contact --by email --ignore-case --apply --yes`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runDedupe,
+}
+
+func init() {
+	dedupeCmd.Flags().String("model", "", "Model whose duplicate records are merged")
+	dedupeCmd.Flags().StringSlice("by", nil, "Fields whose values duplicates share")
+	dedupeCmd.Flags().String("strategy", string(dedupe.StrategyNewest), "Record kept: newest (updated last) or oldest (created first)")
+	dedupeCmd.Flags().Bool("ignore-case", false, "Compare the values as lowercase text")
+	dedupeCmd.Flags().Bool("apply", false, "Merge the duplicates instead of listing them")
+	dedupeCmd.Flags().Bool("yes", false, "Merge without asking for confirmation")
+	dedupeCmd.MarkFlagRequired("model")
+	dedupeCmd.MarkFlagRequired("by")
+	dbCmd.AddCommand(dedupeCmd)
+}
+
+func runDedupe(cmd *cobra.Command, args []string) error {
+	modelName, _ := cmd.Flags().GetString("model")
+	keys, _ := cmd.Flags().GetStringSlice("by")
+	strategyName, _ := cmd.Flags().GetString("strategy")
+	ignoreCase, _ := cmd.Flags().GetBool("ignore-case")
+	apply, _ := cmd.Flags().GetBool("apply")
+	strategy, err := dedupe.ParseStrategy(strategyName)
+	if err != nil {
+		return err
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDefs, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return err
+	}
+	var modelDef *model.ModelDefinition
+	for _, def := range modelDefs {
+		if strings.EqualFold(def.Name, modelName) {
+			modelDef = def
+		}
+	}
+	if modelDef == nil {
+		return fmt.Errorf("model %s not found", modelName)
+	}
+	relations := dedupe.Relations(modelDefs, modelDef)
+
+	groups, err := dedupe.Find(cmd.Context(), conn.GetDB(), modelDef, dedupe.Options{Keys: keys, IgnoreCase: ignoreCase, Strategy: strategy})
+	if err != nil {
+		return err
+	}
+	if err := dedupe.CountReferences(cmd.Context(), conn.GetDB(), groups, relations); err != nil {
+		return err
+	}
+	duplicates := 0
+	for _, group := range groups {
+		duplicates += len(group.Merge)
+	}
+
+	merged := 0
+	if apply && len(groups) > 0 {
+		if err := confirmDestructive(cmd, fmt.Sprintf("Merge %d duplicate %s record(s) into %d?", duplicates, modelDef.Name, len(groups))); err != nil {
+			return err
+		}
+		merged, err = dedupe.Merge(cmd.Context(), conn.GetDB(), modelDef, relations, groups)
+		if err != nil {
+			log.Warnf("Merged %d of %d group(s) before the error", merged, len(groups))
+			return err
+		}
+	}
+
+	result := map[string]interface{}{"model": modelDef.Name, "groups": groups, "duplicates": duplicates, "merged": merged}
+	return printResult(result, func() {
+		for _, group := range groups {
+			references := make([]string, 0, len(group.References))
+			for relation, count := range group.References {
+				references = append(references, fmt.Sprintf("%s: %d", relation, count))
+			}
+			line := fmt.Sprintf("%s: keep %d, merge %v", strings.Join(group.Key, ", "), group.Keep, group.Merge)
+			if len(references) > 0 {
+				sort.Strings(references)
+				line += " (moving " + strings.Join(references, ", ") + ")"
+			}
+			fmt.Println(line)
+		}
+		switch {
+		case len(groups) == 0:
+			log.Infof("No duplicate %s records by %s", modelDef.Name, strings.Join(keys, ", "))
+		case apply:
+			log.Infof("Merged %d duplicate record(s) into %d %s record(s)", duplicates, merged, modelDef.Name)
+		default:
+			log.Infof("Found %d duplicate record(s) in %d group(s); merge them with --apply", duplicates, len(groups))
+		}
+	})
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/cron"
+	"github.com/ooyeku/grayv-lsm/internal/database/backup"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var dumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Back up the database with pg_dump",
+	Long: `Dumps the database named with --database, the primary database by default, with pg_dump into a new
+backup of the --dir directory, checks the backup can be read, and removes the older backups of the database
+that the retention rules do not keep: the --keep newest, and those younger than --max-age. The newest backup
+is always kept.
+
+With --schedule, a cron expression in the local time zone, the command keeps running and backs up the database
+at the times of the schedule until interrupted. Failed runs are logged and do not stop the schedule.
+
+Each backup is a pg_dump archive with a JSON description holding its SHA-256; "db backups list --verify"
+checks the archives against it. pg_dump and pg_restore must be installed.`,
+	Example: `  grayv-lsm db dump
+  grayv-lsm db dump --database tenant_a --dir /var/backups/grayv --keep 14
+  grayv-lsm db dump --schedule "0 3 * * *" --keep 7 --max-age 720h`,
+	SilenceUsage: true,
+	RunE:         runDump,
+}
+
+var backupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "List and restore the backups written by db dump",
+}
+
+var backupsListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the backups, newest first",
+	Long:         `Lists the backups of the --dir directory, newest first. With --verify, checks the checksum of each archive and that pg_restore can read it, and exits with an error if any cannot.`,
+	SilenceUsage: true,
+	RunE:         runBackupsList,
+}
+
+var backupsRestoreCmd = &cobra.Command{
+	Use:   "restore <backup>",
+	Short: "Restore a backup into the database",
+	Long: `Verifies a backup of the --dir directory, named as listed by "db backups list" or "latest" for the newest,
+and restores it with pg_restore into the database named with --database, the primary database by default.
+The objects of the backup are dropped and recreated, in a single transaction.`,
+	Example: `  grayv-lsm db backups restore latest
+  grayv-lsm db backups restore default-20240601T030000Z --database staging --yes`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runBackupsRestore,
+}
+
+func init() {
+	dumpCmd.Flags().String("database", config.DefaultDatabaseName, "Database to back up")
+	dumpCmd.Flags().String("dir", backup.DefaultDir, "Directory of the backups")
+	dumpCmd.Flags().Int("keep", 7, "Number of newest backups kept (0 keeps all)")
+	dumpCmd.Flags().Duration("max-age", 0, "Age past which backups not kept by --keep are removed (0 for none)")
+	dumpCmd.Flags().String("schedule", "", "Cron expression to back up on, running until interrupted")
+
+	backupsListCmd.Flags().String("dir", backup.DefaultDir, "Directory of the backups")
+	backupsListCmd.Flags().Bool("verify", false, "Check the integrity of each backup")
+
+	backupsRestoreCmd.Flags().String("database", config.DefaultDatabaseName, "Database to restore into")
+	backupsRestoreCmd.Flags().String("dir", backup.DefaultDir, "Directory of the backups")
+	backupsRestoreCmd.Flags().Bool("yes", false, "Restore without asking for confirmation")
+
+	backupsCmd.AddCommand(backupsListCmd)
+	backupsCmd.AddCommand(backupsRestoreCmd)
+	dbCmd.AddCommand(dumpCmd)
+	dbCmd.AddCommand(backupsCmd)
+}
+
+func runDump(cmd *cobra.Command, args []string) error {
+	database, _ := cmd.Flags().GetString("database")
+	dir, _ := cmd.Flags().GetString("dir")
+	keep, _ := cmd.Flags().GetInt("keep")
+	maxAge, _ := cmd.Flags().GetDuration("max-age")
+	spec, _ := cmd.Flags().GetString("schedule")
+	if keep < 0 || maxAge < 0 {
+		return fmt.Errorf("--keep and --max-age cannot be negative")
+	}
+	retention := backup.Retention{Keep: keep, MaxAge: maxAge}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	dbConfig, err := cfg.LookupDatabase(database)
+	if err != nil {
+		return err
+	}
+
+	if spec == "" {
+		b, err := dumpAndPrune(cmd.Context(), dbConfig, database, dir, retention)
+		if err != nil {
+			return err
+		}
+		return printResult(b, func() {})
+	}
+
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("invalid --schedule: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Infof("Scheduled backups of %s: %s", database, schedule)
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("the schedule %s never runs", schedule)
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if _, err := dumpAndPrune(ctx, dbConfig, database, dir, retention); err != nil {
+			log.WithError(err).Errorf("Scheduled backup of %s failed", database)
+		}
+	}
+}
+
+// dumpAndPrune backs up a database, verifies the backup and removes the backups the retention rules do not keep.
+func dumpAndPrune(ctx context.Context, dbConfig *config.DatabaseConfig, database, dir string, retention backup.Retention) (*backup.Backup, error) {
+	start := time.Now()
+	b, err := backup.Dump(ctx, dbConfig, database, dir, start)
+	if err != nil {
+		return nil, err
+	}
+	if err := backup.Verify(ctx, b); err != nil {
+		return nil, err
+	}
+	log.Infof("Backed up %s to %s (%d bytes) in %s", database, b.Path, b.Size, time.Since(start).Round(time.Millisecond))
+
+	removed, err := backup.Prune(dir, database, retention, time.Now())
+	for _, r := range removed {
+		log.Infof("Removed backup %s", r.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove old backups: %w", err)
+	}
+	return b, nil
+}
+
+// backupStatus is a backup listed by db backups list, with the result of its verification.
+type backupStatus struct {
+	*backup.Backup
+	Error string `json:"error,omitempty"`
+}
+
+func runBackupsList(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	verify, _ := cmd.Flags().GetBool("verify")
+
+	backups, err := backup.List(dir)
+	if err != nil {
+		return err
+	}
+	statuses := make([]backupStatus, len(backups))
+	failed := 0
+	for i, b := range backups {
+		statuses[i].Backup = b
+		if verify {
+			if err := backup.Verify(cmd.Context(), b); err != nil {
+				statuses[i].Error = err.Error()
+				failed++
+			}
+		}
+	}
+
+	if err := printResult(statuses, func() {
+		if len(statuses) == 0 {
+			fmt.Printf("No backups in %s\n", dir)
+			return
+		}
+		fmt.Printf("%-40s %-15s %-25s %12s  %s\n", "NAME", "DATABASE", "CREATED", "SIZE", "STATUS")
+		for _, s := range statuses {
+			status := "-"
+			if verify {
+				status = "ok"
+				if s.Error != "" {
+					status = s.Error
+				}
+			}
+			fmt.Printf("%-40s %-15s %-25s %12d  %s\n", s.Name, s.Database, s.CreatedAt.Local().Format(time.RFC3339), s.Size, status)
+		}
+	}); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d backup(s) failed verification", failed)
+	}
+	return nil
+}
+
+func runBackupsRestore(cmd *cobra.Command, args []string) error {
+	database, _ := cmd.Flags().GetString("database")
+	dir, _ := cmd.Flags().GetString("dir")
+
+	b, err := backup.Find(dir, args[0])
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	dbConfig, err := cfg.LookupDatabase(database)
+	if err != nil {
+		return err
+	}
+	if err := confirmDestructive(cmd, fmt.Sprintf("Restore backup %s into database %s, replacing its data?", b.Name, dbConfig.Name)); err != nil {
+		return err
+	}
+	if err := backup.Restore(cmd.Context(), dbConfig, b); err != nil {
+		return err
+	}
+	return printResult(b, func() {
+		log.Infof("Restored backup %s into database %s", b.Name, dbConfig.Name)
+	})
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/spf13/cobra"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <statement>",
+	Short: "Print the execution plan of a statement",
+	Long: `Prints the execution plan the configured database chooses for a statement, as formatted by EXPLAIN. The
+statement is read from standard input when it is "-".
+
+With --analyze, the statement is run to report the actual times, rows and buffers read of every step of the
+plan. It runs in a transaction that is rolled back, so the writes of INSERT, UPDATE and
+DELETE statements are not kept, but their locks are taken while it runs. --json prints the plan as JSON.`,
+	Example: `  grayv-lsm db explain "SELECT * FROM posts WHERE author_id = 42"
+  grayv-lsm db explain --analyze - < slow_query.sql`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runExplain,
+}
+
+func init() {
+	explainCmd.Flags().Bool("analyze", false, "Run the statement and report actual times and rows")
+	explainCmd.Flags().Bool("json", false, "Print the plan as JSON")
+
+	dbCmd.AddCommand(explainCmd)
+}
+
+// explainResult is the result of the db explain command.
+type explainResult struct {
+	Statement string `json:"statement"`
+	Plan      string `json:"plan"`
+}
+
+func runExplain(cmd *cobra.Command, args []string) error {
+	analyze, _ := cmd.Flags().GetBool("analyze")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	statement := args[0]
+	if statement == "-" {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read the statement: %w", err)
+		}
+		statement = string(input)
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	plan, err := conn.Explain(cmd.Context(), statement, orm.ExplainOptions{Analyze: analyze, JSON: asJSON})
+	if err != nil {
+		return err
+	}
+	result := explainResult{Statement: strings.TrimSpace(statement), Plan: plan}
+	return printResult(result, func() {
+		fmt.Println(plan)
+	})
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/masking"
+	"github.com/spf13/cobra"
+)
+
+var maskedViewsCmd = &cobra.Command{
+	Use:   "masked-views",
+	Short: "Give analysts read access to the data without the personal data",
+}
+
+var maskedViewsCreateCmd = &cobra.Command{
+	Use:   "create [model...]",
+	Short: "Create views of the model tables with their sensitive fields masked",
+	Long: `Creates a view of the table of each named model, or every model, in the --schema schema (analyst by
+default), with the fields marked with "model update --sensitive-fields" and the encrypted fields masked, and
+grants the --role role (analyst by default, created without login if missing) to read the views and nothing
+else. Grant the role to the accounts of the analysts.
+
+Fields are masked with --strategy:
+  hash     the SHA-256 of the value and a random key, so that equal values stay equal for joins and counts
+  partial  the last quarter of the value, at most 4 characters, the rest replaced with *
+  redact   [redacted]
+  null     NULL
+
+--mask Model.field=strategy masks a field with another strategy, or masks a field that is not sensitive. The
+key of the hashes is created once in the grayv_masking_key table, which the role cannot read. Running the
+command again replaces the views, in a single transaction. Use --dry-run to print the statements instead.`,
+	Example: `  grayv-lsm db masked-views create
+  grayv-lsm db masked-views create User Order --mask User.phone=partial --mask Order.notes=redact
+  psql -c 'GRANT analyst TO alice'`,
+	SilenceUsage: true,
+	RunE:         runMaskedViewsCreate,
+}
+
+func init() {
+	maskedViewsCreateCmd.Flags().String("schema", masking.DefaultSchema, "Schema to create the views in")
+	maskedViewsCreateCmd.Flags().String("role", masking.DefaultRole, "Role granted to read the views")
+	maskedViewsCreateCmd.Flags().String("strategy", masking.Hash, "Strategy of the sensitive fields: "+strings.Join(masking.Strategies, ", "))
+	maskedViewsCreateCmd.Flags().StringArray("mask", nil, "Field masked with a strategy, as Model.field=strategy (repeatable)")
+	maskedViewsCreateCmd.Flags().Bool("dry-run", false, "Print the statements without running them")
+
+	maskedViewsCmd.AddCommand(maskedViewsCreateCmd)
+	dbCmd.AddCommand(maskedViewsCmd)
+}
+
+func runMaskedViewsCreate(cmd *cobra.Command, args []string) error {
+	schema, _ := cmd.Flags().GetString("schema")
+	role, _ := cmd.Flags().GetString("role")
+	strategy, _ := cmd.Flags().GetString("strategy")
+	masks, _ := cmd.Flags().GetStringArray("mask")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	options := masking.Options{Schema: schema, Role: role, Strategy: strategy, Fields: map[string]string{}}
+	for _, mask := range masks {
+		field, fieldStrategy, found := strings.Cut(mask, "=")
+		if !found || !strings.Contains(field, ".") {
+			return fmt.Errorf("invalid mask %q, expected Model.field=strategy", mask)
+		}
+		options.Fields[strings.TrimSpace(field)] = strings.TrimSpace(fieldStrategy)
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	defs, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		if defs, err = filterModels(defs, args); err != nil {
+			return err
+		}
+	}
+	if len(defs) == 0 {
+		return fmt.Errorf("no models to create views of")
+	}
+
+	var views []masking.View
+	if dryRun {
+		views, err = masking.Views(defs, options)
+		if err != nil {
+			return err
+		}
+		statements, err := masking.Statements(views, options)
+		if err != nil {
+			return err
+		}
+		return printResult(statements, func() {
+			for _, statement := range statements {
+				fmt.Println(statement + ";")
+			}
+		})
+	}
+	if views, err = masking.Create(cmd.Context(), conn.GetDB(), defs, options); err != nil {
+		return err
+	}
+
+	return printResult(views, func() {
+		for _, view := range views {
+			columns := make([]string, 0, len(view.Masked))
+			for column, columnStrategy := range view.Masked {
+				columns = append(columns, column+" ("+columnStrategy+")")
+			}
+			sort.Strings(columns)
+			if len(columns) == 0 {
+				log.Infof("%s: no masked columns", view.Name)
+			} else {
+				log.Infof("%s: %s", view.Name, strings.Join(columns, ", "))
+			}
+		}
+		log.Infof("Created %d masked views readable by role %s", len(views), role)
+	})
+}
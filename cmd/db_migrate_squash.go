@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/migration"
+	"github.com/spf13/cobra"
+)
+
+var migrateSquashCmd = &cobra.Command{
+	Use:   "squash",
+	Short: "Collapse the applied migrations of a project into a baseline migration",
+	Long: `Replaces the migrations of --dir the database applied, up to --to if given, with a single baseline migration
+named after the last of them, which runs their up SQL in turn on new databases. The squashed files are removed
+and the database records the baseline as applied in their place, in the migrations table.
+
+Other databases record the baseline the next time they are migrated, provided they applied every squashed
+migration; migrate them before squashing. A baseline cannot be rolled back.`,
+	Example: `  grayv-lsm db migrate squash --dry-run
+  grayv-lsm db migrate squash --dir migrations --to 20240601000000 --yes`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runMigrateSquash,
+}
+
+func init() {
+	migrateSquashCmd.Flags().String("dir", "migrations", "Migrations directory of the project")
+	migrateSquashCmd.Flags().Int64("to", 0, "Version of the last migration to squash (default the last applied)")
+	migrateSquashCmd.Flags().Bool("dry-run", false, "Print the baseline migration without writing it")
+	migrateSquashCmd.Flags().Bool("yes", false, "Do not ask for confirmation")
+	migrateCmd.AddCommand(migrateSquashCmd)
+}
+
+func runMigrateSquash(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	to, _ := cmd.Flags().GetInt64("to")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	migrator := migration.NewMigratorDir(conn.GetDB(), log, dir)
+	if err := migrator.LoadMigrations(); err != nil {
+		return fmt.Errorf("error loading migrations: %w", err)
+	}
+	squashed, err := migrator.Squashable(cmd.Context(), to)
+	if err != nil {
+		return err
+	}
+	baseline, err := migration.Squash(squashed)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, m := range squashed {
+		names = append(names, m.Name)
+	}
+	result := map[string]interface{}{"baseline": filepath.Join(dir, baseline.Name), "squashed": names}
+	if dryRun {
+		return printResult(result, func() {
+			fmt.Print(baseline.File())
+			log.Infof("Would replace %d migration(s) with %s", len(squashed), baseline.Name)
+		})
+	}
+
+	if err := confirmDestructive(cmd, fmt.Sprintf("Replace %d migration(s) of %s with %s?", len(squashed), dir, baseline.Name)); err != nil {
+		return err
+	}
+	// The baseline is written before the squashed migrations are removed, so none is lost if this fails midway.
+	if err := os.WriteFile(filepath.Join(dir, baseline.Name), []byte(baseline.File()), 0644); err != nil {
+		return fmt.Errorf("error writing baseline: %w", err)
+	}
+	for _, m := range squashed {
+		if m.Name == baseline.Name {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, m.Name)); err != nil {
+			return fmt.Errorf("error removing squashed migration: %w", err)
+		}
+	}
+
+	migrator = migration.NewMigratorDir(conn.GetDB(), log, dir)
+	if err := migrator.LoadMigrations(); err != nil {
+		return fmt.Errorf("error loading migrations: %w", err)
+	}
+	if err := migrator.Checkpoint(cmd.Context()); err != nil {
+		return err
+	}
+	return printResult(result, func() {
+		log.Infof("Squashed %d migration(s) into %s", len(squashed), filepath.Join(dir, baseline.Name))
+	})
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/migration"
+	"github.com/spf13/cobra"
+)
+
+var migrateWaitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Wait until another process has applied the migrations",
+	Long: `Blocks until the database has applied every migration, reading the migrations table without changing
+anything, and fails after --timeout. Use it as the init container or pre-start step of application pods, so
+they only start once the deploy job running "db migrate" is done. A database that does not accept connections
+yet or was never migrated is waited for too.
+
+The migrations waited for are the embedded ones, or those of --dir, and the migrations written in Go.`,
+	Example: `  grayv-lsm db migrate wait --timeout 2m
+  grayv-lsm db migrate wait --dir migrations --timeout 5m --interval 5s`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runMigrateWait,
+}
+
+func init() {
+	migrateWaitCmd.Flags().Duration("timeout", 2*time.Minute, "How long to wait before failing")
+	migrateWaitCmd.Flags().Duration("interval", migration.DefaultWaitInterval, "How often to check the migrations table")
+	migrateWaitCmd.Flags().String("dir", "", "Wait for the migrations of a project directory, such as migrations, instead of the embedded ones")
+	migrateCmd.AddCommand(migrateWaitCmd)
+}
+
+func runMigrateWait(cmd *cobra.Command, args []string) error {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	dir, _ := cmd.Flags().GetString("dir")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	migrator := migration.NewMigrator(conn.GetDB(), log)
+	if dir != "" {
+		migrator = migration.NewMigratorDir(conn.GetDB(), log, dir)
+	}
+	if err := migrator.LoadMigrations(); err != nil {
+		return fmt.Errorf("error loading migrations: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	defer cancel()
+	start := time.Now()
+	if err := migrator.Wait(ctx, interval); err != nil {
+		return err
+	}
+	waited := time.Since(start).Round(time.Millisecond)
+	return printResult(map[string]interface{}{"migrations": len(migrator.Migrations()), "waited": waited.String()}, func() {
+		log.Infof("All %d migrations are applied (waited %s)", len(migrator.Migrations()), waited)
+	})
+}
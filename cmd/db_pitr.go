@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/backup"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var pitrCmd = &cobra.Command{
+	Use:   "pitr",
+	Short: "Archive the WAL and restore the database to a point in time",
+	Long: `Point-in-time restores rebuild the database as it was at any moment since a base backup, by replaying the
+write-ahead log (WAL) the server archived since. Set them up once:
+
+  1. "db pitr configure --archive-dir DIR" makes the server copy the WAL to DIR, then restart the server.
+  2. "db pitr verify --archive-dir DIR --switch-wal" checks the WAL is archived.
+  3. "db pitr base-backup" takes a base backup; take one regularly, as restoring replays the WAL since one.
+
+To restore, "db pitr restore" prepares a new data directory from a base backup, which a second server started
+on it replays the archive into, up to the target time. The original server is not touched.`,
+}
+
+var pitrConfigureCmd = &cobra.Command{
+	Use:   "configure",
+	Short: "Configure the server to archive the WAL to a directory",
+	Long: `Sets wal_level, archive_mode and archive_command with ALTER SYSTEM, which needs a superuser, so the server
+copies every completed WAL segment to --archive-dir, an absolute path on the host of the server that the
+postgres user can write to. wal_level and archive_mode take effect once the server restarts.`,
+	Example:      `  grayv-lsm db pitr configure --archive-dir /var/lib/postgresql/wal_archive`,
+	SilenceUsage: true,
+	RunE:         runPITRConfigure,
+}
+
+var pitrVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the WAL is archived",
+	Long: `Checks the archiving settings of the server, that they archive to --archive-dir if given, and the statistics
+of the archiver: that a segment was archived and the last attempt did not fail. --switch-wal closes the
+current WAL segment and waits, up to --timeout, for it to be archived, proving the archive_command works.
+The command exits with an error when a problem is found.`,
+	Example:      `  grayv-lsm db pitr verify --archive-dir /var/lib/postgresql/wal_archive --switch-wal`,
+	SilenceUsage: true,
+	RunE:         runPITRVerify,
+}
+
+var pitrBaseBackupCmd = &cobra.Command{
+	Use:   "base-backup",
+	Short: "Take a base backup of the server with pg_basebackup",
+	Long: `Takes a base backup of the whole server with pg_basebackup into a new directory of --dir, which the WAL
+archived afterwards can be replayed onto. The user of the configuration needs the REPLICATION attribute, and
+pg_basebackup must be installed.`,
+	Example:      `  grayv-lsm db pitr base-backup --dir /backups/base`,
+	SilenceUsage: true,
+	RunE:         runPITRBaseBackup,
+}
+
+var pitrRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Prepare a new data directory restoring the database to a point in time",
+	Long: `Extracts the base backup --base-backup into the new data directory --data-dir, and configures it to replay
+the WAL of --archive-dir up to --target-time and then accept writes, on --port. The base backup must be older
+than the target time. Start a server on the data directory to perform the restore, as printed, then check the
+data on the new port; dump it with "db dump" or point the application at it.`,
+	Example: `  grayv-lsm db pitr restore --base-backup /backups/base/base-20240601T030000Z \
+    --archive-dir /var/lib/postgresql/wal_archive --target-time "2024-06-01 14:29:00" \
+    --data-dir /var/lib/postgresql/restored --port 5433`,
+	SilenceUsage: true,
+	RunE:         runPITRRestore,
+}
+
+func init() {
+	pitrConfigureCmd.Flags().String("archive-dir", "", "Absolute directory of the host of the server to archive the WAL to")
+	pitrConfigureCmd.MarkFlagRequired("archive-dir")
+
+	pitrVerifyCmd.Flags().String("archive-dir", "", "Directory the WAL should be archived to")
+	pitrVerifyCmd.Flags().Bool("switch-wal", false, "Close the current WAL segment and wait for it to be archived")
+	pitrVerifyCmd.Flags().Duration("timeout", time.Minute, "How long to wait for the segment to be archived")
+
+	pitrBaseBackupCmd.Flags().String("database", config.DefaultDatabaseName, "Configured database of the server to back up")
+	pitrBaseBackupCmd.Flags().String("dir", filepath.Join(backup.DefaultDir, "base"), "Directory of the base backups")
+
+	pitrRestoreCmd.Flags().String("base-backup", "", "Directory of the base backup to restore from")
+	pitrRestoreCmd.Flags().String("archive-dir", "", "Directory the WAL was archived to")
+	pitrRestoreCmd.Flags().String("target-time", "", "Time to restore to, RFC 3339 or \"2006-01-02 15:04:05\" in the local time zone")
+	pitrRestoreCmd.Flags().String("data-dir", "", "New data directory of the restored server")
+	pitrRestoreCmd.Flags().Int("port", 5433, "Port of the restored server")
+	for _, name := range []string{"base-backup", "archive-dir", "target-time", "data-dir"} {
+		pitrRestoreCmd.MarkFlagRequired(name)
+	}
+
+	pitrCmd.AddCommand(pitrConfigureCmd)
+	pitrCmd.AddCommand(pitrVerifyCmd)
+	pitrCmd.AddCommand(pitrBaseBackupCmd)
+	pitrCmd.AddCommand(pitrRestoreCmd)
+	dbCmd.AddCommand(pitrCmd)
+}
+
+func runPITRConfigure(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("archive-dir")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	restart, err := backup.ConfigureArchiving(cmd.Context(), conn.GetDB(), dir)
+	if err != nil {
+		return err
+	}
+	return printResult(map[string]interface{}{"archive_dir": dir, "restart_required": restart}, func() {
+		log.Infof("WAL archiving to %s configured", dir)
+		if restart {
+			log.Warn("Restart the server for the settings to take effect, then run \"db pitr verify --switch-wal\"")
+		}
+	})
+}
+
+func runPITRVerify(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("archive-dir")
+	switchWAL, _ := cmd.Flags().GetBool("switch-wal")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	status, err := backup.CheckArchiving(cmd.Context(), conn.GetDB())
+	if err != nil {
+		return err
+	}
+	problems := status.Problems(dir)
+	// Switching proves nothing until archiving is on.
+	if switchWAL && status.ArchiveMode != "off" && !status.PendingRestart {
+		ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+		defer cancel()
+		switched, err := backup.SwitchWAL(ctx, conn.GetDB())
+		if switched != nil {
+			status = switched
+		}
+		problems = status.Problems(dir)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if err := printResult(map[string]interface{}{"status": status, "problems": problems}, func() {
+		fmt.Printf("wal_level:        %s\n", status.WALLevel)
+		fmt.Printf("archive_mode:     %s\n", status.ArchiveMode)
+		fmt.Printf("archive_command:  %s\n", status.ArchiveCommand)
+		fmt.Printf("archived:         %d", status.ArchivedCount)
+		if status.LastArchivedAt != nil {
+			fmt.Printf(" (last %s at %s)", status.LastArchived, status.LastArchivedAt.Local().Format(time.RFC3339))
+		}
+		fmt.Printf("\nfailed:           %d\n", status.FailedCount)
+		for _, problem := range problems {
+			log.Warn(problem)
+		}
+		if len(problems) == 0 {
+			log.Info("The WAL is archived; take base backups with \"db pitr base-backup\"")
+		}
+	}); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("WAL archiving has %d problem(s)", len(problems))
+	}
+	return nil
+}
+
+func runPITRBaseBackup(cmd *cobra.Command, args []string) error {
+	database, _ := cmd.Flags().GetString("database")
+	dir, _ := cmd.Flags().GetString("dir")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	dbConfig, err := cfg.LookupDatabase(database)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	path, err := backup.BaseBackup(cmd.Context(), dbConfig, dir, start)
+	if err != nil {
+		return err
+	}
+	return printResult(map[string]string{"base_backup": path}, func() {
+		log.Infof("Base backup written to %s in %s", path, time.Since(start).Round(time.Second))
+	})
+}
+
+func runPITRRestore(cmd *cobra.Command, args []string) error {
+	options := backup.RestoreOptions{}
+	options.BaseBackup, _ = cmd.Flags().GetString("base-backup")
+	options.ArchiveDir, _ = cmd.Flags().GetString("archive-dir")
+	options.DataDir, _ = cmd.Flags().GetString("data-dir")
+	options.Port, _ = cmd.Flags().GetInt("port")
+	target, _ := cmd.Flags().GetString("target-time")
+
+	var err error
+	if options.TargetTime, err = time.Parse(time.RFC3339, target); err != nil {
+		if options.TargetTime, err = time.ParseInLocation("2006-01-02 15:04:05", target, time.Local); err != nil {
+			return fmt.Errorf("invalid --target-time %q: use RFC 3339 or \"2006-01-02 15:04:05\"", target)
+		}
+	}
+	if options.TargetTime.After(time.Now()) {
+		return fmt.Errorf("the target time %s is in the future", options.TargetTime.Format(time.RFC3339))
+	}
+	if err := backup.PrepareRestore(options); err != nil {
+		return err
+	}
+
+	return printResult(options, func() {
+		log.Infof("Data directory %s prepared to restore to %s", options.DataDir, options.TargetTime.Format(time.RFC3339))
+		fmt.Println("Next steps, as the postgres user:")
+		fmt.Printf("  pg_ctl -D %s -l %s start\n", options.DataDir, filepath.Join(options.DataDir, "restore.log"))
+		fmt.Printf("  # the log reports \"archive recovery complete\" once the WAL is replayed\n")
+		fmt.Printf("  psql -p %d -c 'SELECT pg_is_in_recovery()'   # f once the restored server accepts writes\n", options.Port)
+	})
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/spf13/cobra"
+)
+
+var replicasCmd = &cobra.Command{
+	Use:   "replicas",
+	Short: "Check the read replicas of the database",
+	Long: `Connects to every read replica listed under database.replicas in the configuration and reports
+whether it answers, whether it is in recovery (a standby, rather than a primary it was promoted to), and how
+long ago it replayed the last transaction it received. The command fails if any replica does not answer.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runReplicas,
+}
+
+func init() {
+	dbCmd.AddCommand(replicasCmd)
+}
+
+// replicaStatus is the state of a read replica reported by db replicas.
+type replicaStatus struct {
+	Host       string  `json:"host"`
+	Port       int     `json:"port"`
+	Healthy    bool    `json:"healthy"`
+	Standby    bool    `json:"standby"`
+	LagSeconds float64 `json:"lag_seconds"`
+	Error      string  `json:"error,omitempty"`
+}
+
+func runReplicas(cmd *cobra.Command, args []string) error {
+	configs := cfg.Database.ReplicaConfigs()
+	if len(configs) == 0 {
+		return fmt.Errorf("no replicas are configured under database.replicas")
+	}
+
+	statuses := make([]replicaStatus, len(configs))
+	failed := 0
+	for i := range configs {
+		status := &statuses[i]
+		status.Host, status.Port = configs[i].Host, configs[i].Port
+		conn, err := orm.NewConnection(&configs[i])
+		if err == nil {
+			// The lag is 0 until the replica replays a transaction, and on a primary.
+			err = conn.GetDB().QueryRowContext(cmd.Context(),
+				"SELECT pg_is_in_recovery(), COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)::float8",
+			).Scan(&status.Standby, &status.LagSeconds)
+			conn.Close()
+		}
+		if err != nil {
+			status.Error = err.Error()
+			failed++
+			continue
+		}
+		status.Healthy = true
+	}
+
+	err := printResult(statuses, func() {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "REPLICA\tHEALTHY\tSTANDBY\tLAG")
+		for _, status := range statuses {
+			lag := time.Duration(status.LagSeconds * float64(time.Second)).Round(time.Millisecond).String()
+			if !status.Healthy {
+				lag = status.Error
+			}
+			fmt.Fprintf(tw, "%s:%d\t%s\t%s\t%s\n", status.Host, status.Port, strconv.FormatBool(status.Healthy),
+				strconv.FormatBool(status.Standby), lag)
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d replica(s) did not answer", failed, len(statuses))
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/truncate"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/spf13/cobra"
+)
+
+var truncateCmd = &cobra.Command{
+	Use:   "truncate [model...]",
+	Short: "Delete all rows of the tables of models",
+	Long: `Empties the tables of the given models, or of every model with --all, in one statement, so the foreign
+keys between them are respected. Tables referencing them through foreign keys must be emptied too: they are
+added with --cascade, and the command fails naming them otherwise. The sequences of the id columns start over
+unless --restart-identity=false. Asks for confirmation unless --yes is given.`,
+	SilenceUsage: true,
+	RunE:         runTruncate,
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Drop, re-migrate and re-seed the database",
+	Long: `Drops every table of the database (the public schema), applies the migrations, recreates the stored
+models with the tables of their migrations, and applies the seeds. The version history of the models is lost,
+and with --drop-models the models themselves. Asks for confirmation unless --yes is given.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runReset,
+}
+
+func init() {
+	truncateCmd.Flags().Bool("all", false, "Truncate the tables of every model")
+	truncateCmd.Flags().Bool("cascade", false, "Also truncate the tables referencing them through foreign keys")
+	truncateCmd.Flags().Bool("restart-identity", true, "Restart the sequences of the id columns")
+	truncateCmd.Flags().Bool("yes", false, "Truncate without asking for confirmation")
+	resetCmd.Flags().Bool("drop-models", false, "Drop the stored models instead of recreating them")
+	resetCmd.Flags().Bool("no-seed", false, "Do not apply the seeds")
+	resetCmd.Flags().Bool("yes", false, "Reset without asking for confirmation")
+
+	dbCmd.AddCommand(truncateCmd)
+	dbCmd.AddCommand(resetCmd)
+}
+
+func runTruncate(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	cascade, _ := cmd.Flags().GetBool("cascade")
+	restartIdentity, _ := cmd.Flags().GetBool("restart-identity")
+	if all == (len(args) > 0) {
+		return fmt.Errorf("give the models to truncate or --all")
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	var modelDefs []*model.ModelDefinition
+	if all {
+		if modelDefs, err = fetchAllModelDefinitions(conn); err != nil {
+			return err
+		}
+	}
+	for _, name := range args {
+		modelDef, err := fetchModelDefinition(conn, name)
+		if err != nil {
+			return err
+		}
+		modelDefs = append(modelDefs, modelDef)
+	}
+
+	catalog, err := truncate.LoadCatalog(cmd.Context(), conn.GetDB())
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for _, modelDef := range modelDefs {
+		// With --all, models whose migration was not applied have no table to empty.
+		if table := model.TableName(modelDef); !all || catalog.Tables[table] {
+			tables = append(tables, table)
+		}
+	}
+	tables, err = truncate.Plan(catalog, tables, cascade)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("no model tables to truncate")
+	}
+
+	if err := confirmDestructive(cmd, fmt.Sprintf("Delete all rows of %s?", strings.Join(tables, ", "))); err != nil {
+		return err
+	}
+	if err := truncate.Truncate(cmd.Context(), conn.GetDB(), tables, restartIdentity); err != nil {
+		return err
+	}
+	return printResult(map[string]interface{}{"tables": tables}, func() {
+		log.Infof("Truncated %s", strings.Join(tables, ", "))
+	})
+}
+
+func runReset(cmd *cobra.Command, args []string) error {
+	dropModels, _ := cmd.Flags().GetBool("drop-models")
+	noSeed, _ := cmd.Flags().GetBool("no-seed")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if err := confirmDestructive(cmd, fmt.Sprintf("Drop every table of database %s?", cfg.Database.Name)); err != nil {
+		return err
+	}
+
+	// The models are kept across the reset, unless the models table does not exist yet.
+	var modelDefs []*model.ModelDefinition
+	modelsTable, err := modelsTableExists(cmd.Context(), conn)
+	if err != nil {
+		return err
+	}
+	if modelsTable && !dropModels {
+		if modelDefs, err = fetchAllModelDefinitions(conn); err != nil {
+			return err
+		}
+	}
+
+	if _, err := conn.GetDB().ExecContext(cmd.Context(), "DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		return fmt.Errorf("failed to drop the database schema: %w", err)
+	}
+	log.Info("Dropped all tables")
+	if err := migrateDatabase(cmd.Context(), conn); err != nil {
+		return err
+	}
+	for _, modelDef := range modelDefs {
+		if err := createModelDefinition(conn, modelDef); err != nil {
+			return fmt.Errorf("failed to recreate model %s: %w", modelDef.Name, err)
+		}
+		if _, err := conn.GetDB().ExecContext(cmd.Context(), (&model.ModelManager{}).GenerateMigration(modelDef)); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", model.TableName(modelDef), err)
+		}
+	}
+	if !noSeed {
+		if err := seedDatabase(cmd.Context(), conn); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, len(modelDefs))
+	for i, modelDef := range modelDefs {
+		names[i] = modelDef.Name
+	}
+	return printResult(map[string]interface{}{"models": names, "seeded": !noSeed}, func() {
+		log.Infof("Database %s reset with %d models", cfg.Database.Name, len(modelDefs))
+	})
+}
+
+// modelsTableExists reports whether the database holds the models table created by db migrate.
+func modelsTableExists(ctx context.Context, conn *orm.Connection) (bool, error) {
+	var exists bool
+	err := conn.GetDB().QueryRowContext(ctx, "SELECT to_regclass('public.models') IS NOT NULL").Scan(&exists)
+	return exists, err
+}
+
+// confirmDestructive asks the question on stderr and fails unless it is answered yes, or --yes is given.
+func confirmDestructive(cmd *cobra.Command, question string) error {
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%s This cannot be undone. (y/N): ", question)
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("not confirmed; pass --yes to confirm")
+}
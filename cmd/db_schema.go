@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/snapshot"
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/spf13/cobra"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Dump and load the schema snapshot of the database",
+	Long: `The schema snapshot, schema.sql by default, holds the schema of the database and the versions of the
+migrations applied to it. "db migrate" and "db rollback" rewrite it after running, so that committed along the
+migrations it shows the schema they build, and "db schema load" creates a fresh database from it without
+replaying every migration. pg_dump must be installed to write it.`,
+}
+
+var schemaDumpCmd = &cobra.Command{
+	Use:          "dump",
+	Short:        "Write the schema snapshot of the database",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runSchemaDump,
+}
+
+var schemaLoadCmd = &cobra.Command{
+	Use:   "load",
+	Short: "Create the schema of an empty database from the schema snapshot",
+	Long: `Executes the schema snapshot in a single transaction, creating the tables and recording the migrations
+it was written after as applied, so that "db migrate" only applies the migrations added since. The database
+must be empty; with --force, its tables are dropped first.`,
+	Example: `  grayv-lsm db schema load
+  grayv-lsm db schema load --file db/schema.sql --force --yes`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runSchemaLoad,
+}
+
+func init() {
+	schemaDumpCmd.Flags().String("file", snapshot.DefaultFile, "File to write the snapshot to")
+	schemaLoadCmd.Flags().String("file", snapshot.DefaultFile, "Snapshot to load")
+	schemaLoadCmd.Flags().Bool("force", false, "Drop every table of the database before loading")
+	schemaLoadCmd.Flags().Bool("yes", false, "Drop the tables without asking for confirmation")
+	for _, c := range []*cobra.Command{migrateCmd, rollbackCmd} {
+		c.Flags().String("schema-file", snapshot.DefaultFile, "File the schema snapshot is written to afterwards (none when empty)")
+	}
+
+	schemaCmd.AddCommand(schemaDumpCmd)
+	schemaCmd.AddCommand(schemaLoadCmd)
+	dbCmd.AddCommand(schemaCmd)
+}
+
+func runSchemaDump(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	changed, err := dumpSchema(cmd.Context(), conn, file)
+	if err != nil {
+		return err
+	}
+	return printResult(map[string]interface{}{"file": file, "changed": changed}, func() {
+		if changed {
+			log.Infof("Wrote the schema snapshot to %s", file)
+		} else {
+			log.Infof("The schema snapshot %s is up to date", file)
+		}
+	})
+}
+
+func runSchemaLoad(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	force, _ := cmd.Flags().GetBool("force")
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema snapshot: %w", err)
+	}
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if force {
+		if err := confirmDestructive(cmd, fmt.Sprintf("Drop every table of database %s?", cfg.Database.Name)); err != nil {
+			return err
+		}
+		if _, err := conn.GetDB().ExecContext(cmd.Context(), "DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+			return fmt.Errorf("failed to drop the database schema: %w", err)
+		}
+	}
+	if err := snapshot.Load(cmd.Context(), conn.GetDB(), string(data)); err != nil {
+		if !force {
+			return fmt.Errorf("%w; pass --force to drop its tables first", err)
+		}
+		return err
+	}
+	return printResult(map[string]interface{}{"file": file}, func() {
+		log.Infof("Loaded the schema snapshot %s", file)
+	})
+}
+
+// dumpSchema writes the schema snapshot of the database of conn to file, and reports whether it changed.
+func dumpSchema(ctx context.Context, conn *orm.Connection, file string) (bool, error) {
+	schema, err := snapshot.Dump(ctx, &cfg.Database, conn.GetDB())
+	if err != nil {
+		return false, err
+	}
+	return snapshot.Write(file, schema)
+}
+
+// writeSchemaSnapshot rewrites the schema snapshot named by the --schema-file flag after migrating. Failing
+// to write it does not fail the migrations, which are applied, so it is only logged.
+func writeSchemaSnapshot(cmd *cobra.Command, conn *orm.Connection) {
+	file, _ := cmd.Flags().GetString("schema-file")
+	if file == "" {
+		return
+	}
+	changed, err := dumpSchema(cmd.Context(), conn, file)
+	if err != nil {
+		log.WithError(err).Warnf("Error writing the schema snapshot %s", file)
+		return
+	}
+	if changed {
+		log.Infof("Wrote the schema snapshot to %s", file)
+	}
+}
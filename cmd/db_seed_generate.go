@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/mock"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var seedGenerateCmd = &cobra.Command{
+	Use:   "generate [model...]",
+	Short: "Write seeds inserting fake records of models",
+	Long: `Writes a seed per model, for the named models or every model, inserting fake records into its table. Values
+are of the kinds set on the fields with "model update --fake", such as email, name, url or lorem(50), or look
+like what the names of the fields suggest, and references hold the IDs of the records seeded for the
+referenced model. They are the records "api mock" serves with the same --records and --seed, so an app and
+its mock show the same data.
+
+The records keep their IDs, and the seeds move the id sequences past them: run them, with "db seed --dir",
+on empty tables. Models with encrypted fields cannot be seeded.
+
+Models are read from the database, or from the models file given with --file.`,
+	Example: `  grayv-lsm model update User --fake contact=email,bio=lorem(50)
+  grayv-lsm db seed generate User Post --records 100
+  grayv-lsm db seed --dir seeds`,
+	SilenceUsage: true,
+	RunE:         runSeedGenerate,
+}
+
+func init() {
+	seedGenerateCmd.Flags().String("file", "", "Models file to read the definitions from instead of the database")
+	seedGenerateCmd.Flags().Int("records", mock.DefaultRecords, "Number of records generated per model")
+	seedGenerateCmd.Flags().Int64("seed", 1, "Seed of the generated values")
+	seedGenerateCmd.Flags().String("seeds-dir", "seeds", "Directory to write the seeds to")
+
+	seedCmd.AddCommand(seedGenerateCmd)
+}
+
+// seedFile is a seed written by the db seed generate command.
+type seedFile struct {
+	Model   string `json:"model"`
+	Table   string `json:"table"`
+	File    string `json:"file"`
+	Records int    `json:"records"`
+}
+
+func runSeedGenerate(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	records, _ := cmd.Flags().GetInt("records")
+	randSeed, _ := cmd.Flags().GetInt64("seed")
+	seedsDir, _ := cmd.Flags().GetString("seeds-dir")
+	if records < 1 {
+		return fmt.Errorf("--records must be at least 1")
+	}
+
+	defs, err := selectModels(file, args)
+	if err != nil {
+		return err
+	}
+	if len(defs) == 0 {
+		return fmt.Errorf("no models to seed")
+	}
+	seeds, err := mock.Seeds(defs, records, randSeed)
+	if err != nil {
+		return err
+	}
+
+	fsys := filesystem.NewOSFS("")
+	if err := fsys.MkdirAll(seedsDir, 0755); err != nil {
+		return fmt.Errorf("error creating seeds directory: %w", err)
+	}
+	timestamp := time.Now().UTC().Format("20060102150405")
+	written := make([]seedFile, len(seeds))
+	for i, s := range seeds {
+		name := path.Join(seedsDir, fmt.Sprintf("%s_%s.sql", timestamp, s.Table))
+		if err := fsys.WriteFile(name, []byte(s.SQL), 0644); err != nil {
+			return fmt.Errorf("error writing seed: %w", err)
+		}
+		written[i] = seedFile{Model: s.Model, Table: s.Table, File: name, Records: records}
+	}
+
+	return printResult(written, func() {
+		for _, w := range written {
+			log.Infof("Seed of %d %s record(s) written to %s", w.Records, w.Model, w.File)
+		}
+	})
+}
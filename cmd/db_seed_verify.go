@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/seed"
+	"github.com/spf13/cobra"
+)
+
+var seedVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Report applied seeds whose files changed since",
+	Long: `Compares the seeds with the checksums "db seed" records when it applies them, and reports the seeds whose
+file changed or was removed after it was last applied, so silent edits to applied seed data are caught. Seeds
+never applied are not reported. The command exits with an error when any seed drifted, so it can run in CI.
+
+The embedded seeds are verified, and the seeds of the project directory given with --dir too.`,
+	Example:      `  grayv-lsm db seed verify --dir seeds`,
+	SilenceUsage: true,
+	RunE:         runSeedVerify,
+}
+
+func init() {
+	seedVerifyCmd.Flags().String("dir", "", "Also verify the seed files of a project directory, such as seeds")
+
+	seedCmd.AddCommand(seedVerifyCmd)
+}
+
+func runSeedVerify(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	seeders := []*seed.Seeder{seed.NewSeeder(conn.GetDB())}
+	if dir != "" {
+		seeders = append(seeders, seed.NewSeederDir(conn.GetDB(), dir))
+	}
+	drifts := []seed.Drift{}
+	for _, seeder := range seeders {
+		if err := seeder.LoadSeeds(); err != nil {
+			return fmt.Errorf("error loading seeds: %w", err)
+		}
+		found, err := seeder.Verify(cmd.Context())
+		if err != nil {
+			return err
+		}
+		drifts = append(drifts, found...)
+	}
+
+	if err := printResult(drifts, func() {
+		if len(drifts) == 0 {
+			log.Info("All applied seeds match their files")
+			return
+		}
+		fmt.Printf("%-15s %-40s %-8s %-25s\n", "SOURCE", "SEED", "STATUS", "APPLIED")
+		for _, d := range drifts {
+			fmt.Printf("%-15s %-40s %-8s %-25s\n", d.Source, d.Name, d.Status, d.AppliedAt.Local().Format(time.RFC3339))
+		}
+	}); err != nil {
+		return err
+	}
+	if len(drifts) > 0 {
+		return fmt.Errorf("%d seed(s) changed after they were applied", len(drifts))
+	}
+	return nil
+}
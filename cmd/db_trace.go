@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/trace"
+	"github.com/spf13/cobra"
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace",
+	Short: "Show the records connected to a record through the relations of the models",
+	Long: `Reads the record of --model with --id, then follows the field references of the models: the records it
+references, the records referencing it, and in turn theirs, up to --depth relations away. At most --limit
+records referencing the records of a level are read per relation; the relations cut short are reported.
+
+The graph is printed as a list of records with their references, or with --format json or dot written to
+stdout or to --out; render a DOT file with Graphviz, e.g. "dot -Tsvg trace.dot > trace.svg".`,
+	Example: `  grayv-lsm db trace --model Order --id 42
+  grayv-lsm db trace --model Order --id 42 --depth 3 --format dot --out order-42.dot`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runTrace,
+}
+
+func init() {
+	traceCmd.Flags().String("model", "", "Model of the record to trace")
+	traceCmd.Flags().Int64("id", 0, "ID of the record to trace")
+	traceCmd.Flags().Int("depth", trace.DefaultDepth, "Number of relations followed from the record")
+	traceCmd.Flags().Int("limit", trace.DefaultLimit, "Maximum number of referencing records read per relation and level (0 for all)")
+	traceCmd.Flags().String("format", "text", "Format of the graph: text, json or dot")
+	traceCmd.Flags().String("out", "", "File to write the graph to instead of stdout")
+	traceCmd.MarkFlagRequired("model")
+	traceCmd.MarkFlagRequired("id")
+	dbCmd.AddCommand(traceCmd)
+}
+
+func runTrace(cmd *cobra.Command, args []string) error {
+	modelName, _ := cmd.Flags().GetString("model")
+	id, _ := cmd.Flags().GetInt64("id")
+	depth, _ := cmd.Flags().GetInt("depth")
+	limit, _ := cmd.Flags().GetInt("limit")
+	format, _ := cmd.Flags().GetString("format")
+	out, _ := cmd.Flags().GetString("out")
+	if format != "text" && format != "json" && format != "dot" {
+		return fmt.Errorf("invalid format %q: use text, json or dot", format)
+	}
+	if depth < 0 || limit < 0 {
+		return fmt.Errorf("--depth and --limit must not be negative")
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDefs, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return err
+	}
+	g, err := trace.Trace(cmd.Context(), trace.NewDBSource(conn.GetDB()), modelDefs, modelName, id,
+		trace.Options{Depth: depth, Limit: limit})
+	if err != nil {
+		return err
+	}
+	for _, relation := range g.Truncated {
+		log.Warnf("Only the first %d records of %s were read", limit, relation)
+	}
+
+	var data []byte
+	switch format {
+	case "json":
+		if data, err = json.MarshalIndent(g, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	case "dot":
+		data = []byte(g.DOT())
+	default:
+		if out == "" {
+			return printResult(g, func() { printTrace(g) })
+		}
+		return fmt.Errorf("--out needs --format json or dot")
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	log.Infof("Wrote %d records and %d references to %s", len(g.Nodes), len(g.Edges), out)
+	return nil
+}
+
+// printTrace prints every record of the graph, indented by its depth, with the records it references (->) and
+// the records referencing it (<-).
+func printTrace(g *trace.Graph) {
+	for _, node := range g.Nodes {
+		indent := fmt.Sprintf("%*s", 2*node.Depth, "")
+		fmt.Printf("%s%s %d\n", indent, node.Model, node.ID)
+		for _, edge := range g.Edges {
+			switch node.Key {
+			case edge.From:
+				fmt.Printf("%s  -> %s (%s)\n", indent, edge.To, edge.Field)
+			case edge.To:
+				fmt.Printf("%s  <- %s (%s)\n", indent, edge.From, edge.Field)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate project documentation",
+}
+
+var docsGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate schema documentation for every model",
+	Long: `Write a page for every model describing its table, columns, relations, indexes, row-level security
+policies, and gRPC routes, and an index of the models, as Markdown or HTML. The pages are rendered from the
+model definitions stored in the database; pages of deleted models are removed. Run it after changing models,
+or with --check in CI to fail when the pages are out of date.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runDocsGenerate,
+}
+
+func init() {
+	docsGenerateCmd.Flags().String("format", model.DocsMarkdown, "Format of the pages: markdown or html")
+	docsGenerateCmd.Flags().String("out", "docs/schema", "Directory to write the pages to")
+	docsGenerateCmd.Flags().String("package", "models", "Protobuf package of the gRPC services")
+	docsGenerateCmd.Flags().Bool("check", false, "Only report pages that are out of date, without writing them")
+
+	docsCmd.AddCommand(docsGenerateCmd)
+	RootCmd.AddCommand(docsCmd)
+}
+
+func runDocsGenerate(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	outputDir, _ := cmd.Flags().GetString("out")
+	protoPackage, _ := cmd.Flags().GetString("package")
+	check, _ := cmd.Flags().GetBool("check")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDefs, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return err
+	}
+	files, err := model.RenderDocs(modelDefs, model.DocsOptions{Format: format, OutputDir: outputDir, ProtoPackage: protoPackage})
+	if err != nil {
+		return err
+	}
+
+	fsys := filesystem.NewOSFS("")
+	stale, err := staleDocPages(fsys, filepath.ToSlash(outputDir), files)
+	if err != nil {
+		return err
+	}
+
+	if check {
+		outdated := append([]string{}, stale...)
+		for _, file := range files {
+			if current, err := fsys.ReadFile(file.Path); err != nil || !bytes.Equal(current, file.Content) {
+				outdated = append(outdated, file.Path)
+			}
+		}
+		if err := printResult(outdated, func() {
+			for _, page := range outdated {
+				log.Errorf("%s is out of date", page)
+			}
+		}); err != nil {
+			return err
+		}
+		if len(outdated) > 0 {
+			return fmt.Errorf("%d documentation page(s) are out of date; run \"docs generate\"", len(outdated))
+		}
+		log.Infof("All %d documentation page(s) are up to date", len(files))
+		return nil
+	}
+
+	for _, file := range files {
+		if err := file.Write(fsys); err != nil {
+			return err
+		}
+	}
+	for _, page := range stale {
+		if err := fsys.Remove(page); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", page, err)
+		}
+		log.Infof("Removed %s", page)
+	}
+	log.Infof("Wrote %d documentation page(s) for %d model(s) to %s", len(files), len(modelDefs), outputDir)
+	return nil
+}
+
+// staleDocPages returns the generated pages in dir that are not among files, such as the pages of deleted
+// models. Files without the generated marker are left alone.
+func staleDocPages(fsys filesystem.FS, dir string, files []*model.GeneratedFile) ([]string, error) {
+	entries, err := fsys.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	generated := make(map[string]bool, len(files))
+	for _, file := range files {
+		generated[file.Path] = true
+	}
+	var stale []string
+	for _, entry := range entries {
+		page := path.Join(dir, entry.Name())
+		if entry.IsDir() || generated[page] {
+			continue
+		}
+		if content, err := fsys.ReadFile(page); err == nil && strings.HasPrefix(string(content), model.DocsGeneratedMarker) {
+			stale = append(stale, page)
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/migration"
+	"github.com/ooyeku/grayv-lsm/internal/enforcement"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// enforcePolicies runs the registered policy checks and the Rego policies of the configuration before an
+// operation, and returns an error listing the violations if any policy blocks it.
+func enforcePolicies(op enforcement.Operation, modelDefs []*model.ModelDefinition, migrations []enforcement.Migration) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	input := enforcement.Input{Operation: op, Models: modelDefs, Migrations: migrations}
+	return enforcement.Enforce(input, enforcement.Options{Rego: cfg.Enforcement.Rego, Query: cfg.Enforcement.Query})
+}
+
+// enforceMigrationPolicies runs the policies before the pending migrations of the given phase, or of every
+// phase if phase is empty, are applied. The policies see the stored models, if the models table exists yet.
+func enforceMigrationPolicies(ctx context.Context, conn *orm.Connection, migrator *migration.Migrator, phase migration.Phase) error {
+	pending, err := migrator.PendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	var migrations []enforcement.Migration
+	for _, m := range pending {
+		if phase == "" || m.Phase == phase {
+			migrations = append(migrations, enforcement.Migration{Name: m.Name, Phase: string(m.Phase), SQL: m.UpSQL})
+		}
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	var modelDefs []*model.ModelDefinition
+	var exists bool
+	if err := conn.GetDB().QueryRowContext(ctx, "SELECT to_regclass('models') IS NOT NULL").Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check for the models table: %w", err)
+	}
+	if exists {
+		if modelDefs, err = fetchAllModelDefinitions(conn); err != nil {
+			return err
+		}
+	}
+	return enforcePolicies(enforcement.Migrate, modelDefs, migrations)
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/env"
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage development environments",
+}
+
+var previewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "Manage disposable preview environments",
+	Long:  `Create and destroy disposable preview environments, each with its own database container and, optionally, a running instance of a Grayv app.`,
+}
+
+var previewCreateCmd = &cobra.Command{
+	Use:   "create [branch]",
+	Short: "Create a preview environment for a branch",
+	Long:  `Provision a disposable database on a free port, run migrations and seeds against it, start the Grayv app on another free port, and print the connection details. The branch defaults to the current git branch.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runPreviewCreate,
+}
+
+var previewDestroyCmd = &cobra.Command{
+	Use:   "destroy [branch]",
+	Short: "Destroy a preview environment",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runPreviewDestroy,
+}
+
+var previewListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List preview environments",
+	SilenceUsage: true,
+	RunE:         runPreviewList,
+}
+
+func init() {
+	previewCreateCmd.Flags().String("app", "", "Name of the Grayv app to start (defaults to the only app in the current directory)")
+	previewCreateCmd.Flags().Bool("no-app", false, "Only provision the database")
+	previewCreateCmd.Flags().Bool("no-seed", false, "Skip seeding the preview database")
+
+	previewCmd.AddCommand(previewCreateCmd)
+	previewCmd.AddCommand(previewDestroyCmd)
+	previewCmd.AddCommand(previewListCmd)
+	envCmd.AddCommand(previewCmd)
+	RootCmd.AddCommand(envCmd)
+}
+
+func runPreviewCreate(cmd *cobra.Command, args []string) {
+	noApp, _ := cmd.Flags().GetBool("no-app")
+	noSeed, _ := cmd.Flags().GetBool("no-seed")
+	appName, _ := cmd.Flags().GetString("app")
+
+	branch, err := previewBranch(args)
+	if err != nil {
+		log.WithError(err).Error("Failed to determine branch")
+		return
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.WithError(err).Error("Error loading config")
+		return
+	}
+
+	appDir := ""
+	if !noApp {
+		appDir, err = resolveAppDir(appName)
+		if err != nil {
+			log.WithError(err).Error("Failed to resolve app")
+			return
+		}
+		if appDir == "" {
+			log.Warn("No Grayv app found, only the database will be provisioned")
+		}
+	}
+
+	provision := func(conn *orm.Connection) error {
+		if err := migrateDatabase(cmd.Context(), conn); err != nil {
+			return err
+		}
+		if noSeed {
+			return nil
+		}
+		return seedDatabase(cmd.Context(), conn)
+	}
+
+	log.Infof("Creating preview environment for branch %s...", branch)
+	preview, err := env.NewPreviewManager(cfg).Create(branch, appDir, provision)
+	if err != nil {
+		log.WithError(err).Error("Failed to create preview environment")
+		return
+	}
+
+	log.Infof("Preview environment %s is ready", preview.Name)
+	log.Infof("- Database: %s", preview.RedactedDSN())
+	log.Infof("- Container: %s", preview.ContainerName)
+	if url := preview.AppURL(); url != "" {
+		log.Infof("- App: %s (pid %d, logs in .grav/previews/%s/app.log)", url, preview.AppPID, preview.Name)
+	}
+}
+
+func runPreviewDestroy(cmd *cobra.Command, args []string) {
+	branch, err := previewBranch(args)
+	if err != nil {
+		log.WithError(err).Error("Failed to determine branch")
+		return
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.WithError(err).Error("Error loading config")
+		return
+	}
+
+	if err := env.NewPreviewManager(cfg).Destroy(branch); err != nil {
+		log.WithError(err).Errorf("Failed to destroy preview environment for %s", branch)
+		return
+	}
+	log.Infof("Preview environment for %s destroyed", branch)
+}
+
+// previewView is a preview environment as printed by "env preview list". The database password is redacted.
+type previewView struct {
+	Name      string    `json:"name"`
+	Branch    string    `json:"branch"`
+	Database  string    `json:"database"`
+	AppURL    string    `json:"app_url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func runPreviewList(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	previews, err := env.NewPreviewManager(cfg).List()
+	if err != nil {
+		return fmt.Errorf("failed to list preview environments: %w", err)
+	}
+	views := []previewView{}
+	for _, preview := range previews {
+		views = append(views, previewView{Name: preview.Name, Branch: preview.Branch, Database: preview.RedactedDSN(),
+			AppURL: preview.AppURL(), CreatedAt: preview.CreatedAt})
+	}
+
+	return printResult(views, func() {
+		if len(previews) == 0 {
+			log.Info("No preview environments found")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tBRANCH\tDATABASE\tAPP\tCREATED")
+		for _, preview := range previews {
+			fmt.Fprintf(tw, "%s\t%s\t%s:%d\t%s\t%s\n", preview.Name, preview.Branch,
+				preview.Database.Host, preview.Database.Port, preview.AppURL(), preview.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		tw.Flush()
+	})
+}
+
+// previewBranch returns the branch given on the command line, or the current git branch.
+func previewBranch(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	return env.CurrentBranch()
+}
+
+// resolveAppDir returns the directory of the named Grayv app, or of the only app in the current directory when
+// no name is given. It returns an empty string when no name is given and there is not exactly one app.
+func resolveAppDir(name string) (string, error) {
+	if name != "" {
+		dir := name + "_grav"
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("grayv app %s not found", name)
+		}
+		return dir, nil
+	}
+
+	apps, err := appCreator.ListApps()
+	if err != nil {
+		return "", err
+	}
+	if len(apps) != 1 {
+		return "", nil
+	}
+	return apps[0], nil
+}
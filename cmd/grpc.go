@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/enforcement"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var grpcCmd = &cobra.Command{
+	Use:   "grpc",
+	Short: "Generate gRPC services for models",
+}
+
+var grpcGenerateCmd = &cobra.Command{
+	Use:   "generate [name|--all]",
+	Short: "Generate a gRPC CRUD service for models",
+	Long: `Generate, for one model or for every model with --all, a protobuf message, a service definition with
+Create/Get/List/Update/Delete RPCs, and a server implementation backed by the model's generated repository.
+
+The .proto files are written to proto/ and the server to internal/grpcserver/, inside the app when --app is
+given. Compile the .proto files with protoc into internal/pb, for example:
+
+  protoc -I proto --go_out=. --go_opt=module=<module> --go-grpc_out=. --go-grpc_opt=module=<module> proto/*.proto
+
+and generate the models with "model generate --app" so the repositories exist.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runGRPCGenerate,
+}
+
+func init() {
+	grpcGenerateCmd.Flags().Bool("all", false, "Generate services for every model")
+	grpcGenerateCmd.Flags().String("app", "", "Name of the Grayv app to generate the services in")
+	grpcGenerateCmd.Flags().String("module", "", "Go module path of the app (read from the app's go.mod when --app is given)")
+	grpcGenerateCmd.Flags().String("package", "models", "Protobuf package name")
+
+	grpcCmd.AddCommand(grpcGenerateCmd)
+	RootCmd.AddCommand(grpcCmd)
+}
+
+func runGRPCGenerate(cmd *cobra.Command, args []string) {
+	appName, _ := cmd.Flags().GetString("app")
+	module, _ := cmd.Flags().GetString("module")
+	protoPackage, _ := cmd.Flags().GetString("package")
+
+	root := ""
+	if appName != "" {
+		appDir, err := resolveAppDir(appName)
+		if err != nil {
+			log.WithError(err).Error("Failed to resolve app")
+			return
+		}
+		root = appDir
+		if module == "" {
+			module, err = readModulePath(filepath.Join(appDir, "go.mod"))
+			if err != nil {
+				log.WithError(err).Error("Failed to determine the app's module path")
+				return
+			}
+		}
+	}
+	if module == "" {
+		log.Error("Specify the Go module path with --module or generate into an app with --app")
+		return
+	}
+
+	opts := model.GRPCOptions{
+		ProtoDir:     path.Join(root, "proto"),
+		ServerDir:    path.Join(root, "internal", "grpcserver"),
+		ProtoPackage: protoPackage,
+		GoModule:     module,
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		log.WithError(err).Error("Failed to get database connection")
+		return
+	}
+	defer conn.Close()
+
+	modelDefs, err := selectModelDefinitions(cmd, conn, args)
+	if err != nil {
+		log.WithError(err).Error("Failed to get models from database")
+		return
+	}
+	if err := enforcePolicies(enforcement.Generate, modelDefs, nil); err != nil {
+		log.Error(err)
+		return
+	}
+
+	fsys := filesystem.NewOSFS("")
+	manifest, err := loadManifest(fsys)
+	if err != nil {
+		log.WithError(err).Error("Failed to load generation manifest")
+		return
+	}
+	defer saveManifest(fsys, manifest)
+
+	for _, modelDef := range modelDefs {
+		if model.AssignProtoNumbers(modelDef) {
+			if err := saveModelDefinition(conn, modelDef); err != nil {
+				log.WithError(err).Errorf("Failed to store protobuf field numbers for %s", modelDef.Name)
+				return
+			}
+		}
+
+		if _, err := generateArtifact(fsys, manifest, model.GRPCArtifact(modelDef.Name, opts), modelDef); err != nil {
+			log.WithError(err).Errorf("Failed to generate gRPC service for %s", modelDef.Name)
+			return
+		}
+		log.Infof("Generated gRPC service for %s", modelDef.Name)
+	}
+
+	log.Infof("Compile the services with protoc into %s before building the server", opts.PBImportPath())
+}
+
+// readModulePath returns the module path declared in the given go.mod file.
+func readModulePath(goMod string) (string, error) {
+	file, err := os.Open(goMod)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module ")), `"`), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no module directive in %s", goMod)
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/jobs"
+	"github.com/spf13/cobra"
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Operate the background job queues of apps",
+	Long: `Operate the queues of the background jobs run by the workers of the internal/jobs package of apps, stored
+in the jobs table created by "db migrate".`,
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List jobs, the most recent first",
+	Long: `Lists the jobs of the database, the most recent first, with their queue, kind, status, priority, attempts,
+the time they are due to run and the error of their last failed run. --queue and --status select the jobs
+listed; the statuses are pending, running, done, failed and cancelled.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue, _ := cmd.Flags().GetString("queue")
+		status, _ := cmd.Flags().GetString("status")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		list, err := jobs.List(cmd.Context(), conn.GetDB(), jobs.Filter{Queue: queue, Status: status, Limit: limit})
+		if err != nil {
+			return fmt.Errorf("failed to list jobs: %w", err)
+		}
+		return printResult(list, func() {
+			if len(list) == 0 {
+				log.Info("No jobs found")
+				return
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tQUEUE\tKIND\tSTATUS\tPRIORITY\tATTEMPTS\tRUN AT\tLAST ERROR")
+			for _, j := range list {
+				lastError := strings.Join(strings.Fields(j.LastError), " ")
+				if len(lastError) > 60 {
+					lastError = lastError[:57] + "..."
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d/%d\t%s\t%s\n", j.ID, j.Queue, j.Kind, j.Status, j.Priority,
+					j.Attempts, j.MaxAttempts, j.RunAt.Local().Format("2006-01-02 15:04:05"), lastError)
+			}
+			tw.Flush()
+		})
+	},
+}
+
+var jobsRetryCmd = &cobra.Command{
+	Use:   "retry [id...]",
+	Short: "Run failed or cancelled jobs again",
+	Long: `Makes failed or cancelled jobs pending again, due now and with their attempts reset: the jobs given by ID,
+or with --failed every failed job, of --queue only when given.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		failed, _ := cmd.Flags().GetBool("failed")
+		queue, _ := cmd.Flags().GetString("queue")
+		if failed == (len(args) > 0) {
+			return errors.New("give the IDs of the jobs to retry, or --failed to retry every failed job")
+		}
+		ids, err := parseJobIDs(args)
+		if err != nil {
+			return err
+		}
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		var retried int64
+		if failed {
+			retried, err = jobs.RetryFailed(cmd.Context(), conn.GetDB(), queue)
+		} else {
+			retried, err = jobs.Retry(cmd.Context(), conn.GetDB(), ids)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to retry jobs: %w", err)
+		}
+		return printResult(map[string]int64{"retried": retried}, func() {
+			log.Infof("Retried %d job(s)", retried)
+		})
+	},
+}
+
+var jobsCancelCmd = &cobra.Command{
+	Use:   "cancel id...",
+	Short: "Cancel pending or running jobs",
+	Long: `Cancels the pending or running jobs given by ID. Workers do not interrupt a running job cancelled, but do
+not record its outcome; "jobs retry" runs cancelled jobs again.`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ids, err := parseJobIDs(args)
+		if err != nil {
+			return err
+		}
+
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+
+		cancelled, err := jobs.Cancel(cmd.Context(), conn.GetDB(), ids)
+		if err != nil {
+			return fmt.Errorf("failed to cancel jobs: %w", err)
+		}
+		return printResult(map[string]int64{"cancelled": cancelled}, func() {
+			log.Infof("Cancelled %d job(s)", cancelled)
+		})
+	},
+}
+
+// parseJobIDs parses the job IDs given as arguments.
+func parseJobIDs(args []string) ([]int64, error) {
+	ids := make([]int64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid job ID %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func init() {
+	jobsListCmd.Flags().String("queue", "", "List only the jobs of this queue")
+	jobsListCmd.Flags().String("status", "", "List only the jobs with this status (pending, running, done, failed or cancelled)")
+	jobsListCmd.Flags().Int("limit", 50, "Maximum number of jobs to list (0 for all)")
+	jobsRetryCmd.Flags().Bool("failed", false, "Retry every failed job")
+	jobsRetryCmd.Flags().String("queue", "", "With --failed, retry only the failed jobs of this queue")
+
+	jobsCmd.AddCommand(jobsListCmd)
+	jobsCmd.AddCommand(jobsRetryCmd)
+	jobsCmd.AddCommand(jobsCancelCmd)
+	RootCmd.AddCommand(jobsCmd)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// setupLogging applies the logging configuration to the loggers of every package: the level, of the command
+// if configured for it, and the rotated log file. Lines of the log file and JSON lines carry the command, so
+// that the lines of concurrent runs can be told apart.
+func setupLogging(cmd *cobra.Command) error {
+	if cfg == nil {
+		return nil
+	}
+	command := strings.TrimPrefix(cmd.CommandPath(), RootCmd.Name()+" ")
+	options := logging.Options{
+		Level:  logging.LevelFor(cfg.Logging.Commands, command, cfg.Logging.Level),
+		Format: cfg.Logging.Format,
+		File:   cfg.Logging.File,
+		Rotate: logging.RotateOptions{
+			MaxSize:    int64(cfg.Logging.MaxSize) * 1024 * 1024,
+			MaxBackups: cfg.Logging.MaxBackups,
+		},
+	}
+	if cfg.Logging.MaxAge != "" {
+		maxAge, err := time.ParseDuration(cfg.Logging.MaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid Logging.MaxAge: %w", err)
+		}
+		options.Rotate.MaxAge = maxAge
+	}
+	logging.Scope(logrus.Fields{"command": command})
+	if err := logging.Configure(options); err != nil {
+		return fmt.Errorf("invalid logging config: %w", err)
+	}
+	orm.SlowQueryHook = logSlowQuery
+	return nil
+}
+
+// logSlowQuery logs a statement that ran for longer than the slow query threshold of the database.
+func logSlowQuery(q orm.SlowQuery) {
+	entry := log.WithField("elapsed", q.Elapsed.Round(time.Microsecond).String())
+	if q.Err != nil {
+		entry = entry.WithError(q.Err)
+	}
+	entry.Warnf("Slow query: %s", strings.Join(strings.Fields(q.Query), " "))
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/metrics"
+)
+
+// runMetrics count the migration and seed runs of the process. They are pushed to the Pushgateway of the
+// metrics configuration after every run, since the commands exit before they could be scraped.
+var (
+	runMetrics  = metrics.NewRegistry()
+	runsTotal   = runMetrics.Counter("grayv_lsm_runs_total", "Migration and seed runs, by command and status.", "command", "status")
+	runDuration = runMetrics.Histogram("grayv_lsm_run_duration_seconds", "Duration of the migration and seed runs.",
+		[]float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900}, "command")
+)
+
+// recordRun runs a migration or seed command, "migrate", "rollback" or "seed", and records its outcome and
+// duration in runMetrics.
+func recordRun(command string, run func() error) error {
+	start := time.Now()
+	err := run()
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	runsTotal.Inc(command, status)
+	runDuration.ObserveDuration(time.Since(start), command)
+
+	if cfg != nil && cfg.Metrics.Pushgateway != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := metrics.Push(ctx, cfg.Metrics.Pushgateway, "grayv_lsm", runMetrics); err != nil {
+			log.WithError(err).Warn("Error pushing metrics")
+		}
+	}
+	return err
+}
@@ -1,13 +1,22 @@
 package cmd
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path"
 	"strings"
+	"time"
 
+	"github.com/ooyeku/grayv-lsm/internal/database/seed"
+	"github.com/ooyeku/grayv-lsm/internal/enforcement"
 	"github.com/ooyeku/grayv-lsm/internal/model"
 	"github.com/ooyeku/grayv-lsm/internal/orm"
 	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
 	"github.com/spf13/cobra"
 	"regexp"
 )
@@ -32,43 +41,205 @@ var updateModelCmd = &cobra.Command{
 }
 
 var listModelsCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all models",
-	Run:   runListModels,
+	Use:          "list",
+	Short:        "List all models",
+	SilenceUsage: true,
+	RunE:         runListModels,
 }
 
 var generateModelCmd = &cobra.Command{
-	Use:   "generate [name]",
+	Use:   "generate [name|--all]",
 	Short: "Generate Go code for an existing model",
-	Args:  cobra.ExactArgs(1),
+	Long:  `Generate Go code for one model, or for every model with --all. Models whose definition and templates are unchanged since the last run, and whose generated files are untouched, are skipped using the generation manifest. Generated files edited since they were generated are not overwritten without --force, and --dry-run prints the changes generating would make as a unified diff instead.`,
+	Args:  cobra.MaximumNArgs(1),
 	Run:   runGenerateModel,
 }
 
+var exportTSCmd = &cobra.Command{
+	Use:   "export-ts [name|--all]",
+	Short: "Export TypeScript type definitions for models",
+	Long:  `Write a .d.ts file containing an exported interface for one model, or for every model with --all, so frontend code stays in sync with the backend models.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runExportTS,
+}
+
+var protoCmd = &cobra.Command{
+	Use:   "proto [name|--all]",
+	Short: "Generate protobuf message definitions for models",
+	Long:  `Write a .proto file with a message for one model, or for every model with --all. Field numbers are assigned once and stored in the model definition, and numbers of removed fields are reserved, so messages stay wire-compatible across runs.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runProto,
+}
+
+var verifyModelsCmd = &cobra.Command{
+	Use:          "verify",
+	Short:        "Verify generated code against the generation manifest",
+	Long:         `Check that every file recorded in the generation manifest is unchanged on disk and that regenerating each artifact from its model's current definition reproduces the recorded output exactly. Exits with a non-zero status when any check fails, so it can gate CI builds.`,
+	SilenceUsage: true,
+	RunE:         runVerifyModels,
+}
+
+var inferModelCmd = &cobra.Command{
+	Use:          "infer [name]",
+	Short:        "Create a model from a sample JSON payload or CSV file",
+	Long:         `Infer the fields of a model and their Go types from a sample JSON document, an object or an array of objects, or from the header and first rows of a CSV file, and create the model. Nested JSON objects become related models referenced by a <Key>ID field, and arrays of objects related models referencing the model, unless --nested-json stores them in JSONB columns instead. With --seed, a seed loading the rows of the CSV file is written too. Use --dry-run to print the inferred models without creating them.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runInferModel,
+}
+
 func init() {
 
-	createModelCmd.Flags().StringSlice("fields", []string{}, "Comma-separated list of fields in the format name:type")
-	updateModelCmd.Flags().StringSlice("add-fields", []string{}, "Comma-separated list of fields to add in the format name:type")
+	createModelCmd.Flags().StringSlice("fields", []string{}, "Comma-separated list of fields in the format name:type or name:type:default=value, e.g. status:enum(pending,active):default=pending")
+	createModelCmd.Flags().BoolP("interactive", "i", false, "Define the fields with prompts and preview the model before creating it")
+	createModelCmd.Flags().String("table", "", "Name of the model's table (default derived by the naming strategy)")
+	createModelCmd.Flags().Bool("lock-version", false, "Add a version field and fail updates of records modified concurrently")
+	createModelCmd.Flags().String("tenant-field", "", "Scope the model's records to the tenant held by this field, e.g. tenant_id")
+	createModelCmd.Flags().StringArray("permission", []string{}, "Restrict an action on the model's records to roles, as action=role,role, e.g. delete=admin (repeatable)")
+	createModelCmd.Flags().StringSlice("upsert-keys", []string{}, "Comma-separated list of fields identifying records for the Upsert methods of the repository, e.g. sku")
+	createModelCmd.Flags().StringSlice("fake", []string{}, "Comma-separated list of field=hint kinds of the fake values of string fields, e.g. contact=email,bio=lorem(50)")
+	addCacheFlags(createModelCmd)
+	inferModelCmd.Flags().String("from-json", "", "Path of the sample JSON payload")
+	inferModelCmd.Flags().String("from-csv", "", "Path of a CSV file with a header row")
+	inferModelCmd.Flags().Bool("nested-json", false, "Store nested objects and arrays of objects in JSONB columns instead of related models")
+	inferModelCmd.Flags().Int("sample", 1000, "Number of CSV rows to infer the field types from")
+	inferModelCmd.Flags().Bool("seed", false, "Write a seed loading the rows of the CSV file into the model's table")
+	inferModelCmd.Flags().String("seeds-dir", "seeds", "Directory to write the seed to")
+	inferModelCmd.Flags().String("table", "", "Name of the model's table (default derived by the naming strategy)")
+	inferModelCmd.Flags().Bool("dry-run", false, "Print the inferred models without creating them")
+	updateModelCmd.Flags().StringSlice("add-fields", []string{}, "Comma-separated list of fields to add in the format name:type or name:type:default=value")
 	updateModelCmd.Flags().StringSlice("remove-fields", []string{}, "Comma-separated list of field names to remove")
+	updateModelCmd.Flags().StringSlice("encrypt-fields", []string{}, "Comma-separated list of string fields to store encrypted")
+	updateModelCmd.Flags().StringSlice("sensitive-fields", []string{}, "Comma-separated list of fields holding personal data")
+	updateModelCmd.Flags().StringSlice("references", []string{}, "Comma-separated list of field=Model relations, e.g. authorid=User")
+	updateModelCmd.Flags().StringSlice("index-fields", []string{}, "Comma-separated list of fields to index")
+	updateModelCmd.Flags().StringSlice("vector-index", []string{}, "Comma-separated list of field=metric HNSW indexes on vector fields, e.g. embedding=cosine")
+	updateModelCmd.Flags().StringSlice("search-fields", []string{}, "Comma-separated list of text fields to index in the search backend, replacing the current ones")
+	updateModelCmd.Flags().Bool("no-search", false, "Stop indexing the model in the search backend")
+	updateModelCmd.Flags().String("table", "", "Rename the model's table")
+	updateModelCmd.Flags().Bool("lock-version", false, "Add a version field and fail updates of records modified concurrently")
+	updateModelCmd.Flags().String("tenant-field", "", "Scope the model's records to the tenant held by this field, e.g. tenant_id")
+	updateModelCmd.Flags().StringArray("permission", []string{}, "Restrict an action on the model's records to roles, as action=role,role, or lift it with action= (repeatable)")
+	updateModelCmd.Flags().StringSlice("upsert-keys", []string{}, "Comma-separated list of fields identifying records for the Upsert methods of the repository, replacing the current ones")
+	updateModelCmd.Flags().Bool("no-upsert", false, "Remove the Upsert methods of the repository")
+	updateModelCmd.Flags().StringSlice("fake", []string{}, "Comma-separated list of field=hint kinds of the fake values of string fields, or field= to remove a hint")
+	addCacheFlags(updateModelCmd)
 
 	generateModelCmd.Flags().String("app", "", "Name of the Grayv app to generate the model in")
+	generateModelCmd.Flags().Bool("all", false, "Generate code for every model")
+	generateModelCmd.Flags().Bool("no-cache", false, "Regenerate models even if they are up to date")
+	generateModelCmd.Flags().Bool("kv", false, "Also generate KV repositories storing the records in an embedded file, for prototypes without a database server")
+	generateModelCmd.Flags().Bool("goimports", false, "Also run the generated Go code through goimports, which must be installed")
+	generateModelCmd.Flags().Bool("dry-run", false, "Print the changes to the generated files as a unified diff instead of writing them")
+	generateModelCmd.Flags().Bool("force", false, "Overwrite generated files edited since they were generated")
+
+	exportTSCmd.Flags().Bool("all", false, "Export every model")
+	exportTSCmd.Flags().String("out", "types", "Directory to write the .d.ts files to")
+
+	protoCmd.Flags().Bool("all", false, "Generate messages for every model")
+	protoCmd.Flags().String("out", "proto", "Directory to write the .proto files to")
+	protoCmd.Flags().String("package", "models", "Protobuf package name")
+	protoCmd.Flags().String("go-package", "", "Value of the go_package option")
 
 	modelCmd.AddCommand(createModelCmd)
 	modelCmd.AddCommand(updateModelCmd)
+	modelCmd.AddCommand(inferModelCmd)
 	RootCmd.AddCommand(modelCmd)
 	modelCmd.AddCommand(listModelsCmd)
 	modelCmd.AddCommand(generateModelCmd)
+	modelCmd.AddCommand(verifyModelsCmd)
+	modelCmd.AddCommand(exportTSCmd)
+	modelCmd.AddCommand(protoCmd)
+}
+
+// setPermissions sets the permissions of a model given as action=role,role.
+func setPermissions(def *model.ModelDefinition, specs []string) error {
+	for _, spec := range specs {
+		action, value, found := strings.Cut(spec, "=")
+		if !found {
+			return fmt.Errorf("invalid permission %q, expected action=role,role", spec)
+		}
+		if err := def.SetPermission(strings.TrimSpace(action), parseRoles(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFakeHints sets the kinds of fake values given as field=hint, see model.ModelDefinition.SetFakeHint.
+func setFakeHints(def *model.ModelDefinition, specs []string) error {
+	for _, spec := range specs {
+		name, hint, found := strings.Cut(spec, "=")
+		if !found {
+			return fmt.Errorf("invalid fake hint %q, expected field=hint", spec)
+		}
+		if err := def.SetFakeHint(strings.TrimSpace(name), strings.TrimSpace(hint)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRoles parses a comma-separated list of roles.
+// addCacheFlags adds the flags configuring the cache of a model, see setCache.
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("cache", false, "Cache the records read by the repository's Get, or stop caching them with --cache=false")
+	cmd.Flags().Duration("cache-ttl", 0, "Time records stay cached (default 5m)")
+	cmd.Flags().String("cache-key", "", "Key of the cached records: id, tenant or session (default the narrowest the model allows)")
+}
+
+// setCache applies the cache flags to the model. Setting the TTL or key enables the cache unless --cache=false
+// is given.
+func setCache(cmd *cobra.Command, def *model.ModelDefinition) error {
+	flags := cmd.Flags()
+	if !flags.Changed("cache") && !flags.Changed("cache-ttl") && !flags.Changed("cache-key") {
+		return nil
+	}
+	enabled := true
+	if flags.Changed("cache") {
+		enabled, _ = flags.GetBool("cache")
+	}
+	ttl, _ := flags.GetDuration("cache-ttl")
+	key, _ := flags.GetString("cache-key")
+	return def.SetCache(enabled, ttl, key)
+}
+
+func parseRoles(value string) []string {
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
 }
 
 func runCreateModel(cmd *cobra.Command, args []string) {
 	modelName := sanitizeIdentifier(args[0])
 	fields, _ := cmd.Flags().GetStringSlice("fields")
+	interactive, _ := cmd.Flags().GetBool("interactive")
+	table, _ := cmd.Flags().GetString("table")
+	lockVersion, _ := cmd.Flags().GetBool("lock-version")
+	tenantField, _ := cmd.Flags().GetString("tenant-field")
+	permissions, _ := cmd.Flags().GetStringArray("permission")
+	upsertKeys, _ := cmd.Flags().GetStringSlice("upsert-keys")
+	fakeHints, _ := cmd.Flags().GetStringSlice("fake")
 
-	modelFields, err := parseFields(fields)
-	if err != nil {
-		log.WithError(err).Error("Failed to parse fields")
+	if interactive && len(fields) > 0 {
+		log.Error("--interactive and --fields cannot be combined")
 		return
 	}
 
+	var modelFields []model.Field
+	if !interactive {
+		var err error
+		modelFields, err = parseFields(fields)
+		if err != nil {
+			log.WithError(err).Error("Failed to parse fields")
+			return
+		}
+	}
+
 	conn, err := getDBConnection()
 	if err != nil {
 		log.WithError(err).Error("Failed to get database connection")
@@ -76,26 +247,92 @@ func runCreateModel(cmd *cobra.Command, args []string) {
 	}
 	defer conn.Close()
 
-	fieldsJSON, err := json.Marshal(modelFields)
-	if err != nil {
-		log.WithError(err).Error("Failed to marshal model fields")
+	if interactive {
+		models, err := listModelsFromDB(conn)
+		if err != nil {
+			log.WithError(err).Error("Failed to list models")
+			return
+		}
+		modelDef, err := newModelBuilder(cmd.InOrStdin(), cmd.OutOrStdout(), models).build(modelName)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to define model %s", modelName)
+			return
+		}
+		if modelDef == nil {
+			log.Info("Model creation cancelled")
+			return
+		}
+		modelFields = modelDef.Fields
+	}
+
+	modelDef := model.NewModelDefinition(modelName, modelFields)
+	if table == "" {
+		strategy, err := namingStrategy()
+		if err != nil {
+			log.WithError(err).Error("Failed to get the naming strategy")
+			return
+		}
+		table = strategy.TableName(modelName)
+	}
+	if err := modelDef.SetTable(table); err != nil {
+		log.WithError(err).Errorf("Failed to set the table of model %s", modelName)
+		return
+	}
+	if lockVersion {
+		if err := modelDef.EnableLockVersion(); err != nil {
+			log.WithError(err).Errorf("Failed to enable optimistic locking of model %s", modelName)
+			return
+		}
+	}
+	if tenantField != "" {
+		if err := modelDef.SetTenantField(tenantField); err != nil {
+			log.WithError(err).Errorf("Failed to scope model %s to tenants", modelName)
+			return
+		}
+	}
+	if err := setPermissions(modelDef, permissions); err != nil {
+		log.WithError(err).Errorf("Failed to set the permissions of model %s", modelName)
+		return
+	}
+	if err := setCache(cmd, modelDef); err != nil {
+		log.WithError(err).Errorf("Failed to set the cache of model %s", modelName)
+		return
+	}
+	if err := modelDef.SetUpsertKeys(upsertKeys); err != nil {
+		log.WithError(err).Errorf("Failed to set the upsert keys of model %s", modelName)
+		return
+	}
+	if err := setFakeHints(modelDef, fakeHints); err != nil {
+		log.WithError(err).Errorf("Failed to set the fake hints of model %s", modelName)
 		return
 	}
 
-	query := "INSERT INTO models (name, fields) VALUES ($1, $2)"
-	_, err = conn.Query(query, modelName, fieldsJSON)
-	if err != nil {
+	if err := createModelDefinition(conn, modelDef); err != nil {
 		log.WithError(err).Errorf("Failed to create model %s", modelName)
 		return
 	}
 
-	log.Infof("Model %s created successfully", modelName)
+	log.Infof("Model %s created successfully with table %s", modelName, table)
 }
 
 func runUpdateModel(cmd *cobra.Command, args []string) {
 	modelName := sanitizeIdentifier(args[0])
 	addFields, _ := cmd.Flags().GetStringSlice("add-fields")
 	removeFields, _ := cmd.Flags().GetStringSlice("remove-fields")
+	encryptFields, _ := cmd.Flags().GetStringSlice("encrypt-fields")
+	sensitiveFields, _ := cmd.Flags().GetStringSlice("sensitive-fields")
+	references, _ := cmd.Flags().GetStringSlice("references")
+	indexFields, _ := cmd.Flags().GetStringSlice("index-fields")
+	vectorIndexes, _ := cmd.Flags().GetStringSlice("vector-index")
+	searchFields, _ := cmd.Flags().GetStringSlice("search-fields")
+	noSearch, _ := cmd.Flags().GetBool("no-search")
+	table, _ := cmd.Flags().GetString("table")
+	lockVersion, _ := cmd.Flags().GetBool("lock-version")
+	tenantField, _ := cmd.Flags().GetString("tenant-field")
+	permissions, _ := cmd.Flags().GetStringArray("permission")
+	upsertKeys, _ := cmd.Flags().GetStringSlice("upsert-keys")
+	noUpsert, _ := cmd.Flags().GetBool("no-upsert")
+	fakeHints, _ := cmd.Flags().GetStringSlice("fake")
 
 	conn, err := getDBConnection()
 	if err != nil {
@@ -104,79 +341,343 @@ func runUpdateModel(cmd *cobra.Command, args []string) {
 	}
 	defer conn.Close()
 
-	var fieldsJSON []byte
-	rows, err := conn.Query("SELECT fields FROM models WHERE name = $1", modelName)
+	modelDef, err := fetchModelDefinition(conn, modelName)
 	if err != nil {
 		log.WithError(err).Errorf("Failed to get model %s", modelName)
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		err := rows.Scan(&fieldsJSON)
+	if len(addFields) > 0 {
+		newFields, err := parseFields(addFields)
 		if err != nil {
-			log.WithError(err).Error("Failed to scan model fields")
+			log.WithError(err).Error("Failed to parse new fields")
 			return
 		}
+		modelDef.Fields = append(modelDef.Fields, newFields...)
+	}
 
-		var modelFields []model.Field
-		err = json.Unmarshal(fieldsJSON, &modelFields)
-		if err != nil {
-			log.WithError(err).Error("Failed to unmarshal model fields")
+	if len(removeFields) > 0 {
+		for _, field := range modelDef.Fields {
+			if contains(removeFields, field.Name) {
+				model.ReserveProtoNumber(modelDef, field)
+			}
+		}
+		modelDef.Fields = removeFieldsFromModel(modelDef.Fields, removeFields)
+	}
+
+	for _, name := range encryptFields {
+		if err := modelDef.EncryptField(name); err != nil {
+			log.WithError(err).Errorf("Failed to encrypt field %s", name)
 			return
 		}
+	}
 
-		if len(addFields) > 0 {
-			newFields, err := parseFields(addFields)
-			if err != nil {
-				log.WithError(err).Error("Failed to parse new fields")
-				return
-			}
-			modelFields = append(modelFields, newFields...)
+	for _, name := range sensitiveFields {
+		if err := modelDef.MarkSensitive(name); err != nil {
+			log.WithError(err).Errorf("Failed to mark field %s as sensitive", name)
+			return
 		}
+	}
 
-		if len(removeFields) > 0 {
-			modelFields = removeFieldsFromModel(modelFields, removeFields)
+	for _, reference := range references {
+		name, referenced, found := strings.Cut(reference, "=")
+		if !found {
+			log.Errorf("Invalid reference %q, expected field=Model", reference)
+			return
+		}
+		if _, err := fetchModelDefinition(conn, referenced); err != nil {
+			log.WithError(err).Errorf("Failed to get referenced model %s", referenced)
+			return
 		}
+		if err := modelDef.SetReference(name, referenced); err != nil {
+			log.WithError(err).Errorf("Failed to set reference of field %s", name)
+			return
+		}
+	}
 
-		updatedFieldsJSON, err := json.Marshal(modelFields)
-		if err != nil {
-			log.WithError(err).Error("Failed to marshal updated model fields")
+	for _, name := range indexFields {
+		if err := modelDef.IndexField(name); err != nil {
+			log.WithError(err).Errorf("Failed to index field %s", name)
 			return
 		}
+	}
 
-		_, err = conn.Query("UPDATE models SET fields = $1 WHERE name = $2", updatedFieldsJSON, modelName)
-		if err != nil {
-			log.WithError(err).Errorf("Failed to update model %s", modelName)
+	for _, index := range vectorIndexes {
+		name, metric, found := strings.Cut(index, "=")
+		if !found {
+			log.Errorf("Invalid vector index %q, expected field=metric", index)
+			return
+		}
+		if err := modelDef.IndexVectorField(name, metric); err != nil {
+			log.WithError(err).Errorf("Failed to index field %s", name)
+			return
+		}
+	}
+
+	if len(searchFields) > 0 || noSearch {
+		if err := modelDef.SetSearchFields(searchFields); err != nil {
+			log.WithError(err).Errorf("Failed to set the search fields of model %s", modelName)
+			return
+		}
+	}
+
+	if lockVersion {
+		if err := modelDef.EnableLockVersion(); err != nil {
+			log.WithError(err).Errorf("Failed to enable optimistic locking of model %s", modelName)
+			return
+		}
+	}
+
+	addedTenantColumn := false
+	if tenantField != "" {
+		addedTenantColumn = modelDef.Field(tenantField) == nil
+		if err := modelDef.SetTenantField(tenantField); err != nil {
+			log.WithError(err).Errorf("Failed to scope model %s to tenants", modelName)
+			return
+		}
+	}
+	if err := setPermissions(modelDef, permissions); err != nil {
+		log.WithError(err).Errorf("Failed to set the permissions of model %s", modelName)
+		return
+	}
+	if err := setCache(cmd, modelDef); err != nil {
+		log.WithError(err).Errorf("Failed to set the cache of model %s", modelName)
+		return
+	}
+	previousUpsertIndex := model.UpsertIndexMigration(modelDef)
+	if len(upsertKeys) > 0 || noUpsert {
+		if err := modelDef.SetUpsertKeys(upsertKeys); err != nil {
+			log.WithError(err).Errorf("Failed to set the upsert keys of model %s", modelName)
+			return
+		}
+	}
+
+	if err := setFakeHints(modelDef, fakeHints); err != nil {
+		log.WithError(err).Errorf("Failed to set the fake hints of model %s", modelName)
+		return
+	}
+
+	previousTable := model.TableName(modelDef)
+	if table != "" {
+		if err := modelDef.SetTable(table); err != nil {
+			log.WithError(err).Errorf("Failed to rename the table of model %s", modelName)
 			return
 		}
+	}
+
+	if err := saveModelDefinition(conn, modelDef); err != nil {
+		log.WithError(err).Errorf("Failed to update model %s", modelName)
+		return
+	}
 
-		log.Infof("Model %s updated successfully", modelName)
+	log.Infof("Model %s updated successfully", modelName)
+	if table != "" && table != previousTable {
+		log.Infof("Rename the table in a migration: ALTER TABLE %s RENAME TO %s;", previousTable, table)
+	}
+	if addedTenantColumn {
+		log.Infof("Add the tenant column in a migration, setting the tenant of existing rows:\n%s",
+			strings.Join(model.TenantColumnMigration(modelDef), "\n"))
+	}
+	if upsertIndex := model.UpsertIndexMigration(modelDef); upsertIndex != "" && upsertIndex != previousUpsertIndex {
+		log.Infof("Add the unique index the upserts conflict on in a migration:\n%s", strings.TrimSpace(upsertIndex))
 	}
 }
 
-func runListModels(cmd *cobra.Command, args []string) {
+func runInferModel(cmd *cobra.Command, args []string) error {
+	modelName := sanitizeIdentifier(args[0])
+	jsonPath, _ := cmd.Flags().GetString("from-json")
+	csvPath, _ := cmd.Flags().GetString("from-csv")
+	nestedJSON, _ := cmd.Flags().GetBool("nested-json")
+	sampleRows, _ := cmd.Flags().GetInt("sample")
+	writeSeed, _ := cmd.Flags().GetBool("seed")
+	seedsDir, _ := cmd.Flags().GetString("seeds-dir")
+	table, _ := cmd.Flags().GetString("table")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	if (jsonPath == "") == (csvPath == "") {
+		return fmt.Errorf("set exactly one of --from-json and --from-csv")
+	}
+	if writeSeed && csvPath == "" {
+		return fmt.Errorf("--seed requires --from-csv")
+	}
+	if sampleRows < 1 {
+		return fmt.Errorf("--sample must be at least 1")
+	}
+
+	var sample []byte
+	var header []string
+	var records [][]string
+	var err error
+	if jsonPath != "" {
+		if sample, err = os.ReadFile(jsonPath); err != nil {
+			return fmt.Errorf("failed to read the JSON sample: %w", err)
+		}
+	} else if header, records, err = readCSVFile(csvPath); err != nil {
+		return err
+	}
+	strategy, err := namingStrategy()
+	if err != nil {
+		return fmt.Errorf("failed to get the naming strategy: %w", err)
+	}
+
+	var conn *orm.Connection
+	existing := map[string]bool{}
+	if !dryRun {
+		conn, err = getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+		models, err := listModelsFromDB(conn)
+		if err != nil {
+			return fmt.Errorf("failed to list models: %w", err)
+		}
+		for _, name := range models {
+			existing[name] = true
+		}
+		if existing[modelName] {
+			return fmt.Errorf("model %s already exists", modelName)
+		}
+	}
+
+	var modelDefs []*model.ModelDefinition
+	var columns []model.CSVColumn
+	if jsonPath != "" {
+		modelDefs, err = model.InferModels(modelName, sample, model.InferOptions{
+			NestedAsJSON: nestedJSON,
+			Exists:       func(name string) bool { return existing[name] },
+		})
+	} else {
+		var modelDef *model.ModelDefinition
+		modelDef, columns, err = model.InferModelFromCSV(modelName, header, records[:min(sampleRows, len(records))])
+		modelDefs = []*model.ModelDefinition{modelDef}
+	}
+	if err != nil {
+		return err
+	}
+	for _, modelDef := range modelDefs {
+		modelTable := strategy.TableName(modelDef.Name)
+		if modelDef.Name == modelName && table != "" {
+			modelTable = table
+		}
+		if err := modelDef.SetTable(modelTable); err != nil {
+			return fmt.Errorf("failed to set the table of model %s: %w", modelDef.Name, err)
+		}
+	}
+
+	var seedFile string
+	if !dryRun {
+		// Related models come first, so that the models referencing them are created after them.
+		for _, modelDef := range modelDefs {
+			if err := createModelDefinition(conn, modelDef); err != nil {
+				return fmt.Errorf("failed to create model %s: %w", modelDef.Name, err)
+			}
+		}
+		if writeSeed {
+			if seedFile, err = writeCSVSeed(seedsDir, modelDefs[0], columns, records); err != nil {
+				return err
+			}
+		}
+	}
+
+	result := struct {
+		Models []*model.ModelDefinition `json:"models"`
+		Seed   string                   `json:"seed,omitempty"`
+	}{modelDefs, seedFile}
+	return printResult(result, func() {
+		for _, modelDef := range modelDefs {
+			if dryRun {
+				log.Infof("Model %s with table %s:", modelDef.Name, modelDef.Options.Table)
+			} else {
+				log.Infof("Model %s created successfully with table %s:", modelDef.Name, modelDef.Options.Table)
+			}
+			for _, field := range modelDef.Fields {
+				line := fmt.Sprintf("  %s %s", field.Name, field.Type)
+				if field.IsNull {
+					line += " (nullable)"
+				}
+				if field.References != "" {
+					line += " -> " + field.References
+				}
+				log.Info(line)
+			}
+		}
+		if seedFile != "" {
+			log.Infof("Seed loading %d rows written to %s", len(records), seedFile)
+		}
+	})
+}
+
+// readCSVFile reads the header and records of a CSV file.
+func readCSVFile(file string) (header []string, records [][]string, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open the CSV file: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	records, err = reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the CSV file: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("the CSV file %s is empty", file)
+	}
+	return records[0], records[1:], nil
+}
+
+// writeCSVSeed writes a seed inserting the records of a CSV file into the table of the model inferred from it,
+// and returns the path of the seed file.
+func writeCSVSeed(seedsDir string, modelDef *model.ModelDefinition, columns []model.CSVColumn, records [][]string) (string, error) {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = model.ColumnName(modelDef.Field(column.Field))
+	}
+	rows := make([][]string, len(records))
+	for i, record := range records {
+		rows[i] = make([]string, len(columns))
+		for j, column := range columns {
+			if column.Index < len(record) {
+				rows[i][j] = strings.TrimSpace(record[column.Index])
+			}
+		}
+	}
+
+	fsys := filesystem.NewOSFS("")
+	if err := fsys.MkdirAll(seedsDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating seeds directory: %w", err)
+	}
+	file := path.Join(seedsDir, fmt.Sprintf("%s_%s.sql", time.Now().UTC().Format("20060102150405"), modelDef.Options.Table))
+	if err := fsys.WriteFile(file, []byte(seed.InsertSQL(modelDef.Options.Table, names, rows)), 0644); err != nil {
+		return "", fmt.Errorf("error writing seed: %w", err)
+	}
+	return file, nil
+}
+
+func runListModels(cmd *cobra.Command, args []string) error {
 	conn, err := getDBConnection()
 	if err != nil {
-		log.WithError(err).Error("Failed to get database connection")
-		return
+		return fmt.Errorf("failed to get database connection: %w", err)
 	}
 	defer conn.Close()
 
 	models, err := listModelsFromDB(conn)
 	if err != nil {
-		log.WithError(err).Error("Failed to list models")
-		return
+		return fmt.Errorf("failed to list models: %w", err)
 	}
 
-	if len(models) == 0 {
-		log.Info("No models found.")
-	} else {
-		log.Info("Available models:")
-		for _, m := range models {
-			log.Infof("- %s", m)
+	return printResult(models, func() {
+		if len(models) == 0 {
+			log.Info("No models found.")
+		} else {
+			log.Info("Available models:")
+			for _, m := range models {
+				log.Infof("- %s", m)
+			}
 		}
-	}
+	})
 }
 
 func listModelsFromDB(conn *orm.Connection) ([]string, error) {
@@ -187,7 +688,7 @@ func listModelsFromDB(conn *orm.Connection) ([]string, error) {
 	}
 	defer rows.Close()
 
-	var models []string
+	models := []string{}
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
@@ -200,7 +701,26 @@ func listModelsFromDB(conn *orm.Connection) ([]string, error) {
 }
 
 func runGenerateModel(cmd *cobra.Command, args []string) {
-	modelName := args[0]
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+	appName, _ := cmd.Flags().GetString("app")
+	withKV, _ := cmd.Flags().GetBool("kv")
+	withGoimports, _ := cmd.Flags().GetBool("goimports")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	force, _ := cmd.Flags().GetBool("force")
+	if err := model.UseGoimports(withGoimports); err != nil {
+		log.Error(err)
+		return
+	}
+
+	outputDir := ""
+	if appName != "" {
+		appDir, err := resolveAppDir(appName)
+		if err != nil {
+			log.WithError(err).Error("Failed to resolve app")
+			return
+		}
+		outputDir = path.Join(appDir, "internal", "models")
+	}
 
 	conn, err := getDBConnection()
 	if err != nil {
@@ -209,62 +729,524 @@ func runGenerateModel(cmd *cobra.Command, args []string) {
 	}
 	defer conn.Close()
 
-	var fieldsJSON []byte
-	rows, err := conn.Query("SELECT fields FROM models WHERE name = $1", modelName)
+	modelDefs, err := selectModelDefinitions(cmd, conn, args)
 	if err != nil {
-		log.WithError(err).Errorf("Failed to get model %s from database", modelName)
+		log.WithError(err).Error("Failed to get models from database")
+		return
+	}
+	if err := enforcePolicies(enforcement.Generate, modelDefs, nil); err != nil {
+		log.Error(err)
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		err := rows.Scan(&fieldsJSON)
+	fsys := filesystem.NewOSFS("")
+	manifest, err := loadManifest(fsys)
+	if err != nil {
+		log.WithError(err).Error("Failed to load generation manifest")
+		return
+	}
+
+	generated, cached := 0, 0
+	diffed := map[string]bool{}
+models:
+	for _, modelDef := range modelDefs {
+		artifacts := []model.Artifact{model.GoArtifact(modelDef.Name, outputDir)}
+		if withKV {
+			artifacts = append(artifacts, model.KVArtifact(modelDef.Name, outputDir))
+		}
+		upToDate := true
+		for _, artifact := range artifacts {
+			if !noCache && manifest.UpToDate(fsys, artifact, modelDef) {
+				continue
+			}
+			upToDate = false
+			files, err := model.RenderArtifact(artifact, modelDef)
+			if err != nil {
+				log.WithError(err).Errorf("Failed to generate model file for %s", modelDef.Name)
+				break models
+			}
+			if dryRun {
+				printArtifactDiff(fsys, manifest, files, diffed)
+				continue
+			}
+			if edited := editedFiles(fsys, manifest, files); len(edited) > 0 && !force {
+				log.Errorf("Not generating %s: %s edited since generated; review the changes with --dry-run and overwrite them with --force",
+					modelDef.Name, strings.Join(edited, ", "))
+				break models
+			}
+			if err := writeArtifact(fsys, manifest, artifact, modelDef, files); err != nil {
+				log.WithError(err).Errorf("Failed to generate model file for %s", modelDef.Name)
+				break models
+			}
+		}
+		if upToDate {
+			log.Debugf("Model %s is up to date, skipping", modelDef.Name)
+			cached++
+			continue
+		}
+
+		if !dryRun {
+			log.Infof("Model %s generated successfully", modelDef.Name)
+		}
+		generated++
+	}
+
+	if dryRun {
+		log.Infof("%d model(s) would be generated, %d already up to date; nothing was written", generated, cached)
+		return
+	}
+
+	// Save even after a failure so that the models generated so far are not regenerated next time.
+	if err := manifest.Save(fsys); err != nil {
+		log.WithError(err).Error("Failed to save generation manifest")
+		return
+	}
+
+	if cached > 0 {
+		log.Infof("Generated %d model(s), %d already up to date", generated, cached)
+	}
+}
+
+func runExportTS(cmd *cobra.Command, args []string) {
+	outputDir, _ := cmd.Flags().GetString("out")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		log.WithError(err).Error("Failed to get database connection")
+		return
+	}
+	defer conn.Close()
+
+	modelDefs, err := selectModelDefinitions(cmd, conn, args)
+	if err != nil {
+		log.WithError(err).Error("Failed to get models from database")
+		return
+	}
+	if err := enforcePolicies(enforcement.Generate, modelDefs, nil); err != nil {
+		log.Error(err)
+		return
+	}
+
+	fsys := filesystem.NewOSFS("")
+	manifest, err := loadManifest(fsys)
+	if err != nil {
+		log.WithError(err).Error("Failed to load generation manifest")
+		return
+	}
+	defer saveManifest(fsys, manifest)
+
+	for _, modelDef := range modelDefs {
+		files, err := generateArtifact(fsys, manifest, model.TypeScriptArtifact(modelDef.Name, outputDir), modelDef)
 		if err != nil {
-			log.WithError(err).Error("Failed to scan model fields")
+			log.WithError(err).Errorf("Failed to export TypeScript definitions for %s", modelDef.Name)
 			return
 		}
+		log.Infof("Exported %s to %s", modelDef.Name, files[0].Path)
+	}
+}
+
+func runProto(cmd *cobra.Command, args []string) {
+	outputDir, _ := cmd.Flags().GetString("out")
+	protoPackage, _ := cmd.Flags().GetString("package")
+	goPackage, _ := cmd.Flags().GetString("go-package")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		log.WithError(err).Error("Failed to get database connection")
+		return
+	}
+	defer conn.Close()
+
+	modelDefs, err := selectModelDefinitions(cmd, conn, args)
+	if err != nil {
+		log.WithError(err).Error("Failed to get models from database")
+		return
+	}
+	if err := enforcePolicies(enforcement.Generate, modelDefs, nil); err != nil {
+		log.Error(err)
+		return
+	}
 
-		var modelFields []model.Field
-		err = json.Unmarshal(fieldsJSON, &modelFields)
+	fsys := filesystem.NewOSFS("")
+	manifest, err := loadManifest(fsys)
+	if err != nil {
+		log.WithError(err).Error("Failed to load generation manifest")
+		return
+	}
+	defer saveManifest(fsys, manifest)
+
+	for _, modelDef := range modelDefs {
+		if model.AssignProtoNumbers(modelDef) {
+			if err := saveModelDefinition(conn, modelDef); err != nil {
+				log.WithError(err).Errorf("Failed to store protobuf field numbers for %s", modelDef.Name)
+				return
+			}
+		}
+
+		artifact := model.ProtoArtifact(modelDef.Name, outputDir, protoPackage, goPackage)
+		files, err := generateArtifact(fsys, manifest, artifact, modelDef)
 		if err != nil {
-			log.WithError(err).Error("Failed to unmarshal model fields")
+			log.WithError(err).Errorf("Failed to generate protobuf definitions for %s", modelDef.Name)
 			return
 		}
+		log.Infof("Generated %s for %s", files[0].Path, modelDef.Name)
+	}
+}
+
+func runVerifyModels(cmd *cobra.Command, args []string) error {
+	fsys := filesystem.NewOSFS("")
+	manifest, err := loadManifest(fsys)
+	if err != nil {
+		return fmt.Errorf("failed to load generation manifest: %w", err)
+	}
 
-		modelDef := &model.ModelDefinition{
-			Name:   modelName,
-			Fields: modelFields,
+	if len(manifest.Entries) == 0 {
+		log.Info("No generated artifacts recorded in the manifest.")
+		return nil
+	}
+
+	problems := manifest.Verify(fsys)
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	// Regenerate every recorded artifact in memory and compare against the manifest to prove reproducibility.
+	for _, key := range manifest.Keys() {
+		modelDef, err := fetchModelDefinition(conn, manifest.Entries[key].Model)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		reproduced, err := manifest.Reproduces(key, modelDef)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		if !reproduced {
+			problems = append(problems, fmt.Sprintf("%s: regenerated output does not match the manifest", key))
 		}
+	}
 
-		err = model.GenerateModelFile(modelDef)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			log.Error(problem)
+		}
+		return fmt.Errorf("generated artifacts are not reproducible (%d problem(s))", len(problems))
+	}
+
+	log.Infof("All %d generated artifact(s) match the manifest", len(manifest.Entries))
+	return nil
+}
+
+// generateArtifact renders an artifact from the given definition, writes its files, and records it in the
+// manifest.
+func generateArtifact(fsys filesystem.FS, manifest *model.Manifest, artifact model.Artifact, modelDef *model.ModelDefinition) ([]*model.GeneratedFile, error) {
+	files, err := model.RenderArtifact(artifact, modelDef)
+	if err != nil {
+		return nil, err
+	}
+	return files, writeArtifact(fsys, manifest, artifact, modelDef, files)
+}
+
+// writeArtifact writes the files rendered for an artifact and records it in the manifest.
+func writeArtifact(fsys filesystem.FS, manifest *model.Manifest, artifact model.Artifact, modelDef *model.ModelDefinition, files []*model.GeneratedFile) error {
+	for _, file := range files {
+		if err := file.Write(fsys); err != nil {
+			return err
+		}
+	}
+	return manifest.Record(artifact, modelDef, files...)
+}
+
+// editedFiles returns the paths of the existing files that writing the rendered files would change although
+// they were edited since they were generated, see model.Manifest.Edited.
+func editedFiles(fsys filesystem.FS, manifest *model.Manifest, files []*model.GeneratedFile) []string {
+	var edited []string
+	for _, file := range files {
+		current, err := fsys.ReadFile(file.Path)
+		if err == nil && !bytes.Equal(current, file.Content) && manifest.Edited(file.Path, current) {
+			edited = append(edited, file.Path)
+		}
+	}
+	return edited
+}
+
+// printArtifactDiff prints the unified diff between the existing files and the rendered ones, skipping the
+// files already in diffed, such as the base file shared by the models, and warns about those edited since they
+// were generated.
+func printArtifactDiff(fsys filesystem.FS, manifest *model.Manifest, files []*model.GeneratedFile, diffed map[string]bool) {
+	edited := editedFiles(fsys, manifest, files)
+	for _, file := range files {
+		if diffed[file.Path] {
+			continue
+		}
+		diffed[file.Path] = true
+		current, err := fsys.ReadFile(file.Path)
 		if err != nil {
-			log.WithError(err).Errorf("Failed to generate model file for %s", modelName)
-			return
+			current = nil
+		}
+		fmt.Print(model.UnifiedDiff(file.Path, current, file.Content))
+	}
+	for _, editedPath := range edited {
+		log.Warnf("%s was edited since it was generated; generating overwrites it only with --force", editedPath)
+	}
+}
+
+// loadManifest loads the template overrides of the project, see model.LoadTemplateOverrides, and the generation
+// manifest, so that artifacts are rendered and checked against the manifest with the templates in use.
+func loadManifest(fsys filesystem.FS) (*model.Manifest, error) {
+	overrides, err := model.LoadTemplateOverrides(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if len(overrides) > 0 {
+		log.Debugf("Using templates overriding %s", strings.Join(overrides, ", "))
+	}
+	return model.LoadManifest(fsys)
+}
+
+// saveManifest writes the manifest, logging instead of failing so that it can be deferred. Saving after a
+// partial failure keeps the artifacts generated so far recorded.
+func saveManifest(fsys filesystem.FS, manifest *model.Manifest) {
+	if err := manifest.Save(fsys); err != nil {
+		log.WithError(err).Error("Failed to save generation manifest")
+	}
+}
+
+// selectModelDefinitions resolves the models a command operates on: the single model named in args, or every
+// model when the command's --all flag is set. Exactly one of the two must be given.
+func selectModelDefinitions(cmd *cobra.Command, conn *orm.Connection, args []string) ([]*model.ModelDefinition, error) {
+	all, _ := cmd.Flags().GetBool("all")
+	if all == (len(args) == 1) {
+		return nil, fmt.Errorf("specify either a model name or --all")
+	}
+
+	if all {
+		return fetchAllModelDefinitions(conn)
+	}
+
+	modelDef, err := fetchModelDefinition(conn, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []*model.ModelDefinition{modelDef}, nil
+}
+
+// fetchAllModelDefinitions loads the definitions of every model stored in the models table, ordered by name.
+func fetchAllModelDefinitions(conn *orm.Connection) ([]*model.ModelDefinition, error) {
+	rows, err := conn.Query("SELECT name, fields, options FROM models ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query models: %w", err)
+	}
+	defer rows.Close()
+
+	var modelDefs []*model.ModelDefinition
+	for rows.Next() {
+		var name string
+		var fieldsJSON, optionsJSON []byte
+		if err := rows.Scan(&name, &fieldsJSON, &optionsJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan model: %w", err)
+		}
+
+		modelDef, err := decodeModelDefinition(name, fieldsJSON, optionsJSON)
+		if err != nil {
+			return nil, err
+		}
+		modelDefs = append(modelDefs, modelDef)
+	}
+
+	return modelDefs, rows.Err()
+}
+
+// fetchModelDefinition loads the stored fields and options of the named model from the models table and returns
+// them as a model.ModelDefinition. It returns an error if the model does not exist.
+func fetchModelDefinition(conn *orm.Connection, modelName string) (*model.ModelDefinition, error) {
+	var fieldsJSON, optionsJSON []byte
+	err := conn.GetDB().QueryRow("SELECT fields, options FROM models WHERE name = $1", modelName).Scan(&fieldsJSON, &optionsJSON)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("model %s does not exist", modelName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query model %s: %w", modelName, err)
+	}
+
+	return decodeModelDefinition(modelName, fieldsJSON, optionsJSON)
+}
+
+// decodeModelDefinition builds a model.ModelDefinition from the JSON columns of a row in the models table.
+func decodeModelDefinition(name string, fieldsJSON, optionsJSON []byte) (*model.ModelDefinition, error) {
+	var modelFields []model.Field
+	if err := json.Unmarshal(fieldsJSON, &modelFields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fields of model %s: %w", name, err)
+	}
+
+	modelDef := model.NewModelDefinition(name, modelFields)
+	if len(optionsJSON) > 0 {
+		if err := json.Unmarshal(optionsJSON, &modelDef.Options); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal options of model %s: %w", name, err)
 		}
+	}
+	return modelDef, nil
+}
 
-		log.Infof("Model %s generated successfully", modelName)
+// saveModelDefinition writes the fields and options of an existing model back to the models table and records
+// the new definition as the model's next version, see recordModelVersion, then updates the models file, see
+// saveModelsFile.
+func saveModelDefinition(conn *orm.Connection, modelDef *model.ModelDefinition) error {
+	tx, err := conn.GetDB().Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
+
+	if err := updateModelDefinition(tx, modelDef.Name, modelDef); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	saveModelsFile(conn)
+	return nil
 }
 
-// parseFields parses the given list of fields and returns a slice of model.Field.
+// updateModelDefinition stores the new definition of the model stored under name, renaming it and its history
+// if the definition is named otherwise, and records its new version.
+func updateModelDefinition(tx *sql.Tx, name string, modelDef *model.ModelDefinition) error {
+	fieldsJSON, optionsJSON, err := encodeModelDefinition(modelDef)
+	if err != nil {
+		return err
+	}
+
+	var oldFieldsJSON, oldOptionsJSON []byte
+	err = tx.QueryRow("SELECT fields, options FROM models WHERE name = $1 FOR UPDATE", name).Scan(&oldFieldsJSON, &oldOptionsJSON)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("model %s does not exist", name)
+	}
+	if err != nil {
+		return err
+	}
+	previous, err := decodeModelDefinition(name, oldFieldsJSON, oldOptionsJSON)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE models SET name = $1, fields = $2, options = $3, updated_at = CURRENT_TIMESTAMP WHERE name = $4",
+		modelDef.Name, fieldsJSON, optionsJSON, name); err != nil {
+		return err
+	}
+	if name != modelDef.Name {
+		if _, err := tx.Exec("UPDATE model_versions SET model_name = $1 WHERE model_name = $2", modelDef.Name, name); err != nil {
+			return fmt.Errorf("failed to rename the versions of model %s: %w", name, err)
+		}
+	}
+	return recordModelVersion(tx, previous, modelDef)
+}
+
+// createModelDefinition stores a new model in the models table and records its first version, then updates the
+// models file, see saveModelsFile.
+func createModelDefinition(conn *orm.Connection, modelDef *model.ModelDefinition) error {
+	fieldsJSON, optionsJSON, err := encodeModelDefinition(modelDef)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO models (name, fields, options) VALUES ($1, $2, $3)", modelDef.Name, fieldsJSON, optionsJSON); err != nil {
+		return err
+	}
+	if err := recordModelVersion(tx, nil, modelDef); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	saveModelsFile(conn)
+	return nil
+}
+
+// saveModelsFile writes the definitions of the models table to model.ModelsFile in the current directory, the
+// project root, so that they can be committed and loaded into another database with "model import". The
+// database holds the definitions, so failing to write the file is only logged.
+func saveModelsFile(conn *orm.Connection) {
+	modelDefs, err := fetchAllModelDefinitions(conn)
+	if err == nil {
+		err = model.SaveModels(filesystem.NewOSFS(""), modelDefs)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("Failed to update %s", model.ModelsFile)
+	}
+}
+
+// encodeModelDefinition returns the JSON stored in the fields and options columns of the models table.
+func encodeModelDefinition(modelDef *model.ModelDefinition) (fieldsJSON, optionsJSON []byte, err error) {
+	fieldsJSON, err = json.Marshal(modelDef.Fields)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal model fields: %w", err)
+	}
+	optionsJSON, err = json.Marshal(modelDef.Options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal model options: %w", err)
+	}
+	return fieldsJSON, optionsJSON, nil
+}
+
+// parseFields parses the given list of fields and returns a slice of model.Field. Fields are given as name:type,
+// or name:type:default=value to declare a default, see model.Field.SetDefault.
 // If no error occurs, it returns the slice of model.Field and a nil error. Otherwise, it returns nil and an error.
 func parseFields(fields []string) ([]model.Field, error) {
 	var modelFields []model.Field
-	for _, field := range fields {
-		parts := strings.Split(field, ":")
-		if len(parts) != 2 {
+	for _, field := range joinFieldSpecs(fields) {
+		parts := strings.SplitN(field, ":", 3)
+		if len(parts) < 2 {
 			return nil, fmt.Errorf("invalid field format: %s", field)
 		}
 		name := sanitizeIdentifier(parts[0])
 		fieldType := parts[1]
+		if err := model.ValidateFieldType(fieldType); err != nil {
+			return nil, fmt.Errorf("invalid field %s: %w", field, err)
+		}
 		tag := fmt.Sprintf(`json:"%s"`, strings.ToLower(name))
 		isNull := false
 		isPrimary := name == "ID" || name == "Id" || name == "id"
-		modelFields = append(modelFields, model.NewField(name, fieldType, tag, isNull, isPrimary))
+		modelField := model.NewField(name, fieldType, tag, isNull, isPrimary)
+		if len(parts) == 3 {
+			value, ok := strings.CutPrefix(parts[2], "default=")
+			if !ok {
+				return nil, fmt.Errorf("invalid field %s: expected name:type or name:type:default=value", field)
+			}
+			if err := modelField.SetDefault(value); err != nil {
+				return nil, err
+			}
+		}
+		modelFields = append(modelFields, modelField)
 	}
 	return modelFields, nil
 }
 
+// joinFieldSpecs rejoins the field definitions the comma-separated flag split inside parentheses, such as
+// "status:enum(pending" and "closed)" for "status:enum(pending,closed)".
+func joinFieldSpecs(fields []string) []string {
+	var joined []string
+	open := 0
+	for _, field := range fields {
+		if open > 0 {
+			joined[len(joined)-1] += "," + field
+		} else {
+			joined = append(joined, field)
+		}
+		open += strings.Count(field, "(") - strings.Count(field, ")")
+	}
+	return joined
+}
+
 // removeFieldsFromModel removes specified fields from a list of model fields and returns the updated list.
 //
 // Parameters:
@@ -308,6 +1290,24 @@ func getDBConnection() (*orm.Connection, error) {
 	return conn, nil
 }
 
+// registerCustomTypes registers the custom field types of the configuration, see model.RegisterType.
+func registerCustomTypes(cfg *config.Config) {
+	for _, t := range cfg.Types {
+		if err := model.RegisterType(model.CustomType{Name: t.Name, SQLType: t.SQLType, Import: t.Import}); err != nil {
+			log.WithError(err).Errorf("Ignoring custom type %s", t.Name)
+		}
+	}
+}
+
+// namingStrategy returns the naming strategy configured for the table names of new models.
+func namingStrategy() (model.NamingStrategy, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return "", fmt.Errorf("error loading config: %w", err)
+	}
+	return model.ParseNamingStrategy(cfg.Naming.Tables)
+}
+
 func sanitizeIdentifier(identifier string) string {
 	// Remove any characters that aren't alphanumeric or underscores
 	return regexp.MustCompile(`[^a-zA-Z0-9_]+`).ReplaceAllString(identifier, "")
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// fieldTypes are the built-in field types offered by the interactive model builder, followed by the registered
+// custom types.
+var fieldTypes = []string{"string", "int", "int64", "float64", "bool", "time.Time", "[]byte", "[]string", "[]int"}
+
+// modelBuilder walks through the fields of a new model with prompts, for "model create --interactive".
+type modelBuilder struct {
+	in  *bufio.Scanner
+	out io.Writer
+	// models are the existing models fields can reference.
+	models []string
+}
+
+func newModelBuilder(in io.Reader, out io.Writer, models []string) *modelBuilder {
+	return &modelBuilder{in: bufio.NewScanner(in), out: out, models: models}
+}
+
+// build prompts for the fields of the named model until an empty field name is entered, previews the
+// generated struct and asks for confirmation. It returns nil if the model is not confirmed.
+func (b *modelBuilder) build(name string) (*model.ModelDefinition, error) {
+	def := model.NewModelDefinition(name, nil)
+	fmt.Fprintf(b.out, "Defining model %s. Enter an empty field name when done.\n", name)
+	for {
+		fieldName, err := b.ask("Field name", "")
+		if err != nil {
+			return nil, err
+		}
+		if fieldName == "" {
+			if len(def.Fields) == 0 {
+				fmt.Fprintln(b.out, "A model needs at least one field.")
+				continue
+			}
+			break
+		}
+		fieldName = sanitizeIdentifier(fieldName)
+		if fieldName == "" || def.Field(fieldName) != nil {
+			fmt.Fprintf(b.out, "Field %q is invalid or already defined.\n", fieldName)
+			continue
+		}
+		if err := b.buildField(def, fieldName); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := model.RenderModelFile(def)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(b.out, "\n%s\n", file.Content)
+	ok, err := b.confirm(fmt.Sprintf("Create model %s?", name), true)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return def, nil
+}
+
+// buildField prompts for the type, nullability, default, index and relation of a field and adds it to def.
+func (b *modelBuilder) buildField(def *model.ModelDefinition, name string) error {
+	types := append([]string(nil), fieldTypes...)
+	for _, t := range model.RegisteredTypes() {
+		types = append(types, t.Name)
+	}
+	fieldType, err := b.choose("Type (? lists the types, vector(n) for embeddings, enum(a,b) for enums)", "string", types, func(answer string) bool {
+		return model.ValidateFieldType(answer) == nil
+	})
+	if err != nil {
+		return err
+	}
+	nullable, err := b.confirm("Nullable?", false)
+	if err != nil {
+		return err
+	}
+	isPrimary := strings.EqualFold(name, "id")
+	def.Fields = append(def.Fields, model.NewField(name, fieldType, fmt.Sprintf(`json:"%s"`, strings.ToLower(name)), nullable, isPrimary))
+
+	for {
+		value, err := b.ask("Default (empty for none)", "")
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			break
+		}
+		if err := def.SetDefault(name, value); err != nil {
+			fmt.Fprintln(b.out, err)
+			continue
+		}
+		break
+	}
+
+	indexed, err := b.confirm("Index?", false)
+	if err != nil {
+		return err
+	}
+	if indexed {
+		def.IndexField(name)
+	}
+
+	if len(b.models) == 0 || (fieldType != "int" && fieldType != "int64") {
+		return nil
+	}
+	referenced, err := b.choose("References model (empty for none)", "", b.models, nil)
+	if err != nil || referenced == "" {
+		return err
+	}
+	return def.SetReference(name, referenced)
+}
+
+// ask prints a prompt and returns the trimmed answer, or def if it is empty.
+func (b *modelBuilder) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(b.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(b.out, "%s: ", prompt)
+	}
+	if !b.in.Scan() {
+		if err := b.in.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("input ended before the model was complete")
+	}
+	answer := strings.TrimSpace(b.in.Text())
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// confirm asks a yes/no question.
+func (b *modelBuilder) confirm(prompt string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := b.ask(fmt.Sprintf("%s (%s)", prompt, hint), "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// choose asks for one of the given options, or an answer accepted by accept if it is not nil. An unambiguous
+// prefix of an option is completed to it and "?" lists the options. An empty answer returns def, which may be
+// empty.
+func (b *modelBuilder) choose(prompt, def string, options []string, accept func(string) bool) (string, error) {
+	for {
+		answer, err := b.ask(prompt, def)
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			return "", nil
+		}
+		if answer == "?" {
+			fmt.Fprintf(b.out, "  %s\n", strings.Join(options, ", "))
+			continue
+		}
+		if accept != nil && accept(answer) {
+			return answer, nil
+		}
+		matches := completeOption(answer, options)
+		switch len(matches) {
+		case 0:
+			fmt.Fprintf(b.out, "Unknown choice %q; enter ? to list the choices.\n", answer)
+		case 1:
+			if matches[0] != answer {
+				fmt.Fprintf(b.out, "  -> %s\n", matches[0])
+			}
+			return matches[0], nil
+		default:
+			fmt.Fprintf(b.out, "  %s\n", strings.Join(matches, ", "))
+		}
+	}
+}
+
+// completeOption returns the options input completes to: the option equal to it, ignoring case, or else every
+// option it is a prefix of.
+func completeOption(input string, options []string) []string {
+	var matches []string
+	for _, option := range options {
+		if strings.EqualFold(option, input) {
+			return []string{option}
+		}
+		if strings.HasPrefix(strings.ToLower(option), strings.ToLower(input)) {
+			matches = append(matches, option)
+		}
+	}
+	return matches
+}
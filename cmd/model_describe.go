@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/spf13/cobra"
+)
+
+var modelDescribeCmd = &cobra.Command{
+	Use:          "describe [name]",
+	Short:        "Show the definition of a model",
+	Long:         `Show the table and fields of a model with their columns, and its options: optimistic locking, tenant scoping, permissions, row-level security policies, search fields, upsert keys and caching. Cached models report their hit rates at runtime with models.ModelCacheStats.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runModelDescribe,
+}
+
+func init() {
+	modelCmd.AddCommand(modelDescribeCmd)
+}
+
+func runModelDescribe(cmd *cobra.Command, args []string) error {
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDef, err := fetchModelDefinition(conn, args[0])
+	if err != nil {
+		return err
+	}
+
+	return printResult(modelDef, func() {
+		log.Infof("Model %s (table %s)", modelDef.Name, model.TableName(modelDef))
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FIELD\tTYPE\tCOLUMN\tNULL\tDEFAULT\tDETAILS")
+		for i := range modelDef.Fields {
+			field := &modelDef.Fields[i]
+			null := "no"
+			if field.IsNull {
+				null = "yes"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", field.Name, field.Type, model.ColumnName(field), null,
+				field.Default, strings.Join(fieldDetails(field), ", "))
+		}
+		tw.Flush()
+
+		options := modelDef.Options
+		if options.LockVersion {
+			log.Info("Optimistic locking: enabled")
+		}
+		if options.TenantField != "" {
+			log.Infof("Tenant field: %s", options.TenantField)
+		}
+		if len(options.Permissions) > 0 {
+			actions := make([]string, 0, len(options.Permissions))
+			for action := range options.Permissions {
+				actions = append(actions, action)
+			}
+			sort.Strings(actions)
+			for _, action := range actions {
+				log.Infof("Permission: %s by %s", action, strings.Join(options.Permissions[action], ", "))
+			}
+		}
+		for _, policy := range options.Policies {
+			log.Infof("Policy: %s (%s) on %s = %s", policy.Name, policy.Kind, policy.Column, policy.Setting)
+		}
+		if len(options.SearchFields) > 0 {
+			log.Infof("Search fields: %s", strings.Join(options.SearchFields, ", "))
+		}
+		if columns := model.UpsertColumns(modelDef); len(columns) > 0 {
+			log.Infof("Upserts on: %s", strings.Join(columns, ", "))
+		}
+		log.Infof("Caching: %s", describeCache(modelDef))
+	})
+}
+
+// fieldDetails lists the properties of a field not shown in their own column.
+func fieldDetails(field *model.Field) []string {
+	var details []string
+	if field.IsPrimary {
+		details = append(details, "primary")
+	}
+	if field.Indexed {
+		details = append(details, "indexed")
+	}
+	if field.VectorMetric != "" {
+		details = append(details, "vector index "+field.VectorMetric)
+	}
+	if field.References != "" {
+		details = append(details, "references "+field.References)
+	}
+	if field.Encrypted {
+		details = append(details, "encrypted")
+	}
+	if field.Sensitive {
+		details = append(details, "sensitive")
+	}
+	if field.Fake != "" {
+		details = append(details, "fake "+field.Fake)
+	}
+	return details
+}
+
+// describeCache describes how the generated repository caches the records of a model.
+func describeCache(modelDef *model.ModelDefinition) string {
+	cache := modelDef.Options.Cache
+	if cache == nil {
+		return "disabled"
+	}
+	if !cache.Enabled {
+		return fmt.Sprintf("disabled (TTL %s, keyed by %s when enabled)", cache.TTL, cache.KeyStrategy)
+	}
+	return fmt.Sprintf("records read by Get are cached for %s, keyed by %s, and evicted when updated or deleted",
+		cache.TTL, model.CacheKeyDescription(cache.KeyStrategy))
+}
@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/spf13/cobra"
+)
+
+var modelHistoryCmd = &cobra.Command{
+	Use:          "history [name]",
+	Short:        "List the versions of a model's definition",
+	Long:         `List every version of a model's definition with the changes it made. A version is recorded each time the model is created or its definition changes.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runModelHistory,
+}
+
+var modelRollbackCmd = &cobra.Command{
+	Use:   "rollback [name]",
+	Short: "Restore an earlier version of a model's definition",
+	Long: `Restore the fields and options a model had in the version given with --to. The restored definition is
+recorded as a new version, so a rollback can itself be rolled back. Only the definition changes: run "model
+generate" and migrate the table afterwards.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runModelRollback,
+}
+
+var modelChangelogCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: "Describe schema changes for release notes",
+	Long: `Write a Markdown changelog of the schema changes between two git refs or two versions of a model: new
+and removed models, added, removed and changed fields, index, table and policy changes.
+
+With --from-ref, the model definitions are read from the models file (--file) committed at that ref and at
+--to-ref, or in the working tree when --to-ref is not given. With --model, the versions --from and --to (by
+default the current definition) recorded by "model history" are compared.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runModelChangelog,
+}
+
+func init() {
+	modelRollbackCmd.Flags().Int("to", 0, "Version to restore")
+	modelRollbackCmd.MarkFlagRequired("to")
+
+	modelChangelogCmd.Flags().String("from-ref", "", "Git ref to compare the model definitions from")
+	modelChangelogCmd.Flags().String("to-ref", "", "Git ref to compare the model definitions to (default the working tree)")
+	modelChangelogCmd.Flags().String("file", model.ModelsFile, "Models file read at the git refs")
+	modelChangelogCmd.Flags().String("model", "", "Model whose versions are compared")
+	modelChangelogCmd.Flags().Int("from", 0, "Version of the model to compare from")
+	modelChangelogCmd.Flags().Int("to", 0, "Version of the model to compare to (default the current definition)")
+	modelChangelogCmd.Flags().String("title", "Schema changes", "Heading of the changelog")
+	modelChangelogCmd.MarkFlagsMutuallyExclusive("from-ref", "model")
+
+	modelCmd.AddCommand(modelHistoryCmd)
+	modelCmd.AddCommand(modelRollbackCmd)
+	modelCmd.AddCommand(modelChangelogCmd)
+}
+
+// recordModelVersion stores a model's new definition as its next version in the model_versions table, along
+// with the changes from the previous definition, unless nothing changed. previous is nil for a new model. The
+// history of a model created before versioning starts with the definition being replaced.
+func recordModelVersion(tx *sql.Tx, previous, modelDef *model.ModelDefinition) error {
+	changes := model.DiffDefinitions(previous, modelDef)
+	if previous != nil && len(changes) == 0 {
+		return nil
+	}
+
+	var latest int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM model_versions WHERE model_name = $1", modelDef.Name).Scan(&latest); err != nil {
+		return fmt.Errorf("failed to read versions of model %s (run \"db migrate\" to create the model_versions table): %w", modelDef.Name, err)
+	}
+	if latest == 0 && previous != nil {
+		latest = 1
+		if err := insertModelVersion(tx, previous, latest, model.DiffDefinitions(nil, previous)); err != nil {
+			return err
+		}
+	}
+	return insertModelVersion(tx, modelDef, latest+1, changes)
+}
+
+func insertModelVersion(tx *sql.Tx, modelDef *model.ModelDefinition, version int, changes []string) error {
+	fieldsJSON, optionsJSON, err := encodeModelDefinition(modelDef)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO model_versions (model_name, version, fields, options, changes) VALUES ($1, $2, $3, $4, $5)",
+		modelDef.Name, version, fieldsJSON, optionsJSON, strings.Join(changes, "\n"))
+	if err != nil {
+		return fmt.Errorf("failed to record version %d of model %s: %w", version, modelDef.Name, err)
+	}
+	return nil
+}
+
+// fetchModelVersion loads the definition a model had in the given version from the model_versions table.
+func fetchModelVersion(conn *orm.Connection, modelName string, version int) (*model.ModelDefinition, error) {
+	var fieldsJSON, optionsJSON []byte
+	err := conn.GetDB().QueryRow("SELECT fields, options FROM model_versions WHERE model_name = $1 AND version = $2", modelName, version).
+		Scan(&fieldsJSON, &optionsJSON)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("model %s has no version %d", modelName, version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query version %d of model %s: %w", version, modelName, err)
+	}
+	return decodeModelDefinition(modelName, fieldsJSON, optionsJSON)
+}
+
+// modelVersionView is a version of a model as printed by "model history".
+type modelVersionView struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Changes   []string  `json:"changes"`
+}
+
+func runModelHistory(cmd *cobra.Command, args []string) error {
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := fetchModelDefinition(conn, args[0]); err != nil {
+		return err
+	}
+	rows, err := conn.GetDB().Query("SELECT version, created_at, changes FROM model_versions WHERE model_name = $1 ORDER BY version", args[0])
+	if err != nil {
+		return fmt.Errorf("failed to query versions of model %s: %w", args[0], err)
+	}
+	defer rows.Close()
+
+	versions := []modelVersionView{}
+	for rows.Next() {
+		var version modelVersionView
+		var changes string
+		if err := rows.Scan(&version.Version, &version.CreatedAt, &changes); err != nil {
+			return fmt.Errorf("failed to scan version: %w", err)
+		}
+		version.Changes = []string{}
+		if changes != "" {
+			version.Changes = strings.Split(changes, "\n")
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return printResult(versions, func() {
+		if len(versions) == 0 {
+			log.Infof("Model %s has no recorded versions", args[0])
+			return
+		}
+		for _, version := range versions {
+			fmt.Printf("Version %d  %s\n", version.Version, version.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+			for _, change := range version.Changes {
+				fmt.Printf("  %s\n", change)
+			}
+		}
+	})
+}
+
+func runModelRollback(cmd *cobra.Command, args []string) error {
+	version, _ := cmd.Flags().GetInt("to")
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	current, err := fetchModelDefinition(conn, args[0])
+	if err != nil {
+		return err
+	}
+	target, err := fetchModelVersion(conn, current.Name, version)
+	if err != nil {
+		return err
+	}
+
+	if len(model.DiffDefinitions(current, target)) == 0 {
+		log.Infof("Model %s already matches version %d", current.Name, version)
+		return nil
+	}
+	if err := saveModelDefinition(conn, target); err != nil {
+		return fmt.Errorf("failed to restore version %d of model %s: %w", version, current.Name, err)
+	}
+	log.Infof("Restored version %d of model %s; run \"model generate\" and migrate its table", version, current.Name)
+	return nil
+}
+
+func runModelChangelog(cmd *cobra.Command, args []string) error {
+	fromRef, _ := cmd.Flags().GetString("from-ref")
+	toRef, _ := cmd.Flags().GetString("to-ref")
+	file, _ := cmd.Flags().GetString("file")
+	modelName, _ := cmd.Flags().GetString("model")
+	from, _ := cmd.Flags().GetInt("from")
+	to, _ := cmd.Flags().GetInt("to")
+	title, _ := cmd.Flags().GetString("title")
+
+	var old, new []*model.ModelDefinition
+	var err error
+	switch {
+	case fromRef != "":
+		if old, err = readModelsAtRef(fromRef, file); err != nil {
+			return err
+		}
+		new, err = readModelsAtRef(toRef, file)
+	case modelName != "" && from > 0:
+		old, new, err = readModelVersions(modelName, from, to)
+	default:
+		return errors.New("either --from-ref, or --model and --from, is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	changelog := model.NewChangelog(old, new)
+	return printResult(changelog, func() {
+		fmt.Print(changelog.Markdown(title))
+	})
+}
+
+// readModelsAtRef reads the model definitions of a models file, as stored by the model manager, committed at a
+// git ref, or in the working tree when ref is empty.
+func readModelsAtRef(ref, file string) ([]*model.ModelDefinition, error) {
+	var data []byte
+	var err error
+	if ref == "" {
+		data, err = os.ReadFile(file)
+	} else {
+		if !filepath.IsAbs(file) {
+			file = "./" + filepath.ToSlash(file)
+		}
+		var stderr strings.Builder
+		show := exec.Command("git", "show", ref+":"+file)
+		show.Stderr = &stderr
+		data, err = show.Output()
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at %s: %w", file, refOrWorkingTree(ref), err)
+	}
+	defs, err := model.DecodeModels(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s at %s: %w", file, refOrWorkingTree(ref), err)
+	}
+	return defs, nil
+}
+
+func refOrWorkingTree(ref string) string {
+	if ref == "" {
+		return "the working tree"
+	}
+	return ref
+}
+
+// readModelVersions returns the definitions of a model at two recorded versions. A zero to stands for the
+// current definition.
+func readModelVersions(modelName string, from, to int) (old, new []*model.ModelDefinition, err error) {
+	conn, err := getDBConnection()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	current, err := fetchModelDefinition(conn, modelName)
+	if err != nil {
+		return nil, nil, err
+	}
+	versions := make([]*model.ModelDefinition, 2)
+	for i, version := range []int{from, to} {
+		if version == 0 {
+			versions[i] = current
+			continue
+		}
+		if versions[i], err = fetchModelVersion(conn, current.Name, version); err != nil {
+			return nil, nil, err
+		}
+	}
+	return versions[:1], versions[1:], nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var importModelsCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Load the model definitions of the models file into the database",
+	Long: `Loads the model definitions kept in ` + model.ModelsFile + `, which the model commands update whenever they
+change a model, into the database: the models missing from it are created, and those defined otherwise are
+updated to the definition of the file, recording a new version. Models of the database missing from the file
+are left alone. Use it to start from the definitions committed to git with a new database, or after pulling
+changes to them; then write the migrations of the tables with "db migrate".
+
+With --dry-run, the models that would be created or updated are listed without changing anything.`,
+	Example: `  grayv-lsm model import
+  grayv-lsm model import --file models.json --dry-run`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runImportModels,
+}
+
+func init() {
+	importModelsCmd.Flags().String("file", "", "Models file to load instead of "+model.ModelsFile)
+	importModelsCmd.Flags().Bool("dry-run", false, "List the models that would change without changing them")
+	modelCmd.AddCommand(importModelsCmd)
+}
+
+func runImportModels(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	fsys := filesystem.NewOSFS("")
+	var modelDefs []*model.ModelDefinition
+	var err error
+	if file == "" {
+		file = model.ModelsFile
+		modelDefs, err = model.LoadModels(fsys)
+	} else {
+		var data []byte
+		if data, err = fsys.ReadFile(file); err == nil {
+			modelDefs, err = model.DecodeModels(data)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if len(modelDefs) == 0 {
+		return fmt.Errorf("no model definitions in %s", file)
+	}
+	for _, modelDef := range modelDefs {
+		for _, field := range modelDef.Fields {
+			if err := model.ValidateFieldType(field.Type); err != nil {
+				return fmt.Errorf("invalid field %s of model %s: %w", field.Name, modelDef.Name, err)
+			}
+		}
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	stored, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return err
+	}
+	storedHashes := make(map[string]string, len(stored))
+	for _, modelDef := range stored {
+		if storedHashes[modelDef.Name], err = model.HashDefinition(modelDef); err != nil {
+			return err
+		}
+	}
+
+	var created, updated []string
+	for _, modelDef := range modelDefs {
+		hash, err := model.HashDefinition(modelDef)
+		if err != nil {
+			return err
+		}
+		storedHash, exists := storedHashes[modelDef.Name]
+		switch {
+		case !exists:
+			if !dryRun {
+				if err := createModelDefinition(conn, modelDef); err != nil {
+					return fmt.Errorf("failed to create model %s: %w", modelDef.Name, err)
+				}
+			}
+			created = append(created, modelDef.Name)
+		case storedHash != hash:
+			if !dryRun {
+				if err := saveModelDefinition(conn, modelDef); err != nil {
+					return fmt.Errorf("failed to update model %s: %w", modelDef.Name, err)
+				}
+			}
+			updated = append(updated, modelDef.Name)
+		}
+	}
+
+	result := map[string]interface{}{"file": file, "created": created, "updated": updated, "dry_run": dryRun}
+	return printResult(result, func() {
+		create, update := "Created", "Updated"
+		if dryRun {
+			create, update = "Would create", "Would update"
+		}
+		for _, name := range created {
+			log.Infof("%s model %s", create, name)
+		}
+		for _, name := range updated {
+			log.Infof("%s model %s", update, name)
+		}
+		if len(created)+len(updated) == 0 {
+			log.Infof("The %d model(s) of %s are up to date", len(modelDefs), file)
+		}
+	})
+}
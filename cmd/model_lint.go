@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var modelLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check model definitions against lint rules",
+	Long: `Check every model definition against the built-in lint rules and the rules of the configuration:
+
+  primary-key    the id primary key is not redeclared with another type, other fields are not marked primary
+  fk-index       fields referencing another model are indexed
+  reserved-word  tables and columns are not named after SQL reserved words
+  naming         models are PascalCase, tables snake_case, and field names survive code generation
+
+Built-in rules are disabled with lint.disable in the configuration, and rules matching names against regular
+expressions or requiring fields are added with lint.rules. The definitions are read from the database, or
+from a models file with --file. The command fails when an error is found, or any issue with --strict.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runModelLint,
+}
+
+func init() {
+	modelLintCmd.Flags().String("file", "", "Models file to lint instead of the models stored in the database")
+	modelLintCmd.Flags().Bool("strict", false, "Fail on warnings too")
+	modelLintCmd.Flags().String("junit", "", "Also write the report as JUnit XML to this file")
+
+	modelCmd.AddCommand(modelLintCmd)
+}
+
+func runModelLint(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	strict, _ := cmd.Flags().GetBool("strict")
+	junitPath, _ := cmd.Flags().GetString("junit")
+
+	rules, err := lintRules()
+	if err != nil {
+		return err
+	}
+
+	var modelDefs []*model.ModelDefinition
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if modelDefs, err = model.DecodeModels(data); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+	} else {
+		conn, err := getDBConnection()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		defer conn.Close()
+		if modelDefs, err = fetchAllModelDefinitions(conn); err != nil {
+			return err
+		}
+	}
+
+	issues := model.Lint(modelDefs, rules)
+	failing := 0
+	for _, issue := range issues {
+		if issue.Severity == model.LintError || strict {
+			failing++
+		}
+	}
+
+	if junitPath != "" {
+		if err := writeLintJUnit(junitPath, modelDefs, issues, strict); err != nil {
+			return fmt.Errorf("failed to write %s: %w", junitPath, err)
+		}
+	}
+	err = printResult(issues, func() {
+		for _, issue := range issues {
+			if issue.Severity == model.LintError {
+				log.Error(issue.String())
+			} else {
+				log.Warn(issue.String())
+			}
+		}
+		if len(issues) == 0 {
+			log.Infof("%d model(s) pass %d lint rule(s)", len(modelDefs), len(rules))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failing > 0 {
+		return fmt.Errorf("%d lint issue(s) found", failing)
+	}
+	return nil
+}
+
+// lintRules returns the lint rules selected by the configuration, see model.SelectLintRules.
+func lintRules() ([]model.LintRule, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %w", err)
+	}
+	var custom []model.LintRule
+	for _, r := range cfg.Lint.Rules {
+		rule, err := model.PatternRule{
+			Name:          r.Name,
+			Target:        r.Target,
+			Match:         r.Match,
+			Forbid:        r.Forbid,
+			RequireFields: r.RequireFields,
+			Severity:      r.Severity,
+			Message:       r.Message,
+		}.LintRule()
+		if err != nil {
+			return nil, err
+		}
+		custom = append(custom, rule)
+	}
+	return model.SelectLintRules(cfg.Lint.Disable, custom)
+}
+
+// junitTestSuite is the JUnit XML report of a lint run, with a test case per model.
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string         `xml:"classname,attr"`
+	Name      string         `xml:"name,attr"`
+	Failures  []junitFailure `xml:"failure"`
+	SystemOut string         `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+}
+
+// writeLintJUnit writes the issues as a JUnit XML report, which CI systems display per model. Issues failing
+// the run are failures; the other warnings are listed in the output of their model.
+func writeLintJUnit(path string, modelDefs []*model.ModelDefinition, issues []model.LintIssue, strict bool) error {
+	suite := junitTestSuite{Name: "model lint"}
+	cases := make(map[string]*junitTestCase, len(modelDefs))
+	for _, def := range modelDefs {
+		suite.TestCases = append(suite.TestCases, junitTestCase{ClassName: "models", Name: def.Name})
+	}
+	for i := range suite.TestCases {
+		cases[suite.TestCases[i].Name] = &suite.TestCases[i]
+	}
+	for _, issue := range issues {
+		testCase := cases[issue.Model]
+		if issue.Severity == model.LintError || strict {
+			testCase.Failures = append(testCase.Failures, junitFailure{Type: issue.Rule, Message: issue.String()})
+		} else {
+			testCase.SystemOut += issue.String() + "\n"
+		}
+	}
+	suite.Tests = len(suite.TestCases)
+	for _, testCase := range suite.TestCases {
+		if len(testCase.Failures) > 0 {
+			suite.Failures++
+		}
+	}
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(xml.Header+strings.TrimSpace(string(data))+"\n"), 0644)
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/enforcement"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var renameModelCmd = &cobra.Command{
+	Use:   "rename <model> <new-name>",
+	Short: "Rename a model, keeping the rows of its table",
+	Long: `Renames a model and the references of the other models to it. Its table is renamed to the table the naming
+strategy derives for the new name, unless it was named otherwise with "model update --table", along with its
+primary key, ID sequence and indexes, by a migration written to --migrations-dir: the rows are kept, unlike removing the model
+and creating it again. The artifacts recorded in the generation manifest for the model and the models
+referencing it are regenerated, and the files generated under the previous name removed.
+
+A rename breaks the application version still using the previous name, so the migration is a contract migration
+allowed to break the expand/contract rules; deploy it with the version using the new name.`,
+	Example: `  grayv-lsm model rename Order Purchase
+  grayv-lsm model rename Order Purchase --dry-run`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE:         runRenameModel,
+}
+
+var renameFieldCmd = &cobra.Command{
+	Use:   "rename-field <model> <field> <new-name>",
+	Short: "Rename a field of a model, keeping the values of its column",
+	Long: `Renames a field of a model, and the options naming it: the tenant field, the search fields, the upsert keys
+and the columns of the policies. Its column and indexes are renamed by a migration written to
+--migrations-dir, so the values are kept, unlike removing the field and adding it again. The artifacts recorded
+in the generation manifest for the model are regenerated.
+
+A rename breaks the application version still using the previous name, so the migration is a contract migration
+allowed to break the expand/contract rules; deploy it with the version using the new name.`,
+	Example:      `  grayv-lsm model rename-field Post body content`,
+	Args:         cobra.ExactArgs(3),
+	SilenceUsage: true,
+	RunE:         runRenameField,
+}
+
+func init() {
+	for _, c := range []*cobra.Command{renameModelCmd, renameFieldCmd} {
+		c.Flags().String("migrations-dir", "migrations", "Directory to write the migration to")
+		c.Flags().Bool("dry-run", false, "Print the migration without changing anything")
+		modelCmd.AddCommand(c)
+	}
+}
+
+func runRenameModel(cmd *cobra.Command, args []string) error {
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDefs, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return err
+	}
+	strategy, err := namingStrategy()
+	if err != nil {
+		return fmt.Errorf("failed to get the naming strategy: %w", err)
+	}
+	// The definitions changed by the rename, by their name before it.
+	changed := make(map[string]*model.ModelDefinition)
+	for _, def := range modelDefs {
+		if strings.EqualFold(def.Name, args[0]) {
+			changed[def.Name] = def
+		}
+		for _, field := range def.Fields {
+			if strings.EqualFold(field.References, args[0]) {
+				changed[def.Name] = def
+			}
+		}
+	}
+
+	rename, err := model.RenameModel(modelDefs, args[0], args[1], strategy)
+	if err != nil {
+		return err
+	}
+	return applyRename(cmd, conn, rename, changed)
+}
+
+func runRenameField(cmd *cobra.Command, args []string) error {
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDef, err := fetchModelDefinition(conn, args[0])
+	if err != nil {
+		return err
+	}
+	rename, err := model.RenameField(modelDef, args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return applyRename(cmd, conn, rename, map[string]*model.ModelDefinition{modelDef.Name: modelDef})
+}
+
+// applyRename writes the migration of a rename, stores the definitions it changed, given by their name before
+// the rename, and regenerates their artifacts. With --dry-run, it only prints the rename.
+func applyRename(cmd *cobra.Command, conn *orm.Connection, rename *model.Rename, changed map[string]*model.ModelDefinition) error {
+	migrationsDir, _ := cmd.Flags().GetString("migrations-dir")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	subject := "model " + rename.From
+	name := strings.ToLower(fmt.Sprintf("rename_%s_to_%s", rename.From, rename.To))
+	if rename.Field != "" {
+		subject = fmt.Sprintf("field %s.%s", rename.Model, rename.From)
+		name = strings.ToLower(fmt.Sprintf("rename_%s_%s_to_%s", rename.Model, rename.From, rename.To))
+	}
+	var migration string
+	if rename.Up != "" {
+		migration = fmt.Sprintf("-- Up\n-- Phase: contract\n-- Allow: expand-contract\n-- Rename %s to %s\n%s\n-- Down\n%s",
+			subject, rename.To, rename.Up, rename.Down)
+	}
+	if dryRun {
+		return printResult(rename, func() {
+			log.Infof("Would rename %s to %s", subject, rename.To)
+			for _, reference := range rename.References {
+				log.Infof("Would update the reference of %s", reference)
+			}
+			if migration != "" {
+				fmt.Print(migration)
+			}
+		})
+	}
+
+	var defs []*model.ModelDefinition
+	for _, previousName := range sortedNames(changed) {
+		defs = append(defs, changed[previousName])
+	}
+	if err := enforcePolicies(enforcement.Generate, defs, nil); err != nil {
+		return err
+	}
+
+	fsys := filesystem.NewOSFS("")
+	var migrationFile string
+	if migration != "" {
+		if err := fsys.MkdirAll(migrationsDir, 0755); err != nil {
+			return fmt.Errorf("error creating migrations directory: %w", err)
+		}
+		migrationFile = path.Join(migrationsDir, time.Now().UTC().Format("20060102150405")+"_"+name+".sql")
+		if err := fsys.WriteFile(migrationFile, []byte(migration), 0644); err != nil {
+			return fmt.Errorf("error writing migration: %w", err)
+		}
+	}
+
+	tx, err := conn.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, previousName := range sortedNames(changed) {
+		if err := updateModelDefinition(tx, previousName, changed[previousName]); err != nil {
+			return fmt.Errorf("failed to update model %s: %w", previousName, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	saveModelsFile(conn)
+
+	regenerated, removed, err := regenerateRenamed(fsys, changed)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		*model.Rename
+		Migration   string   `json:"migration,omitempty"`
+		Regenerated []string `json:"regenerated"`
+		Removed     []string `json:"removed"`
+	}{rename, migrationFile, regenerated, removed}
+	return printResult(result, func() {
+		log.Infof("Renamed %s to %s", subject, rename.To)
+		for _, reference := range rename.References {
+			log.Infof("Updated the reference of %s", reference)
+		}
+		if migrationFile != "" {
+			log.Infof("Wrote migration %s", migrationFile)
+		}
+		for _, key := range regenerated {
+			log.Infof("Regenerated %s", key)
+		}
+		for _, file := range removed {
+			log.Infof("Removed %s", file)
+		}
+	})
+}
+
+// regenerateRenamed regenerates the artifacts of the manifest for the changed definitions, given by their name
+// before a rename, recording them under their new name, and removes the files generated before that are not
+// generated anymore. It returns the keys of the artifacts regenerated and the files removed.
+func regenerateRenamed(fsys filesystem.FS, changed map[string]*model.ModelDefinition) (regenerated, removed []string, err error) {
+	manifest, err := loadManifest(fsys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load generation manifest: %w", err)
+	}
+	defer saveManifest(fsys, manifest)
+
+	for _, key := range manifest.Keys() {
+		entry := manifest.Entries[key]
+		def, ok := changed[entry.Model]
+		if !ok {
+			continue
+		}
+		artifact := entry.Artifact
+		if artifact.Model != def.Name {
+			delete(manifest.Entries, key)
+			artifact.Model = def.Name
+		}
+		files, err := generateArtifact(fsys, manifest, artifact, def)
+		if err != nil {
+			return regenerated, removed, fmt.Errorf("failed to regenerate %s: %w", artifact.Key(), err)
+		}
+		regenerated = append(regenerated, artifact.Key())
+
+		written := make(map[string]bool, len(files))
+		for _, file := range files {
+			written[file.Path] = true
+		}
+		for _, output := range entry.Outputs {
+			if written[output.Path] {
+				continue
+			}
+			if err := fsys.Remove(output.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return regenerated, removed, fmt.Errorf("failed to remove %s: %w", output.Path, err)
+			}
+			removed = append(removed, output.Path)
+		}
+	}
+	return regenerated, removed, nil
+}
+
+// sortedNames returns the names of the definitions, sorted.
+func sortedNames(defs map[string]*model.ModelDefinition) []string {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ooyeku/grayv-lsm/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+// Output formats selectable with the global --output flag.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var (
+	// outputFormat is the format command results are printed in.
+	outputFormat = outputText
+	// resultPrinted records that a command printed its result, so a failure it reports afterwards, such as
+	// lint issues, is not printed as a second JSON document.
+	resultPrinted bool
+)
+
+func init() {
+	RootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText,
+		`Output format: "text", or "json" to print command results as JSON on stdout and log lines as JSON on stderr`)
+	RootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := setupOutput(cmd, args); err != nil {
+			return err
+		}
+		if err := loadConfig(cmd); err != nil {
+			return err
+		}
+		return setupLogging(cmd)
+	}
+}
+
+// setupOutput validates --output. In JSON mode, log lines of every logger are written as JSON to stderr, so
+// stdout only holds the JSON result of the command, and errors are printed as JSON by Execute.
+func setupOutput(cmd *cobra.Command, args []string) error {
+	switch outputFormat {
+	case outputText:
+		return nil
+	case outputJSON:
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		logging.SetJSONOutput(os.Stderr)
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q (expected %q or %q)", outputFormat, outputText, outputJSON)
+	}
+}
+
+// printResult prints the result of a command: as indented JSON on stdout with --output json, otherwise by
+// calling text.
+func printResult(result interface{}, text func()) error {
+	if outputFormat != outputJSON {
+		text()
+		return nil
+	}
+	resultPrinted = true
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// printError prints an error returned by a command as a JSON object on stdout.
+func printError(err error) {
+	json.NewEncoder(os.Stdout).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
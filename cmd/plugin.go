@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"text/tabwriter"
+
+	"github.com/ooyeku/grayv-lsm/internal/plugin"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage plugins",
+	Long: `Plugins are executables named grayv-lsm-<name> on the PATH. "grayv-lsm <name> [args]" runs the plugin of
+that name with the arguments, so plugins add commands, and "plugin generate <name>" runs it as a code generator.`,
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the plugins on the PATH",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plugins := plugin.List(os.Getenv("PATH"))
+		return printResult(plugins, func() {
+			if len(plugins) == 0 {
+				log.Infof("No plugins found: plugins are executables named %s<name> on the PATH", plugin.Prefix)
+				return
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tPATH")
+			for _, p := range plugins {
+				fmt.Fprintf(tw, "%s\t%s\n", p.Name, p.Path)
+			}
+			tw.Flush()
+		})
+	},
+}
+
+var pluginGenerateCmd = &cobra.Command{
+	Use:   "generate [plugin] [model|--all]",
+	Short: "Generate code for models with a plugin",
+	Long: `Run a plugin as a code generator, e.g. for Ent, sqlc or Terraform, and write the files it generates to --out.
+
+The plugin is run with the "generate" argument and reads a JSON request on its standard input:
+
+  {"version": 1, "models": [{"definition": {...}, "table": "users", "columns": [{"name": "id", "type": "uint"}],
+   "schema": "CREATE TABLE users (...)"}], "options": {"key": "value"}}
+
+where definition is the model definition as stored in .grav/models.json, and options are given with --opt. It writes
+a JSON response on its standard output, listing the files to write by path relative to --out:
+
+  {"files": [{"path": "schema.sql", "content": "..."}]}
+
+The plugin logs to its standard error, and fails by exiting with a non-zero status.`,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	RunE:         runPluginGenerate,
+}
+
+func init() {
+	pluginGenerateCmd.Flags().Bool("all", false, "Generate code for every model")
+	pluginGenerateCmd.Flags().String("out", ".", "Directory to write the generated files to")
+	pluginGenerateCmd.Flags().StringToString("opt", map[string]string{}, "Options passed to the plugin, e.g. --opt engine=postgresql")
+
+	pluginCmd.AddCommand(pluginListCmd)
+	pluginCmd.AddCommand(pluginGenerateCmd)
+	RootCmd.AddCommand(pluginCmd)
+}
+
+func runPluginGenerate(cmd *cobra.Command, args []string) error {
+	outputDir, _ := cmd.Flags().GetString("out")
+	options, _ := cmd.Flags().GetStringToString("opt")
+
+	p, err := plugin.Lookup(args[0])
+	if err != nil {
+		return err
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDefs, err := selectModelDefinitions(cmd, conn, args[1:])
+	if err != nil {
+		return err
+	}
+
+	files, err := p.Generate(cmd.Context(), plugin.NewGenerateRequest(modelDefs, options), outputDir, os.Stderr)
+	if err != nil {
+		return err
+	}
+	fsys := filesystem.NewOSFS("")
+	written := make([]string, 0, len(files))
+	for _, file := range files {
+		if err := file.Write(fsys); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+		written = append(written, file.Path)
+	}
+	return printResult(written, func() {
+		for _, path := range written {
+			log.Infof("Wrote %s", path)
+		}
+		log.Infof("Plugin %s generated %d file(s) for %d model(s)", p.Name, len(written), len(modelDefs))
+	})
+}
+
+// runPluginCommand runs the plugin named by the first argument when it is not a command, see pluginCmd, and
+// exits with the plugin's status. It returns when there is no such plugin, for the command line to be parsed.
+func runPluginCommand(args []string) {
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' {
+		return
+	}
+	if found, _, err := RootCmd.Find(args); err == nil && found != RootCmd {
+		return
+	}
+	p, err := plugin.Lookup(args[0])
+	if err != nil {
+		return
+	}
+
+	err = p.Run(context.Background(), args[1:], os.Stdin, os.Stdout, os.Stderr)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
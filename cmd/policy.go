@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage row-level security policies of models",
+	Long: `Declare Postgres row-level security policies on a model's table. A tenant policy only exposes rows whose
+column matches the tenant of the session (app.tenant_id by default), an owner policy only rows whose column
+matches the session's user (app.user_id by default). The model's migration enables row-level security and
+creates the policies, and its generated repository sets the settings from the request context, see
+WithTenantID and WithUserID. Run "model generate" after changing policies.`,
+}
+
+var policyAddCmd = &cobra.Command{
+	Use:          "add [model]",
+	Short:        "Add a tenant isolation or owner-only policy to a model",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runPolicyAdd,
+}
+
+var policyRemoveCmd = &cobra.Command{
+	Use:          "remove [model] [policy]",
+	Short:        "Remove a policy from a model",
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE:         runPolicyRemove,
+}
+
+var policyListCmd = &cobra.Command{
+	Use:          "list [model]",
+	Short:        "List the policies of a model",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runPolicyList,
+}
+
+var policySQLCmd = &cobra.Command{
+	Use:          "sql [model]",
+	Short:        "Print the migration creating a model's table and policies",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runPolicySQL,
+}
+
+func init() {
+	policyAddCmd.Flags().String("tenant", "", "Column holding the tenant of each row")
+	policyAddCmd.Flags().String("owner", "", "Column holding the user owning each row")
+	policyAddCmd.Flags().String("setting", "", "Session setting compared with the column (default app.tenant_id or app.user_id)")
+
+	policyCmd.AddCommand(policyAddCmd)
+	policyCmd.AddCommand(policyRemoveCmd)
+	policyCmd.AddCommand(policyListCmd)
+	policyCmd.AddCommand(policySQLCmd)
+	modelCmd.AddCommand(policyCmd)
+}
+
+func runPolicyAdd(cmd *cobra.Command, args []string) error {
+	tenantColumn, _ := cmd.Flags().GetString("tenant")
+	ownerColumn, _ := cmd.Flags().GetString("owner")
+	setting, _ := cmd.Flags().GetString("setting")
+
+	var kind, column string
+	switch {
+	case tenantColumn != "" && ownerColumn != "":
+		return fmt.Errorf("--tenant and --owner cannot be combined; add each policy separately")
+	case tenantColumn != "":
+		kind, column = model.PolicyTenant, tenantColumn
+	case ownerColumn != "":
+		kind, column = model.PolicyOwner, ownerColumn
+	default:
+		return fmt.Errorf("either --tenant or --owner is required")
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDef, err := fetchModelDefinition(conn, args[0])
+	if err != nil {
+		return err
+	}
+	policy, err := model.NewPolicy(modelDef, kind, column, setting)
+	if err != nil {
+		return err
+	}
+	model.AddPolicy(modelDef, policy)
+	if err := saveModelDefinition(conn, modelDef); err != nil {
+		return fmt.Errorf("failed to store policies of %s: %w", modelDef.Name, err)
+	}
+
+	log.Infof("Added policy %s to %s", policy.Name, modelDef.Name)
+	return nil
+}
+
+func runPolicyRemove(cmd *cobra.Command, args []string) error {
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDef, err := fetchModelDefinition(conn, args[0])
+	if err != nil {
+		return err
+	}
+	if !model.RemovePolicy(modelDef, args[1]) {
+		return fmt.Errorf("model %s has no policy %s", modelDef.Name, args[1])
+	}
+	if err := saveModelDefinition(conn, modelDef); err != nil {
+		return fmt.Errorf("failed to store policies of %s: %w", modelDef.Name, err)
+	}
+
+	log.Infof("Removed policy %s from %s", args[1], modelDef.Name)
+	return nil
+}
+
+// policyView is a policy as printed by "model policy list".
+type policyView struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Column  string `json:"column"`
+	Setting string `json:"setting"`
+}
+
+func runPolicyList(cmd *cobra.Command, args []string) error {
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDef, err := fetchModelDefinition(conn, args[0])
+	if err != nil {
+		return err
+	}
+	policies := []policyView{}
+	for _, policy := range modelDef.Options.Policies {
+		policies = append(policies, policyView{Name: policy.Name, Kind: policy.Kind, Column: policy.Column, Setting: policy.Setting})
+	}
+
+	return printResult(policies, func() {
+		if len(policies) == 0 {
+			log.Infof("Model %s has no policies", modelDef.Name)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "POLICY\tKIND\tCOLUMN\tSETTING")
+		for _, policy := range policies {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", policy.Name, policy.Kind, policy.Column, policy.Setting)
+		}
+		w.Flush()
+	})
+}
+
+func runPolicySQL(cmd *cobra.Command, args []string) error {
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDef, err := fetchModelDefinition(conn, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Print((&model.ModelManager{}).GenerateMigration(modelDef))
+	return nil
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/internal/privacy"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/ooyeku/grayv-lsm/pkg/encryption"
+	"github.com/spf13/cobra"
+)
+
+var privacyCmd = &cobra.Command{
+	Use:   "privacy",
+	Short: "Export and erase the personal data of a data subject",
+	Long: `Handle data subject requests. The personal data of a subject, such as a user, is its own record and the
+records of every model with a field referencing its model; mark the relations with "model update --references"
+and the fields holding personal data with "model update --sensitive-fields". Every export and erasure is
+recorded in the privacy_audit table created by "db migrate".`,
+}
+
+var privacyExportCmd = &cobra.Command{
+	Use:          "export",
+	Short:        "Export the personal data of a data subject as JSON",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runPrivacyExport,
+}
+
+var privacyEraseCmd = &cobra.Command{
+	Use:   "erase",
+	Short: "Anonymize or delete the personal data of a data subject",
+	Long: `Erases a data subject and its related records in a single transaction. In anonymize mode, the default,
+the sensitive fields of the records are overwritten and the records are kept; in delete mode the records are
+deleted. Erasure is irreversible and requires --yes.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runPrivacyErase,
+}
+
+func init() {
+	for _, c := range []*cobra.Command{privacyExportCmd, privacyEraseCmd} {
+		c.Flags().String("model", "", "Model of the data subject, e.g. User")
+		c.Flags().Int64("id", 0, "ID of the data subject")
+		c.Flags().String("actor", os.Getenv("USER"), "Person handling the request, recorded in the audit table")
+		c.MarkFlagRequired("model")
+		c.MarkFlagRequired("id")
+	}
+	privacyExportCmd.Flags().String("out", "", "Write the export to this file instead of stdout")
+	privacyEraseCmd.Flags().String("mode", privacy.Anonymize, `Erasure mode: "anonymize" or "delete"`)
+	privacyEraseCmd.Flags().Bool("yes", false, "Confirm the erasure")
+
+	privacyCmd.AddCommand(privacyExportCmd)
+	privacyCmd.AddCommand(privacyEraseCmd)
+	RootCmd.AddCommand(privacyCmd)
+}
+
+// newPrivacyPlan loads every model definition and plans the handling of a request for a subject of the model
+// given with --model.
+func newPrivacyPlan(cmd *cobra.Command, conn *orm.Connection) (*privacy.Plan, error) {
+	modelName, _ := cmd.Flags().GetString("model")
+
+	modelDefs, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return nil, err
+	}
+	return privacy.NewPlan(modelName, modelDefs)
+}
+
+func runPrivacyExport(cmd *cobra.Command, args []string) error {
+	id, _ := cmd.Flags().GetInt64("id")
+	actor, _ := cmd.Flags().GetString("actor")
+	out, _ := cmd.Flags().GetString("out")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	// Without keys, encrypted fields are exported as stored.
+	var keyring *encryption.Keyring
+	if len(cfg.Encryption.Keys) > 0 {
+		if keyring, err = encryption.NewKeyring(cfg.Encryption.Keys, cfg.Encryption.Primary); err != nil {
+			return fmt.Errorf("invalid encryption config: %w", err)
+		}
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	plan, err := newPrivacyPlan(cmd, conn)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := plan.Export(cmd.Context(), conn.GetDB(), id, keyring, actor)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		resultPrinted = true
+		return encoder.Encode(bundle)
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, data, 0600); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return printResult(map[string]string{"file": out}, func() {
+		log.Infof("Personal data of %s %d written to %s", plan.Subject.Name, id, out)
+	})
+}
+
+func runPrivacyErase(cmd *cobra.Command, args []string) error {
+	id, _ := cmd.Flags().GetInt64("id")
+	actor, _ := cmd.Flags().GetString("actor")
+	mode, _ := cmd.Flags().GetString("mode")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	if !yes {
+		return fmt.Errorf("erasure is irreversible; pass --yes to confirm")
+	}
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	plan, err := newPrivacyPlan(cmd, conn)
+	if err != nil {
+		return err
+	}
+
+	erasure, err := plan.Erase(cmd.Context(), conn.GetDB(), id, mode, actor)
+	if err != nil {
+		return err
+	}
+
+	return printResult(erasure, func() {
+		tables := make([]string, 0, len(erasure.Affected))
+		for table := range erasure.Affected {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			log.Infof("%s: %d rows", table, erasure.Affected[table])
+		}
+		log.Infof("Erased %s %d (%s)", plan.Subject.Name, id, mode)
+	})
+}
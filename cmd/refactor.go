@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/enforcement"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var refactorCmd = &cobra.Command{
+	Use:   "refactor",
+	Short: "Apply changes across every model",
+}
+
+var refactorFieldTypeCmd = &cobra.Command{
+	Use:   "field-type",
+	Short: "Change the type of every field of a type",
+	Long: `Change every field declared with the --from type, or a pointer or slice of it, to the --to type, e.g.
+every float64 field to decimal.Decimal (registered as a custom type stored as NUMERIC(12,2)). The model
+definitions are updated, the artifacts recorded in the generation manifest for the changed models are
+regenerated, and migrations altering the column types are written to --migrations-dir, each altering the
+tables of up to --batch-size models. Use --dry-run to list the fields that would change.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runRefactorFieldType,
+}
+
+func init() {
+	refactorFieldTypeCmd.Flags().String("from", "", "Current type of the fields, e.g. float64")
+	refactorFieldTypeCmd.Flags().String("to", "", "New type of the fields, e.g. decimal.Decimal")
+	refactorFieldTypeCmd.Flags().StringSlice("models", nil, "Only change the fields of these models")
+	refactorFieldTypeCmd.Flags().String("migrations-dir", "migrations", "Directory to write the migrations to")
+	refactorFieldTypeCmd.Flags().Int("batch-size", 10, "Number of tables altered by each migration")
+	refactorFieldTypeCmd.Flags().Bool("dry-run", false, "List the fields that would change without changing anything")
+	refactorFieldTypeCmd.MarkFlagRequired("from")
+	refactorFieldTypeCmd.MarkFlagRequired("to")
+
+	refactorCmd.AddCommand(refactorFieldTypeCmd)
+	RootCmd.AddCommand(refactorCmd)
+}
+
+func runRefactorFieldType(cmd *cobra.Command, args []string) error {
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	only, _ := cmd.Flags().GetStringSlice("models")
+	migrationsDir, _ := cmd.Flags().GetString("migrations-dir")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if batchSize < 1 {
+		return fmt.Errorf("--batch-size must be at least 1")
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDefs, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return err
+	}
+	if len(only) > 0 {
+		var selected []*model.ModelDefinition
+		for _, def := range modelDefs {
+			if contains(only, def.Name) {
+				selected = append(selected, def)
+			}
+		}
+		if len(selected) != len(only) {
+			return fmt.Errorf("unknown model in %s", strings.Join(only, ", "))
+		}
+		modelDefs = selected
+	}
+
+	changes, err := model.ChangeFieldType(modelDefs, from, to)
+	if err != nil {
+		return err
+	}
+	if dryRun || len(changes) == 0 {
+		return printResult(changes, func() {
+			for _, change := range changes {
+				log.Infof("%s.%s: %s -> %s", change.Model, change.Field, change.From, change.To)
+			}
+			if len(changes) == 0 {
+				log.Infof("No field has type %s", from)
+			}
+		})
+	}
+
+	byName := make(map[string]*model.ModelDefinition, len(modelDefs))
+	for _, def := range modelDefs {
+		byName[def.Name] = def
+	}
+	changed := make(map[string]*model.ModelDefinition)
+	var changedDefs []*model.ModelDefinition
+	for _, change := range changes {
+		if changed[change.Model] == nil {
+			changed[change.Model] = byName[change.Model]
+			changedDefs = append(changedDefs, byName[change.Model])
+		}
+	}
+	if err := enforcePolicies(enforcement.Generate, changedDefs, nil); err != nil {
+		return err
+	}
+
+	fsys := filesystem.NewOSFS("")
+	up, down := model.FieldTypeMigrations(changes, batchSize)
+	if err := fsys.MkdirAll(migrationsDir, 0755); err != nil {
+		return fmt.Errorf("error creating migrations directory: %w", err)
+	}
+	version := time.Now().UTC()
+	var migrationFiles []string
+	for i := range up {
+		name := fmt.Sprintf("%s_change_%s_to_%s_%d.sql", version.Add(time.Duration(i)*time.Second).Format("20060102150405"),
+			strings.ToLower(sanitizeIdentifier(from)), strings.ToLower(sanitizeIdentifier(to)), i+1)
+		content := fmt.Sprintf("-- Up\n-- Change %s fields to %s\n%s\n-- Down\n%s", from, to, up[i], down[i])
+		file := path.Join(migrationsDir, name)
+		if err := fsys.WriteFile(file, []byte(content), 0644); err != nil {
+			return fmt.Errorf("error writing migration: %w", err)
+		}
+		migrationFiles = append(migrationFiles, file)
+	}
+
+	for _, def := range changedDefs {
+		if err := saveModelDefinition(conn, def); err != nil {
+			return fmt.Errorf("failed to update model %s: %w", def.Name, err)
+		}
+	}
+
+	manifest, err := loadManifest(fsys)
+	if err != nil {
+		return fmt.Errorf("failed to load generation manifest: %w", err)
+	}
+	defer saveManifest(fsys, manifest)
+	var regenerated []string
+	for _, key := range manifest.Keys() {
+		artifact := manifest.Entries[key].Artifact
+		def, ok := changed[artifact.Model]
+		if !ok {
+			continue
+		}
+		if _, err := generateArtifact(fsys, manifest, artifact, def); err != nil {
+			return fmt.Errorf("failed to regenerate %s: %w", key, err)
+		}
+		regenerated = append(regenerated, key)
+	}
+
+	result := struct {
+		Changes     []model.FieldTypeChange `json:"changes"`
+		Migrations  []string                `json:"migrations"`
+		Regenerated []string                `json:"regenerated"`
+	}{changes, migrationFiles, regenerated}
+	return printResult(result, func() {
+		for _, change := range changes {
+			log.Infof("%s.%s: %s -> %s", change.Model, change.Field, change.From, change.To)
+		}
+		for _, file := range migrationFiles {
+			log.Infof("Wrote migration %s", file)
+		}
+		for _, key := range regenerated {
+			log.Infof("Regenerated %s", key)
+		}
+	})
+}
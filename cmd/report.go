@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/report"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Run the named reports of the project",
+	Long: `Run the reports defined in the reports/ directory of the project (--dir): SQL files, or YAML files with
+parameters, a query written in SQL or built from its clauses, and a schedule. Parameters are referenced as
+:name in queries and bound as query parameters, never interpolated.`,
+}
+
+var reportListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the reports with their parameters and schedules",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runReportList,
+}
+
+var reportRunCmd = &cobra.Command{
+	Use:   "run name",
+	Short: "Run a report and print its result",
+	Long: `Runs a report with the parameters given with --param name=value, or their defaults, and prints its result
+as a table, or writes it as CSV or JSON (--format), to --out when given. Dates accept today and yesterday, and
+months this_month and last_month, e.g.:
+
+  grayv-lsm report run monthly_revenue --param month=2024-05 --format csv --out revenue.csv`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runReportRun,
+}
+
+var reportSchedulerCmd = &cobra.Command{
+	Use:   "scheduler",
+	Short: "Run the scheduled reports on their schedules",
+	Long: `Runs the reports with a schedule at the times of their cron schedules, in the local time zone, with the
+parameters of their schedules, until interrupted. Every run writes a file to --out-dir named after the report
+and the time of the run, e.g. monthly_revenue-20240601T0600.csv. Failed runs are logged and retried at the
+next time of their schedule.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runReportScheduler,
+}
+
+func init() {
+	reportCmd.PersistentFlags().String("dir", ".", "Project directory containing the reports directory")
+	reportRunCmd.Flags().StringArray("param", []string{}, "Parameter of the report, as name=value (repeatable)")
+	reportRunCmd.Flags().String("format", report.FormatTable, "Output format: table, csv or json")
+	reportRunCmd.Flags().String("out", "", "Write the result to this file instead of stdout")
+	reportSchedulerCmd.Flags().String("out-dir", filepath.Join(report.Dir, "out"), "Directory to write the results of the runs to")
+
+	reportCmd.AddCommand(reportListCmd)
+	reportCmd.AddCommand(reportRunCmd)
+	reportCmd.AddCommand(reportSchedulerCmd)
+	RootCmd.AddCommand(reportCmd)
+}
+
+func loadReports(cmd *cobra.Command) ([]*report.Report, error) {
+	dir, _ := cmd.Flags().GetString("dir")
+	return report.Load(os.DirFS(dir))
+}
+
+func runReportList(cmd *cobra.Command, args []string) error {
+	reports, err := loadReports(cmd)
+	if err != nil {
+		return err
+	}
+	return printResult(reports, func() {
+		if len(reports) == 0 {
+			log.Info("No reports found")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tPARAMETERS\tSCHEDULE\tNEXT RUN\tDESCRIPTION")
+		for _, r := range reports {
+			params := make([]string, len(r.Params))
+			for i, p := range r.Params {
+				params[i] = p.Name + " " + p.Type
+				if !p.Required {
+					params[i] = "[" + params[i] + "]"
+				}
+			}
+			schedule, next := "", ""
+			if r.Cron() != nil {
+				schedule = r.Cron().String()
+				if at := r.Cron().Next(time.Now()); !at.IsZero() {
+					next = at.Format("2006-01-02 15:04")
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Name, strings.Join(params, ", "), schedule, next, r.Description)
+		}
+		tw.Flush()
+	})
+}
+
+// parseReportParams parses the --param flags, given as name=value.
+func parseReportParams(params []string) (map[string]string, error) {
+	values := make(map[string]string, len(params))
+	for _, param := range params {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid parameter %q: use name=value", param)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func runReportRun(cmd *cobra.Command, args []string) error {
+	params, _ := cmd.Flags().GetStringArray("param")
+	format, _ := cmd.Flags().GetString("format")
+	out, _ := cmd.Flags().GetString("out")
+
+	if err := report.CheckFormat(format); err != nil {
+		return err
+	}
+	values, err := parseReportParams(params)
+	if err != nil {
+		return err
+	}
+	reports, err := loadReports(cmd)
+	if err != nil {
+		return err
+	}
+	r, err := report.Find(reports, args[0])
+	if err != nil {
+		return err
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	result, err := report.Run(cmd.Context(), conn.GetDB(), r, values, time.Now())
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		if outputFormat == outputJSON {
+			// The result is printed as JSON, whatever the format.
+			return printResult(result, nil)
+		}
+		return report.Write(os.Stdout, format, result)
+	}
+	if err := writeReportFile(out, format, result); err != nil {
+		return err
+	}
+	return printResult(map[string]interface{}{"report": r.Name, "rows": len(result.Rows), "out": out}, func() {
+		log.Infof("Wrote %d rows of report %s to %s", len(result.Rows), r.Name, out)
+	})
+}
+
+// writeReportFile writes the result of a report to a file, removing the file if writing fails.
+func writeReportFile(path, format string, result *report.Result) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	err = report.Write(f, format, result)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func runReportScheduler(cmd *cobra.Command, args []string) error {
+	outDir, _ := cmd.Flags().GetString("out-dir")
+
+	reports, err := loadReports(cmd)
+	if err != nil {
+		return err
+	}
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for _, r := range report.Scheduled(reports) {
+		log.Infof("Scheduled report %s: %s", r.Name, r.Cron())
+	}
+	err = report.RunSchedule(ctx, reports, func(r *report.Report, at time.Time) {
+		result, err := report.Run(ctx, conn.GetDB(), r, r.Schedule.Params, at)
+		if err == nil {
+			path := report.OutputPath(outDir, r, at)
+			if err = writeReportFile(path, r.ScheduleFormat(), result); err == nil {
+				log.Infof("Wrote %d rows of report %s to %s", len(result.Rows), r.Name, path)
+				return
+			}
+		}
+		log.WithError(err).Errorf("Scheduled run of report %s failed", r.Name)
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -13,9 +16,17 @@ var RootCmd = &cobra.Command{
 	Long:  ` grayv-lsm is a CLI tool for managing the lifecycle of Grayv App.  Grayv apps are lightweight backend components consising of a containerized database, a model/schema generator, and an orm system.`,
 }
 
+// Execute runs the command named by the arguments. Ctrl-C or SIGTERM cancel the context of the command, which
+// interrupts the statements it runs on the database and rolls back their transactions.
 func Execute() {
-	err := RootCmd.Execute()
+	runPluginCommand(os.Args[1:])
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := RootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
+		if outputFormat == outputJSON && !resultPrinted {
+			printError(err)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/search"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Manage the search indexes of models",
+	Long: `Manage the indexes of the models with search fields, set with "model update --search-fields", in the
+search backend of the Search configuration: Meilisearch or Elasticsearch.`,
+}
+
+var searchReindexCmd = &cobra.Command{
+	Use:   "reindex [model]",
+	Short: "Rebuild the search index of a model from its table",
+	Long: `Replaces the documents of the search index of a model, or of every model with search fields when none is
+given, with its records. The generated repositories index the records they change once EnableSearch is
+called; reindex after enabling search on a model and after changing records otherwise, e.g. in migrations.
+The index is empty until the first batch of records is indexed.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runSearchReindex,
+}
+
+func init() {
+	searchReindexCmd.Flags().Int("batch-size", search.DefaultBatchSize, "Number of records indexed at once")
+
+	searchCmd.AddCommand(searchReindexCmd)
+	RootCmd.AddCommand(searchCmd)
+}
+
+func runSearchReindex(cmd *cobra.Command, args []string) error {
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	backend, err := search.New(cfg.Search)
+	if err != nil {
+		return err
+	}
+
+	conn, err := getDBConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	modelDefs, err := fetchAllModelDefinitions(conn)
+	if err != nil {
+		return fmt.Errorf("failed to get models: %w", err)
+	}
+	var indexed []*model.ModelDefinition
+	for _, def := range modelDefs {
+		if len(args) > 0 && !strings.EqualFold(def.Name, args[0]) {
+			continue
+		}
+		if len(args) > 0 && len(def.Options.SearchFields) == 0 {
+			return fmt.Errorf("model %s has no search fields: set them with model update --search-fields", def.Name)
+		}
+		if len(def.Options.SearchFields) > 0 {
+			indexed = append(indexed, def)
+		}
+	}
+	if len(args) > 0 && len(indexed) == 0 {
+		return fmt.Errorf("model %s not found", args[0])
+	}
+
+	counts := make(map[string]int, len(indexed))
+	for _, def := range indexed {
+		count, err := search.Reindex(cmd.Context(), conn.GetDB(), backend, def, batchSize)
+		if err != nil {
+			return err
+		}
+		counts[def.Name] = count
+	}
+	return printResult(counts, func() {
+		if len(indexed) == 0 {
+			log.Info("No models have search fields")
+			return
+		}
+		for _, def := range indexed {
+			log.Infof("Indexed %d %s records in %s", counts[def.Name], def.Name, model.TableName(def))
+		}
+	})
+}
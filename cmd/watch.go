@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/enforcement"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/watch"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Regenerate code when model definitions change",
+	Long: `Watch the models file (--file) and the files or directories given with --watch, e.g. templates, and on
+every change:
+
+  - describe the schema changes from the previous definitions, with the CREATE TABLE statement of new models
+  - regenerate the Go code of the models whose definition changed, or of every model when another watched
+    file changed
+  - with --build, run "go build ./..." in the app, or in the current directory
+
+Code is generated as "model generate" does, to the app given with --app. Errors are logged and watching goes
+on, so a definition saved half-way is picked up once it is fixed. Stop watching with Ctrl+C.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runWatch,
+}
+
+func init() {
+	watchCmd.Flags().String("file", model.ModelsFile, "Models file to watch")
+	watchCmd.Flags().StringSlice("watch", []string{}, "Other files or directories to watch, e.g. templates")
+	watchCmd.Flags().String("app", "", "Name of the Grayv app to generate the models in")
+	watchCmd.Flags().Bool("build", false, "Build the app after generating code")
+	watchCmd.Flags().Duration("interval", 500*time.Millisecond, "How often to check the watched files")
+
+	RootCmd.AddCommand(watchCmd)
+}
+
+// modelWatcher regenerates the code of models as their definitions change, see watchCmd.
+type modelWatcher struct {
+	fsys      filesystem.FS
+	file      string
+	outputDir string
+	buildDir  string
+	build     bool
+	previous  []*model.ModelDefinition
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	extra, _ := cmd.Flags().GetStringSlice("watch")
+	appName, _ := cmd.Flags().GetString("app")
+	build, _ := cmd.Flags().GetBool("build")
+	interval, _ := cmd.Flags().GetDuration("interval")
+
+	w := &modelWatcher{fsys: filesystem.NewOSFS(""), file: file, build: build, buildDir: "."}
+	if appName != "" {
+		appDir, err := resolveAppDir(appName)
+		if err != nil {
+			return err
+		}
+		w.outputDir = path.Join(appDir, "internal", "models")
+		w.buildDir = appDir
+	}
+
+	// The first run brings the generated code up to date with the definitions as they are.
+	w.run(nil)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Infof("Watching %s for changes", strings.Join(append([]string{file}, extra...), ", "))
+	err := watch.Poll(ctx, w.fsys, append([]string{file}, extra...), interval, func(changed []string) error {
+		log.Infof("Changed: %s", strings.Join(changed, ", "))
+		w.run(changed)
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// run regenerates the code after the given files changed, or brings it up to date when changed is nil.
+func (w *modelWatcher) run(changed []string) {
+	defs, err := readModelsAtRef("", w.file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if err := enforcePolicies(enforcement.Generate, defs, nil); err != nil {
+		log.Error(err)
+		return
+	}
+	if changed != nil {
+		w.describeChanges(defs)
+	}
+	w.previous = defs
+
+	// Files other than the models file, such as templates, may change the code of every model.
+	force := false
+	for _, p := range changed {
+		if p != w.file {
+			force = true
+		}
+	}
+	if !w.generate(defs, force) || !w.build {
+		return
+	}
+
+	build := exec.Command("go", "build", "./...")
+	build.Dir = w.buildDir
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		log.WithError(err).Error("Build failed")
+		return
+	}
+	log.Info("Build succeeded")
+}
+
+// describeChanges logs the schema changes from the previous definitions, and the migration creating the
+// table of every new model.
+func (w *modelWatcher) describeChanges(defs []*model.ModelDefinition) {
+	byName := make(map[string]*model.ModelDefinition, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+	for _, entry := range model.NewChangelog(w.previous, defs) {
+		switch entry.Status {
+		case "added":
+			log.Infof("Model %s added, create its table with:", entry.Model)
+			fmt.Print((&model.ModelManager{}).GenerateMigration(byName[entry.Model]))
+		case "removed":
+			log.Warnf("Model %s removed: its generated files and table %s are kept", entry.Model, entry.Table)
+		default:
+			for _, change := range entry.Changes {
+				log.Infof("Model %s: %s", entry.Model, change)
+			}
+		}
+	}
+}
+
+// generate generates the code of the models whose definition or generated files changed, or of every model
+// with force, and reports whether it succeeded.
+func (w *modelWatcher) generate(defs []*model.ModelDefinition, force bool) bool {
+	manifest, err := loadManifest(w.fsys)
+	if err != nil {
+		log.WithError(err).Error("Failed to load generation manifest")
+		return false
+	}
+	defer saveManifest(w.fsys, manifest)
+
+	for _, def := range defs {
+		artifact := model.GoArtifact(def.Name, w.outputDir)
+		if !force && manifest.UpToDate(w.fsys, artifact, def) {
+			continue
+		}
+		if _, err := generateArtifact(w.fsys, manifest, artifact, def); err != nil {
+			log.WithError(err).Errorf("Failed to generate model file for %s", def.Name)
+			return false
+		}
+		log.Infof("Model %s generated successfully", def.Name)
+	}
+	return true
+}
@@ -0,0 +1,6 @@
+-- Up
+-- Model-level options (protobuf numbering, policies, relations, ...) stored alongside the fields
+ALTER TABLE models ADD COLUMN IF NOT EXISTS options JSONB NOT NULL DEFAULT '{}';
+
+-- Down
+ALTER TABLE models DROP COLUMN IF EXISTS options;
@@ -0,0 +1,14 @@
+-- Up
+-- Audit trail of personal data exports and erasures
+CREATE TABLE IF NOT EXISTS privacy_audit (
+    id SERIAL PRIMARY KEY,
+    action VARCHAR(50) NOT NULL,
+    model VARCHAR(50) NOT NULL,
+    subject_id BIGINT NOT NULL,
+    affected JSONB NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    performed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Down
+DROP TABLE IF EXISTS privacy_audit;
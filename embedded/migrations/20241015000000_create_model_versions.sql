@@ -0,0 +1,15 @@
+-- Up
+-- Every definition a model has had, so changes can be reviewed and rolled back
+CREATE TABLE IF NOT EXISTS model_versions (
+    id SERIAL PRIMARY KEY,
+    model_name VARCHAR(50) NOT NULL,
+    version INTEGER NOT NULL,
+    fields JSONB NOT NULL,
+    options JSONB NOT NULL DEFAULT '{}',
+    changes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (model_name, version)
+);
+
+-- Down
+DROP TABLE IF EXISTS model_versions;
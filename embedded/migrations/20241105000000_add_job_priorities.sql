@@ -0,0 +1,10 @@
+-- Up
+-- Priorities of jobs: workers claim the due jobs of a queue with the highest priority first
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+DROP INDEX IF EXISTS jobs_queue_status_run_at_idx;
+CREATE INDEX IF NOT EXISTS jobs_queue_status_priority_run_at_idx ON jobs (queue, status, priority DESC, run_at);
+
+-- Down
+DROP INDEX IF EXISTS jobs_queue_status_priority_run_at_idx;
+CREATE INDEX IF NOT EXISTS jobs_queue_status_run_at_idx ON jobs (queue, status, run_at);
+ALTER TABLE jobs DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,29 @@
+-- Up
+-- Notifications sent by apps with their internal/notifications package: every attempt to notify a recipient,
+-- for deliverability audits, and the recipients not to notify anymore
+CREATE TABLE IF NOT EXISTS notification_log (
+    id BIGSERIAL PRIMARY KEY,
+    channel VARCHAR(50) NOT NULL,
+    recipient VARCHAR(320) NOT NULL,
+    template VARCHAR(100) NOT NULL,
+    subject TEXT,
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS notification_log_recipient_idx ON notification_log (channel, recipient);
+CREATE INDEX IF NOT EXISTS notification_log_status_created_at_idx ON notification_log (status, created_at);
+
+CREATE TABLE IF NOT EXISTS notification_suppressions (
+    channel VARCHAR(50) NOT NULL,
+    recipient VARCHAR(320) NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel, recipient)
+);
+
+-- Down
+DROP TABLE IF EXISTS notification_suppressions;
+DROP TABLE IF EXISTS notification_log;
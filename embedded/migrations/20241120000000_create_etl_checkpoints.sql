@@ -0,0 +1,11 @@
+-- Up
+-- Progress of the ETL pipelines of apps, saved by their internal/etl package with every batch it loads
+CREATE TABLE IF NOT EXISTS etl_checkpoints (
+    pipeline VARCHAR(100) PRIMARY KEY,
+    last_cursor TEXT NOT NULL DEFAULT '',
+    records BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Down
+DROP TABLE IF EXISTS etl_checkpoints;
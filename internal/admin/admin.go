@@ -0,0 +1,547 @@
+// Package admin serves a small web UI to browse the models of a project and, given a Store, the rows of their
+// tables, a page at a time, with forms creating, editing and deleting rows. Given a JobStore, it also monitors
+// the queues of background jobs, and retries or cancels jobs.
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/metrics"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// PageSize is the number of rows listed per page.
+const PageSize = 25
+
+// Options configure a Server.
+type Options struct {
+	// Store reads and writes the rows of the tables; without one, only the model definitions are shown.
+	Store Store
+	// Jobs reads and operates the background jobs; without one, the jobs pages are not served.
+	Jobs JobStore
+	// ReadOnly hides the forms and refuses writes.
+	ReadOnly bool
+	// Metrics, if set, records the requests and the queries of the server, served on MetricsPath.
+	Metrics *metrics.Registry
+	// MetricsPath is the path of the metrics, DefaultMetricsPath if empty.
+	MetricsPath string
+	// MetricsBuckets are the buckets of the latency histograms, metrics.DefaultBuckets if empty.
+	MetricsBuckets []float64
+}
+
+// Server is the http.Handler of the admin UI.
+type Server struct {
+	models  []*model.ModelDefinition
+	byName  map[string]*model.ModelDefinition
+	options Options
+	mux     *http.ServeMux
+	// sensitive are the keys of the values redacted from job payloads, see sensitiveKeys.
+	sensitive map[string]bool
+	// handler is the mux, instrumented when Options.Metrics is set.
+	handler http.Handler
+}
+
+// NewServer creates the admin UI of the given models.
+func NewServer(defs []*model.ModelDefinition, options Options) *Server {
+	s := &Server{
+		models: defs, byName: make(map[string]*model.ModelDefinition, len(defs)), options: options, mux: http.NewServeMux(),
+		sensitive: sensitiveKeys(defs),
+	}
+	s.handler = s.mux
+	for _, def := range defs {
+		s.byName[def.Name] = def
+	}
+	s.mux.HandleFunc("GET /{$}", s.index)
+	s.mux.HandleFunc("GET /models/{model}", s.withModel(s.list))
+	s.mux.HandleFunc("GET /models/{model}/new", s.withModel(s.newForm))
+	s.mux.HandleFunc("POST /models/{model}", s.withModel(s.create))
+	s.mux.HandleFunc("GET /models/{model}/{id}", s.withRow(s.editForm))
+	s.mux.HandleFunc("POST /models/{model}/{id}", s.withRow(s.update))
+	s.mux.HandleFunc("POST /models/{model}/{id}/delete", s.withRow(s.delete))
+	if options.Jobs != nil {
+		s.mux.HandleFunc("GET /jobs", s.jobList)
+		s.mux.HandleFunc("POST /jobs/retry-failed", s.retryFailedJobs)
+		s.mux.HandleFunc("GET /jobs/{id}", withJob(s.jobDetail))
+		s.mux.HandleFunc("POST /jobs/{id}/retry", withJob(s.retryJob))
+		s.mux.HandleFunc("POST /jobs/{id}/cancel", withJob(s.cancelJob))
+	}
+	if options.Metrics != nil {
+		path := options.MetricsPath
+		if path == "" {
+			path = DefaultMetricsPath
+		}
+		s.mux.Handle("GET "+path, s.instrument())
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler. Forms are only accepted from the pages of the UI, see sameOrigin.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && !sameOrigin(r) {
+		http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		return
+	}
+	s.handler.ServeHTTP(w, r)
+}
+
+// sameOrigin reports whether a request comes from a page of the same host, as told by its Origin or Referer
+// header. Requests without either, such as those of scripts, are accepted.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host == r.Host
+}
+
+// EditableColumns returns the columns of a model's table the UI writes: the columns of its fields, except
+// encrypted ones, whose values are ciphertext.
+func EditableColumns(def *model.ModelDefinition) []model.StoredColumn {
+	var columns []model.StoredColumn
+	for _, column := range model.StoredColumns(def) {
+		if column.Field != nil && !column.Field.Encrypted {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// withModel resolves the model named in the path.
+func (s *Server) withModel(handler func(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		def, ok := s.byName[r.PathValue("model")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r, def)
+	}
+}
+
+// withRow resolves the model and the ID named in the path, for handlers of rows, which need a store.
+func (s *Server) withRow(handler func(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition, id int64)) http.HandlerFunc {
+	return s.withModel(func(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || s.options.Store == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r, def, id)
+	})
+}
+
+// writable refuses writes when the UI is read-only or has no store, and reports whether they are allowed.
+func (s *Server) writable(w http.ResponseWriter) bool {
+	if s.options.ReadOnly || s.options.Store == nil {
+		http.Error(w, "the admin UI is read-only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+type modelSummary struct {
+	Name   string
+	Table  string
+	Fields int
+}
+
+func (s *Server) index(w http.ResponseWriter, r *http.Request) {
+	summaries := make([]modelSummary, len(s.models))
+	for i, def := range s.models {
+		summaries[i] = modelSummary{Name: def.Name, Table: model.TableName(def), Fields: len(def.Fields)}
+	}
+	s.render(w, http.StatusOK, "index", map[string]interface{}{"Models": summaries, "Connected": s.options.Store != nil, "Jobs": s.options.Jobs != nil})
+}
+
+type fieldInfo struct {
+	Name       string
+	Column     string
+	Type       string
+	Nullable   bool
+	Indexed    bool
+	Encrypted  bool
+	References string
+}
+
+type listPage struct {
+	Name       string
+	Table      string
+	Fields     []fieldInfo
+	Connected  bool
+	ReadOnly   bool
+	Columns    []string
+	Rows       []Row
+	Total      int64
+	Page       int
+	Pages      int
+	Error      string
+	References map[string]bool
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition) {
+	data := listPage{Name: def.Name, Table: model.TableName(def), Connected: s.options.Store != nil, ReadOnly: s.options.ReadOnly, Page: 1}
+	for _, column := range model.StoredColumns(def) {
+		data.Columns = append(data.Columns, column.Name)
+		if f := column.Field; f != nil {
+			data.Fields = append(data.Fields, fieldInfo{
+				Name: f.Name, Column: column.Name, Type: f.Type, Nullable: f.IsNull || strings.HasPrefix(f.Type, "*"),
+				Indexed: f.Indexed, Encrypted: f.Encrypted, References: f.References,
+			})
+		}
+	}
+	if s.options.Store == nil {
+		s.render(w, http.StatusOK, "list", data)
+		return
+	}
+
+	if page, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && page > 1 {
+		data.Page = page
+	}
+	rows, total, err := s.options.Store.List(r.Context(), def, PageSize, (data.Page-1)*PageSize)
+	if err != nil {
+		data.Error = err.Error()
+		s.render(w, http.StatusInternalServerError, "list", data)
+		return
+	}
+	data.Rows, data.Total, data.Pages = rows, total, int((total+PageSize-1)/PageSize)
+	s.render(w, http.StatusOK, "list", data)
+}
+
+type formInput struct {
+	Column   string
+	Type     string
+	Value    string
+	Null     bool
+	Nullable bool
+	Options  []string
+}
+
+type formPage struct {
+	Name   string
+	ID     int64
+	Inputs []formInput
+	Error  string
+}
+
+// newFormPage returns the form of a row holding the given values.
+func newFormPage(def *model.ModelDefinition, id int64, row Row) formPage {
+	page := formPage{Name: def.Name, ID: id}
+	for _, column := range EditableColumns(def) {
+		value, set := row[column.Name]
+		options, _ := model.EnumValues(column.Field.Type)
+		page.Inputs = append(page.Inputs, formInput{
+			Column:   column.Name,
+			Type:     column.Field.Type,
+			Value:    value,
+			Null:     !set,
+			Nullable: column.Field.IsNull || strings.HasPrefix(column.Field.Type, "*"),
+			Options:  options,
+		})
+	}
+	return page
+}
+
+// formValues returns the values of the editable columns posted with a form. Values of nullable columns whose
+// null box is checked are nil.
+func formValues(def *model.ModelDefinition, r *http.Request) map[string]*string {
+	values := make(map[string]*string)
+	for _, column := range EditableColumns(def) {
+		if r.PostForm.Get("null."+column.Name) != "" {
+			values[column.Name] = nil
+			continue
+		}
+		if _, ok := r.PostForm[column.Name]; ok {
+			value := r.PostForm.Get(column.Name)
+			values[column.Name] = &value
+		}
+	}
+	return values
+}
+
+// rowOf returns the row holding the given values.
+func rowOf(values map[string]*string) Row {
+	row := make(Row, len(values))
+	for name, value := range values {
+		if value != nil {
+			row[name] = *value
+		}
+	}
+	return row
+}
+
+func (s *Server) newForm(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition) {
+	if !s.writable(w) {
+		return
+	}
+	row := Row{}
+	for _, column := range EditableColumns(def) {
+		row[column.Name] = column.Field.Default
+	}
+	s.render(w, http.StatusOK, "form", newFormPage(def, 0, row))
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition) {
+	if !s.writable(w) || !parseForm(w, r) {
+		return
+	}
+	values := formValues(def, r)
+	if _, err := s.options.Store.Create(r.Context(), def, values); err != nil {
+		page := newFormPage(def, 0, rowOf(values))
+		page.Error = err.Error()
+		s.render(w, http.StatusUnprocessableEntity, "form", page)
+		return
+	}
+	http.Redirect(w, r, "/models/"+url.PathEscape(def.Name), http.StatusSeeOther)
+}
+
+func (s *Server) editForm(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition, id int64) {
+	if !s.writable(w) {
+		return
+	}
+	row, err := s.options.Store.Get(r.Context(), def, id)
+	if s.failed(w, r, err) {
+		return
+	}
+	s.render(w, http.StatusOK, "form", newFormPage(def, id, row))
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition, id int64) {
+	if !s.writable(w) || !parseForm(w, r) {
+		return
+	}
+	values := formValues(def, r)
+	err := s.options.Store.Update(r.Context(), def, id, values)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		page := newFormPage(def, id, rowOf(values))
+		page.Error = err.Error()
+		s.render(w, http.StatusUnprocessableEntity, "form", page)
+		return
+	}
+	http.Redirect(w, r, "/models/"+url.PathEscape(def.Name), http.StatusSeeOther)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition, id int64) {
+	if !s.writable(w) {
+		return
+	}
+	if s.failed(w, r, s.options.Store.Delete(r.Context(), def, id)) {
+		return
+	}
+	http.Redirect(w, r, "/models/"+url.PathEscape(def.Name), http.StatusSeeOther)
+}
+
+// parseForm parses the posted form, or answers a bad request, and reports whether it succeeded.
+func parseForm(w http.ResponseWriter, r *http.Request) bool {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// failed answers the error of a store, not found for sql.ErrNoRows, and reports whether there was one.
+func (s *Server) failed(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, sql.ErrNoRows):
+		http.NotFound(w, r)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return true
+}
+
+var pages = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"value": func(row Row, column string) template.HTML {
+		value, ok := row[column]
+		if !ok {
+			return "<em>NULL</em>"
+		}
+		if len(value) > 80 {
+			value = value[:77] + "..."
+		}
+		return template.HTML(template.HTMLEscapeString(value))
+	},
+}).Parse(pageTemplates))
+
+// render renders the named page.
+func (s *Server) render(w http.ResponseWriter, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	pages.ExecuteTemplate(w, name, data)
+}
+
+// pageTemplates are the templates of the pages: "index", "list", "form", "jobs" and "job".
+const pageTemplates = `{{define "header"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.}} - grayv-lsm admin</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 80em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+form.inline { display: inline; }
+.error { color: #b00; }
+label { display: block; margin-top: 0.8em; font-weight: bold; }
+</style>
+</head>
+<body>
+<p><a href="/">Models</a></p>
+{{end}}
+
+{{- define "footer"}}</body>
+</html>
+{{end}}
+
+{{- define "index"}}{{template "header" "Models"}}
+<h1>Models</h1>
+{{- if not .Connected}}
+<p>Not connected to a database: only the model definitions are shown.</p>
+{{- end}}
+<table>
+<tr><th>Model</th><th>Table</th><th>Fields</th></tr>
+{{- range .Models}}
+<tr><td><a href="/models/{{.Name}}">{{.Name}}</a></td><td><code>{{.Table}}</code></td><td>{{.Fields}}</td></tr>
+{{- end}}
+</table>
+{{- if .Jobs}}
+<p><a href="/jobs">Background jobs</a></p>
+{{- end}}
+{{template "footer"}}{{end}}
+
+{{- define "list"}}{{template "header" .Name}}
+<h1>{{.Name}}</h1>
+<p>Table <code>{{.Table}}</code></p>
+<table>
+<tr><th>Field</th><th>Column</th><th>Type</th><th>Nullable</th><th>Indexed</th><th>References</th></tr>
+{{- range .Fields}}
+<tr><td>{{.Name}}</td><td><code>{{.Column}}</code></td><td><code>{{.Type}}</code>{{if .Encrypted}} (encrypted){{end}}</td><td>{{if .Nullable}}yes{{end}}</td><td>{{if .Indexed}}yes{{end}}</td><td>{{if .References}}<a href="/models/{{.References}}">{{.References}}</a>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- else if .Connected}}
+<h2>Rows ({{.Total}})</h2>
+{{- if not .ReadOnly}}
+<p><a href="/models/{{.Name}}/new">New {{.Name}}</a></p>
+{{- end}}
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}{{if not .ReadOnly}}<th></th>{{end}}</tr>
+{{- $page := .}}
+{{- range $row := .Rows}}
+<tr>{{range $page.Columns}}<td>{{value $row .}}</td>{{end}}
+{{- if not $page.ReadOnly}}<td><a href="/models/{{$page.Name}}/{{index $row "id"}}">Edit</a>
+<form class="inline" method="post" action="/models/{{$page.Name}}/{{index $row "id"}}/delete" onsubmit="return confirm('Delete this row?')"><button>Delete</button></form></td>{{end}}</tr>
+{{- end}}
+</table>
+<p>Page {{.Page}} of {{.Pages}}
+{{- if gt .Page 1}} <a href="?page={{add .Page -1}}">Previous</a>{{end}}
+{{- if lt .Page .Pages}} <a href="?page={{add .Page 1}}">Next</a>{{end}}</p>
+{{- end}}
+{{template "footer"}}{{end}}
+
+{{- define "form"}}{{template "header" .Name}}
+<h1>{{if .ID}}Edit {{.Name}} {{.ID}}{{else}}New {{.Name}}{{end}}</h1>
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- end}}
+<form method="post" action="/models/{{.Name}}{{if .ID}}/{{.ID}}{{end}}">
+{{- range .Inputs}}
+<label for="{{.Column}}">{{.Column}} <code>{{.Type}}</code></label>
+{{- if .Options}}
+<select id="{{.Column}}" name="{{.Column}}">{{$value := .Value}}{{range .Options}}<option{{if eq . $value}} selected{{end}}>{{.}}</option>{{end}}</select>
+{{- else}}
+<input id="{{.Column}}" name="{{.Column}}" value="{{.Value}}" size="60">
+{{- end}}
+{{- if .Nullable}} <input type="checkbox" name="null.{{.Column}}" value="1"{{if .Null}} checked{{end}}> NULL{{end}}
+{{- end}}
+<p><button>Save</button> <a href="/models/{{.Name}}">Cancel</a></p>
+</form>
+{{template "footer"}}{{end}}
+{{- define "jobs"}}{{template "header" "Jobs"}}
+<h1>Jobs</h1>
+{{- if .Message}}
+<p>{{.Message}}</p>
+{{- end}}
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- else}}
+<table>
+<tr><th>Queue</th><th>Pending</th><th>Running</th><th>Failed</th><th>Done</th><th>Cancelled</th>{{if not .ReadOnly}}<th></th>{{end}}</tr>
+{{- $page := .}}
+{{- range .Counts}}
+<tr><td><a href="/jobs?queue={{.Queue}}">{{.Queue}}</a></td><td>{{.Pending}}</td><td>{{.Running}}</td><td>{{if .Failed}}<a href="/jobs?queue={{.Queue}}&amp;status=failed">{{.Failed}}</a>{{else}}0{{end}}</td><td>{{.Done}}</td><td>{{.Cancelled}}</td>
+{{- if not $page.ReadOnly}}<td>{{if .Failed}}<form class="inline" method="post" action="/jobs/retry-failed"><input type="hidden" name="queue" value="{{.Queue}}"><button>Retry failed</button></form>{{end}}</td>{{end}}</tr>
+{{- end}}
+</table>
+<form method="get" action="/jobs">
+Queue <input name="queue" value="{{.Queue}}">
+Status <select name="status"><option value="">any</option>{{range .Statuses}}<option{{if eq . $page.Status}} selected{{end}}>{{.}}</option>{{end}}</select>
+<button>Filter</button>
+</form>
+<table>
+<tr><th>ID</th><th>Queue</th><th>Kind</th><th>Status</th><th>Priority</th><th>Attempts</th><th>Run at</th><th>Last error</th>{{if not .ReadOnly}}<th></th>{{end}}</tr>
+{{- range .Jobs}}
+<tr><td><a href="/jobs/{{.ID}}">{{.ID}}</a></td><td>{{.Queue}}</td><td>{{.Kind}}</td><td>{{.Status}}</td><td>{{.Priority}}</td><td>{{.Attempts}}/{{.MaxAttempts}}</td><td>{{.RunAt.Format "2006-01-02 15:04:05"}}</td><td>{{.LastError}}</td>
+{{- if not $page.ReadOnly}}<td>{{template "job-actions" .}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- end}}
+{{template "footer"}}{{end}}
+
+{{- define "job-actions"}}
+{{- if or (eq .Status "failed") (eq .Status "cancelled")}}<form class="inline" method="post" action="/jobs/{{.ID}}/retry"><button>Retry</button></form>{{end}}
+{{- if or (eq .Status "pending") (eq .Status "running")}}<form class="inline" method="post" action="/jobs/{{.ID}}/cancel" onsubmit="return confirm('Cancel this job?')"><button>Cancel</button></form>{{end}}
+{{- end}}
+
+{{- define "job"}}{{template "header" "Job"}}
+<p><a href="/jobs?queue={{.Job.Queue}}">Jobs of {{.Job.Queue}}</a></p>
+<h1>Job {{.Job.ID}}</h1>
+<table>
+<tr><th>Queue</th><td>{{.Job.Queue}}</td></tr>
+<tr><th>Kind</th><td>{{.Job.Kind}}</td></tr>
+<tr><th>Status</th><td>{{.Job.Status}}</td></tr>
+<tr><th>Priority</th><td>{{.Job.Priority}}</td></tr>
+<tr><th>Attempts</th><td>{{.Job.Attempts}}/{{.Job.MaxAttempts}}</td></tr>
+<tr><th>Run at</th><td>{{.Job.RunAt.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+<tr><th>Created at</th><td>{{.Job.CreatedAt.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{- if .Job.FinishedAt}}
+<tr><th>Finished at</th><td>{{.Job.FinishedAt.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{- end}}
+{{- if .Job.LockedBy}}
+<tr><th>Locked by</th><td>{{.Job.LockedBy}}</td></tr>
+{{- end}}
+</table>
+{{- if .Job.LastError}}
+<h2>Last error</h2>
+<pre class="error">{{.Job.LastError}}</pre>
+{{- end}}
+<h2>Payload</h2>
+<pre>{{.Payload}}</pre>
+{{- if .Checkpoint}}
+<h2>Checkpoint</h2>
+<pre>{{.Checkpoint}}</pre>
+{{- end}}
+{{- if not .ReadOnly}}
+<p>{{template "job-actions" .Job}}</p>
+{{- end}}
+{{template "footer"}}{{end}}
+`
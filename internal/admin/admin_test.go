@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/metrics"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// memoryStore is a Store keeping the rows of every model in memory.
+type memoryStore struct {
+	rows   map[string]map[int64]Row
+	nextID int64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{rows: make(map[string]map[int64]Row)}
+}
+
+func (s *memoryStore) List(ctx context.Context, def *model.ModelDefinition, limit, offset int) ([]Row, int64, error) {
+	var rows []Row
+	for id := int64(1); id <= s.nextID; id++ {
+		if row, ok := s.rows[def.Name][id]; ok {
+			rows = append(rows, row)
+		}
+	}
+	total := int64(len(rows))
+	if offset > len(rows) {
+		offset = len(rows)
+	}
+	rows = rows[offset:]
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows, total, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, def *model.ModelDefinition, id int64) (Row, error) {
+	row, ok := s.rows[def.Name][id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (s *memoryStore) Create(ctx context.Context, def *model.ModelDefinition, values map[string]*string) (int64, error) {
+	s.nextID++
+	if s.rows[def.Name] == nil {
+		s.rows[def.Name] = make(map[int64]Row)
+	}
+	row := rowOf(values)
+	row["id"] = strconv.FormatInt(s.nextID, 10)
+	s.rows[def.Name][s.nextID] = row
+	return s.nextID, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, def *model.ModelDefinition, id int64, values map[string]*string) error {
+	row, ok := s.rows[def.Name][id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	for name, value := range values {
+		if value == nil {
+			delete(row, name)
+		} else {
+			row[name] = *value
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, def *model.ModelDefinition, id int64) error {
+	if _, ok := s.rows[def.Name][id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.rows[def.Name], id)
+	return nil
+}
+
+func testModels() []*model.ModelDefinition {
+	secret := model.NewField("token", "string", "", false, false)
+	secret.Encrypted = true
+	return []*model.ModelDefinition{model.NewModelDefinition("Post", []model.Field{
+		model.NewField("title", "string", "", false, false),
+		model.NewField("subtitle", "string", "", true, false),
+		secret,
+	})}
+}
+
+func serve(handler http.Handler, method, target string, form url.Values, header map[string]string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if form != nil {
+		r = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestEditableColumns(t *testing.T) {
+	var names []string
+	for _, column := range EditableColumns(testModels()[0]) {
+		names = append(names, column.Name)
+	}
+	assert.Equal(t, []string{"title", "subtitle"}, names)
+}
+
+func TestServer_DefinitionsOnly(t *testing.T) {
+	s := NewServer(testModels(), Options{})
+
+	w := serve(s, "GET", "/", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<a href="/models/Post">Post</a>`)
+	assert.Contains(t, w.Body.String(), "Not connected to a database")
+
+	w = serve(s, "GET", "/models/Post", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<code>subtitle</code>")
+	assert.NotContains(t, w.Body.String(), "Rows")
+
+	assert.Equal(t, http.StatusNotFound, serve(s, "GET", "/models/Comment", nil, nil).Code)
+	assert.Equal(t, http.StatusForbidden, serve(s, "POST", "/models/Post", url.Values{"title": {"x"}}, nil).Code)
+}
+
+func TestServer_Rows(t *testing.T) {
+	store := newMemoryStore()
+	s := NewServer(testModels(), Options{Store: store})
+
+	w := serve(s, "GET", "/models/Post/new", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `name="null.subtitle"`)
+	assert.NotContains(t, w.Body.String(), `name="token"`)
+
+	w = serve(s, "POST", "/models/Post", url.Values{"title": {"Hello"}, "subtitle": {""}, "null.subtitle": {"1"}, "token": {"x"}}, nil)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/models/Post", w.Header().Get("Location"))
+	assert.Equal(t, Row{"id": "1", "title": "Hello"}, store.rows["Post"][1])
+
+	w = serve(s, "POST", "/models/Post/1", url.Values{"title": {"Hi <b>"}, "subtitle": {"Sub"}}, nil)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, Row{"id": "1", "title": "Hi <b>", "subtitle": "Sub"}, store.rows["Post"][1])
+
+	w = serve(s, "GET", "/models/Post", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Rows (1)")
+	assert.Contains(t, w.Body.String(), "<td>Hi &lt;b&gt;</td>")
+	assert.Contains(t, w.Body.String(), "<em>NULL</em>")
+
+	w = serve(s, "GET", "/models/Post/1", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `value="Sub"`)
+
+	assert.Equal(t, http.StatusNotFound, serve(s, "GET", "/models/Post/2", nil, nil).Code)
+	assert.Equal(t, http.StatusForbidden, serve(s, "POST", "/models/Post/1/delete", nil, map[string]string{"Origin": "http://evil.example"}).Code)
+	assert.Equal(t, http.StatusSeeOther, serve(s, "POST", "/models/Post/1/delete", nil, map[string]string{"Origin": "http://example.com"}).Code)
+	assert.Empty(t, store.rows["Post"])
+	assert.Equal(t, http.StatusNotFound, serve(s, "POST", "/models/Post/1/delete", nil, nil).Code)
+}
+
+func TestServer_Pages(t *testing.T) {
+	store := newMemoryStore()
+	def := testModels()[0]
+	for i := 0; i < PageSize+5; i++ {
+		title := "post " + strconv.Itoa(i)
+		store.Create(context.Background(), def, map[string]*string{"title": &title})
+	}
+	s := NewServer([]*model.ModelDefinition{def}, Options{Store: store, ReadOnly: true})
+
+	w := serve(s, "GET", "/models/Post?page=2", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Page 2 of 2")
+	assert.Contains(t, w.Body.String(), "<td>post 29</td>")
+	assert.NotContains(t, w.Body.String(), "<td>post 0</td>")
+	assert.NotContains(t, w.Body.String(), "Edit")
+	assert.Equal(t, http.StatusForbidden, serve(s, "GET", "/models/Post/new", nil, nil).Code)
+}
+
+func TestServer_Metrics(t *testing.T) {
+	s := NewServer(testModels(), Options{Store: newMemoryStore(), Metrics: metrics.NewRegistry(), MetricsPath: "/internal/metrics"})
+	serve(s, "POST", "/models/Post", url.Values{"title": {"Hello"}}, nil)
+	serve(s, "GET", "/models/Post/1", nil, nil)
+	serve(s, "GET", "/models/Post/2", nil, nil)
+
+	w := serve(s, "GET", "/internal/metrics", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `http_requests_total{method="GET",route="GET /models/{model}/{id}",code="200"} 1`)
+	assert.Contains(t, w.Body.String(), `http_requests_total{method="GET",route="GET /models/{model}/{id}",code="404"} 1`)
+	assert.Contains(t, w.Body.String(), `http_requests_total{method="POST",route="POST /models/{model}",code="303"} 1`)
+	assert.Contains(t, w.Body.String(), `db_query_duration_seconds_count{table="posts",operation="get"} 2`)
+	assert.Contains(t, w.Body.String(), `db_query_errors_total{table="posts",operation="get"} 1`)
+	assert.Equal(t, http.StatusNotFound, serve(NewServer(testModels(), Options{}), "GET", "/metrics", nil, nil).Code)
+}
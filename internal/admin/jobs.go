@@ -0,0 +1,248 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/jobs"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// JobStore reads and operates the background jobs of the jobs table, see the jobs package.
+type JobStore interface {
+	// Counts returns the numbers of jobs of every queue by status.
+	Counts(ctx context.Context) ([]jobs.QueueCounts, error)
+	// List returns the jobs selected by filter, the most recent first.
+	List(ctx context.Context, filter jobs.Filter) ([]jobs.Job, error)
+	// Get returns the job of the given ID, with its payload, or sql.ErrNoRows.
+	Get(ctx context.Context, id int64) (*jobs.Job, error)
+	// Retry makes the failed or cancelled jobs among ids run again, and returns how many it retried.
+	Retry(ctx context.Context, ids []int64) (int64, error)
+	// RetryFailed makes the failed jobs of a queue, or of all queues when empty, run again.
+	RetryFailed(ctx context.Context, queue string) (int64, error)
+	// Cancel cancels the pending or running jobs among ids, and returns how many it cancelled.
+	Cancel(ctx context.Context, ids []int64) (int64, error)
+}
+
+// DBJobStore is a JobStore of the jobs table of a Postgres database.
+type DBJobStore struct {
+	db *sql.DB
+}
+
+// NewDBJobStore creates a job store of the jobs table of db.
+func NewDBJobStore(db *sql.DB) *DBJobStore {
+	return &DBJobStore{db: db}
+}
+
+// Counts implements JobStore.
+func (s *DBJobStore) Counts(ctx context.Context) ([]jobs.QueueCounts, error) {
+	return jobs.Counts(ctx, s.db)
+}
+
+// List implements JobStore.
+func (s *DBJobStore) List(ctx context.Context, filter jobs.Filter) ([]jobs.Job, error) {
+	return jobs.List(ctx, s.db, filter)
+}
+
+// Get implements JobStore.
+func (s *DBJobStore) Get(ctx context.Context, id int64) (*jobs.Job, error) {
+	return jobs.Get(ctx, s.db, id)
+}
+
+// Retry implements JobStore.
+func (s *DBJobStore) Retry(ctx context.Context, ids []int64) (int64, error) {
+	return jobs.Retry(ctx, s.db, ids)
+}
+
+// RetryFailed implements JobStore.
+func (s *DBJobStore) RetryFailed(ctx context.Context, queue string) (int64, error) {
+	return jobs.RetryFailed(ctx, s.db, queue)
+}
+
+// Cancel implements JobStore.
+func (s *DBJobStore) Cancel(ctx context.Context, ids []int64) (int64, error) {
+	return jobs.Cancel(ctx, s.db, ids)
+}
+
+// secretKeys are the keys of payload values redacted whatever the models, compared without case, underscores
+// and dashes.
+var secretKeys = []string{"password", "passwordhash", "secret", "token", "accesstoken", "refreshtoken", "apikey", "authorization", "creditcard", "ssn"}
+
+// sensitiveKeys returns the keys of the payload values redacted by the job pages: secretKeys, and the names and
+// columns of the sensitive and encrypted fields of the models.
+func sensitiveKeys(defs []*model.ModelDefinition) map[string]bool {
+	keys := make(map[string]bool)
+	for _, key := range secretKeys {
+		keys[key] = true
+	}
+	for _, def := range defs {
+		for i := range def.Fields {
+			if field := &def.Fields[i]; field.Sensitive || field.Encrypted {
+				keys[normalizeKey(field.Name)] = true
+				keys[normalizeKey(model.ColumnName(field))] = true
+			}
+		}
+	}
+	return keys
+}
+
+func normalizeKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+// Redacted replaces the values of sensitive keys in a payload.
+const Redacted = "****"
+
+// redactPayload returns a JSON document indented, with the values of the given keys, at any depth, replaced by
+// Redacted. Documents that are not valid JSON are not shown.
+func redactPayload(data json.RawMessage, keys map[string]bool) string {
+	if len(data) == 0 {
+		return ""
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "(invalid JSON)"
+	}
+	out, err := json.MarshalIndent(redact(value, keys), "", "  ")
+	if err != nil {
+		return "(invalid JSON)"
+	}
+	return string(out)
+}
+
+func redact(value interface{}, keys map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if keys[normalizeKey(key)] {
+				v[key] = Redacted
+			} else {
+				v[key] = redact(item, keys)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item, keys)
+		}
+	}
+	return value
+}
+
+type jobsPage struct {
+	Counts   []jobs.QueueCounts
+	Jobs     []jobs.Job
+	Queue    string
+	Status   string
+	Statuses []string
+	ReadOnly bool
+	Message  string
+	Error    string
+}
+
+func (s *Server) jobList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data := jobsPage{Queue: query.Get("queue"), Status: query.Get("status"), Statuses: jobs.Statuses, ReadOnly: s.options.ReadOnly, Message: query.Get("message")}
+	status := http.StatusOK
+	counts, err := s.options.Jobs.Counts(r.Context())
+	if err == nil {
+		data.Counts = counts
+		data.Jobs, err = s.options.Jobs.List(r.Context(), jobs.Filter{Queue: data.Queue, Status: data.Status, Limit: PageSize * 2})
+	}
+	if err != nil {
+		data.Error, status = err.Error(), http.StatusInternalServerError
+	}
+	s.render(w, status, "jobs", data)
+}
+
+type jobPage struct {
+	Job        *jobs.Job
+	Payload    string
+	Checkpoint string
+	ReadOnly   bool
+}
+
+func (s *Server) jobDetail(w http.ResponseWriter, r *http.Request, id int64) {
+	job, err := s.options.Jobs.Get(r.Context(), id)
+	if s.failed(w, r, err) {
+		return
+	}
+	s.render(w, http.StatusOK, "job", jobPage{
+		Job:        job,
+		Payload:    redactPayload(job.Payload, s.sensitive),
+		Checkpoint: redactPayload(job.Checkpoint, s.sensitive),
+		ReadOnly:   s.options.ReadOnly,
+	})
+}
+
+func (s *Server) retryJob(w http.ResponseWriter, r *http.Request, id int64) {
+	s.operateJob(w, r, id, "retried", s.options.Jobs.Retry)
+}
+
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request, id int64) {
+	s.operateJob(w, r, id, "cancelled", s.options.Jobs.Cancel)
+}
+
+// operateJob retries or cancels a job, and redirects to the jobs page telling whether it did.
+func (s *Server) operateJob(w http.ResponseWriter, r *http.Request, id int64, done string, operate func(context.Context, []int64) (int64, error)) {
+	if !s.jobsWritable(w) {
+		return
+	}
+	n, err := operate(r.Context(), []int64{id})
+	if s.failed(w, r, err) {
+		return
+	}
+	message := "Job " + strconv.FormatInt(id, 10) + " " + done
+	if n == 0 {
+		message = "Job " + strconv.FormatInt(id, 10) + " was not " + done + ": its status does not allow it"
+	}
+	redirectJobs(w, r, "", message)
+}
+
+func (s *Server) retryFailedJobs(w http.ResponseWriter, r *http.Request) {
+	if !s.jobsWritable(w) || !parseForm(w, r) {
+		return
+	}
+	queue := r.PostForm.Get("queue")
+	n, err := s.options.Jobs.RetryFailed(r.Context(), queue)
+	if s.failed(w, r, err) {
+		return
+	}
+	redirectJobs(w, r, queue, strconv.FormatInt(n, 10)+" failed job(s) retried")
+}
+
+// jobsWritable refuses to operate jobs when the UI is read-only, and reports whether it may.
+func (s *Server) jobsWritable(w http.ResponseWriter) bool {
+	if s.options.ReadOnly {
+		http.Error(w, "the admin UI is read-only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func redirectJobs(w http.ResponseWriter, r *http.Request, queue, message string) {
+	query := url.Values{"message": {message}}
+	if queue != "" {
+		query.Set("queue", queue)
+	}
+	http.Redirect(w, r, "/jobs?"+query.Encode(), http.StatusSeeOther)
+}
+
+// withJob resolves the job ID named in the path.
+func withJob(handler func(w http.ResponseWriter, r *http.Request, id int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r, id)
+	}
+}
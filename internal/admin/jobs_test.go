@@ -0,0 +1,134 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/jobs"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// memoryJobStore is a JobStore keeping jobs in memory.
+type memoryJobStore struct {
+	jobs []*jobs.Job
+}
+
+func (s *memoryJobStore) Counts(ctx context.Context) ([]jobs.QueueCounts, error) {
+	counts := jobs.QueueCounts{Queue: "default"}
+	for _, j := range s.jobs {
+		switch j.Status {
+		case "pending":
+			counts.Pending++
+		case "failed":
+			counts.Failed++
+		}
+	}
+	return []jobs.QueueCounts{counts}, nil
+}
+
+func (s *memoryJobStore) List(ctx context.Context, filter jobs.Filter) ([]jobs.Job, error) {
+	var list []jobs.Job
+	for _, j := range s.jobs {
+		if filter.Status == "" || j.Status == filter.Status {
+			list = append(list, *j)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryJobStore) Get(ctx context.Context, id int64) (*jobs.Job, error) {
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return j, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *memoryJobStore) set(ids []int64, from []string, to string) int64 {
+	var n int64
+	for _, j := range s.jobs {
+		for _, id := range ids {
+			if j.ID == id && (j.Status == from[0] || j.Status == from[1]) {
+				j.Status = to
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (s *memoryJobStore) Retry(ctx context.Context, ids []int64) (int64, error) {
+	return s.set(ids, []string{"failed", "cancelled"}, "pending"), nil
+}
+
+func (s *memoryJobStore) RetryFailed(ctx context.Context, queue string) (int64, error) {
+	var ids []int64
+	for _, j := range s.jobs {
+		ids = append(ids, j.ID)
+	}
+	return s.set(ids, []string{"failed", "failed"}, "pending"), nil
+}
+
+func (s *memoryJobStore) Cancel(ctx context.Context, ids []int64) (int64, error) {
+	return s.set(ids, []string{"pending", "running"}, "cancelled"), nil
+}
+
+func TestRedactPayload(t *testing.T) {
+	keys := sensitiveKeys(append(testModels(), model.NewUserModel("User")))
+	payload := redactPayload(json.RawMessage(`{"to": "ann@example.com", "Subject": "Hi", "user": {"api_key": "k", "id": 12345678901234567890}, "tokens": [{"Token": "t"}]}`), keys)
+	assert.JSONEq(t, `{"to": "ann@example.com", "Subject": "Hi", "user": {"api_key": "****", "id": 12345678901234567890}, "tokens": [{"Token": "****"}]}`, payload)
+	assert.Contains(t, payload, "12345678901234567890")
+	assert.JSONEq(t, `{"email": "****", "password": "****"}`, redactPayload(json.RawMessage(`{"email": "ann@example.com", "password": "x"}`), keys))
+	assert.Equal(t, "", redactPayload(nil, keys))
+	assert.Equal(t, "(invalid JSON)", redactPayload(json.RawMessage(`{`), keys))
+}
+
+func TestServer_Jobs(t *testing.T) {
+	store := &memoryJobStore{jobs: []*jobs.Job{
+		{ID: 1, Queue: "default", Kind: "send_email", Status: "failed", Attempts: 5, MaxAttempts: 5, RunAt: time.Now(),
+			LastError: "smtp: connection refused", Payload: json.RawMessage(`{"to": "ann@example.com", "password": "hunter2"}`)},
+		{ID: 2, Queue: "default", Kind: "send_email", Status: "pending", MaxAttempts: 5, RunAt: time.Now(), Payload: json.RawMessage(`{}`)},
+	}}
+	s := NewServer(testModels(), Options{Store: newMemoryStore(), Jobs: store})
+
+	w := serve(s, "GET", "/", nil, nil)
+	assert.Contains(t, w.Body.String(), `<a href="/jobs">Background jobs</a>`)
+
+	w = serve(s, "GET", "/jobs", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<td>1</td><td>0</td><td><a href="/jobs?queue=default&amp;status=failed">1</a></td>`)
+	assert.Contains(t, w.Body.String(), `action="/jobs/1/retry"`)
+	assert.Contains(t, w.Body.String(), `action="/jobs/2/cancel"`)
+
+	w = serve(s, "GET", "/jobs/1", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "smtp: connection refused")
+	assert.Contains(t, w.Body.String(), "ann@example.com")
+	assert.NotContains(t, w.Body.String(), "hunter2")
+	assert.Equal(t, http.StatusNotFound, serve(s, "GET", "/jobs/3", nil, nil).Code)
+
+	w = serve(s, "POST", "/jobs/1/retry", url.Values{}, nil)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "pending", store.jobs[0].Status)
+	w = serve(s, "POST", "/jobs/1/retry", url.Values{}, nil)
+	assert.Contains(t, w.Header().Get("Location"), "was+not+retried")
+
+	assert.Equal(t, http.StatusSeeOther, serve(s, "POST", "/jobs/2/cancel", url.Values{}, nil).Code)
+	assert.Equal(t, "cancelled", store.jobs[1].Status)
+	store.jobs[0].Status = "failed"
+	w = serve(s, "POST", "/jobs/retry-failed", url.Values{"queue": {"default"}}, nil)
+	assert.Equal(t, "/jobs?message=1+failed+job%28s%29+retried&queue=default", w.Header().Get("Location"))
+
+	readOnly := NewServer(testModels(), Options{Jobs: store, ReadOnly: true})
+	assert.NotContains(t, serve(readOnly, "GET", "/jobs", nil, nil).Body.String(), "<button>Retry")
+	assert.Equal(t, http.StatusForbidden, serve(readOnly, "POST", "/jobs/2/retry", url.Values{}, nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(NewServer(testModels(), Options{}), "GET", "/jobs", nil, nil).Code)
+}
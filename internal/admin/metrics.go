@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/metrics"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// DefaultMetricsPath is the path the metrics are served on when Options.MetricsPath is empty.
+const DefaultMetricsPath = "/metrics"
+
+// instrument registers the metrics of the server on options.Metrics: its requests, by route, and the queries
+// of its store, by table and operation. It returns the handler serving the metrics.
+func (s *Server) instrument() http.Handler {
+	s.handler = metrics.NewHTTPMetrics(s.options.Metrics, s.options.MetricsBuckets).Instrument(s.mux, s.route)
+	if s.options.Store != nil {
+		s.options.Store = &metricsStore{
+			store:    s.options.Store,
+			duration: s.options.Metrics.Histogram("db_query_duration_seconds", "Duration of the queries of the admin UI.", s.options.MetricsBuckets, "table", "operation"),
+			errors:   s.options.Metrics.Counter("db_query_errors_total", "Queries of the admin UI that failed.", "table", "operation"),
+		}
+	}
+	return s.options.Metrics.Handler()
+}
+
+// route returns the pattern of the route of a request, "" if none matches.
+func (s *Server) route(r *http.Request) string {
+	_, pattern := s.mux.Handler(r)
+	return pattern
+}
+
+// metricsStore is a Store recording the duration of the operations of another.
+type metricsStore struct {
+	store    Store
+	duration *metrics.Histogram
+	errors   *metrics.Counter
+}
+
+func (s *metricsStore) observe(def *model.ModelDefinition, operation string, start time.Time, err error) {
+	table := model.TableName(def)
+	s.duration.ObserveDuration(time.Since(start), table, operation)
+	if err != nil {
+		s.errors.Inc(table, operation)
+	}
+}
+
+func (s *metricsStore) List(ctx context.Context, def *model.ModelDefinition, limit, offset int) ([]Row, int64, error) {
+	start := time.Now()
+	rows, total, err := s.store.List(ctx, def, limit, offset)
+	s.observe(def, "list", start, err)
+	return rows, total, err
+}
+
+func (s *metricsStore) Get(ctx context.Context, def *model.ModelDefinition, id int64) (Row, error) {
+	start := time.Now()
+	row, err := s.store.Get(ctx, def, id)
+	s.observe(def, "get", start, err)
+	return row, err
+}
+
+func (s *metricsStore) Create(ctx context.Context, def *model.ModelDefinition, values map[string]*string) (int64, error) {
+	start := time.Now()
+	id, err := s.store.Create(ctx, def, values)
+	s.observe(def, "create", start, err)
+	return id, err
+}
+
+func (s *metricsStore) Update(ctx context.Context, def *model.ModelDefinition, id int64, values map[string]*string) error {
+	start := time.Now()
+	err := s.store.Update(ctx, def, id, values)
+	s.observe(def, "update", start, err)
+	return err
+}
+
+func (s *metricsStore) Delete(ctx context.Context, def *model.ModelDefinition, id int64) error {
+	start := time.Now()
+	err := s.store.Delete(ctx, def, id)
+	s.observe(def, "delete", start, err)
+	return err
+}
@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// Row is a row of a model's table, with the text of the value of every column, by column name. NULL values are
+// missing.
+type Row map[string]string
+
+// Store reads and writes the rows of the tables of models.
+type Store interface {
+	// List returns the rows of a page of the table, ordered by ID, and the number of rows of the table.
+	List(ctx context.Context, def *model.ModelDefinition, limit, offset int) ([]Row, int64, error)
+	// Get returns the row of the given ID, or sql.ErrNoRows.
+	Get(ctx context.Context, def *model.ModelDefinition, id int64) (Row, error)
+	// Create inserts a row with the given values, by column name, and returns its ID.
+	Create(ctx context.Context, def *model.ModelDefinition, values map[string]*string) (int64, error)
+	// Update writes the given values, by column name, to the row of the given ID, or returns sql.ErrNoRows.
+	Update(ctx context.Context, def *model.ModelDefinition, id int64, values map[string]*string) error
+	// Delete deletes the row of the given ID, or returns sql.ErrNoRows.
+	Delete(ctx context.Context, def *model.ModelDefinition, id int64) error
+}
+
+// DBStore is a Store reading and writing a Postgres database. Values are read as text, and written as text
+// parameters the database converts to the type of their column.
+type DBStore struct {
+	db *sql.DB
+}
+
+// NewDBStore creates a store reading and writing db.
+func NewDBStore(db *sql.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// selectColumns returns the columns of a model's table cast to text, for a SELECT.
+func selectColumns(def *model.ModelDefinition) string {
+	columns := model.StoredColumns(def)
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = pq.QuoteIdentifier(column.Name) + "::text"
+	}
+	return strings.Join(names, ", ")
+}
+
+// List implements Store.
+func (s *DBStore) List(ctx context.Context, def *model.ModelDefinition, limit, offset int) ([]Row, int64, error) {
+	table := pq.QuoteIdentifier(model.TableName(def))
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT count(*) FROM "+table).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY id LIMIT $1 OFFSET $2", selectColumns(def), table), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var result []Row
+	for rows.Next() {
+		row, err := scanRow(def, rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, row)
+	}
+	return result, total, rows.Err()
+}
+
+// Get implements Store.
+func (s *DBStore) Get(ctx context.Context, def *model.ModelDefinition, id int64) (Row, error) {
+	return scanRow(def, s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE id = $1",
+		selectColumns(def), pq.QuoteIdentifier(model.TableName(def))), id))
+}
+
+// scanRow scans a row selected with selectColumns.
+func scanRow(def *model.ModelDefinition, scanner interface{ Scan(...interface{}) error }) (Row, error) {
+	columns := model.StoredColumns(def)
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := scanner.Scan(dest...); err != nil {
+		return nil, err
+	}
+	row := make(Row, len(columns))
+	for i, column := range columns {
+		if values[i].Valid {
+			row[column.Name] = values[i].String
+		}
+	}
+	return row, nil
+}
+
+// Create implements Store. The timestamps of the row are set to the current time.
+func (s *DBStore) Create(ctx context.Context, def *model.ModelDefinition, values map[string]*string) (int64, error) {
+	names := []string{"created_at", "updated_at"}
+	placeholders := []string{"now()", "now()"}
+	var args []interface{}
+	for _, column := range EditableColumns(def) {
+		value, ok := values[column.Name]
+		if !ok {
+			continue
+		}
+		args = append(args, nullString(value))
+		names = append(names, pq.QuoteIdentifier(column.Name))
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	var id int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING id",
+		pq.QuoteIdentifier(model.TableName(def)), strings.Join(names, ", "), strings.Join(placeholders, ", ")), args...).Scan(&id)
+	return id, err
+}
+
+// Update implements Store. The update time of the row is set to the current time.
+func (s *DBStore) Update(ctx context.Context, def *model.ModelDefinition, id int64, values map[string]*string) error {
+	assignments := []string{"updated_at = now()"}
+	args := []interface{}{id}
+	for _, column := range EditableColumns(def) {
+		value, ok := values[column.Name]
+		if !ok {
+			continue
+		}
+		args = append(args, nullString(value))
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(column.Name), len(args)))
+	}
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE id = $1",
+		pq.QuoteIdentifier(model.TableName(def)), strings.Join(assignments, ", ")), args...)
+	return requireRow(result, err)
+}
+
+// Delete implements Store.
+func (s *DBStore) Delete(ctx context.Context, def *model.ModelDefinition, id int64) error {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = $1", pq.QuoteIdentifier(model.TableName(def))), id)
+	return requireRow(result, err)
+}
+
+// requireRow returns sql.ErrNoRows if a statement affected no row.
+func requireRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// nullString returns the argument writing value, NULL for nil.
+func nullString(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
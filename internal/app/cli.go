@@ -0,0 +1,345 @@
+package app
+
+// cobraVersion is the version of cobra the command line of new apps requires, the one grayv-lsm is built with.
+const cobraVersion = "v1.8.1"
+
+// cryptoVersion is the version of golang.org/x/crypto new apps require, whose bcrypt package hashes the passwords
+// of the authentication "auth generate" adds to them; the one grayv-lsm is built with.
+const cryptoVersion = "v0.26.0"
+
+// libraryModule is the module path of grayv-lsm, whose pkg/appdb the command line of new apps migrates and
+// seeds their database with.
+const libraryModule = "github.com/ooyeku/grayv-lsm"
+
+// goModTemplate is the go.mod of a new app. Without a library version, the requirements of the command line
+// are left to "go mod tidy".
+const goModTemplate = `module {{.Module}}
+
+go 1.22
+{{- if .LibraryVersion}}
+
+require (
+	` + libraryModule + ` {{.LibraryVersion}}
+	github.com/spf13/cobra ` + cobraVersion + `
+	golang.org/x/crypto ` + cryptoVersion + `
+)
+{{- end}}
+{{- if .LibraryDir}}
+
+replace ` + libraryModule + ` => {{.LibraryDir}}
+{{- end}}
+`
+
+// mainTemplate is the cmd/main.go of a new app, running its command line.
+const mainTemplate = `package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"{{.Module}}/internal/cli"
+)
+
+func main() {
+	// SIGINT and SIGTERM cancel the context of the commands, stopping migrations and seeds in flight.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := cli.New().ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+`
+
+// filesTemplate is the package at the root of a new app, embedding its migrations and seeds into its binary.
+const filesTemplate = `// Package {{.Name}} embeds the migrations and seed files of {{.Name}} into its binary, see internal/cli.
+package {{.Name}}
+
+import "embed"
+
+// Files holds the migrations/ and seeds/ directories.
+//
+//go:embed all:migrations all:seeds
+var Files embed.FS
+`
+
+// cliTemplate is the internal/cli package of a new app: a cobra command line serving the app and managing its
+// database with pkg/appdb, so that the app's binary is all a production container needs.
+const cliTemplate = `// Package cli is the command line of {{.Name}}. Its binary serves the app, migrates and seeds its database with
+// the migrations and seed files embedded into it, runs its job worker and lists its routes, so production
+// containers do not need grayv-lsm installed:
+//
+//	{{.Name}}                    # or {{.Name}} serve
+//	{{.Name}} migrate            # then migrate status, migrate rollback [steps]
+//	{{.Name}} seed
+//	{{.Name}} worker -q emails
+//	{{.Name}} routes list
+//
+// The database is opened with DATABASE_URL, and DATABASE_DRIVER ("postgres" by default).
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/ooyeku/grayv-lsm/pkg/appdb"
+	"github.com/spf13/cobra"
+
+	{{.Name}} "{{.Module}}"
+	"{{.Module}}/internal/handlers"
+	"{{.Module}}/internal/jobs"
+	"{{.Module}}/internal/middleware"
+	"{{.Module}}/internal/preflight"
+	"{{.Module}}/internal/server"
+)
+
+// New returns the root command of {{.Name}}, which serves the app when run without a subcommand.
+func New() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "{{.Name}}",
+		Short:        "Serve {{.Name}} and manage its database",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         serve,
+	}
+	root.AddCommand(&cobra.Command{
+		Use:   "serve",
+		Short: "Serve {{.Name}} over HTTP until SIGINT or SIGTERM",
+		Args:  cobra.NoArgs,
+		RunE:  serve,
+	})
+	root.AddCommand(migrateCommand(), seedCommand(), workerCommand(), routesCommand())
+	return root
+}
+
+// serve runs the preflight checks and the server, see internal/preflight and internal/server.
+func serve(cmd *cobra.Command, args []string) error {
+	options, err := server.FromEnv(os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	// Fail before binding the port rather than serve errors, see internal/preflight.
+	checks := preflight.FromEnv(os.Getenv)
+	if err := preflight.Run(cmd.Context(), checks, log.Printf); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	handlers.Register(mux)
+	srv := server.New(serverChain().Then(mux), options, log.Printf)
+
+	// db is the connection pool of the app when DATABASE_URL is set, closed once the requests in flight are
+	// done. Register warmups and cleanups with srv.OnStart and srv.OnStop, see internal/server.
+	var db *sql.DB
+	if checks.DatabaseURL != "" {
+		if db, err = sql.Open(checks.DatabaseDriver, checks.DatabaseURL); err != nil {
+			return err
+		}
+		srv.OnStop("database", func(ctx context.Context) error { return db.Close() })
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Starting {{.Name}} on %s", options.Addr)
+	return srv.Run(ctx)
+}
+
+// serverChain returns the middleware wrapping every route. Add the app's own middleware with chain.Use, see
+// internal/middleware.
+func serverChain() *middleware.Chain {
+	return middleware.New(middleware.FromEnv(os.Getenv), log.Printf)
+}
+
+// openDB opens the database of DATABASE_URL.
+func openDB() (*sql.DB, error) {
+	checks := preflight.FromEnv(os.Getenv)
+	if checks.DatabaseURL == "" {
+		return nil, errors.New("set DATABASE_URL to the database of {{.Name}}")
+	}
+	return sql.Open(checks.DatabaseDriver, checks.DatabaseURL)
+}
+
+// withDB runs fn with the database of DATABASE_URL.
+func withDB(fn func(db *sql.DB) error) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+func migrateCommand() *cobra.Command {
+	migrate := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply the pending migrations",
+		Long: ` + "`" + `Applies the pending migrations of migrations/, embedded into the binary, together with those of the
+tables grayv-lsm provides, such as the jobs table, in version order.` + "`" + `,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDB(func(db *sql.DB) error { return appdb.Migrate(cmd.Context(), db, {{.Name}}.Files) })
+		},
+	}
+	migrate.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and whether they were applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDB(func(db *sql.DB) error {
+				migrations, err := appdb.Migrations(cmd.Context(), db, {{.Name}}.Files)
+				if err != nil {
+					return err
+				}
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+				for _, m := range migrations {
+					status := "pending"
+					if m.Applied {
+						status = "applied"
+					}
+					fmt.Fprintf(tw, "%d\t%s\t%s\n", m.Version, m.Name, status)
+				}
+				return tw.Flush()
+			})
+		},
+	})
+	migrate.AddCommand(&cobra.Command{
+		Use:   "rollback [steps]",
+		Short: "Roll back the last migrations applied, 1 by default",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps := 1
+			if len(args) == 1 {
+				var err error
+				if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+					return fmt.Errorf("invalid number of steps %q", args[0])
+				}
+			}
+			return withDB(func(db *sql.DB) error { return appdb.Rollback(cmd.Context(), db, {{.Name}}.Files, steps) })
+		},
+	})
+	return migrate
+}
+
+func seedCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "seed",
+		Short: "Execute the seed files",
+		Long: ` + "`" + `Executes the seed files of seeds/, embedded into the binary, in order of file name.` + "`" + `,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDB(func(db *sql.DB) error { return appdb.Seed(cmd.Context(), db, {{.Name}}.Files) })
+		},
+	}
+}
+
+func workerCommand() *cobra.Command {
+	var options jobs.Options
+	worker := &cobra.Command{
+		Use:   "worker",
+		Short: "Run the jobs of a queue until SIGINT or SIGTERM",
+		Long: ` + "`" + `Claims and runs the jobs of a queue with the handlers registered by registerJobs, see internal/jobs. On
+SIGINT or SIGTERM, the running jobs finish within the drain timeout and the others go back to the queue.` + "`" + `,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDB(func(db *sql.DB) error {
+				options.Logf = log.Printf
+				w := jobs.NewWorker(db, options)
+				registerJobs(w)
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				return w.Run(ctx)
+			})
+		},
+	}
+	worker.Flags().StringVarP(&options.Queue, "queue", "q", "default", "Queue to run the jobs of")
+	worker.Flags().IntVarP(&options.Concurrency, "concurrency", "c", 1, "Number of jobs to run at once")
+	worker.Flags().DurationVar(&options.DrainTimeout, "drain-timeout", 0, "How long running jobs may take to finish on shutdown (30s by default)")
+	return worker
+}
+
+// routeInfo is a route as listed by "routes list --json", which "grayv-lsm api routes" reads.
+type routeInfo struct {
+	Method      string   ` + "`" + `json:"method"` + "`" + `
+	Path        string   ` + "`" + `json:"path"` + "`" + `
+	Handler     string   ` + "`" + `json:"handler"` + "`" + `
+	Middleware  []string ` + "`" + `json:"middleware"` + "`" + `
+	Description string   ` + "`" + `json:"description"` + "`" + `
+}
+
+func routesCommand() *cobra.Command {
+	routes := &cobra.Command{
+		Use:   "routes",
+		Short: "Inspect the HTTP routes",
+	}
+	var asJSON bool
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the routes registered by internal/handlers",
+		Long: ` + "`" + `Lists the routes registered by internal/handlers with their method, handler and middleware: those
+wrapping every route, as configured by the environment, then those of the route, outermost first.` + "`" + `,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			wrapping := serverChain().Names()
+			infos := make([]routeInfo, len(handlers.Routes))
+			for i, route := range handlers.Routes {
+				infos[i] = routeInfo{
+					Method:      route.Method(),
+					Path:        route.Path(),
+					Handler:     middleware.FuncName(route.Handler),
+					Middleware:  append(append([]string{}, wrapping...), route.Chain().Names()...),
+					Description: route.Description,
+				}
+			}
+			if asJSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(infos)
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "METHOD\tPATH\tHANDLER\tMIDDLEWARE\tDESCRIPTION")
+			for _, info := range infos {
+				method, chain := info.Method, strings.Join(info.Middleware, " > ")
+				if method == "" {
+					method = "ANY"
+				}
+				if chain == "" {
+					chain = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", method, info.Path, info.Handler, chain, info.Description)
+			}
+			return tw.Flush()
+		},
+	}
+	list.Flags().BoolVar(&asJSON, "json", false, "Print the routes as JSON")
+	routes.AddCommand(list)
+	return routes
+}
+`
+
+// cliJobsTemplate is the file of internal/cli registering the handlers of the jobs of a new app.
+const cliJobsTemplate = `package cli
+
+import "{{.Module}}/internal/jobs"
+
+// registerJobs registers the handlers of the jobs run by the worker command, e.g.
+//
+//	w.Handle("send_welcome", sendWelcome)
+//
+// Jobs of a kind without a handler fail.
+func registerJobs(w *jobs.Worker) {}
+`
@@ -92,15 +92,21 @@ import (
     "fmt"
     "log"
     "net/http"
+    "os"
 )
 
 func main() {
     http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-        fmt.Fprintf(w, "Welcome to %s!", appName)
+        fmt.Fprintf(w, "Welcome to %s!", "{{.}}")
     })
 
-    log.Println("Starting server on :8080")
-    if err := http.ListenAndServe(":8080", nil); err != nil {
+    port := os.Getenv("PORT")
+    if port == "" {
+        port = "8080"
+    }
+
+    log.Println("Starting server on :" + port)
+    if err := http.ListenAndServe(":"+port, nil); err != nil {
         log.Fatal(err)
     }
 }
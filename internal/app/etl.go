@@ -0,0 +1,866 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+// The sources of the pipelines ScaffoldETL generates.
+const (
+	ETLSourceCSV = "csv"
+	ETLSourceSQL = "sql"
+)
+
+// pipelineNamePattern matches the names of pipelines, used as file names and in the etl_checkpoints table.
+var pipelineNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ETLOptions configure the pipeline generated by ScaffoldETL.
+type ETLOptions struct {
+	// Pipeline is the name of the pipeline.
+	Pipeline string
+	// Source is ETLSourceCSV, reading data/<pipeline>.csv, or ETLSourceSQL, running Query against the database
+	// in the SOURCE_DATABASE_URL environment variable. ETLSourceCSV by default.
+	Source string
+	Query  string
+	// Key is the integer column the rows of Query are extracted in the order of, "id" by default.
+	Key string
+	// Table is the table the records are loaded into, the name of the pipeline by default.
+	Table string
+	// Columns are the columns loaded, all the columns of the records when empty.
+	Columns []string
+	// Conflict lists the columns of a unique constraint of Table: records conflicting with a row update it.
+	Conflict []string
+}
+
+// etlData is the data the ETL templates are rendered with.
+type etlData struct {
+	scaffoldData
+	ETLOptions
+	// Func is the name of the transform function of the pipeline.
+	Func string
+}
+
+// etlFiles are the files shared by the pipelines of an app, written by ScaffoldETL if they do not exist.
+var etlFiles = []scaffoldFile{
+	{"internal/etl/etl.go", etlTemplate},
+	{"internal/pipelines/doc.go", `// Package pipelines holds the ETL pipelines of {{.Name}}, one file each, generated with
+// "grayv-lsm app etl". Every file registers its pipeline with etl.Register in its init function.
+package pipelines
+`},
+	{"cmd/etl/main.go", etlCommandTemplate},
+}
+
+// ScaffoldETL adds a pipeline to the app of the given name, in its <name>_grav directory of fsys: the file
+// internal/pipelines/<pipeline>.go registering the pipeline, with a source, a transform function to fill in
+// and the table it loads, and, for the first pipeline of the app, the internal/etl package running the
+// pipelines and the cmd/etl command running and resuming them. It returns the paths of the files written, and
+// fails if the pipeline exists.
+func ScaffoldETL(fsys filesystem.FS, name string, options ETLOptions) ([]string, error) {
+	if !pipelineNamePattern.MatchString(options.Pipeline) {
+		return nil, fmt.Errorf("invalid pipeline name %q: use lowercase letters, digits and underscores, starting with a letter", options.Pipeline)
+	}
+	switch options.Source {
+	case "":
+		options.Source = ETLSourceCSV
+	case ETLSourceCSV:
+	case ETLSourceSQL:
+		if options.Query == "" {
+			return nil, fmt.Errorf("a pipeline with an SQL source needs a query")
+		}
+	default:
+		return nil, fmt.Errorf("unknown source %q: use %s or %s", options.Source, ETLSourceCSV, ETLSourceSQL)
+	}
+	if options.Key == "" {
+		options.Key = "id"
+	}
+	if options.Table == "" {
+		options.Table = options.Pipeline
+	}
+
+	dir := name + "_grav"
+	if _, err := fsys.Stat(dir); err != nil {
+		return nil, fmt.Errorf("grayv app %s not found: %w", name, err)
+	}
+	pipelineFile := scaffoldFile{path.Join("internal/pipelines", options.Pipeline+".go"), pipelineTemplate}
+	if _, err := fsys.Stat(path.Join(dir, pipelineFile.Path)); !errors.Is(err, fs.ErrNotExist) {
+		if err == nil {
+			return nil, fmt.Errorf("pipeline %s already exists", options.Pipeline)
+		}
+		return nil, err
+	}
+
+	data := etlData{
+		scaffoldData: scaffoldData{Name: name, Module: dir},
+		ETLOptions:   options,
+		Func:         transformFuncName(options.Pipeline),
+	}
+	var written []string
+	for _, file := range append(etlFiles, pipelineFile) {
+		filePath := path.Join(dir, file.Path)
+		if _, err := fsys.Stat(filePath); err == nil {
+			continue
+		}
+		tmpl, err := template.New(file.Path).Parse(file.Template)
+		if err != nil {
+			return written, err
+		}
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, data); err != nil {
+			return written, fmt.Errorf("failed to render %s: %w", file.Path, err)
+		}
+		source, err := format.Source(content.Bytes())
+		if err != nil {
+			return written, fmt.Errorf("failed to format %s: %w", file.Path, err)
+		}
+		if err := fsys.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			return written, fmt.Errorf("failed to create directory %s: %w", path.Dir(filePath), err)
+		}
+		if err := fsys.WriteFile(filePath, source, 0644); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+		written = append(written, filePath)
+	}
+	return written, nil
+}
+
+// transformFuncName returns the name of the transform function of a pipeline, e.g. transformOrderImport for
+// order_import.
+func transformFuncName(pipeline string) string {
+	var name strings.Builder
+	name.WriteString("transform")
+	for _, part := range strings.Split(pipeline, "_") {
+		if part != "" {
+			name.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return name.String()
+}
+
+// pipelineTemplate is the file of a pipeline in internal/pipelines.
+const pipelineTemplate = `package pipelines
+
+import (
+	"context"
+	"strings"
+
+	"{{.Module}}/internal/etl"
+)
+
+func init() {
+	etl.Register(&etl.Pipeline{
+		Name: {{printf "%q" .Pipeline}},
+{{- if eq .Source "sql"}}
+		// Extract the rows of the query from the database in SOURCE_DATABASE_URL, in the order of {{.Key}}.
+		// Later runs extract the rows added since.
+		Source: &etl.SQLSource{
+			URLEnv: "SOURCE_DATABASE_URL",
+			Query:  {{printf "%q" .Query}},
+			Key:    {{printf "%q" .Key}},
+		},
+{{- else}}
+		// Extract the rows of the CSV file, keyed by its headers.
+		Source: &etl.CSVSource{Path: {{printf "%q" (print "data/" .Pipeline ".csv")}}},
+{{- end}}
+		Transforms: []etl.Transform{ {{- .Func -}} },
+		Load: etl.Load{
+			Table: {{printf "%q" .Table}},
+{{- if .Columns}}
+			Columns: []string{ {{- range $i, $c := .Columns}}{{if $i}}, {{end}}{{printf "%q" $c}}{{end -}} },
+{{- end}}
+{{- if .Conflict}}
+			Conflict: []string{ {{- range $i, $c := .Conflict}}{{if $i}}, {{end}}{{printf "%q" $c}}{{end -}} },
+{{- end}}
+		},
+	})
+}
+
+// {{.Func}} prepares a record of the {{.Pipeline}} pipeline to be loaded.
+// Rename, convert and validate its values here, or return nil to skip it. Returning an error stops the
+// pipeline, which resumes from the batch of the record at its next run.
+func {{.Func}}(ctx context.Context, record etl.Record) (etl.Record, error) {
+	for column, value := range record {
+		if s, ok := value.(string); ok {
+			record[column] = strings.TrimSpace(s)
+		}
+	}
+	return record, nil
+}
+`
+
+// etlCommandTemplate is the cmd/etl command of an app, running its pipelines.
+const etlCommandTemplate = `// Command etl runs the ETL pipelines of {{.Name}} registered in internal/pipelines:
+//
+//	go run ./cmd/etl list                          # list the pipelines and their checkpoints
+//	go run ./cmd/etl run [-restart] <pipeline>     # run until the source is exhausted, resuming by default
+//	go run ./cmd/etl reset <pipeline>              # start over at the next run
+//	go run ./cmd/etl enqueue [-queue name] [-restart] <pipeline>  # run as a background job
+//	go run ./cmd/etl work [-queue name]            # run the enqueued pipelines until interrupted
+//
+// DATABASE_URL opens the database the records are loaded into, with the driver in DATABASE_DRIVER, "postgres"
+// by default, which must be imported here.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"{{.Module}}/internal/etl"
+	"{{.Module}}/internal/jobs"
+	_ "{{.Module}}/internal/pipelines"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: etl list | run [-restart] <pipeline> | reset <pipeline> | enqueue [-queue name] [-restart] <pipeline> | work [-queue name]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	restart := flags.Bool("restart", false, "start over from the first record of the source")
+	queue := flags.String("queue", "default", "queue of the jobs running pipelines")
+	flags.Parse(os.Args[2:])
+
+	driver := os.Getenv("DATABASE_DRIVER")
+	if driver == "" {
+		driver = "postgres"
+	}
+	if os.Getenv("DATABASE_URL") == "" {
+		log.Fatal("set DATABASE_URL to the database the records are loaded into")
+	}
+	db, err := sql.Open(driver, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runner := etl.NewRunner(db, log.Printf)
+
+	pipeline := func() string {
+		if flags.NArg() != 1 {
+			usage()
+		}
+		return flags.Arg(0)
+	}
+	switch os.Args[1] {
+	case "list":
+		err = list(ctx, runner)
+	case "run":
+		var p *etl.Pipeline
+		if p, err = etl.Lookup(pipeline()); err == nil {
+			_, err = runner.Run(ctx, p, *restart)
+		}
+	case "reset":
+		err = runner.Reset(ctx, pipeline())
+	case "enqueue":
+		var id int64
+		if id, err = etl.Enqueue(ctx, db, *queue, pipeline(), *restart); err == nil {
+			log.Printf("Enqueued job %d on queue %s", id, *queue)
+		}
+	case "work":
+		worker := jobs.NewWorker(db, jobs.Options{Queue: *queue, Logf: log.Printf})
+		worker.Handle(etl.JobKind, runner.Handler())
+		err = worker.Run(ctx)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// list prints the registered pipelines with their checkpoints.
+func list(ctx context.Context, runner *etl.Runner) error {
+	checkpoints, err := runner.Checkpoints(ctx)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]etl.Checkpoint, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		byName[checkpoint.Pipeline] = checkpoint
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PIPELINE\tRECORDS\tCURSOR\tUPDATED")
+	for _, name := range etl.Names() {
+		checkpoint, ok := byName[name]
+		if !ok {
+			fmt.Fprintf(tw, "%s\t-\t-\tnever run\n", name)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", name, checkpoint.Records, checkpoint.Cursor, checkpoint.UpdatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return tw.Flush()
+}
+`
+
+// etlTemplate is the internal/etl package of an app, running the pipelines generated by ScaffoldETL with
+// checkpoints in the etl_checkpoints table created by "db migrate", and as jobs of internal/jobs. Like
+// jobsTemplate, it only uses the standard library.
+const etlTemplate = `// Package etl runs the extract, transform and load pipelines of {{.Name}}. A Pipeline reads the records of a
+// Source in batches, passes every record through its transforms, and loads each batch into a table with
+// multi-row INSERTs, in the transaction that saves the position of the batch in the etl_checkpoints table
+// created by "grayv-lsm db migrate". A pipeline that is interrupted, or fails, resumes after the last batch it
+// loaded, so that no record is loaded twice. Pipelines run with "go run ./cmd/etl", or as jobs of
+// internal/jobs.
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"{{.Module}}/internal/jobs"
+)
+
+// Record is a record of a pipeline, by column.
+type Record map[string]interface{}
+
+// Source extracts the records of a pipeline.
+type Source interface {
+	// Extract returns up to limit records following the position cursor, "" for the first record, with the
+	// position of the last record returned. It returns no records once the source is exhausted.
+	Extract(ctx context.Context, cursor string, limit int) ([]Record, string, error)
+}
+
+// Transform changes a record, or drops it by returning nil.
+type Transform func(ctx context.Context, record Record) (Record, error)
+
+// Load configures how the records of a pipeline are loaded.
+type Load struct {
+	// Table is the table the records are inserted into.
+	Table string
+	// Columns are the columns loaded, in order; the keys of the first record of every batch when empty.
+	Columns []string
+	// Conflict lists the columns of a unique constraint of the table: records conflicting with a row update it
+	// instead of failing. A batch may not hold two records with the same values of these columns.
+	Conflict []string
+}
+
+// Pipeline extracts records from a source, transforms them and loads them into a table.
+type Pipeline struct {
+	Name       string
+	Source     Source
+	Transforms []Transform
+	Load       Load
+	// BatchSize is the number of records extracted and loaded at once, 1000 by default.
+	BatchSize int
+}
+
+var (
+	mu        sync.Mutex
+	pipelines = make(map[string]*Pipeline)
+)
+
+// Register registers a pipeline under its name, from the init function of its file in internal/pipelines. It
+// panics if the name is taken.
+func Register(p *Pipeline) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := pipelines[p.Name]; ok {
+		panic(fmt.Sprintf("etl: pipeline %s registered twice", p.Name))
+	}
+	pipelines[p.Name] = p
+}
+
+// Lookup returns the registered pipeline of a name.
+func Lookup(name string) (*Pipeline, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	p, ok := pipelines[name]
+	if !ok {
+		return nil, fmt.Errorf("etl: no pipeline named %q", name)
+	}
+	return p, nil
+}
+
+// Names returns the names of the registered pipelines, sorted.
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(pipelines))
+	for name := range pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ErrConcurrentRun is returned when the checkpoint of a pipeline moved while a batch was loaded: the pipeline
+// runs elsewhere too, and the batch is not loaded.
+var ErrConcurrentRun = errors.New("etl: the pipeline is running elsewhere")
+
+// Checkpoint is the progress of a pipeline, saved with every batch it loads.
+type Checkpoint struct {
+	Pipeline string
+	// Cursor is the position of the last record extracted, where the next run resumes.
+	Cursor string
+	// Records counts the records loaded since the pipeline last started over.
+	Records   int64
+	UpdatedAt time.Time
+}
+
+// Runner runs pipelines, saving their checkpoints in the database they load.
+type Runner struct {
+	store store
+	logf  func(format string, args ...interface{})
+}
+
+// NewRunner creates a runner loading records into db and saving checkpoints in its etl_checkpoints table.
+// logf, if not nil, logs the progress of the pipelines.
+func NewRunner(db *sql.DB, logf func(format string, args ...interface{})) *Runner {
+	return newRunner(sqlStore{db}, logf)
+}
+
+func newRunner(s store, logf func(format string, args ...interface{})) *Runner {
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	return &Runner{store: s, logf: logf}
+}
+
+// Run runs a pipeline from its checkpoint, or from the first record of its source with restart, until the
+// source is exhausted or ctx is done. It returns the number of records loaded.
+func (r *Runner) Run(ctx context.Context, p *Pipeline, restart bool) (int64, error) {
+	if restart {
+		if err := r.store.reset(ctx, p.Name); err != nil {
+			return 0, err
+		}
+	}
+	checkpoint, err := r.store.checkpoint(ctx, p.Name)
+	if err != nil {
+		return 0, err
+	}
+	cursor := ""
+	if checkpoint != nil && checkpoint.Cursor != "" {
+		cursor = checkpoint.Cursor
+		r.logf("etl: resuming %s after %s", p.Name, cursor)
+	}
+	size := p.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+
+	var loaded int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return loaded, err
+		}
+		records, next, err := p.Source.Extract(ctx, cursor, size)
+		if err != nil {
+			return loaded, fmt.Errorf("etl: extracting %s: %w", p.Name, err)
+		}
+		if len(records) == 0 {
+			r.logf("etl: %s done, %d record(s) loaded", p.Name, loaded)
+			return loaded, nil
+		}
+		batch, err := transform(ctx, p.Transforms, records)
+		if err != nil {
+			return loaded, fmt.Errorf("etl: transforming %s: %w", p.Name, err)
+		}
+		if err := r.store.commit(ctx, p.Name, p.Load, batch, cursor, next); err != nil {
+			return loaded, fmt.Errorf("etl: loading %s into %s: %w", p.Name, p.Load.Table, err)
+		}
+		loaded += int64(len(batch))
+		cursor = next
+		r.logf("etl: %s loaded %d record(s)", p.Name, loaded)
+	}
+}
+
+// transform passes the records through the transforms, dropping the records a transform returns nil for.
+func transform(ctx context.Context, transforms []Transform, records []Record) ([]Record, error) {
+	batch := make([]Record, 0, len(records))
+	for _, record := range records {
+		for _, t := range transforms {
+			var err error
+			if record, err = t(ctx, record); err != nil {
+				return nil, err
+			}
+			if record == nil {
+				break
+			}
+		}
+		if record != nil {
+			batch = append(batch, record)
+		}
+	}
+	return batch, nil
+}
+
+// Checkpoints returns the checkpoints of the pipelines that ran.
+func (r *Runner) Checkpoints(ctx context.Context) ([]Checkpoint, error) {
+	return r.store.checkpoints(ctx)
+}
+
+// Reset forgets the checkpoint of a pipeline, so that its next run starts over.
+func (r *Runner) Reset(ctx context.Context, name string) error {
+	return r.store.reset(ctx, name)
+}
+
+// JobKind is the kind of the jobs of internal/jobs running a pipeline.
+const JobKind = "etl"
+
+// JobPayload is the payload of JobKind jobs.
+type JobPayload struct {
+	Pipeline string ` + "`" + `json:"pipeline"` + "`" + `
+	Restart  bool   ` + "`" + `json:"restart,omitempty"` + "`" + `
+}
+
+// Enqueue adds a job running the named pipeline to a queue of internal/jobs.
+func Enqueue(ctx context.Context, db *sql.DB, queue, name string, restart bool) (int64, error) {
+	if _, err := Lookup(name); err != nil {
+		return 0, err
+	}
+	return jobs.Enqueue(ctx, db, queue, JobKind, JobPayload{Pipeline: name, Restart: restart})
+}
+
+// Handler returns the handler of JobKind jobs, registered on a worker with worker.Handle(etl.JobKind, ...).
+// Only the first attempt of a job restarting its pipeline starts over: retries resume from the checkpoint.
+func (r *Runner) Handler() jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var payload JobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("etl: invalid job payload: %w", err)
+		}
+		p, err := Lookup(payload.Pipeline)
+		if err != nil {
+			return err
+		}
+		_, err = r.Run(ctx, p, payload.Restart && job.Attempts <= 1)
+		return err
+	}
+}
+
+// maxParams is the number of parameters a Postgres statement accepts.
+const maxParams = 65535
+
+// insertStatements returns the multi-row INSERT statements loading records, with their arguments.
+func insertStatements(load Load, records []Record) ([]string, [][]interface{}) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := load.Columns
+	if len(columns) == 0 {
+		for column := range records[0] {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+	}
+	head := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quote(load.Table), quoteAll(columns))
+	tail := ""
+	if len(load.Conflict) > 0 {
+		conflict := make(map[string]bool, len(load.Conflict))
+		for _, column := range load.Conflict {
+			conflict[column] = true
+		}
+		var updates []string
+		for _, column := range columns {
+			if !conflict[column] {
+				updates = append(updates, quote(column)+" = EXCLUDED."+quote(column))
+			}
+		}
+		tail = fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", quoteAll(load.Conflict))
+		if len(updates) > 0 {
+			tail = fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", quoteAll(load.Conflict), strings.Join(updates, ", "))
+		}
+	}
+
+	var statements []string
+	var arguments [][]interface{}
+	perStatement := maxParams / len(columns)
+	for start := 0; start < len(records); start += perStatement {
+		end := min(start+perStatement, len(records))
+		rows := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, record := range records[start:end] {
+			placeholders := make([]string, len(columns))
+			for i, column := range columns {
+				args = append(args, record[column])
+				placeholders[i] = "$" + strconv.Itoa(len(args))
+			}
+			rows = append(rows, "("+strings.Join(placeholders, ", ")+")")
+		}
+		statements = append(statements, head+strings.Join(rows, ", ")+tail)
+		arguments = append(arguments, args)
+	}
+	return statements, arguments
+}
+
+func quote(name string) string {
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// store holds the checkpoints of the pipelines and loads their records.
+type store interface {
+	checkpoint(ctx context.Context, pipeline string) (*Checkpoint, error)
+	checkpoints(ctx context.Context) ([]Checkpoint, error)
+	// commit loads the records and moves the checkpoint of the pipeline from cursor to next, in one
+	// transaction. It fails with ErrConcurrentRun if the checkpoint is not at cursor.
+	commit(ctx context.Context, pipeline string, load Load, records []Record, cursor, next string) error
+	reset(ctx context.Context, pipeline string) error
+}
+
+// sqlStore is the store of the etl_checkpoints table.
+type sqlStore struct {
+	db *sql.DB
+}
+
+func (s sqlStore) checkpoint(ctx context.Context, pipeline string) (*Checkpoint, error) {
+	c := Checkpoint{Pipeline: pipeline}
+	err := s.db.QueryRowContext(ctx, "SELECT last_cursor, records, updated_at FROM etl_checkpoints WHERE pipeline = $1", pipeline).Scan(&c.Cursor, &c.Records, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s sqlStore) checkpoints(ctx context.Context) ([]Checkpoint, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT pipeline, last_cursor, records, updated_at FROM etl_checkpoints ORDER BY pipeline")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var checkpoints []Checkpoint
+	for rows.Next() {
+		var c Checkpoint
+		if err := rows.Scan(&c.Pipeline, &c.Cursor, &c.Records, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, rows.Err()
+}
+
+func (s sqlStore) commit(ctx context.Context, pipeline string, load Load, records []Record, cursor, next string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO etl_checkpoints (pipeline) VALUES ($1) ON CONFLICT (pipeline) DO NOTHING", pipeline); err != nil {
+		return err
+	}
+	var current string
+	if err := tx.QueryRowContext(ctx, "SELECT last_cursor FROM etl_checkpoints WHERE pipeline = $1 FOR UPDATE", pipeline).Scan(&current); err != nil {
+		return err
+	}
+	if current != cursor {
+		return ErrConcurrentRun
+	}
+	statements, arguments := insertStatements(load, records)
+	for i, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, arguments[i]...); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE etl_checkpoints SET last_cursor = $2, records = records + $3, updated_at = now() WHERE pipeline = $1", pipeline, next, len(records)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s sqlStore) reset(ctx context.Context, pipeline string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM etl_checkpoints WHERE pipeline = $1", pipeline)
+	return err
+}
+
+// CSVSource extracts the records of a CSV file with a header row, keyed by the headers, with string values.
+// Its cursor is the number of records read.
+type CSVSource struct {
+	Path string
+
+	file   *os.File
+	reader *csv.Reader
+	header []string
+	read   int
+}
+
+// Extract implements Source. The file stays open between batches, and is closed once exhausted.
+func (s *CSVSource) Extract(ctx context.Context, cursor string, limit int) ([]Record, string, error) {
+	skip := 0
+	if cursor != "" {
+		var err error
+		if skip, err = strconv.Atoi(cursor); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q of %s", cursor, s.Path)
+		}
+	}
+	if s.reader == nil || s.read != skip {
+		if err := s.open(); err != nil {
+			return nil, "", err
+		}
+		for s.read < skip {
+			if _, err := s.reader.Read(); err == io.EOF {
+				return nil, cursor, s.close()
+			} else if err != nil {
+				return nil, "", err
+			}
+			s.read++
+		}
+	}
+
+	var records []Record
+	for len(records) < limit {
+		values, err := s.reader.Read()
+		if err == io.EOF {
+			if err := s.close(); err != nil {
+				return nil, "", err
+			}
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("%s, record %d: %w", s.Path, s.read+1, err)
+		}
+		record := make(Record, len(s.header))
+		for i, column := range s.header {
+			if i < len(values) {
+				record[column] = values[i]
+			}
+		}
+		records = append(records, record)
+		s.read++
+	}
+	return records, strconv.Itoa(skip + len(records)), nil
+}
+
+func (s *CSVSource) open() error {
+	s.close()
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	s.file, s.reader, s.read = file, csv.NewReader(file), 0
+	if s.header, err = s.reader.Read(); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", s.Path, err)
+	}
+	if len(s.header) > 0 {
+		s.header[0] = strings.TrimPrefix(s.header[0], "\ufeff")
+	}
+	return nil
+}
+
+func (s *CSVSource) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.reader = nil, nil
+	return err
+}
+
+// SQLSource extracts the rows of a query against another database in the order of an integer key column of
+// the query, such as id. Its cursor is the key of the last row read, so later runs extract the rows added
+// since.
+type SQLSource struct {
+	// Driver is the driver of the database, "postgres" by default, which must be imported.
+	Driver string
+	// URLEnv is the environment variable holding the URL of the database.
+	URLEnv string
+	Query  string
+	Key    string
+
+	db *sql.DB
+}
+
+// Extract implements Source. The database is opened at the first batch.
+func (s *SQLSource) Extract(ctx context.Context, cursor string, limit int) ([]Record, string, error) {
+	if s.db == nil {
+		driver := s.Driver
+		if driver == "" {
+			driver = "postgres"
+		}
+		url := os.Getenv(s.URLEnv)
+		if url == "" {
+			return nil, "", fmt.Errorf("set %s to the URL of the source database", s.URLEnv)
+		}
+		db, err := sql.Open(driver, url)
+		if err != nil {
+			return nil, "", err
+		}
+		s.db = db
+	}
+
+	query := fmt.Sprintf("SELECT * FROM (%s) AS source", s.Query)
+	args := []interface{}{limit}
+	if cursor != "" {
+		after, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q: the key %s must be an integer column", cursor, s.Key)
+		}
+		query += fmt.Sprintf(" WHERE %s > $2", quote(s.Key))
+		args = append(args, after)
+	}
+	rows, err := s.db.QueryContext(ctx, query+fmt.Sprintf(" ORDER BY %s LIMIT $1", quote(s.Key)), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var records []Record
+	next := cursor
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, "", err
+		}
+		record := make(Record, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			record[column] = values[i]
+		}
+		records = append(records, record)
+		next = fmt.Sprint(record[s.Key])
+	}
+	return records, next, rows.Err()
+}
+`
@@ -0,0 +1,425 @@
+package app
+
+// jobsTemplate is the internal/jobs package of a new app, running background jobs stored in the jobs table
+// created by "db migrate". Like preflightTemplate, it only uses the standard library.
+const jobsTemplate = `// Package jobs runs the background jobs of {{.Name}}. Jobs are rows of the jobs table, created by
+// "grayv-lsm db migrate": Enqueue adds one, and a Worker claims the jobs of a queue and runs the handler of
+// their kind. On shutdown, a worker stops claiming jobs, lets the running ones finish within a deadline, and
+// puts the others back in the queue for another worker, which resumes them from their last Checkpoint.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job is a job claimed by a worker.
+type Job struct {
+	ID      int64
+	Queue   string
+	Kind    string
+	Payload json.RawMessage
+	// Priority is the priority the job was enqueued with.
+	Priority int
+	// Attempts counts the runs of the job, this one included.
+	Attempts int
+	// Checkpoint is the progress saved by an earlier run of the job, or nil.
+	Checkpoint json.RawMessage
+}
+
+// Handler runs a job. The job is done when it returns nil, and runs again later otherwise, until it ran
+// max_attempts times. Its context is canceled when the worker gives up on it while draining. The outcome of a
+// job canceled with "grayv-lsm jobs cancel" while it runs is not recorded.
+type Handler func(ctx context.Context, job *Job) error
+
+// EnqueueOption sets the priority or the time to run of an enqueued job.
+type EnqueueOption func(*enqueueOptions)
+
+type enqueueOptions struct {
+	priority int
+	at       *time.Time
+	delay    time.Duration
+}
+
+// Priority sets the priority of a job, 0 by default: workers claim the due jobs of a queue with the highest
+// priority first, and jobs of the same priority in the order they are due.
+func Priority(priority int) EnqueueOption {
+	return func(o *enqueueOptions) { o.priority = priority }
+}
+
+// Delay runs a job no earlier than d after it is enqueued, as measured by the database clock.
+func Delay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) { o.delay = d }
+}
+
+// At runs a job no earlier than t.
+func At(t time.Time) EnqueueOption {
+	return func(o *enqueueOptions) { o.at = &t }
+}
+
+// Enqueue adds a job of the given kind to a queue, with its payload encoded as JSON, and returns its ID. The job
+// runs as soon as a worker is free, unless options delay it.
+func Enqueue(ctx context.Context, db *sql.DB, queue, kind string, payload interface{}, options ...EnqueueOption) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	var o enqueueOptions
+	for _, option := range options {
+		option(&o)
+	}
+	var id int64
+	err = db.QueryRowContext(ctx, ` + "`" + `
+		INSERT INTO jobs (queue, kind, payload, priority, run_at)
+		VALUES ($1, $2, $3, $4, COALESCE($5::timestamptz, now()) + make_interval(secs => $6))
+		RETURNING id` + "`" + `, queue, kind, data, o.priority, o.at, o.delay.Seconds(),
+	).Scan(&id)
+	return id, err
+}
+
+type checkpointKey struct{}
+
+// Checkpoint saves the progress of the job running with ctx, encoded as JSON. A later run of the job, e.g.
+// after it was requeued on shutdown, receives it in Job.Checkpoint.
+func Checkpoint(ctx context.Context, progress interface{}) error {
+	save, ok := ctx.Value(checkpointKey{}).(func(json.RawMessage) error)
+	if !ok {
+		return errors.New("jobs: Checkpoint called outside of a job")
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return save(data)
+}
+
+// Options configure a Worker. Zero values select the defaults.
+type Options struct {
+	// Queue is the queue the worker claims jobs from, "default" by default.
+	Queue string
+	// Concurrency is the number of jobs the worker runs at once, 1 by default.
+	Concurrency int
+	// QueueConcurrency limits the jobs of the queue running at once across all its workers, e.g. to spare a
+	// rate-limited API. No limit by default.
+	QueueConcurrency int
+	// PollInterval is how long the worker waits when the queue is empty, 1s by default.
+	PollInterval time.Duration
+	// RetryDelay is the delay before a failed job runs again, times its attempts, 10s by default.
+	RetryDelay time.Duration
+	// DrainTimeout is how long running jobs may take to finish on shutdown before they are requeued, 30s by
+	// default.
+	DrainTimeout time.Duration
+	// LockTimeout is how long a job may run before other workers consider its worker dead and claim it again,
+	// 15m by default.
+	LockTimeout time.Duration
+	// Logf logs what the worker does, if set.
+	Logf func(format string, args ...interface{})
+}
+
+// Stats are counters of a worker.
+type Stats struct {
+	Claimed   int64
+	Succeeded int64
+	Failed    int64
+	Requeued  int64
+	// Drain is how long the last shutdown took to drain the running jobs.
+	Drain time.Duration
+}
+
+// Worker claims and runs the jobs of a queue.
+type Worker struct {
+	store    store
+	id       string
+	options  Options
+	handlers map[string]Handler
+
+	claimed, succeeded, failed, requeued, drain atomic.Int64
+}
+
+var workers atomic.Int64
+
+// NewWorker creates a worker running the jobs of db.
+func NewWorker(db *sql.DB, options Options) *Worker {
+	return newWorker(sqlStore{db}, options)
+}
+
+func newWorker(s store, options Options) *Worker {
+	if options.Queue == "" {
+		options.Queue = "default"
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = time.Second
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = 10 * time.Second
+	}
+	if options.DrainTimeout <= 0 {
+		options.DrainTimeout = 30 * time.Second
+	}
+	if options.LockTimeout <= 0 {
+		options.LockTimeout = 15 * time.Minute
+	}
+	host, _ := os.Hostname()
+	return &Worker{
+		store:    s,
+		id:       fmt.Sprintf("%s:%d:%d", host, os.Getpid(), workers.Add(1)),
+		options:  options,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle registers the handler of the jobs of a kind. Jobs without a handler fail.
+func (w *Worker) Handle(kind string, handler Handler) {
+	w.handlers[kind] = handler
+}
+
+// Stats returns the counters of the worker.
+func (w *Worker) Stats() Stats {
+	return Stats{
+		Claimed:   w.claimed.Load(),
+		Succeeded: w.succeeded.Load(),
+		Failed:    w.failed.Load(),
+		Requeued:  w.requeued.Load(),
+		Drain:     time.Duration(w.drain.Load()),
+	}
+}
+
+func (w *Worker) logf(format string, args ...interface{}) {
+	if w.options.Logf != nil {
+		w.options.Logf(format, args...)
+	}
+}
+
+// Run claims and runs jobs until ctx is done, e.g. on SIGTERM, then drains: it stops claiming jobs, waits
+// DrainTimeout for the running jobs to finish, and requeues the jobs still running before canceling their
+// context. It returns once drained, with the errors of requeuing jobs.
+func (w *Worker) Run(ctx context.Context) error {
+	// Jobs outlive ctx while draining: they run with their own context, canceled when they are given up on.
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	running := make(map[int64]bool)
+	slots := make(chan struct{}, w.options.Concurrency)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		job, err := w.store.claim(ctx, w.options.Queue, w.id, w.options.LockTimeout, w.options.QueueConcurrency)
+		if err != nil || job == nil {
+			<-slots
+			if err != nil && ctx.Err() == nil {
+				w.logf("jobs: claiming a job failed: %v", err)
+			}
+			select {
+			case <-time.After(w.options.PollInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		w.claimed.Add(1)
+		mu.Lock()
+		running[job.ID] = true
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(jobCtx, job)
+			mu.Lock()
+			delete(running, job.ID)
+			mu.Unlock()
+			<-slots
+		}()
+	}
+
+	start := time.Now()
+	mu.Lock()
+	w.logf("jobs: draining %d running job(s) of queue %s", len(running), w.options.Queue)
+	mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var requeued int
+	var errs []error
+	select {
+	case <-done:
+	case <-time.After(w.options.DrainTimeout):
+		mu.Lock()
+		ids := make([]int64, 0, len(running))
+		for id := range running {
+			ids = append(ids, id)
+		}
+		mu.Unlock()
+		requeueCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		for _, id := range ids {
+			ok, err := w.store.requeue(requeueCtx, id, w.id)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to requeue job %d: %w", id, err))
+			} else if ok {
+				requeued++
+			}
+		}
+		cancel()
+		// Jobs are requeued before their context is canceled, so that they are not recorded as failed.
+		cancelJobs()
+	}
+
+	elapsed := time.Since(start)
+	w.drain.Store(int64(elapsed))
+	w.requeued.Add(int64(requeued))
+	w.logf("jobs: drained queue %s in %s, %d job(s) requeued", w.options.Queue, elapsed.Round(time.Millisecond), requeued)
+	return errors.Join(errs...)
+}
+
+// run runs a claimed job and records its outcome. The store ignores the outcome of jobs the worker no longer
+// holds, such as requeued jobs.
+func (w *Worker) run(ctx context.Context, job *Job) {
+	var err error
+	if handler, ok := w.handlers[job.Kind]; ok {
+		jobCtx := context.WithValue(ctx, checkpointKey{}, func(data json.RawMessage) error {
+			return w.store.checkpoint(ctx, job.ID, w.id, data)
+		})
+		err = runHandler(jobCtx, handler, job)
+	} else {
+		err = fmt.Errorf("no handler for jobs of kind %q", job.Kind)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err == nil {
+		w.succeeded.Add(1)
+		err = w.store.complete(recordCtx, job.ID, w.id)
+	} else {
+		w.failed.Add(1)
+		w.logf("jobs: job %d (%s) failed: %v", job.ID, job.Kind, err)
+		err = w.store.fail(recordCtx, job.ID, w.id, time.Duration(job.Attempts)*w.options.RetryDelay, err)
+	}
+	if err != nil {
+		w.logf("jobs: failed to record the outcome of job %d: %v", job.ID, err)
+	}
+}
+
+// runHandler runs a handler, turning its panics into errors.
+func runHandler(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// store holds the jobs. Its methods other than claim only change jobs locked by the given worker.
+type store interface {
+	// claim locks the next job of a queue due to run for a worker, the one with the highest priority, or returns
+	// nil if there is none or limit jobs of the queue are running already (when limit > 0). Jobs locked for
+	// longer than lockTimeout are claimed again.
+	claim(ctx context.Context, queue, worker string, lockTimeout time.Duration, limit int) (*Job, error)
+	complete(ctx context.Context, id int64, worker string) error
+	// fail records the error of a job, which runs again after retryAfter, unless it ran max_attempts times.
+	fail(ctx context.Context, id int64, worker string, retryAfter time.Duration, err error) error
+	// requeue unlocks a running job without counting the attempt, and reports whether it did.
+	requeue(ctx context.Context, id int64, worker string) (bool, error)
+	checkpoint(ctx context.Context, id int64, worker string, data json.RawMessage) error
+}
+
+// sqlStore is the store of the jobs table.
+type sqlStore struct {
+	db *sql.DB
+}
+
+func (s sqlStore) claim(ctx context.Context, queue, worker string, lockTimeout time.Duration, limit int) (*Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if limit > 0 {
+		// Workers of the queue count its running jobs one at a time, so that they do not exceed the limit together.
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('jobs:' || $1))", queue); err != nil {
+			return nil, err
+		}
+		var running int
+		err := tx.QueryRowContext(ctx, "SELECT count(*) FROM jobs WHERE queue = $1 AND status = 'running' AND locked_at >= now() - make_interval(secs => $2)",
+			queue, lockTimeout.Seconds()).Scan(&running)
+		if err != nil {
+			return nil, err
+		}
+		if running >= limit {
+			return nil, nil
+		}
+	}
+
+	job := &Job{}
+	var checkpoint []byte
+	err = tx.QueryRowContext(ctx, ` + "`" + `
+		UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_by = $2, locked_at = now(), updated_at = now()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE queue = $1 AND (status = 'pending' AND run_at <= now() OR status = 'running' AND locked_at < now() - make_interval(secs => $3))
+			ORDER BY priority DESC, run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, queue, kind, payload, priority, attempts, checkpoint` + "`" + `, queue, worker, lockTimeout.Seconds(),
+	).Scan(&job.ID, &job.Queue, &job.Kind, &job.Payload, &job.Priority, &job.Attempts, &checkpoint)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.Checkpoint = checkpoint
+	return job, tx.Commit()
+}
+
+func (s sqlStore) complete(ctx context.Context, id int64, worker string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE jobs SET status = 'done', locked_by = NULL, finished_at = now(), updated_at = now() WHERE id = $1 AND locked_by = $2 AND status = 'running'", id, worker)
+	return err
+}
+
+func (s sqlStore) fail(ctx context.Context, id int64, worker string, retryAfter time.Duration, jobErr error) error {
+	_, err := s.db.ExecContext(ctx, ` + "`" + `
+		UPDATE jobs SET status = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'pending' END,
+			run_at = now() + make_interval(secs => $3), last_error = $4, locked_by = NULL, updated_at = now()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'` + "`" + `, id, worker, retryAfter.Seconds(), jobErr.Error())
+	return err
+}
+
+func (s sqlStore) requeue(ctx context.Context, id int64, worker string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE jobs SET status = 'pending', attempts = attempts - 1, locked_by = NULL, updated_at = now() WHERE id = $1 AND locked_by = $2 AND status = 'running'", id, worker)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (s sqlStore) checkpoint(ctx context.Context, id int64, worker string, data json.RawMessage) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE jobs SET checkpoint = $3, updated_at = now() WHERE id = $1 AND locked_by = $2 AND status = 'running'", id, worker, []byte(data))
+	return err
+}
+`
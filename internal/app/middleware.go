@@ -0,0 +1,681 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// DefaultMiddleware are the middleware of the servers of new apps used unless disabled in the configuration:
+// the others, gzip and CORS, are enabled by it.
+var DefaultMiddleware = []string{"request_id", "logging", "recovery"}
+
+// middlewareData is the configuration of the middleware of a new app, rendered as the Defaults of its
+// internal/middleware package.
+type middlewareData struct {
+	RequestID   bool
+	Logging     bool
+	Recovery    bool
+	Gzip        bool
+	CORSOrigins string
+}
+
+// newMiddlewareData returns the middleware of a new app configured by cfg.
+func newMiddlewareData(cfg config.MiddlewareConfig) (middlewareData, error) {
+	enabled := make(map[string]bool)
+	for _, name := range DefaultMiddleware {
+		enabled[name] = true
+	}
+	for _, name := range cfg.Disable {
+		if !enabled[name] {
+			return middlewareData{}, fmt.Errorf("invalid server.middleware.disable entry %q: use one of %s", name, strings.Join(DefaultMiddleware, ", "))
+		}
+		enabled[name] = false
+	}
+	origins := make([]string, len(cfg.CORSOrigins))
+	for i, origin := range cfg.CORSOrigins {
+		origins[i] = fmt.Sprintf("%q", origin)
+	}
+	return middlewareData{
+		RequestID:   enabled["request_id"],
+		Logging:     enabled["logging"],
+		Recovery:    enabled["recovery"],
+		Gzip:        cfg.Gzip,
+		CORSOrigins: strings.Join(origins, ", "),
+	}, nil
+}
+
+// middlewareTemplate is the internal/middleware package of a new app, wrapping the handlers of its server.
+// Like preflightTemplate, it only uses the standard library.
+const middlewareTemplate = `// Package middleware wraps the handlers of the {{.Name}} server with cross-cutting concerns: request IDs,
+// access logs, recovery from panics, CORS, read-only mode, gzip compression and the recording of requests. New
+// returns the chain configured by Config,
+// and Use adds the app's own middleware to it:
+//
+//	chain := middleware.New(middleware.FromEnv(os.Getenv), log.Printf)
+//	chain.Use(a.Middleware) // a from auth.New
+//	server.Handler = chain.Then(mux)
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a handler.
+type Middleware func(http.Handler) http.Handler
+
+// Chain is a list of middleware wrapping a handler, the first one outermost.
+type Chain struct {
+	middleware []Middleware
+}
+
+// Use appends middleware to the chain, which run after, inside, the middleware already in it.
+func (c *Chain) Use(middleware ...Middleware) {
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// Then returns handler wrapped by the middleware of the chain.
+func (c *Chain) Then(handler http.Handler) http.Handler {
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		handler = c.middleware[i](handler)
+	}
+	return handler
+}
+
+// Names returns the names of the middleware of the chain, outermost first, see FuncName.
+func (c *Chain) Names() []string {
+	names := make([]string, len(c.middleware))
+	for i, m := range c.middleware {
+		names[i] = FuncName(m)
+	}
+	return names
+}
+
+// FuncName returns the name of a function, such as a middleware or a handler, qualified by its package name:
+// "middleware.RequestID" for RequestID, and "middleware.Logging" for the middleware Logging returns.
+func FuncName(fn interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	name = strings.TrimSuffix(name[strings.LastIndex(name, "/")+1:], "-fm")
+	// Closures are named after the function declaring them, e.g. middleware.Logging.func1.2.
+	for {
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			return name
+		}
+		suffix := strings.TrimPrefix(name[i+1:], "func")
+		if suffix == "" || strings.Trim(suffix, "0123456789") != "" {
+			return name
+		}
+		name = name[:i]
+	}
+}
+
+// Config selects the middleware of the chain returned by New.
+type Config struct {
+	RequestID bool
+	Logging   bool
+	Recovery  bool
+	Gzip      bool
+	// CORSOrigins are the origins allowed to call the server from browsers, "*" for any; CORS is disabled
+	// when empty.
+	CORSOrigins []string
+	// RecordDir is the directory Record writes the requests served to, for "grayv-lsm api replay"; requests
+	// are not recorded when empty. Only set it in development and staging.
+	RecordDir string
+	// ReadOnly answers the requests that may write, see ReadOnly, with ReadOnlyMessage, or
+	// DefaultReadOnlyMessage when empty, during maintenance windows and incidents, except those of the paths
+	// of ReadOnlyAllow, such as a login endpoint that only reads.
+	ReadOnly        bool
+	ReadOnlyMessage string
+	ReadOnlyAllow   []string
+}
+
+// Defaults is the configuration chosen when {{.Name}} was scaffolded, from the server.middleware section of
+// the grayv-lsm configuration.
+var Defaults = Config{
+	RequestID:   {{.Middleware.RequestID}},
+	Logging:     {{.Middleware.Logging}},
+	Recovery:    {{.Middleware.Recovery}},
+	Gzip:        {{.Middleware.Gzip}},
+	CORSOrigins: []string{ {{- .Middleware.CORSOrigins -}} },
+}
+
+// FromEnv returns Defaults overridden by the environment: MIDDLEWARE_DISABLE and MIDDLEWARE_ENABLE list the
+// middleware to disable or enable, separated by commas, among request_id, logging, recovery and gzip, and
+// CORS_ORIGINS lists the origins allowed by CORS, "none" to disable it. RECORD_DIR sets RecordDir, READ_ONLY,
+// a boolean such as true or 1, which also makes the generated repositories read-only, sets ReadOnly,
+// READ_ONLY_MESSAGE sets ReadOnlyMessage, and READ_ONLY_ALLOW lists the paths of ReadOnlyAllow, separated by
+// commas.
+func FromEnv(getenv func(string) string) Config {
+	cfg := Defaults
+	for _, name := range split(getenv("MIDDLEWARE_DISABLE")) {
+		cfg.set(name, false)
+	}
+	for _, name := range split(getenv("MIDDLEWARE_ENABLE")) {
+		cfg.set(name, true)
+	}
+	if origins := getenv("CORS_ORIGINS"); origins == "none" {
+		cfg.CORSOrigins = nil
+	} else if origins != "" {
+		cfg.CORSOrigins = split(origins)
+	}
+	cfg.RecordDir = getenv("RECORD_DIR")
+	cfg.ReadOnly, _ = strconv.ParseBool(getenv("READ_ONLY"))
+	cfg.ReadOnlyMessage = getenv("READ_ONLY_MESSAGE")
+	cfg.ReadOnlyAllow = split(getenv("READ_ONLY_ALLOW"))
+	return cfg
+}
+
+// set enables or disables the named middleware.
+func (c *Config) set(name string, on bool) {
+	switch name {
+	case "request_id":
+		c.RequestID = on
+	case "logging":
+		c.Logging = on
+	case "recovery":
+		c.Recovery = on
+	case "gzip":
+		c.Gzip = on
+	}
+}
+
+func split(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// New returns the chain of the middleware enabled by cfg, in this order: RequestID, Logging, Recovery, CORS,
+// ReadOnly, Gzip and Record. Logs are written with logf.
+func New(cfg Config, logf func(format string, args ...interface{})) *Chain {
+	chain := &Chain{}
+	if cfg.RequestID {
+		chain.Use(RequestID)
+	}
+	if cfg.Logging {
+		chain.Use(Logging(logf))
+	}
+	if cfg.Recovery {
+		chain.Use(Recovery(logf))
+	}
+	if len(cfg.CORSOrigins) > 0 {
+		chain.Use(CORS(cfg.CORSOrigins))
+	}
+	if cfg.ReadOnly {
+		chain.Use(ReadOnly(cfg.ReadOnlyMessage, cfg.ReadOnlyAllow...))
+	}
+	if cfg.Gzip {
+		chain.Use(Gzip)
+	}
+	if cfg.RecordDir != "" {
+		chain.Use(Record(cfg.RecordDir, logf))
+	}
+	return chain
+}
+
+// RequestIDHeader is the header carrying the ID of a request.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID gives every request an ID, the one in its X-Request-ID header when it is set by a proxy, or a
+// random one, which is returned in the X-Request-ID header of the response and by RequestIDFrom.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID reports whether an ID received from a client is safe to log and return.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFrom returns the ID of the request of ctx, set by RequestID, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// responseWriter records the status and size of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Logging logs every request with logf once served: its method, path, status, size, duration and ID.
+func Logging(logf func(format string, args ...interface{})) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := &responseWriter{ResponseWriter: w}
+			defer func() {
+				status := rw.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				logf("%s %s %d %dB %s id=%s", r.Method, r.URL.Path, status, rw.size, time.Since(start).Round(time.Microsecond), RequestIDFrom(r.Context()))
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// Recovery answers 500 Internal Server Error to the requests whose handler panics, and logs the panic with
+// its stack, instead of closing the connection.
+func Recovery(logf func(format string, args ...interface{})) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if p := recover(); p != nil {
+					if p == http.ErrAbortHandler {
+						panic(p)
+					}
+					logf("panic serving %s %s id=%s: %v\n%s", r.Method, r.URL.Path, RequestIDFrom(r.Context()), p, debug.Stack())
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORS lets the given origins, or any origin with "*", call the server from browsers, and answers their
+// preflight requests.
+func CORS(origins []string) Middleware {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !allowed["*"] && !allowed[origin] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DefaultReadOnlyMessage is the message ReadOnly answers with when none is configured.
+const DefaultReadOnlyMessage = "{{.Name}} is read-only for maintenance, please retry later"
+
+// ReadOnlyRetryAfter is the number of seconds ReadOnly asks clients to wait before retrying, in the
+// Retry-After header of its responses.
+var ReadOnlyRetryAfter = 120
+
+// ReadOnly answers 503 Service Unavailable, with message or DefaultReadOnlyMessage, to the requests that may
+// write: those of other methods than GET, HEAD and OPTIONS, except those of the allowed paths. Reads are served
+// as usual.
+func ReadOnly(message string, allow ...string) Middleware {
+	if message == "" {
+		message = DefaultReadOnlyMessage
+	}
+	allowed := make(map[string]bool, len(allow))
+	for _, path := range allow {
+		allowed[path] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if allowed[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(ReadOnlyRetryAfter))
+			http.Error(w, message, http.StatusServiceUnavailable)
+		})
+	}
+}
+
+// gzipWriter compresses the body of a response.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.Header().Get("Content-Encoding") == "" && status != http.StatusNoContent && status != http.StatusNotModified {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Del("Content-Length")
+			w.gz = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Gzip compresses the responses of the requests accepting gzip, except those already encoded.
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer func() {
+			if gw.gz != nil {
+				gw.gz.Close()
+			}
+		}()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// MaxRecordedBody is the number of bytes of a request or response body Record keeps; longer bodies are
+// truncated in the recording, but served in full.
+var MaxRecordedBody = 1 << 20
+
+// Redacted replaces the values of credentials in recordings: those of the Authorization, Cookie, Set-Cookie
+// and X-Api-Key headers, and those of query parameters, form fields and JSON body fields whose name contains
+// password, token, secret or api_key.
+const Redacted = "[REDACTED]"
+
+// Recording is a request served by the server and its response, as written by Record.
+type Recording struct {
+	ID        string           ` + "`" + `json:"id"` + "`" + `
+	Time      time.Time        ` + "`" + `json:"time"` + "`" + `
+	Method    string           ` + "`" + `json:"method"` + "`" + `
+	URL       string           ` + "`" + `json:"url"` + "`" + `
+	Header    http.Header      ` + "`" + `json:"header"` + "`" + `
+	Body      string           ` + "`" + `json:"body,omitempty"` + "`" + `
+	Truncated bool             ` + "`" + `json:"truncated,omitempty"` + "`" + `
+	Response  RecordedResponse ` + "`" + `json:"response"` + "`" + `
+}
+
+// RecordedResponse is the response of a Recording.
+type RecordedResponse struct {
+	Status    int           ` + "`" + `json:"status"` + "`" + `
+	Header    http.Header   ` + "`" + `json:"header"` + "`" + `
+	Body      string        ` + "`" + `json:"body,omitempty"` + "`" + `
+	Truncated bool          ` + "`" + `json:"truncated,omitempty"` + "`" + `
+	Duration  time.Duration ` + "`" + `json:"duration"` + "`" + `
+}
+
+// recordWriter keeps the status, headers and first bytes of a response.
+type recordWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *recordWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	keep := MaxRecordedBody - w.body.Len()
+	if keep < len(b) {
+		w.truncated = true
+	} else {
+		keep = len(b)
+	}
+	w.body.Write(b[:keep])
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *recordWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Record writes every request served, with its response, to a JSON file of dir named after its time and ID,
+// which "grayv-lsm api replay" sends again to another server. Credentials are redacted, see Redacted, and
+// failures to write a recording are logged with logf, the request being served regardless.
+func Record(dir string, logf func(format string, args ...interface{})) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			body, err := io.ReadAll(io.LimitReader(r.Body, int64(MaxRecordedBody)+1))
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			truncated := len(body) > MaxRecordedBody
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if truncated {
+				body = body[:MaxRecordedBody]
+			}
+
+			rw := &recordWriter{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+
+			id := RequestIDFrom(r.Context())
+			if id == "" {
+				b := make([]byte, 8)
+				rand.Read(b)
+				id = hex.EncodeToString(b)
+			}
+			recording := Recording{
+				ID:        id,
+				Time:      start.UTC(),
+				Method:    r.Method,
+				URL:       redactURL(r.URL),
+				Header:    redactHeader(r.Header),
+				Body:      redactBody(r.Header.Get("Content-Type"), body),
+				Truncated: truncated,
+				Response: RecordedResponse{
+					Status:    rw.status,
+					Header:    redactHeader(rw.Header()),
+					Body:      redactBody(rw.Header().Get("Content-Type"), rw.body.Bytes()),
+					Truncated: rw.truncated,
+					Duration:  time.Since(start),
+				},
+			}
+			if err := writeRecording(dir, recording); err != nil {
+				logf("failed to record %s %s id=%s: %v", r.Method, r.URL.Path, id, err)
+			}
+		})
+	}
+}
+
+// writeRecording writes a recording to a new file of dir.
+func writeRecording(dir string, recording Recording) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.json", recording.Time.Format("20060102T150405.000000000"), filepath.Base(recording.ID))
+	return os.WriteFile(filepath.Join(dir, name), data, 0o600)
+}
+
+// sensitive reports whether a header, parameter or field of the given name holds a credential.
+func sensitive(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie":
+		return true
+	}
+	name = strings.ReplaceAll(name, "-", "_")
+	for _, word := range []string{"password", "token", "secret", "api_key", "apikey"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name := range redacted {
+		if sensitive(name) {
+			redacted[name] = []string{Redacted}
+		}
+	}
+	return redacted
+}
+
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	query := u.Query()
+	redactValues(query)
+	return u.EscapedPath() + "?" + query.Encode()
+}
+
+func redactValues(values url.Values) {
+	for name := range values {
+		if sensitive(name) {
+			values[name] = []string{Redacted}
+		}
+	}
+}
+
+// redactBody returns a body as text, with the credentials of JSON and form bodies redacted.
+func redactBody(contentType string, body []byte) string {
+	switch {
+	case strings.Contains(contentType, "json"):
+		var value interface{}
+		if json.Unmarshal(body, &value) != nil {
+			return string(body)
+		}
+		redacted, err := json.Marshal(redactJSON(value))
+		if err != nil {
+			return string(body)
+		}
+		return string(redacted)
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return string(body)
+		}
+		redactValues(values)
+		return values.Encode()
+	}
+	return string(body)
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			if sensitive(name) {
+				v[name] = Redacted
+			} else {
+				v[name] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+	}
+	return value
+}
+`
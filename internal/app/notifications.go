@@ -0,0 +1,385 @@
+package app
+
+// notificationsTemplate is the internal/notifications package of a new app, sending templated messages by
+// email, SMS and webhook, logged in the notification_log table created by "db migrate". Like
+// preflightTemplate, it only uses the standard library.
+const notificationsTemplate = `// Package notifications sends the notifications of {{.Name}}: messages rendered from templates, delivered
+// by email, SMS or webhook, retried when delivery fails, and never sent to suppressed recipients, such as the
+// addresses that bounced. Every notification is recorded in the notification_log table created by
+// "grayv-lsm db migrate", for deliverability audits.
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Message is a rendered notification.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Channel delivers messages. Its errors are retried unless they are Permanent or Undeliverable.
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type permanentError struct {
+	err           error
+	undeliverable bool
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error of a channel that retrying cannot fix, such as a rejected request.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Undeliverable marks an error of a channel telling that the recipient does not exist, such as a bounce. The
+// recipient is then suppressed.
+func Undeliverable(err error) error {
+	return &permanentError{err: err, undeliverable: true}
+}
+
+// ErrSuppressed is returned by Send for suppressed recipients.
+var ErrSuppressed = errors.New("notifications: recipient suppressed")
+
+// Statuses of the notifications in notification_log.
+const (
+	StatusSent       = "sent"
+	StatusFailed     = "failed"
+	StatusSuppressed = "suppressed"
+)
+
+// Options configure a Notifier. Zero values select the defaults.
+type Options struct {
+	// Attempts is the number of times a message is sent before giving up, 3 by default.
+	Attempts int
+	// Backoff is the delay before the second attempt, doubled before each of the next ones, 1s by default.
+	Backoff time.Duration
+	// Logf logs the failed attempts, if set.
+	Logf func(format string, args ...interface{})
+}
+
+// Notifier renders notifications and sends them through its channels.
+type Notifier struct {
+	store     store
+	options   Options
+	channels  map[string]Channel
+	templates map[string]*notificationTemplate
+}
+
+type notificationTemplate struct {
+	subject, body *template.Template
+}
+
+// New creates a notifier recording its notifications in db.
+func New(db *sql.DB, options Options) *Notifier {
+	return newNotifier(sqlStore{db}, options)
+}
+
+func newNotifier(s store, options Options) *Notifier {
+	if options.Attempts <= 0 {
+		options.Attempts = 3
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = time.Second
+	}
+	return &Notifier{store: s, options: options, channels: make(map[string]Channel), templates: make(map[string]*notificationTemplate)}
+}
+
+// AddChannel registers a channel under a name, such as "email".
+func (n *Notifier) AddChannel(name string, channel Channel) {
+	n.channels[name] = channel
+}
+
+// AddTemplate registers the template of a notification: the text/template sources of its subject and body,
+// rendered with the data given to Send.
+func (n *Notifier) AddTemplate(name, subject, body string) error {
+	subjectTemplate, err := template.New(name + ".subject").Option("missingkey=error").Parse(subject)
+	if err != nil {
+		return err
+	}
+	bodyTemplate, err := template.New(name + ".body").Option("missingkey=error").Parse(body)
+	if err != nil {
+		return err
+	}
+	n.templates[name] = &notificationTemplate{subject: subjectTemplate, body: bodyTemplate}
+	return nil
+}
+
+// Render renders the message of a template for a recipient.
+func (n *Notifier) Render(name, to string, data interface{}) (Message, error) {
+	t, ok := n.templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("notifications: no template %q", name)
+	}
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: strings.TrimSpace(subject.String()), Body: body.String()}, nil
+}
+
+// Send renders a template for a recipient and sends it through a channel, retrying failed attempts, and
+// records the outcome in notification_log. It returns ErrSuppressed, without sending anything, if the
+// recipient is suppressed on the channel, and suppresses recipients the channel finds Undeliverable.
+func (n *Notifier) Send(ctx context.Context, channelName, to, templateName string, data interface{}) error {
+	channel, ok := n.channels[channelName]
+	if !ok {
+		return fmt.Errorf("notifications: no channel %q", channelName)
+	}
+	msg, err := n.Render(templateName, to, data)
+	if err != nil {
+		return err
+	}
+	entry := logEntry{Channel: channelName, Recipient: to, Template: templateName, Subject: msg.Subject}
+
+	suppressed, err := n.store.suppressed(ctx, channelName, to)
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		entry.Status = StatusSuppressed
+		return errors.Join(ErrSuppressed, n.store.log(ctx, entry))
+	}
+
+	backoff := n.options.Backoff
+	for entry.Attempts < n.options.Attempts {
+		if entry.Attempts > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				err = errors.Join(err, ctx.Err())
+				break
+			}
+		}
+		entry.Attempts++
+		if err = channel.Send(ctx, msg); err == nil {
+			break
+		}
+		if n.options.Logf != nil {
+			n.options.Logf("notifications: attempt %d to send %s to %s by %s failed: %v", entry.Attempts, templateName, to, channelName, err)
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			if permanent.undeliverable {
+				if suppressErr := n.store.suppress(ctx, channelName, to, err.Error()); suppressErr != nil {
+					err = errors.Join(err, suppressErr)
+				}
+			}
+			break
+		}
+	}
+
+	entry.Status = StatusSent
+	if err != nil {
+		entry.Status, entry.LastError = StatusFailed, err.Error()
+	}
+	// The outcome is recorded even when ctx is canceled.
+	logCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	return errors.Join(err, n.store.log(logCtx, entry))
+}
+
+// Suppress stops sending notifications to a recipient on a channel, for the given reason, e.g. an
+// unsubscription.
+func (n *Notifier) Suppress(ctx context.Context, channel, to, reason string) error {
+	return n.store.suppress(ctx, channel, to, reason)
+}
+
+// Unsuppress sends notifications to a suppressed recipient again.
+func (n *Notifier) Unsuppress(ctx context.Context, channel, to string) error {
+	return n.store.unsuppress(ctx, channel, to)
+}
+
+// logEntry is a row of notification_log.
+type logEntry struct {
+	Channel, Recipient, Template, Subject string
+	Status                                string
+	Attempts                              int
+	LastError                             string
+}
+
+// store holds the suppression list and the notification log.
+type store interface {
+	suppressed(ctx context.Context, channel, to string) (bool, error)
+	suppress(ctx context.Context, channel, to, reason string) error
+	unsuppress(ctx context.Context, channel, to string) error
+	log(ctx context.Context, entry logEntry) error
+}
+
+// sqlStore is the store of the notification_log and notification_suppressions tables.
+type sqlStore struct {
+	db *sql.DB
+}
+
+func (s sqlStore) suppressed(ctx context.Context, channel, to string) (bool, error) {
+	var suppressed bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM notification_suppressions WHERE channel = $1 AND recipient = $2)", channel, to).Scan(&suppressed)
+	return suppressed, err
+}
+
+func (s sqlStore) suppress(ctx context.Context, channel, to, reason string) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO notification_suppressions (channel, recipient, reason) VALUES ($1, $2, $3) ON CONFLICT (channel, recipient) DO UPDATE SET reason = EXCLUDED.reason", channel, to, reason)
+	return err
+}
+
+func (s sqlStore) unsuppress(ctx context.Context, channel, to string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM notification_suppressions WHERE channel = $1 AND recipient = $2", channel, to)
+	return err
+}
+
+func (s sqlStore) log(ctx context.Context, e logEntry) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO notification_log (channel, recipient, template, subject, status, attempts, last_error, sent_at) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), CASE WHEN $8 THEN now() END)",
+		e.Channel, e.Recipient, e.Template, e.Subject, e.Status, e.Attempts, e.LastError, e.Status == StatusSent)
+	return err
+}
+
+// Email sends messages as plain text emails through an SMTP server.
+type Email struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	From string
+	// Auth authenticates to the server, if set, e.g. smtp.PlainAuth.
+	Auth smtp.Auth
+}
+
+// Send implements Channel. Rejected recipients (SMTP 550 to 553) are Undeliverable, and other 5xx replies
+// Permanent.
+func (e *Email) Send(ctx context.Context, msg Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", e.From, msg.To, msg.Subject)
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	err := smtp.SendMail(e.Addr, e.Auth, e.From, []string{msg.To}, []byte(b.String()))
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		switch {
+		case reply.Code >= 550 && reply.Code <= 553:
+			return Undeliverable(err)
+		case reply.Code >= 500:
+			return Permanent(err)
+		}
+	}
+	return err
+}
+
+// Webhook posts messages as JSON objects with to, subject and body fields to a URL.
+type Webhook struct {
+	URL string
+	// Secret, if set, signs the body of the requests: their X-Signature header is the hex-encoded
+	// HMAC-SHA256 of the body with the secret.
+	Secret string
+	Client *http.Client
+}
+
+// Send implements Channel. Responses 4xx, except 408 and 429, are Permanent.
+func (h *Webhook) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]string{"to": msg.To, "subject": msg.Subject, "body": msg.Body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+	return do(h.Client, req)
+}
+
+// SMS sends the body of messages as text messages through an HTTP gateway, posting the form fields To, From
+// and Body, as the messages API of Twilio expects, with basic authentication.
+type SMS struct {
+	URL                string
+	From               string
+	Username, Password string
+	Client             *http.Client
+}
+
+// Send implements Channel. Responses 4xx, except 408 and 429, are Permanent.
+func (s *SMS) Send(ctx context.Context, msg Message) error {
+	form := url.Values{"To": {msg.To}, "From": {s.From}, "Body": {msg.Body}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	return do(s.Client, req)
+}
+
+// do sends a request, and returns an error for responses other than 2xx.
+func do(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// ChannelsFromEnv returns the channels configured by the environment, by name:
+//   - "email" when SMTP_ADDR is set, sending from SMTP_FROM, authenticated with SMTP_USERNAME and
+//     SMTP_PASSWORD when set
+//   - "sms" when SMS_URL is set, sending from SMS_FROM, authenticated with SMS_USERNAME and SMS_PASSWORD
+//   - "webhook" when WEBHOOK_URL is set, signed with WEBHOOK_SECRET when set
+func ChannelsFromEnv(getenv func(string) string) map[string]Channel {
+	channels := make(map[string]Channel)
+	if addr := getenv("SMTP_ADDR"); addr != "" {
+		email := &Email{Addr: addr, From: getenv("SMTP_FROM")}
+		if username := getenv("SMTP_USERNAME"); username != "" {
+			host, _, _ := strings.Cut(addr, ":")
+			email.Auth = smtp.PlainAuth("", username, getenv("SMTP_PASSWORD"), host)
+		}
+		channels["email"] = email
+	}
+	if u := getenv("SMS_URL"); u != "" {
+		channels["sms"] = &SMS{URL: u, From: getenv("SMS_FROM"), Username: getenv("SMS_USERNAME"), Password: getenv("SMS_PASSWORD")}
+	}
+	if u := getenv("WEBHOOK_URL"); u != "" {
+		channels["webhook"] = &Webhook{URL: u, Secret: getenv("WEBHOOK_SECRET")}
+	}
+	return channels
+}
+`
@@ -0,0 +1,284 @@
+package app
+
+// preflightTemplate is the internal/preflight package of a new app, which the serve command of internal/cli runs
+// before binding its port. It only uses the standard library; checking the database requires a database
+// driver, which the command line imports for postgres.
+const preflightTemplate = `// Package preflight checks that {{.Name}} is ready to serve before it binds its port: that its configuration
+// is valid, its database reachable and migrated, and the clocks of the server and the database agree. A failed
+// check stops the server with what to do about it, instead of serving errors.
+package preflight
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checks are the names of the checks, in the order they run.
+var Checks = []string{"config", "database", "migrations", "clock"}
+
+// Config configures the checks. FromEnv reads it from the environment variables named below.
+type Config struct {
+	// Enabled runs the checks; PREFLIGHT=off disables them.
+	Enabled bool
+	// Checks are the names of the checks to run (PREFLIGHT_CHECKS, comma-separated), all of them by default.
+	Checks []string
+	// Port is the port the server listens on (PORT).
+	Port string
+	// DatabaseDriver and DatabaseURL open the database (DATABASE_DRIVER, "postgres" by default, and
+	// DATABASE_URL). Without a URL, the checks of the database are skipped.
+	DatabaseDriver string
+	DatabaseURL    string
+	// MigrationsDir holds the migrations the database must have applied (MIGRATIONS_DIR).
+	MigrationsDir string
+	// MaxClockSkew is how far the clock of the database may be from the server's (PREFLIGHT_MAX_CLOCK_SKEW).
+	MaxClockSkew time.Duration
+	// Timeout bounds the time all the checks take (PREFLIGHT_TIMEOUT).
+	Timeout time.Duration
+
+	// problems are the environment variables FromEnv could not read, reported by the config check.
+	problems []Failure
+}
+
+// FromEnv reads the configuration of the checks from the environment.
+func FromEnv(getenv func(string) string) Config {
+	cfg := Config{
+		Enabled:        !strings.EqualFold(getenv("PREFLIGHT"), "off"),
+		Checks:         Checks,
+		Port:           getenv("PORT"),
+		DatabaseDriver: getenv("DATABASE_DRIVER"),
+		DatabaseURL:    getenv("DATABASE_URL"),
+		MigrationsDir:  getenv("MIGRATIONS_DIR"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+	if cfg.DatabaseDriver == "" {
+		cfg.DatabaseDriver = "postgres"
+	}
+	if cfg.MigrationsDir == "" {
+		cfg.MigrationsDir = "migrations"
+	}
+	if checks := getenv("PREFLIGHT_CHECKS"); checks != "" {
+		cfg.Checks = nil
+		for _, name := range strings.Split(checks, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cfg.Checks = append(cfg.Checks, name)
+			}
+		}
+	}
+	cfg.MaxClockSkew = cfg.duration(getenv, "PREFLIGHT_MAX_CLOCK_SKEW", 2*time.Second)
+	cfg.Timeout = cfg.duration(getenv, "PREFLIGHT_TIMEOUT", 5*time.Second)
+	return cfg
+}
+
+// duration reads a duration from the environment, or returns fallback if it is unset or invalid.
+func (c *Config) duration(getenv func(string) string, name string, fallback time.Duration) time.Duration {
+	value := getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		c.problems = append(c.problems, Failure{"config", fmt.Sprintf("%s=%q is not a positive duration", name, value), "set it to a duration such as 2s or 500ms"})
+		return fallback
+	}
+	return d
+}
+
+// Failure is a failed check, with what to do about it.
+type Failure struct {
+	Check   string
+	Problem string
+	Fix     string
+}
+
+// failure returns the failure of a check.
+func failure(check, problem, fix string) []Failure {
+	return []Failure{Failure{Check: check, Problem: problem, Fix: fix}}
+}
+
+// Error is the error of the checks that failed.
+type Error struct {
+	Failures []Failure
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d preflight check(s) failed:", len(e.Failures))
+	for _, f := range e.Failures {
+		fmt.Fprintf(&b, "\n  %s: %s\n    fix: %s", f.Check, f.Problem, f.Fix)
+	}
+	return b.String()
+}
+
+// Run runs the checks, logging their outcome with logf, and returns an *Error listing the checks that failed.
+// The checks of the database are skipped without a database URL, and when the database is unreachable.
+func Run(ctx context.Context, cfg Config, logf func(format string, args ...interface{})) error {
+	if !cfg.Enabled {
+		logf("preflight: disabled")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	var db *sql.DB
+	var dbFailure *Failure
+	if cfg.DatabaseURL != "" && needsDatabase(cfg.Checks) {
+		db, dbFailure = openDatabase(ctx, cfg)
+		if db != nil {
+			defer db.Close()
+		}
+	}
+
+	var failures []Failure
+	for _, name := range cfg.Checks {
+		var failed []Failure
+		switch {
+		case name == "config":
+			failed = checkConfig(cfg)
+		case name != "database" && name != "migrations" && name != "clock":
+			failed = failure("config", fmt.Sprintf("unknown check %q in PREFLIGHT_CHECKS", name), "use "+strings.Join(Checks, ", "))
+		case cfg.DatabaseURL == "":
+			logf("preflight: %s skipped, DATABASE_URL is not set", name)
+			continue
+		case name == "database":
+			if dbFailure != nil {
+				failed = []Failure{*dbFailure}
+			}
+		case db == nil:
+			logf("preflight: %s skipped, the database is unreachable", name)
+			continue
+		case name == "migrations":
+			failed = checkMigrations(ctx, db, cfg.MigrationsDir)
+		case name == "clock":
+			failed = checkClock(ctx, db, cfg.MaxClockSkew)
+		}
+		if len(failed) == 0 {
+			logf("preflight: %s ok", name)
+		}
+		failures = append(failures, failed...)
+	}
+	if len(failures) > 0 {
+		return &Error{Failures: failures}
+	}
+	return nil
+}
+
+// needsDatabase reports whether one of the checks reads the database.
+func needsDatabase(checks []string) bool {
+	for _, name := range checks {
+		if name == "database" || name == "migrations" || name == "clock" {
+			return true
+		}
+	}
+	return false
+}
+
+func checkConfig(cfg Config) []Failure {
+	failures := append([]Failure(nil), cfg.problems...)
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		failures = append(failures, Failure{"config", fmt.Sprintf("PORT=%q is not a valid port", cfg.Port), "set PORT to a number between 1 and 65535"})
+	}
+	return failures
+}
+
+// openDatabase opens the database and checks that it is reachable.
+func openDatabase(ctx context.Context, cfg Config) (*sql.DB, *Failure) {
+	db, err := sql.Open(cfg.DatabaseDriver, cfg.DatabaseURL)
+	if err != nil {
+		return nil, &Failure{"database", err.Error(), fmt.Sprintf("import the %s driver in internal/cli/cli.go, or set DATABASE_DRIVER", cfg.DatabaseDriver)}
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, &Failure{"database", "cannot reach the database: " + err.Error(), "start the database (grayv-lsm db start) and check DATABASE_URL"}
+	}
+	return db, nil
+}
+
+// checkMigrations checks that the database applied the migrations of dir, recorded in its migrations table.
+func checkMigrations(ctx context.Context, db *sql.DB, dir string) []Failure {
+	applied := make(map[int64]bool)
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return failure("migrations", "cannot read the applied migrations: "+err.Error(), "check that the database is Postgres and DATABASE_URL's user can read it")
+	}
+	if exists {
+		rows, err := db.QueryContext(ctx, "SELECT version FROM migrations")
+		if err != nil {
+			return failure("migrations", "cannot read the applied migrations: "+err.Error(), "check that DATABASE_URL's user can read the migrations table")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int64
+			if err := rows.Scan(&version); err != nil {
+				return failure("migrations", "cannot read the applied migrations: "+err.Error(), "check the migrations table")
+			}
+			applied[version] = true
+		}
+	}
+
+	pending, err := pendingMigrations(dir, applied)
+	if err != nil {
+		return failure("migrations", err.Error(), "set MIGRATIONS_DIR to the migrations directory, or start the server from the app directory")
+	}
+	if len(pending) > 0 {
+		return failure("migrations", fmt.Sprintf("%d migration(s) not applied: %s", len(pending), strings.Join(pending, ", ")), "apply them (grayv-lsm db migrate) before starting the server")
+	}
+	return nil
+}
+
+// pendingMigrations returns the names of the migration files of dir, named <version>_<name>.sql, whose
+// version is not applied, ordered by version.
+func pendingMigrations(dir string, applied map[int64]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the migrations: %w", err)
+	}
+	versions := make(map[string]int64)
+	var pending []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", entry.Name())
+		}
+		if !applied[version] {
+			versions[entry.Name()] = version
+			pending = append(pending, entry.Name())
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return versions[pending[i]] < versions[pending[j]] })
+	return pending, nil
+}
+
+// checkClock checks that the clock of the database is within maxSkew of the server's.
+func checkClock(ctx context.Context, db *sql.DB, maxSkew time.Duration) []Failure {
+	start := time.Now()
+	var dbNow time.Time
+	if err := db.QueryRowContext(ctx, "SELECT now()").Scan(&dbNow); err != nil {
+		return failure("clock", "cannot read the clock of the database: "+err.Error(), "check that the database is Postgres")
+	}
+	end := time.Now()
+
+	// The database read its clock about half-way through the round trip.
+	skew := dbNow.Sub(start.Add(end.Sub(start) / 2))
+	direction := "ahead of"
+	if skew < 0 {
+		skew, direction = -skew, "behind"
+	}
+	if skew > maxSkew {
+		return failure("clock", fmt.Sprintf("the database clock is %s %s the server's", skew.Round(time.Millisecond), direction), "synchronize the clocks with NTP, or raise PREFLIGHT_MAX_CLOCK_SKEW")
+	}
+	return nil
+}
+`
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"text/template"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+// appNamePattern matches the names of apps: they are used in the module path, the database name and the
+// container name of the app.
+var appNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// scaffoldFile is a file of a new app, rendered from a template with the app's scaffoldData.
+type scaffoldFile struct {
+	Path     string
+	Template string
+}
+
+// scaffoldData is the data the templates of scaffoldFiles are rendered with.
+type scaffoldData struct {
+	Name           string
+	Module         string
+	Middleware     middlewareData
+	LibraryVersion string
+	LibraryDir     string
+}
+
+// Options configure the code of a new app. Zero values select the defaults.
+type Options struct {
+	// Middleware configures the middleware chain of the app's server.
+	Middleware config.MiddlewareConfig
+	// LibraryVersion is the version of grayv-lsm the command line of the app requires. When empty, the go.mod
+	// of the app has no requirements, and "go mod tidy" adds them.
+	LibraryVersion string
+	// LibraryDir, when set, replaces grayv-lsm with the module in that directory, such as a checkout of it.
+	LibraryDir string
+}
+
+// scaffoldFiles are the files of a new app, by path relative to the app directory. Empty directories hold a
+// .gitkeep file so they are kept in version control.
+var scaffoldFiles = []scaffoldFile{
+	{"go.mod", goModTemplate},
+	{"cmd/main.go", mainTemplate},
+	{"files.go", filesTemplate},
+	{"internal/cli/cli.go", cliTemplate},
+	{"internal/cli/jobs.go", cliJobsTemplate},
+	{"internal/handlers/handlers.go", `// Package handlers holds the HTTP handlers of {{.Name}}.
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"{{.Module}}/internal/middleware"
+)
+
+// Route is an HTTP route of {{.Name}}. Its pattern may start with a method, e.g. "GET /orders/{id}", and its
+// middleware, e.g. authentication, wrap its handler only, inside the middleware of the server.
+type Route struct {
+	Pattern     string
+	Handler     http.HandlerFunc
+	Description string
+	Middleware  []middleware.Middleware
+}
+
+// Routes lists the routes of {{.Name}}, registered by Register and listed by "{{.Name}} routes list".
+var Routes = []Route{
+	{Pattern: "GET /healthz", Handler: health, Description: "Reports that the server is up"},
+	{Pattern: "/", Handler: index, Description: "Welcome page"},
+}
+
+// Register registers the handlers of {{.Name}} on mux.
+func Register(mux *http.ServeMux) {
+	for _, route := range Routes {
+		mux.Handle(route.Pattern, route.Chain().Then(route.Handler))
+	}
+}
+
+// Method returns the method of the route, or "" if it matches every method.
+func (r Route) Method() string {
+	if method, _, found := strings.Cut(r.Pattern, " "); found {
+		return method
+	}
+	return ""
+}
+
+// Path returns the pattern of the route without its method.
+func (r Route) Path() string {
+	_, path, found := strings.Cut(r.Pattern, " ")
+	if !found {
+		return r.Pattern
+	}
+	return strings.TrimSpace(path)
+}
+
+// Chain returns the chain of the middleware of the route.
+func (r Route) Chain() *middleware.Chain {
+	chain := &middleware.Chain{}
+	chain.Use(r.Middleware...)
+	return chain
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
+
+func index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintln(w, "Welcome to {{.Name}}!")
+}
+`},
+	{"internal/preflight/preflight.go", preflightTemplate},
+	{"internal/jobs/jobs.go", jobsTemplate},
+	{"internal/middleware/middleware.go", middlewareTemplate},
+	{"internal/notifications/notifications.go", notificationsTemplate},
+	{"internal/server/server.go", serverTemplate},
+	{"internal/models/doc.go", `// Package models holds the models of {{.Name}} and their repositories, generated with
+// "grayv-lsm model generate --app {{.Name}}".
+package models
+`},
+	{"migrations/.gitkeep", ""},
+	{"seeds/.gitkeep", ""},
+	{"config.yaml", `# Configuration of grayv-lsm for {{.Name}}, read by the grayv-lsm commands run in this directory.
+database:
+  driver: postgres
+  host: localhost
+  port: 5432
+  user: postgres
+  password: postgres
+  name: {{.Name}}
+  sslmode: disable
+  containername: {{.Name}}-db
+server:
+  host: 0.0.0.0
+  port: 8080
+logging:
+  level: info
+`},
+	{".gitignore", "/bin/\n*.log\n.env\n"},
+	{"README.md", `# {{.Name}}
+
+Scaffolded with ` + "`grayv-lsm app new {{.Name}}`" + `.
+
+- ` + "`go run ./cmd`" + ` starts the server on :8080 (set ` + "`PORT`" + ` to change it). On SIGINT or SIGTERM, it stops accepting connections,
+  lets the requests in flight finish within ` + "`DRAIN_TIMEOUT`" + ` (10s by default), runs the stop hooks registered with
+  ` + "`srv.OnStop`" + ` and closes the database pool; ` + "`srv.OnStart`" + ` hooks run before the port is bound, see ` + "`internal/server`" + `.
+- The binary is also the command line of the app, see ` + "`internal/cli`" + `: ` + "`migrate`" + ` (` + "`status`" + `, ` + "`rollback`" + `) and ` + "`seed`" + ` apply the migrations
+  and seeds embedded into it, ` + "`worker`" + ` runs the jobs registered in ` + "`internal/cli/jobs.go`" + ` and ` + "`routes list`" + ` lists the routes of
+  ` + "`internal/handlers`" + `, so production containers only need ` + "`go build -o bin/{{.Name}} ./cmd`" + `. Run ` + "`go mod tidy`" + ` first if ` + "`go.mod`" + ` has
+  no requirements.
+- ` + "`grayv-lsm model generate --app {{.Name}}`" + `, run from the parent directory, writes models to ` + "`internal/models`" + `.
+- SQL migrations go in ` + "`migrations/`" + ` and seed files in ` + "`seeds/`" + `; ` + "`config.yaml`" + ` configures the database.
+- Before binding its port, the server runs the preflight checks of ` + "`internal/preflight`" + ` (configuration, database, pending
+  migrations, clock skew) and exits with what to fix if one fails. ` + "`DATABASE_URL`" + ` enables the database checks, which need a
+  driver (` + "`internal/cli`" + ` imports the ` + "`postgres`" + ` one); ` + "`PREFLIGHT_CHECKS`" + ` selects checks and ` + "`PREFLIGHT=off`" + ` disables them.
+- ` + "`internal/jobs`" + ` runs background jobs from the ` + "`jobs`" + ` table created by ` + "`grayv-lsm db migrate`" + `; workers drain on shutdown.
+- ` + "`internal/middleware`" + ` wraps the handlers with request IDs, access logs and recovery from panics, plus gzip and CORS when enabled;
+  ` + "`MIDDLEWARE_DISABLE`" + `, ` + "`MIDDLEWARE_ENABLE`" + ` and ` + "`CORS_ORIGINS`" + ` override the defaults, and ` + "`chain.Use`" + ` in ` + "`internal/cli/cli.go`" + ` adds more.
+- ` + "`READ_ONLY=true`" + ` answers writes with 503 and ` + "`READ_ONLY_MESSAGE`" + ` during maintenance, except on the paths of ` + "`READ_ONLY_ALLOW`" + `, and
+  makes the generated repositories fail writes with ` + "`models.ErrReadOnly`" + `.
+- ` + "`internal/notifications`" + ` sends templated emails, text messages and webhooks through the channels configured by ` + "`SMTP_*`" + `, ` + "`SMS_*`" + `
+  and ` + "`WEBHOOK_*`" + `, retrying failures, skipping suppressed recipients and logging deliveries to ` + "`notification_log`" + `.
+`},
+}
+
+// Scaffold writes the project layout of a new app to the <name>_grav directory of fsys: a Go module named
+// like the directory with an HTTP server in cmd/ that runs with "go run ./cmd" after the checks of
+// internal/preflight and shuts down gracefully with internal/server, the command line of internal/cli migrating
+// and seeding the database, running jobs and listing routes, internal/models for the generated models,
+// internal/handlers, internal/jobs, internal/middleware, internal/notifications, migrations/, seeds/, and the
+// grayv-lsm configuration of the app's database. It returns the paths of the files written, and fails if the directory exists.
+func Scaffold(fsys filesystem.FS, name string, options Options) ([]string, error) {
+	if !appNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid app name %q: use lowercase letters, digits and underscores, starting with a letter", name)
+	}
+	dir := name + "_grav"
+	if _, err := fsys.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		if err == nil {
+			return nil, fmt.Errorf("directory %s already exists", dir)
+		}
+		return nil, err
+	}
+
+	middleware, err := newMiddlewareData(options.Middleware)
+	if err != nil {
+		return nil, err
+	}
+	data := scaffoldData{Name: name, Module: dir, Middleware: middleware, LibraryVersion: options.LibraryVersion, LibraryDir: options.LibraryDir}
+	var written []string
+	for _, file := range scaffoldFiles {
+		tmpl, err := template.New(file.Path).Parse(file.Template)
+		if err != nil {
+			return written, err
+		}
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, data); err != nil {
+			return written, fmt.Errorf("failed to render %s: %w", file.Path, err)
+		}
+		filePath := path.Join(dir, file.Path)
+		if err := fsys.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			return written, fmt.Errorf("failed to create directory %s: %w", path.Dir(filePath), err)
+		}
+		if err := fsys.WriteFile(filePath, content.Bytes(), 0644); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+		written = append(written, filePath)
+	}
+	return written, nil
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+func TestScaffold(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	files, err := Scaffold(fsys, "shop", Options{})
+	assert.NoError(t, err)
+	assert.Contains(t, files, "shop_grav/cmd/main.go")
+	assert.Contains(t, files, "shop_grav/internal/preflight/preflight.go")
+	assert.Contains(t, files, "shop_grav/internal/jobs/jobs.go")
+	assert.Contains(t, files, "shop_grav/internal/middleware/middleware.go")
+	assert.Contains(t, files, "shop_grav/internal/notifications/notifications.go")
+	assert.Contains(t, files, "shop_grav/internal/server/server.go")
+	assert.Contains(t, files, "shop_grav/internal/cli/cli.go")
+	assert.Contains(t, files, "shop_grav/files.go")
+	assert.Contains(t, files, "shop_grav/migrations/.gitkeep")
+	assert.Contains(t, files, "shop_grav/seeds/.gitkeep")
+
+	goMod, err := fsys.ReadFile("shop_grav/go.mod")
+	assert.NoError(t, err)
+	assert.Equal(t, "module shop_grav\n\ngo 1.22\n", string(goMod))
+
+	data, err := fsys.ReadFile("shop_grav/config.yaml")
+	assert.NoError(t, err)
+	var cfg config.Config
+	assert.NoError(t, yaml.Unmarshal(data, &cfg))
+	assert.Equal(t, "shop", cfg.Database.Name)
+	assert.Equal(t, "shop-db", cfg.Database.ContainerName)
+	assert.Equal(t, 8080, cfg.Server.Port)
+
+	middleware, err := fsys.ReadFile("shop_grav/internal/middleware/middleware.go")
+	assert.NoError(t, err)
+	assert.Contains(t, string(middleware), "\tRequestID:   true,\n\tLogging:     true,\n\tRecovery:    true,\n\tGzip:        false,\n\tCORSOrigins: []string{},\n")
+
+	_, err = Scaffold(fsys, "shop", Options{})
+	assert.EqualError(t, err, "directory shop_grav already exists")
+	_, err = Scaffold(fsys, "blog", Options{LibraryVersion: "v1.2.0", LibraryDir: "../grayv-lsm"})
+	assert.NoError(t, err)
+	goMod, err = fsys.ReadFile("blog_grav/go.mod")
+	assert.NoError(t, err)
+	assert.Equal(t, "module blog_grav\n\ngo 1.22\n\nrequire (\n\tgithub.com/ooyeku/grayv-lsm v1.2.0\n\tgithub.com/spf13/cobra v1.8.1\n\tgolang.org/x/crypto v0.26.0\n)\n\n"+
+		"replace github.com/ooyeku/grayv-lsm => ../grayv-lsm\n", string(goMod))
+	_, err = Scaffold(fsys, "My App", Options{})
+	assert.Error(t, err)
+	_, err = Scaffold(fsys, "cart", Options{Middleware: config.MiddlewareConfig{Disable: []string{"gzip"}}})
+	assert.EqualError(t, err, `invalid server.middleware.disable entry "gzip": use one of request_id, logging, recovery`)
+}
+
+func TestScaffold_Middleware(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	_, err := Scaffold(fsys, "shop", Options{Middleware: config.MiddlewareConfig{
+		Disable: []string{"logging"}, Gzip: true, CORSOrigins: []string{"https://shop.example.com", "http://localhost:3000"},
+	}})
+	assert.NoError(t, err)
+	middleware, err := fsys.ReadFile("shop_grav/internal/middleware/middleware.go")
+	assert.NoError(t, err)
+	assert.Contains(t, string(middleware), "\tLogging:     false,\n")
+	assert.Contains(t, string(middleware), "\tGzip:        true,\n")
+	assert.Contains(t, string(middleware), `CORSOrigins: []string{"https://shop.example.com", "http://localhost:3000"},`)
+}
+
+func TestScaffold_Builds(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+	goSum, err := os.ReadFile("../../go.sum")
+	if err != nil {
+		t.Skipf("go.sum not available: %v", err)
+	}
+	library, err := filepath.Abs("../..")
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	// The command line of the app builds against this checkout of grayv-lsm.
+	_, err = Scaffold(filesystem.NewOSFS(dir), "shop", Options{LibraryVersion: "v0.0.0", LibraryDir: library})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "shop_grav", "go.sum"), goSum, 0644))
+	_, err = ScaffoldETL(filesystem.NewOSFS(dir), "shop", ETLOptions{Pipeline: "orders", Conflict: []string{"id"}})
+	assert.NoError(t, err)
+	_, err = ScaffoldETL(filesystem.NewOSFS(dir), "shop", ETLOptions{Pipeline: "legacy_users", Source: ETLSourceSQL, Query: "SELECT id, email FROM users", Table: "users"})
+	assert.NoError(t, err)
+
+	vet := exec.Command(goBin, "vet", "./...")
+	vet.Dir = filepath.Join(dir, "shop_grav")
+	vet.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+	output, err := vet.CombinedOutput()
+	assert.NoError(t, err, string(output))
+
+	// The tests of the generated packages are kept in testdata, and copied to the app to run them.
+	for _, pkg := range []string{"preflight", "jobs", "middleware", "notifications", "server", "etl", "cli"} {
+		data, err := os.ReadFile(filepath.Join("testdata", pkg, pkg+"_test.go"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(vet.Dir, "internal", pkg, pkg+"_test.go"), data, 0644))
+	}
+	test := exec.Command(goBin, "test", "./internal/...")
+	test.Dir = vet.Dir
+	test.Env = vet.Env
+	output, err = test.CombinedOutput()
+	assert.NoError(t, err, string(output))
+}
+
+func TestScaffoldETL(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	_, err := ScaffoldETL(fsys, "shop", ETLOptions{Pipeline: "orders"})
+	assert.ErrorContains(t, err, "grayv app shop not found")
+
+	_, err = Scaffold(fsys, "shop", Options{})
+	assert.NoError(t, err)
+	files, err := ScaffoldETL(fsys, "shop", ETLOptions{Pipeline: "order_import", Table: "orders", Columns: []string{"id", "total"}, Conflict: []string{"id"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"shop_grav/internal/etl/etl.go", "shop_grav/internal/pipelines/doc.go", "shop_grav/cmd/etl/main.go",
+		"shop_grav/internal/pipelines/order_import.go"}, files)
+	pipeline, err := fsys.ReadFile("shop_grav/internal/pipelines/order_import.go")
+	assert.NoError(t, err)
+	assert.Contains(t, string(pipeline), `Source:     &etl.CSVSource{Path: "data/order_import.csv"},`)
+	assert.Contains(t, string(pipeline), "Transforms: []etl.Transform{transformOrderImport},")
+	assert.Contains(t, string(pipeline), "\t\t\tTable:    \"orders\",\n\t\t\tColumns:  []string{\"id\", \"total\"},\n\t\t\tConflict: []string{\"id\"},\n")
+
+	files, err = ScaffoldETL(fsys, "shop", ETLOptions{Pipeline: "legacy", Source: ETLSourceSQL, Query: "SELECT * FROM accounts"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"shop_grav/internal/pipelines/legacy.go"}, files, "the shared files are written once")
+
+	_, err = ScaffoldETL(fsys, "shop", ETLOptions{Pipeline: "legacy"})
+	assert.EqualError(t, err, "pipeline legacy already exists")
+	_, err = ScaffoldETL(fsys, "shop", ETLOptions{Pipeline: "other", Source: ETLSourceSQL})
+	assert.EqualError(t, err, "a pipeline with an SQL source needs a query")
+	_, err = ScaffoldETL(fsys, "shop", ETLOptions{Pipeline: "Orders"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package app
+
+// serverTemplate is the internal/server package of a new app, running its HTTP server with lifecycle hooks
+// and a graceful shutdown. Like preflightTemplate, it only uses the standard library.
+const serverTemplate = `// Package server runs the HTTP server of {{.Name}}. Run calls the OnStart hooks, such as cache warmups or
+// background workers, serves until its context is canceled, e.g. on SIGINT or SIGTERM, then stops accepting
+// connections, lets the requests in flight finish within the drain timeout and calls the OnStop hooks, such
+// as closing the database pool, in the reverse order of their registration.
+//
+// A jobs.Worker, for instance, runs from a start hook until a stop hook cancels it and waits for its drain:
+//
+//	workerCtx, stopWorker := context.WithCancel(context.Background())
+//	done := make(chan error, 1)
+//	srv.OnStart("jobs", func(ctx context.Context) error {
+//		go func() { done <- worker.Run(workerCtx) }()
+//		return nil
+//	})
+//	srv.OnStop("jobs", func(ctx context.Context) error {
+//		stopWorker()
+//		return <-done
+//	})
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Hook is a function run when the server starts or stops. The context of stop hooks expires with the drain
+// timeout.
+type Hook func(ctx context.Context) error
+
+// Options configures a Server.
+type Options struct {
+	// Addr is the address to listen on, ":8080" by default.
+	Addr string
+	// DrainTimeout is how long the requests in flight and then the stop hooks may take on shutdown, 10s by
+	// default. Connections still open after it are closed.
+	DrainTimeout time.Duration
+	// ReadHeaderTimeout is how long clients may take to send the headers of a request, 10s by default.
+	ReadHeaderTimeout time.Duration
+}
+
+// FromEnv returns the options set by the environment: PORT, 8080 by default, and DRAIN_TIMEOUT, a duration
+// such as "30s".
+func FromEnv(getenv func(string) string) (Options, error) {
+	options := Options{Addr: ":8080"}
+	if port := getenv("PORT"); port != "" {
+		options.Addr = ":" + port
+	}
+	if timeout := getenv("DRAIN_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return options, fmt.Errorf("invalid DRAIN_TIMEOUT %q: use a positive duration such as 30s", timeout)
+		}
+		options.DrainTimeout = d
+	}
+	return options, nil
+}
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+// Server is an HTTP server with lifecycle hooks.
+type Server struct {
+	http    *http.Server
+	options Options
+	logf    func(format string, args ...interface{})
+	onStart []namedHook
+	onStop  []namedHook
+}
+
+// New creates a server of handler. logf, if set, logs the lifecycle of the server.
+func New(handler http.Handler, options Options, logf func(format string, args ...interface{})) *Server {
+	if options.Addr == "" {
+		options.Addr = ":8080"
+	}
+	if options.DrainTimeout <= 0 {
+		options.DrainTimeout = 10 * time.Second
+	}
+	if options.ReadHeaderTimeout <= 0 {
+		options.ReadHeaderTimeout = 10 * time.Second
+	}
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	return &Server{
+		http:    &http.Server{Addr: options.Addr, Handler: handler, ReadHeaderTimeout: options.ReadHeaderTimeout},
+		options: options,
+		logf:    logf,
+	}
+}
+
+// OnStart registers a hook run before the server accepts connections, in the order of registration. The
+// server does not start if one fails.
+func (s *Server) OnStart(name string, hook Hook) {
+	s.onStart = append(s.onStart, namedHook{name, hook})
+}
+
+// OnStop registers a hook run once the requests in flight are done, or the drain timeout expired, in the
+// reverse order of registration: resources registered first, such as the database pool, are released last.
+// Stop hooks also run when a start hook fails.
+func (s *Server) OnStop(name string, hook Hook) {
+	s.onStop = append(s.onStop, namedHook{name, hook})
+}
+
+// Run listens on the address of the options and serves until ctx is canceled, see Serve.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.options.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve runs the start hooks, serves the connections of listener until ctx is canceled, and shuts down
+// gracefully. It returns the errors of the server and of the hooks.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	for _, h := range s.onStart {
+		if err := h.hook(ctx); err != nil {
+			listener.Close()
+			err = fmt.Errorf("start hook %s: %w", h.name, err)
+			return errors.Join(err, s.stop())
+		}
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- s.http.Serve(listener) }()
+	s.logf("Listening on %s", listener.Addr())
+
+	var err error
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+		s.logf("Shutting down, draining requests for up to %s", s.options.DrainTimeout)
+		drainCtx, cancel := context.WithTimeout(context.Background(), s.options.DrainTimeout)
+		if shutdownErr := s.http.Shutdown(drainCtx); shutdownErr != nil {
+			s.logf("Requests still in flight after %s are aborted", s.options.DrainTimeout)
+			s.http.Close()
+		}
+		cancel()
+		err = <-served
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return errors.Join(err, s.stop())
+}
+
+// stop runs the stop hooks, in reverse order, within the drain timeout.
+func (s *Server) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.DrainTimeout)
+	defer cancel()
+	var errs []error
+	for i := len(s.onStop) - 1; i >= 0; i-- {
+		h := s.onStop[i]
+		if err := h.hook(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stop hook %s: %w", h.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+`
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"strings"
+	"testing"
+
+	shop "shop_grav"
+)
+
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	root := New()
+	root.SetArgs(args)
+	root.SetOut(&out)
+	root.SetErr(&out)
+	err := root.Execute()
+	return out.String(), err
+}
+
+func TestRoutesList(t *testing.T) {
+	t.Setenv("MIDDLEWARE_ENABLE", "request_id")
+	t.Setenv("MIDDLEWARE_DISABLE", "logging,recovery,gzip")
+	t.Setenv("CORS_ORIGINS", "none")
+	out, err := run(t, "routes", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "GET     /healthz  handlers.health  middleware.RequestID  Reports that the server is up") ||
+		!strings.Contains(out, "ANY     /         handlers.index   middleware.RequestID  Welcome page") {
+		t.Fatalf("routes %q", out)
+	}
+
+	out, err = run(t, "routes", "list", "--json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []routeInfo
+	if err := json.Unmarshal([]byte(out), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Method != "GET" || infos[0].Path != "/healthz" || infos[1].Method != "" || len(infos[1].Middleware) != 1 {
+		t.Fatalf("routes %+v", infos)
+	}
+}
+
+func TestDatabaseCommandsNeedURL(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	for _, args := range [][]string{{"migrate"}, {"migrate", "status"}, {"seed"}, {"worker"}} {
+		if _, err := run(t, args...); err == nil || !strings.Contains(err.Error(), "DATABASE_URL") {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	if _, err := run(t, "migrate", "rollback", "zero"); err == nil || !strings.Contains(err.Error(), "invalid number of steps") {
+		t.Fatalf("rollback: %v", err)
+	}
+	if _, err := run(t, "unknown"); err == nil {
+		t.Fatal("unknown command accepted")
+	}
+}
+
+func TestFilesEmbedded(t *testing.T) {
+	for _, dir := range []string{"migrations", "seeds"} {
+		if _, err := fs.ReadDir(shop.Files, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// memoryStore keeps checkpoints and loaded records in memory.
+type memoryStore struct {
+	cursors map[string]string
+	loaded  []Record
+	// failAt fails the commit of the batch starting at this cursor, if set.
+	failAt string
+}
+
+func (s *memoryStore) checkpoint(ctx context.Context, pipeline string) (*Checkpoint, error) {
+	cursor, ok := s.cursors[pipeline]
+	if !ok {
+		return nil, nil
+	}
+	return &Checkpoint{Pipeline: pipeline, Cursor: cursor}, nil
+}
+
+func (s *memoryStore) checkpoints(ctx context.Context) ([]Checkpoint, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) commit(ctx context.Context, pipeline string, load Load, records []Record, cursor, next string) error {
+	if s.cursors[pipeline] != cursor {
+		return ErrConcurrentRun
+	}
+	if s.failAt != "" && cursor == s.failAt {
+		return errors.New("connection reset")
+	}
+	s.loaded = append(s.loaded, records...)
+	s.cursors[pipeline] = next
+	return nil
+}
+
+func (s *memoryStore) reset(ctx context.Context, pipeline string) error {
+	delete(s.cursors, pipeline)
+	return nil
+}
+
+// sliceSource extracts numbered records, its cursor being the number of the last one.
+type sliceSource struct {
+	n int
+}
+
+func (s *sliceSource) Extract(ctx context.Context, cursor string, limit int) ([]Record, string, error) {
+	after, _ := strconv.Atoi(cursor)
+	var records []Record
+	for i := after + 1; i <= s.n && len(records) < limit; i++ {
+		records = append(records, Record{"n": i})
+	}
+	return records, strconv.Itoa(after + len(records)), nil
+}
+
+func TestRun_Resumes(t *testing.T) {
+	store := &memoryStore{cursors: map[string]string{}, failAt: "4"}
+	runner := newRunner(store, nil)
+	odd := func(ctx context.Context, r Record) (Record, error) {
+		if r["n"].(int)%2 == 0 {
+			return nil, nil
+		}
+		return r, nil
+	}
+	p := &Pipeline{Name: "numbers", Source: &sliceSource{n: 7}, Transforms: []Transform{odd}, BatchSize: 2}
+
+	loaded, err := runner.Run(context.Background(), p, false)
+	if err == nil || loaded != 2 {
+		t.Fatalf("expected the third batch to fail after 2 records, got %d, %v", loaded, err)
+	}
+	store.failAt = ""
+	if loaded, err = runner.Run(context.Background(), p, false); err != nil || loaded != 2 {
+		t.Fatalf("expected the run to resume and load 2 records, got %d, %v", loaded, err)
+	}
+	if want := []Record{{"n": 1}, {"n": 3}, {"n": 5}, {"n": 7}}; !reflect.DeepEqual(store.loaded, want) {
+		t.Fatalf("loaded %v, want %v", store.loaded, want)
+	}
+
+	store.loaded = nil
+	if loaded, err = runner.Run(context.Background(), p, true); err != nil || loaded != 4 {
+		t.Fatalf("expected a restart to load 4 records, got %d, %v", loaded, err)
+	}
+}
+
+func TestInsertStatements(t *testing.T) {
+	statements, args := insertStatements(Load{Table: "orders", Conflict: []string{"id"}},
+		[]Record{{"id": 1, "total": 9.5}, {"id": 2, "total": 3.0}})
+	want := `INSERT INTO "orders" ("id", "total") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "total" = EXCLUDED."total"`
+	if len(statements) != 1 || statements[0] != want {
+		t.Fatalf("got %v, want %s", statements, want)
+	}
+	if !reflect.DeepEqual(args[0], []interface{}{1, 9.5, 2, 3.0}) {
+		t.Fatalf("got arguments %v", args[0])
+	}
+
+	records := make([]Record, 40000)
+	for i := range records {
+		records[i] = Record{"a": i, "b": i}
+	}
+	statements, args = insertStatements(Load{Table: "t", Columns: []string{"a", "b"}}, records)
+	if len(statements) != 2 || len(args[0]) != 65534 || len(args[1]) != 80000-65534 {
+		t.Fatalf("expected 2 statements within the parameter limit, got %d", len(statements))
+	}
+}
+
+func TestCSVSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.csv")
+	if err := os.WriteFile(path, []byte("\ufeffid,total\n1,9.5\n2,3\n3,4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := &CSVSource{Path: path}
+	records, cursor, err := source.Extract(context.Background(), "", 2)
+	if err != nil || cursor != "2" || !reflect.DeepEqual(records, []Record{{"id": "1", "total": "9.5"}, {"id": "2", "total": "3"}}) {
+		t.Fatalf("got %v, %q, %v", records, cursor, err)
+	}
+	if records, cursor, err = (&CSVSource{Path: path}).Extract(context.Background(), "2", 2); err != nil || cursor != "3" || len(records) != 1 {
+		t.Fatalf("expected a new source to resume after 2 records, got %v, %q, %v", records, cursor, err)
+	}
+	if records, cursor, err = source.Extract(context.Background(), "2", 2); err != nil || cursor != "3" || records[0]["id"] != "3" {
+		t.Fatalf("got %v, %q, %v", records, cursor, err)
+	}
+	if records, cursor, err = source.Extract(context.Background(), "3", 2); err != nil || cursor != "3" || len(records) != 0 {
+		t.Fatalf("expected the source to be exhausted, got %v, %q, %v", records, cursor, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register(&Pipeline{Name: "test_register"})
+	if _, err := Lookup("test_register"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Lookup("missing"); err == nil {
+		t.Fatal("expected an error for an unknown pipeline")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected registering a pipeline twice to panic")
+		}
+	}()
+	Register(&Pipeline{Name: "test_register"})
+}
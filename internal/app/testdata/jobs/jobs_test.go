@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a store keeping jobs in memory.
+type memoryStore struct {
+	mu          sync.Mutex
+	pending     []*Job
+	done        []int64
+	failed      []int64
+	requeued    []int64
+	checkpoints map[int64]string
+	limit       int
+}
+
+func (s *memoryStore) claim(ctx context.Context, queue, worker string, lockTimeout time.Duration, limit int) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	if len(s.pending) == 0 {
+		return nil, nil
+	}
+	job := s.pending[0]
+	s.pending = s.pending[1:]
+	job.Attempts++
+	return job, nil
+}
+
+func (s *memoryStore) complete(ctx context.Context, id int64, worker string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = append(s.done, id)
+	return nil
+}
+
+func (s *memoryStore) fail(ctx context.Context, id int64, worker string, retryAfter time.Duration, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = append(s.failed, id)
+	return nil
+}
+
+func (s *memoryStore) requeue(ctx context.Context, id int64, worker string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requeued = append(s.requeued, id)
+	return true, nil
+}
+
+func (s *memoryStore) checkpoint(ctx context.Context, id int64, worker string, data json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[id] = string(data)
+	return nil
+}
+
+func TestWorker_Drain(t *testing.T) {
+	store := &memoryStore{checkpoints: make(map[int64]string), pending: []*Job{
+		{ID: 1, Kind: "slow"}, {ID: 2, Kind: "fast"}, {ID: 3, Kind: "broken"}, {ID: 4, Kind: "unknown"},
+	}}
+	w := newWorker(store, Options{Concurrency: 4, QueueConcurrency: 8, PollInterval: time.Millisecond, DrainTimeout: 50 * time.Millisecond, Logf: t.Logf})
+	started := make(chan struct{})
+	w.Handle("slow", func(ctx context.Context, job *Job) error {
+		if err := Checkpoint(ctx, map[string]int{"step": 2}); err != nil {
+			return err
+		}
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	w.Handle("fast", func(ctx context.Context, job *Job) error { return nil })
+	w.Handle("broken", func(ctx context.Context, job *Job) error { panic("broken") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() { result <- w.Run(ctx) }()
+	<-started
+	for w.Stats().Succeeded+w.Stats().Failed < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.done) != 1 || store.done[0] != 2 || len(store.failed) != 2 || len(store.requeued) != 1 || store.requeued[0] != 1 {
+		t.Fatalf("done %v, failed %v, requeued %v", store.done, store.failed, store.requeued)
+	}
+	if store.limit != 8 {
+		t.Fatalf("claimed with a queue limit of %d", store.limit)
+	}
+	if store.checkpoints[1] != `{"step":2}` {
+		t.Fatalf("checkpoints %v", store.checkpoints)
+	}
+	stats := w.Stats()
+	if stats.Claimed != 4 || stats.Requeued != 1 || stats.Drain < 50*time.Millisecond {
+		t.Fatalf("stats %+v", stats)
+	}
+	if err := Checkpoint(context.Background(), 1); err == nil || errors.Is(err, context.Canceled) {
+		t.Fatalf("checkpoint outside of a job: %v", err)
+	}
+}
+
+func TestEnqueueOptions(t *testing.T) {
+	at := time.Date(2024, 11, 5, 9, 0, 0, 0, time.UTC)
+	var o enqueueOptions
+	for _, option := range []EnqueueOption{Priority(10), Delay(time.Minute), At(at)} {
+		option(&o)
+	}
+	if o.priority != 10 || o.delay != time.Minute || o.at == nil || !o.at.Equal(at) {
+		t.Fatalf("options %+v", o)
+	}
+}
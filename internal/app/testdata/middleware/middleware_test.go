@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	env := map[string]string{"MIDDLEWARE_DISABLE": "logging, recovery", "MIDDLEWARE_ENABLE": "gzip", "CORS_ORIGINS": "https://a.example.com,https://b.example.com"}
+	cfg := FromEnv(func(key string) string { return env[key] })
+	if !cfg.RequestID || cfg.Logging || cfg.Recovery || !cfg.Gzip || len(cfg.CORSOrigins) != 2 {
+		t.Fatalf("config %+v", cfg)
+	}
+	env = map[string]string{"CORS_ORIGINS": "none"}
+	if cfg := FromEnv(func(key string) string { return env[key] }); cfg.CORSOrigins != nil || cfg.RequestID != Defaults.RequestID || cfg.Gzip != Defaults.Gzip {
+		t.Fatalf("config %+v", cfg)
+	}
+}
+
+func TestChain(t *testing.T) {
+	var logs []string
+	logf := func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	chain := New(Config{RequestID: true, Logging: true, Recovery: true, Gzip: true, CORSOrigins: []string{"https://shop.example.com"}}, logf)
+	var order []string
+	chain.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "app:"+RequestIDFrom(r.Context()))
+			next.ServeHTTP(w, r)
+		})
+	})
+	handler := chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		io.WriteString(w, strings.Repeat("hello ", 100))
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Origin", "https://shop.example.com")
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get(RequestIDHeader) != "req-1" ||
+		w.Header().Get("Access-Control-Allow-Origin") != "https://shop.example.com" {
+		t.Fatalf("response %d %v", w.Code, w.Header())
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(gz); string(body) != strings.Repeat("hello ", 100) {
+		t.Fatalf("body %q", body)
+	}
+	if len(order) != 1 || order[0] != "app:req-1" || len(logs) != 1 || !strings.HasPrefix(logs[0], "GET / 200 ") || !strings.HasSuffix(logs[0], "id=req-1") {
+		t.Fatalf("order %v, logs %v", order, logs)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusInternalServerError || len(w.Header().Get(RequestIDHeader)) != 32 || len(logs) != 3 || !strings.Contains(logs[1], "panic serving GET /panic") {
+		t.Fatalf("panic: %d, logs %v", w.Code, logs)
+	}
+
+	r = httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "https://shop.example.com")
+	r.Header.Set("Access-Control-Request-Method", "DELETE")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Fatalf("preflight: %d %v", w.Code, w.Header())
+	}
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("other origin: %v", w.Header())
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	env := map[string]string{"READ_ONLY": "true", "READ_ONLY_ALLOW": "/auth/login"}
+	cfg := FromEnv(func(key string) string { return env[key] })
+	if !cfg.ReadOnly || len(cfg.ReadOnlyAllow) != 1 {
+		t.Fatalf("config %+v", cfg)
+	}
+	handler := New(cfg, func(string, ...interface{}) {}).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "served")
+	}))
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/orders", http.StatusOK},
+		{"HEAD", "/orders", http.StatusOK},
+		{"POST", "/orders", http.StatusServiceUnavailable},
+		{"DELETE", "/orders/1", http.StatusServiceUnavailable},
+		{"POST", "/auth/login", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.status {
+			t.Fatalf("%s %s: status %d", tc.method, tc.path, w.Code)
+		}
+		if tc.status == http.StatusServiceUnavailable && (strings.TrimSpace(w.Body.String()) != DefaultReadOnlyMessage || w.Header().Get("Retry-After") == "") {
+			t.Fatalf("%s %s: %q %v", tc.method, tc.path, w.Body.String(), w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	ReadOnly("back at 10:00 UTC")(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("PUT", "/orders/1", nil))
+	if w.Code != http.StatusServiceUnavailable || strings.TrimSpace(w.Body.String()) != "back at 10:00 UTC" {
+		t.Fatalf("custom message: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestNames(t *testing.T) {
+	chain := New(Config{RequestID: true, Logging: true, CORSOrigins: []string{"*"}}, nil)
+	chain.Use(func(next http.Handler) http.Handler { return next })
+	names := strings.Join(chain.Names(), " ")
+	if names != "middleware.RequestID middleware.Logging middleware.CORS middleware.TestNames" {
+		t.Fatalf("names %q", names)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	dir := t.TempDir()
+	env := map[string]string{"RECORD_DIR": dir}
+	chain := New(Config{RequestID: true, RecordDir: FromEnv(func(key string) string { return env[key] }).RecordDir}, t.Logf)
+	handler := chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "hunter2") {
+			t.Errorf("handler read %q", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"token":"abc","user":{"email":"ann@example.com"}}`)
+	}))
+
+	r := httptest.NewRequest("POST", "/sessions?next=/home&access_token=abc", strings.NewReader(`{"email":"ann@example.com","password":"hunter2"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer abc")
+	r.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*-req-1.json"))
+	if len(files) != 1 {
+		t.Fatalf("recordings %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "abc") {
+		t.Fatalf("credentials recorded: %s", data)
+	}
+	var recording Recording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		t.Fatal(err)
+	}
+	if recording.Method != "POST" || recording.URL != "/sessions?access_token=%5BREDACTED%5D&next=%2Fhome" ||
+		recording.Header.Get("Authorization") != Redacted || recording.Header.Get(RequestIDHeader) != "req-1" {
+		t.Fatalf("request %+v", recording)
+	}
+	if recording.Response.Status != http.StatusCreated || !strings.Contains(recording.Response.Body, `"email":"ann@example.com"`) {
+		t.Fatalf("response %+v", recording.Response)
+	}
+}
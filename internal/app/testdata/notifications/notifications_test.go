@@ -0,0 +1,142 @@
+package notifications
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// memoryStore is a store keeping the suppression list and the log in memory.
+type memoryStore struct {
+	suppressions map[string]string
+	entries      []logEntry
+}
+
+func (s *memoryStore) suppressed(ctx context.Context, channel, to string) (bool, error) {
+	_, ok := s.suppressions[channel+":"+to]
+	return ok, nil
+}
+
+func (s *memoryStore) suppress(ctx context.Context, channel, to, reason string) error {
+	s.suppressions[channel+":"+to] = reason
+	return nil
+}
+
+func (s *memoryStore) unsuppress(ctx context.Context, channel, to string) error {
+	delete(s.suppressions, channel+":"+to)
+	return nil
+}
+
+func (s *memoryStore) log(ctx context.Context, entry logEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// channelFunc is a Channel calling a function.
+type channelFunc func(ctx context.Context, msg Message) error
+
+func (f channelFunc) Send(ctx context.Context, msg Message) error { return f(ctx, msg) }
+
+func TestNotifier_Send(t *testing.T) {
+	store := &memoryStore{suppressions: make(map[string]string)}
+	n := newNotifier(store, Options{Backoff: time.Millisecond})
+	if err := n.AddTemplate("welcome", "Welcome, {{.Name}}", "Hello {{.Name}},\nthanks for signing up.\n"); err != nil {
+		t.Fatal(err)
+	}
+	var sent []Message
+	failures := 2
+	n.AddChannel("email", channelFunc(func(ctx context.Context, msg Message) error {
+		if msg.To == "gone@example.com" {
+			return Undeliverable(errors.New("550 no such user"))
+		}
+		if failures > 0 {
+			failures--
+			return errors.New("connection refused")
+		}
+		sent = append(sent, msg)
+		return nil
+	}))
+	data := map[string]string{"Name": "Ann"}
+
+	if err := n.Send(context.Background(), "email", "ann@example.com", "welcome", data); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0].Subject != "Welcome, Ann" || sent[0].Body != "Hello Ann,\nthanks for signing up.\n" {
+		t.Fatalf("sent %+v", sent)
+	}
+	if e := store.entries[0]; e.Status != StatusSent || e.Attempts != 3 || e.Template != "welcome" || e.Subject != "Welcome, Ann" {
+		t.Fatalf("entry %+v", e)
+	}
+
+	if err := n.Send(context.Background(), "email", "gone@example.com", "welcome", data); err == nil {
+		t.Fatal("undeliverable recipient sent")
+	}
+	if e := store.entries[1]; e.Status != StatusFailed || e.Attempts != 1 || e.LastError != "550 no such user" {
+		t.Fatalf("entry %+v", e)
+	}
+	if err := n.Send(context.Background(), "email", "gone@example.com", "welcome", data); !errors.Is(err, ErrSuppressed) {
+		t.Fatalf("suppressed recipient: %v", err)
+	}
+	if e := store.entries[2]; e.Status != StatusSuppressed || e.Attempts != 0 {
+		t.Fatalf("entry %+v", e)
+	}
+	if err := n.Unsuppress(context.Background(), "email", "gone@example.com"); err != nil || len(store.suppressions) != 0 {
+		t.Fatalf("unsuppress: %v %v", err, store.suppressions)
+	}
+
+	if err := n.Send(context.Background(), "email", "ann@example.com", "welcome", map[string]string{}); err == nil {
+		t.Fatal("missing template data accepted")
+	}
+	if err := n.Send(context.Background(), "sms", "ann@example.com", "welcome", data); err == nil {
+		t.Fatal("unknown channel accepted")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var body []byte
+	var signature string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	channels := ChannelsFromEnv(func(key string) string {
+		return map[string]string{"WEBHOOK_URL": server.URL, "WEBHOOK_SECRET": "s3cret"}[key]
+	})
+	if len(channels) != 1 || channels["webhook"] == nil {
+		t.Fatalf("channels %v", channels)
+	}
+	if err := channels["webhook"].Send(context.Background(), Message{To: "ops", Subject: "Disk full", Body: "90%"}); err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]string
+	if err := json.Unmarshal(body, &msg); err != nil || msg["to"] != "ops" || msg["subject"] != "Disk full" {
+		t.Fatalf("body %s", body)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if signature != hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("signature %q", signature)
+	}
+
+	status = http.StatusBadRequest
+	var permanent *permanentError
+	if err := channels["webhook"].Send(context.Background(), Message{}); !errors.As(err, &permanent) {
+		t.Fatalf("400: %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := channels["webhook"].Send(context.Background(), Message{}); err == nil || errors.As(err, &permanent) {
+		t.Fatalf("503: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	env := map[string]string{"PORT": "x", "PREFLIGHT_TIMEOUT": "soon", "DATABASE_URL": "postgres://localhost/shop"}
+	err := Run(context.Background(), FromEnv(func(name string) string { return env[name] }), t.Logf)
+	var preflightErr *Error
+	if !errors.As(err, &preflightErr) || len(preflightErr.Failures) != 3 {
+		t.Fatalf("err %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, `PORT="x"`) || !strings.Contains(msg, "PREFLIGHT_TIMEOUT") || !strings.Contains(msg, "import the postgres driver") {
+		t.Fatalf("err %v", err)
+	}
+	if err := Run(context.Background(), FromEnv(func(string) string { return "" }), t.Logf); err != nil {
+		t.Fatal(err)
+	}
+	off := map[string]string{"PREFLIGHT": "off", "PORT": "x"}
+	if err := Run(context.Background(), FromEnv(func(name string) string { return off[name] }), t.Logf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"10_b.sql", "2_a.sql", "1_init.sql", "README.md"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	pending, err := pendingMigrations(dir, map[int64]bool{1: true})
+	if err != nil || strings.Join(pending, ",") != "2_a.sql,10_b.sql" {
+		t.Fatalf("pending %v, %v", pending, err)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_Serve(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	srv := New(handler, Options{DrainTimeout: 5 * time.Second}, t.Logf)
+	var events []string
+	for _, name := range []string{"cache", "database"} {
+		name := name
+		srv.OnStart(name, func(ctx context.Context) error {
+			events = append(events, "start "+name)
+			return nil
+		})
+		srv.OnStop(name, func(ctx context.Context) error {
+			events = append(events, "stop "+name)
+			return nil
+		})
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, listener) }()
+
+	// A request in flight when the server is asked to stop is served before the stop hooks run.
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	events = append(events, "released")
+	close(release)
+
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if body := <-response; body != "done" {
+		t.Fatalf("response %q", body)
+	}
+	want := "start cache, start database, released, stop database, stop cache"
+	if got := strings.Join(events, ", "); got != want {
+		t.Fatalf("events %s, want %s", got, want)
+	}
+}
+
+func TestServer_StartHookFails(t *testing.T) {
+	srv := New(http.NotFoundHandler(), Options{}, nil)
+	stopped := false
+	srv.OnStop("database", func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+	srv.OnStart("warmup", func(ctx context.Context) error { return errors.New("cache unreachable") })
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = srv.Serve(context.Background(), listener)
+	if err == nil || err.Error() != "start hook warmup: cache unreachable" || !stopped {
+		t.Fatalf("err %v, stopped %v", err, stopped)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	env := map[string]string{"PORT": "9000", "DRAIN_TIMEOUT": "30s"}
+	options, err := FromEnv(func(key string) string { return env[key] })
+	if err != nil || options.Addr != ":9000" || options.DrainTimeout != 30*time.Second {
+		t.Fatalf("options %+v, %v", options, err)
+	}
+	env["DRAIN_TIMEOUT"] = "soon"
+	if _, err := FromEnv(func(key string) string { return env[key] }); err == nil {
+		t.Fatal("invalid DRAIN_TIMEOUT accepted")
+	}
+}
@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{"* * * * *", "*/15 0-6,22 1 jan-mar mon-fri", "0 6 1 * *", "@daily", "5/20 * * * 7"} {
+		_, err := Parse(spec)
+		assert.NoError(t, err, spec)
+	}
+
+	_, err := Parse("0 6 1 *")
+	assert.EqualError(t, err, `invalid schedule "0 6 1 *": expected 5 fields (minute hour day-of-month month day-of-week)`)
+	_, err = Parse("60 * * * *")
+	assert.EqualError(t, err, `invalid schedule "60 * * * *": invalid minute "60": use a value from 0 to 59`)
+	_, err = Parse("*/0 * * * *")
+	assert.EqualError(t, err, `invalid schedule "*/0 * * * *": invalid step "0" of the minute`)
+	_, err = Parse("0 9-5 * * *")
+	assert.EqualError(t, err, `invalid schedule "0 9-5 * * *": invalid range "9-5" of the hour`)
+}
+
+func TestSchedule_Next(t *testing.T) {
+	from := time.Date(2024, 5, 14, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 14, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 14, 10, 15, 0, 0, time.UTC)},
+		{"0 6 1 * *", time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 14, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * sat,sun", time.Date(2024, 5, 18, 9, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// With both days restricted, either matches: the 20th or the next Monday.
+		{"0 0 20 * 1", time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * 3", time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.want, s.Next(from), tt.spec)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package anonymize rewrites the sensitive columns of a Postgres database, such as a copy of production, with
+// fake values following a rules file, so that the copy can be shared with developers.
+package anonymize
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// The strategies columns are rewritten with.
+const (
+	// Email gives addresses like user_1a2b3c4d5e6f@example.com.
+	Email = "email"
+	// Name gives a first name and a last name.
+	Name      = "name"
+	FirstName = "first_name"
+	LastName  = "last_name"
+	// Phone gives numbers like +15550123456.
+	Phone = "phone"
+	// Address gives street addresses like 42 Maple St.
+	Address = "address"
+	// Token gives 32 hexadecimal digits.
+	Token = "token"
+	// Redact gives "[redacted]".
+	Redact = "redact"
+	// Null gives NULL.
+	Null = "null"
+)
+
+// Strategies lists the strategies a rule may use.
+var Strategies = []string{Email, Name, FirstName, LastName, Phone, Address, Token, Redact, Null}
+
+// DefaultSecretEnv is the environment variable holding the secret of the fake values unless the rules name
+// another.
+const DefaultSecretEnv = "ANONYMIZE_SECRET"
+
+var (
+	firstNames = []string{"Alex", "Blake", "Casey", "Dana", "Eli", "Frankie", "Gray", "Harper", "Indy", "Jordan",
+		"Kai", "Logan", "Morgan", "Noel", "Oakley", "Parker", "Quinn", "Riley", "Sam", "Taylor"}
+	lastNames = []string{"Adams", "Brooks", "Carter", "Diaz", "Evans", "Foster", "Garcia", "Hughes", "Ito", "Jensen",
+		"Kim", "Lopez", "Miller", "Nguyen", "Okafor", "Patel", "Reyes", "Silva", "Turner", "Walsh"}
+	streets = []string{"Maple", "Oak", "Pine", "Cedar", "Elm", "Birch", "Willow", "Lake", "Hill", "Park"}
+
+	identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Rules maps the columns of tables to the strategies they are rewritten with.
+type Rules struct {
+	// SecretEnv is the environment variable holding the secret mixed into the fake values, DefaultSecretEnv if
+	// empty. Values are derived from a hash of the secret and the original value, so a value is rewritten the
+	// same way in every column and every run with the same secret, and joins on rewritten columns still match,
+	// but the original values cannot be recovered without the secret.
+	SecretEnv string `yaml:"secret_env"`
+	// Tables maps table names to their columns and the strategies they are rewritten with.
+	Tables map[string]map[string]string `yaml:"tables"`
+}
+
+// LoadRules reads and validates a rules file.
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	rules := &Rules{}
+	if err := yaml.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("invalid rules %s: %w", path, err)
+	}
+	if err := rules.validate(); err != nil {
+		return nil, fmt.Errorf("invalid rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func (r *Rules) validate() error {
+	if r.SecretEnv == "" {
+		r.SecretEnv = DefaultSecretEnv
+	}
+	if len(r.Tables) == 0 {
+		return fmt.Errorf("no tables")
+	}
+	for table, columns := range r.Tables {
+		if !identifier.MatchString(table) {
+			return fmt.Errorf("invalid table name %q", table)
+		}
+		for column, strategy := range columns {
+			if !identifier.MatchString(column) {
+				return fmt.Errorf("invalid column name %q of table %s", column, table)
+			}
+			if _, err := expression(strategy, column, ""); err != nil {
+				return fmt.Errorf("column %s of table %s: %w", column, table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Secret returns the secret of the fake values, read from the environment.
+func (r *Rules) Secret() (string, error) {
+	env := r.SecretEnv
+	if env == "" {
+		env = DefaultSecretEnv
+	}
+	secret := os.Getenv(env)
+	if secret == "" {
+		return "", fmt.Errorf("set %s to the secret the fake values are derived from", env)
+	}
+	return secret, nil
+}
+
+// Statement is the UPDATE rewriting the columns of a table.
+type Statement struct {
+	Table string
+	SQL   string
+}
+
+// Statements returns the statements rewriting the columns of the rules with fake values derived from secret,
+// by table name. NULL values stay NULL.
+func (r *Rules) Statements(secret string) ([]Statement, error) {
+	tables := make([]string, 0, len(r.Tables))
+	for table := range r.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var statements []Statement
+	for _, table := range tables {
+		columns := make([]string, 0, len(r.Tables[table]))
+		for column := range r.Tables[table] {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		assignments := make([]string, len(columns))
+		for i, column := range columns {
+			expr, err := expression(r.Tables[table][column], column, secret)
+			if err != nil {
+				return nil, fmt.Errorf("column %s of table %s: %w", column, table, err)
+			}
+			assignments[i] = pq.QuoteIdentifier(column) + " = " + expr
+		}
+		statements = append(statements, Statement{Table: table,
+			SQL: fmt.Sprintf("UPDATE %s SET %s", pq.QuoteIdentifier(table), strings.Join(assignments, ", "))})
+	}
+	return statements, nil
+}
+
+// expression returns the SQL expression rewriting a column with the given strategy. The hash of the secret and
+// the value, and so every expression but Redact's, is NULL when the value is.
+func expression(strategy, column, secret string) (string, error) {
+	hash := fmt.Sprintf("md5(%s || %s::text)", pq.QuoteLiteral(secret+":"), pq.QuoteIdentifier(column))
+	// number picks a non-negative integer from the hash, starting at digit offset.
+	number := func(offset int) string {
+		return fmt.Sprintf("('x' || substr(%s, %d, 7))::bit(28)::int", hash, offset)
+	}
+	pick := func(values []string, offset int) string {
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = pq.QuoteLiteral(v)
+		}
+		return fmt.Sprintf("(ARRAY[%s])[1 + %s %% %d]", strings.Join(quoted, ", "), number(offset), len(values))
+	}
+
+	switch strategy {
+	case Email:
+		return fmt.Sprintf("'user_' || substr(%s, 1, 12) || '@example.com'", hash), nil
+	case Name:
+		return pick(firstNames, 1) + " || ' ' || " + pick(lastNames, 8), nil
+	case FirstName:
+		return pick(firstNames, 1), nil
+	case LastName:
+		return pick(lastNames, 8), nil
+	case Phone:
+		return fmt.Sprintf("'+1555' || lpad((%s %% 10000000)::text, 7, '0')", number(1)), nil
+	case Address:
+		return fmt.Sprintf("(1 + %s %% 9999)::text || ' ' || %s || ' St'", number(1), pick(streets, 8)), nil
+	case Token:
+		return hash, nil
+	case Redact:
+		return fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE '[redacted]' END", pq.QuoteIdentifier(column)), nil
+	case Null:
+		return "NULL", nil
+	}
+	return "", fmt.Errorf("unknown strategy %q: use one of %v", strategy, Strategies)
+}
+
+// Run rewrites the columns of the rules in db in a single transaction, with fake values derived from secret. It
+// returns the number of rows rewritten by table.
+func (r *Rules) Run(ctx context.Context, db *sql.DB, secret string) (map[string]int64, error) {
+	statements, err := r.Statements(secret)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rewritten := make(map[string]int64, len(statements))
+	for _, statement := range statements {
+		result, err := tx.ExecContext(ctx, statement.SQL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to anonymize %s: %w", statement.Table, err)
+		}
+		rewritten[statement.Table], _ = result.RowsAffected()
+	}
+	return rewritten, tx.Commit()
+}
+
+// Uncovered lists the sensitive fields of the models, as table.column, that the rules do not rewrite.
+func (r *Rules) Uncovered(defs []*model.ModelDefinition) []string {
+	var uncovered []string
+	for _, def := range defs {
+		table := model.TableName(def)
+		for i := range def.Fields {
+			field := &def.Fields[i]
+			if _, ok := r.Tables[table][model.ColumnName(field)]; field.Sensitive && !ok {
+				uncovered = append(uncovered, table+"."+model.ColumnName(field))
+			}
+		}
+	}
+	return uncovered
+}
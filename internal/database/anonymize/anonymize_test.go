@@ -0,0 +1,79 @@
+package anonymize
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func writeRules(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules(writeRules(t, `
+tables:
+  users:
+    email: email
+    full_name: name
+  sessions:
+    token: token
+`))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSecretEnv, rules.SecretEnv)
+	assert.Equal(t, map[string]string{"email": "email", "full_name": "name"}, rules.Tables["users"])
+
+	_, err = LoadRules(writeRules(t, "tables:\n  users:\n    email: scramble\n"))
+	assert.ErrorContains(t, err, `column email of table users: unknown strategy "scramble"`)
+	_, err = LoadRules(writeRules(t, "tables:\n  users:\n    \"email; DROP\": email\n"))
+	assert.ErrorContains(t, err, `invalid column name "email; DROP" of table users`)
+	_, err = LoadRules(writeRules(t, "secret_env: SALT\n"))
+	assert.ErrorContains(t, err, "no tables")
+}
+
+func TestStatements(t *testing.T) {
+	rules := &Rules{Tables: map[string]map[string]string{
+		"users":    {"email": Email, "notes": Redact, "phone": Null},
+		"sessions": {"token": Token},
+	}}
+	statements, err := rules.Statements("it's")
+	require.NoError(t, err)
+	require.Len(t, statements, 2)
+	assert.Equal(t, Statement{Table: "sessions", SQL: `UPDATE "sessions" SET "token" = md5('it''s:' || "token"::text)`}, statements[0])
+	assert.Equal(t, `UPDATE "users" SET "email" = 'user_' || substr(md5('it''s:' || "email"::text), 1, 12) || '@example.com', `+
+		`"notes" = CASE WHEN "notes" IS NULL THEN NULL ELSE '[redacted]' END, "phone" = NULL`, statements[1].SQL)
+
+	name, err := expression(Name, "name", "s")
+	require.NoError(t, err)
+	assert.Contains(t, name, `(ARRAY['Alex', 'Blake'`)
+	assert.Contains(t, name, `[1 + ('x' || substr(md5('s:' || "name"::text), 8, 7))::bit(28)::int % 20]`)
+}
+
+func TestSecret(t *testing.T) {
+	rules := &Rules{SecretEnv: "GRAYV_TEST_ANONYMIZE_SECRET"}
+	_, err := rules.Secret()
+	assert.EqualError(t, err, "set GRAYV_TEST_ANONYMIZE_SECRET to the secret the fake values are derived from")
+	t.Setenv("GRAYV_TEST_ANONYMIZE_SECRET", "pepper")
+	secret, err := rules.Secret()
+	require.NoError(t, err)
+	assert.Equal(t, "pepper", secret)
+}
+
+func TestUncovered(t *testing.T) {
+	user := model.NewModelDefinition("User", []model.Field{
+		model.NewField("Email", "string", "", false, false),
+		model.NewField("Phone", "string", "", true, false),
+		model.NewField("Plan", "string", "", false, false),
+	})
+	user.Fields[0].Sensitive = true
+	user.Fields[1].Sensitive = true
+	rules := &Rules{Tables: map[string]map[string]string{"users": {"email": Email}}}
+	assert.Equal(t, []string{"users.phone"}, rules.Uncovered([]*model.ModelDefinition{user}))
+}
@@ -0,0 +1,235 @@
+// Package backup dumps Postgres databases with pg_dump into a directory of backups, rotates them following
+// retention rules, verifies their integrity and restores them with pg_restore.
+//
+// It also supports point-in-time restores, which replay the WAL archived since a base backup, a copy of the
+// files of the whole server, up to a chosen time. The WAL archive directory is written by the server, so it is
+// a path of the host of the server; restoring reads it and the base backup from the host running the restore.
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// DefaultDir is the directory backups are written to unless another is given.
+const DefaultDir = "backups"
+
+// nameFormat is the time format of the names of backups.
+const nameFormat = "20060102T150405Z"
+
+// Backup describes a dump of a database. Each backup is a pg_dump archive, <Name>.dump, with its description
+// next to it, <Name>.json.
+type Backup struct {
+	Name      string    `json:"name"`
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	// SHA256 is the checksum of the archive, computed when it was written, that Verify compares it to.
+	SHA256 string `json:"sha256"`
+	// Path is the path of the archive.
+	Path string `json:"-"`
+}
+
+// Retention rules which backups Prune removes. Backups are kept if any rule keeps them, and the newest
+// backup is always kept.
+type Retention struct {
+	// Keep is the number of newest backups kept, all when 0.
+	Keep int
+	// MaxAge is the age past which backups are removed, unless Keep keeps them; none expire when 0.
+	MaxAge time.Duration
+}
+
+// command creates the commands running pg_dump and pg_restore. It is a variable so tests can substitute a fake.
+var command = exec.CommandContext
+
+// Dump dumps the database of db, named database in the configuration, into a new backup of dir, and returns it.
+// The archive is written under a temporary name, renamed once complete and checksummed, so that an interrupted
+// dump leaves no backup behind.
+func Dump(ctx context.Context, db *config.DatabaseConfig, database, dir string, now time.Time) (*Backup, error) {
+	if err := checkDriver(db); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the backups directory: %w", err)
+	}
+	b := &Backup{Name: database + "-" + now.UTC().Format(nameFormat), Database: database, CreatedAt: now.UTC()}
+	b.Path = filepath.Join(dir, b.Name+".dump")
+	partial := b.Path + ".partial"
+
+	cmd := command(ctx, "pg_dump", "--format=custom", "--no-owner", "--file="+partial)
+	cmd.Env = append(os.Environ(), pgEnv(db)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	var err error
+	if b.SHA256, b.Size, err = checksum(partial); err == nil {
+		err = os.Rename(partial, b.Path)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	data, _ := json.MarshalIndent(b, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, b.Name+".json"), data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write the description of backup %s: %w", b.Name, err)
+	}
+	return b, nil
+}
+
+// List returns the backups of dir, newest first, and none if dir does not exist.
+func List(dir string) ([]*Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []*Backup
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		b := &Backup{}
+		if err := json.Unmarshal(data, b); err != nil {
+			return nil, fmt.Errorf("invalid description of backup %s: %w", entry.Name(), err)
+		}
+		b.Path = filepath.Join(dir, b.Name+".dump")
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// Find returns the backup of dir with the given name, or the newest one if name is "latest".
+func Find(dir, name string) (*Backup, error) {
+	backups, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range backups {
+		if b.Name == name || name == "latest" {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("no backup %s in %s", name, dir)
+}
+
+// Verify checks that the archive of a backup is intact: that its checksum is the one computed when it was
+// written, and that pg_restore can read its table of contents.
+func Verify(ctx context.Context, b *Backup) error {
+	sum, _, err := checksum(b.Path)
+	if err != nil {
+		return err
+	}
+	if sum != b.SHA256 {
+		return fmt.Errorf("backup %s is corrupted: its checksum is %s, expected %s", b.Name, sum, b.SHA256)
+	}
+	if out, err := command(ctx, "pg_restore", "--list", b.Path).CombinedOutput(); err != nil {
+		return fmt.Errorf("backup %s cannot be read: %w: %s", b.Name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Restore verifies a backup and restores it into the database of db, replacing the objects it contains.
+func Restore(ctx context.Context, db *config.DatabaseConfig, b *Backup) error {
+	if err := checkDriver(db); err != nil {
+		return err
+	}
+	if err := Verify(ctx, b); err != nil {
+		return err
+	}
+	cmd := command(ctx, "pg_restore", "--clean", "--if-exists", "--no-owner", "--single-transaction",
+		"--dbname="+db.Name, b.Path)
+	cmd.Env = append(os.Environ(), pgEnv(db)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pg_restore failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Prune removes the backups of dir of the given database that the retention rules do not keep, and returns
+// them.
+func Prune(dir, database string, retention Retention, now time.Time) ([]*Backup, error) {
+	backups, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []*Backup
+	kept := 0
+	for _, b := range backups {
+		if b.Database != database {
+			continue
+		}
+		kept++
+		keep := kept == 1 ||
+			(retention.Keep > 0 && kept <= retention.Keep) ||
+			(retention.MaxAge > 0 && now.Sub(b.CreatedAt) <= retention.MaxAge) ||
+			(retention.Keep == 0 && retention.MaxAge == 0)
+		if keep {
+			continue
+		}
+		for _, path := range []string{b.Path, filepath.Join(dir, b.Name+".json")} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return removed, err
+			}
+		}
+		removed = append(removed, b)
+	}
+	return removed, nil
+}
+
+// checkDriver returns an error unless db is a Postgres database, which pg_dump dumps.
+func checkDriver(db *config.DatabaseConfig) error {
+	if db.Driver != "" && db.Driver != "postgres" && db.Driver != "pgx" {
+		return fmt.Errorf("backups are only supported for postgres databases, not %s", db.Driver)
+	}
+	return nil
+}
+
+// pgEnv returns the environment variables connecting pg_dump and pg_restore to the database of db, so that the
+// password does not appear in the arguments of the processes.
+func pgEnv(db *config.DatabaseConfig) []string {
+	env := []string{"PGHOST=" + db.Host, "PGUSER=" + db.User, "PGPASSWORD=" + db.Password, "PGDATABASE=" + db.Name}
+	if db.Port != 0 {
+		env = append(env, "PGPORT="+strconv.Itoa(db.Port))
+	}
+	if db.SSLMode != "" {
+		env = append(env, "PGSSLMODE="+db.SSLMode)
+	}
+	return env
+}
+
+// checksum returns the hexadecimal SHA-256 and the size of a file.
+func checksum(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
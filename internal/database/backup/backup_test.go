@@ -0,0 +1,163 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// fakeCommands replaces pg_dump, which writes "archive" to its --file, and pg_restore, which fails when fail is
+// set, and records their arguments.
+func fakeCommands(t *testing.T, fail bool) *[]string {
+	var calls []string
+	command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		script := "true"
+		switch {
+		case name == "pg_dump":
+			script = "printf archive > " + strings.TrimPrefix(args[len(args)-1], "--file=")
+		case fail:
+			script = "echo 'input file is not a valid archive' >&2; exit 1"
+		}
+		return exec.CommandContext(ctx, "sh", "-c", script)
+	}
+	t.Cleanup(func() { command = exec.CommandContext })
+	return &calls
+}
+
+func TestDump(t *testing.T) {
+	calls := fakeCommands(t, false)
+	dir := filepath.Join(t.TempDir(), "backups")
+	now := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+
+	b, err := Dump(context.Background(), &config.DatabaseConfig{Driver: "postgres", Name: "app"}, "default", dir, now)
+	require.NoError(t, err)
+	assert.Equal(t, "default-20240601T060000Z", b.Name)
+	assert.Equal(t, int64(len("archive")), b.Size)
+	assert.Equal(t, "0eb3e36bfb24dcd9bb1d1bece1531216b59539a8fde17ee80224af0653c92aa3", b.SHA256)
+	assert.FileExists(t, filepath.Join(dir, b.Name+".dump"))
+	assert.NoFileExists(t, filepath.Join(dir, b.Name+".dump.partial"))
+	assert.Equal(t, []string{"pg_dump --format=custom --no-owner --file=" + b.Path + ".partial"}, *calls)
+
+	backups, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.Equal(t, b.SHA256, backups[0].SHA256)
+	assert.Equal(t, b.Path, backups[0].Path)
+	assert.True(t, now.Equal(backups[0].CreatedAt))
+}
+
+func TestDump_Driver(t *testing.T) {
+	fakeCommands(t, false)
+	_, err := Dump(context.Background(), &config.DatabaseConfig{Driver: "sqlite3"}, "default", t.TempDir(), time.Now())
+	assert.ErrorContains(t, err, "only supported for postgres")
+}
+
+func TestVerify(t *testing.T) {
+	fakeCommands(t, false)
+	dir := t.TempDir()
+	b, err := Dump(context.Background(), &config.DatabaseConfig{}, "default", dir, time.Now())
+	require.NoError(t, err)
+	assert.NoError(t, Verify(context.Background(), b))
+
+	require.NoError(t, os.WriteFile(b.Path, []byte("tampered"), 0600))
+	assert.ErrorContains(t, Verify(context.Background(), b), "is corrupted")
+
+	fakeCommands(t, true)
+	b, err = Dump(context.Background(), &config.DatabaseConfig{}, "default", dir, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.ErrorContains(t, Verify(context.Background(), b), "not a valid archive")
+}
+
+func TestRestore(t *testing.T) {
+	calls := fakeCommands(t, false)
+	dir := t.TempDir()
+	b, err := Dump(context.Background(), &config.DatabaseConfig{}, "default", dir, time.Now())
+	require.NoError(t, err)
+
+	require.NoError(t, Restore(context.Background(), &config.DatabaseConfig{Name: "app"}, b))
+	assert.Equal(t, "pg_restore --clean --if-exists --no-owner --single-transaction --dbname=app "+b.Path, (*calls)[len(*calls)-1])
+}
+
+func TestFind(t *testing.T) {
+	fakeCommands(t, false)
+	dir := t.TempDir()
+	now := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		_, err := Dump(context.Background(), &config.DatabaseConfig{}, "default", dir, now.Add(time.Duration(i)*time.Hour))
+		require.NoError(t, err)
+	}
+
+	latest, err := Find(dir, "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "default-20240601T080000Z", latest.Name)
+	first, err := Find(dir, "default-20240601T060000Z")
+	require.NoError(t, err)
+	assert.Equal(t, "default-20240601T060000Z", first.Name)
+	_, err = Find(dir, "default-20200101T000000Z")
+	assert.ErrorContains(t, err, "no backup")
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	names := func(backups []*Backup) []string {
+		var names []string
+		for _, b := range backups {
+			names = append(names, b.Name)
+		}
+		return names
+	}
+	dump := func(t *testing.T) string {
+		fakeCommands(t, false)
+		dir := t.TempDir()
+		for i := 0; i < 5; i++ {
+			_, err := Dump(context.Background(), &config.DatabaseConfig{}, "default", dir, now.AddDate(0, 0, -i))
+			require.NoError(t, err)
+		}
+		_, err := Dump(context.Background(), &config.DatabaseConfig{}, "tenant", dir, now.AddDate(0, 0, -9))
+		require.NoError(t, err)
+		return dir
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		removed   []string
+	}{
+		{"none", Retention{}, nil},
+		{"keep", Retention{Keep: 2}, []string{"default-20240608T000000Z", "default-20240607T000000Z", "default-20240606T000000Z"}},
+		{"max age", Retention{MaxAge: 72 * time.Hour}, []string{"default-20240606T000000Z"}},
+		{"either", Retention{Keep: 4, MaxAge: 24 * time.Hour}, []string{"default-20240606T000000Z"}},
+		{"newest", Retention{MaxAge: time.Nanosecond}, []string{"default-20240609T000000Z", "default-20240608T000000Z", "default-20240607T000000Z", "default-20240606T000000Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := dump(t)
+			removed, err := Prune(dir, "default", tt.retention, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.removed, names(removed))
+
+			backups, err := List(dir)
+			require.NoError(t, err)
+			assert.Len(t, backups, 6-len(tt.removed))
+			for _, b := range removed {
+				assert.NoFileExists(t, b.Path)
+			}
+		})
+	}
+}
+
+func TestList_Missing(t *testing.T) {
+	backups, err := List(filepath.Join(t.TempDir(), "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+}
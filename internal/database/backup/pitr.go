@@ -0,0 +1,293 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// ArchiveCommand returns the archive_command copying each completed WAL segment to dir, without overwriting
+// a segment archived already.
+func ArchiveCommand(dir string) (string, error) {
+	if !filepath.IsAbs(dir) || strings.ContainsAny(dir, "'%\n") {
+		return "", fmt.Errorf("the archive directory must be an absolute path without quotes or %%: %q", dir)
+	}
+	return fmt.Sprintf("test ! -f '%[1]s/%%f' && cp %%p '%[1]s/%%f'", filepath.Clean(dir)), nil
+}
+
+// ArchiveStatements returns the statements enabling WAL archiving to dir. wal_level and archive_mode only take
+// effect once the server restarts.
+func ArchiveStatements(dir string) ([]string, error) {
+	archiveCommand, err := ArchiveCommand(dir)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		"ALTER SYSTEM SET wal_level = 'replica'",
+		"ALTER SYSTEM SET archive_mode = 'on'",
+		"ALTER SYSTEM SET archive_command = " + pq.QuoteLiteral(archiveCommand),
+		"SELECT pg_reload_conf()",
+	}, nil
+}
+
+// ConfigureArchiving enables WAL archiving to dir, which needs a superuser, and reports whether the server must
+// be restarted for it to take effect.
+func ConfigureArchiving(ctx context.Context, db *sql.DB, dir string) (restart bool, err error) {
+	statements, err := ArchiveStatements(dir)
+	if err != nil {
+		return false, err
+	}
+	// ALTER SYSTEM cannot run inside a transaction.
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return false, fmt.Errorf("failed to configure WAL archiving: %w", err)
+		}
+	}
+	err = db.QueryRowContext(ctx,
+		"SELECT count(*) > 0 FROM pg_settings WHERE name IN ('wal_level', 'archive_mode') AND pending_restart").Scan(&restart)
+	return restart, err
+}
+
+// ArchiveStatus is the configuration of WAL archiving and the statistics of the archiver of a server.
+type ArchiveStatus struct {
+	WALLevel       string     `json:"wal_level"`
+	ArchiveMode    string     `json:"archive_mode"`
+	ArchiveCommand string     `json:"archive_command"`
+	PendingRestart bool       `json:"pending_restart"`
+	ArchivedCount  int64      `json:"archived_count"`
+	LastArchived   string     `json:"last_archived_wal,omitempty"`
+	LastArchivedAt *time.Time `json:"last_archived_time,omitempty"`
+	FailedCount    int64      `json:"failed_count"`
+	LastFailed     string     `json:"last_failed_wal,omitempty"`
+	LastFailedAt   *time.Time `json:"last_failed_time,omitempty"`
+}
+
+// CheckArchiving returns the status of WAL archiving of the server of db.
+func CheckArchiving(ctx context.Context, db *sql.DB) (*ArchiveStatus, error) {
+	s := &ArchiveStatus{}
+	var lastArchived, lastFailed sql.NullString
+	var lastArchivedAt, lastFailedAt sql.NullTime
+	err := db.QueryRowContext(ctx, `SELECT current_setting('wal_level'), current_setting('archive_mode'),
+        current_setting('archive_command'),
+        (SELECT count(*) > 0 FROM pg_settings WHERE name IN ('wal_level', 'archive_mode', 'archive_command') AND pending_restart),
+        archived_count, last_archived_wal, last_archived_time, failed_count, last_failed_wal, last_failed_time
+        FROM pg_stat_archiver`).Scan(&s.WALLevel, &s.ArchiveMode, &s.ArchiveCommand, &s.PendingRestart,
+		&s.ArchivedCount, &lastArchived, &lastArchivedAt, &s.FailedCount, &lastFailed, &lastFailedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check WAL archiving: %w", err)
+	}
+	s.LastArchived, s.LastFailed = lastArchived.String, lastFailed.String
+	if lastArchivedAt.Valid {
+		s.LastArchivedAt = &lastArchivedAt.Time
+	}
+	if lastFailedAt.Valid {
+		s.LastFailedAt = &lastFailedAt.Time
+	}
+	return s, nil
+}
+
+// Problems returns what prevents a point-in-time restore from the WAL archived to dir, none if it is possible
+// once a base backup was taken. dir is not checked when empty.
+func (s *ArchiveStatus) Problems(dir string) []string {
+	var problems []string
+	if s.WALLevel == "minimal" {
+		problems = append(problems, "wal_level is minimal, the WAL cannot be replayed: set it to replica")
+	}
+	if s.ArchiveMode == "off" {
+		problems = append(problems, "archive_mode is off")
+	}
+	if dir != "" {
+		if want, err := ArchiveCommand(dir); err != nil {
+			problems = append(problems, err.Error())
+		} else if s.ArchiveCommand != want {
+			problems = append(problems, fmt.Sprintf("archive_command is %q, not archiving to %s", s.ArchiveCommand, dir))
+		}
+	}
+	if s.PendingRestart {
+		problems = append(problems, "the server must be restarted for the archiving settings to take effect")
+	}
+	if s.LastFailedAt != nil && (s.LastArchivedAt == nil || s.LastFailedAt.After(*s.LastArchivedAt)) {
+		problems = append(problems, fmt.Sprintf("archiving WAL segment %s failed at %s; see the server log",
+			s.LastFailed, s.LastFailedAt.Format(time.RFC3339)))
+	}
+	if s.ArchivedCount == 0 {
+		problems = append(problems, "no WAL segment was archived yet")
+	}
+	return problems
+}
+
+// SwitchWAL closes the current WAL segment, so the server archives it, and waits for the archiver to report a
+// segment archived or failed, until ctx is done.
+func SwitchWAL(ctx context.Context, db *sql.DB) (*ArchiveStatus, error) {
+	before, err := CheckArchiving(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, "SELECT pg_switch_wal()"); err != nil {
+		return nil, fmt.Errorf("failed to switch the WAL segment: %w", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no WAL segment was archived after switching: %w", ctx.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+		after, err := CheckArchiving(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		if after.ArchivedCount > before.ArchivedCount {
+			return after, nil
+		}
+		if after.FailedCount > before.FailedCount {
+			return after, fmt.Errorf("archiving WAL segment %s failed; see the server log", after.LastFailed)
+		}
+	}
+}
+
+// BaseBackup takes a base backup of the server of db with pg_basebackup into a new directory of dir, as a
+// compressed tar of the data directory, base.tar.gz, and returns the directory.
+func BaseBackup(ctx context.Context, db *config.DatabaseConfig, dir string, now time.Time) (string, error) {
+	if err := checkDriver(db); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create the base backups directory: %w", err)
+	}
+	target := filepath.Join(dir, "base-"+now.UTC().Format(nameFormat))
+	// The WAL needed to make the backup consistent is restored from the archive, like the rest.
+	cmd := command(ctx, "pg_basebackup", "--pgdata="+target, "--format=tar", "--gzip", "--wal-method=none",
+		"--checkpoint=fast")
+	cmd.Env = append(os.Environ(), pgEnv(db)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(target)
+		return "", fmt.Errorf("pg_basebackup failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return target, nil
+}
+
+// RestoreOptions configure a point-in-time restore.
+type RestoreOptions struct {
+	// BaseBackup is the directory written by BaseBackup, which must be older than TargetTime.
+	BaseBackup string
+	// ArchiveDir is the directory the WAL was archived to.
+	ArchiveDir string
+	// DataDir is the data directory of the new server, which must not exist or be empty.
+	DataDir string
+	// TargetTime is the time the database is restored to.
+	TargetTime time.Time
+	// Port is the port of the new server, so it can run next to the original one.
+	Port int
+}
+
+// PrepareRestore prepares a new data directory for a point-in-time restore: it extracts the base backup into
+// it and configures the new server to replay the archived WAL up to the target time and then accept writes.
+// Starting the server, with pg_ctl, performs the restore; the original server is not touched.
+func PrepareRestore(options RestoreOptions) error {
+	if options.TargetTime.IsZero() {
+		return errors.New("a target time is required")
+	}
+	if options.Port <= 0 {
+		return errors.New("a port is required")
+	}
+	archiveDir, err := filepath.Abs(options.ArchiveDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(archiveDir); err != nil {
+		return fmt.Errorf("the WAL archive is not readable: %w", err)
+	}
+	if entries, err := os.ReadDir(options.DataDir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("the data directory %s is not empty", options.DataDir)
+	}
+	if err := os.MkdirAll(options.DataDir, 0700); err != nil {
+		return fmt.Errorf("failed to create the data directory: %w", err)
+	}
+	if err := extractTarGz(filepath.Join(options.BaseBackup, "base.tar.gz"), options.DataDir); err != nil {
+		return fmt.Errorf("failed to extract the base backup: %w", err)
+	}
+
+	settings := fmt.Sprintf("\n# Point-in-time restore\nport = %d\narchive_mode = 'off'\nrestore_command = %s\n"+
+		"recovery_target_time = %s\nrecovery_target_action = 'promote'\n", options.Port,
+		pq.QuoteLiteral(fmt.Sprintf("cp '%s/%%f' %%p", archiveDir)),
+		pq.QuoteLiteral(options.TargetTime.Format("2006-01-02 15:04:05.999999-07:00")))
+	f, err := os.OpenFile(filepath.Join(options.DataDir, "postgresql.auto.conf"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(settings)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(options.DataDir, "recovery.signal"), nil, 0600)
+}
+
+// extractTarGz extracts the regular files, directories and symbolic links of a gzipped tar into dir, refusing
+// entries outside of it.
+func extractTarGz(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, header.Name)
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid entry %q", header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0700)
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, target)
+		case tar.TypeReg:
+			if err = os.MkdirAll(filepath.Dir(target), 0700); err == nil {
+				err = extractFile(target, tr, os.FileMode(header.Mode)&0700)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes the content of r to a new file.
+func extractFile(path string, r io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
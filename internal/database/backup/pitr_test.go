@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+func TestArchiveStatements(t *testing.T) {
+	statements, err := ArchiveStatements("/var/lib/postgresql/wal/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"ALTER SYSTEM SET wal_level = 'replica'",
+		"ALTER SYSTEM SET archive_mode = 'on'",
+		`ALTER SYSTEM SET archive_command = 'test ! -f ''/var/lib/postgresql/wal/%f'' && cp %p ''/var/lib/postgresql/wal/%f'''`,
+		"SELECT pg_reload_conf()",
+	}, statements)
+
+	for _, dir := range []string{"wal", "/wal's", "/wal%"} {
+		_, err := ArchiveStatements(dir)
+		assert.Error(t, err, dir)
+	}
+}
+
+func TestArchiveStatus_Problems(t *testing.T) {
+	archived := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+	failed := archived.Add(time.Minute)
+	command, _ := ArchiveCommand("/wal")
+	ok := ArchiveStatus{WALLevel: "replica", ArchiveMode: "on", ArchiveCommand: command, ArchivedCount: 3, LastArchivedAt: &archived}
+	assert.Empty(t, ok.Problems("/wal"))
+	assert.Empty(t, ok.Problems(""))
+
+	s := ok
+	s.ArchiveCommand = "cp %p /elsewhere/%f"
+	assert.Equal(t, []string{`archive_command is "cp %p /elsewhere/%f", not archiving to /wal`}, s.Problems("/wal"))
+
+	s = ArchiveStatus{WALLevel: "minimal", ArchiveMode: "off", PendingRestart: true, FailedCount: 1,
+		LastFailed: "000000010000000000000002", LastFailedAt: &failed}
+	assert.Len(t, s.Problems(""), 5)
+
+	s = ok
+	s.LastFailed, s.LastFailedAt = "000000010000000000000002", &failed
+	assert.Equal(t, []string{"archiving WAL segment 000000010000000000000002 failed at 2024-06-01T06:01:00Z; see the server log"}, s.Problems(""))
+}
+
+func TestBaseBackup(t *testing.T) {
+	calls := fakeCommands(t, false)
+	dir := t.TempDir()
+	target, err := BaseBackup(context.Background(), &config.DatabaseConfig{}, dir, time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "base-20240601T060000Z"), target)
+	assert.Equal(t, []string{"pg_basebackup --pgdata=" + target + " --format=tar --gzip --wal-method=none --checkpoint=fast"}, *calls)
+}
+
+// writeBaseBackup writes a base.tar.gz holding the given files into a new directory, and returns it.
+func writeBaseBackup(t *testing.T, files map[string]string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base.tar.gz"), buf.Bytes(), 0600))
+	return dir
+}
+
+func TestPrepareRestore(t *testing.T) {
+	base := writeBaseBackup(t, map[string]string{
+		"PG_VERSION":           "16\n",
+		"global/pg_control":    "control",
+		"postgresql.auto.conf": "wal_level = 'replica'\n",
+	})
+	archive := t.TempDir()
+	dataDir := filepath.Join(t.TempDir(), "restored")
+	target := time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	require.NoError(t, PrepareRestore(RestoreOptions{BaseBackup: base, ArchiveDir: archive, DataDir: dataDir, TargetTime: target, Port: 5433}))
+	assert.FileExists(t, filepath.Join(dataDir, "global", "pg_control"))
+	assert.FileExists(t, filepath.Join(dataDir, "recovery.signal"))
+	conf, err := os.ReadFile(filepath.Join(dataDir, "postgresql.auto.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "wal_level = 'replica'\n\n# Point-in-time restore\nport = 5433\narchive_mode = 'off'\n"+
+		"restore_command = 'cp ''"+archive+"/%f'' %p'\nrecovery_target_time = '2024-06-01 12:30:00+00:00'\n"+
+		"recovery_target_action = 'promote'\n", string(conf))
+
+	err = PrepareRestore(RestoreOptions{BaseBackup: base, ArchiveDir: archive, DataDir: dataDir, TargetTime: target, Port: 5433})
+	assert.ErrorContains(t, err, "is not empty")
+	err = PrepareRestore(RestoreOptions{BaseBackup: base, ArchiveDir: archive, DataDir: t.TempDir(), Port: 5433})
+	assert.ErrorContains(t, err, "target time")
+}
+
+func TestPrepareRestore_InvalidEntry(t *testing.T) {
+	base := writeBaseBackup(t, map[string]string{"../escaped": "x"})
+	err := PrepareRestore(RestoreOptions{BaseBackup: base, ArchiveDir: t.TempDir(), DataDir: t.TempDir(),
+		TargetTime: time.Now(), Port: 5433})
+	assert.ErrorContains(t, err, "invalid entry")
+}
@@ -0,0 +1,336 @@
+package datadiff
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Row holds the values of one table row in the order of TableData.Columns. Values are normalized to nil, bool,
+// int64, float64, string, or time.Time so rows read from different databases compare equal.
+type Row []interface{}
+
+// TableData is the content of a table read from one database.
+type TableData struct {
+	Name    string
+	Columns []string
+	// Key lists the primary key columns. Tables without a primary key are keyed by all their columns.
+	Key  []string
+	Rows []Row
+}
+
+// TableDiff describes how the rows of a table in a target database differ from the same table in a source
+// database.
+type TableDiff struct {
+	Table   string
+	Columns []string
+	Key     []string
+	// Missing are source rows with no row of the same key in the target.
+	Missing []Row
+	// Extra are target rows with no row of the same key in the source.
+	Extra []Row
+	// Changed are source rows whose target row has the same key but different values.
+	Changed []Row
+}
+
+// Empty reports whether the table holds the same rows in both databases.
+func (d *TableDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0
+}
+
+// MatchTables returns the tables matching any of the glob patterns (as understood by path.Match, e.g.
+// "lookup_*"), sorted by name. With no patterns every table matches.
+func MatchTables(tables, patterns []string) ([]string, error) {
+	var matched []string
+	for _, table := range tables {
+		if len(patterns) == 0 {
+			matched = append(matched, table)
+			continue
+		}
+		for _, pattern := range patterns {
+			ok, err := path.Match(pattern, table)
+			if err != nil {
+				return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+			}
+			if ok {
+				matched = append(matched, table)
+				break
+			}
+		}
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// LoadTable reads every row of a table in the public schema, ordered by its key.
+func LoadTable(db *sql.DB, table string) (*TableData, error) {
+	data := &TableData{Name: table}
+
+	columns, err := db.Query(`
+		SELECT column_name
+		FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = $1
+		ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns of %s: %w", table, err)
+	}
+	data.Columns, err = scanStrings(columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	if len(data.Columns) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", table)
+	}
+
+	key, err := db.Query(`
+		SELECT a.attname
+		FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indrelid = to_regclass($1) AND i.indisprimary
+		ORDER BY array_position(i.indkey, a.attnum)`, pq.QuoteIdentifier(table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query primary key of %s: %w", table, err)
+	}
+	data.Key, err = scanStrings(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read primary key of %s: %w", table, err)
+	}
+	if len(data.Key) == 0 {
+		data.Key = data.Columns
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s",
+		quoteIdentifiers(data.Columns), pq.QuoteIdentifier(table), quoteIdentifiers(data.Key)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rows of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values := make([]interface{}, len(data.Columns))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan row of %s: %w", table, err)
+		}
+		row := make(Row, len(values))
+		for i, value := range values {
+			row[i] = normalize(value)
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows of %s: %w", table, err)
+	}
+	return data, nil
+}
+
+// Diff compares the rows of a table in the source and target databases by key. Both must have the same columns.
+func Diff(source, target *TableData) (*TableDiff, error) {
+	if !sameColumns(source.Columns, target.Columns) {
+		return nil, fmt.Errorf("table %s has different columns: %v in the source, %v in the target",
+			source.Name, source.Columns, target.Columns)
+	}
+
+	diff := &TableDiff{Table: source.Name, Columns: source.Columns, Key: source.Key}
+	positions := columnPositions(target.Columns)
+	targetRows := make(map[string]Row, len(target.Rows))
+	for _, row := range target.Rows {
+		targetRows[rowKey(target.Columns, target.Key, row)] = row
+	}
+
+	seen := make(map[string]bool, len(source.Rows))
+	for _, row := range source.Rows {
+		key := rowKey(source.Columns, source.Key, row)
+		seen[key] = true
+		other, exists := targetRows[key]
+		if !exists {
+			diff.Missing = append(diff.Missing, row)
+			continue
+		}
+		for i, column := range source.Columns {
+			if literal(row[i]) != literal(other[positions[column]]) {
+				diff.Changed = append(diff.Changed, row)
+				break
+			}
+		}
+	}
+	for _, row := range target.Rows {
+		if !seen[rowKey(target.Columns, target.Key, row)] {
+			diff.Extra = append(diff.Extra, reorder(row, target.Columns, source.Columns))
+		}
+	}
+	return diff, nil
+}
+
+// WriteSyncSQL writes the statements that make the target table hold the same rows as the source table:
+// deletes of extra rows, updates of changed rows, and inserts of missing rows, wrapped in a transaction.
+func WriteSyncSQL(w io.Writer, diffs []*TableDiff) error {
+	var b strings.Builder
+	b.WriteString("BEGIN;\n")
+	for _, diff := range diffs {
+		if diff.Empty() {
+			continue
+		}
+		table := pq.QuoteIdentifier(diff.Table)
+		fmt.Fprintf(&b, "\n-- %s: %d to insert, %d to update, %d to delete\n",
+			diff.Table, len(diff.Missing), len(diff.Changed), len(diff.Extra))
+
+		for _, row := range diff.Extra {
+			fmt.Fprintf(&b, "DELETE FROM %s WHERE %s;\n", table, keyCondition(diff, row))
+		}
+		for _, row := range diff.Changed {
+			var assignments []string
+			for i, column := range diff.Columns {
+				if !contains(diff.Key, column) {
+					assignments = append(assignments, pq.QuoteIdentifier(column)+" = "+literal(row[i]))
+				}
+			}
+			fmt.Fprintf(&b, "UPDATE %s SET %s WHERE %s;\n", table, strings.Join(assignments, ", "), keyCondition(diff, row))
+		}
+		for _, row := range diff.Missing {
+			values := make([]string, len(row))
+			for i, value := range row {
+				values[i] = literal(value)
+			}
+			fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES (%s);\n", table, quoteIdentifiers(diff.Columns), strings.Join(values, ", "))
+		}
+	}
+	b.WriteString("\nCOMMIT;\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// keyCondition returns the WHERE condition selecting a row by its key.
+func keyCondition(diff *TableDiff, row Row) string {
+	positions := columnPositions(diff.Columns)
+	conditions := make([]string, len(diff.Key))
+	for i, column := range diff.Key {
+		value := row[positions[column]]
+		if value == nil {
+			conditions[i] = pq.QuoteIdentifier(column) + " IS NULL"
+		} else {
+			conditions[i] = pq.QuoteIdentifier(column) + " = " + literal(value)
+		}
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// literal renders a normalized value as a SQL literal. It doubles as the canonical form values are compared in.
+func literal(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return pq.QuoteLiteral(v.UTC().Format(time.RFC3339Nano))
+	case string:
+		return pq.QuoteLiteral(v)
+	default:
+		return pq.QuoteLiteral(fmt.Sprint(v))
+	}
+}
+
+// normalize converts a value scanned by the driver into one of the types literal understands.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// rowKey returns the canonical form of a row's key.
+func rowKey(columns, key []string, row Row) string {
+	positions := columnPositions(columns)
+	parts := make([]string, len(key))
+	for i, column := range key {
+		parts[i] = literal(row[positions[column]])
+	}
+	return strings.Join(parts, ",")
+}
+
+// reorder returns the row's values in the order of the wanted columns.
+func reorder(row Row, columns, wanted []string) Row {
+	positions := columnPositions(columns)
+	reordered := make(Row, len(wanted))
+	for i, column := range wanted {
+		reordered[i] = row[positions[column]]
+	}
+	return reordered
+}
+
+func columnPositions(columns []string) map[string]int {
+	positions := make(map[string]int, len(columns))
+	for i, column := range columns {
+		positions[column] = i
+	}
+	return positions
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, column := range a {
+		if !contains(b, column) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pq.QuoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,83 @@
+package datadiff
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTables(t *testing.T) {
+	tables := []string{"users", "lookup_countries", "lookup_currencies", "models"}
+
+	matched, err := MatchTables(tables, []string{"lookup_*"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lookup_countries", "lookup_currencies"}, matched)
+
+	matched, err = MatchTables(tables, nil)
+	assert.NoError(t, err)
+	assert.Len(t, matched, 4)
+
+	_, err = MatchTables(tables, []string{"["})
+	assert.Error(t, err)
+}
+
+func TestDiffAndSyncSQL(t *testing.T) {
+	source := &TableData{
+		Name:    "lookup_countries",
+		Columns: []string{"code", "name", "added_at"},
+		Key:     []string{"code"},
+		Rows: []Row{
+			{"DE", "Germany", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{"FR", "France", nil},
+			{"IT", "Italy", nil},
+		},
+	}
+	// The target lists its columns in another order.
+	target := &TableData{
+		Name:    "lookup_countries",
+		Columns: []string{"name", "code", "added_at"},
+		Key:     []string{"code"},
+		Rows: []Row{
+			{"Germany", "DE", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{"Frankreich", "FR", nil},
+			{"O'Land", "XX", nil},
+		},
+	}
+
+	diff, err := Diff(source, target)
+	assert.NoError(t, err)
+	assert.Equal(t, []Row{{"IT", "Italy", nil}}, diff.Missing)
+	assert.Equal(t, []Row{{"FR", "France", nil}}, diff.Changed)
+	assert.Equal(t, []Row{{"XX", "O'Land", nil}}, diff.Extra)
+
+	var sql strings.Builder
+	assert.NoError(t, WriteSyncSQL(&sql, []*TableDiff{diff, {Table: "lookup_empty"}}))
+	assert.Equal(t, `BEGIN;
+
+-- lookup_countries: 1 to insert, 1 to update, 1 to delete
+DELETE FROM "lookup_countries" WHERE "code" = 'XX';
+UPDATE "lookup_countries" SET "name" = 'France', "added_at" = NULL WHERE "code" = 'FR';
+INSERT INTO "lookup_countries" ("code", "name", "added_at") VALUES ('IT', 'Italy', NULL);
+
+COMMIT;
+`, sql.String())
+}
+
+func TestDiff_DifferentColumns(t *testing.T) {
+	source := &TableData{Name: "lookup", Columns: []string{"id", "name"}, Key: []string{"id"}}
+	target := &TableData{Name: "lookup", Columns: []string{"id", "label"}, Key: []string{"id"}}
+
+	_, err := Diff(source, target)
+	assert.Error(t, err)
+}
+
+func TestLiteral(t *testing.T) {
+	assert.Equal(t, "NULL", literal(nil))
+	assert.Equal(t, "TRUE", literal(true))
+	assert.Equal(t, "42", literal(normalize(int32(42))))
+	assert.Equal(t, "1.5", literal(1.5))
+	assert.Equal(t, "'it''s'", literal(normalize([]byte("it's"))))
+	assert.Equal(t, "'2024-01-01T00:00:00Z'", literal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,227 @@
+// Package dedupe finds the records of a model in a Postgres database that duplicate each other by key fields,
+// and merges each group of duplicates into the one record a strategy keeps: the references of other models to
+// the duplicates, declared with field references (see model.Field), are moved to the record kept, and the
+// duplicates deleted.
+package dedupe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// Strategy chooses the record of a group of duplicates that is kept.
+type Strategy string
+
+const (
+	// StrategyNewest keeps the record updated last.
+	StrategyNewest Strategy = "newest"
+	// StrategyOldest keeps the record created first.
+	StrategyOldest Strategy = "oldest"
+)
+
+// ParseStrategy converts a strategy name as given on the command line into a Strategy.
+func ParseStrategy(name string) (Strategy, error) {
+	switch strategy := Strategy(strings.ToLower(strings.TrimSpace(name))); strategy {
+	case StrategyNewest, StrategyOldest:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("invalid strategy %q (expected %q or %q)", name, StrategyNewest, StrategyOldest)
+	}
+}
+
+// order returns the ORDER BY clause putting the record a strategy keeps first, ties going to the highest or
+// lowest ID.
+func (s Strategy) order() string {
+	if s == StrategyOldest {
+		return "created_at ASC, id ASC"
+	}
+	return "updated_at DESC, id DESC"
+}
+
+// Options select the duplicates of a model.
+type Options struct {
+	// Keys are the fields whose values duplicates share. Records with a NULL key are never duplicates.
+	Keys []string
+	// IgnoreCase compares the keys as lowercase text, so that Ada@example.com duplicates ada@example.com.
+	IgnoreCase bool
+	Strategy   Strategy
+}
+
+// Group is a group of duplicates.
+type Group struct {
+	// Key holds the values of the keys the duplicates share, as text.
+	Key []string `json:"key"`
+	// Keep is the ID of the record kept, and Merge the IDs of the duplicates merged into it.
+	Keep  int64   `json:"keep"`
+	Merge []int64 `json:"merge"`
+	// References counts the references to the duplicates moved to the record kept, by Model.field.
+	References map[string]int64 `json:"references,omitempty"`
+}
+
+// Relation is a field of a model referencing the model deduplicated.
+type Relation struct {
+	Model  string
+	Field  string
+	Table  string
+	Column string
+}
+
+// String returns the relation as Model.field.
+func (r Relation) String() string {
+	return r.Model + "." + r.Field
+}
+
+// Relations returns the fields of the definitions referencing def.
+func Relations(defs []*model.ModelDefinition, def *model.ModelDefinition) []Relation {
+	var relations []Relation
+	for _, other := range defs {
+		for i := range other.Fields {
+			field := &other.Fields[i]
+			if strings.EqualFold(field.References, def.Name) {
+				relations = append(relations, Relation{Model: other.Name, Field: field.Name,
+					Table: model.TableName(other), Column: model.ColumnName(field)})
+			}
+		}
+	}
+	return relations
+}
+
+// keyColumns returns the columns of the keys of opts, preceded by the tenant column of models scoped to
+// tenants, since records of different tenants never duplicate each other.
+func keyColumns(def *model.ModelDefinition, opts Options) ([]string, error) {
+	if len(opts.Keys) == 0 {
+		return nil, fmt.Errorf("no key to find duplicates by")
+	}
+	var columns []string
+	if tenant := def.Field(def.Options.TenantField); tenant != nil {
+		columns = append(columns, model.ColumnName(tenant))
+	}
+	for _, name := range opts.Keys {
+		field := def.Field(name)
+		if field == nil {
+			return nil, fmt.Errorf("model %s has no field %s", def.Name, name)
+		}
+		if field.Encrypted {
+			return nil, fmt.Errorf("field %s of model %s is encrypted, so equal values are stored differently", field.Name, def.Name)
+		}
+		if column := model.ColumnName(field); !containsString(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// findQuery returns the query listing the groups of duplicates of a model: the values of the key columns and
+// the IDs of the records, the record kept first, ordered by key.
+func findQuery(def *model.ModelDefinition, columns []string, opts Options) string {
+	keys := make([]string, len(columns))
+	var conditions []string
+	for i, column := range columns {
+		keys[i] = pq.QuoteIdentifier(column) + "::text"
+		if opts.IgnoreCase {
+			keys[i] = "lower(" + keys[i] + ")"
+		}
+		conditions = append(conditions, pq.QuoteIdentifier(column)+" IS NOT NULL")
+	}
+	key := strings.Join(keys, ", ")
+	return fmt.Sprintf("SELECT ARRAY[%s], array_agg(id ORDER BY %s) FROM %s WHERE %s GROUP BY %s HAVING count(*) > 1 ORDER BY %s",
+		key, opts.Strategy.order(), pq.QuoteIdentifier(model.TableName(def)), strings.Join(conditions, " AND "), key, key)
+}
+
+// Find returns the groups of duplicates of def, ordered by key, each with the record opts.Strategy keeps.
+func Find(ctx context.Context, db *sql.DB, def *model.ModelDefinition, opts Options) ([]Group, error) {
+	columns, err := keyColumns(def, opts)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, findQuery(def, columns, opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the duplicates of %s: %w", def.Name, err)
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var key []string
+		var ids []int64
+		if err := rows.Scan(pq.Array(&key), pq.Array(&ids)); err != nil {
+			return nil, err
+		}
+		groups = append(groups, Group{Key: key, Keep: ids[0], Merge: ids[1:]})
+	}
+	return groups, rows.Err()
+}
+
+// CountReferences sets the References of the groups: the number of references of every relation to their
+// duplicates.
+func CountReferences(ctx context.Context, db *sql.DB, groups []Group, relations []Relation) error {
+	for i := range groups {
+		groups[i].References = make(map[string]int64)
+		for _, relation := range relations {
+			var count int64
+			query := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s = ANY($1)",
+				pq.QuoteIdentifier(relation.Table), pq.QuoteIdentifier(relation.Column))
+			if err := db.QueryRowContext(ctx, query, pq.Array(groups[i].Merge)).Scan(&count); err != nil {
+				return fmt.Errorf("failed to count the references of %s: %w", relation, err)
+			}
+			if count > 0 {
+				groups[i].References[relation.String()] = count
+			}
+		}
+	}
+	return nil
+}
+
+// mergeStatements returns the statements merging the duplicates of a group of a model, given as $2, into the
+// record kept, given as $1: the references of every relation are moved to the record kept, then the duplicates
+// deleted.
+func mergeStatements(def *model.ModelDefinition, relations []Relation) []string {
+	var statements []string
+	for _, relation := range relations {
+		statements = append(statements, fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s = ANY($2)",
+			pq.QuoteIdentifier(relation.Table), pq.QuoteIdentifier(relation.Column), pq.QuoteIdentifier(relation.Column)))
+	}
+	return append(statements, fmt.Sprintf("DELETE FROM %s WHERE id = ANY($2) AND id <> $1", pq.QuoteIdentifier(model.TableName(def))))
+}
+
+// Merge merges every group of duplicates of def into its record kept, each group in its own transaction, and
+// returns the number of groups merged. It stops at the first group failing to merge, which is left as it was,
+// e.g. when moving a reference breaks a unique constraint of the referencing table.
+func Merge(ctx context.Context, db *sql.DB, def *model.ModelDefinition, relations []Relation, groups []Group) (int, error) {
+	statements := mergeStatements(def, relations)
+	for merged, group := range groups {
+		if err := mergeGroup(ctx, db, statements, group); err != nil {
+			return merged, fmt.Errorf("failed to merge %v into %s %d: %w", group.Merge, def.Name, group.Keep, err)
+		}
+	}
+	return len(groups), nil
+}
+
+func mergeGroup(ctx context.Context, db *sql.DB, statements []string, group Group) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, group.Keep, pq.Array(group.Merge)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
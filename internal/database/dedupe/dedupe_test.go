@@ -0,0 +1,80 @@
+package dedupe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func newDedupeTestModels() []*model.ModelDefinition {
+	contact := model.NewModelDefinition("Contact", []model.Field{
+		model.NewField("email", "string", "", false, false),
+		model.NewField("name", "string", "", false, false),
+		{Name: "ssn", Type: "string", Encrypted: true},
+	})
+	note := model.NewModelDefinition("Note", []model.Field{
+		{Name: "contact_id", Type: "int64", References: "Contact"},
+		{Name: "author_id", Type: "int64", References: "User"},
+	})
+	deal := model.NewModelDefinition("Deal", []model.Field{
+		{Name: "buyer_id", Type: "*int64", References: "contact"},
+	})
+	return []*model.ModelDefinition{contact, deal, note}
+}
+
+func TestParseStrategy(t *testing.T) {
+	strategy, err := ParseStrategy(" Oldest")
+	require.NoError(t, err)
+	assert.Equal(t, StrategyOldest, strategy)
+	_, err = ParseStrategy("random")
+	assert.EqualError(t, err, `invalid strategy "random" (expected "newest" or "oldest")`)
+}
+
+func TestRelations(t *testing.T) {
+	defs := newDedupeTestModels()
+	assert.Equal(t, []Relation{
+		{Model: "Deal", Field: "buyer_id", Table: "deals", Column: "buyer_id"},
+		{Model: "Note", Field: "contact_id", Table: "notes", Column: "contact_id"},
+	}, Relations(defs, defs[0]))
+}
+
+func TestFindQuery(t *testing.T) {
+	contact := newDedupeTestModels()[0]
+
+	columns, err := keyColumns(contact, Options{Keys: []string{"email"}})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT ARRAY["email"::text], array_agg(id ORDER BY updated_at DESC, id DESC) FROM "contacts" `+
+		`WHERE "email" IS NOT NULL GROUP BY "email"::text HAVING count(*) > 1 ORDER BY "email"::text`,
+		findQuery(contact, columns, Options{Keys: []string{"email"}, Strategy: StrategyNewest}))
+
+	require.NoError(t, contact.SetTenantField("org_id"))
+	opts := Options{Keys: []string{"Email", "name"}, IgnoreCase: true, Strategy: StrategyOldest}
+	columns, err = keyColumns(contact, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"org_id", "email", "name"}, columns)
+	assert.Equal(t, `SELECT ARRAY[lower("org_id"::text), lower("email"::text), lower("name"::text)], `+
+		`array_agg(id ORDER BY created_at ASC, id ASC) FROM "contacts" `+
+		`WHERE "org_id" IS NOT NULL AND "email" IS NOT NULL AND "name" IS NOT NULL `+
+		`GROUP BY lower("org_id"::text), lower("email"::text), lower("name"::text) HAVING count(*) > 1 `+
+		`ORDER BY lower("org_id"::text), lower("email"::text), lower("name"::text)`,
+		findQuery(contact, columns, opts))
+
+	_, err = keyColumns(contact, Options{Keys: []string{"phone"}})
+	assert.EqualError(t, err, "model Contact has no field phone")
+	_, err = keyColumns(contact, Options{Keys: []string{"ssn"}})
+	assert.EqualError(t, err, "field ssn of model Contact is encrypted, so equal values are stored differently")
+	_, err = keyColumns(contact, Options{})
+	assert.EqualError(t, err, "no key to find duplicates by")
+}
+
+func TestMergeStatements(t *testing.T) {
+	defs := newDedupeTestModels()
+	assert.Equal(t, []string{
+		`UPDATE "deals" SET "buyer_id" = $1 WHERE "buyer_id" = ANY($2)`,
+		`UPDATE "notes" SET "contact_id" = $1 WHERE "contact_id" = ANY($2)`,
+		`DELETE FROM "contacts" WHERE id = ANY($2) AND id <> $1`,
+	}, mergeStatements(defs[0], Relations(defs, defs[0])))
+}
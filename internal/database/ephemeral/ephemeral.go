@@ -0,0 +1,126 @@
+// Package ephemeral starts disposable Postgres containers with docker, to run migrations, seeds and tests
+// against an empty database without touching a real one.
+package ephemeral
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// DefaultImage is the image of the containers unless another is given.
+const DefaultImage = "postgres:16-alpine"
+
+// ErrNoDocker is returned by Start when the docker CLI is not installed.
+var ErrNoDocker = errors.New("docker is required to start an ephemeral database")
+
+// Container is a running Postgres container, removed once stopped.
+type Container struct {
+	ID    string
+	Image string
+	// Database is the configuration of the database of the container, reachable on a random port of the
+	// loopback interface.
+	Database config.DatabaseConfig
+}
+
+// Start starts a container of image, DefaultImage if empty, and returns it once its database accepts
+// connections, or an error if it does not before ctx is done, in which case the container is stopped.
+func Start(ctx context.Context, image string) (*Container, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, ErrNoDocker
+	}
+	if image == "" {
+		image = DefaultImage
+	}
+	password := make([]byte, 12)
+	rand.Read(password)
+	c := &Container{Image: image, Database: config.DatabaseConfig{
+		Driver:   "postgres",
+		Host:     "127.0.0.1",
+		User:     "grayv",
+		Password: hex.EncodeToString(password),
+		Name:     "grayv",
+		SSLMode:  "disable",
+	}}
+
+	out, err := exec.CommandContext(ctx, "docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_USER="+c.Database.User, "-e", "POSTGRES_PASSWORD="+c.Database.Password,
+		"-e", "POSTGRES_DB="+c.Database.Name, "-p", "127.0.0.1::5432", image).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start a %s container: %w", image, commandError(err))
+	}
+	c.ID = strings.TrimSpace(string(out))
+	if err := c.wait(ctx); err != nil {
+		c.Stop()
+		return nil, err
+	}
+	return c, nil
+}
+
+// wait finds the port of the container and waits for its database to accept connections.
+func (c *Container) wait(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, "docker", "port", c.ID, "5432/tcp").Output()
+	if err != nil {
+		return fmt.Errorf("failed to find the port of the container: %w", commandError(err))
+	}
+	_, port, err := net.SplitHostPort(strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0]))
+	if err == nil {
+		c.Database.Port, err = strconv.Atoi(port)
+	}
+	if err != nil {
+		return fmt.Errorf("unexpected port of the container %q", out)
+	}
+
+	db, err := sql.Open("postgres", c.URL())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for {
+		// The image restarts its server once initialized, which only listens on TCP afterwards.
+		if err = db.PingContext(ctx); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the database of the container did not accept connections: %w", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// URL returns the postgres:// URL of the database of the container.
+func (c *Container) URL() string {
+	d := c.Database
+	return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=%s", d.User, d.Password,
+		net.JoinHostPort(d.Host, strconv.Itoa(d.Port)), d.Name, d.SSLMode)
+}
+
+// Stop stops the container, which removes it with its data.
+func (c *Container) Stop() error {
+	if err := exec.Command("docker", "stop", c.ID).Run(); err != nil {
+		return fmt.Errorf("failed to stop the container %s: %w", c.ID, commandError(err))
+	}
+	return nil
+}
+
+// commandError returns the error of a command with its standard error.
+func commandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,325 @@
+// Package export extracts the rows of a model's table, or some of its columns, as a CSV file or an Excel
+// workbook for business users, formatting numbers and times for their locale.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/encryption"
+)
+
+// Formats.
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+// Locale is how numbers and times are written in CSV files. Excel workbooks hold typed cells instead, which
+// spreadsheet applications display in the locale of their user.
+type Locale struct {
+	// Delimiter separates the fields of a CSV record. Locales with a decimal comma use a semicolon, which
+	// is what spreadsheet applications expect there.
+	Delimiter rune
+	// DecimalSeparator separates the integer and fractional parts of numbers.
+	DecimalSeparator string
+	// DateFormat is the Go layout of times, e.g. "02.01.2006 15:04".
+	DateFormat string
+}
+
+// Locales are the predefined locales, by language tag. DefaultLocale is "en-US".
+var Locales = map[string]Locale{
+	"en-US": {Delimiter: ',', DecimalSeparator: ".", DateFormat: "01/02/2006 15:04:05"},
+	"en-GB": {Delimiter: ',', DecimalSeparator: ".", DateFormat: "02/01/2006 15:04:05"},
+	"de-DE": {Delimiter: ';', DecimalSeparator: ",", DateFormat: "02.01.2006 15:04:05"},
+	"fr-FR": {Delimiter: ';', DecimalSeparator: ",", DateFormat: "02/01/2006 15:04:05"},
+	"es-ES": {Delimiter: ';', DecimalSeparator: ",", DateFormat: "02/01/2006 15:04:05"},
+	"nl-NL": {Delimiter: ';', DecimalSeparator: ",", DateFormat: "02-01-2006 15:04:05"},
+	"iso":   {Delimiter: ',', DecimalSeparator: ".", DateFormat: time.RFC3339},
+}
+
+// DefaultLocale is the locale of exports that do not set one.
+const DefaultLocale = "en-US"
+
+// LocaleNames returns the names of the predefined locales, sorted.
+func LocaleNames() []string {
+	names := make([]string, 0, len(Locales))
+	for name := range Locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options configures an export.
+type Options struct {
+	// Format is CSV or XLSX.
+	Format string
+	// Columns are the columns exported, in order; every column of the table when empty.
+	Columns []string
+	// Locale formats the values of CSV files.
+	Locale Locale
+	// Location is the time zone times are written in, UTC if nil.
+	Location *time.Location
+	// BOM starts CSV files with a UTF-8 byte order mark, without which Excel reads them in the legacy
+	// encoding of the system.
+	BOM bool
+	// Keyring, if set, decrypts the values of encrypted fields. Without it their ciphertext is exported.
+	Keyring *encryption.Keyring
+	// BatchSize is the number of rows read at once, 1000 if not positive.
+	BatchSize int
+}
+
+// Columns returns the columns of the model's table with the given names, in order, or every column when names
+// is empty.
+func Columns(def *model.ModelDefinition, names []string) ([]model.StoredColumn, error) {
+	all := model.StoredColumns(def)
+	if len(names) == 0 {
+		return all, nil
+	}
+	columns := make([]model.StoredColumn, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, column := range all {
+			if strings.EqualFold(column.Name, name) {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("table %s has no column %s", model.TableName(def), name)
+		}
+	}
+	return columns, nil
+}
+
+// Export writes the rows of the model's table, ordered by ID, to w. It returns the number of rows written.
+func Export(ctx context.Context, db *sql.DB, def *model.ModelDefinition, w io.Writer, options Options) (int, error) {
+	columns, err := Columns(def, options.Columns)
+	if err != nil {
+		return 0, err
+	}
+	sheet, err := newSheet(w, model.TableName(def), columns, options)
+	if err != nil {
+		return 0, err
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	names := []string{"id"}
+	for _, column := range columns {
+		names = append(names, pq.QuoteIdentifier(column.Name))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id > $1 ORDER BY id LIMIT $2",
+		strings.Join(names, ", "), pq.QuoteIdentifier(model.TableName(def)))
+
+	var afterID int64
+	exported := 0
+	for {
+		rows, lastID, err := readBatch(ctx, db, query, afterID, batchSize, len(columns))
+		if err != nil {
+			return exported, fmt.Errorf("failed to read %s: %w", model.TableName(def), err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		for _, row := range rows {
+			if err := decrypt(columns, row, options.Keyring); err != nil {
+				return exported, err
+			}
+			if err := sheet.WriteRow(row); err != nil {
+				return exported, err
+			}
+		}
+		exported += len(rows)
+		afterID = lastID
+	}
+	return exported, sheet.Close()
+}
+
+// readBatch reads the rows selected by query, whose first column is the ID, following afterID, and returns
+// the values of their other columns with the ID of the last one.
+func readBatch(ctx context.Context, db *sql.DB, query string, afterID int64, limit, columns int) ([][]interface{}, int64, error) {
+	rows, err := db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var batch [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, columns)
+		pointers := []interface{}{&afterID}
+		for i := range values {
+			pointers = append(pointers, &values[i])
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, 0, err
+		}
+		batch = append(batch, values)
+	}
+	return batch, afterID, rows.Err()
+}
+
+// decrypt replaces the ciphertext of the encrypted columns of a row by the plaintext.
+func decrypt(columns []model.StoredColumn, row []interface{}, keyring *encryption.Keyring) error {
+	if keyring == nil {
+		return nil
+	}
+	for i, column := range columns {
+		if column.Field == nil || !column.Field.Encrypted {
+			continue
+		}
+		value, ok := row[i].([]byte)
+		if !ok {
+			continue
+		}
+		if _, err := encryption.KeyID(string(value)); err != nil {
+			continue
+		}
+		plaintext, err := keyring.Decrypt(string(value))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", column.Name, err)
+		}
+		row[i] = []byte(plaintext)
+	}
+	return nil
+}
+
+// sheet writes the rows of an export in its format.
+type sheet interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// newSheet starts writing an export of the given columns to w, with their names as header.
+func newSheet(w io.Writer, name string, columns []model.StoredColumn, options Options) (sheet, error) {
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	switch options.Format {
+	case "", CSV:
+		return newCSVSheet(w, columns, options)
+	case XLSX:
+		return newXLSXSheet(w, name, columns, options)
+	default:
+		return nil, fmt.Errorf("invalid format %q: use csv or xlsx", options.Format)
+	}
+}
+
+// cell is a value of an export, converted from its database form to one of nil, bool, int64, float64,
+// time.Time or string. Binary values are written in hex, as Postgres prints them.
+func cell(column model.StoredColumn, value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		if strings.TrimPrefix(column.Type, "*") == "[]byte" {
+			return `\x` + hex.EncodeToString(v)
+		}
+		text := string(v)
+		if isNumeric(column.Type) {
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				return f
+			}
+		}
+		return text
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// isNumeric reports whether a column of the Go type holds numbers, which Postgres returns as text for
+// NUMERIC columns.
+func isNumeric(goType string) bool {
+	goType = strings.TrimPrefix(goType, "*")
+	switch goType {
+	case "string", "[]byte", "bool", "time.Time":
+		return false
+	}
+	_, enum := model.EnumValues(goType)
+	return !enum && !strings.HasPrefix(goType, "[]") && !strings.HasPrefix(goType, "vector(")
+}
+
+// csvSheet writes an export as a CSV file.
+type csvSheet struct {
+	w       *csv.Writer
+	columns []model.StoredColumn
+	options Options
+}
+
+func newCSVSheet(w io.Writer, columns []model.StoredColumn, options Options) (*csvSheet, error) {
+	locale := options.Locale
+	if locale.Delimiter == 0 {
+		locale = Locales[DefaultLocale]
+	}
+	options.Locale = locale
+	if options.BOM {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return nil, err
+		}
+	}
+	s := &csvSheet{w: csv.NewWriter(w), columns: columns, options: options}
+	s.w.Comma = locale.Delimiter
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	return s, s.w.Write(header)
+}
+
+func (s *csvSheet) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = s.format(cell(s.columns[i], value))
+	}
+	return s.w.Write(record)
+}
+
+// format writes a value for the locale. Text that spreadsheet applications would take for a formula is
+// prefixed with a quote, so that opening an export cannot run one.
+func (s *csvSheet) format(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", s.options.Locale.DecimalSeparator, 1)
+	case time.Time:
+		return v.In(s.options.Location).Format(s.options.Locale.DateFormat)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (s *csvSheet) Close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
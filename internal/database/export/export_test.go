@@ -0,0 +1,95 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func newExportTestModel() *model.ModelDefinition {
+	return model.NewModelDefinition("Invoice", []model.Field{
+		model.NewField("Customer", "string", "", false, false),
+		model.NewField("Total", "float64", "", false, false),
+		model.NewField("Paid", "bool", "", false, false),
+		model.NewField("Status", "enum(open,paid)", "", false, false),
+	})
+}
+
+// newExportTestRows returns rows of the id, created_at, customer, total and status columns, as scanned from
+// Postgres.
+func newExportTestRows() [][]interface{} {
+	created := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+	return [][]interface{}{
+		{int64(1), created, []byte("ACME; Inc."), []byte("1234.5"), []byte("open")},
+		{int64(2), created, []byte("=HYPERLINK(\"x\")"), float64(-3), nil},
+	}
+}
+
+func writeSheet(t *testing.T, options Options) string {
+	columns, err := Columns(newExportTestModel(), []string{"id", "created_at", "customer", "TOTAL", "status"})
+	assert.NoError(t, err)
+	var b bytes.Buffer
+	s, err := newSheet(&b, "invoices", columns, options)
+	assert.NoError(t, err)
+	for _, row := range newExportTestRows() {
+		assert.NoError(t, s.WriteRow(row))
+	}
+	assert.NoError(t, s.Close())
+	return b.String()
+}
+
+func TestColumns(t *testing.T) {
+	columns, err := Columns(newExportTestModel(), nil)
+	assert.NoError(t, err)
+	assert.Len(t, columns, 7)
+	_, err = Columns(newExportTestModel(), []string{"id", "amount"})
+	assert.EqualError(t, err, "table invoices has no column amount")
+}
+
+func TestCSV(t *testing.T) {
+	assert.Equal(t, `id,created_at,customer,total,status
+1,03/01/2024 23:30:00,ACME; Inc.,1234.5,open
+2,03/01/2024 23:30:00,"'=HYPERLINK(""x"")",-3,
+`, writeSheet(t, Options{}))
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	assert.Equal(t, "\ufeff"+`id;created_at;customer;total;status
+1;02.03.2024 00:30:00;"ACME; Inc.";1234,5;open
+2;02.03.2024 00:30:00;"'=HYPERLINK(""x"")";-3;
+`, writeSheet(t, Options{Locale: Locales["de-DE"], Location: berlin, BOM: true}))
+}
+
+func TestXLSX(t *testing.T) {
+	workbook := writeSheet(t, Options{Format: XLSX})
+	r, err := zip.NewReader(bytes.NewReader([]byte(workbook)), int64(len(workbook)))
+	assert.NoError(t, err)
+	parts := map[string]string{}
+	for _, file := range r.File {
+		f, err := file.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		parts[file.Name] = string(content)
+	}
+	assert.Contains(t, parts, "[Content_Types].xml")
+	assert.Contains(t, parts["xl/workbook.xml"], `<sheet name="invoices" sheetId="1" r:id="rId1"/>`)
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<row r="1"><c r="A1" t="inlineStr" s="2"><is><t xml:space="preserve">id</t></is></c>`)
+	assert.Contains(t, sheet, `<row r="2"><c r="A2"><v>1</v></c><c r="B2" s="1"><v>45352.979166666664</v></c>`+
+		`<c r="C2" t="inlineStr"><is><t xml:space="preserve">ACME; Inc.</t></is></c><c r="D2"><v>1234.5</v></c>`)
+	assert.Contains(t, sheet, `<t xml:space="preserve">=HYPERLINK(&#34;x&#34;)</t></is></c><c r="D3"><v>-3</v></c></row>`)
+}
+
+func TestColumnLetters(t *testing.T) {
+	for index, letters := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(t, letters, columnLetters(index))
+	}
+}
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// The parts of a workbook of one sheet, besides the sheet itself. Cells use the styles of styles.xml by index:
+// 1 for times, 2 for the header.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+</styleSheet>`
+)
+
+// excelEpoch is the time of the serial number 0 of Excel times, chosen so that serial numbers are right
+// after February 1900, which Excel believes had 29 days.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxSheet writes an export as an Excel workbook of one sheet. Rows are streamed to the sheet, which holds
+// its strings inline rather than in a shared table so that nothing is kept in memory.
+type xlsxSheet struct {
+	zip     *zip.Writer
+	w       *bufio.Writer
+	name    string
+	columns []model.StoredColumn
+	options Options
+	row     int
+}
+
+func newXLSXSheet(w io.Writer, name string, columns []model.StoredColumn, options Options) (*xlsxSheet, error) {
+	s := &xlsxSheet{zip: zip.NewWriter(w), name: name, columns: columns, options: options}
+	part, err := s.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	s.w = bufio.NewWriter(part)
+	s.w.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<sheetData>`)
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	return s, s.writeRow(header, 2)
+}
+
+func (s *xlsxSheet) WriteRow(values []interface{}) error {
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = cell(s.columns[i], value)
+	}
+	return s.writeRow(cells, 0)
+}
+
+// writeRow writes a row of cells, of the given style unless their type has one.
+func (s *xlsxSheet) writeRow(cells []interface{}, style int) error {
+	s.row++
+	fmt.Fprintf(s.w, `<row r="%d">`, s.row)
+	for i, value := range cells {
+		ref := columnLetters(i) + strconv.Itoa(s.row)
+		switch v := value.(type) {
+		case nil:
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(s.w, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		case int64:
+			fmt.Fprintf(s.w, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(s.w, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'g', -1, 64))
+		case time.Time:
+			fmt.Fprintf(s.w, `<c r="%s" s="1"><v>%s</v></c>`, ref, strconv.FormatFloat(s.serial(v), 'f', -1, 64))
+		default:
+			fmt.Fprintf(s.w, `<c r="%s" t="inlineStr"`, ref)
+			if style != 0 {
+				fmt.Fprintf(s.w, ` s="%d"`, style)
+			}
+			s.w.WriteString(`><is><t xml:space="preserve">`)
+			xml.EscapeText(s.w, []byte(fmt.Sprint(v)))
+			s.w.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := s.w.WriteString(`</row>`)
+	return err
+}
+
+// serial returns the Excel serial number of a time, in days since excelEpoch, for its wall clock in the time
+// zone of the export: Excel times have no time zone.
+func (s *xlsxSheet) serial(t time.Time) float64 {
+	t = t.In(s.options.Location)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	seconds := float64(wall.Unix()-excelEpoch.Unix()) + float64(wall.Nanosecond())/1e9
+	return seconds / 86400
+}
+
+// columnLetters returns the letters of the column of the given index, A for 0, Z for 25, AA for 26.
+func columnLetters(index int) string {
+	letters := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		letters = string(rune('A'+(index-1)%26)) + letters
+	}
+	return letters
+}
+
+// Close completes the sheet and writes the other parts of the workbook.
+func (s *xlsxSheet) Close() error {
+	s.w.WriteString(`</sheetData></worksheet>`)
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheetName(s.name)))
+	parts := []struct{ path, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, name.String())},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		w, err := s.zip.Create(part.path)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+	return s.zip.Close()
+}
+
+// sheetName returns a name Excel accepts for a sheet: at most 31 characters, none of []:*?/\.
+func sheetName(name string) string {
+	runes := []rune{}
+	for _, r := range name {
+		switch r {
+		case '[', ']', ':', '*', '?', '/', '\\':
+			r = '_'
+		}
+		runes = append(runes, r)
+	}
+	if len(runes) > 31 {
+		runes = runes[:31]
+	}
+	return string(runes)
+}
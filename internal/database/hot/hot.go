@@ -0,0 +1,204 @@
+// Package hot finds the busiest tables and queries of a Postgres database over a sampling window, from the
+// cumulative statistics of pg_stat_user_tables and, when the extension is installed, pg_stat_statements.
+package hot
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// TableCounters are the cumulative operation counters of a table.
+type TableCounters struct {
+	SeqScans int64
+	IdxScans int64
+	RowsRead int64
+	Inserts  int64
+	Updates  int64
+	Deletes  int64
+}
+
+// QueryCounters are the cumulative counters of a normalized query.
+type QueryCounters struct {
+	Query string
+	Calls int64
+	// Time is the total execution time of the calls.
+	Time time.Duration
+}
+
+// Snapshot holds the counters of a database at one point in time.
+type Snapshot struct {
+	Tables map[string]TableCounters
+	// Queries holds the counters of queries by query ID; it is nil when pg_stat_statements is not installed.
+	Queries map[int64]QueryCounters
+}
+
+// TableActivity is the activity of a table over a window.
+type TableActivity struct {
+	Table    string `json:"table"`
+	SeqScans int64  `json:"seq_scans"`
+	IdxScans int64  `json:"idx_scans"`
+	RowsRead int64  `json:"rows_read"`
+	Inserts  int64  `json:"inserts"`
+	Updates  int64  `json:"updates"`
+	Deletes  int64  `json:"deletes"`
+}
+
+// Reads returns the number of scans of the table.
+func (a TableActivity) Reads() int64 {
+	return a.SeqScans + a.IdxScans
+}
+
+// Writes returns the number of rows written to the table.
+func (a TableActivity) Writes() int64 {
+	return a.Inserts + a.Updates + a.Deletes
+}
+
+// QueryActivity is the activity of a query over a window.
+type QueryActivity struct {
+	Query string        `json:"query"`
+	Calls int64         `json:"calls"`
+	Time  time.Duration `json:"-"`
+	// Milliseconds is Time in milliseconds, as written to JSON.
+	Milliseconds float64 `json:"total_ms"`
+}
+
+// Mean returns the mean execution time of the calls.
+func (a QueryActivity) Mean() time.Duration {
+	if a.Calls == 0 {
+		return 0
+	}
+	return a.Time / time.Duration(a.Calls)
+}
+
+// Report is the activity of a database over a window, busiest first.
+type Report struct {
+	Window  time.Duration   `json:"-"`
+	Tables  []TableActivity `json:"tables"`
+	Queries []QueryActivity `json:"queries"`
+	// Statements tells whether pg_stat_statements was available to report queries.
+	Statements bool `json:"statements"`
+}
+
+// Diff returns the activity between two snapshots taken window apart, with the limit busiest tables, by reads
+// and writes, and queries, by total execution time; a limit of 0 keeps them all. Idle tables and queries are
+// left out.
+func Diff(before, after *Snapshot, window time.Duration, limit int) Report {
+	report := Report{Window: window, Tables: []TableActivity{}, Queries: []QueryActivity{}, Statements: after.Queries != nil}
+	for table, now := range after.Tables {
+		then := before.Tables[table]
+		activity := TableActivity{
+			Table:    table,
+			SeqScans: now.SeqScans - then.SeqScans,
+			IdxScans: now.IdxScans - then.IdxScans,
+			RowsRead: now.RowsRead - then.RowsRead,
+			Inserts:  now.Inserts - then.Inserts,
+			Updates:  now.Updates - then.Updates,
+			Deletes:  now.Deletes - then.Deletes,
+		}
+		if activity.Reads()+activity.Writes() > 0 {
+			report.Tables = append(report.Tables, activity)
+		}
+	}
+	sort.Slice(report.Tables, func(i, j int) bool {
+		a, b := report.Tables[i], report.Tables[j]
+		if a.Reads()+a.Writes() != b.Reads()+b.Writes() {
+			return a.Reads()+a.Writes() > b.Reads()+b.Writes()
+		}
+		return a.Table < b.Table
+	})
+
+	for id, now := range after.Queries {
+		then := before.Queries[id]
+		activity := QueryActivity{Query: now.Query, Calls: now.Calls - then.Calls, Time: now.Time - then.Time}
+		activity.Milliseconds = float64(activity.Time) / float64(time.Millisecond)
+		if activity.Calls > 0 {
+			report.Queries = append(report.Queries, activity)
+		}
+	}
+	sort.Slice(report.Queries, func(i, j int) bool {
+		a, b := report.Queries[i], report.Queries[j]
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		return a.Query < b.Query
+	})
+
+	if limit > 0 && len(report.Tables) > limit {
+		report.Tables = report.Tables[:limit]
+	}
+	if limit > 0 && len(report.Queries) > limit {
+		report.Queries = report.Queries[:limit]
+	}
+	return report
+}
+
+// Take takes a snapshot of the counters of the current database. The counters of queries are only read when
+// pg_stat_statements is installed.
+func Take(ctx context.Context, db *sql.DB) (*Snapshot, error) {
+	snapshot := &Snapshot{Tables: make(map[string]TableCounters)}
+	rows, err := db.QueryContext(ctx, `SELECT schemaname || '.' || relname, COALESCE(seq_scan, 0), COALESCE(idx_scan, 0),
+	COALESCE(seq_tup_read, 0) + COALESCE(idx_tup_fetch, 0), n_tup_ins, n_tup_upd, n_tup_del
+FROM pg_stat_user_tables`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var c TableCounters
+		if err := rows.Scan(&table, &c.SeqScans, &c.IdxScans, &c.RowsRead, &c.Inserts, &c.Updates, &c.Deletes); err != nil {
+			return nil, err
+		}
+		snapshot.Tables[table] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var installed bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('pg_stat_statements') IS NOT NULL").Scan(&installed); err != nil {
+		return nil, err
+	}
+	if !installed {
+		return snapshot, nil
+	}
+	snapshot.Queries = make(map[int64]QueryCounters)
+	rows, err = db.QueryContext(ctx, `SELECT COALESCE(queryid, 0), query, calls, total_exec_time
+FROM pg_stat_statements WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var c QueryCounters
+		var milliseconds float64
+		if err := rows.Scan(&id, &c.Query, &c.Calls, &milliseconds); err != nil {
+			return nil, err
+		}
+		c.Time = time.Duration(milliseconds * float64(time.Millisecond))
+		snapshot.Queries[id] = c
+	}
+	return snapshot, rows.Err()
+}
+
+// Sample takes a snapshot, waits for window, or until ctx is done, and returns the activity since.
+func Sample(ctx context.Context, db *sql.DB, window time.Duration, limit int) (Report, error) {
+	before, err := Take(ctx, db)
+	if err != nil {
+		return Report{}, err
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return Report{}, ctx.Err()
+	case <-time.After(window):
+	}
+	after, err := Take(ctx, db)
+	if err != nil {
+		return Report{}, err
+	}
+	return Diff(before, after, time.Since(start), limit), nil
+}
@@ -0,0 +1,53 @@
+package hot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	before := &Snapshot{
+		Tables: map[string]TableCounters{
+			"public.users":  {SeqScans: 10, IdxScans: 100, RowsRead: 1000, Inserts: 5},
+			"public.orders": {IdxScans: 50, Inserts: 20},
+			"public.tags":   {SeqScans: 3},
+		},
+		Queries: map[int64]QueryCounters{
+			1: {Query: "SELECT * FROM users WHERE id = $1", Calls: 100, Time: time.Second},
+			2: {Query: "INSERT INTO orders VALUES ($1)", Calls: 20, Time: 200 * time.Millisecond},
+		},
+	}
+	after := &Snapshot{
+		Tables: map[string]TableCounters{
+			"public.users":  {SeqScans: 12, IdxScans: 130, RowsRead: 1500, Inserts: 5},
+			"public.orders": {IdxScans: 60, Inserts: 70, Updates: 5},
+			"public.tags":   {SeqScans: 3},
+			"public.items":  {Inserts: 1},
+		},
+		Queries: map[int64]QueryCounters{
+			1: {Query: "SELECT * FROM users WHERE id = $1", Calls: 130, Time: 1300 * time.Millisecond},
+			2: {Query: "INSERT INTO orders VALUES ($1)", Calls: 70, Time: 700 * time.Millisecond},
+			3: {Query: "SELECT 1", Calls: 0},
+		},
+	}
+
+	report := Diff(before, after, 10*time.Second, 0)
+	assert.True(t, report.Statements)
+	assert.Equal(t, []TableActivity{
+		{Table: "public.orders", IdxScans: 10, Inserts: 50, Updates: 5},
+		{Table: "public.users", SeqScans: 2, IdxScans: 30, RowsRead: 500},
+		{Table: "public.items", Inserts: 1},
+	}, report.Tables)
+	assert.Equal(t, []QueryActivity{
+		{Query: "INSERT INTO orders VALUES ($1)", Calls: 50, Time: 500 * time.Millisecond, Milliseconds: 500},
+		{Query: "SELECT * FROM users WHERE id = $1", Calls: 30, Time: 300 * time.Millisecond, Milliseconds: 300},
+	}, report.Queries)
+	assert.Equal(t, 10*time.Millisecond, report.Queries[0].Mean())
+
+	report = Diff(before, &Snapshot{Tables: after.Tables}, time.Second, 1)
+	assert.False(t, report.Statements)
+	assert.Len(t, report.Tables, 1)
+	assert.Empty(t, report.Queries)
+}
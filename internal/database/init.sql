@@ -2,7 +2,8 @@
 CREATE TABLE IF NOT EXISTS models (
     id SERIAL PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
-    fields JSONB NOT NULL
+    fields JSONB NOT NULL,
+    options JSONB NOT NULL DEFAULT '{}'
 );
 
 CREATE TABLE IF NOT EXISTS users (
@@ -0,0 +1,151 @@
+// Package integrity finds the rows of model tables that break the relations and constraints declared by the
+// models but not enforced by the database, such as legacy data loaded before the constraints were added:
+// references to missing rows, NULLs in non-nullable columns, and duplicates in unique columns.
+package integrity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// Kind is the kind of problem a check finds.
+type Kind string
+
+// Kinds of checks.
+const (
+	// Orphan rows reference a row that does not exist.
+	Orphan Kind = "orphan"
+	// Null rows hold NULL in a non-nullable column.
+	Null Kind = "null"
+	// Duplicate rows hold the value of a unique column of an older row.
+	Duplicate Kind = "duplicate"
+)
+
+// Check counts the rows of a column that have one kind of problem, and fixes them.
+type Check struct {
+	Kind   Kind   `json:"kind"`
+	Model  string `json:"model"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	// References is the table referenced by the column of an orphan check.
+	References string `json:"references,omitempty"`
+	// Query counts the rows with the problem.
+	Query string `json:"-"`
+	// Fix is the statement fixing the rows with the problem.
+	Fix string `json:"fix"`
+}
+
+// Checks returns the checks of the columns of the models: an orphan check for every field referencing a model,
+// a null check for every non-nullable field, and a duplicate check for every unique (primary) field. Fixes
+// set orphan references to NULL when the column is nullable and delete the rows otherwise, set NULLs to the
+// column default when there is one and delete the rows otherwise, and delete duplicates, keeping the oldest row
+// of every value.
+func Checks(defs []*model.ModelDefinition) ([]Check, error) {
+	tables := make(map[string]string, len(defs))
+	for _, def := range defs {
+		tables[strings.ToLower(def.Name)] = model.TableName(def)
+	}
+
+	var checks []Check
+	for _, def := range defs {
+		table := model.TableName(def)
+		for _, column := range model.StoredColumns(def) {
+			field := column.Field
+			if field == nil {
+				continue
+			}
+			name := model.ColumnName(field)
+			nullable := field.IsNull || strings.HasPrefix(field.Type, "*")
+			if field.IsPrimary {
+				checks = append(checks, Check{
+					Kind:   Duplicate,
+					Model:  def.Name,
+					Table:  table,
+					Column: name,
+					Query: fmt.Sprintf("SELECT count(*) FROM %s a WHERE EXISTS (SELECT 1 FROM %s b WHERE b.%s = a.%s AND b.id < a.id)",
+						table, table, name, name),
+					Fix: fmt.Sprintf("DELETE FROM %s a USING %s b WHERE a.%s = b.%s AND a.id > b.id;", table, table, name, name),
+				})
+			}
+			if !nullable {
+				check := Check{
+					Kind:   Null,
+					Model:  def.Name,
+					Table:  table,
+					Column: name,
+					Query:  fmt.Sprintf("SELECT count(*) FROM %s WHERE %s IS NULL", table, name),
+					Fix:    fmt.Sprintf("DELETE FROM %s WHERE %s IS NULL;", table, name),
+				}
+				if field.Default != "" {
+					check.Fix = fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s IS NULL;", table, name, model.SQLDefault(field), name)
+				}
+				checks = append(checks, check)
+			}
+			if field.References != "" {
+				referenced, ok := tables[strings.ToLower(field.References)]
+				if !ok {
+					return nil, fmt.Errorf("%s.%s references unknown model %s", def.Name, field.Name, field.References)
+				}
+				missing := fmt.Sprintf("%s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %s p WHERE p.id = %s.%s)", name, referenced, table, name)
+				check := Check{
+					Kind:       Orphan,
+					Model:      def.Name,
+					Table:      table,
+					Column:     name,
+					References: referenced,
+					Query:      fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", table, missing),
+					Fix:        fmt.Sprintf("DELETE FROM %s WHERE %s;", table, missing),
+				}
+				if nullable {
+					check.Fix = fmt.Sprintf("UPDATE %s SET %s = NULL WHERE %s;", table, name, missing)
+				}
+				checks = append(checks, check)
+			}
+		}
+	}
+	return checks, nil
+}
+
+// Issue is a check that found rows with its problem.
+type Issue struct {
+	Check
+	Rows int64 `json:"rows"`
+}
+
+// Run runs the checks against db and returns the issues found, in the order of the checks.
+func Run(ctx context.Context, db *sql.DB, checks []Check) ([]Issue, error) {
+	issues := []Issue{}
+	for _, check := range checks {
+		var rows int64
+		if err := db.QueryRowContext(ctx, check.Query).Scan(&rows); err != nil {
+			return nil, fmt.Errorf("failed to check %s of %s.%s: %w", check.Kind, check.Table, check.Column, err)
+		}
+		if rows > 0 {
+			issues = append(issues, Issue{Check: check, Rows: rows})
+		}
+	}
+	return issues, nil
+}
+
+// WriteFixScript writes a script fixing the issues in one transaction, for review before it is run. Duplicates
+// and NULLs are fixed before orphans, since the rows they delete may be referenced. Deleting orphans may orphan
+// the rows referencing them in turn: check again after running the script.
+func WriteFixScript(w io.Writer, issues []Issue) error {
+	var b strings.Builder
+	b.WriteString("-- Fixes the integrity issues found by grayv-lsm db check-integrity.\nBEGIN;\n")
+	for _, kind := range []Kind{Duplicate, Null, Orphan} {
+		for _, issue := range issues {
+			if issue.Kind == kind {
+				fmt.Fprintf(&b, "-- %d %s row(s) in %s.%s\n%s\n", issue.Rows, issue.Kind, issue.Table, issue.Column, issue.Fix)
+			}
+		}
+	}
+	b.WriteString("COMMIT;\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,70 @@
+package integrity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func newIntegrityTestModels() []*model.ModelDefinition {
+	user := model.NewModelDefinition("User", []model.Field{
+		model.NewField("email", "string", "", false, true),
+		model.NewField("manager_id", "*int64", "", false, false),
+	})
+	user.Fields[1].References = "User"
+	order := model.NewModelDefinition("Order", []model.Field{
+		model.NewField("user_id", "int64", "", false, false),
+		model.NewField("status", "string", "", false, false),
+		model.NewField("note", "string", "", true, false),
+	})
+	order.Fields[0].References = "user"
+	order.Fields[1].Default = "new"
+	return []*model.ModelDefinition{user, order}
+}
+
+func TestChecks(t *testing.T) {
+	checks, err := Checks(newIntegrityTestModels())
+	assert.NoError(t, err)
+
+	var kinds []string
+	for _, check := range checks {
+		kinds = append(kinds, string(check.Kind)+" "+check.Table+"."+check.Column)
+	}
+	assert.Equal(t, []string{
+		"duplicate users.email",
+		"null users.email",
+		"orphan users.manager_id",
+		"null orders.user_id",
+		"orphan orders.user_id",
+		"null orders.status",
+	}, kinds)
+
+	assert.Equal(t, "SELECT count(*) FROM users a WHERE EXISTS (SELECT 1 FROM users b WHERE b.email = a.email AND b.id < a.id)", checks[0].Query)
+	assert.Equal(t, "DELETE FROM users a USING users b WHERE a.email = b.email AND a.id > b.id;", checks[0].Fix)
+	assert.Equal(t, "DELETE FROM users WHERE email IS NULL;", checks[1].Fix)
+	assert.Equal(t, "UPDATE users SET manager_id = NULL WHERE manager_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users p WHERE p.id = users.manager_id);", checks[2].Fix)
+	assert.Equal(t, "SELECT count(*) FROM orders WHERE user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users p WHERE p.id = orders.user_id)", checks[4].Query)
+	assert.Equal(t, "DELETE FROM orders WHERE user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users p WHERE p.id = orders.user_id);", checks[4].Fix)
+	assert.Equal(t, "UPDATE orders SET status = 'new' WHERE status IS NULL;", checks[5].Fix)
+
+	defs := newIntegrityTestModels()
+	defs[1].Fields[0].References = "Account"
+	_, err = Checks(defs)
+	assert.EqualError(t, err, "Order.user_id references unknown model Account")
+}
+
+func TestWriteFixScript(t *testing.T) {
+	checks, err := Checks(newIntegrityTestModels())
+	assert.NoError(t, err)
+	issues := []Issue{{Check: checks[4], Rows: 3}, {Check: checks[0], Rows: 1}}
+
+	var b strings.Builder
+	assert.NoError(t, WriteFixScript(&b, issues))
+	assert.Equal(t, "-- Fixes the integrity issues found by grayv-lsm db check-integrity.\nBEGIN;\n"+
+		"-- 1 duplicate row(s) in users.email\n"+checks[0].Fix+"\n"+
+		"-- 3 orphan row(s) in orders.user_id\n"+checks[4].Fix+"\n"+
+		"COMMIT;\n", b.String())
+}
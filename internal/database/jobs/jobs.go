@@ -0,0 +1,192 @@
+// Package jobs operates the queues of the background jobs run by the workers of generated apps, stored in the
+// jobs table: it lists jobs, retries failed or cancelled ones and cancels pending ones.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Statuses are the statuses of jobs. Workers move jobs from pending to running, then to done, or back to
+// pending to retry them, until they fail max_attempts times.
+var Statuses = []string{"pending", "running", "done", "failed", "cancelled"}
+
+// Job is a row of the jobs table.
+type Job struct {
+	ID          int64      `json:"id"`
+	Queue       string     `json:"queue"`
+	Kind        string     `json:"kind"`
+	Status      string     `json:"status"`
+	Priority    int        `json:"priority"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	RunAt       time.Time  `json:"run_at"`
+	LockedBy    string     `json:"locked_by,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// Payload and Checkpoint are only read by Get.
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Checkpoint json.RawMessage `json:"checkpoint,omitempty"`
+}
+
+// QueueCounts are the numbers of jobs of a queue by status.
+type QueueCounts struct {
+	Queue     string `json:"queue"`
+	Pending   int64  `json:"pending"`
+	Running   int64  `json:"running"`
+	Done      int64  `json:"done"`
+	Failed    int64  `json:"failed"`
+	Cancelled int64  `json:"cancelled"`
+}
+
+// Filter selects the jobs listed. Zero values select all jobs.
+type Filter struct {
+	Queue  string
+	Status string
+	// Limit caps the number of jobs listed, the most recent first.
+	Limit int
+}
+
+func listQuery(filter Filter) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Queue != "" {
+		args = append(args, filter.Queue)
+		conditions = append(conditions, fmt.Sprintf("queue = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		if !validStatus(filter.Status) {
+			return "", nil, fmt.Errorf("invalid job status %q: use one of %s", filter.Status, strings.Join(Statuses, ", "))
+		}
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	query := "SELECT " + jobColumns + "\nFROM jobs"
+	if len(conditions) > 0 {
+		query += "\nWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += "\nORDER BY id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return query, args, nil
+}
+
+// jobColumns are the columns of the jobs read by scanJob.
+const jobColumns = `id, queue, kind, status, priority, attempts, max_attempts, run_at, COALESCE(locked_by, ''),
+	COALESCE(last_error, ''), finished_at, created_at`
+
+func scanJob(scanner interface{ Scan(...interface{}) error }, dest ...interface{}) (Job, error) {
+	var j Job
+	var finishedAt sql.NullTime
+	err := scanner.Scan(append([]interface{}{&j.ID, &j.Queue, &j.Kind, &j.Status, &j.Priority, &j.Attempts, &j.MaxAttempts,
+		&j.RunAt, &j.LockedBy, &j.LastError, &finishedAt, &j.CreatedAt}, dest...)...)
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return j, err
+}
+
+func validStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the jobs selected by filter, the most recent first.
+func List(ctx context.Context, db *sql.DB, filter Filter) ([]Job, error) {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Get returns the job of the given ID, with its payload and checkpoint, or sql.ErrNoRows.
+func Get(ctx context.Context, db *sql.DB, id int64) (*Job, error) {
+	var payload, checkpoint []byte
+	j, err := scanJob(db.QueryRowContext(ctx, "SELECT "+jobColumns+", payload, checkpoint FROM jobs WHERE id = $1", id), &payload, &checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	j.Payload, j.Checkpoint = payload, checkpoint
+	return &j, nil
+}
+
+// Counts returns the numbers of jobs of every queue by status, ordered by queue.
+func Counts(ctx context.Context, db *sql.DB) ([]QueueCounts, error) {
+	rows, err := db.QueryContext(ctx, `SELECT queue,
+	count(*) FILTER (WHERE status = 'pending'), count(*) FILTER (WHERE status = 'running'),
+	count(*) FILTER (WHERE status = 'done'), count(*) FILTER (WHERE status = 'failed'),
+	count(*) FILTER (WHERE status = 'cancelled')
+FROM jobs GROUP BY queue ORDER BY queue`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []QueueCounts{}
+	for rows.Next() {
+		var c QueueCounts
+		if err := rows.Scan(&c.Queue, &c.Pending, &c.Running, &c.Done, &c.Failed, &c.Cancelled); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// retrySet makes jobs pending again, due now and with their attempts reset.
+const retrySet = "UPDATE jobs SET status = 'pending', attempts = 0, run_at = now(), locked_by = NULL, locked_at = NULL, finished_at = NULL, updated_at = now()"
+
+// Retry makes the failed or cancelled jobs among ids run again, and returns how many it retried.
+func Retry(ctx context.Context, db *sql.DB, ids []int64) (int64, error) {
+	return exec(ctx, db, retrySet+" WHERE id = ANY($1) AND status IN ('failed', 'cancelled')", pq.Array(ids))
+}
+
+// RetryFailed makes the failed jobs of a queue, or of all queues when queue is empty, run again, and returns
+// how many it retried.
+func RetryFailed(ctx context.Context, db *sql.DB, queue string) (int64, error) {
+	return exec(ctx, db, retrySet+" WHERE status = 'failed' AND ($1 = '' OR queue = $1)", queue)
+}
+
+// Cancel cancels the pending or running jobs among ids, and returns how many it cancelled. Workers do not
+// interrupt the running jobs cancelled, but no longer record their outcome.
+func Cancel(ctx context.Context, db *sql.DB, ids []int64) (int64, error) {
+	return exec(ctx, db, "UPDATE jobs SET status = 'cancelled', locked_by = NULL, finished_at = now(), updated_at = now() WHERE id = ANY($1) AND status IN ('pending', 'running')",
+		pq.Array(ids))
+}
+
+func exec(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int64, error) {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListQuery(t *testing.T) {
+	query, args, err := listQuery(Filter{})
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+	assert.False(t, strings.Contains(query, "WHERE"))
+	assert.True(t, strings.HasSuffix(query, "ORDER BY id DESC"))
+
+	query, args, err = listQuery(Filter{Queue: "emails", Status: "failed", Limit: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"emails", "failed", 20}, args)
+	assert.True(t, strings.HasSuffix(query, "WHERE queue = $1 AND status = $2\nORDER BY id DESC LIMIT $3"))
+
+	_, _, err = listQuery(Filter{Status: "lost"})
+	assert.EqualError(t, err, `invalid job status "lost": use one of pending, running, done, failed, cancelled`)
+}
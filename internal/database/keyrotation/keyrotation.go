@@ -0,0 +1,192 @@
+// Package keyrotation re-encrypts the values of an encrypted column under a new key.
+package keyrotation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/pkg/encryption"
+)
+
+// Value is the stored value of an encrypted column in one row.
+type Value struct {
+	ID    int64
+	Value string
+}
+
+// Store reads and writes the column being rotated.
+type Store interface {
+	// Pending returns the number of values not yet encrypted with the given key.
+	Pending(ctx context.Context, keyID string) (int, error)
+	// NextBatch returns up to limit values not encrypted with the given key in rows whose ID is greater than
+	// afterID, ordered by ID.
+	NextBatch(ctx context.Context, keyID string, afterID int64, limit int) ([]Value, error)
+	// Replace stores the rotated values of a batch atomically. A row is only updated while it still holds the
+	// value it was read with, so values written concurrently are never overwritten. It returns the number of
+	// rows updated.
+	Replace(ctx context.Context, old, rotated []Value) (int, error)
+}
+
+// Progress reports how far a rotation has got.
+type Progress struct {
+	// Total is the number of values that were not encrypted with the target key when the rotation started.
+	Total int
+	// Rotated is the number of values re-encrypted so far.
+	Rotated int
+	// Skipped is the number of values that changed while their batch was processed. They are rotated by the
+	// next run if they are still not encrypted with the target key.
+	Skipped int
+}
+
+// Rotator re-encrypts every value of a column under a target key, in batches that are committed one at a
+// time. The keyring must hold the target key and every key the values are currently encrypted with; values
+// stored in plaintext are encrypted. Because every committed batch is final and rotated values are no longer
+// selected, an interrupted rotation resumes where it stopped when run again. Applications reading through a
+// keyring holding both keys keep working throughout.
+type Rotator struct {
+	Store     Store
+	Keyring   *encryption.Keyring
+	KeyID     string
+	BatchSize int
+	// OnProgress, if set, is called after every batch.
+	OnProgress func(Progress)
+}
+
+// Run rotates every pending value and returns the final progress.
+func (r *Rotator) Run(ctx context.Context) (Progress, error) {
+	var progress Progress
+	if r.BatchSize <= 0 {
+		return progress, fmt.Errorf("batch size must be positive, got %d", r.BatchSize)
+	}
+	if !r.Keyring.HasKey(r.KeyID) {
+		return progress, fmt.Errorf("%w %q", encryption.ErrUnknownKey, r.KeyID)
+	}
+
+	total, err := r.Store.Pending(ctx, r.KeyID)
+	if err != nil {
+		return progress, fmt.Errorf("failed to count values to rotate: %w", err)
+	}
+	progress.Total = total
+
+	var afterID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		batch, err := r.Store.NextBatch(ctx, r.KeyID, afterID, r.BatchSize)
+		if err != nil {
+			return progress, fmt.Errorf("failed to read values after row %d: %w", afterID, err)
+		}
+		if len(batch) == 0 {
+			return progress, nil
+		}
+
+		rotated := make([]Value, len(batch))
+		for i, value := range batch {
+			rotated[i], err = r.rotate(value)
+			if err != nil {
+				return progress, err
+			}
+		}
+		updated, err := r.Store.Replace(ctx, batch, rotated)
+		if err != nil {
+			return progress, fmt.Errorf("failed to store rotated values of rows %d to %d: %w", batch[0].ID, batch[len(batch)-1].ID, err)
+		}
+
+		progress.Rotated += updated
+		progress.Skipped += len(batch) - updated
+		afterID = batch[len(batch)-1].ID
+		if r.OnProgress != nil {
+			r.OnProgress(progress)
+		}
+	}
+}
+
+func (r *Rotator) rotate(value Value) (Value, error) {
+	var (
+		rotated string
+		err     error
+	)
+	if _, keyErr := encryption.KeyID(value.Value); keyErr != nil {
+		rotated, err = r.Keyring.EncryptWith(r.KeyID, value.Value)
+	} else {
+		rotated, err = r.Keyring.Rotate(r.KeyID, value.Value)
+	}
+	if err != nil {
+		return value, fmt.Errorf("failed to rotate value of row %d: %w", value.ID, err)
+	}
+	return Value{ID: value.ID, Value: rotated}, nil
+}
+
+// PostgresStore is a Store for a column of a table with a serial id column, as created for generated models.
+type PostgresStore struct {
+	db     *sql.DB
+	table  string
+	column string
+}
+
+// NewPostgresStore creates a store for the given column of a table.
+func NewPostgresStore(db *sql.DB, table, column string) *PostgresStore {
+	return &PostgresStore{db: db, table: pq.QuoteIdentifier(table), column: pq.QuoteIdentifier(column)}
+}
+
+// pendingCondition selects the non-NULL values not starting with the prefix of the target key, passed as $1.
+func (s *PostgresStore) pendingCondition() string {
+	return fmt.Sprintf("%s IS NOT NULL AND left(%s, length($1)) <> $1", s.column, s.column)
+}
+
+// Pending implements Store.
+func (s *PostgresStore) Pending(ctx context.Context, keyID string) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", s.table, s.pendingCondition()),
+		encryption.Prefix(keyID)).Scan(&count)
+	return count, err
+}
+
+// NextBatch implements Store.
+func (s *PostgresStore) NextBatch(ctx context.Context, keyID string, afterID int64, limit int) ([]Value, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT id, %s FROM %s WHERE %s AND id > $2 ORDER BY id LIMIT $3", s.column, s.table, s.pendingCondition()),
+		encryption.Prefix(keyID), afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []Value
+	for rows.Next() {
+		var value Value
+		if err := rows.Scan(&value.ID, &value.Value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// Replace implements Store.
+func (s *PostgresStore) Replace(ctx context.Context, old, rotated []Value) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("UPDATE %s SET %s = $1 WHERE id = $2 AND %s = $3", s.table, s.column, s.column)
+	updated := 0
+	for i, value := range rotated {
+		result, err := tx.ExecContext(ctx, query, value.Value, value.ID, old[i].Value)
+		if err != nil {
+			return 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		updated += int(affected)
+	}
+	return updated, tx.Commit()
+}
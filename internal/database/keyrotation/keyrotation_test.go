@@ -0,0 +1,162 @@
+package keyrotation
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/pkg/encryption"
+)
+
+// memoryStore is a Store over an in-memory column.
+type memoryStore struct {
+	values map[int64]string
+	// failAfter makes Replace fail once this many batches were stored.
+	failAfter int
+	batches   int
+	// onReplace, if set, runs before a batch is stored.
+	onReplace func()
+}
+
+func (s *memoryStore) pending(keyID string) []Value {
+	var values []Value
+	for id, value := range s.values {
+		if !strings.HasPrefix(value, encryption.Prefix(keyID)) {
+			values = append(values, Value{ID: id, Value: value})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].ID < values[j].ID })
+	return values
+}
+
+func (s *memoryStore) Pending(ctx context.Context, keyID string) (int, error) {
+	return len(s.pending(keyID)), nil
+}
+
+func (s *memoryStore) NextBatch(ctx context.Context, keyID string, afterID int64, limit int) ([]Value, error) {
+	var batch []Value
+	for _, value := range s.pending(keyID) {
+		if value.ID > afterID && len(batch) < limit {
+			batch = append(batch, value)
+		}
+	}
+	return batch, nil
+}
+
+func (s *memoryStore) Replace(ctx context.Context, old, rotated []Value) (int, error) {
+	if s.failAfter > 0 && s.batches == s.failAfter {
+		return 0, errors.New("connection lost")
+	}
+	if s.onReplace != nil {
+		s.onReplace()
+	}
+	s.batches++
+	updated := 0
+	for i, value := range rotated {
+		if s.values[value.ID] == old[i].Value {
+			s.values[value.ID] = value.Value
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func newTestKeyring(t *testing.T) *encryption.Keyring {
+	keys := map[string]string{}
+	for _, id := range []string{"k1", "k2"} {
+		key, err := encryption.GenerateKey()
+		assert.NoError(t, err)
+		keys[id] = key
+	}
+	keyring, err := encryption.NewKeyring(keys, "k1")
+	assert.NoError(t, err)
+	return keyring
+}
+
+func newTestStore(t *testing.T, keyring *encryption.Keyring, n int) (*memoryStore, map[int64]string) {
+	store := &memoryStore{values: map[int64]string{}}
+	plaintexts := map[int64]string{}
+	for id := int64(1); id <= int64(n); id++ {
+		plaintexts[id] = "ssn-" + string(rune('a'+id))
+		value, err := keyring.Encrypt(plaintexts[id])
+		assert.NoError(t, err)
+		store.values[id] = value
+	}
+	return store, plaintexts
+}
+
+func TestRotator_Run(t *testing.T) {
+	keyring := newTestKeyring(t)
+	store, plaintexts := newTestStore(t, keyring, 5)
+	store.values[6] = "legacy plaintext"
+	plaintexts[6] = "legacy plaintext"
+
+	var reports []Progress
+	rotator := &Rotator{Store: store, Keyring: keyring, KeyID: "k2", BatchSize: 2,
+		OnProgress: func(p Progress) { reports = append(reports, p) }}
+	progress, err := rotator.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Progress{Total: 6, Rotated: 6}, progress)
+	assert.Equal(t, []Progress{{Total: 6, Rotated: 2}, {Total: 6, Rotated: 4}, {Total: 6, Rotated: 6}}, reports)
+
+	for id, value := range store.values {
+		keyID, err := encryption.KeyID(value)
+		assert.NoError(t, err)
+		assert.Equal(t, "k2", keyID)
+		plaintext, err := keyring.Decrypt(value)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintexts[id], plaintext)
+	}
+}
+
+func TestRotator_Resumes(t *testing.T) {
+	keyring := newTestKeyring(t)
+	store, _ := newTestStore(t, keyring, 5)
+	store.failAfter = 1
+
+	rotator := &Rotator{Store: store, Keyring: keyring, KeyID: "k2", BatchSize: 2}
+	progress, err := rotator.Run(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 2, progress.Rotated)
+
+	// Values of either key stay readable while the rotation is incomplete.
+	for _, value := range store.values {
+		_, err := keyring.Decrypt(value)
+		assert.NoError(t, err)
+	}
+
+	store.failAfter = 0
+	progress, err = rotator.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Progress{Total: 3, Rotated: 3}, progress)
+}
+
+func TestRotator_SkipsConcurrentWrites(t *testing.T) {
+	keyring := newTestKeyring(t)
+	store, _ := newTestStore(t, keyring, 2)
+	store.onReplace = func() {
+		store.values[1], _ = keyring.Encrypt("changed")
+		store.onReplace = nil
+	}
+
+	rotator := &Rotator{Store: store, Keyring: keyring, KeyID: "k2", BatchSize: 10}
+	progress, err := rotator.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Progress{Total: 2, Rotated: 1, Skipped: 1}, progress)
+	plaintext, err := keyring.Decrypt(store.values[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", plaintext)
+}
+
+func TestRotator_UnknownKey(t *testing.T) {
+	keyring := newTestKeyring(t)
+	store, _ := newTestStore(t, keyring, 1)
+
+	rotator := &Rotator{Store: store, Keyring: keyring, KeyID: "k3", BatchSize: 10}
+	_, err := rotator.Run(context.Background())
+	assert.True(t, errors.Is(err, encryption.ErrUnknownKey))
+}
@@ -133,7 +133,17 @@ func (dm *DBLifecycleManager) BuildImage() error {
 	return nil
 }
 
+// EnsureImage builds the database Docker image unless an image with the configured name already exists locally.
+func (dm *DBLifecycleManager) EnsureImage() error {
+	output, _ := dm.runCommand(fmt.Sprintf("docker images -q %s", dm.config.Database.Image))
+	if strings.TrimSpace(output) != "" {
+		return nil
+	}
+	return dm.BuildImage()
+}
+
 // StartContainer starts the database Docker container.
+// The container's port 5432 is published on the configured database port.
 // It checks if the container already exists and removes it if it does.
 // It checks if the image exists locally and returns an error if it does not.
 // It starts the Docker container by running a command with necessary environment variables.
@@ -159,8 +169,8 @@ func (dm *DBLifecycleManager) StartContainer() error {
 	}
 
 	// Start the Docker container
-	startCommand := fmt.Sprintf("docker run -d --name %s -e POSTGRES_USER=%s -e POSTGRES_PASSWORD=%s -e POSTGRES_DB=%s -p 5432:5432 %s",
-		dm.config.Database.ContainerName, dm.config.Database.User, dm.config.Database.Password, dm.config.Database.Name, dm.config.Database.Image)
+	startCommand := fmt.Sprintf("docker run -d --name %s -e POSTGRES_USER=%s -e POSTGRES_PASSWORD=%s -e POSTGRES_DB=%s -p %d:5432 %s",
+		dm.config.Database.ContainerName, dm.config.Database.User, dm.config.Database.Password, dm.config.Database.Name, dm.config.Database.Port, dm.config.Database.Image)
 	output, err := dm.runCommand(startCommand)
 	if err != nil {
 		return fmt.Errorf("failed to start the database docker container: %v\nOutput: %s", err, output)
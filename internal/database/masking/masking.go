@@ -0,0 +1,219 @@
+// Package masking creates views of the tables of models with their sensitive fields masked, in a schema an
+// analyst role may read, so that read access to the data can be given without the personal data.
+package masking
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// The strategies columns are masked with.
+const (
+	// Hash gives the hexadecimal SHA-256 of the value and the key of KeyTable, so equal values have equal
+	// hashes, and joins and counts of distinct values still work, but values cannot be guessed from them.
+	Hash = "hash"
+	// Partial keeps the last quarter of the value, at most 4 characters, and replaces the rest with '*'.
+	Partial = "partial"
+	// Redact gives "[redacted]".
+	Redact = "redact"
+	// Null gives NULL.
+	Null = "null"
+)
+
+// Strategies lists the strategies columns may be masked with.
+var Strategies = []string{Hash, Partial, Redact, Null}
+
+// DefaultSchema is the schema of the views, and DefaultRole the role granted to read them, unless Options name
+// others.
+const (
+	DefaultSchema = "analyst"
+	DefaultRole   = "analyst"
+)
+
+// KeyTable is the table holding the random key mixed into the hashes. It is created next to the tables of the
+// models, and the role is not granted to read it; the views read it with the privileges of their owner.
+const KeyTable = "grayv_masking_key"
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Options configure the masked views.
+type Options struct {
+	// Schema is the schema the views are created in, DefaultSchema if empty. Every view is named after the
+	// table of its model.
+	Schema string
+	// Role is the role granted to read the views, DefaultRole if empty. It is created without login if it does
+	// not exist; grant it to the accounts of the analysts.
+	Role string
+	// Strategy is the strategy the sensitive and encrypted fields are masked with, Hash if empty.
+	Strategy string
+	// Fields maps fields, as Model.field, to the strategy they are masked with instead, to mask fields that
+	// are not sensitive too.
+	Fields map[string]string
+}
+
+// View is the masked view of the table of a model.
+type View struct {
+	Model string `json:"model"`
+	Table string `json:"table"`
+	// Name is the name of the view, qualified by its schema.
+	Name string `json:"name"`
+	// Masked maps the masked columns to their strategy.
+	Masked map[string]string `json:"masked"`
+	// SQL is the definition of the view.
+	SQL string `json:"sql"`
+}
+
+func (o *Options) validate() error {
+	if o.Schema == "" {
+		o.Schema = DefaultSchema
+	}
+	if o.Role == "" {
+		o.Role = DefaultRole
+	}
+	if o.Strategy == "" {
+		o.Strategy = Hash
+	}
+	switch {
+	case !identifier.MatchString(o.Schema):
+		return fmt.Errorf("invalid schema name %q", o.Schema)
+	case strings.EqualFold(o.Schema, "public"):
+		return fmt.Errorf("the views cannot be created in the public schema, which holds the tables")
+	case !identifier.MatchString(o.Role):
+		return fmt.Errorf("invalid role name %q", o.Role)
+	}
+	if _, err := expression(o.Strategy, "c"); err != nil {
+		return err
+	}
+	for field, strategy := range o.Fields {
+		if _, err := expression(strategy, "c"); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// Views returns the masked views of the tables of the models, in the order of the models.
+func Views(defs []*model.ModelDefinition, options Options) ([]View, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	// Fields are matched case-insensitively, and removed once found to report those matching no field.
+	fields := make(map[string]string, len(options.Fields))
+	for name := range options.Fields {
+		fields[strings.ToLower(name)] = name
+	}
+
+	views := make([]View, len(defs))
+	for i, def := range defs {
+		table := model.TableName(def)
+		view := View{Model: def.Name, Table: table, Name: options.Schema + "." + table, Masked: map[string]string{}}
+		var columns []string
+		for _, column := range model.StoredColumns(def) {
+			quoted := pq.QuoteIdentifier(column.Name)
+			strategy := ""
+			if column.Field != nil {
+				key := strings.ToLower(def.Name + "." + column.Field.Name)
+				if name, ok := fields[key]; ok {
+					strategy = options.Fields[name]
+					delete(fields, key)
+				} else if column.Field.Sensitive || column.Field.Encrypted {
+					strategy = options.Strategy
+				}
+			}
+			if strategy == "" {
+				columns = append(columns, quoted)
+				continue
+			}
+			expr, _ := expression(strategy, quoted)
+			columns = append(columns, expr+" AS "+quoted)
+			view.Masked[column.Name] = strategy
+		}
+		view.SQL = fmt.Sprintf("CREATE VIEW %s.%s AS SELECT %s FROM %s", pq.QuoteIdentifier(options.Schema),
+			pq.QuoteIdentifier(table), strings.Join(columns, ", "), pq.QuoteIdentifier(table))
+		views[i] = view
+	}
+	if len(fields) > 0 {
+		unknown := make([]string, 0, len(fields))
+		for _, name := range fields {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("no field %s among the models", strings.Join(unknown, ", "))
+	}
+	return views, nil
+}
+
+// expression returns the SQL expression masking a quoted column with the given strategy. Every expression but
+// Null's is NULL when the value is.
+func expression(strategy, column string) (string, error) {
+	value := column + "::text"
+	switch strategy {
+	case Hash:
+		return fmt.Sprintf("encode(sha256(convert_to((SELECT key FROM %s) || %s, 'UTF8')), 'hex')", KeyTable, value), nil
+	case Partial:
+		kept := fmt.Sprintf("least(4, length(%s) / 4)", value)
+		return fmt.Sprintf("repeat('*', length(%s) - %s) || right(%s, %s)", value, kept, value, kept), nil
+	case Redact:
+		return fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE '[redacted]' END", column), nil
+	case Null:
+		return "NULL::text", nil
+	}
+	return "", fmt.Errorf("unknown strategy %q: use one of %v", strategy, Strategies)
+}
+
+// Statements returns the statements creating the key of the hashes, the role and the schema if they do not
+// exist, replacing the views, and granting the role to read the views and nothing else of the schema.
+func Statements(views []View, options Options) ([]string, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	schema, role := pq.QuoteIdentifier(options.Schema), pq.QuoteIdentifier(options.Role)
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (key TEXT NOT NULL)", KeyTable),
+		fmt.Sprintf("REVOKE ALL ON %s FROM PUBLIC", KeyTable),
+		// gen_random_uuid, unlike random, draws from a cryptographically secure source.
+		fmt.Sprintf("INSERT INTO %[1]s (key) SELECT replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', '') WHERE NOT EXISTS (SELECT 1 FROM %[1]s)", KeyTable),
+		fmt.Sprintf("DO $$ BEGIN IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = %s) THEN CREATE ROLE %s NOLOGIN; END IF; END $$",
+			pq.QuoteLiteral(options.Role), role),
+		"CREATE SCHEMA IF NOT EXISTS " + schema,
+		fmt.Sprintf("REVOKE ALL ON ALL TABLES IN SCHEMA %s FROM %s", schema, role),
+	}
+	for _, view := range views {
+		statements = append(statements,
+			fmt.Sprintf("DROP VIEW IF EXISTS %s.%s", schema, pq.QuoteIdentifier(view.Table)),
+			view.SQL,
+			fmt.Sprintf("GRANT SELECT ON %s.%s TO %s", schema, pq.QuoteIdentifier(view.Table), role))
+	}
+	return append(statements, fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", schema, role)), nil
+}
+
+// Create creates the masked views of the models in db, in a single transaction, and returns them.
+func Create(ctx context.Context, db *sql.DB, defs []*model.ModelDefinition, options Options) ([]View, error) {
+	views, err := Views(defs, options)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := Statements(views, options)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("failed to create the masked views: %w\n%s", err, statement)
+		}
+	}
+	return views, tx.Commit()
+}
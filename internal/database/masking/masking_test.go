@@ -0,0 +1,65 @@
+package masking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func testModels(t *testing.T) []*model.ModelDefinition {
+	user := model.NewModelDefinition("User", []model.Field{
+		model.NewField("Email", "string", "", false, false),
+		model.NewField("Phone", "*string", "", true, false),
+		model.NewField("Plan", "string", "", false, false),
+	})
+	require.NoError(t, user.MarkSensitive("Email"))
+	require.NoError(t, user.MarkSensitive("Phone"))
+	require.NoError(t, user.SetTable("users"))
+	return []*model.ModelDefinition{user}
+}
+
+func TestViews(t *testing.T) {
+	views, err := Views(testModels(t), Options{Fields: map[string]string{"user.phone": Partial}})
+	require.NoError(t, err)
+	require.Len(t, views, 1)
+	view := views[0]
+	assert.Equal(t, "analyst.users", view.Name)
+	assert.Equal(t, map[string]string{"email": Hash, "phone": Partial}, view.Masked)
+	assert.Equal(t, `CREATE VIEW "analyst"."users" AS SELECT "id", "created_at", "updated_at", `+
+		`encode(sha256(convert_to((SELECT key FROM grayv_masking_key) || "email"::text, 'UTF8')), 'hex') AS "email", `+
+		`repeat('*', length("phone"::text) - least(4, length("phone"::text) / 4)) || right("phone"::text, least(4, length("phone"::text) / 4)) AS "phone", `+
+		`"plan" FROM "users"`, view.SQL)
+}
+
+func TestViews_Options(t *testing.T) {
+	views, err := Views(testModels(t), Options{Schema: "reporting", Strategy: Redact, Fields: map[string]string{"User.Plan": Null}})
+	require.NoError(t, err)
+	assert.Equal(t, "reporting.users", views[0].Name)
+	assert.Equal(t, map[string]string{"email": Redact, "phone": Redact, "plan": Null}, views[0].Masked)
+
+	_, err = Views(testModels(t), Options{Fields: map[string]string{"User.Missing": Hash}})
+	assert.EqualError(t, err, "no field User.Missing among the models")
+	_, err = Views(testModels(t), Options{Strategy: "shuffle"})
+	assert.ErrorContains(t, err, `unknown strategy "shuffle"`)
+	_, err = Views(testModels(t), Options{Schema: "public"})
+	assert.Error(t, err)
+	_, err = Views(testModels(t), Options{Role: "analyst; DROP TABLE users"})
+	assert.ErrorContains(t, err, "invalid role name")
+}
+
+func TestStatements(t *testing.T) {
+	views, err := Views(testModels(t), Options{})
+	require.NoError(t, err)
+	statements, err := Statements(views, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, statements, "CREATE SCHEMA IF NOT EXISTS \"analyst\"")
+	assert.Contains(t, statements, `REVOKE ALL ON ALL TABLES IN SCHEMA "analyst" FROM "analyst"`)
+	assert.Contains(t, statements, `DROP VIEW IF EXISTS "analyst"."users"`)
+	assert.Contains(t, statements, views[0].SQL)
+	assert.Contains(t, statements, `GRANT SELECT ON "analyst"."users" TO "analyst"`)
+	assert.Equal(t, `GRANT USAGE ON SCHEMA "analyst" TO "analyst"`, statements[len(statements)-1])
+	assert.Contains(t, statements[3], "CREATE ROLE \"analyst\" NOLOGIN")
+}
@@ -0,0 +1,151 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultBackfillBatchSize is the number of rows a backfill updates per transaction unless its directive sets
+// another with BATCH.
+const DefaultBackfillBatchSize = 10000
+
+// Backfill adds a NOT NULL column with a default to a table without locking it for long, as declared by a
+// "-- Backfill:" directive such as
+//
+//	-- Backfill: posts.status VARCHAR(20) DEFAULT 'draft' BATCH 5000
+//
+// Adding a NOT NULL column directly takes an ACCESS EXCLUSIVE lock while it checks, and on older PostgreSQL
+// versions writes, every row. A backfill instead adds the column as nullable, sets its default for new rows,
+// fills the existing rows in batches of their own transaction, adds a CHECK (column IS NOT NULL) constraint NOT
+// VALID, validates it, which only blocks schema changes, and finally sets the column NOT NULL, which PostgreSQL
+// 12 and later prove by the validated constraint without scanning the table again.
+//
+// Every step can be repeated, so a backfill interrupted midway is resumed by applying its migration again.
+type Backfill struct {
+	Table     string
+	Column    string
+	Type      string
+	Default   string
+	BatchSize int
+}
+
+// backfillDirective declares a backfill in the up SQL of a migration.
+var backfillDirective = regexp.MustCompile(`(?im)^\s*--\s*backfill:\s*(.*?)\s*$`)
+
+// backfillSpec matches the specification of a backfill: table.column type DEFAULT expression [BATCH size].
+var backfillSpec = regexp.MustCompile(`(?is)^((?:[a-z_][\w$]*\.)?[a-z_][\w$]*)\.([a-z_][\w$]*)\s+(.+?)\s+DEFAULT\s+(.+?)(?:\s+BATCH\s+(\d+))?$`)
+
+// notNullSuffix matches NOT NULL written after the type of a backfilled column, which is implied.
+var notNullSuffix = regexp.MustCompile(`(?i)\s+NOT\s+NULL$`)
+
+// ParseBackfill parses the specification of a backfill as written after "-- Backfill:".
+func ParseBackfill(spec string) (*Backfill, error) {
+	match := backfillSpec.FindStringSubmatch(strings.TrimSpace(spec))
+	if match == nil {
+		return nil, fmt.Errorf("invalid backfill %q: expected table.column type DEFAULT expression [BATCH size]", spec)
+	}
+	b := &Backfill{
+		Table:     match[1],
+		Column:    match[2],
+		Type:      notNullSuffix.ReplaceAllString(match[3], ""),
+		Default:   match[4],
+		BatchSize: DefaultBackfillBatchSize,
+	}
+	if match[5] != "" {
+		size, err := strconv.Atoi(match[5])
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("invalid batch size %q of backfill %s.%s", match[5], b.Table, b.Column)
+		}
+		b.BatchSize = size
+	}
+	return b, nil
+}
+
+// parseBackfills returns the backfills declared by the directives of the up SQL of a migration. The steps of a
+// backfill commit separately, so a migration declaring backfills may contain no other statement.
+func parseBackfills(upSQL string) ([]*Backfill, error) {
+	var backfills []*Backfill
+	for _, match := range backfillDirective.FindAllStringSubmatch(upSQL, -1) {
+		b, err := ParseBackfill(match[1])
+		if err != nil {
+			return nil, err
+		}
+		backfills = append(backfills, b)
+	}
+	if len(backfills) > 0 && strings.TrimSpace(stripComments(upSQL)) != "" {
+		return nil, fmt.Errorf("a migration with backfills can contain no other statement, as their steps commit separately; move the statements to another migration")
+	}
+	return backfills, nil
+}
+
+// constraint returns the name of the CHECK constraint the backfill adds while the column is not yet NOT NULL.
+func (b *Backfill) constraint() string {
+	table := b.Table[strings.LastIndex(b.Table, ".")+1:]
+	name := fmt.Sprintf("%s_%s_not_null_check", table, b.Column)
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// BackfillStep is a statement of a backfill, run in a transaction of its own.
+type BackfillStep struct {
+	Name string
+	SQL  string
+	// Batched tells whether the statement updates a batch of rows, and is repeated until it updates none.
+	Batched bool
+}
+
+// Steps returns the statements of the backfill in the order they are run.
+func (b *Backfill) Steps() []BackfillStep {
+	constraint := b.constraint()
+	return []BackfillStep{
+		{Name: "add nullable column", SQL: fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", b.Table, b.Column, b.Type)},
+		{Name: "set default", SQL: fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s", b.Table, b.Column, b.Default)},
+		{Name: "backfill", Batched: true, SQL: fmt.Sprintf(
+			"UPDATE %[1]s SET %[2]s = %[3]s WHERE ctid = ANY (ARRAY(SELECT ctid FROM %[1]s WHERE %[2]s IS NULL LIMIT %[4]d))",
+			b.Table, b.Column, b.Default, b.BatchSize)},
+		{Name: "add constraint not valid", SQL: fmt.Sprintf(
+			"ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s, ADD CONSTRAINT %s CHECK (%s IS NOT NULL) NOT VALID",
+			b.Table, constraint, constraint, b.Column)},
+		{Name: "validate constraint", SQL: fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s", b.Table, constraint)},
+		{Name: "set not null", SQL: fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", b.Table, b.Column)},
+		{Name: "drop constraint", SQL: fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", b.Table, constraint)},
+	}
+}
+
+// String returns the specification of the backfill.
+func (b *Backfill) String() string {
+	return fmt.Sprintf("%s.%s %s DEFAULT %s BATCH %d", b.Table, b.Column, b.Type, b.Default, b.BatchSize)
+}
+
+// runBackfill runs the steps of a backfill, each committing on its own, and returns the number of rows it
+// filled.
+func runBackfill(ctx context.Context, db *sql.DB, b *Backfill, progress func(rows int64)) (int64, error) {
+	var filled int64
+	for _, step := range b.Steps() {
+		for {
+			result, err := db.ExecContext(ctx, step.SQL)
+			if err != nil {
+				return filled, fmt.Errorf("backfill %s.%s failed to %s: %w", b.Table, b.Column, step.Name, err)
+			}
+			if !step.Batched {
+				break
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return filled, err
+			}
+			if rows == 0 {
+				break
+			}
+			filled += rows
+			progress(filled)
+		}
+	}
+	return filled, nil
+}
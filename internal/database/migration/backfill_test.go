@@ -0,0 +1,67 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBackfill(t *testing.T) {
+	b, err := ParseBackfill("public.posts.status VARCHAR(20) NOT NULL DEFAULT 'draft' BATCH 500")
+	require.NoError(t, err)
+	assert.Equal(t, &Backfill{Table: "public.posts", Column: "status", Type: "VARCHAR(20)", Default: "'draft'", BatchSize: 500}, b)
+
+	b, err = ParseBackfill("posts.published_at TIMESTAMP WITH TIME ZONE default now()")
+	require.NoError(t, err)
+	assert.Equal(t, &Backfill{Table: "posts", Column: "published_at", Type: "TIMESTAMP WITH TIME ZONE", Default: "now()", BatchSize: DefaultBackfillBatchSize}, b)
+
+	for _, spec := range []string{"posts.status TEXT", "status TEXT DEFAULT ''", "posts.status TEXT DEFAULT '' BATCH 0"} {
+		_, err := ParseBackfill(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestBackfill_Steps(t *testing.T) {
+	b := &Backfill{Table: "public.posts", Column: "status", Type: "TEXT", Default: "'draft'", BatchSize: 500}
+	var statements []string
+	for _, step := range b.Steps() {
+		statements = append(statements, step.SQL)
+	}
+	assert.Equal(t, []string{
+		"ALTER TABLE public.posts ADD COLUMN IF NOT EXISTS status TEXT",
+		"ALTER TABLE public.posts ALTER COLUMN status SET DEFAULT 'draft'",
+		"UPDATE public.posts SET status = 'draft' WHERE ctid = ANY (ARRAY(SELECT ctid FROM public.posts WHERE status IS NULL LIMIT 500))",
+		"ALTER TABLE public.posts DROP CONSTRAINT IF EXISTS posts_status_not_null_check, ADD CONSTRAINT posts_status_not_null_check CHECK (status IS NOT NULL) NOT VALID",
+		"ALTER TABLE public.posts VALIDATE CONSTRAINT posts_status_not_null_check",
+		"ALTER TABLE public.posts ALTER COLUMN status SET NOT NULL",
+		"ALTER TABLE public.posts DROP CONSTRAINT IF EXISTS posts_status_not_null_check",
+	}, statements)
+}
+
+func TestLoadMigrations_Backfills(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240101000000_post_status.sql": {Data: []byte("-- Up\n-- Backfill: posts.status TEXT DEFAULT 'draft'\n-- Backfill: posts.views INTEGER DEFAULT 0 BATCH 100\n-- Down\nALTER TABLE posts DROP COLUMN status, DROP COLUMN views;\n")},
+	}
+	migrator := NewMigratorFS(nil, logrus.New(), fsys)
+	require.NoError(t, migrator.LoadMigrations())
+	m := migrator.Migrations()[0]
+	require.Len(t, m.Backfills, 2)
+	assert.Equal(t, "posts.views INTEGER DEFAULT 0 BATCH 100", m.Backfills[1].String())
+	assert.Equal(t, PhaseExpand, m.Phase)
+	assert.Empty(t, migrator.LintPhases())
+
+	catalog := fakeCatalog{tables: map[string]TableStats{"posts": {Exists: true, Rows: 5000000, Bytes: 2 << 30}}}
+	impact, err := EstimateImpact(context.Background(), catalog, migrator.Migrations(), ImpactOptions{})
+	require.NoError(t, err)
+	assert.False(t, impact.MaintenanceWindow)
+	assert.Len(t, impact.Statements, 14)
+
+	fsys = fstest.MapFS{
+		"migrations/20240101000000_post_status.sql": {Data: []byte("-- Up\n-- Backfill: posts.status TEXT DEFAULT 'draft'\nCREATE INDEX posts_status ON posts (status);\n-- Down\n")},
+	}
+	assert.ErrorContains(t, NewMigratorFS(nil, logrus.New(), fsys).LoadMigrations(), "a migration with backfills can contain no other statement")
+}
@@ -0,0 +1,453 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Locks are the Postgres table locks taken by migration statements, from the weakest to the strongest.
+const (
+	LockRowExclusive         = "ROW EXCLUSIVE"
+	LockShareUpdateExclusive = "SHARE UPDATE EXCLUSIVE"
+	LockShare                = "SHARE"
+	LockShareRowExclusive    = "SHARE ROW EXCLUSIVE"
+	LockAccessExclusive      = "ACCESS EXCLUSIVE"
+)
+
+var lockStrength = map[string]int{
+	"":                       0,
+	LockRowExclusive:         1,
+	LockShareUpdateExclusive: 2,
+	LockShare:                3,
+	LockShareRowExclusive:    4,
+	LockAccessExclusive:      5,
+}
+
+// BlocksWrites tells whether a lock blocks the inserts, updates and deletes of other sessions.
+func BlocksWrites(lock string) bool {
+	return lockStrength[lock] >= lockStrength[LockShare]
+}
+
+// BlocksReads tells whether a lock blocks the reads of other sessions.
+func BlocksReads(lock string) bool {
+	return lock == LockAccessExclusive
+}
+
+// Default thresholds of ImpactOptions.
+const (
+	DefaultLargeTableBytes = 100 << 20
+	DefaultLargeUpdateRows = 1000000
+)
+
+// ImpactOptions sets what Impact considers large enough to need a maintenance window.
+type ImpactOptions struct {
+	// LargeTableBytes is the size, indexes included, past which rewriting or scanning a table under a lock
+	// blocking writes needs a maintenance window.
+	LargeTableBytes int64
+	// LargeUpdateRows is the number of rows past which an UPDATE, DELETE or INSERT needs a maintenance window:
+	// its transaction holds the locks of the rows until the migration commits.
+	LargeUpdateRows int64
+}
+
+// TableStats are the statistics of a table in the catalog.
+type TableStats struct {
+	Exists bool
+	// Rows is the estimated number of rows, from the last VACUUM or ANALYZE.
+	Rows int64
+	// Bytes is the size of the table, its indexes and its TOAST table.
+	Bytes int64
+}
+
+// Catalog provides the statistics impact estimates are based on.
+type Catalog interface {
+	// TableStats returns the statistics of a table.
+	TableStats(ctx context.Context, table string) (TableStats, error)
+	// EstimateRows returns the number of rows the planner expects a statement to process, without running it.
+	EstimateRows(ctx context.Context, statement string) (int64, error)
+}
+
+// NewCatalog returns the catalog of a Postgres database, read from pg_class and EXPLAIN.
+func NewCatalog(db *sql.DB) Catalog {
+	return dbCatalog{db}
+}
+
+type dbCatalog struct {
+	db *sql.DB
+}
+
+func (c dbCatalog) TableStats(ctx context.Context, table string) (TableStats, error) {
+	var stats TableStats
+	err := c.db.QueryRowContext(ctx, `SELECT GREATEST(c.reltuples, 0)::bigint, pg_total_relation_size(c.oid)
+FROM pg_class c WHERE c.oid = to_regclass($1)`, table).Scan(&stats.Rows, &stats.Bytes)
+	if err == sql.ErrNoRows {
+		return stats, nil
+	}
+	stats.Exists = err == nil
+	return stats, err
+}
+
+func (c dbCatalog) EstimateRows(ctx context.Context, statement string) (int64, error) {
+	var plan []byte
+	if err := c.db.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+statement).Scan(&plan); err != nil {
+		return 0, err
+	}
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+			// Plans are the inputs of the ModifyTable node of a data-modifying statement, which returns no rows
+			// itself.
+			Plans []struct {
+				Rows float64 `json:"Plan Rows"`
+			} `json:"Plans"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &plans); err != nil || len(plans) == 0 {
+		return 0, fmt.Errorf("unexpected EXPLAIN output: %s", plan)
+	}
+	rows := plans[0].Plan.Rows
+	for _, input := range plans[0].Plan.Plans {
+		if input.Rows > rows {
+			rows = input.Rows
+		}
+	}
+	return int64(rows), nil
+}
+
+// StatementImpact is the estimated impact of a statement of a migration.
+type StatementImpact struct {
+	Migration string `json:"migration"`
+	Statement string `json:"statement"`
+	Table     string `json:"table,omitempty"`
+	// Operation describes what the statement does to the table.
+	Operation string `json:"operation"`
+	// Lock is the lock the statement holds on the table until the migration commits.
+	Lock string `json:"lock,omitempty"`
+	// Rewrite tells whether the statement rewrites the table, and Scan whether it reads all of it, e.g. to
+	// build an index or validate a constraint.
+	Rewrite bool `json:"rewrite"`
+	Scan    bool `json:"scan"`
+	// NewTable tells whether the table is created by a migration estimated before, and so is empty.
+	NewTable bool `json:"new_table,omitempty"`
+	// Rows and Bytes are the statistics of the table.
+	Rows  int64 `json:"rows"`
+	Bytes int64 `json:"bytes"`
+	// AffectedRows is the number of rows an UPDATE, DELETE or INSERT is expected to write, or -1 if unknown.
+	AffectedRows int64 `json:"affected_rows,omitempty"`
+	// Window tells why the statement needs a maintenance window, if it does.
+	Window string `json:"window,omitempty"`
+}
+
+// Impact is the estimated impact of migrations.
+type Impact struct {
+	Statements []StatementImpact `json:"statements"`
+	// MaintenanceWindow tells whether a statement needs a maintenance window.
+	MaintenanceWindow bool `json:"maintenance_window"`
+}
+
+// EstimateImpact estimates the impact of applying the migrations in order: the tables their statements lock,
+// how strongly and for how long, judging by whether they rewrite or scan the tables, and the sizes of the tables
+// in the catalog statistics. Statements that touch no existing table, such as CREATE FUNCTION, are left out.
+// Backfills are estimated by their steps, the batch update once.
+func EstimateImpact(ctx context.Context, catalog Catalog, migrations []*Migration, options ImpactOptions) (*Impact, error) {
+	if options.LargeTableBytes <= 0 {
+		options.LargeTableBytes = DefaultLargeTableBytes
+	}
+	if options.LargeUpdateRows <= 0 {
+		options.LargeUpdateRows = DefaultLargeUpdateRows
+	}
+	impact := &Impact{Statements: []StatementImpact{}}
+	created := map[string]bool{}
+	stats := map[string]TableStats{}
+	for _, m := range migrations {
+		statements := splitStatements(stripComments(m.UpSQL))
+		proven := map[int]bool{}
+		for _, b := range m.Backfills {
+			for _, step := range b.Steps() {
+				// Setting the column NOT NULL is proven by the validated constraint, without a scan.
+				proven[len(statements)] = step.Name == "set not null"
+				statements = append(statements, step.SQL)
+			}
+		}
+		for i, statement := range statements {
+			si, ok := analyzeStatement(statement)
+			if !ok {
+				continue
+			}
+			si.Migration = m.Name
+			if proven[i] {
+				si.Scan = false
+			}
+			if si.NewTable {
+				created[si.Table] = true
+				continue
+			}
+			if created[si.Table] {
+				si.NewTable = true
+			} else if si.Table != "" {
+				s, cached := stats[si.Table]
+				if !cached {
+					var err error
+					if s, err = catalog.TableStats(ctx, si.Table); err != nil {
+						return nil, fmt.Errorf("failed to read statistics of %s: %w", si.Table, err)
+					}
+					stats[si.Table] = s
+				}
+				si.Rows, si.Bytes = s.Rows, s.Bytes
+			}
+			if si.Lock == LockRowExclusive && !si.NewTable {
+				// The statement may reference tables or columns added by the migrations, unknown to EXPLAIN.
+				si.AffectedRows = -1
+				if rows, err := catalog.EstimateRows(ctx, statement); err == nil {
+					si.AffectedRows = rows
+				}
+			}
+			si.Window = windowReason(si, options)
+			impact.MaintenanceWindow = impact.MaintenanceWindow || si.Window != ""
+			impact.Statements = append(impact.Statements, si)
+		}
+	}
+	return impact, nil
+}
+
+// windowReason tells why a statement needs a maintenance window, or returns "" if it does not.
+func windowReason(si StatementImpact, options ImpactOptions) string {
+	if si.NewTable {
+		return ""
+	}
+	if si.AffectedRows >= options.LargeUpdateRows {
+		return fmt.Sprintf("writes about %d rows in one transaction", si.AffectedRows)
+	}
+	if !BlocksWrites(si.Lock) || si.Bytes < options.LargeTableBytes || !(si.Rewrite || si.Scan) {
+		return ""
+	}
+	blocked := "writes"
+	if BlocksReads(si.Lock) {
+		blocked = "reads and writes"
+	}
+	action := "scans"
+	if si.Rewrite {
+		action = "rewrites"
+	}
+	return fmt.Sprintf("%s a large table while blocking %s", action, blocked)
+}
+
+// statementImpact returns the impact of a statement on the table it alters.
+func statementImpact(table, operation, lock string, rewrite, scan bool) (StatementImpact, bool) {
+	return StatementImpact{Table: table, Operation: operation, Lock: lock, Rewrite: rewrite, Scan: scan}, true
+}
+
+// The statements analyzed, matched on their text with spaces normalized. Table names may be quoted or
+// qualified by a schema.
+const tableName = `((?:"[^"]+"|[\w$]+)(?:\.(?:"[^"]+"|[\w$]+))?)`
+
+var (
+	createTableStatement = regexp.MustCompile(`(?i)^CREATE\s+(?:(?:GLOBAL|LOCAL)\s+)?(?:(?:TEMP|TEMPORARY|UNLOGGED)\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + tableName)
+	createIndexStatement = regexp.MustCompile(`(?i)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(?:\S+\s+)?ON\s+(?:ONLY\s+)?` + tableName)
+	dropTableStatement   = regexp.MustCompile(`(?i)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?` + tableName)
+	truncateStatement    = regexp.MustCompile(`(?i)^TRUNCATE\s+(?:TABLE\s+)?(?:ONLY\s+)?` + tableName)
+	alterTableStatement  = regexp.MustCompile(`(?i)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + tableName + `\s+(.*)$`)
+	updateStatement      = regexp.MustCompile(`(?i)^UPDATE\s+(?:ONLY\s+)?` + tableName)
+	deleteStatement      = regexp.MustCompile(`(?i)^DELETE\s+FROM\s+(?:ONLY\s+)?` + tableName)
+	insertStatement      = regexp.MustCompile(`(?i)^INSERT\s+INTO\s+` + tableName)
+	rewriteStatement     = regexp.MustCompile(`(?i)^(VACUUM\s+(?:\(\s*)?FULL\b[^;]*?|CLUSTER(?:\s+VERBOSE)?)\s+` + tableName + `\s*\)?\s*$`)
+	reindexStatement     = regexp.MustCompile(`(?i)^REINDEX\s+(?:\([^)]*\)\s+)?TABLE\s+(CONCURRENTLY\s+)?` + tableName)
+)
+
+// analyzeStatement returns the impact of a statement on the table it alters, without statistics. Statements
+// creating a table return an impact with NewTable set.
+func analyzeStatement(statement string) (StatementImpact, bool) {
+	statement = strings.Join(strings.Fields(statement), " ")
+	si, ok := analyze(statement)
+	si.Statement = statement
+	if len(si.Statement) > 120 {
+		si.Statement = si.Statement[:117] + "..."
+	}
+	return si, ok
+}
+
+func analyze(statement string) (StatementImpact, bool) {
+	if m := createTableStatement.FindStringSubmatch(statement); m != nil {
+		return StatementImpact{Table: m[1], Operation: "create table", NewTable: true}, true
+	}
+	if m := createIndexStatement.FindStringSubmatch(statement); m != nil {
+		if m[1] != "" {
+			return statementImpact(m[2], "create index concurrently", LockShareUpdateExclusive, false, true)
+		}
+		return statementImpact(m[2], "create index", LockShare, false, true)
+	}
+	if m := dropTableStatement.FindStringSubmatch(statement); m != nil {
+		return statementImpact(m[1], "drop table", LockAccessExclusive, false, false)
+	}
+	if m := truncateStatement.FindStringSubmatch(statement); m != nil {
+		return statementImpact(m[1], "truncate", LockAccessExclusive, false, false)
+	}
+	if m := alterTableStatement.FindStringSubmatch(statement); m != nil {
+		return alterTableImpact(m[1], m[2])
+	}
+	if m := rewriteStatement.FindStringSubmatch(statement); m != nil {
+		return statementImpact(m[2], strings.ToLower(strings.Fields(m[1])[0]), LockAccessExclusive, true, false)
+	}
+	if m := reindexStatement.FindStringSubmatch(statement); m != nil {
+		if m[1] != "" {
+			return statementImpact(m[2], "reindex concurrently", LockShareUpdateExclusive, false, true)
+		}
+		return statementImpact(m[2], "reindex", LockShare, false, true)
+	}
+	for _, dml := range []struct {
+		pattern   *regexp.Regexp
+		operation string
+	}{{updateStatement, "update"}, {deleteStatement, "delete"}, {insertStatement, "insert"}} {
+		if m := dml.pattern.FindStringSubmatch(statement); m != nil {
+			return statementImpact(m[1], dml.operation, LockRowExclusive, false, false)
+		}
+	}
+	return StatementImpact{}, false
+}
+
+// Clauses of ALTER TABLE actions.
+var (
+	addConstraintAction = regexp.MustCompile(`(?i)^ADD\s+(?:CONSTRAINT\s+\S+\s+)?(FOREIGN\s+KEY|CHECK|PRIMARY\s+KEY|UNIQUE|EXCLUDE)\b`)
+	addColumnAction     = regexp.MustCompile(`(?i)^ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?\S+\s+(\S+)(.*)$`)
+	alterTypeAction     = regexp.MustCompile(`(?i)^ALTER\s+(?:COLUMN\s+)?\S+\s+(?:SET\s+DATA\s+)?TYPE\b`)
+	setNotNullAction    = regexp.MustCompile(`(?i)^ALTER\s+(?:COLUMN\s+)?\S+\s+SET\s+NOT\s+NULL\b`)
+	validateAction      = regexp.MustCompile(`(?i)^VALIDATE\s+CONSTRAINT\b`)
+	rewriteAction       = regexp.MustCompile(`(?i)^SET\s+(TABLESPACE|LOGGED|UNLOGGED)\b`)
+	notValid            = regexp.MustCompile(`(?i)\bNOT\s+VALID\b`)
+	usingIndex          = regexp.MustCompile(`(?i)\bUSING\s+INDEX\b`)
+	// volatileDefault matches a column default Postgres evaluates for every row, which makes adding the column
+	// rewrite the table; other defaults are stored once in the catalog.
+	volatileDefault = regexp.MustCompile(`(?i)\b(?:DEFAULT\s+(?:[^,]*\b)?(?:random|clock_timestamp|timeofday|gen_random_uuid|uuid_generate_v\d\w*|nextval)\s*\(|GENERATED\s+.*\bSTORED\b|GENERATED\s+.*\bAS\s+IDENTITY\b)`)
+)
+
+// alterTableImpact returns the impact of the actions of an ALTER TABLE statement: the strongest lock and every
+// rewrite or scan of its actions.
+func alterTableImpact(table, actions string) (StatementImpact, bool) {
+	si := StatementImpact{Table: table}
+	var operations []string
+	for _, action := range splitTopLevel(actions, ',') {
+		action = strings.TrimSpace(action)
+		operation, lock, rewrite, scan := alterAction(action)
+		operations = append(operations, operation)
+		if lockStrength[lock] > lockStrength[si.Lock] {
+			si.Lock = lock
+		}
+		si.Rewrite = si.Rewrite || rewrite
+		si.Scan = si.Scan || scan
+	}
+	si.Operation = strings.Join(operations, ", ")
+	return si, true
+}
+
+// alterAction returns a description of an ALTER TABLE action, the lock it takes, and whether it rewrites or
+// scans the table.
+func alterAction(action string) (operation, lock string, rewrite, scan bool) {
+	lock = LockAccessExclusive
+	if m := addConstraintAction.FindStringSubmatch(action); m != nil {
+		kind := strings.ToLower(strings.Join(strings.Fields(m[1]), " "))
+		if kind == "foreign key" {
+			lock = LockShareRowExclusive
+		}
+		switch {
+		case notValid.MatchString(action):
+			return "add " + kind + " not valid", lock, false, false
+		case usingIndex.MatchString(action):
+			return "add " + kind + " using index", lock, false, false
+		}
+		return "add " + kind, lock, false, true
+	}
+	switch {
+	case validateAction.MatchString(action):
+		return "validate constraint", LockShareUpdateExclusive, false, true
+	case alterTypeAction.MatchString(action):
+		return "alter column type", lock, true, false
+	case setNotNullAction.MatchString(action):
+		return "set not null", lock, false, true
+	case rewriteAction.MatchString(action):
+		return "set " + strings.ToLower(rewriteAction.FindStringSubmatch(action)[1]), lock, true, false
+	}
+	if m := addColumnAction.FindStringSubmatch(action); m != nil {
+		columnType := strings.ToLower(m[1])
+		if strings.HasSuffix(columnType, "serial") || volatileDefault.MatchString(m[2]) {
+			return "add column with a volatile default", lock, true, false
+		}
+		return "add column", lock, false, false
+	}
+	fields := strings.Fields(strings.ToLower(action))
+	if len(fields) > 2 {
+		fields = fields[:2]
+	}
+	return strings.Join(fields, " "), lock, false, false
+}
+
+// splitTopLevel splits s on sep outside parentheses and quotes.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitStatements splits SQL into its statements, on semicolons outside quotes, dollar-quoted bodies such as
+// those of functions, and block comments. Empty statements are left out.
+func splitStatements(sql string) []string {
+	var statements []string
+	start := 0
+	add := func(end int) {
+		if statement := strings.TrimSpace(sql[start:end]); statement != "" {
+			statements = append(statements, statement)
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"':
+			for i++; i < len(sql) && sql[i] != c; i++ {
+			}
+		case c == '$':
+			if tag := dollarTag.FindString(sql[i:]); tag != "" {
+				if end := strings.Index(sql[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				} else {
+					i = len(sql)
+				}
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(sql)
+			}
+		case c == ';':
+			add(i)
+		}
+	}
+	if start < len(sql) {
+		add(len(sql))
+	}
+	return statements
+}
+
+// dollarTag matches the opening tag of a dollar-quoted string, $$ or $name$.
+var dollarTag = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
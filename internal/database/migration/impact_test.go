@@ -0,0 +1,113 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCatalog serves table statistics and row estimates from maps.
+type fakeCatalog struct {
+	tables map[string]TableStats
+	rows   map[string]int64
+}
+
+func (c fakeCatalog) TableStats(ctx context.Context, table string) (TableStats, error) {
+	return c.tables[table], nil
+}
+
+func (c fakeCatalog) EstimateRows(ctx context.Context, statement string) (int64, error) {
+	rows, ok := c.rows[statement]
+	if !ok {
+		return 0, errors.New("relation does not exist")
+	}
+	return rows, nil
+}
+
+func TestAnalyzeStatement(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      StatementImpact
+	}{
+		{"CREATE INDEX posts_slug ON posts (slug)", StatementImpact{Table: "posts", Operation: "create index", Lock: LockShare, Scan: true}},
+		{"CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS posts_slug ON public.posts (slug)",
+			StatementImpact{Table: "public.posts", Operation: "create index concurrently", Lock: LockShareUpdateExclusive, Scan: true}},
+		{"ALTER TABLE posts ADD COLUMN slug TEXT NOT NULL DEFAULT ''", StatementImpact{Table: "posts", Operation: "add column", Lock: LockAccessExclusive}},
+		{"ALTER TABLE posts ADD COLUMN token UUID DEFAULT gen_random_uuid()",
+			StatementImpact{Table: "posts", Operation: "add column with a volatile default", Lock: LockAccessExclusive, Rewrite: true}},
+		{"ALTER TABLE posts ALTER COLUMN views TYPE BIGINT, ALTER COLUMN slug SET NOT NULL",
+			StatementImpact{Table: "posts", Operation: "alter column type, set not null", Lock: LockAccessExclusive, Rewrite: true, Scan: true}},
+		{"ALTER TABLE comments ADD CONSTRAINT comments_post_fk FOREIGN KEY (post_id) REFERENCES posts (id) NOT VALID",
+			StatementImpact{Table: "comments", Operation: "add foreign key not valid", Lock: LockShareRowExclusive}},
+		{"ALTER TABLE comments VALIDATE CONSTRAINT comments_post_fk",
+			StatementImpact{Table: "comments", Operation: "validate constraint", Lock: LockShareUpdateExclusive, Scan: true}},
+		{"ALTER TABLE posts ADD CHECK (views >= 0)", StatementImpact{Table: "posts", Operation: "add check", Lock: LockAccessExclusive, Scan: true}},
+		{"ALTER TABLE posts DROP COLUMN legacy", StatementImpact{Table: "posts", Operation: "drop column", Lock: LockAccessExclusive}},
+		{"UPDATE posts SET slug = id::text", StatementImpact{Table: "posts", Operation: "update", Lock: LockRowExclusive}},
+		{"VACUUM FULL posts", StatementImpact{Table: "posts", Operation: "vacuum", Lock: LockAccessExclusive, Rewrite: true}},
+		{`CREATE TABLE "Tags" (id SERIAL)`, StatementImpact{Table: `"Tags"`, Operation: "create table", NewTable: true}},
+	}
+	for _, tt := range tests {
+		si, ok := analyzeStatement(tt.statement)
+		if assert.True(t, ok, tt.statement) {
+			tt.want.Statement = tt.statement
+			assert.Equal(t, tt.want, si)
+		}
+	}
+
+	_, ok := analyzeStatement("CREATE FUNCTION touch() RETURNS trigger AS $$ BEGIN RETURN NEW; END $$ LANGUAGE plpgsql")
+	assert.False(t, ok)
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+INSERT INTO notes (text) VALUES ('a; b'); /* ; */ UPDATE notes SET text = 'c';`
+	assert.Equal(t, []string{
+		"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql",
+		"INSERT INTO notes (text) VALUES ('a; b')",
+		"/* ; */ UPDATE notes SET text = 'c'",
+	}, splitStatements(sql))
+}
+
+func TestEstimateImpact(t *testing.T) {
+	catalog := fakeCatalog{
+		tables: map[string]TableStats{
+			"posts":    {Exists: true, Rows: 5000000, Bytes: 2 << 30},
+			"comments": {Exists: true, Rows: 1000, Bytes: 1 << 20},
+		},
+		rows: map[string]int64{"UPDATE posts SET slug = id::text": 5000000},
+	}
+	migrations := []*Migration{
+		{Name: "1_index.sql", UpSQL: "CREATE INDEX CONCURRENTLY posts_slug ON posts (slug);\nALTER TABLE comments ALTER COLUMN body TYPE TEXT;"},
+		{Name: "2_tags.sql", UpSQL: "CREATE TABLE tags (id SERIAL);\nCREATE INDEX tags_id ON tags (id);\n-- ALTER TABLE posts ALTER COLUMN id TYPE BIGINT;"},
+		{Name: "3_backfill.sql", UpSQL: "UPDATE posts SET slug = id::text;\nUPDATE tags SET id = id;\nDELETE FROM comments WHERE post_id IS NULL;"},
+		{Name: "4_not_null.sql", UpSQL: "ALTER TABLE posts ALTER COLUMN slug SET NOT NULL;"},
+	}
+	impact, err := EstimateImpact(context.Background(), catalog, migrations, ImpactOptions{})
+	require.NoError(t, err)
+	assert.True(t, impact.MaintenanceWindow)
+
+	windows := map[string]string{}
+	for _, si := range impact.Statements {
+		windows[si.Migration+" "+si.Operation+" "+si.Table] = si.Window
+	}
+	assert.Equal(t, map[string]string{
+		"1_index.sql create index concurrently posts": "",
+		"1_index.sql alter column type comments":      "",
+		"2_tags.sql create index tags":                "",
+		"3_backfill.sql update posts":                 "writes about 5000000 rows in one transaction",
+		"3_backfill.sql update tags":                  "",
+		"3_backfill.sql delete comments":              "",
+		"4_not_null.sql set not null posts":           "scans a large table while blocking reads and writes",
+	}, windows)
+
+	assert.True(t, impact.Statements[2].NewTable)
+	assert.Equal(t, int64(-1), impact.Statements[5].AffectedRows, "EXPLAIN failed for the DELETE")
+
+	impact, err = EstimateImpact(context.Background(), catalog, migrations[:2], ImpactOptions{})
+	require.NoError(t, err)
+	assert.False(t, impact.MaintenanceWindow)
+}
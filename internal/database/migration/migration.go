@@ -1,11 +1,15 @@
 package migration
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/ooyeku/grayv-lsm/embedded"
+	"github.com/ooyeku/grayv-lsm/pkg/schema"
 	"github.com/sirupsen/logrus"
-	"path/filepath"
+	"io/fs"
+	"os"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,12 +33,20 @@ func init() {
 //   - UpSQL: string - the SQL code to apply the migration
 //   - DownSQL: string - the SQL code to rollback the migration
 //   - Timestamp: time.Time - the timestamp when the migration was created
+//   - Phase: Phase - the expand/contract phase the migration is applied in
+//   - Backfills: []*Backfill - the NOT NULL columns the migration adds in steps, declared by "-- Backfill:"
+//     directives
+//   - Squashes: []int64 - the versions of the migrations a baseline replaces, declared by a "-- Squashes:"
+//     directive, see Squash
 type Migration struct {
 	Version   int64
 	Name      string
 	UpSQL     string
 	DownSQL   string
 	Timestamp time.Time
+	Phase     Phase
+	Backfills []*Backfill
+	Squashes  []int64
 }
 
 // Migrator represents a database migrator that can apply and rollback migrations.
@@ -43,6 +55,7 @@ type Migration struct {
 //
 // Fields:
 // - db: The *sql.DB instance representing the database connection.
+// - fsys: The file system the migration files are read from.
 // - migrations: A slice of *Migration instances representing the available migrations.
 // - logger: The *logrus.Logger instance used for logging migration events.
 //
@@ -58,40 +71,71 @@ type Migration struct {
 //	logger := logrus.New()
 //	migrator := NewMigrator(db, logger)
 //	migrator.LoadMigrations()
-//	err := migrator.Migrate()
-//	err = migrator.Rollback(1)
+//	err := migrator.Migrate(ctx)
+//	err = migrator.Rollback(ctx, 1)
 type Migrator struct {
 	db         *sql.DB
+	fsys       fs.FS
+	dir        string
+	dialect    schema.Dialect
 	migrations []*Migration
 	logger     *logrus.Logger
 }
 
 // NewMigrator creates a new instance of Migrator.
 // It accepts a *sql.DB database connection and a *logrus.Logger logger.
+// Migrations are read from the embedded file system.
 // Returns a pointer to Migrator struct.
 // Example usage:
 //
 //	migrator := migration.NewMigrator(conn.GetDB(), log)
 func NewMigrator(db *sql.DB, logger *logrus.Logger) *Migrator {
-	return &Migrator{db: db, logger: logger}
+	return NewMigratorFS(db, logger, embedded.EmbeddedFiles)
 }
 
-// LoadMigrations reads and loads the embedded migration files from the "migrations" directory.
+// NewMigratorFS creates a new Migrator that reads its migration files from the "migrations" directory of the
+// given file system instead of the embedded files.
+// Example usage:
+//
+//	migrator := migration.NewMigratorFS(conn.GetDB(), log, os.DirFS("."))
+func NewMigratorFS(db *sql.DB, logger *logrus.Logger, fsys fs.FS) *Migrator {
+	return &Migrator{db: db, fsys: fsys, dir: "migrations", dialect: schema.Postgres, logger: logger}
+}
+
+// SetDialect sets the SQL dialect of the database, Postgres by default, which the migrations written in Go
+// are rendered in, see the schema package.
+func (m *Migrator) SetDialect(dialect schema.Dialect) {
+	m.dialect = dialect
+}
+
+// NewMigratorDir creates a new Migrator that reads its migration files from the given directory, such as the
+// migrations directory of a project.
+// Example usage:
+//
+//	migrator := migration.NewMigratorDir(conn.GetDB(), log, "migrations")
+func NewMigratorDir(db *sql.DB, logger *logrus.Logger, dir string) *Migrator {
+	migrator := NewMigratorFS(db, logger, os.DirFS(dir))
+	migrator.dir = "."
+	return migrator
+}
+
+// LoadMigrations reads and loads the migration files from the Migrator's "migrations" directory.
 // It reads the files with the ".sql" extension,
 // parses each migration file,
+// renders the migrations written in Go registered with schema.Register in the Migrator's dialect,
 // sorts the migrations based on their version,
 // and appends them to the Migrator's migrations slice.
 // Returns an error if there is any issue reading, parsing, or sorting the migrations.
 func (m *Migrator) LoadMigrations() error {
-	entries, err := embedded.EmbeddedFiles.ReadDir("migrations")
+	entries, err := fs.ReadDir(m.fsys, m.dir)
 	if err != nil {
-		return fmt.Errorf("failed to read embedded migrations directory: %w", err)
+		return fmt.Errorf("failed to read migrations directory: %w", err)
 	}
 
 	var loadErrors []error
 	for _, entry := range entries {
-		if filepath.Ext(entry.Name()) == ".sql" {
-			migrationContent, err := embedded.EmbeddedFiles.ReadFile(filepath.Join("migrations", entry.Name()))
+		if path.Ext(entry.Name()) == ".sql" {
+			migrationContent, err := fs.ReadFile(m.fsys, path.Join(m.dir, entry.Name()))
 			if err != nil {
 				loadErrors = append(loadErrors, fmt.Errorf("failed to read migration file %s: %w", entry.Name(), err))
 				continue
@@ -105,6 +149,26 @@ func (m *Migrator) LoadMigrations() error {
 		}
 	}
 
+	for _, registered := range schema.Migrations() {
+		if existing := m.findMigration(registered.Version); existing != nil {
+			loadErrors = append(loadErrors, fmt.Errorf("migrations %s and %s have the same version", existing.Name, registered.FileName()))
+			continue
+		}
+		upSQL, downSQL, err := registered.SQL(m.dialect)
+		if err != nil {
+			loadErrors = append(loadErrors, err)
+			continue
+		}
+		m.migrations = append(m.migrations, &Migration{
+			Version:   registered.Version,
+			Name:      registered.FileName(),
+			UpSQL:     upSQL,
+			DownSQL:   downSQL,
+			Timestamp: time.Now(),
+			Phase:     ClassifySQL(upSQL),
+		})
+	}
+
 	sort.Slice(m.migrations, func(i, j int) bool {
 		return m.migrations[i].Version < m.migrations[j].Version
 	})
@@ -122,8 +186,9 @@ func (m *Migrator) LoadMigrations() error {
 // the whitespace from both parts and assigns them to the UpSQL and DownSQL fields of the *Migration object.
 // It also calls parseVersionFromFilename to parse the version from the given filename. If there is an error
 // parsing the version, it returns an error. Finally, it initializes a new *Migration object with the parsed
-// information, including the version, filename, timestamp (set to the current time), and returns it along
-// with nil error.
+// information, including the version, filename, timestamp (set to the current time), and phase (declared with a
+// "-- Phase:" directive or inferred from the up SQL), backfills (declared with "-- Backfill:" directives) and
+// squashed versions (declared with a "-- Squashes:" directive), and returns it along with nil error.
 func parseMigrationContent(filename, content string) (*Migration, error) {
 	parts := strings.Split(content, "-- Down")
 	if len(parts) != 2 {
@@ -138,33 +203,75 @@ func parseMigrationContent(filename, content string) (*Migration, error) {
 		return nil, fmt.Errorf("error parsing version from filename: %w", err)
 	}
 
+	phase, err := migrationPhase(upSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	backfills, err := parseBackfills(upSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	squashes, err := parseSquashes(upSQL)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Migration{
 		Version:   version,
 		Name:      filename,
 		UpSQL:     upSQL,
 		DownSQL:   downSQL,
 		Timestamp: time.Now(),
+		Phase:     phase,
+		Backfills: backfills,
+		Squashes:  squashes,
 	}, nil
 }
 
+// Migrations returns the loaded migrations in version order.
+func (m *Migrator) Migrations() []*Migration {
+	return m.migrations
+}
+
+// PendingMigrations returns the loaded migrations that have not been applied to the database, in version
+// order. It creates the migrations table if it does not exist.
+func (m *Migrator) PendingMigrations(ctx context.Context) ([]*Migration, error) {
+	if err := m.createMigrationsTable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	appliedMigrations, err := m.getAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	return m.pendingMigrations(appliedMigrations), nil
+}
+
 // Migrate applies pending migrations to the database.
 // It creates the migrations table if it does not exist.
 // It retrieves the list of applied migrations from the database.
 // For each migration that has not been applied, it runs the migration.
-// Returns an error if any step fails.
-func (m *Migrator) Migrate() error {
-	if err := m.createMigrationsTable(); err != nil {
+// Returns an error if any step fails. Cancelling ctx stops the migration running, whose transaction is rolled
+// back, and leaves the following ones pending.
+//
+// A baseline replacing migrations the database applied is recorded as applied in their place, see Checkpoint.
+func (m *Migrator) Migrate(ctx context.Context) error {
+	if err := m.createMigrationsTable(ctx); err != nil {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
 
-	appliedMigrations, err := m.getAppliedMigrations()
+	appliedMigrations, err := m.getAppliedMigrations(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get applied migrations: %w", err)
 	}
+	if err := m.checkpoints(ctx, appliedMigrations); err != nil {
+		return err
+	}
 
 	for _, migration := range m.migrations {
 		if !contains(appliedMigrations, migration.Version) {
-			if err := m.runMigration(migration); err != nil {
+			if err := m.runMigration(ctx, migration); err != nil {
 				return fmt.Errorf("failed to run migration %s: %w", migration.Name, err)
 			}
 		}
@@ -180,12 +287,12 @@ func (m *Migrator) Migrate() error {
 // If steps is less than or equal to 0, the function returns immediately without performing any rollback operations.
 // If there are fewer applied migrations than the specified steps, it only rolls back the available migrations.
 // The function returns an error if it encounters any issues during the rollback process.
-func (m *Migrator) Rollback(steps int) error {
+func (m *Migrator) Rollback(ctx context.Context, steps int) error {
 	if steps <= 0 {
 		return nil
 	}
 
-	appliedMigrations, err := m.getAppliedMigrations()
+	appliedMigrations, err := m.getAppliedMigrations(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get applied migrations: %w", err)
 	}
@@ -195,7 +302,7 @@ func (m *Migrator) Rollback(steps int) error {
 		if migration == nil {
 			return fmt.Errorf("migration with version %d not found", appliedMigrations[i])
 		}
-		if err := m.rollbackMigration(migration); err != nil {
+		if err := m.rollbackMigration(ctx, migration); err != nil {
 			return fmt.Errorf("failed to rollback migration %s: %w", migration.Name, err)
 		}
 	}
@@ -209,15 +316,19 @@ const migrationsTableName = "migrations"
 // The table has three columns: "version" of type BIGINT and primary key, "name" of type TEXT and not null,
 // and "applied_at" of type TIMESTAMP WITH TIME ZONE with a default value of the current timestamp.
 // This method returns an error if there was a problem executing the SQL statement to create the table.
-func (m *Migrator) createMigrationsTable() error {
+func (m *Migrator) createMigrationsTable(ctx context.Context) error {
+	appliedAt := "TIMESTAMP WITH TIME ZONE"
+	if m.dialect != schema.Postgres {
+		appliedAt = "TIMESTAMP"
+	}
 	query := fmt.Sprintf(`
         CREATE TABLE IF NOT EXISTS %s (
             version BIGINT PRIMARY KEY,
             name TEXT NOT NULL,
-            applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+            applied_at %s DEFAULT CURRENT_TIMESTAMP
         )
-    `, migrationsTableName)
-	_, err := m.db.Exec(query)
+    `, migrationsTableName, appliedAt)
+	_, err := m.db.ExecContext(ctx, query)
 	return err
 }
 
@@ -231,18 +342,45 @@ func (m *Migrator) createMigrationsTable() error {
 //
 // Returns:
 // - error: An error if any occurred during the migration process.
-func (m *Migrator) runMigration(migration *Migration) error {
-	tx, err := m.db.Begin()
+//
+// The steps of the migration's backfills commit separately, before the migration is recorded.
+func (m *Migrator) runMigration(ctx context.Context, migration *Migration) error {
+	for _, backfill := range migration.Backfills {
+		filled, err := runBackfill(ctx, m.db, backfill, func(rows int64) {
+			m.logger.Debugf("Backfilled %d rows of %s.%s", rows, backfill.Table, backfill.Column)
+		})
+		if err != nil {
+			return err
+		}
+		m.logger.Infof("Backfilled %s.%s: %d rows", backfill.Table, backfill.Column, filled)
+	}
+
+	if len(migration.Backfills) == 0 && needsNoTransaction(migration.UpSQL) {
+		if err := m.execWithoutTransaction(ctx, migration.UpSQL); err != nil {
+			return fmt.Errorf("error applying migration: %w", err)
+		}
+		if _, err := m.db.ExecContext(ctx, m.rebind("INSERT INTO migrations (version, name) VALUES ($1, $2)"),
+			migration.Version, migration.Name); err != nil {
+			return fmt.Errorf("error recording migration: %w", err)
+		}
+		m.logger.Infof("Applied migration: %s", migration.Name)
+		return nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec(migration.UpSQL); err != nil {
-		return fmt.Errorf("error applying migration: %w", err)
+	// The up SQL of a migration with backfills is only their directives.
+	if len(migration.Backfills) == 0 {
+		if _, err := tx.ExecContext(ctx, migration.UpSQL); err != nil {
+			return fmt.Errorf("error applying migration: %w", err)
+		}
 	}
 
-	if _, err := tx.Exec("INSERT INTO migrations (version, name) VALUES ($1, $2)",
+	if _, err := tx.ExecContext(ctx, m.rebind("INSERT INTO migrations (version, name) VALUES ($1, $2)"),
 		migration.Version, migration.Name); err != nil {
 		return fmt.Errorf("error recording migration: %w", err)
 	}
@@ -259,18 +397,29 @@ func (m *Migrator) runMigration(migration *Migration) error {
 // It starts a transaction, rolls it back in case of an error, and commits the rollback if successful.
 // It logs the name of the rolled-back migration.
 // It returns an error if any operation fails.
-func (m *Migrator) rollbackMigration(migration *Migration) error {
-	tx, err := m.db.Begin()
+func (m *Migrator) rollbackMigration(ctx context.Context, migration *Migration) error {
+	if needsNoTransaction(migration.DownSQL) {
+		if err := m.execWithoutTransaction(ctx, migration.DownSQL); err != nil {
+			return fmt.Errorf("error rolling back migration: %w", err)
+		}
+		if _, err := m.db.ExecContext(ctx, m.rebind("DELETE FROM migrations WHERE version = $1"), migration.Version); err != nil {
+			return fmt.Errorf("error removing migration record: %w", err)
+		}
+		m.logger.Infof("Rolled back migration: %s", migration.Name)
+		return nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec(migration.DownSQL); err != nil {
+	if _, err := tx.ExecContext(ctx, migration.DownSQL); err != nil {
 		return fmt.Errorf("error rolling back migration: %w", err)
 	}
 
-	if _, err := tx.Exec("DELETE FROM migrations WHERE version = $1", migration.Version); err != nil {
+	if _, err := tx.ExecContext(ctx, m.rebind("DELETE FROM migrations WHERE version = $1"), migration.Version); err != nil {
 		return fmt.Errorf("error removing migration record: %w", err)
 	}
 
@@ -286,8 +435,8 @@ func (m *Migrator) rollbackMigration(migration *Migration) error {
 // the versions of the applied migrations, ordered in descending order. It returns
 // a slice of int64 representing the versions and an error if there was any issue
 // querying the database.
-func (m *Migrator) getAppliedMigrations() ([]int64, error) {
-	rows, err := m.db.Query("SELECT version FROM migrations ORDER BY version DESC")
+func (m *Migrator) getAppliedMigrations(ctx context.Context) ([]int64, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version FROM migrations ORDER BY version DESC")
 	if err != nil {
 		return nil, fmt.Errorf("error querying migrations: %w", err)
 	}
@@ -309,6 +458,17 @@ func (m *Migrator) getAppliedMigrations() ([]int64, error) {
 	return appliedMigrations, nil
 }
 
+// rebind rewrites the $n placeholders of a query of the migrations table into those of the Migrator's dialect.
+func (m *Migrator) rebind(query string) string {
+	if m.dialect != schema.MySQL {
+		return query
+	}
+	for n := 9; n >= 1; n-- {
+		query = strings.ReplaceAll(query, "$"+strconv.Itoa(n), "?")
+	}
+	return query
+}
+
 // findMigration searches for a migration with the specified version in the list of migrations.
 // It returns a pointer to the found migration, or nil if no migration with that version was found.
 func (m *Migrator) findMigration(version int64) *Migration {
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations_FromMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240102000000_add_posts.sql": {Data: []byte("-- Up\nCREATE TABLE posts (id SERIAL);\n\n-- Down\nDROP TABLE posts;\n")},
+		"migrations/20240101000000_add_users.sql": {Data: []byte("-- Up\nCREATE TABLE users (id SERIAL);\n\n-- Down\nDROP TABLE users;\n")},
+		"migrations/notes.txt":                    {Data: []byte("ignored")},
+	}
+
+	migrator := NewMigratorFS(nil, logrus.New(), fsys)
+	assert.NoError(t, migrator.LoadMigrations())
+
+	if assert.Len(t, migrator.migrations, 2) {
+		assert.Equal(t, int64(20240101000000), migrator.migrations[0].Version)
+		assert.Equal(t, "-- Up\nCREATE TABLE users (id SERIAL);", migrator.migrations[0].UpSQL)
+		assert.Equal(t, "DROP TABLE users;", migrator.migrations[0].DownSQL)
+		assert.Equal(t, int64(20240102000000), migrator.migrations[1].Version)
+	}
+}
+
+func TestLoadMigrations_InvalidFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240101000000_broken.sql": {Data: []byte("CREATE TABLE broken (id SERIAL);")},
+	}
+
+	migrator := NewMigratorFS(nil, logrus.New(), fsys)
+	assert.Error(t, migrator.LoadMigrations())
+	assert.Empty(t, migrator.migrations)
+}
+
+func TestSquash(t *testing.T) {
+	users, err := parseMigrationContent("20240101000000_add_users.sql", "-- Up\n-- Phase: expand\nCREATE TABLE users (id SERIAL)\n-- Down\nDROP TABLE users;")
+	require.NoError(t, err)
+	status, err := parseMigrationContent("20240102000000_add_status.sql", "-- Up\n-- Backfill: users.status TEXT DEFAULT 'active'\n-- Down\nALTER TABLE users DROP COLUMN status;")
+	require.NoError(t, err)
+
+	baseline, err := Squash([]*Migration{users, status})
+	require.NoError(t, err)
+	assert.Equal(t, "20240102000000_baseline.sql", baseline.Name)
+	assert.Equal(t, int64(20240102000000), baseline.Version)
+	assert.Equal(t, []int64{20240101000000, 20240102000000}, baseline.Squashes)
+	assert.Empty(t, baseline.Backfills)
+	assert.Equal(t, "-- Up\n-- Squashes: 20240101000000, 20240102000000\n\n"+
+		"-- From 20240101000000_add_users.sql\nCREATE TABLE users (id SERIAL);\n\n"+
+		"-- From 20240102000000_add_status.sql\nALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';", baseline.UpSQL)
+	assert.Contains(t, baseline.DownSQL, "RAISE EXCEPTION")
+
+	// Squashing a baseline again keeps the versions it replaced.
+	posts, err := parseMigrationContent("20240103000000_add_posts.sql", "-- Up\nCREATE TABLE posts (id SERIAL);\n-- Down\nDROP TABLE posts;")
+	require.NoError(t, err)
+	again, err := Squash([]*Migration{baseline, posts})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240101000000, 20240102000000, 20240103000000}, again.Squashes)
+	assert.Equal(t, 1, strings.Count(again.UpSQL, "-- Squashes:"))
+
+	reparsed, err := parseMigrationContent(again.Name, again.File())
+	require.NoError(t, err)
+	assert.Equal(t, again.UpSQL, reparsed.UpSQL)
+
+	_, err = Squash([]*Migration{users})
+	assert.Error(t, err)
+	_, err = Squash([]*Migration{status, users})
+	assert.Error(t, err)
+}
+
+func TestNewMigratorDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20240101000000_add_users.sql"), []byte("-- Up\nCREATE TABLE users (id SERIAL);\n-- Down\nDROP TABLE users;\n"), 0644))
+
+	migrator := NewMigratorDir(nil, logrus.New(), dir)
+	require.NoError(t, migrator.LoadMigrations())
+	assert.Len(t, migrator.Migrations(), 1)
+}
@@ -0,0 +1,203 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Phase is the step of an expand/contract (blue/green) deploy a migration belongs to.
+//
+// Expand migrations only add to the schema, so both the old and the new version of the application keep
+// working against it; they are applied before the new version is deployed. Contract migrations remove or
+// change what the old version still relies on; they are applied once the old version is gone.
+type Phase string
+
+const (
+	// PhaseExpand marks a migration that is safe to apply before the new application version is deployed.
+	PhaseExpand Phase = "expand"
+	// PhaseContract marks a migration that must only be applied after the old application version is retired.
+	PhaseContract Phase = "contract"
+)
+
+// ParsePhase converts a phase name as given on the command line into a Phase.
+func ParsePhase(name string) (Phase, error) {
+	switch phase := Phase(strings.ToLower(strings.TrimSpace(name))); phase {
+	case PhaseExpand, PhaseContract:
+		return phase, nil
+	default:
+		return "", fmt.Errorf("invalid migration phase %q (expected %q or %q)", name, PhaseExpand, PhaseContract)
+	}
+}
+
+// phaseDirective declares the phase of a migration explicitly, e.g. "-- Phase: contract".
+var phaseDirective = regexp.MustCompile(`(?im)^\s*--\s*phase:\s*(\w+)\s*$`)
+
+// renameStatement matches renaming a table or column.
+var renameStatement = regexp.MustCompile(`(?i)\bRENAME\b`)
+
+// contractStatements match statements that break the previous application version.
+var contractStatements = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`(?i)\bDROP\s+(TABLE|VIEW)\b`), "drops a table or view"},
+	{regexp.MustCompile(`(?i)\bDROP\s+COLUMN\b`), "drops a column"},
+	{renameStatement, "renames a table or column"},
+	{regexp.MustCompile(`(?i)\bALTER\s+COLUMN\s+\S+\s+(SET\s+DATA\s+)?TYPE\b`), "changes a column type"},
+	{regexp.MustCompile(`(?i)\bSET\s+NOT\s+NULL\b`), "makes a column NOT NULL"},
+	{regexp.MustCompile(`(?i)\bDROP\s+CONSTRAINT\b`), "drops a constraint"},
+}
+
+// addNotNullColumn matches a column added as NOT NULL without a default, which makes inserts by the previous
+// application version fail.
+var addNotNullColumn = regexp.MustCompile(`(?i)\bADD\s+(COLUMN\s+)?[^,;]*\bNOT\s+NULL\b[^,;]*`)
+
+// ClassifySQL returns the phase the given up SQL belongs to, judging by its statements: SQL containing any
+// statement that breaks the previous application version is a contract migration, anything else expands.
+func ClassifySQL(upSQL string) Phase {
+	if len(contractReasons(upSQL)) > 0 {
+		return PhaseContract
+	}
+	return PhaseExpand
+}
+
+// sqlComment matches a "--" line comment.
+var sqlComment = regexp.MustCompile(`--[^\n]*`)
+
+// stripComments removes line comments so that prose such as "-- drop the table later" is not mistaken for a
+// statement.
+func stripComments(sql string) string {
+	return sqlComment.ReplaceAllString(sql, "")
+}
+
+// contractReasons describes every statement in the SQL that breaks the previous application version.
+func contractReasons(upSQL string) []string {
+	upSQL = stripComments(upSQL)
+	var reasons []string
+	for _, statement := range contractStatements {
+		if statement.pattern.MatchString(upSQL) {
+			reasons = append(reasons, statement.reason)
+		}
+	}
+	return reasons
+}
+
+// migrationPhase returns the phase declared by the migration's "-- Phase:" directive, or the phase inferred
+// from its up SQL when it has none.
+func migrationPhase(upSQL string) (Phase, error) {
+	if match := phaseDirective.FindStringSubmatch(upSQL); match != nil {
+		return ParsePhase(match[1])
+	}
+	return ClassifySQL(upSQL), nil
+}
+
+// LintIssue is a violation of the expand/contract rules, or a dangerous operation, found in a migration.
+type LintIssue struct {
+	Migration string
+	Rule      string
+	Severity  Severity
+	Message   string
+}
+
+// String formats the issue for display.
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Migration, i.Message)
+}
+
+// LintPhases checks that the loaded migrations follow the expand/contract pattern:
+//   - an expand migration contains no statement that breaks the previous application version,
+//   - an expand migration adds no NOT NULL column without a default,
+//   - renames are not used at all, since no single phase keeps both names available; add the new column or
+//     table, backfill it, and drop the old one in a later contract migration instead.
+//
+// A migration breaking the rules on purpose, such as a rename deployed with downtime, allows it with an
+// "-- Allow: expand-contract" directive.
+func (m *Migrator) LintPhases() []LintIssue {
+	var issues []LintIssue
+	for _, migration := range m.migrations {
+		issues = append(issues, lintMigration(migration)...)
+	}
+	return issues
+}
+
+// lintMigration returns the expand/contract violations of a single migration, none if it allows them with an
+// "-- Allow: expand-contract" directive.
+func lintMigration(migration *Migration) []LintIssue {
+	if allowedRules(migration.UpSQL)[RuleExpandContract] {
+		return nil
+	}
+	var issues []LintIssue
+	report := func(format string, args ...interface{}) {
+		issues = append(issues, LintIssue{Migration: migration.Name, Rule: RuleExpandContract, Severity: SeverityError,
+			Message: fmt.Sprintf(format, args...)})
+	}
+
+	if migration.Phase == PhaseExpand {
+		for _, reason := range contractReasons(migration.UpSQL) {
+			report("expand migration %s; move it to a contract migration", reason)
+		}
+		for _, clause := range addNotNullColumn.FindAllString(stripComments(migration.UpSQL), -1) {
+			if !strings.Contains(strings.ToUpper(clause), "DEFAULT") {
+				report("expand migration adds a NOT NULL column without a default: %s", strings.TrimSpace(clause))
+			}
+		}
+	}
+	if renameStatement.MatchString(stripComments(migration.UpSQL)) {
+		report("renames break one application version in either phase; add, backfill, and later drop instead")
+	}
+	return issues
+}
+
+// MigratePhase applies the pending migrations of the given phase in version order and leaves the others
+// pending. Contract migrations are refused while expand migrations are still pending, because the contract
+// phase assumes the expanded schema is fully in place. Migrations violating the expand/contract rules, see
+// LintPhases, are refused before anything is applied.
+func (m *Migrator) MigratePhase(ctx context.Context, phase Phase) error {
+	if issues := m.LintPhases(); len(issues) > 0 {
+		return fmt.Errorf("migrations violate the expand/contract rules: %v", issues)
+	}
+
+	if err := m.createMigrationsTable(ctx); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	appliedMigrations, err := m.getAppliedMigrations(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	if err := m.checkpoints(ctx, appliedMigrations); err != nil {
+		return err
+	}
+
+	pending := m.pendingMigrations(appliedMigrations)
+	if phase == PhaseContract {
+		for _, migration := range pending {
+			if migration.Phase == PhaseExpand {
+				return fmt.Errorf("expand migration %s is still pending; run the expand phase first", migration.Name)
+			}
+		}
+	}
+
+	for _, migration := range pending {
+		if migration.Phase != phase {
+			continue
+		}
+		if err := m.runMigration(ctx, migration); err != nil {
+			return fmt.Errorf("failed to run migration %s: %w", migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// pendingMigrations returns the loaded migrations that have not been applied, in version order.
+func (m *Migrator) pendingMigrations(appliedMigrations []int64) []*Migration {
+	var pending []*Migration
+	for _, migration := range m.migrations {
+		if !contains(appliedMigrations, migration.Version) {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
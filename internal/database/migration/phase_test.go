@@ -0,0 +1,74 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifySQL(t *testing.T) {
+	assert.Equal(t, PhaseExpand, ClassifySQL("CREATE TABLE posts (id SERIAL);"))
+	assert.Equal(t, PhaseExpand, ClassifySQL("ALTER TABLE posts ADD COLUMN slug TEXT;\n-- drop the old column later"))
+	assert.Equal(t, PhaseContract, ClassifySQL("ALTER TABLE posts DROP COLUMN legacy;"))
+	assert.Equal(t, PhaseContract, ClassifySQL("ALTER TABLE posts ALTER COLUMN views TYPE BIGINT;"))
+	assert.Equal(t, PhaseContract, ClassifySQL("ALTER TABLE posts ALTER COLUMN slug SET NOT NULL;"))
+}
+
+func TestParsePhase(t *testing.T) {
+	phase, err := ParsePhase(" Contract ")
+	assert.NoError(t, err)
+	assert.Equal(t, PhaseContract, phase)
+
+	_, err = ParsePhase("deploy")
+	assert.Error(t, err)
+}
+
+func TestLoadMigrations_Phases(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_add_slug.sql":        {Data: []byte("-- Up\nALTER TABLE posts ADD COLUMN slug TEXT;\n-- Down\nALTER TABLE posts DROP COLUMN slug;\n")},
+		"migrations/2_drop_legacy.sql":     {Data: []byte("-- Up\nALTER TABLE posts DROP COLUMN legacy;\n-- Down\nSELECT 1;\n")},
+		"migrations/3_explicit.sql":        {Data: []byte("-- Up\n-- Phase: contract\nUPDATE posts SET slug = id::text;\n-- Down\nSELECT 1;\n")},
+		"migrations/4_invalid_phase.sql":   {Data: []byte("-- Up\n-- Phase: later\nSELECT 1;\n-- Down\nSELECT 1;\n")},
+		"migrations/5_add_index_later.sql": {Data: []byte("-- Up\nCREATE INDEX posts_slug ON posts (slug);\n-- Down\nDROP INDEX posts_slug;\n")},
+	}
+
+	migrator := NewMigratorFS(nil, logrus.New(), fsys)
+	assert.Error(t, migrator.LoadMigrations(), "an unknown phase directive must be rejected")
+
+	phases := make(map[string]Phase)
+	for _, m := range migrator.Migrations() {
+		phases[m.Name] = m.Phase
+	}
+	assert.Equal(t, map[string]Phase{
+		"1_add_slug.sql":        PhaseExpand,
+		"2_drop_legacy.sql":     PhaseContract,
+		"3_explicit.sql":        PhaseContract,
+		"5_add_index_later.sql": PhaseExpand,
+	}, phases)
+}
+
+func TestLintPhases(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_ok.sql":               {Data: []byte("-- Up\nALTER TABLE posts ADD COLUMN slug TEXT NOT NULL DEFAULT '';\n-- Down\nSELECT 1;\n")},
+		"migrations/2_not_null.sql":         {Data: []byte("-- Up\nALTER TABLE posts ADD COLUMN author_id INTEGER NOT NULL;\n-- Down\nSELECT 1;\n")},
+		"migrations/3_forced_expand.sql":    {Data: []byte("-- Up\n-- Phase: expand\nDROP TABLE drafts;\n-- Down\nSELECT 1;\n")},
+		"migrations/4_rename.sql":           {Data: []byte("-- Up\nALTER TABLE posts RENAME COLUMN body TO content;\n-- Down\nSELECT 1;\n")},
+		"migrations/5_contract_is_fine.sql": {Data: []byte("-- Up\nALTER TABLE posts DROP COLUMN legacy;\n-- Down\nSELECT 1;\n")},
+		"migrations/6_allowed_rename.sql":   {Data: []byte("-- Up\n-- Phase: contract\n-- Allow: expand-contract\nALTER TABLE posts RENAME TO articles;\n-- Down\nSELECT 1;\n")},
+	}
+
+	migrator := NewMigratorFS(nil, logrus.New(), fsys)
+	assert.NoError(t, migrator.LoadMigrations())
+
+	issues := make(map[string]int)
+	for _, issue := range migrator.LintPhases() {
+		issues[issue.Migration]++
+	}
+	assert.Equal(t, map[string]int{
+		"2_not_null.sql":      1,
+		"3_forced_expand.sql": 1,
+		"4_rename.sql":        1,
+	}, issues)
+}
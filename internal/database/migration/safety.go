@@ -0,0 +1,178 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Severity is how dangerous a lint issue is.
+type Severity string
+
+const (
+	// SeverityError marks an operation that loses data or fails on a table with rows.
+	SeverityError Severity = "error"
+	// SeverityWarning marks an operation that locks a table for as long as it takes to rewrite or scan it.
+	SeverityWarning Severity = "warning"
+	// SeverityInfo marks an operation that needs a follow-up.
+	SeverityInfo Severity = "info"
+)
+
+// The rules of LintSafety, which a migration allows with an "-- Allow:" directive, e.g.
+// "-- Allow: drop-column".
+const (
+	RuleExpandContract        = "expand-contract"
+	RuleDropTable             = "drop-table"
+	RuleDropColumn            = "drop-column"
+	RuleTruncate              = "truncate"
+	RuleNotNullWithoutDefault = "not-null-without-default"
+	RuleSetNotNull            = "set-not-null"
+	RuleIndexNotConcurrent    = "index-not-concurrent"
+	RuleValidatingConstraint  = "validating-constraint"
+	RuleRewriteTable          = "rewrite-table"
+	RuleNotValidConstraint    = "not-valid-constraint"
+)
+
+// allowDirective lists the rules a migration breaks on purpose.
+var allowDirective = regexp.MustCompile(`(?im)^\s*--\s*allow:\s*(.*?)\s*$`)
+
+var (
+	dropColumnAction = regexp.MustCompile(`(?i)^DROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?("[^"]+"|[\w$]+)`)
+	notNullClause    = regexp.MustCompile(`(?i)\bNOT\s+NULL\b`)
+	defaultClause    = regexp.MustCompile(`(?i)\bDEFAULT\b`)
+	primaryOrUnique  = regexp.MustCompile(`(?i)^(PRIMARY KEY|UNIQUE)$`)
+)
+
+// LintSafety checks the loaded migrations for operations that are dangerous to run against a database in
+// use, see lintSafety. Rules a migration allows with an "-- Allow:" directive are not checked for it.
+func (m *Migrator) LintSafety() []LintIssue {
+	var issues []LintIssue
+	for _, migration := range m.migrations {
+		issues = append(issues, lintSafety(migration)...)
+	}
+	return issues
+}
+
+// lintSafety returns the dangerous operations of a migration:
+//   - errors: dropping a table or a column, or truncating a table, which loses their data, and adding a NOT
+//     NULL column without a default, which fails on a table with rows,
+//   - warnings: creating an index without CONCURRENTLY, which blocks writes while the index is built, and
+//     setting a column NOT NULL, adding a constraint other than NOT VALID or rewriting a table, which hold an
+//     ACCESS EXCLUSIVE lock while they scan or rewrite it,
+//   - infos: adding a constraint NOT VALID, which must be validated in a later migration.
+//
+// Operations on tables the migration creates are not dangerous, as the tables are empty.
+func lintSafety(migration *Migration) []LintIssue {
+	allowed := allowedRules(migration.UpSQL)
+	var issues []LintIssue
+	report := func(rule string, severity Severity, format string, args ...interface{}) {
+		if !allowed[rule] {
+			issues = append(issues, LintIssue{Migration: migration.Name, Rule: rule, Severity: severity,
+				Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	created := map[string]bool{}
+	for _, statement := range splitStatements(stripComments(migration.UpSQL)) {
+		statement = strings.Join(strings.Fields(statement), " ")
+		if m := createTableStatement.FindStringSubmatch(statement); m != nil {
+			created[m[1]] = true
+			continue
+		}
+		if m := dropTableStatement.FindStringSubmatch(statement); m != nil {
+			report(RuleDropTable, SeverityError, "drops table %s and its rows", m[1])
+			continue
+		}
+		if m := truncateStatement.FindStringSubmatch(statement); m != nil {
+			report(RuleTruncate, SeverityError, "deletes every row of %s", m[1])
+			continue
+		}
+		if m := createIndexStatement.FindStringSubmatch(statement); m != nil {
+			if m[1] == "" && !created[m[2]] {
+				report(RuleIndexNotConcurrent, SeverityWarning,
+					"creates an index on %s without CONCURRENTLY, blocking writes to it until the index is built", m[2])
+			}
+			continue
+		}
+		if m := rewriteStatement.FindStringSubmatch(statement); m != nil {
+			report(RuleRewriteTable, SeverityWarning, "rewrites %s under an ACCESS EXCLUSIVE lock", m[2])
+			continue
+		}
+		if m := alterTableStatement.FindStringSubmatch(statement); m != nil {
+			lintAlterTable(m[1], m[2], created[m[1]], report)
+		}
+	}
+	return issues
+}
+
+// allowedRules returns the rules the "-- Allow:" directives of the up SQL of a migration allow.
+func allowedRules(upSQL string) map[string]bool {
+	allowed := map[string]bool{}
+	for _, match := range allowDirective.FindAllStringSubmatch(upSQL, -1) {
+		for _, rule := range strings.Split(match[1], ",") {
+			allowed[strings.ToLower(strings.TrimSpace(rule))] = true
+		}
+	}
+	return allowed
+}
+
+// lintAlterTable reports the dangerous actions of an ALTER TABLE statement of a table, created by the same
+// migration if created is set.
+func lintAlterTable(table, actions string, created bool, report func(rule string, severity Severity, format string, args ...interface{})) {
+	for _, action := range splitTopLevel(actions, ',') {
+		action = strings.TrimSpace(action)
+		if m := dropColumnAction.FindStringSubmatch(action); m != nil && !strings.EqualFold(m[1], "CONSTRAINT") {
+			report(RuleDropColumn, SeverityError, "drops column %s of %s and its data", m[1], table)
+			continue
+		}
+		if created {
+			continue
+		}
+		operation, _, rewrite, _ := alterAction(action)
+		switch {
+		case addColumnAction.MatchString(action) && notNullClause.MatchString(action) && !defaultClause.MatchString(action) &&
+			!addConstraintAction.MatchString(action):
+			report(RuleNotNullWithoutDefault, SeverityError,
+				"adds a NOT NULL column without a default to %s, which fails if it has rows; add a DEFAULT or use a \"-- Backfill:\" directive", table)
+		case operation == "set not null":
+			report(RuleSetNotNull, SeverityWarning,
+				"sets a column of %s NOT NULL, scanning it under an ACCESS EXCLUSIVE lock; validate a CHECK (column IS NOT NULL) NOT VALID constraint first, or use a \"-- Backfill:\" directive", table)
+		case rewrite:
+			report(RuleRewriteTable, SeverityWarning, "%s rewrites %s under an ACCESS EXCLUSIVE lock", operation, table)
+		case strings.HasSuffix(operation, " not valid"):
+			report(RuleNotValidConstraint, SeverityInfo,
+				"adds a constraint to %s NOT VALID; validate it with VALIDATE CONSTRAINT in a later migration", table)
+		case strings.HasPrefix(operation, "add ") && addConstraintAction.MatchString(action) && !strings.HasSuffix(operation, " using index"):
+			kind := strings.ToUpper(strings.TrimPrefix(operation, "add "))
+			if primaryOrUnique.MatchString(kind) {
+				report(RuleValidatingConstraint, SeverityWarning,
+					"adds a %s constraint to %s, building its index while blocking writes; create a unique index CONCURRENTLY and add the constraint USING INDEX", kind, table)
+			} else {
+				report(RuleValidatingConstraint, SeverityWarning,
+					"adds a %s constraint to %s, checking every row while blocking writes; add it NOT VALID and validate it in a later migration", kind, table)
+			}
+		}
+	}
+}
+
+// concurrently matches the statements PostgreSQL refuses to run in a transaction block.
+var concurrently = regexp.MustCompile(`(?i)\b(?:INDEX|REINDEX\s+(?:\([^)]*\)\s+)?\w+)\s+CONCURRENTLY\b`)
+
+// needsNoTransaction reports whether the SQL holds a statement that cannot run in a transaction, such as
+// CREATE INDEX CONCURRENTLY.
+func needsNoTransaction(sql string) bool {
+	return concurrently.MatchString(stripComments(sql))
+}
+
+// execWithoutTransaction runs the statements of the SQL one by one outside a transaction, as needed by
+// statements such as CREATE INDEX CONCURRENTLY. A failing statement leaves the statements before it applied, so
+// such migrations should be written to be rerun, e.g. with IF NOT EXISTS.
+func (m *Migrator) execWithoutTransaction(ctx context.Context, sql string) error {
+	for _, statement := range splitStatements(stripComments(sql)) {
+		if _, err := m.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
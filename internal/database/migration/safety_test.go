@@ -0,0 +1,61 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintSafety(t *testing.T) {
+	rules := func(upSQL string) map[string]Severity {
+		found := make(map[string]Severity)
+		for _, issue := range lintSafety(&Migration{Name: "1_test.sql", UpSQL: upSQL}) {
+			found[issue.Rule] = issue.Severity
+		}
+		return found
+	}
+
+	assert.Equal(t, map[string]Severity{RuleDropColumn: SeverityError, RuleDropTable: SeverityError, RuleTruncate: SeverityError},
+		rules("ALTER TABLE posts DROP COLUMN legacy, DROP CONSTRAINT posts_legacy_check;\nDROP TABLE drafts;\nTRUNCATE sessions;"))
+	assert.Equal(t, map[string]Severity{RuleNotNullWithoutDefault: SeverityError},
+		rules("ALTER TABLE posts ADD COLUMN slug TEXT NOT NULL, ADD COLUMN views INT NOT NULL DEFAULT 0;"))
+	assert.Equal(t, map[string]Severity{RuleIndexNotConcurrent: SeverityWarning},
+		rules("CREATE INDEX posts_slug ON posts (slug);\nCREATE INDEX CONCURRENTLY posts_views ON posts (views);"))
+	assert.Equal(t, map[string]Severity{RuleSetNotNull: SeverityWarning},
+		rules("ALTER TABLE posts ALTER COLUMN slug SET NOT NULL;"))
+	assert.Equal(t, map[string]Severity{RuleRewriteTable: SeverityWarning},
+		rules("ALTER TABLE posts ALTER COLUMN views TYPE BIGINT;"))
+	assert.Equal(t, map[string]Severity{RuleValidatingConstraint: SeverityWarning},
+		rules("ALTER TABLE posts ADD CONSTRAINT posts_slug_key UNIQUE (slug);"))
+	assert.Equal(t, map[string]Severity{RuleNotValidConstraint: SeverityInfo},
+		rules("ALTER TABLE posts ADD CONSTRAINT posts_author_fk FOREIGN KEY (author_id) REFERENCES users (id) NOT VALID;"))
+	assert.Empty(t, rules("-- drop table posts later\nALTER TABLE posts ADD COLUMN slug TEXT;"))
+}
+
+func TestLintSafety_CreatedTables(t *testing.T) {
+	issues := lintSafety(&Migration{Name: "1_create_posts.sql", UpSQL: `CREATE TABLE posts (id SERIAL PRIMARY KEY);
+ALTER TABLE posts ADD COLUMN slug TEXT NOT NULL;
+CREATE UNIQUE INDEX posts_slug ON posts (slug);
+ALTER TABLE posts DROP COLUMN slug;`})
+	if assert.Len(t, issues, 1, "only drops are reported on a table created by the migration") {
+		assert.Equal(t, RuleDropColumn, issues[0].Rule)
+		assert.Equal(t, "1_create_posts.sql", issues[0].Migration)
+	}
+}
+
+func TestLintSafety_Allow(t *testing.T) {
+	issues := lintSafety(&Migration{Name: "1_cleanup.sql", UpSQL: `-- Allow: drop-column, Truncate
+ALTER TABLE posts DROP COLUMN legacy;
+TRUNCATE sessions;
+DROP TABLE drafts;`})
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, RuleDropTable, issues[0].Rule)
+	}
+}
+
+func TestNeedsNoTransaction(t *testing.T) {
+	assert.True(t, needsNoTransaction("CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS posts_slug ON posts (slug);"))
+	assert.True(t, needsNoTransaction("DROP INDEX CONCURRENTLY posts_slug;"))
+	assert.True(t, needsNoTransaction("REINDEX (VERBOSE) TABLE CONCURRENTLY posts;"))
+	assert.False(t, needsNoTransaction("CREATE INDEX posts_slug ON posts (slug);\n-- use CREATE INDEX CONCURRENTLY on big tables"))
+}
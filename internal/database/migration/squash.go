@@ -0,0 +1,208 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// squashDirective declares the versions of the migrations a baseline replaces, e.g.
+// "-- Squashes: 20240101000000, 20240102000000".
+var squashDirective = regexp.MustCompile(`(?im)^\s*--\s*squashes:\s*(.*?)\s*$`)
+
+// upHeader matches the "-- Up" line opening the up SQL of a migration file.
+var upHeader = regexp.MustCompile(`(?im)^\s*--\s*up\s*$\n?`)
+
+// parseSquashes returns the versions declared by the "-- Squashes:" directive of the up SQL, if any.
+func parseSquashes(upSQL string) ([]int64, error) {
+	matches := squashDirective.FindAllStringSubmatch(upSQL, -1)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("a migration can only have one \"-- Squashes:\" directive")
+	}
+	var versions []int64
+	for _, field := range strings.Split(matches[0][1], ",") {
+		version, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid squashed version %q", strings.TrimSpace(field))
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// Squash returns the baseline migration replacing the given migrations, which must be in version order. The
+// baseline takes the version of the last migration, so it sorts before the migrations that follow, and its up
+// SQL runs the up SQL of every migration in turn, with backfills written as the plain ALTER TABLE statements
+// they amount to on a new database. A "-- Squashes:" directive lists the versions it replaces, including
+// those of the baselines it replaces in turn. A baseline cannot be rolled back: its down SQL raises an error.
+func Squash(migrations []*Migration) (*Migration, error) {
+	if len(migrations) < 2 {
+		return nil, fmt.Errorf("at least two migrations are needed to squash, got %d", len(migrations))
+	}
+	var versions []string
+	var sections []string
+	for i, migration := range migrations {
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			return nil, fmt.Errorf("migration %s is out of version order", migration.Name)
+		}
+		for _, version := range migration.Squashes {
+			if version != migration.Version {
+				versions = append(versions, strconv.FormatInt(version, 10))
+			}
+		}
+		versions = append(versions, strconv.FormatInt(migration.Version, 10))
+
+		body := migration.UpSQL
+		if len(migration.Backfills) > 0 {
+			var statements []string
+			for _, b := range migration.Backfills {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s NOT NULL DEFAULT %s;",
+					b.Table, b.Column, b.Type, b.Default))
+			}
+			body = strings.Join(statements, "\n")
+		}
+		body = upHeader.ReplaceAllString(body, "")
+		body = phaseDirective.ReplaceAllString(body, "")
+		body = squashDirective.ReplaceAllString(body, "")
+		body = strings.TrimSpace(body)
+		// Terminate the last statement, which the next section would otherwise continue.
+		if statements := strings.TrimSpace(stripComments(body)); statements != "" && !strings.HasSuffix(statements, ";") {
+			if lines := strings.Split(body, "\n"); strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "--") {
+				body += "\n;"
+			} else {
+				body += ";"
+			}
+		}
+		sections = append(sections, fmt.Sprintf("-- From %s\n%s", migration.Name, body))
+	}
+
+	last := migrations[len(migrations)-1]
+	name := fmt.Sprintf("%d_baseline.sql", last.Version)
+	file := fmt.Sprintf("-- Up\n-- Squashes: %s\n\n%s\n\n-- Down\nDO $$ BEGIN RAISE EXCEPTION 'migration %s is a baseline and cannot be rolled back'; END $$;\n",
+		strings.Join(versions, ", "), strings.Join(sections, "\n\n"), name)
+	return parseMigrationContent(name, file)
+}
+
+// File returns the content of the migration file of the migration.
+func (m *Migration) File() string {
+	upSQL := m.UpSQL
+	if !upHeader.MatchString(upSQL) {
+		upSQL = "-- Up\n" + upSQL
+	}
+	return fmt.Sprintf("%s\n\n-- Down\n%s\n", upSQL, m.DownSQL)
+}
+
+// Squashable returns the migrations to squash into a baseline: the applied migrations up to version to, or all
+// of them when to is 0, in version order. It fails if any migration up to the last of them is pending, since a
+// baseline must only replace migrations every database has applied in order.
+func (m *Migrator) Squashable(ctx context.Context, to int64) ([]*Migration, error) {
+	pending, err := m.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	isPending := make(map[int64]bool, len(pending))
+	for _, migration := range pending {
+		isPending[migration.Version] = true
+	}
+
+	var applied []*Migration
+	var firstPending *Migration
+	found := to == 0
+	for _, migration := range m.migrations {
+		if to > 0 && migration.Version > to {
+			break
+		}
+		found = found || migration.Version == to
+		if isPending[migration.Version] {
+			if firstPending == nil {
+				firstPending = migration
+			}
+			continue
+		}
+		if firstPending != nil {
+			return nil, fmt.Errorf("migration %s is pending but %s after it was applied; apply it before squashing",
+				firstPending.Name, migration.Name)
+		}
+		if strings.HasSuffix(migration.Name, ".go") {
+			return nil, fmt.Errorf("migration %s is written in Go and cannot be squashed; squash up to the migration before it", migration.Name)
+		}
+		applied = append(applied, migration)
+	}
+	if !found {
+		return nil, fmt.Errorf("no migration has version %d", to)
+	}
+	if to > 0 && firstPending != nil {
+		return nil, fmt.Errorf("migration %s is pending; apply it before squashing", firstPending.Name)
+	}
+	if len(applied) < 2 {
+		return nil, fmt.Errorf("nothing to squash: %d applied migration(s)", len(applied))
+	}
+	return applied, nil
+}
+
+// Checkpoint records the baselines among the loaded migrations as applied in place of the migrations they
+// replace, wherever the database applied them: their records are replaced by the record of the baseline.
+// Migrate records them too, so databases migrated before a squash follow once they are migrated again.
+func (m *Migrator) Checkpoint(ctx context.Context) error {
+	if err := m.createMigrationsTable(ctx); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	appliedMigrations, err := m.getAppliedMigrations(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	return m.checkpoints(ctx, appliedMigrations)
+}
+
+// checkpoints records the baselines whose migrations the database applied, and fails for a baseline only some
+// of whose migrations were applied, which it cannot be applied on top of.
+func (m *Migrator) checkpoints(ctx context.Context, appliedMigrations []int64) error {
+	for _, baseline := range m.migrations {
+		var replaced []int64
+		for _, version := range baseline.Squashes {
+			if version != baseline.Version && contains(appliedMigrations, version) {
+				replaced = append(replaced, version)
+			}
+		}
+		if !contains(appliedMigrations, baseline.Version) {
+			if len(replaced) > 0 {
+				return fmt.Errorf("the database applied %d of the %d migrations squashed into %s; apply the others with a release from before the squash first",
+					len(replaced), len(baseline.Squashes), baseline.Name)
+			}
+			continue
+		}
+		if len(replaced) == 0 {
+			continue
+		}
+		if err := m.recordCheckpoint(ctx, baseline, replaced); err != nil {
+			return fmt.Errorf("failed to record baseline %s: %w", baseline.Name, err)
+		}
+		m.logger.Infof("Recorded baseline %s in place of %d migration(s)", baseline.Name, len(replaced))
+	}
+	return nil
+}
+
+// recordCheckpoint replaces the records of the given migrations with the record of the baseline, whose version
+// is that of the last migration it replaces.
+func (m *Migrator) recordCheckpoint(ctx context.Context, baseline *Migration, replaced []int64) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, version := range replaced {
+		if _, err := tx.ExecContext(ctx, m.rebind("DELETE FROM migrations WHERE version = $1"), version); err != nil {
+			return fmt.Errorf("error removing migration record: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, m.rebind("UPDATE migrations SET name = $1 WHERE version = $2"), baseline.Name, baseline.Version); err != nil {
+		return fmt.Errorf("error recording baseline: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultWaitInterval is how often Wait checks the migrations table.
+const DefaultWaitInterval = 2 * time.Second
+
+// Wait blocks until the database has applied every loaded migration, checking the migrations table every
+// interval, so that an application only starts once another process, such as a deploy job, migrated the
+// database it needs. It only reads: failures to query the table, as when the database does not accept
+// connections yet or was never migrated, are retried. It fails once ctx is done, with the migrations still
+// pending or the last failure.
+func (m *Migrator) Wait(ctx context.Context, interval time.Duration) error {
+	var pending []*Migration
+	var lastErr error
+	for {
+		applied, err := m.getAppliedMigrations(ctx)
+		switch {
+		case err == nil:
+			pending, lastErr = m.pendingMigrations(applied), nil
+			if len(pending) == 0 {
+				return nil
+			}
+			m.logger.Infof("Waiting for %d pending migration(s), starting with %s", len(pending), pending[0].Name)
+		case ctx.Err() == nil:
+			lastErr = err
+			m.logger.Infof("Waiting for the migrations table: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("migrations not applied in time: %w", lastErr)
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("migrations not applied in time: %d pending, starting with %s", len(pending), pending[0].Name)
+			}
+			return fmt.Errorf("migrations not applied in time: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
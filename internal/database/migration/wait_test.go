@@ -0,0 +1,104 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionsTable is the migrations table of the fake driver, which fails queries until it exists.
+var versionsTable struct {
+	sync.Mutex
+	exists   bool
+	versions []int64
+}
+
+type versionsDriver struct{}
+
+func (versionsDriver) Open(string) (driver.Conn, error) { return versionsConn{}, nil }
+
+type versionsConn struct{}
+
+func (versionsConn) Prepare(string) (driver.Stmt, error) { return versionsStmt{}, nil }
+func (versionsConn) Close() error                        { return nil }
+func (versionsConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type versionsStmt struct{}
+
+func (versionsStmt) Close() error                               { return nil }
+func (versionsStmt) NumInput() int                              { return -1 }
+func (versionsStmt) Exec([]driver.Value) (driver.Result, error) { return nil, errors.New("read only") }
+func (versionsStmt) Query([]driver.Value) (driver.Rows, error) {
+	versionsTable.Lock()
+	defer versionsTable.Unlock()
+	if !versionsTable.exists {
+		return nil, errors.New(`relation "migrations" does not exist`)
+	}
+	return &versionsRows{versions: append([]int64(nil), versionsTable.versions...)}, nil
+}
+
+type versionsRows struct{ versions []int64 }
+
+func (*versionsRows) Columns() []string { return []string{"version"} }
+func (*versionsRows) Close() error      { return nil }
+func (r *versionsRows) Next(dest []driver.Value) error {
+	if len(r.versions) == 0 {
+		return io.EOF
+	}
+	dest[0], r.versions = r.versions[0], r.versions[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("migration_versions", versionsDriver{})
+}
+
+func TestWait(t *testing.T) {
+	versionsTable.Lock()
+	versionsTable.exists, versionsTable.versions = false, nil
+	versionsTable.Unlock()
+
+	db, err := sql.Open("migration_versions", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	fsys := fstest.MapFS{
+		"migrations/1_create_posts.sql": {Data: []byte("-- Up\nCREATE TABLE posts (id SERIAL);\n-- Down\nDROP TABLE posts;\n")},
+		"migrations/2_add_slug.sql":     {Data: []byte("-- Up\nALTER TABLE posts ADD COLUMN slug TEXT;\n-- Down\nSELECT 1;\n")},
+	}
+	migrator := NewMigratorFS(db, logrus.New(), fsys)
+	require.NoError(t, migrator.LoadMigrations())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.EqualError(t, migrator.Wait(ctx, time.Millisecond),
+		`migrations not applied in time: error querying migrations: relation "migrations" does not exist`)
+
+	versionsTable.Lock()
+	versionsTable.exists, versionsTable.versions = true, []int64{1}
+	versionsTable.Unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.EqualError(t, migrator.Wait(ctx, time.Millisecond),
+		"migrations not applied in time: 1 pending, starting with 2_add_slug.sql")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		versionsTable.Lock()
+		versionsTable.versions = []int64{2, 1}
+		versionsTable.Unlock()
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, migrator.Wait(ctx, time.Millisecond))
+}
@@ -0,0 +1,189 @@
+package multidb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// Target is a named database that a set of steps is applied to.
+type Target struct {
+	Name   string
+	Config config.DatabaseConfig
+}
+
+// Step is a named operation, such as running migrations or seeds, that is applied to every target.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context, conn *orm.Connection) error
+}
+
+// Status is the outcome of a single step on a single target.
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// StepResult records the outcome of one step on one target.
+type StepResult struct {
+	Step     string
+	Status   Status
+	Err      error
+	Duration time.Duration
+}
+
+// TargetResult aggregates the outcome of all steps on a single target. Err is set when the target could not
+// be connected to, in which case every step is reported as skipped.
+type TargetResult struct {
+	Target   string
+	Steps    []StepResult
+	Err      error
+	Duration time.Duration
+}
+
+// Failed reports whether the target could not be connected to or any of its steps failed.
+func (r TargetResult) Failed() bool {
+	if r.Err != nil {
+		return true
+	}
+	for _, step := range r.Steps {
+		if step.Status == StatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// connect opens a connection to a target. It is a variable so tests can substitute a fake.
+var connect = orm.NewConnection
+
+// Run applies the steps to every target concurrently, with at most parallelism targets in flight at once.
+// Steps run in order on each target; once a step fails the remaining steps for that target are skipped, while
+// other targets carry on. Results are returned in the same order as targets. Once ctx is cancelled, running
+// steps are interrupted and the targets not started yet fail without connecting.
+func Run(ctx context.Context, targets []Target, steps []Step, parallelism int) []TargetResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make([]TargetResult, len(targets))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = runTarget(ctx, target, steps)
+		}(i, target)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// runTarget connects to a single target and runs the steps against it sequentially.
+func runTarget(ctx context.Context, target Target, steps []Step) TargetResult {
+	start := time.Now()
+	result := TargetResult{Target: target.Name}
+
+	var conn *orm.Connection
+	err := ctx.Err()
+	if err == nil {
+		conn, err = connect(&target.Config)
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("error connecting to database: %w", err)
+		for _, step := range steps {
+			result.Steps = append(result.Steps, StepResult{Step: step.Name, Status: StatusSkipped})
+		}
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	failed := false
+	for _, step := range steps {
+		if failed {
+			result.Steps = append(result.Steps, StepResult{Step: step.Name, Status: StatusSkipped})
+			continue
+		}
+
+		stepStart := time.Now()
+		stepResult := StepResult{Step: step.Name, Status: StatusOK}
+		if err := step.Run(ctx, conn); err != nil {
+			stepResult.Status = StatusFailed
+			stepResult.Err = err
+			failed = true
+		}
+		stepResult.Duration = time.Since(stepStart)
+		result.Steps = append(result.Steps, stepResult)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// WriteSummary writes a matrix with one row per target and one column per step, followed by the total duration
+// and the first error encountered on that target, if any.
+func WriteSummary(w io.Writer, steps []Step, results []TargetResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := []string{"TARGET"}
+	for _, step := range steps {
+		header = append(header, strings.ToUpper(step.Name))
+	}
+	header = append(header, "DURATION", "ERROR")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, result := range results {
+		row := []string{result.Target}
+		firstErr := result.Err
+		for _, step := range result.Steps {
+			row = append(row, string(step.Status))
+			if firstErr == nil && step.Err != nil {
+				firstErr = fmt.Errorf("%s: %w", step.Step, step.Err)
+			}
+		}
+
+		errText := ""
+		if firstErr != nil {
+			errText = firstErr.Error()
+		}
+		row = append(row, result.Duration.Round(time.Millisecond).String(), errText)
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// ResolveTargets builds the list of targets from the configuration. With all set, every configured database is
+// returned, starting with the primary one; otherwise the named databases are returned in the given order.
+func ResolveTargets(cfg *config.Config, names []string, all bool) ([]Target, error) {
+	if all {
+		names = cfg.DatabaseNames()
+	}
+
+	var targets []Target
+	for _, name := range names {
+		db, err := cfg.LookupDatabase(name)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, Target{Name: name, Config: *db})
+	}
+	return targets, nil
+}
@@ -0,0 +1,94 @@
+package multidb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_BoundedParallelismAndAggregation(t *testing.T) {
+	original := connect
+	defer func() { connect = original }()
+	connect = func(cfg *config.DatabaseConfig) (*orm.Connection, error) {
+		return &orm.Connection{}, nil
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	steps := []Step{
+		{Name: "migrate", Run: func(ctx context.Context, conn *orm.Connection) error {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return nil
+		}},
+		{Name: "seed", Run: func(ctx context.Context, conn *orm.Connection) error {
+			return errors.New("boom")
+		}},
+	}
+
+	var targets []Target
+	for i := 0; i < 6; i++ {
+		targets = append(targets, Target{Name: fmt.Sprintf("tenant_%d", i), Config: config.DatabaseConfig{Driver: "postgres"}})
+	}
+
+	results := Run(context.Background(), targets, steps, 2)
+	assert.Len(t, results, 6)
+	assert.LessOrEqual(t, maxInFlight, 2)
+	for i, result := range results {
+		assert.Equal(t, targets[i].Name, result.Target)
+		assert.True(t, result.Failed())
+		assert.Equal(t, StatusOK, result.Steps[0].Status)
+		assert.Equal(t, StatusFailed, result.Steps[1].Status)
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSummary(&buf, steps, results))
+	assert.Contains(t, buf.String(), "MIGRATE")
+	assert.Contains(t, buf.String(), "seed: boom")
+}
+
+func TestRun_ConnectionFailureSkipsSteps(t *testing.T) {
+	original := connect
+	defer func() { connect = original }()
+	connect = func(cfg *config.DatabaseConfig) (*orm.Connection, error) {
+		return nil, errors.New("unreachable")
+	}
+
+	results := Run(context.Background(), []Target{{Name: "default"}}, []Step{{Name: "migrate", Run: func(context.Context, *orm.Connection) error { return nil }}}, 1)
+	assert.Error(t, results[0].Err)
+	assert.Equal(t, StatusSkipped, results[0].Steps[0].Status)
+}
+
+func TestRun_CancelledSkipsTargets(t *testing.T) {
+	original := connect
+	defer func() { connect = original }()
+	connected := false
+	connect = func(cfg *config.DatabaseConfig) (*orm.Connection, error) {
+		connected = true
+		return &orm.Connection{}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := Run(ctx, []Target{{Name: "default"}}, []Step{{Name: "migrate", Run: func(context.Context, *orm.Connection) error { return nil }}}, 1)
+	assert.ErrorIs(t, results[0].Err, context.Canceled)
+	assert.Equal(t, StatusSkipped, results[0].Steps[0].Status)
+	assert.False(t, connected)
+}
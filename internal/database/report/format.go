@@ -0,0 +1,90 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+// Formats are the output formats of reports.
+var Formats = []string{FormatTable, FormatCSV, FormatJSON}
+
+// CheckFormat returns an error if format is not one of Formats.
+func CheckFormat(format string) error {
+	for _, f := range Formats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid report format %q: use one of %s", format, strings.Join(Formats, ", "))
+}
+
+// Write writes the result in the given format: an aligned table, CSV with a header, or a JSON array of objects
+// keyed by column.
+func Write(w io.Writer, format string, result *Result) error {
+	switch format {
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(result.Columns, "\t")))
+		for _, row := range result.Rows {
+			cells := make([]string, len(row))
+			for i, v := range row {
+				cells[i] = strings.Join(strings.Fields(text(v)), " ")
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		return tw.Flush()
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(result.Columns)
+		for _, row := range result.Rows {
+			cells := make([]string, len(row))
+			for i, v := range row {
+				cells[i] = text(v)
+			}
+			cw.Write(cells)
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatJSON:
+		records := make([]map[string]interface{}, len(result.Rows))
+		for i, row := range result.Rows {
+			records[i] = make(map[string]interface{}, len(row))
+			for j, v := range row {
+				records[i][result.Columns[j]] = v
+			}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+	return CheckFormat(format)
+}
+
+// text formats a value of a result: times at midnight as dates, other times as RFC 3339, NULL as nothing.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,106 @@
+package report
+
+import "strings"
+
+// paramNames returns the names of the parameters referenced in a query, in the order of their first reference.
+func paramNames(query string) []string {
+	var names []string
+	seen := map[string]bool{}
+	replaceParams(query, func(name string) string {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return ""
+	})
+	return names
+}
+
+// replaceParams replaces the parameters of a query, :name, by what replace returns for their name. Casts
+// (::type), string literals, quoted identifiers and comments are left alone.
+func replaceParams(query string, replace func(name string) string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := skipQuoted(query, i, c)
+			b.WriteString(query[i:end])
+			i = end
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			b.WriteString(query[i : i+end])
+			i += end
+		case c == '$':
+			end := skipDollarQuoted(query, i)
+			b.WriteString(query[i:end])
+			i = end
+		case strings.HasPrefix(query[i:], "::"):
+			b.WriteString("::")
+			i += 2
+		case c == ':' && i+1 < len(query) && isIdentStart(query[i+1]):
+			end := i + 2
+			for end < len(query) && isIdentPart(query[end]) {
+				end++
+			}
+			b.WriteString(replace(query[i+1 : end]))
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// skipQuoted returns the index after the string or identifier quoted by quote starting at i, where doubled
+// quotes are escapes.
+func skipQuoted(query string, i int, quote byte) int {
+	for j := i + 1; j < len(query); j++ {
+		if query[j] == quote {
+			if j+1 < len(query) && query[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(query)
+}
+
+// skipDollarQuoted returns the index after the dollar-quoted string ($$...$$ or $tag$...$tag$) starting at i,
+// or after the $ when it does not start one, e.g. in a positional parameter.
+func skipDollarQuoted(query string, i int) int {
+	end := i + 1
+	for end < len(query) && isIdentPart(query[end]) && !(end == i+1 && query[end] >= '0' && query[end] <= '9') {
+		end++
+	}
+	if end >= len(query) || query[end] != '$' {
+		return i + 1
+	}
+	tag := query[i : end+1]
+	if close := strings.Index(query[end+1:], tag); close >= 0 {
+		return end + 1 + close + len(tag)
+	}
+	return len(query)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
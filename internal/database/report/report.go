@@ -0,0 +1,405 @@
+// Package report runs the named reports of a project, defined in its reports directory as SQL files or as YAML
+// definitions with parameters, a query builder and a schedule, and writes their results as a table, CSV or
+// JSON.
+package report
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/cron"
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is the directory of the reports of a project.
+const Dir = "reports"
+
+// Parameter types.
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	// TypeDate is a day, e.g. 2024-05-14, or today or yesterday.
+	TypeDate = "date"
+	// TypeMonth is the first day of a month, e.g. 2024-05, or this_month or last_month.
+	TypeMonth = "month"
+	// TypeTime is a time, e.g. 2024-05-14T09:30:00Z, or now.
+	TypeTime = "time"
+)
+
+// Types are the types of parameters.
+var Types = []string{TypeString, TypeInt, TypeFloat, TypeBool, TypeDate, TypeMonth, TypeTime}
+
+// Param is a parameter of a report, referenced as :name in its query.
+type Param struct {
+	Name        string `yaml:"name" json:"name"`
+	Type        string `yaml:"type" json:"type"`
+	Default     string `yaml:"default,omitempty" json:"default,omitempty"`
+	Required    bool   `yaml:"required,omitempty" json:"required,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// Builder builds the query of a report from its clauses, each of which may reference parameters.
+type Builder struct {
+	From    string   `yaml:"from" json:"from"`
+	Select  []string `yaml:"select,omitempty" json:"select,omitempty"`
+	Where   []string `yaml:"where,omitempty" json:"where,omitempty"`
+	GroupBy []string `yaml:"group_by,omitempty" json:"group_by,omitempty"`
+	Having  []string `yaml:"having,omitempty" json:"having,omitempty"`
+	OrderBy []string `yaml:"order_by,omitempty" json:"order_by,omitempty"`
+	Limit   int      `yaml:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// SQL returns the SELECT statement of the builder, of every column when Select is empty.
+func (b *Builder) SQL() string {
+	columns := []string{"*"}
+	if len(b.Select) > 0 {
+		columns = b.Select
+	}
+	query := "SELECT " + strings.Join(columns, ", ") + "\nFROM " + b.From
+	if len(b.Where) > 0 {
+		query += "\nWHERE " + joinConditions(b.Where)
+	}
+	if len(b.GroupBy) > 0 {
+		query += "\nGROUP BY " + strings.Join(b.GroupBy, ", ")
+	}
+	if len(b.Having) > 0 {
+		query += "\nHAVING " + joinConditions(b.Having)
+	}
+	if len(b.OrderBy) > 0 {
+		query += "\nORDER BY " + strings.Join(b.OrderBy, ", ")
+	}
+	if b.Limit > 0 {
+		query += "\nLIMIT " + strconv.Itoa(b.Limit)
+	}
+	return query
+}
+
+// joinConditions joins conditions with AND, parenthesizing them so that ORs within them keep their meaning.
+func joinConditions(conditions []string) string {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	parts := make([]string, len(conditions))
+	for i, condition := range conditions {
+		parts[i] = "(" + condition + ")"
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// Schedule runs a report periodically, see "report scheduler".
+type Schedule struct {
+	// Cron is the schedule of the runs, e.g. "0 6 1 * *" for 6am on the first day of every month.
+	Cron string `yaml:"cron" json:"cron"`
+	// Params are the parameters of the runs, e.g. last_month for a month.
+	Params map[string]string `yaml:"params,omitempty" json:"params,omitempty"`
+	// Format is the format of the files written, CSV by default.
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+}
+
+// Report is a named report.
+type Report struct {
+	Name        string    `yaml:"-" json:"name"`
+	Description string    `yaml:"description,omitempty" json:"description,omitempty"`
+	Params      []Param   `yaml:"params,omitempty" json:"params,omitempty"`
+	SQL         string    `yaml:"sql,omitempty" json:"sql,omitempty"`
+	Query       *Builder  `yaml:"query,omitempty" json:"query,omitempty"`
+	Schedule    *Schedule `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	// Path is the file the report is defined in.
+	Path string `yaml:"-" json:"path"`
+
+	cron *cron.Schedule
+}
+
+// Statement returns the SQL of the report, written or built.
+func (r *Report) Statement() string {
+	if r.Query != nil {
+		return r.Query.SQL()
+	}
+	return r.SQL
+}
+
+// Cron returns the parsed schedule of the report, or nil if it has none.
+func (r *Report) Cron() *cron.Schedule {
+	return r.cron
+}
+
+// Param returns the parameter of the given name, or nil.
+func (r *Report) Param(name string) *Param {
+	for i := range r.Params {
+		if r.Params[i].Name == name {
+			return &r.Params[i]
+		}
+	}
+	return nil
+}
+
+// Load reads the reports of the reports directory of fsys, ordered by name. A report named monthly_revenue is
+// defined in monthly_revenue.yaml (or .yml), or in monthly_revenue.sql, a query whose parameters are strings.
+func Load(fsys fs.FS) ([]*Report, error) {
+	entries, err := fs.ReadDir(fsys, Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reports directory: %w", err)
+	}
+	byName := map[string]*Report{}
+	var reports []*Report
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".sql" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		r, err := parse(fsys, path.Join(Dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if previous, ok := byName[r.Name]; ok {
+			return nil, fmt.Errorf("report %s is defined in both %s and %s", r.Name, previous.Path, r.Path)
+		}
+		byName[r.Name] = r
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+	return reports, nil
+}
+
+// Find returns the report of the given name among reports.
+func Find(reports []*Report, name string) (*Report, error) {
+	for _, r := range reports {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("report %s not found in %s/", name, Dir)
+}
+
+func parse(fsys fs.FS, file string) (*Report, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report %s: %w", file, err)
+	}
+	ext := path.Ext(file)
+	r := &Report{Name: strings.TrimSuffix(path.Base(file), ext), Path: file}
+	if ext == ".sql" {
+		r.SQL = string(data)
+		for _, name := range paramNames(r.SQL) {
+			r.Params = append(r.Params, Param{Name: name, Type: TypeString, Required: true})
+		}
+	} else if err := yaml.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", file, err)
+	}
+	if err := r.validate(); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", file, err)
+	}
+	return r, nil
+}
+
+func (r *Report) validate() error {
+	if (r.SQL == "") == (r.Query == nil) {
+		return fmt.Errorf("define either sql or query")
+	}
+	if r.Query != nil && r.Query.From == "" {
+		return fmt.Errorf("query has no from")
+	}
+	for i := range r.Params {
+		p := &r.Params[i]
+		if p.Type == "" {
+			p.Type = TypeString
+		}
+		if !validType(p.Type) {
+			return fmt.Errorf("parameter %s has invalid type %q: use one of %s", p.Name, p.Type, strings.Join(Types, ", "))
+		}
+		if p.Default != "" {
+			if _, err := p.Value(p.Default, time.Now()); err != nil {
+				return fmt.Errorf("default of parameter %s: %w", p.Name, err)
+			}
+		}
+	}
+	for _, name := range paramNames(r.Statement()) {
+		if r.Param(name) == nil {
+			return fmt.Errorf("query references undeclared parameter :%s", name)
+		}
+	}
+	if r.Schedule != nil {
+		s, err := cron.Parse(r.Schedule.Cron)
+		if err != nil {
+			return err
+		}
+		r.cron = s
+		if r.Schedule.Format != "" {
+			if err := CheckFormat(r.Schedule.Format); err != nil {
+				return fmt.Errorf("schedule: %w", err)
+			}
+		}
+		for name := range r.Schedule.Params {
+			if r.Param(name) == nil {
+				return fmt.Errorf("schedule sets undeclared parameter %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+func validType(t string) bool {
+	for _, valid := range Types {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Value converts a value given for the parameter to the value bound to the query. Dates and months are relative
+// to now when given as today, yesterday, this_month or last_month, and are in the location of now.
+func (p *Param) Value(s string, now time.Time) (interface{}, error) {
+	invalid := func(example string) error {
+		return fmt.Errorf("invalid %s %q for parameter %s: use e.g. %s", p.Type, s, p.Name, example)
+	}
+	switch p.Type {
+	case TypeInt:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, invalid("42")
+		}
+		return v, nil
+	case TypeFloat:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, invalid("4.2")
+		}
+		return v, nil
+	case TypeBool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, invalid("true")
+		}
+		return v, nil
+	case TypeDate:
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		switch s {
+		case "today":
+			return today, nil
+		case "yesterday":
+			return today.AddDate(0, 0, -1), nil
+		}
+		v, err := time.ParseInLocation("2006-01-02", s, now.Location())
+		if err != nil {
+			return nil, invalid("2024-05-14, today or yesterday")
+		}
+		return v, nil
+	case TypeMonth:
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		switch s {
+		case "this_month":
+			return month, nil
+		case "last_month":
+			return month.AddDate(0, -1, 0), nil
+		}
+		v, err := time.ParseInLocation("2006-01", s, now.Location())
+		if err != nil {
+			return nil, invalid("2024-05, this_month or last_month")
+		}
+		return v, nil
+	case TypeTime:
+		if s == "now" {
+			return now, nil
+		}
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, invalid("2024-05-14T09:30:00Z or now")
+		}
+		return v, nil
+	}
+	return s, nil
+}
+
+// Bind returns the statement of the report with its parameters replaced by placeholders, and their values:
+// the values given, or the defaults of the parameters. Optional parameters without a value are NULL.
+func (r *Report) Bind(values map[string]string, now time.Time) (string, []interface{}, error) {
+	for name := range values {
+		if r.Param(name) == nil {
+			return "", nil, fmt.Errorf("report %s has no parameter %s", r.Name, name)
+		}
+	}
+	statement := r.Statement()
+	names := paramNames(statement)
+	args := make([]interface{}, len(names))
+	positions := make(map[string]int, len(names))
+	for i, name := range names {
+		p := r.Param(name)
+		if p == nil {
+			return "", nil, fmt.Errorf("report %s references undeclared parameter :%s", r.Name, name)
+		}
+		s, given := values[name]
+		if !given {
+			s = p.Default
+		}
+		if given || s != "" {
+			v, err := p.Value(s, now)
+			if err != nil {
+				return "", nil, err
+			}
+			args[i] = v
+		} else if p.Required {
+			return "", nil, fmt.Errorf("report %s requires parameter %s: set it with --param %s=...", r.Name, name, name)
+		}
+		positions[name] = i + 1
+	}
+	query := replaceParams(statement, func(name string) string {
+		return "$" + strconv.Itoa(positions[name])
+	})
+	return query, args, nil
+}
+
+// Result is the result of a report.
+type Result struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Run runs the report with the given parameter values.
+func Run(ctx context.Context, db *sql.DB, r *Report, values map[string]string, now time.Time) (*Result, error) {
+	query, args, err := r.Bind(values, now)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("report %s failed: %w", r.Name, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range row {
+			pointers[i] = &row[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, v := range row {
+			// The driver returns numerics and text as bytes.
+			if b, ok := v.([]byte); ok {
+				row[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("report %s failed: %w", r.Name, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const monthlyRevenue = `description: Revenue by day of a month
+params:
+  - name: month
+    type: month
+    required: true
+  - name: status
+    default: paid
+sql: |
+  SELECT created_at::date AS day, sum(total) AS revenue
+  FROM orders
+  WHERE status = :status AND created_at >= :month AND created_at < :month::date + interval '1 month'
+  GROUP BY 1 ORDER BY 1
+schedule:
+  cron: "0 6 1 * *"
+  params:
+    month: last_month
+`
+
+const topCustomers = `params:
+  - name: since
+    type: date
+    default: yesterday
+  - name: limit
+    type: int
+query:
+  from: orders
+  select: [customer_id, "count(*) AS orders"]
+  where: ["created_at >= :since", "status = 'paid' OR status = 'shipped'"]
+  group_by: [customer_id]
+  order_by: [orders DESC]
+  limit: 10
+`
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"reports/monthly_revenue.yaml": {Data: []byte(monthlyRevenue)},
+		"reports/top_customers.yml":    {Data: []byte(topCustomers)},
+		"reports/signups.sql":          {Data: []byte("SELECT count(*) FROM users WHERE source = :source -- not :this\n")},
+		"reports/README.md":            {Data: []byte("notes")},
+	}
+	reports, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, reports, 3)
+	assert.Equal(t, "monthly_revenue", reports[0].Name)
+	assert.Equal(t, "signups", reports[1].Name)
+	assert.Equal(t, []Param{{Name: "source", Type: TypeString, Required: true}}, reports[1].Params)
+	assert.Equal(t, "top_customers", reports[2].Name)
+
+	assert.Equal(t, "0 6 1 * *", reports[0].Cron().String())
+	assert.Equal(t, []*Report{reports[0]}, Scheduled(reports))
+	assert.Equal(t, FormatCSV, reports[0].ScheduleFormat())
+
+	_, err = Find(reports, "weekly")
+	assert.EqualError(t, err, "report weekly not found in reports/")
+
+	for file, content := range map[string]string{
+		"reports/a.yaml": "params: [{name: month, type: week}]\nsql: SELECT :month",
+		"reports/b.yaml": "sql: SELECT :month",
+		"reports/c.yaml": "description: nothing",
+		"reports/d.yaml": "sql: SELECT 1\nschedule: {cron: '0 6 1 *'}",
+	} {
+		_, err := Load(fstest.MapFS{file: {Data: []byte(content)}})
+		assert.Error(t, err, file)
+	}
+}
+
+func TestBuilder_SQL(t *testing.T) {
+	b := &Builder{From: "orders", Where: []string{"a = 1", "b = 2 OR c = 3"}, GroupBy: []string{"d"}, Limit: 5}
+	assert.Equal(t, "SELECT *\nFROM orders\nWHERE (a = 1) AND (b = 2 OR c = 3)\nGROUP BY d\nLIMIT 5", b.SQL())
+}
+
+func TestReport_Bind(t *testing.T) {
+	reports, err := Load(fstest.MapFS{
+		"reports/monthly_revenue.yaml": {Data: []byte(monthlyRevenue)},
+		"reports/top_customers.yaml":   {Data: []byte(topCustomers)},
+	})
+	require.NoError(t, err)
+	now := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+
+	query, args, err := reports[0].Bind(map[string]string{"month": "2024-05"}, now)
+	require.NoError(t, err)
+	assert.Contains(t, query, "WHERE status = $1 AND created_at >= $2 AND created_at < $2::date + interval '1 month'")
+	assert.Equal(t, []interface{}{"paid", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}, args)
+
+	_, args, err = reports[0].Bind(reports[0].Schedule.Params, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), args[1])
+
+	_, _, err = reports[0].Bind(nil, now)
+	assert.EqualError(t, err, "report monthly_revenue requires parameter month: set it with --param month=...")
+	_, _, err = reports[0].Bind(map[string]string{"month": "May"}, now)
+	assert.EqualError(t, err, `invalid month "May" for parameter month: use e.g. 2024-05, this_month or last_month`)
+	_, _, err = reports[0].Bind(map[string]string{"month": "2024-05", "region": "eu"}, now)
+	assert.EqualError(t, err, "report monthly_revenue has no parameter region")
+
+	// Optional parameters without a value are NULL; the string literal is left alone.
+	query, args, err = reports[1].Bind(nil, now)
+	require.NoError(t, err)
+	assert.Contains(t, query, "WHERE (created_at >= $1) AND (status = 'paid' OR status = 'shipped')")
+	assert.Equal(t, []interface{}{time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)}, args)
+}
+
+func TestReplaceParams(t *testing.T) {
+	query := `SELECT ':a', ":b", $$ :c $$, $1, x::text /* :d */ FROM t WHERE y = :e -- :f`
+	assert.Equal(t, []string{"e"}, paramNames(query))
+	assert.Equal(t, `SELECT ':a', ":b", $$ :c $$, $1, x::text /* :d */ FROM t WHERE y = ? -- :f`,
+		replaceParams(query, func(string) string { return "?" }))
+}
+
+func TestWrite(t *testing.T) {
+	result := &Result{
+		Columns: []string{"day", "revenue", "note"},
+		Rows: [][]interface{}{
+			{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "1250.50", "first, of May"},
+			{time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), 980.25, nil},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, FormatCSV, result))
+	assert.Equal(t, "day,revenue,note\n2024-05-01,1250.50,\"first, of May\"\n2024-05-02,980.25,\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, Write(&buf, FormatTable, result))
+	assert.Equal(t, "DAY         REVENUE  NOTE\n2024-05-01  1250.50  first, of May\n2024-05-02  980.25   \n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, Write(&buf, FormatJSON, &Result{Columns: []string{"n"}, Rows: [][]interface{}{{int64(3)}}}))
+	assert.JSONEq(t, `[{"n": 3}]`, buf.String())
+
+	assert.EqualError(t, Write(&buf, "xml", result), `invalid report format "xml": use one of table, csv, json`)
+}
@@ -0,0 +1,72 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+// Scheduled returns the reports with a schedule.
+func Scheduled(reports []*Report) []*Report {
+	var scheduled []*Report
+	for _, r := range reports {
+		if r.cron != nil {
+			scheduled = append(scheduled, r)
+		}
+	}
+	return scheduled
+}
+
+// RunSchedule calls run for the scheduled reports at the times of their schedules, in the local time zone,
+// until ctx is canceled. Reports due at the same time run one after the other; a run that ends after the next
+// time of its report skips the runs missed.
+func RunSchedule(ctx context.Context, reports []*Report, run func(r *Report, at time.Time)) error {
+	scheduled := Scheduled(reports)
+	if len(scheduled) == 0 {
+		return errors.New("no report has a schedule")
+	}
+	for {
+		now := time.Now()
+		var next time.Time
+		var due []*Report
+		for _, r := range scheduled {
+			at := r.cron.Next(now)
+			switch {
+			case at.IsZero():
+			case next.IsZero() || at.Before(next):
+				next, due = at, []*Report{r}
+			case at.Equal(next):
+				due = append(due, r)
+			}
+		}
+		if next.IsZero() {
+			return errors.New("the schedules of the reports never run")
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		for _, r := range due {
+			run(r, next)
+		}
+	}
+}
+
+// OutputPath returns the file a scheduled run of a report writes to in dir, named after the report and the time
+// of the run, e.g. monthly_revenue-20240601T0600.csv.
+func OutputPath(dir string, r *Report, at time.Time) string {
+	return filepath.Join(dir, r.Name+"-"+at.Format("20060102T1504")+"."+r.ScheduleFormat())
+}
+
+// ScheduleFormat returns the format of the files written by the scheduled runs of the report.
+func (r *Report) ScheduleFormat() string {
+	if r.Schedule == nil || r.Schedule.Format == "" {
+		return FormatCSV
+	}
+	return r.Schedule.Format
+}
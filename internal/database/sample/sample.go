@@ -0,0 +1,235 @@
+// Package sample selects a referentially consistent sample of the rows of models in a Postgres database and
+// copies it into another one, anonymizing sensitive fields on the way. Relations are declared with field
+// references, see model.Field.
+package sample
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/transfer"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/privacy"
+)
+
+// Source is a database rows are sampled from.
+type Source interface {
+	// SampleIDs returns the IDs of about percent percent of the rows of a table, picked at random.
+	SampleIDs(ctx context.Context, table string, percent float64) ([]int64, error)
+	// ReferencedIDs returns the distinct non-null values of a column of a table in the rows with the given IDs.
+	ReferencedIDs(ctx context.Context, table, column string, ids []int64) ([]int64, error)
+}
+
+// Select samples percent percent of the rows of every model and adds the rows they reference, and the rows
+// those reference in turn, so that every reference of the sample resolves within it. It returns the sorted IDs
+// of the sample by table, as used by transfer.Transfer.
+func Select(ctx context.Context, src Source, defs []*model.ModelDefinition, percent float64) (map[string][]int64, error) {
+	if percent <= 0 || percent > 100 {
+		return nil, fmt.Errorf("percent must be greater than 0 and at most 100, got %g", percent)
+	}
+	byName := make(map[string]*model.ModelDefinition, len(defs))
+	for _, def := range defs {
+		byName[strings.ToLower(def.Name)] = def
+	}
+
+	selected := make(map[string]map[int64]bool, len(defs))
+	frontier := make(map[*model.ModelDefinition][]int64)
+	add := func(def *model.ModelDefinition, ids []int64) {
+		table := model.TableName(def)
+		if selected[table] == nil {
+			selected[table] = make(map[int64]bool)
+		}
+		for _, id := range ids {
+			if !selected[table][id] {
+				selected[table][id] = true
+				frontier[def] = append(frontier[def], id)
+			}
+		}
+	}
+	for _, def := range defs {
+		ids, err := src.SampleIDs(ctx, model.TableName(def), percent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample %s: %w", model.TableName(def), err)
+		}
+		add(def, ids)
+	}
+
+	// References are followed from the rows added last until no row is added, which ends on cycles since rows
+	// are only added once.
+	for len(frontier) > 0 {
+		current := frontier
+		frontier = make(map[*model.ModelDefinition][]int64)
+		for _, def := range defs {
+			ids := current[def]
+			if len(ids) == 0 {
+				continue
+			}
+			for i := range def.Fields {
+				field := &def.Fields[i]
+				if field.References == "" {
+					continue
+				}
+				referenced, ok := byName[strings.ToLower(field.References)]
+				if !ok {
+					return nil, fmt.Errorf("%s.%s references unknown model %s", def.Name, field.Name, field.References)
+				}
+				refs, err := src.ReferencedIDs(ctx, model.TableName(def), model.ColumnName(field), ids)
+				if err != nil {
+					return nil, fmt.Errorf("failed to follow %s.%s: %w", def.Name, field.Name, err)
+				}
+				add(referenced, refs)
+			}
+		}
+	}
+
+	result := make(map[string][]int64, len(selected))
+	for table, set := range selected {
+		ids := make([]int64, 0, len(set))
+		for id := range set {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		result[table] = ids
+	}
+	return result, nil
+}
+
+// DBSource is a Source reading from a Postgres database.
+type DBSource struct {
+	db *sql.DB
+}
+
+// NewDBSource creates a source reading from db.
+func NewDBSource(db *sql.DB) *DBSource {
+	return &DBSource{db: db}
+}
+
+// SampleIDs implements Source.
+func (s *DBSource) SampleIDs(ctx context.Context, table string, percent float64) ([]int64, error) {
+	return s.queryIDs(ctx, fmt.Sprintf("SELECT id FROM %s WHERE random() * 100 < $1", pq.QuoteIdentifier(table)), percent)
+}
+
+// ReferencedIDs implements Source.
+func (s *DBSource) ReferencedIDs(ctx context.Context, table, column string, ids []int64) ([]int64, error) {
+	return s.queryIDs(ctx, fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE id = ANY($1) AND %s IS NOT NULL",
+		pq.QuoteIdentifier(column), pq.QuoteIdentifier(table), pq.QuoteIdentifier(column)), pq.Array(ids))
+}
+
+func (s *DBSource) queryIDs(ctx context.Context, query string, args ...interface{}) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Target is a transfer.Target writing a sample into a Postgres database that may already hold some of its
+// tables and rows: missing tables are created, and sampled rows replace the rows of the same ID.
+type Target struct {
+	db        *sql.DB
+	anonymize bool
+	created   map[string]bool
+}
+
+// NewTarget creates a target writing to db. With anonymize, the sensitive fields of the rows written are
+// overwritten as an erasure in anonymize mode does, see privacy.AnonymizedAssignments.
+func NewTarget(db *sql.DB, anonymize bool) *Target {
+	return &Target{db: db, anonymize: anonymize, created: make(map[string]bool)}
+}
+
+// CreateTable implements transfer.Target. Tables that already exist are kept.
+func (t *Target) CreateTable(ctx context.Context, def *model.ModelDefinition) error {
+	table := model.TableName(def)
+	var exists bool
+	if err := t.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	for _, statement := range (transfer.Postgres{}).CreateTable(def) {
+		if _, err := t.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	t.created[table] = true
+	return nil
+}
+
+// Insert implements transfer.Target. The rows of a batch are written, and anonymized, in one transaction.
+func (t *Target) Insert(ctx context.Context, def *model.ModelDefinition, columns []model.StoredColumn, rows [][]interface{}) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.PrepareContext(ctx, upsertStatement(def, columns))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		if _, err := statement.ExecContext(ctx, row...); err != nil {
+			return err
+		}
+		ids[i], _ = row[0].(int64)
+	}
+
+	if assignments := privacy.AnonymizedAssignments(def); t.anonymize && len(assignments) > 0 {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE id = ANY($1)",
+			pq.QuoteIdentifier(model.TableName(def)), strings.Join(assignments, ", ")), pq.Array(ids)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FinishTable implements transfer.Target. The sequence of the id column is moved past the written IDs, and the
+// row-level security policies of the tables created are added.
+func (t *Target) FinishTable(ctx context.Context, def *model.ModelDefinition) error {
+	statements := (transfer.Postgres{}).FinishTable(def)
+	if !t.created[model.TableName(def)] {
+		statements = statements[:1]
+	}
+	for _, statement := range statements {
+		if _, err := t.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertStatement returns the statement inserting a row of the given columns into the table of a model, or
+// updating the row of the same ID.
+func upsertStatement(def *model.ModelDefinition, columns []model.StoredColumn) string {
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	var updates []string
+	for i, column := range columns {
+		names[i] = pq.QuoteIdentifier(column.Name)
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		if column.Name != "id" {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", names[i], names[i]))
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (id) DO UPDATE SET %s",
+		pq.QuoteIdentifier(model.TableName(def)), strings.Join(names, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+}
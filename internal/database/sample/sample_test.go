@@ -0,0 +1,96 @@
+package sample
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// fakeSource samples fixed IDs and resolves references from fixed rows, by table and column.
+type fakeSource struct {
+	sampled map[string][]int64
+	refs    map[string]map[string]map[int64]int64
+}
+
+func (s *fakeSource) SampleIDs(ctx context.Context, table string, percent float64) ([]int64, error) {
+	return s.sampled[table], nil
+}
+
+func (s *fakeSource) ReferencedIDs(ctx context.Context, table, column string, ids []int64) ([]int64, error) {
+	var refs []int64
+	for _, id := range ids {
+		if ref, ok := s.refs[table][column][id]; ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+func newSampleTestModels() []*model.ModelDefinition {
+	user := model.NewModelDefinition("User", []model.Field{
+		model.NewField("email", "string", "", false, false),
+		model.NewField("manager_id", "*int64", "", true, false),
+	})
+	user.Fields[1].References = "User"
+	order := model.NewModelDefinition("Order", []model.Field{model.NewField("user_id", "int64", "", false, false)})
+	order.Fields[0].References = "user"
+	item := model.NewModelDefinition("Item", []model.Field{model.NewField("order_id", "int64", "", false, false)})
+	item.Fields[0].References = "Order"
+	return []*model.ModelDefinition{user, order, item}
+}
+
+func TestSelect(t *testing.T) {
+	src := &fakeSource{
+		sampled: map[string][]int64{"users": {1}, "items": {7}},
+		refs: map[string]map[string]map[int64]int64{
+			// 1 reports to 2, who reports to 3, who reports to 1.
+			"users":  {"manager_id": {1: 2, 2: 3, 3: 1, 4: 1}},
+			"orders": {"user_id": {5: 4, 6: 1}},
+			"items":  {"order_id": {7: 5}},
+		},
+	}
+
+	ids, err := Select(context.Background(), src, newSampleTestModels(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]int64{
+		"users":  {1, 2, 3, 4},
+		"orders": {5},
+		"items":  {7},
+	}, ids)
+}
+
+func TestSelect_Errors(t *testing.T) {
+	defs := newSampleTestModels()
+	_, err := Select(context.Background(), &fakeSource{}, defs, 0)
+	assert.ErrorContains(t, err, "percent must be greater than 0")
+	_, err = Select(context.Background(), &fakeSource{}, defs, 101)
+	assert.Error(t, err)
+
+	defs[2].Fields[0].References = "Cart"
+	_, err = Select(context.Background(), &fakeSource{sampled: map[string][]int64{"items": {1}}}, defs, 50)
+	assert.EqualError(t, err, "Item.order_id references unknown model Cart")
+
+	_, err = Select(context.Background(), failingSource{}, defs, 50)
+	assert.EqualError(t, err, "failed to sample users: boom")
+}
+
+type failingSource struct{}
+
+func (failingSource) SampleIDs(context.Context, string, float64) ([]int64, error) {
+	return nil, errors.New("boom")
+}
+
+func (failingSource) ReferencedIDs(context.Context, string, string, []int64) ([]int64, error) {
+	return nil, errors.New("boom")
+}
+
+func TestUpsertStatement(t *testing.T) {
+	def := newSampleTestModels()[1]
+	assert.Equal(t, `INSERT INTO "orders" ("id", "created_at", "updated_at", "user_id") VALUES ($1, $2, $3, $4) `+
+		`ON CONFLICT (id) DO UPDATE SET "created_at" = EXCLUDED."created_at", "updated_at" = EXCLUDED."updated_at", "user_id" = EXCLUDED."user_id"`,
+		upsertStatement(def, model.StoredColumns(def)))
+}
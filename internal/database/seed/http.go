@@ -0,0 +1,481 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// SourceHTTP is the source of the seeds fetching JSON from an HTTP endpoint.
+const SourceHTTP = "http"
+
+// The pagination types of an HTTP source.
+const (
+	// PagePagination requests pages by number.
+	PagePagination = "page"
+	// OffsetPagination requests pages by the offset of their first record.
+	OffsetPagination = "offset"
+	// CursorPagination requests the page after the cursor returned by the previous one.
+	CursorPagination = "cursor"
+	// LinkPagination follows the URL of the next page, from the response or its Link header.
+	LinkPagination = "link"
+)
+
+// DefaultMaxPages is the number of pages an HTTP source fetches at most unless it sets another.
+const DefaultMaxPages = 100
+
+// httpInsertBatchSize is the number of rows of an INSERT statement of an HTTP seed.
+const httpInsertBatchSize = 500
+
+var linkNext = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// HTTPSource is a seed file with the .yaml extension fetching records from a JSON API, and inserting them into
+// the table of a model, or a table, with the fields of the records mapped to columns:
+//
+//	source: http
+//	url: https://api.example.com/v1/countries
+//	records: data
+//	pagination: {type: page, size_param: per_page, size: 100}
+//	auth: {type: bearer, token_env: COUNTRIES_TOKEN}
+//	model: Country
+//	fields:
+//	  Code: iso.alpha2
+//	  Name: name.common
+//	conflict: [Code]
+type HTTPSource struct {
+	Source  string            `yaml:"source"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Auth    *HTTPAuth         `yaml:"auth"`
+	// Records is the dotted path of the array of records in the responses, the response itself when empty.
+	Records    string          `yaml:"records"`
+	Pagination *HTTPPagination `yaml:"pagination"`
+	// Model is the model the records are inserted as; Table names the table instead.
+	Model string `yaml:"model"`
+	Table string `yaml:"table"`
+	// Fields maps the fields of the model, or the columns of the table, to the dotted paths of their values in
+	// the records.
+	Fields map[string]string `yaml:"fields"`
+	// Conflict lists the fields or columns of a unique constraint: records conflicting with a row update it,
+	// so the seed can run again.
+	Conflict []string `yaml:"conflict"`
+}
+
+// HTTPAuth authenticates the requests of an HTTP source with credentials read from environment variables.
+type HTTPAuth struct {
+	// Type is "bearer", "basic", "header" or "query".
+	Type string `yaml:"type"`
+	// TokenEnv holds the token of the bearer, header and query types.
+	TokenEnv string `yaml:"token_env"`
+	// UsernameEnv and PasswordEnv hold the credentials of the basic type.
+	UsernameEnv string `yaml:"username_env"`
+	PasswordEnv string `yaml:"password_env"`
+	// Name is the header, or the query parameter, holding the token.
+	Name string `yaml:"name"`
+}
+
+// HTTPPagination configures how an HTTP source fetches the pages of records. Fetching stops at a page with no
+// records, a page with fewer than Size records when Size is set, a page without a next cursor or link, or
+// after MaxPages pages.
+type HTTPPagination struct {
+	// Type is one of PagePagination, OffsetPagination, CursorPagination and LinkPagination.
+	Type string `yaml:"type"`
+	// Param is the query parameter of the page number, offset or cursor: "page", "offset" or "cursor" by default.
+	Param string `yaml:"param"`
+	// SizeParam is the query parameter of the page size, set to Size if both are.
+	SizeParam string `yaml:"size_param"`
+	Size      int    `yaml:"size"`
+	// Start is the number of the first page, 1 by default.
+	Start int `yaml:"start"`
+	// Next is the dotted path of the next cursor, or of the URL of the next page, in the responses. Link
+	// pagination uses the Link header of the responses without it.
+	Next     string `yaml:"next"`
+	MaxPages int    `yaml:"max_pages"`
+}
+
+// ParseHTTPSource parses and validates the YAML of an HTTP seed.
+func ParseHTTPSource(data []byte) (*HTTPSource, error) {
+	s := &HTTPSource{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Source != SourceHTTP {
+		return nil, fmt.Errorf("unknown source %q (expected %q)", s.Source, SourceHTTP)
+	}
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url %q", s.URL)
+	}
+	if (s.Model == "") == (s.Table == "") {
+		return nil, fmt.Errorf("set either model or table")
+	}
+	if len(s.Fields) == 0 {
+		return nil, fmt.Errorf("no fields")
+	}
+	if s.Auth != nil {
+		switch s.Auth.Type {
+		case "bearer":
+		case "header", "query":
+			if s.Auth.Name == "" {
+				return nil, fmt.Errorf("%s auth needs a name", s.Auth.Type)
+			}
+		case "basic":
+			if s.Auth.UsernameEnv == "" || s.Auth.PasswordEnv == "" {
+				return nil, fmt.Errorf("basic auth needs username_env and password_env")
+			}
+		default:
+			return nil, fmt.Errorf("unknown auth type %q (expected bearer, basic, header or query)", s.Auth.Type)
+		}
+		if s.Auth.Type != "basic" && s.Auth.TokenEnv == "" {
+			return nil, fmt.Errorf("%s auth needs token_env", s.Auth.Type)
+		}
+	}
+	if p := s.Pagination; p != nil {
+		switch p.Type {
+		case PagePagination, OffsetPagination, CursorPagination:
+			if p.Param == "" {
+				p.Param = p.Type
+			}
+		case LinkPagination:
+		default:
+			return nil, fmt.Errorf("unknown pagination type %q", p.Type)
+		}
+		if p.Type == CursorPagination && p.Next == "" {
+			return nil, fmt.Errorf("cursor pagination needs the path of the next cursor")
+		}
+		if p.Type == OffsetPagination && p.Size <= 0 {
+			return nil, fmt.Errorf("offset pagination needs a page size")
+		}
+		if p.Start == 0 {
+			p.Start = 1
+		}
+		if p.MaxPages <= 0 {
+			p.MaxPages = DefaultMaxPages
+		}
+	}
+	return s, nil
+}
+
+// Fetch requests the pages of the source and returns their records.
+func (s *HTTPSource) Fetch(ctx context.Context, client *http.Client) ([]map[string]interface{}, error) {
+	p := s.Pagination
+	if p == nil {
+		p = &HTTPPagination{MaxPages: 1}
+	}
+	next, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]interface{}
+	for page := 0; page < p.MaxPages && next != nil; page++ {
+		pageURL := *next
+		query := pageURL.Query()
+		switch p.Type {
+		case PagePagination:
+			query.Set(p.Param, strconv.Itoa(p.Start+page))
+		case OffsetPagination:
+			query.Set(p.Param, strconv.Itoa(len(records)))
+		}
+		if p.SizeParam != "" && p.Size > 0 {
+			query.Set(p.SizeParam, strconv.Itoa(p.Size))
+		}
+		pageURL.RawQuery = query.Encode()
+
+		body, header, err := s.get(ctx, client, &pageURL)
+		if err != nil {
+			return nil, err
+		}
+		items, ok := lookup(body, s.Records).([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the records of %s at %q are not an array", pageURL.Redacted(), s.Records)
+		}
+		for _, item := range items {
+			record, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("a record of %s is not an object", pageURL.Redacted())
+			}
+			records = append(records, record)
+		}
+		if len(items) == 0 || (p.Size > 0 && len(items) < p.Size) {
+			break
+		}
+
+		next = nil
+		switch p.Type {
+		case PagePagination, OffsetPagination:
+			next = &pageURL
+		case CursorPagination:
+			if cursor := lookup(body, p.Next); cursor != nil && fmt.Sprint(cursor) != "" {
+				query.Set(p.Param, fmt.Sprint(cursor))
+				pageURL.RawQuery = query.Encode()
+				next = &pageURL
+			}
+		case LinkPagination:
+			link := ""
+			if p.Next != "" {
+				link, _ = lookup(body, p.Next).(string)
+			} else if m := linkNext.FindStringSubmatch(header.Get("Link")); m != nil {
+				link = m[1]
+			}
+			if link != "" {
+				if next, err = pageURL.Parse(link); err != nil {
+					return nil, fmt.Errorf("invalid link to the next page %q: %w", link, err)
+				}
+			}
+		}
+	}
+	return records, nil
+}
+
+// get requests a page and decodes its JSON body, keeping numbers as json.Number.
+func (s *HTTPSource) get(ctx context.Context, client *http.Client, u *url.URL) (interface{}, http.Header, error) {
+	// Errors name the URL without the token of query auth.
+	shown := u.Redacted()
+	if s.Auth != nil && s.Auth.Type == "query" {
+		token, err := env(s.Auth.TokenEnv)
+		if err != nil {
+			return nil, nil, err
+		}
+		query := u.Query()
+		query.Set(s.Auth.Name, token)
+		withToken := *u
+		withToken.RawQuery = query.Encode()
+		u = &withToken
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+	if err := s.authorize(req); err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, nil, fmt.Errorf("failed to fetch %s: %w", shown, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch %s: %s", shown, resp.Status)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON from %s: %w", shown, err)
+	}
+	return body, resp.Header, nil
+}
+
+func (s *HTTPSource) authorize(req *http.Request) error {
+	if s.Auth == nil {
+		return nil
+	}
+	switch s.Auth.Type {
+	case "bearer", "header":
+		token, err := env(s.Auth.TokenEnv)
+		if err != nil {
+			return err
+		}
+		if s.Auth.Type == "bearer" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			req.Header.Set(s.Auth.Name, token)
+		}
+	case "basic":
+		username, err := env(s.Auth.UsernameEnv)
+		if err != nil {
+			return err
+		}
+		password, err := env(s.Auth.PasswordEnv)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(username, password)
+	}
+	return nil
+}
+
+// env returns the value of an environment variable holding a credential.
+func env(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("set %s to the credential of the HTTP source", name)
+	}
+	return value, nil
+}
+
+// lookup returns the value at a dotted path of a decoded JSON value, whose segments are object keys or array
+// indexes, or nil if there is none. The empty path is the value itself.
+func lookup(value interface{}, path string) interface{} {
+	if path == "" {
+		return value
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// Columns returns the table the records are inserted into and the columns of the fields, sorted, with the
+// columns of the conflict fields. The fields of a model are resolved with models, which maps the names of the
+// models to their definitions.
+func (s *HTTPSource) Columns(models map[string]*model.ModelDefinition) (table string, columns, paths, conflict []string, err error) {
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	column := func(name string) string { return name }
+	table = s.Table
+	if s.Model != "" {
+		def, ok := models[strings.ToLower(s.Model)]
+		if !ok {
+			return "", nil, nil, nil, fmt.Errorf("model %s does not exist", s.Model)
+		}
+		table = model.TableName(def)
+		column = func(name string) string {
+			if field := def.Field(name); field != nil {
+				return model.ColumnName(field)
+			}
+			return ""
+		}
+	}
+	for _, name := range names {
+		c := column(name)
+		if c == "" {
+			return "", nil, nil, nil, fmt.Errorf("model %s has no field %s", s.Model, name)
+		}
+		columns = append(columns, c)
+		paths = append(paths, s.Fields[name])
+	}
+	for _, name := range s.Conflict {
+		c := column(name)
+		if c == "" {
+			return "", nil, nil, nil, fmt.Errorf("model %s has no field %s", s.Model, name)
+		}
+		conflict = append(conflict, c)
+	}
+	return table, columns, paths, conflict, nil
+}
+
+// insert inserts the records into the table within tx. Nested objects and arrays are inserted as JSON, and
+// the rows of a model get the current time as their creation and update times.
+func (s *HTTPSource) insert(ctx context.Context, tx *sql.Tx, records []map[string]interface{}, models map[string]*model.ModelDefinition) error {
+	table, columns, paths, conflict, err := s.Columns(models)
+	if err != nil {
+		return err
+	}
+	timestamps := s.Model != ""
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = pq.QuoteIdentifier(c)
+	}
+	if timestamps {
+		quoted = append(quoted, "created_at", "updated_at")
+	}
+	tail := ""
+	if len(conflict) > 0 {
+		conflicting := make(map[string]bool, len(conflict))
+		quotedConflict := make([]string, len(conflict))
+		for i, c := range conflict {
+			conflicting[c] = true
+			quotedConflict[i] = pq.QuoteIdentifier(c)
+		}
+		var updates []string
+		for _, c := range columns {
+			if !conflicting[c] {
+				updates = append(updates, pq.QuoteIdentifier(c)+" = EXCLUDED."+pq.QuoteIdentifier(c))
+			}
+		}
+		if timestamps {
+			updates = append(updates, "updated_at = EXCLUDED.updated_at")
+		}
+		tail = fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(quotedConflict, ", "))
+		if len(updates) > 0 {
+			tail = fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quotedConflict, ", "), strings.Join(updates, ", "))
+		}
+	}
+
+	now := time.Now().UTC()
+	for start := 0; start < len(records); start += httpInsertBatchSize {
+		end := start + httpInsertBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		var rows []string
+		var args []interface{}
+		for _, record := range records[start:end] {
+			placeholders := make([]string, 0, len(quoted))
+			for _, path := range paths {
+				value, err := columnValue(lookup(record, path))
+				if err != nil {
+					return err
+				}
+				args = append(args, value)
+				placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+			}
+			if timestamps {
+				args = append(args, now, now)
+				placeholders = append(placeholders, "$"+strconv.Itoa(len(args)-1), "$"+strconv.Itoa(len(args)))
+			}
+			rows = append(rows, "("+strings.Join(placeholders, ", ")+")")
+		}
+		statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s", pq.QuoteIdentifier(table), strings.Join(quoted, ", "), strings.Join(rows, ", "), tail)
+		if _, err := tx.ExecContext(ctx, statement, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnValue converts a decoded JSON value to a statement argument.
+func columnValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, string, bool:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+}
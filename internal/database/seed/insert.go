@@ -0,0 +1,48 @@
+package seed
+
+import (
+	"fmt"
+	"strings"
+)
+
+// insertBatchSize is the number of rows of an INSERT statement written by InsertSQL.
+const insertBatchSize = 500
+
+// InsertSQL returns the SQL of a seed inserting the rows into the columns of a table, in INSERT statements of
+// up to 500 rows. Values are written as string literals that PostgreSQL converts to the column types, and empty
+// values as NULL.
+func InsertSQL(table string, columns []string, rows [][]string) string {
+	var b strings.Builder
+	for start := 0; start < len(rows); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES\n", table, strings.Join(columns, ", "))
+		for i, row := range rows[start:end] {
+			values := make([]string, len(columns))
+			for j := range columns {
+				values[j] = "NULL"
+				if j < len(row) && row[j] != "" {
+					values[j] = quoteLiteral(row[j])
+				}
+			}
+			separator := ","
+			if start+i == end-1 {
+				separator = ";"
+			}
+			fmt.Fprintf(&b, "  (%s)%s\n", strings.Join(values, ", "), separator)
+		}
+	}
+	return b.String()
+}
+
+// quoteLiteral quotes a value as an SQL string literal. Seeds are split into statements at every semicolon, so
+// semicolons in the value are concatenated as chr(59).
+func quoteLiteral(value string) string {
+	quoted := "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	if !strings.Contains(value, ";") {
+		return quoted
+	}
+	return "(" + strings.ReplaceAll(quoted, ";", "' || chr(59) || '") + ")"
+}
@@ -0,0 +1,101 @@
+package seed
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// groupDirective puts a seed in a parallel group, e.g. "-- Group: catalog", or "# Group: catalog" in the
+// YAML of HTTP seeds.
+var groupDirective = regexp.MustCompile(`(?im)^\s*(?:--|#)\s*group:\s*(\S+)\s*$`)
+
+// seedGroup returns the parallel group the content of a seed file declares, or "" if it declares none.
+func seedGroup(content string) string {
+	if m := groupDirective.FindStringSubmatch(content); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return ""
+}
+
+// SetWorkers sets the number of parallel groups of seeds executed concurrently, 1 by default.
+func (s *Seeder) SetWorkers(workers int) {
+	s.workers = workers
+}
+
+// stages splits seeds, in order, into the stages they execute in. Each stage is a list of groups, which
+// execute concurrently, and whose seeds execute one after the other in order. A seed without a group is a
+// stage of its own, so it still executes after every seed before it and before every seed after it; the
+// grouped seeds between two such seeds form a stage of their groups.
+func stages(seeds []*Seed) [][][]*Seed {
+	var stages [][][]*Seed
+	var groups [][]*Seed
+	index := map[string]int{}
+	for _, seed := range seeds {
+		if seed.Group == "" {
+			if len(groups) > 0 {
+				stages = append(stages, groups)
+				groups, index = nil, map[string]int{}
+			}
+			stages = append(stages, [][]*Seed{{seed}})
+			continue
+		}
+		i, ok := index[seed.Group]
+		if !ok {
+			i = len(groups)
+			index[seed.Group] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], seed)
+	}
+	if len(groups) > 0 {
+		stages = append(stages, groups)
+	}
+	return stages
+}
+
+// executeStage executes the groups of a stage, up to the Seeder's workers at once. Once a seed fails, the
+// seeds still running are canceled and no more start; the first error is returned.
+func (s *Seeder) executeStage(ctx context.Context, groups [][]*Seed) error {
+	workers := s.workers
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group []*Seed) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			for _, seed := range group {
+				if err := ctx.Err(); err != nil {
+					fail(err)
+					return
+				}
+				if err := s.executeSeed(ctx, seed); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}(group)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -1,63 +1,127 @@
 package seed
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ooyeku/grayv-lsm/embedded"
+	"github.com/ooyeku/grayv-lsm/internal/model"
 	"github.com/sirupsen/logrus"
 )
 
 // Seed represents a database seed, which encapsulates the name and the SQL statements
-// to be executed.
+// to be executed, or the HTTP source its rows are fetched from. Checksum is the hexadecimal SHA-256
+// of the content of its file, recorded when it is applied, and Group the parallel group declared by
+// its "-- Group:" directive, if any.
 type Seed struct {
-	Name string
-	SQL  string
+	Name     string
+	SQL      string
+	HTTP     *HTTPSource
+	Checksum string
+	Group    string
 }
 
 // Seeder represents a struct for managing database seeding operations.
 //
-// It contains a database connection (db) and a set of seed objects (seeds).
+// It contains a database connection (db), the file system seeds are read from (fsys) and the directory of
+// the seeds in it (dir), the source its applied seeds are recorded under (source), a set of seed objects
+// (seeds), the models HTTP seeds insert rows of by lowercased name (models), the client HTTP seeds are
+// fetched with (client), and the number of parallel groups of seeds executed concurrently (workers).
 type Seeder struct {
-	db    *sql.DB
-	seeds []*Seed
+	db      *sql.DB
+	fsys    fs.FS
+	dir     string
+	source  string
+	seeds   []*Seed
+	models  map[string]*model.ModelDefinition
+	client  *http.Client
+	workers int
 }
 
 // NewSeeder creates a new instance of the Seeder struct which is used to seed the database with initial data.
 // It takes a pointer to a sql.DB object as a parameter and returns a pointer to the Seeder struct.
 // The sql.DB object is used to execute the SQL queries to seed the database.
+// Seeds are read from the embedded file system.
 // Example usage: seeder := seed.NewSeeder(conn.GetDB())
 func NewSeeder(db *sql.DB) *Seeder {
-	return &Seeder{db: db}
+	seeder := NewSeederFS(db, embedded.EmbeddedFiles)
+	seeder.source = "embedded"
+	return seeder
 }
 
-// LoadSeeds loads the seed files from the embedded "seeds" directory and populates the Seeder's seeds slice.
-// Seed files must have a .sql extension. The seeds are sorted in alphabetical order by filename.
-// Returns an error if the embedded seeds directory cannot be read or if any seed file fails to be read.
+// NewSeederFS creates a new Seeder that reads its seed files from the "seeds" directory of the given file system.
+// This allows seeds to be loaded uniformly from the embedded files, a project directory (os.DirFS), or an
+// in-memory tree in tests.
+// Example usage: seeder := seed.NewSeederFS(conn.GetDB(), os.DirFS("."))
+func NewSeederFS(db *sql.DB, fsys fs.FS) *Seeder {
+	return &Seeder{db: db, fsys: fsys, dir: "seeds", source: "seeds", client: &http.Client{Timeout: time.Minute}, workers: 1}
+}
+
+// NewSeederDir creates a new Seeder that reads its seed files from the given directory, such as the seeds
+// directory of a project.
+// Example usage: seeder := seed.NewSeederDir(conn.GetDB(), "seeds")
+func NewSeederDir(db *sql.DB, dir string) *Seeder {
+	seeder := NewSeederFS(db, os.DirFS(dir))
+	seeder.dir = "."
+	seeder.source = path.Clean(filepath.ToSlash(dir))
+	return seeder
+}
+
+// SetModels sets the models HTTP seeds may insert rows of.
+func (s *Seeder) SetModels(defs []*model.ModelDefinition) {
+	s.models = make(map[string]*model.ModelDefinition, len(defs))
+	for _, def := range defs {
+		s.models[strings.ToLower(def.Name)] = def
+	}
+}
+
+// SetHTTPClient sets the client HTTP seeds are fetched with.
+func (s *Seeder) SetHTTPClient(client *http.Client) {
+	s.client = client
+}
+
+// LoadSeeds loads the seed files from the Seeder's "seeds" directory and populates the Seeder's seeds slice.
+// Seed files must have a .sql extension, or a .yaml or .yml extension for HTTP seeds (see HTTPSource). The
+// seeds are sorted in alphabetical order by filename.
+// Returns an error if the seeds directory cannot be read or if any seed file fails to be read.
 // This method is part of the Seeder type.
 func (s *Seeder) LoadSeeds() error {
-	entries, err := embedded.EmbeddedFiles.ReadDir("seeds")
+	entries, err := fs.ReadDir(s.fsys, s.dir)
 	if err != nil {
-		return fmt.Errorf("failed to read embedded seeds directory: %w", err)
+		return fmt.Errorf("failed to read seeds directory: %w", err)
 	}
 
 	var loadErrors []error
 	for _, entry := range entries {
-		if filepath.Ext(entry.Name()) == ".sql" {
-			seedContent, err := embedded.EmbeddedFiles.ReadFile(filepath.Join("seeds", entry.Name()))
-			if err != nil {
-				loadErrors = append(loadErrors, fmt.Errorf("failed to read seed file %s: %w", entry.Name(), err))
-				continue
-			}
-			seed := &Seed{
-				Name: entry.Name(),
-				SQL:  string(seedContent),
-			}
-			s.seeds = append(s.seeds, seed)
+		ext := path.Ext(entry.Name())
+		if ext != ".sql" && ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		seedContent, err := fs.ReadFile(s.fsys, path.Join(s.dir, entry.Name()))
+		if err != nil {
+			loadErrors = append(loadErrors, fmt.Errorf("failed to read seed file %s: %w", entry.Name(), err))
+			continue
+		}
+		sum := sha256.Sum256(seedContent)
+		seed := &Seed{Name: entry.Name(), Checksum: hex.EncodeToString(sum[:]), Group: seedGroup(string(seedContent))}
+		if ext == ".sql" {
+			seed.SQL = string(seedContent)
+		} else if seed.HTTP, err = ParseHTTPSource(seedContent); err != nil {
+			loadErrors = append(loadErrors, fmt.Errorf("invalid seed file %s: %w", entry.Name(), err))
+			continue
 		}
+		s.seeds = append(s.seeds, seed)
 	}
 
 	sort.Slice(s.seeds, func(i, j int) bool {
@@ -71,10 +135,15 @@ func (s *Seeder) LoadSeeds() error {
 	return nil
 }
 
-// Seed executes all the loaded seeds in the Seeder. Returns an error if any seed fails to execute.
-func (s *Seeder) Seed() error {
-	for _, seed := range s.seeds {
-		if err := s.executeSeed(seed); err != nil {
+// Seed executes all the loaded seeds in the Seeder. Returns an error if any seed fails to execute. Cancelling
+// ctx stops the seed running, whose transaction is rolled back, and skips the following ones. Seeds of
+// different parallel groups between two seeds without a group execute concurrently (see SetWorkers).
+func (s *Seeder) Seed(ctx context.Context) error {
+	if err := s.createSeedsTable(ctx); err != nil {
+		return fmt.Errorf("failed to create %s table: %w", seedsTableName, err)
+	}
+	for _, stage := range stages(s.seeds) {
+		if err := s.executeStage(ctx, stage); err != nil {
 			return err
 		}
 	}
@@ -91,14 +160,31 @@ func (s *Seeder) Seed() error {
 //
 // Returns:
 // - An error if any error occurs during the execution of the seed, otherwise nil.
-func (s *Seeder) executeSeed(seed *Seed) error {
-	tx, err := s.db.Begin()
+func (s *Seeder) executeSeed(ctx context.Context, seed *Seed) error {
+	// The records of HTTP seeds are fetched before the transaction starts, so it stays short.
+	var records []map[string]interface{}
+	if seed.HTTP != nil {
+		var err error
+		if records, err = seed.HTTP.Fetch(ctx, s.client); err != nil {
+			logrus.WithError(err).Errorf("error fetching seed %s", seed.Name)
+			return err
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		logrus.WithError(err).Error("error starting transaction")
 		return err
 	}
 	defer tx.Rollback()
 
+	if seed.HTTP != nil {
+		if err := seed.HTTP.insert(ctx, tx, records, s.models); err != nil {
+			logrus.WithError(err).Errorf("error executing seed %s", seed.Name)
+			return err
+		}
+	}
+
 	// Split the SQL into individual statements
 	statements := strings.Split(seed.SQL, ";")
 
@@ -108,12 +194,17 @@ func (s *Seeder) executeSeed(seed *Seed) error {
 			continue
 		}
 
-		if _, err := tx.Exec(stmt); err != nil {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
 			logrus.WithError(err).Errorf("error executing seed %s", seed.Name)
 			return err
 		}
 	}
 
+	if err := s.recordSeed(ctx, tx, seed); err != nil {
+		logrus.WithError(err).Errorf("error recording seed %s", seed.Name)
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		logrus.WithError(err).Errorf("error committing seed %s", seed.Name)
 		return err
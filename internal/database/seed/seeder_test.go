@@ -0,0 +1,262 @@
+package seed
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func TestLoadSeeds_FromMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"seeds/002_posts.sql": {Data: []byte("INSERT INTO posts (title) VALUES ('hello');")},
+		"seeds/001_users.sql": {Data: []byte("INSERT INTO users (username) VALUES ('admin');")},
+		"seeds/README.md":     {Data: []byte("not a seed")},
+	}
+
+	seeder := NewSeederFS(nil, fsys)
+	assert.NoError(t, seeder.LoadSeeds())
+
+	if assert.Len(t, seeder.seeds, 2) {
+		assert.Equal(t, "001_users.sql", seeder.seeds[0].Name)
+		assert.Equal(t, "002_posts.sql", seeder.seeds[1].Name)
+		assert.Equal(t, "INSERT INTO posts (title) VALUES ('hello');", seeder.seeds[1].SQL)
+	}
+}
+
+func TestLoadSeeds_MissingDirectory(t *testing.T) {
+	seeder := NewSeederFS(nil, fstest.MapFS{})
+	assert.Error(t, seeder.LoadSeeds())
+}
+
+func TestInsertSQL(t *testing.T) {
+	rows := [][]string{{"Ann", "ann@example.com", "30"}, {"O'Brien; Pat", "", "41"}}
+	assert.Equal(t, "INSERT INTO people (name, email, age) VALUES\n"+
+		"  ('Ann', 'ann@example.com', '30'),\n"+
+		"  (('O''Brien' || chr(59) || ' Pat'), NULL, '41');\n", InsertSQL("people", []string{"name", "email", "age"}, rows))
+
+	rows = make([][]string, insertBatchSize+1)
+	for i := range rows {
+		rows[i] = []string{"x"}
+	}
+	assert.Equal(t, 2, strings.Count(InsertSQL("t", []string{"a"}, rows), "INSERT INTO"))
+}
+
+func TestLoadSeeds_HTTPSeed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"seeds/001_users.sql": {Data: []byte("INSERT INTO users (username) VALUES ('admin');")},
+		"seeds/002_countries.yaml": {Data: []byte(`source: http
+url: https://api.example.com/countries
+model: Country
+fields: {Code: cca2}
+`)},
+	}
+
+	seeder := NewSeederFS(nil, fsys)
+	assert.NoError(t, seeder.LoadSeeds())
+	if assert.Len(t, seeder.seeds, 2) && assert.NotNil(t, seeder.seeds[1].HTTP) {
+		assert.Equal(t, "Country", seeder.seeds[1].HTTP.Model)
+	}
+
+	fsys["seeds/003_broken.yml"] = &fstest.MapFile{Data: []byte("source: ftp\nurl: ftp://example.com\n")}
+	assert.ErrorContains(t, NewSeederFS(nil, fsys).LoadSeeds(), "003_broken.yml")
+}
+
+func TestParseHTTPSource(t *testing.T) {
+	for yaml, want := range map[string]string{
+		"source: http\nurl: /countries\nmodel: Country\nfields: {Code: cca2}":                                   "invalid url",
+		"source: http\nurl: https://example.com\nfields: {Code: cca2}":                                          "set either model or table",
+		"source: http\nurl: https://example.com\nmodel: Country":                                                "no fields",
+		"source: http\nurl: https://example.com\ntable: t\nfields: {a: b}\nauth: {type: bearer}":                "needs token_env",
+		"source: http\nurl: https://example.com\ntable: t\nfields: {a: b}\npagination: {type: cursor}":          "cursor pagination",
+		"source: http\nurl: https://example.com\ntable: t\nfields: {a: b}\npagination: {type: offset, size: 0}": "offset pagination",
+	} {
+		_, err := ParseHTTPSource([]byte(yaml))
+		assert.ErrorContains(t, err, want)
+	}
+
+	source, err := ParseHTTPSource([]byte("source: http\nurl: https://example.com\ntable: t\nfields: {a: b}\npagination: {type: page}"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, &HTTPPagination{Type: PagePagination, Param: "page", Start: 1, MaxPages: DefaultMaxPages}, source.Pagination)
+	}
+}
+
+func TestHTTPSource_Fetch(t *testing.T) {
+	t.Setenv("SEED_TOKEN", "secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			fmt.Fprint(w, `{"data": [{"id": 1, "name": {"common": "France"}}, {"id": 2, "name": {"common": "Peru"}}], "meta": {"next": "b"}}`)
+		case "b":
+			fmt.Fprint(w, `{"data": [{"id": 3, "name": {"common": "Chad"}}], "meta": {"next": ""}}`)
+		}
+	}))
+	defer server.Close()
+
+	source, err := ParseHTTPSource([]byte(`source: http
+url: ` + server.URL + `/countries
+records: data
+auth: {type: bearer, token_env: SEED_TOKEN}
+pagination: {type: cursor, next: meta.next}
+table: countries
+fields: {name: name.common}
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	records, err := source.Fetch(context.Background(), server.Client())
+	if assert.NoError(t, err) && assert.Len(t, records, 3) {
+		assert.Equal(t, "Chad", lookup(records[2], "name.common"))
+		assert.Equal(t, json.Number("3"), lookup(records[2], "id"))
+	}
+
+	t.Setenv("SEED_TOKEN", "")
+	_, err = source.Fetch(context.Background(), server.Client())
+	assert.ErrorContains(t, err, "set SEED_TOKEN")
+}
+
+func TestHTTPSource_FetchLinkPagination(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=2>; rel="next"`, server.URL))
+			fmt.Fprint(w, `[{"n": 1}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"n": 2}]`)
+	}))
+	defer server.Close()
+
+	source, err := ParseHTTPSource([]byte("source: http\nurl: " + server.URL + "/items\npagination: {type: link}\ntable: items\nfields: {n: n}\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	records, err := source.Fetch(context.Background(), server.Client())
+	if assert.NoError(t, err) && assert.Len(t, records, 2) {
+		assert.Equal(t, json.Number("2"), records[1]["n"])
+	}
+}
+
+func TestHTTPSource_Columns(t *testing.T) {
+	source := &HTTPSource{Model: "country", Fields: map[string]string{"Name": "name.common", "Code": "cca2"}, Conflict: []string{"code"}}
+	models := map[string]*model.ModelDefinition{"country": {Name: "Country", Fields: []model.Field{{Name: "Code", Type: "string"}, {Name: "Name", Type: "string"}}}}
+
+	table, columns, paths, conflict, err := source.Columns(models)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "countrys", table)
+		assert.Equal(t, []string{"code", "name"}, columns)
+		assert.Equal(t, []string{"cca2", "name.common"}, paths)
+		assert.Equal(t, []string{"code"}, conflict)
+	}
+
+	source.Fields["Capital"] = "capital"
+	_, _, _, _, err = source.Columns(models)
+	assert.ErrorContains(t, err, "has no field Capital")
+	_, _, _, _, err = source.Columns(nil)
+	assert.ErrorContains(t, err, "model country does not exist")
+}
+
+func TestColumnValue(t *testing.T) {
+	for value, want := range map[interface{}]interface{}{nil: nil, "a": "a", true: true, json.Number("1.5"): "1.5"} {
+		got, err := columnValue(value)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	got, err := columnValue(map[string]interface{}{"a": []interface{}{json.Number("1")}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":[1]}`, got)
+}
+
+func TestLoadSeeds_Checksum(t *testing.T) {
+	fsys := fstest.MapFS{"seeds/001_users.sql": {Data: []byte("INSERT INTO users (username) VALUES ('admin');")}}
+	seeder := NewSeederFS(nil, fsys)
+	assert.NoError(t, seeder.LoadSeeds())
+	sum := sha256.Sum256(fsys["seeds/001_users.sql"].Data)
+	if assert.Len(t, seeder.seeds, 1) {
+		assert.Equal(t, hex.EncodeToString(sum[:]), seeder.seeds[0].Checksum)
+	}
+}
+
+func TestSeeder_Drifts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001_users.sql": {Data: []byte("INSERT INTO users (username) VALUES ('admin');")},
+		"002_posts.sql": {Data: []byte("INSERT INTO posts (title) VALUES ('hello');")},
+		"003_tags.sql":  {Data: []byte("INSERT INTO tags (name) VALUES ('go');")},
+	}
+	seeder := NewSeederFS(nil, fsys)
+	seeder.dir, seeder.source = ".", "seeds"
+	assert.NoError(t, seeder.LoadSeeds())
+
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	drifts := seeder.drifts(map[string]appliedSeed{
+		"001_users.sql": {checksum: seeder.seeds[0].Checksum, appliedAt: at},
+		"002_posts.sql": {checksum: "edited", appliedAt: at},
+		"000_roles.sql": {checksum: "removed", appliedAt: at},
+	})
+	assert.Equal(t, []Drift{
+		{Source: "seeds", Name: "000_roles.sql", Status: DriftMissing, AppliedChecksum: "removed", AppliedAt: at},
+		{Source: "seeds", Name: "002_posts.sql", Status: DriftChanged, AppliedChecksum: "edited",
+			Checksum: seeder.seeds[1].Checksum, AppliedAt: at},
+	}, drifts)
+}
+
+func TestNewSeederDir_Source(t *testing.T) {
+	assert.Equal(t, "db/seeds", NewSeederDir(nil, "./db/seeds/").source)
+	assert.Equal(t, "embedded", NewSeeder(nil).source)
+}
+
+func TestLoadSeeds_Group(t *testing.T) {
+	fsys := fstest.MapFS{
+		"seeds/001_users.sql":     {Data: []byte("-- Group: Accounts\nINSERT INTO users (username) VALUES ('admin');")},
+		"seeds/002_roles.sql":     {Data: []byte("INSERT INTO roles (name) VALUES ('admin'); -- Group: ignored")},
+		"seeds/003_countries.yml": {Data: []byte("# group: reference\nsource: http\nurl: https://example.com\ntable: t\nfields: {a: b}\n")},
+	}
+	seeder := NewSeederFS(nil, fsys)
+	assert.NoError(t, seeder.LoadSeeds())
+	if assert.Len(t, seeder.seeds, 3) {
+		assert.Equal(t, "accounts", seeder.seeds[0].Group)
+		assert.Equal(t, "", seeder.seeds[1].Group)
+		assert.Equal(t, "reference", seeder.seeds[2].Group)
+	}
+}
+
+func TestStages(t *testing.T) {
+	var seeds []*Seed
+	for _, s := range []string{"001_schema:", "002_users:a", "003_posts:b", "004_users_roles:a", "005_index:", "006_tags:c"} {
+		name, group, _ := strings.Cut(s, ":")
+		seeds = append(seeds, &Seed{Name: name, Group: group})
+	}
+	var names [][][]string
+	for _, stage := range stages(seeds) {
+		var groups [][]string
+		for _, group := range stage {
+			var seedNames []string
+			for _, seed := range group {
+				seedNames = append(seedNames, seed.Name)
+			}
+			groups = append(groups, seedNames)
+		}
+		names = append(names, groups)
+	}
+	assert.Equal(t, [][][]string{
+		{{"001_schema"}},
+		{{"002_users", "004_users_roles"}, {"003_posts"}},
+		{{"005_index"}},
+		{{"006_tags"}},
+	}, names)
+}
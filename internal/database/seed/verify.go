@@ -0,0 +1,110 @@
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const seedsTableName = "grayv_seeds"
+
+// The statuses of the seeds reported by Verify.
+const (
+	// DriftChanged is the status of a seed whose file changed since it was applied.
+	DriftChanged = "changed"
+	// DriftMissing is the status of an applied seed whose file was removed.
+	DriftMissing = "missing"
+)
+
+// Drift is a seed whose file no longer matches the content applied to the database.
+type Drift struct {
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// AppliedChecksum is the checksum recorded when the seed was last applied, and Checksum that of its file,
+	// empty if it was removed.
+	AppliedChecksum string    `json:"applied_checksum"`
+	Checksum        string    `json:"checksum,omitempty"`
+	AppliedAt       time.Time `json:"applied_at"`
+}
+
+// appliedSeed is the record of an applied seed.
+type appliedSeed struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// createSeedsTable creates the table recording the checksum of the applied seeds, by source and name, if it
+// does not exist already.
+func (s *Seeder) createSeedsTable(ctx context.Context) error {
+	query := fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s (
+            source TEXT NOT NULL,
+            name TEXT NOT NULL,
+            checksum TEXT NOT NULL,
+            applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (source, name)
+        )
+    `, seedsTableName)
+	_, err := s.db.ExecContext(ctx, query)
+	return err
+}
+
+// recordSeed records the checksum of a seed applied in tx, replacing that of its previous application.
+func (s *Seeder) recordSeed(ctx context.Context, tx *sql.Tx, seed *Seed) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (source, name, checksum) VALUES ($1, $2, $3)
+        ON CONFLICT (source, name) DO UPDATE SET checksum = EXCLUDED.checksum, applied_at = CURRENT_TIMESTAMP`,
+		seedsTableName), s.source, seed.Name, seed.Checksum)
+	return err
+}
+
+// Verify compares the loaded seeds with the checksums recorded when they were last applied, and returns the
+// seeds whose file changed or was removed since, sorted by name. Seeds never applied are not reported.
+func (s *Seeder) Verify(ctx context.Context) ([]Drift, error) {
+	if err := s.createSeedsTable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create %s table: %w", seedsTableName, err)
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT name, checksum, applied_at FROM %s WHERE source = $1",
+		seedsTableName), s.source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied seeds: %w", err)
+	}
+	defer rows.Close()
+	applied := map[string]appliedSeed{}
+	for rows.Next() {
+		var name string
+		var a appliedSeed
+		if err := rows.Scan(&name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[name] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return s.drifts(applied), nil
+}
+
+// drifts returns the seeds whose checksum differs from the one they were applied with, and the applied seeds
+// that were not loaded.
+func (s *Seeder) drifts(applied map[string]appliedSeed) []Drift {
+	var drifts []Drift
+	loaded := make(map[string]bool, len(s.seeds))
+	for _, seed := range s.seeds {
+		loaded[seed.Name] = true
+		if a, ok := applied[seed.Name]; ok && a.checksum != seed.Checksum {
+			drifts = append(drifts, Drift{Source: s.source, Name: seed.Name, Status: DriftChanged,
+				AppliedChecksum: a.checksum, Checksum: seed.Checksum, AppliedAt: a.appliedAt})
+		}
+	}
+	for name, a := range applied {
+		if !loaded[name] {
+			drifts = append(drifts, Drift{Source: s.source, Name: name, Status: DriftMissing,
+				AppliedChecksum: a.checksum, AppliedAt: a.appliedAt})
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Name < drifts[j].Name })
+	return drifts
+}
@@ -0,0 +1,86 @@
+// Package sessions reports the long-running transactions of a Postgres database, such as transactions left
+// open by leaked connections, with the caller tagged in their last statement by generated repositories.
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Session is a database session with an open transaction.
+type Session struct {
+	PID             int           `json:"pid"`
+	User            string        `json:"user"`
+	ApplicationName string        `json:"application_name"`
+	ClientAddr      string        `json:"client_addr"`
+	State           string        `json:"state"`
+	TransactionAge  time.Duration `json:"-"`
+	QueryAge        time.Duration `json:"-"`
+	Query           string        `json:"query"`
+	// TransactionSeconds and QuerySeconds are TransactionAge and QueryAge in seconds, as written to JSON.
+	TransactionSeconds float64 `json:"transaction_seconds"`
+	QuerySeconds       float64 `json:"query_seconds"`
+	// Caller is the code that ran the last statement, when it was tagged, see ParseCaller.
+	Caller string `json:"caller,omitempty"`
+}
+
+// IdleInTransaction reports whether the session holds a transaction open without running a statement, which
+// usually means a transaction the application never committed or rolled back.
+func (s Session) IdleInTransaction() bool {
+	return strings.HasPrefix(s.State, "idle in transaction")
+}
+
+const sessionsQuery = `SELECT pid, COALESCE(usename, ''), application_name, COALESCE(host(client_addr), ''),
+	COALESCE(state, ''), EXTRACT(EPOCH FROM now() - xact_start), COALESCE(EXTRACT(EPOCH FROM now() - query_start), 0),
+	COALESCE(query, '')
+FROM pg_stat_activity
+WHERE datname = current_database() AND pid <> pg_backend_pid() AND xact_start IS NOT NULL
+	AND now() - xact_start >= $1 * interval '1 second'
+ORDER BY xact_start`
+
+// List returns the sessions of the current database whose transaction has been open for at least threshold,
+// oldest first.
+func List(ctx context.Context, db *sql.DB, threshold time.Duration) ([]Session, error) {
+	rows, err := db.QueryContext(ctx, sessionsQuery, threshold.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var transactionAge, queryAge float64
+		if err := rows.Scan(&s.PID, &s.User, &s.ApplicationName, &s.ClientAddr, &s.State, &transactionAge, &queryAge, &s.Query); err != nil {
+			return nil, err
+		}
+		s.TransactionAge, s.TransactionSeconds = seconds(transactionAge), transactionAge
+		s.QueryAge, s.QuerySeconds = seconds(queryAge), queryAge
+		s.Caller = ParseCaller(s.Query)
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
+// ParseCaller returns the caller tagged in a statement by the repositories of generated apps that set
+// models.TagQueries, e.g. "main.handle:main.go:42" for a statement starting with
+// "/* caller=main.handle:main.go:42 */", or "" if the statement is not tagged.
+func ParseCaller(query string) string {
+	const prefix = "/* caller="
+	start := strings.Index(query, prefix)
+	if start < 0 {
+		return ""
+	}
+	rest := query[start+len(prefix):]
+	end := strings.Index(rest, " */")
+	if end < 0 {
+		return ""
+	}
+	return rest[:end]
+}
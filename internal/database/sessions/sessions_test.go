@@ -0,0 +1,21 @@
+package sessions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCaller(t *testing.T) {
+	assert.Equal(t, "main.handle:main.go:42", ParseCaller("/* caller=main.handle:main.go:42 */ SELECT id FROM users"))
+	assert.Equal(t, "shop_grav/internal/handlers.(*Orders).Create:orders.go:7",
+		ParseCaller("/* caller=shop_grav/internal/handlers.(*Orders).Create:orders.go:7 */ INSERT INTO orders DEFAULT VALUES"))
+	assert.Equal(t, "", ParseCaller("SELECT 1"))
+	assert.Equal(t, "", ParseCaller("/* caller=truncated"))
+}
+
+func TestIdleInTransaction(t *testing.T) {
+	assert.True(t, Session{State: "idle in transaction"}.IdleInTransaction())
+	assert.True(t, Session{State: "idle in transaction (aborted)"}.IdleInTransaction())
+	assert.False(t, Session{State: "active"}.IdleInTransaction())
+}
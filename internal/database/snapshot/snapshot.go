@@ -0,0 +1,206 @@
+// Package snapshot writes the schema of a Postgres database, with the versions of the migrations applied to
+// it, to a canonical SQL file, and loads such a file into a fresh database, so that a database is created
+// without replaying every migration.
+//
+// The schema is dumped with pg_dump and stripped of what changes between runs without the schema changing,
+// such as the versions of the server and of pg_dump, so that the file only changes in version control when
+// the schema does.
+package snapshot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// DefaultFile is the file snapshots are written to unless another is given.
+const DefaultFile = "schema.sql"
+
+// header starts every snapshot.
+const header = `-- Schema snapshot written by grayv-lsm after running the migrations; do not edit it by hand.
+-- Load it into an empty database with "grayv-lsm db schema load" instead of replaying every migration.
+`
+
+// command creates the command running pg_dump. It is a variable so tests can substitute a fake.
+var command = exec.CommandContext
+
+// Version is a migration applied to the database of a snapshot.
+type Version struct {
+	Version int64
+	Name    string
+}
+
+// Dump returns the snapshot of the database of db, reached through conn for the migrations applied to it.
+func Dump(ctx context.Context, db *config.DatabaseConfig, conn *sql.DB) (string, error) {
+	if db.Driver != "" && db.Driver != "postgres" && db.Driver != "pgx" {
+		return "", fmt.Errorf("schema snapshots are only supported for postgres databases, not %s", db.Driver)
+	}
+	cmd := command(ctx, "pg_dump", "--schema-only", "--no-owner", "--no-privileges")
+	cmd.Env = append(os.Environ(), pgEnv(db)...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+	return Render(string(out), versions), nil
+}
+
+// variableLines match the lines of pg_dump output that change between runs while the schema does not: the
+// versions of the server and of pg_dump, and the \restrict and \unrestrict commands with their random keys.
+var variableLines = regexp.MustCompile(`(?m)^(--\s*Dumped (from database|by pg_dump) version .*|\\(un)?restrict\b.*)\n`)
+
+// blankLines matches runs of blank lines, left behind by the lines removed.
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// Render returns the snapshot of a schema dumped by pg_dump, with statements recording the given migrations as
+// applied, in version order.
+func Render(dump string, versions []Version) string {
+	dump = variableLines.ReplaceAllString(strings.ReplaceAll(dump, "\r\n", "\n"), "")
+	dump = strings.TrimSpace(blankLines.ReplaceAllString(dump, "\n\n"))
+
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteString("\n")
+	b.WriteString(dump)
+	b.WriteString("\n")
+	if len(versions) > 0 {
+		b.WriteString("\n--\n-- Applied migrations\n--\n\nINSERT INTO public.migrations (version, name) VALUES\n")
+		for i, v := range versions {
+			b.WriteString("    (" + strconv.FormatInt(v.Version, 10) + ", '" + strings.ReplaceAll(v.Name, "'", "''") + "')")
+			if i < len(versions)-1 {
+				b.WriteString(",\n")
+			}
+		}
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// Write writes a snapshot to path, under a temporary name renamed once complete, so that an interrupted write
+// leaves the previous snapshot in place. It reports whether the file changed.
+func Write(path, snapshot string) (bool, error) {
+	if previous, err := os.ReadFile(path); err == nil && string(previous) == snapshot {
+		return false, nil
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return false, fmt.Errorf("failed to create the directory of %s: %w", path, err)
+		}
+	}
+	partial := path + ".partial"
+	if err := os.WriteFile(partial, []byte(snapshot), 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// Load executes a snapshot in a single transaction. The database must be empty: Load refuses to run if it has
+// any table, see Tables.
+func Load(ctx context.Context, db *sql.DB, snapshot string) error {
+	tables, err := Tables(ctx, db)
+	if err != nil {
+		return err
+	}
+	if len(tables) > 0 {
+		return fmt.Errorf("the database is not empty, it has %d table(s) such as %s", len(tables), tables[0])
+	}
+
+	// The SET statements of pg_dump output last for the session, so they are reset before the connection
+	// returns to the pool.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, snapshot); err != nil {
+		tx.Rollback()
+		conn.ExecContext(ctx, "RESET ALL")
+		return fmt.Errorf("failed to load the schema snapshot: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "RESET ALL")
+	return err
+}
+
+// Tables returns the tables of the database outside the system schemas, sorted.
+func Tables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT table_schema || '.' || table_name FROM information_schema.tables
+        WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
+        ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the tables: %w", err)
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// appliedVersions returns the migrations applied to the database in version order, and none if it was never
+// migrated.
+func appliedVersions(ctx context.Context, db *sql.DB) ([]Version, error) {
+	var table sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.migrations')::text").Scan(&table); err != nil {
+		return nil, fmt.Errorf("failed to look up the migrations table: %w", err)
+	}
+	if !table.Valid {
+		return nil, nil
+	}
+	rows, err := db.QueryContext(ctx, "SELECT version, name FROM public.migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("error querying migrations: %w", err)
+	}
+	defer rows.Close()
+	var versions []Version
+	for rows.Next() {
+		var v Version
+		if err := rows.Scan(&v.Version, &v.Name); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// pgEnv returns the environment variables connecting pg_dump to the database of db, so that the password does
+// not appear in the arguments of the process.
+func pgEnv(db *config.DatabaseConfig) []string {
+	env := []string{"PGHOST=" + db.Host, "PGUSER=" + db.User, "PGPASSWORD=" + db.Password, "PGDATABASE=" + db.Name}
+	if db.Port != 0 {
+		env = append(env, "PGPORT="+strconv.Itoa(db.Port))
+	}
+	if db.SSLMode != "" {
+		env = append(env, "PGSSLMODE="+db.SSLMode)
+	}
+	return env
+}
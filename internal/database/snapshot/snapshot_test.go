@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dump = `--
+-- PostgreSQL database dump
+--
+
+\restrict Zx81fK2
+
+-- Dumped from database version 16.4
+-- Dumped by pg_dump version 16.4
+
+SET statement_timeout = 0;
+
+
+
+CREATE TABLE public.users (
+    id integer NOT NULL
+);
+
+\unrestrict Zx81fK2
+`
+
+func TestRender(t *testing.T) {
+	snapshot := Render(dump, []Version{{Version: 20240101000000, Name: "create_users"}, {Version: 20240201000000, Name: "user's_email"}})
+
+	assert.Equal(t, header+`
+--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+
+CREATE TABLE public.users (
+    id integer NOT NULL
+);
+
+--
+-- Applied migrations
+--
+
+INSERT INTO public.migrations (version, name) VALUES
+    (20240101000000, 'create_users'),
+    (20240201000000, 'user''s_email');
+`, snapshot)
+
+	// The versions of the server and of pg_dump do not change the snapshot.
+	other := Render(`--
+-- PostgreSQL database dump
+--
+
+\restrict a9Kq01
+
+-- Dumped from database version 17.0
+-- Dumped by pg_dump version 17.2
+
+SET statement_timeout = 0;
+
+CREATE TABLE public.users (
+    id integer NOT NULL
+);
+`, []Version{{Version: 20240101000000, Name: "create_users"}, {Version: 20240201000000, Name: "user's_email"}})
+	assert.Equal(t, snapshot, other)
+
+	assert.NotContains(t, Render(dump, nil), "INSERT INTO")
+}
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db", "schema.sql")
+
+	changed, err := Write(path, "one")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = Write(path, "one")
+	require.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = Write(path, "two")
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(data))
+	_, err = os.Stat(path + ".partial")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,338 @@
+// Package trace walks the relations of a record of a Postgres database: the records it references through
+// field references, the records referencing it, and so on up to a depth, into a graph that is exported as JSON
+// or as a Graphviz DOT file. Relations are declared with field references, see model.Field.
+package trace
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// DefaultDepth is the number of relations followed from the record traced unless another is given.
+const DefaultDepth = 2
+
+// DefaultLimit is the number of records referencing the records of a level read per relation unless another
+// is given.
+const DefaultLimit = 100
+
+// Row is a record read from a table, by column.
+type Row map[string]interface{}
+
+// Source is a database records are read from.
+type Source interface {
+	// Rows returns the rows of a table whose column holds one of the values, ordered by id, at most limit of
+	// them unless limit is 0.
+	Rows(ctx context.Context, table, column string, values []int64, limit int) ([]Row, error)
+}
+
+// Node is a record of the graph.
+type Node struct {
+	// Key identifies the record in the edges of the graph, e.g. "Order:42".
+	Key   string `json:"key"`
+	Model string `json:"model"`
+	ID    int64  `json:"id"`
+	// Depth is the number of relations followed from the record traced to reach the record.
+	Depth  int `json:"depth"`
+	Fields Row `json:"fields"`
+}
+
+// Edge is a reference of a record, From, to another, To, through one of its fields.
+type Edge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Field string `json:"field"`
+}
+
+// Graph is the records connected to a record, the first of its nodes.
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []Edge  `json:"edges"`
+	// Truncated lists the relations that had more referencing records than the limit, which were left out.
+	Truncated []string `json:"truncated,omitempty"`
+}
+
+// Options are the bounds of a trace.
+type Options struct {
+	// Depth is the number of relations followed from the record traced.
+	Depth int
+	// Limit is the number of records referencing the records of a level read per relation, all when 0.
+	Limit int
+}
+
+// Trace returns the graph of the records connected to the record of the given model and ID: the records it
+// references, the records referencing it, and in turn theirs, up to opts.Depth relations away. Every record
+// appears once, so the walk ends on cycles.
+func Trace(ctx context.Context, src Source, defs []*model.ModelDefinition, modelName string, id int64, opts Options) (*Graph, error) {
+	byName := make(map[string]*model.ModelDefinition, len(defs))
+	for _, def := range defs {
+		byName[strings.ToLower(def.Name)] = def
+	}
+	root, ok := byName[strings.ToLower(modelName)]
+	if !ok {
+		return nil, fmt.Errorf("model %s not found", modelName)
+	}
+	for _, def := range defs {
+		for _, field := range def.Fields {
+			if _, ok := byName[strings.ToLower(field.References)]; field.References != "" && !ok {
+				return nil, fmt.Errorf("%s.%s references unknown model %s", def.Name, field.Name, field.References)
+			}
+		}
+	}
+
+	rows, err := src.Rows(ctx, model.TableName(root), "id", []int64{id}, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %d: %w", root.Name, id, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s %d not found", root.Name, id)
+	}
+
+	g := &Graph{Edges: []Edge{}}
+	nodes := make(map[string]*Node)
+	edges := make(map[Edge]bool)
+	frontier := make(map[*model.ModelDefinition][]*Node)
+	add := func(def *model.ModelDefinition, row Row, depth int) *Node {
+		id, _ := toInt64(row["id"])
+		key := nodeKey(def, id)
+		if node, ok := nodes[key]; ok {
+			return node
+		}
+		node := &Node{Key: key, Model: def.Name, ID: id, Depth: depth, Fields: row}
+		nodes[key] = node
+		g.Nodes = append(g.Nodes, node)
+		frontier[def] = append(frontier[def], node)
+		return node
+	}
+	link := func(from *Node, to string, field string) {
+		if _, ok := nodes[to]; ok {
+			edge := Edge{From: from.Key, To: to, Field: field}
+			if !edges[edge] {
+				edges[edge] = true
+				g.Edges = append(g.Edges, edge)
+			}
+		}
+	}
+	add(root, rows[0], 0)
+
+	for depth := 1; depth <= opts.Depth && len(frontier) > 0; depth++ {
+		current := frontier
+		frontier = make(map[*model.ModelDefinition][]*Node)
+		for _, def := range defs {
+			level := current[def]
+			if len(level) == 0 {
+				continue
+			}
+
+			// The records the level references.
+			for i := range def.Fields {
+				field := &def.Fields[i]
+				if field.References == "" {
+					continue
+				}
+				referenced := byName[strings.ToLower(field.References)]
+				column := model.ColumnName(field)
+				values := referencedValues(level, column)
+				if len(values) == 0 {
+					continue
+				}
+				rows, err := src.Rows(ctx, model.TableName(referenced), "id", values, 0)
+				if err != nil {
+					return nil, fmt.Errorf("failed to follow %s.%s: %w", def.Name, field.Name, err)
+				}
+				for _, row := range rows {
+					add(referenced, row, depth)
+				}
+				for _, node := range level {
+					if value, ok := toInt64(node.Fields[column]); ok {
+						link(node, nodeKey(referenced, value), column)
+					}
+				}
+			}
+
+			// The records referencing the level.
+			ids := make([]int64, len(level))
+			for i, node := range level {
+				ids[i] = node.ID
+			}
+			for _, other := range defs {
+				for i := range other.Fields {
+					field := &other.Fields[i]
+					if !strings.EqualFold(field.References, def.Name) {
+						continue
+					}
+					column := model.ColumnName(field)
+					limit := opts.Limit
+					if limit > 0 {
+						limit++
+					}
+					rows, err := src.Rows(ctx, model.TableName(other), column, ids, limit)
+					if err != nil {
+						return nil, fmt.Errorf("failed to follow %s.%s: %w", other.Name, field.Name, err)
+					}
+					if opts.Limit > 0 && len(rows) > opts.Limit {
+						rows = rows[:opts.Limit]
+						g.Truncated = append(g.Truncated, fmt.Sprintf("%s.%s at depth %d", other.Name, field.Name, depth))
+					}
+					for _, row := range rows {
+						node := add(other, row, depth)
+						if value, ok := toInt64(row[column]); ok {
+							link(node, nodeKey(def, value), column)
+						}
+					}
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+// nodeKey returns the key of the record of a model with the given ID.
+func nodeKey(def *model.ModelDefinition, id int64) string {
+	return def.Name + ":" + strconv.FormatInt(id, 10)
+}
+
+// referencedValues returns the distinct non-null values of a column of the records, sorted.
+func referencedValues(nodes []*Node, column string) []int64 {
+	seen := make(map[int64]bool)
+	var values []int64
+	for _, node := range nodes {
+		if value, ok := toInt64(node.Fields[column]); ok && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+// toInt64 converts the value of an ID or reference column, and reports false for NULL.
+func toInt64(value interface{}) (int64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return value, true
+	case int32:
+		return int64(value), true
+	case int:
+		return int64(value), true
+	case float64:
+		return int64(value), true
+	case string:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// DOT renders the graph in the Graphviz DOT language, e.g. for "dot -Tsvg". Each record is a box listing its
+// fields, and each reference an arrow labelled with the referencing column; the record traced is drawn bold.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph trace {\n  rankdir=LR;\n  node [shape=box, fontname=\"monospace\"];\n")
+	for i, node := range g.Nodes {
+		label := []string{node.Model + " " + strconv.FormatInt(node.ID, 10)}
+		for _, column := range sortedColumns(node.Fields) {
+			if column != "id" {
+				label = append(label, column+": "+truncate(fmt.Sprint(node.Fields[column]), 40))
+			}
+		}
+		style := ""
+		if i == 0 {
+			style = ", style=bold"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s%s];\n", dotQuote(node.Key), dotLabel(label), style)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Field))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// sortedColumns returns the columns of a row, sorted.
+func sortedColumns(row Row) []string {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return s
+}
+
+// dotQuote returns s as a quoted DOT identifier.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// dotLabel returns lines as a quoted DOT label, each line left-justified.
+func dotLabel(lines []string) string {
+	quoted := make([]string, len(lines))
+	for i, line := range lines {
+		quoted[i] = strings.TrimSuffix(strings.TrimPrefix(dotQuote(line), `"`), `"`)
+	}
+	return `"` + strings.Join(quoted, `\l`) + `\l"`
+}
+
+// DBSource is a Source reading from a Postgres database.
+type DBSource struct {
+	db *sql.DB
+}
+
+// NewDBSource creates a source reading from db.
+func NewDBSource(db *sql.DB) *DBSource {
+	return &DBSource{db: db}
+}
+
+// Rows implements Source. Text and binary columns are read as strings.
+func (s *DBSource) Rows(ctx context.Context, table, column string, values []int64, limit int) ([]Row, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s = ANY($1) ORDER BY id", pq.QuoteIdentifier(table), pq.QuoteIdentifier(column))
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(values))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result []Row
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(Row, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
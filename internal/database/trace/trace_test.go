@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// fakeSource holds fixed rows by table.
+type fakeSource map[string][]Row
+
+func (s fakeSource) Rows(ctx context.Context, table, column string, values []int64, limit int) ([]Row, error) {
+	var rows []Row
+	for _, row := range s[table] {
+		for _, value := range values {
+			if v, ok := toInt64(row[column]); ok && v == value && (limit == 0 || len(rows) < limit) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows, nil
+}
+
+func newTraceTestModels() []*model.ModelDefinition {
+	user := model.NewModelDefinition("User", []model.Field{
+		model.NewField("email", "string", "", false, false),
+	})
+	order := model.NewModelDefinition("Order", []model.Field{
+		{Name: "user_id", Type: "int64", References: "User"},
+	})
+	item := model.NewModelDefinition("LineItem", []model.Field{
+		{Name: "order_id", Type: "int64", References: "Order"},
+		{Name: "sku", Type: "string"},
+	})
+	return []*model.ModelDefinition{item, order, user}
+}
+
+func newTraceTestSource() fakeSource {
+	return fakeSource{
+		"users": {{"id": int64(7), "email": "ada@example.com"}},
+		"orders": {
+			{"id": int64(42), "user_id": int64(7)},
+			{"id": int64(43), "user_id": int64(7)},
+		},
+		"lineitems": {
+			{"id": int64(1), "order_id": int64(42), "sku": "A"},
+			{"id": int64(2), "order_id": int64(42), "sku": "B"},
+			{"id": int64(3), "order_id": int64(43), "sku": "C"},
+		},
+	}
+}
+
+func nodeKeys(g *Graph) []string {
+	var keys []string
+	for _, node := range g.Nodes {
+		keys = append(keys, node.Key)
+	}
+	return keys
+}
+
+func TestTrace(t *testing.T) {
+	defs := newTraceTestModels()
+	src := newTraceTestSource()
+
+	g, err := Trace(context.Background(), src, defs, "order", 42, Options{Depth: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Order:42", "User:7", "LineItem:1", "LineItem:2"}, nodeKeys(g))
+	assert.Equal(t, []Edge{
+		{From: "Order:42", To: "User:7", Field: "user_id"},
+		{From: "LineItem:1", To: "Order:42", Field: "order_id"},
+		{From: "LineItem:2", To: "Order:42", Field: "order_id"},
+	}, g.Edges)
+
+	g, err = Trace(context.Background(), src, defs, "Order", 42, Options{Depth: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Order:42", "User:7", "LineItem:1", "LineItem:2", "Order:43", "LineItem:3"}, nodeKeys(g))
+	assert.Equal(t, 3, g.Nodes[5].Depth)
+	assert.Contains(t, g.Edges, Edge{From: "Order:43", To: "User:7", Field: "user_id"})
+
+	g, err = Trace(context.Background(), src, defs, "Order", 42, Options{Depth: 1, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Order:42", "User:7", "LineItem:1"}, nodeKeys(g))
+	assert.Equal(t, []string{"LineItem.order_id at depth 1"}, g.Truncated)
+}
+
+func TestTrace_Errors(t *testing.T) {
+	defs := newTraceTestModels()
+	src := newTraceTestSource()
+
+	_, err := Trace(context.Background(), src, defs, "Order", 99, Options{Depth: 1})
+	assert.EqualError(t, err, "Order 99 not found")
+	_, err = Trace(context.Background(), src, defs, "Invoice", 1, Options{Depth: 1})
+	assert.EqualError(t, err, "model Invoice not found")
+
+	defs[0].Fields[1].References = "Product"
+	_, err = Trace(context.Background(), src, defs, "Order", 42, Options{Depth: 1})
+	assert.EqualError(t, err, "LineItem.sku references unknown model Product")
+}
+
+func TestGraph_DOT(t *testing.T) {
+	g := &Graph{
+		Nodes: []*Node{
+			{Key: "Order:42", Model: "Order", ID: 42, Fields: Row{"id": int64(42), "note": `say "hi"`}},
+			{Key: "User:7", Model: "User", ID: 7, Fields: Row{"id": int64(7)}},
+		},
+		Edges: []Edge{{From: "Order:42", To: "User:7", Field: "user_id"}},
+	}
+	assert.Equal(t, `digraph trace {
+  rankdir=LR;
+  node [shape=box, fontname="monospace"];
+  "Order:42" [label="Order 42\lnote: say \"hi\"\l", style=bold];
+  "User:7" [label="User 7\l"];
+  "Order:42" -> "User:7" [label="user_id"];
+}
+`, g.DOT())
+}
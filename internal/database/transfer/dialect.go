@@ -0,0 +1,234 @@
+package transfer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// Dialect generates the SQL of a database engine and converts normalized values to the types it stores.
+type Dialect interface {
+	// CreateTable returns the statements creating the table of a model and its indexes.
+	CreateTable(def *model.ModelDefinition) []string
+	// FinishTable returns the statements completing the table of a model once its rows are copied.
+	FinishTable(def *model.ModelDefinition) []string
+	// Convert converts a normalized value read from a column to the value stored by the engine.
+	Convert(column model.StoredColumn, value interface{}) (interface{}, error)
+	// Literal renders a converted value as a SQL literal.
+	Literal(value interface{}) string
+	// Placeholder returns the placeholder of the nth statement argument, starting at 1.
+	Placeholder(n int) string
+	// QuoteIdentifier quotes a table or column name.
+	QuoteIdentifier(name string) string
+}
+
+// DialectFor returns the dialect of a database driver: "postgres" or "sqlite".
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "postgres":
+		return Postgres{}, nil
+	case "sqlite", "sqlite3":
+		return SQLite{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported driver %q (expected postgres or sqlite)", driver)
+	}
+}
+
+// Postgres is the dialect of Postgres databases. Tables are created by the model's migration, without its
+// row-level security policies: they would reject the copied rows, so they are created once the rows are in.
+type Postgres struct{}
+
+// CreateTable implements Dialect.
+func (Postgres) CreateTable(def *model.ModelDefinition) []string {
+	withoutPolicies := *def
+	withoutPolicies.Options.Policies = nil
+	return statements((&model.ModelManager{}).GenerateMigration(&withoutPolicies))
+}
+
+// FinishTable implements Dialect. The sequence of the id column is moved past the copied IDs.
+func (d Postgres) FinishTable(def *model.ModelDefinition) []string {
+	table := model.TableName(def)
+	return append([]string{fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s",
+		pq.QuoteLiteral(table), d.QuoteIdentifier(table))}, statements(model.GeneratePolicies(def))...)
+}
+
+// statements splits a script generated for a model into its statements.
+func statements(script string) []string {
+	var result []string
+	for _, statement := range strings.Split(script, ";\n") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			result = append(result, statement)
+		}
+	}
+	return result
+}
+
+// Convert implements Dialect. Normalized values are stored as they are.
+func (Postgres) Convert(column model.StoredColumn, value interface{}) (interface{}, error) {
+	return value, nil
+}
+
+// Literal implements Dialect.
+func (Postgres) Literal(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return `'\x` + hex.EncodeToString(v) + `'`
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return literal(value, pq.QuoteLiteral)
+	}
+}
+
+// Placeholder implements Dialect.
+func (Postgres) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// QuoteIdentifier implements Dialect.
+func (Postgres) QuoteIdentifier(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+// SQLite is the dialect of SQLite databases. SQLite has no boolean, time, or array types: booleans are stored
+// as 0 or 1, times as RFC 3339 text in UTC, and arrays and vectors as JSON arrays.
+type SQLite struct{}
+
+// CreateTable implements Dialect.
+func (d SQLite) CreateTable(def *model.ModelDefinition) []string {
+	table := model.TableName(def)
+	var columns, indexes []string
+	for _, column := range model.StoredColumns(def) {
+		if column.Name == "id" {
+			columns = append(columns, "  id INTEGER PRIMARY KEY")
+			continue
+		}
+		definition := fmt.Sprintf("  %s %s", d.QuoteIdentifier(column.Name), sqliteType(column.Type))
+		nullable := strings.HasPrefix(column.Type, "*")
+		if column.Field != nil {
+			nullable = nullable || column.Field.IsNull
+			if column.Field.IsPrimary {
+				definition += " UNIQUE"
+			}
+			if column.Field.Indexed {
+				indexes = append(indexes, fmt.Sprintf("CREATE INDEX %s ON %s (%s)",
+					d.QuoteIdentifier(table+"_"+column.Name+"_idx"), d.QuoteIdentifier(table), d.QuoteIdentifier(column.Name)))
+			}
+		}
+		if !nullable {
+			definition += " NOT NULL"
+		}
+		columns = append(columns, definition)
+	}
+	create := fmt.Sprintf("CREATE TABLE %s (\n%s\n)", d.QuoteIdentifier(table), strings.Join(columns, ",\n"))
+	return append([]string{create}, indexes...)
+}
+
+// FinishTable implements Dialect. SQLite needs no finishing: new rows get IDs past the largest one.
+func (SQLite) FinishTable(def *model.ModelDefinition) []string {
+	return nil
+}
+
+// sqliteType returns the SQLite column type storing values of a field type.
+func sqliteType(fieldType string) string {
+	fieldType = strings.TrimPrefix(fieldType, "*")
+	switch {
+	case fieldType == "[]byte":
+		return "BLOB"
+	case fieldType == "bool", strings.HasPrefix(fieldType, "int"), strings.HasPrefix(fieldType, "uint"):
+		return "INTEGER"
+	case strings.HasPrefix(fieldType, "float"):
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// Convert implements Dialect.
+func (SQLite) Convert(column model.StoredColumn, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case string:
+		fieldType := strings.TrimPrefix(column.Type, "*")
+		if strings.HasPrefix(fieldType, "[]") && fieldType != "[]byte" {
+			return arrayToJSON(fieldType, v)
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+// arrayToJSON converts the Postgres text form of an array, e.g. {a,"b c"}, to a JSON array.
+func arrayToJSON(fieldType, value string) (string, error) {
+	var array interface{ Scan(interface{}) error }
+	switch elem := strings.TrimPrefix(fieldType, "[]"); {
+	case elem == "bool":
+		array = &pq.BoolArray{}
+	case strings.HasPrefix(elem, "int"), strings.HasPrefix(elem, "uint"):
+		array = &pq.Int64Array{}
+	case strings.HasPrefix(elem, "float"):
+		array = &pq.Float64Array{}
+	default:
+		array = &pq.StringArray{}
+	}
+	if err := array.Scan([]byte(value)); err != nil {
+		return "", fmt.Errorf("invalid array %q: %w", value, err)
+	}
+	data, err := json.Marshal(array)
+	return string(data), err
+}
+
+// Literal implements Dialect.
+func (SQLite) Literal(value interface{}) string {
+	if v, ok := value.([]byte); ok {
+		return "X'" + hex.EncodeToString(v) + "'"
+	}
+	return literal(value, func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	})
+}
+
+// Placeholder implements Dialect.
+func (SQLite) Placeholder(n int) string {
+	return "?"
+}
+
+// QuoteIdentifier implements Dialect.
+func (SQLite) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// literal renders the values shared by both dialects, quoting strings with quote.
+func literal(value interface{}, quote func(string) string) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return quote(v.UTC().Format(time.RFC3339Nano))
+	case string:
+		return quote(v)
+	default:
+		return quote(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,273 @@
+// Package transfer copies the tables of models, schema and data, from a Postgres database to another database,
+// possibly of another engine, converting values to the types of the target.
+package transfer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// Target is a database tables are copied to.
+type Target interface {
+	// CreateTable creates the table of a model.
+	CreateTable(ctx context.Context, def *model.ModelDefinition) error
+	// Insert inserts a batch of rows, holding the values of columns, into the table of a model.
+	Insert(ctx context.Context, def *model.ModelDefinition, columns []model.StoredColumn, rows [][]interface{}) error
+	// FinishTable completes the table of a model once its rows are copied.
+	FinishTable(ctx context.Context, def *model.ModelDefinition) error
+}
+
+// Transfer copies the tables of models from a Postgres source to a target. Rows are read in batches ordered by
+// ID, and every batch is inserted on its own.
+type Transfer struct {
+	Source    *sql.DB
+	Target    Target
+	BatchSize int
+	// IDs, if set, restricts the rows copied to those with the listed IDs, by table. No rows are copied from
+	// tables without IDs.
+	IDs map[string][]int64
+	// OnProgress, if set, is called after every batch with the number of rows of the table copied so far.
+	OnProgress func(table string, copied int)
+}
+
+// Run creates the table of every model in the target and copies its rows. It returns the number of rows copied
+// by table.
+func (t *Transfer) Run(ctx context.Context, defs []*model.ModelDefinition) (map[string]int, error) {
+	if t.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive, got %d", t.BatchSize)
+	}
+	copied := make(map[string]int, len(defs))
+	for _, def := range defs {
+		table := model.TableName(def)
+		if err := t.Target.CreateTable(ctx, def); err != nil {
+			return copied, fmt.Errorf("failed to create table %s: %w", table, err)
+		}
+		n, err := t.copyTable(ctx, def)
+		copied[table] = n
+		if err != nil {
+			return copied, fmt.Errorf("failed to copy table %s: %w", table, err)
+		}
+		if err := t.Target.FinishTable(ctx, def); err != nil {
+			return copied, fmt.Errorf("failed to finish table %s: %w", table, err)
+		}
+	}
+	return copied, nil
+}
+
+func (t *Transfer) copyTable(ctx context.Context, def *model.ModelDefinition) (int, error) {
+	columns := model.StoredColumns(def)
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = pq.QuoteIdentifier(column.Name)
+	}
+	filter, args := "", []interface{}{}
+	if t.IDs != nil {
+		filter, args = " AND id = ANY($3)", []interface{}{pq.Array(t.IDs[model.TableName(def)])}
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id > $1%s ORDER BY id LIMIT $2",
+		strings.Join(names, ", "), pq.QuoteIdentifier(model.TableName(def)), filter)
+
+	var afterID int64
+	copied := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+		rows, lastID, err := readBatch(ctx, t.Source, query, columns, append([]interface{}{afterID, t.BatchSize}, args...))
+		if err != nil {
+			return copied, err
+		}
+		if len(rows) == 0 {
+			return copied, nil
+		}
+		if err := t.Target.Insert(ctx, def, columns, rows); err != nil {
+			return copied, err
+		}
+		copied += len(rows)
+		afterID = lastID
+		if t.OnProgress != nil {
+			t.OnProgress(model.TableName(def), copied)
+		}
+	}
+}
+
+// readBatch reads the rows selected by query, whose first arguments are the ID the rows follow and the size of
+// the batch, and returns them with the ID of the last one. Values are normalized, see normalize.
+func readBatch(ctx context.Context, db *sql.DB, query string, columns []model.StoredColumn, args []interface{}) ([][]interface{}, int64, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var batch [][]interface{}
+	var lastID int64
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, 0, err
+		}
+		for i, column := range columns {
+			values[i] = normalize(column, values[i])
+		}
+		id, ok := values[0].(int64)
+		if !ok {
+			return nil, 0, fmt.Errorf("unexpected id %v", values[0])
+		}
+		lastID = id
+		batch = append(batch, values)
+	}
+	return batch, lastID, rows.Err()
+}
+
+// normalize converts a value scanned from Postgres to nil, bool, int64, float64, string, time.Time, or []byte
+// for BYTEA columns. Arrays and vectors are kept in their Postgres text form.
+func normalize(column model.StoredColumn, value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		if strings.TrimPrefix(column.Type, "*") == "[]byte" {
+			return v
+		}
+		return string(v)
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// DBTarget is a Target writing to a database through database/sql.
+type DBTarget struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewDBTarget creates a target writing to db, whose engine the dialect generates SQL for.
+func NewDBTarget(db *sql.DB, dialect Dialect) *DBTarget {
+	return &DBTarget{db: db, dialect: dialect}
+}
+
+// CreateTable implements Target.
+func (t *DBTarget) CreateTable(ctx context.Context, def *model.ModelDefinition) error {
+	return t.exec(ctx, t.dialect.CreateTable(def))
+}
+
+// FinishTable implements Target.
+func (t *DBTarget) FinishTable(ctx context.Context, def *model.ModelDefinition) error {
+	return t.exec(ctx, t.dialect.FinishTable(def))
+}
+
+func (t *DBTarget) exec(ctx context.Context, statements []string) error {
+	for _, statement := range statements {
+		if _, err := t.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert implements Target. The rows of a batch are inserted in one transaction.
+func (t *DBTarget) Insert(ctx context.Context, def *model.ModelDefinition, columns []model.StoredColumn, rows [][]interface{}) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = t.dialect.QuoteIdentifier(column.Name)
+		placeholders[i] = t.dialect.Placeholder(i + 1)
+	}
+	statement, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		t.dialect.QuoteIdentifier(model.TableName(def)), strings.Join(names, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, row := range rows {
+		args := make([]interface{}, len(row))
+		for i, value := range row {
+			if args[i], err = t.dialect.Convert(columns[i], value); err != nil {
+				return err
+			}
+		}
+		if _, err := statement.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ScriptTarget is a Target writing SQL statements, e.g. to a file or to the stdin of a database shell.
+type ScriptTarget struct {
+	w       io.Writer
+	dialect Dialect
+}
+
+// NewScriptTarget creates a target writing the statements of the dialect to w.
+func NewScriptTarget(w io.Writer, dialect Dialect) *ScriptTarget {
+	return &ScriptTarget{w: w, dialect: dialect}
+}
+
+// CreateTable implements Target.
+func (t *ScriptTarget) CreateTable(ctx context.Context, def *model.ModelDefinition) error {
+	return t.write(t.dialect.CreateTable(def))
+}
+
+// FinishTable implements Target.
+func (t *ScriptTarget) FinishTable(ctx context.Context, def *model.ModelDefinition) error {
+	return t.write(t.dialect.FinishTable(def))
+}
+
+func (t *ScriptTarget) write(statements []string) error {
+	for _, statement := range statements {
+		if _, err := fmt.Fprintf(t.w, "%s;\n", statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert implements Target. Every batch is wrapped in a transaction.
+func (t *ScriptTarget) Insert(ctx context.Context, def *model.ModelDefinition, columns []model.StoredColumn, rows [][]interface{}) error {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = t.dialect.QuoteIdentifier(column.Name)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES (", t.dialect.QuoteIdentifier(model.TableName(def)), strings.Join(names, ", "))
+
+	var b strings.Builder
+	b.WriteString("BEGIN;\n")
+	for _, row := range rows {
+		literals := make([]string, len(row))
+		for i, value := range row {
+			converted, err := t.dialect.Convert(columns[i], value)
+			if err != nil {
+				return err
+			}
+			literals[i] = t.dialect.Literal(converted)
+		}
+		b.WriteString(prefix + strings.Join(literals, ", ") + ");\n")
+	}
+	b.WriteString("COMMIT;\n")
+	_, err := t.w.Write([]byte(b.String()))
+	return err
+}
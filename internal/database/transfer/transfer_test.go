@@ -0,0 +1,119 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func newTransferTestModel() *model.ModelDefinition {
+	def := model.NewModelDefinition("Post", []model.Field{
+		model.NewField("Title", "string", "", false, false),
+		model.NewField("Published", "bool", "", false, false),
+		model.NewField("Tags", "[]string", "", false, false),
+		model.NewField("Body", "[]byte", "", true, false),
+		model.NewField("Score", "float64", "", true, false),
+	})
+	def.IndexField("title")
+	return def
+}
+
+// newTransferTestRow returns a row of newTransferTestModel as normalized by readBatch.
+func newTransferTestRow(id int64) []interface{} {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []interface{}{id, created, created, "it's " + string(rune('a'+id)), id%2 == 0, `{go,"sql lite"}`, []byte{0xca, 0xfe}, nil}
+}
+
+func TestSQLiteCreateTable(t *testing.T) {
+	assert.Equal(t, []string{
+		`CREATE TABLE "posts" (
+  id INTEGER PRIMARY KEY,
+  "created_at" TEXT NOT NULL,
+  "updated_at" TEXT NOT NULL,
+  "title" TEXT NOT NULL,
+  "published" INTEGER NOT NULL,
+  "tags" TEXT NOT NULL,
+  "body" BLOB,
+  "score" REAL
+)`,
+		`CREATE INDEX "posts_title_idx" ON "posts" ("title")`,
+	}, SQLite{}.CreateTable(newTransferTestModel()))
+}
+
+func TestSQLiteConvert(t *testing.T) {
+	columns := model.StoredColumns(newTransferTestModel())
+	row := newTransferTestRow(2)
+
+	converted := make([]interface{}, len(row))
+	for i, value := range row {
+		var err error
+		converted[i], err = SQLite{}.Convert(columns[i], value)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []interface{}{int64(2), "2024-05-01T12:00:00Z", "2024-05-01T12:00:00Z", "it's c", int64(1),
+		`["go","sql lite"]`, []byte{0xca, 0xfe}, nil}, converted)
+
+	_, err := SQLite{}.Convert(columns[5], "{unterminated")
+	assert.Error(t, err)
+}
+
+func TestPostgresDialect(t *testing.T) {
+	def := newTransferTestModel()
+	policy, err := model.NewPolicy(def, model.PolicyTenant, "title", "")
+	assert.NoError(t, err)
+	model.AddPolicy(def, policy)
+
+	create := Postgres{}.CreateTable(def)
+	assert.True(t, strings.HasPrefix(create[0], "CREATE TABLE posts ("))
+	assert.NotContains(t, strings.Join(create, "\n"), "POLICY")
+
+	finish := Postgres{}.FinishTable(def)
+	assert.Equal(t, "SELECT setval(pg_get_serial_sequence('posts', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM \"posts\"", finish[0])
+	assert.Contains(t, strings.Join(finish, "\n"), "CREATE POLICY posts_tenant_isolation")
+
+	assert.Equal(t, `'\xcafe'`, Postgres{}.Literal([]byte{0xca, 0xfe}))
+	assert.Equal(t, "'it''s'", Postgres{}.Literal("it's"))
+	assert.Equal(t, "TRUE", Postgres{}.Literal(true))
+}
+
+// TestScriptTarget_SQLite loads a script written for SQLite into the sqlite3 shell.
+func TestScriptTarget_SQLite(t *testing.T) {
+	sqlite, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 shell not available")
+	}
+
+	def := newTransferTestModel()
+	columns := model.StoredColumns(def)
+	var script bytes.Buffer
+	target := NewScriptTarget(&script, SQLite{})
+	ctx := context.Background()
+	assert.NoError(t, target.CreateTable(ctx, def))
+	assert.NoError(t, target.Insert(ctx, def, columns, [][]interface{}{newTransferTestRow(1), newTransferTestRow(2)}))
+	assert.NoError(t, target.Insert(ctx, def, columns, [][]interface{}{newTransferTestRow(3)}))
+	assert.NoError(t, target.FinishTable(ctx, def))
+	script.WriteString("SELECT count(*), sum(published), max(title), hex(max(body)), max(tags) FROM posts;\n")
+
+	shell := exec.Command(sqlite, "-bail", ":memory:")
+	shell.Stdin = &script
+	output, err := shell.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	assert.Equal(t, `3|1|it's d|CAFE|["go","sql lite"]`+"\n", string(output))
+}
+
+func TestDialectFor(t *testing.T) {
+	for driver, expected := range map[string]Dialect{"postgres": Postgres{}, "sqlite": SQLite{}, "sqlite3": SQLite{}} {
+		dialect, err := DialectFor(driver)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, dialect)
+	}
+	_, err := DialectFor("mysql")
+	assert.Error(t, err)
+}
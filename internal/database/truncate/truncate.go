@@ -0,0 +1,148 @@
+// Package truncate empties the tables of models in a Postgres database, together with the tables referencing
+// them through foreign keys.
+package truncate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ForeignKey is a foreign key of a table referencing another table.
+type ForeignKey struct {
+	Table      string
+	References string
+}
+
+// Catalog lists the tables of the public schema and the foreign keys between them.
+type Catalog struct {
+	Tables map[string]bool
+	Keys   []ForeignKey
+}
+
+// LoadCatalog reads the tables of the public schema of db and their foreign keys.
+func LoadCatalog(ctx context.Context, db *sql.DB) (*Catalog, error) {
+	catalog := &Catalog{Tables: make(map[string]bool)}
+	rows, err := db.QueryContext(ctx, "SELECT tablename FROM pg_tables WHERE schemaname = 'public'")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		catalog.Tables[table] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys, err := db.QueryContext(ctx, `SELECT t.relname, r.relname FROM pg_constraint c
+JOIN pg_class t ON t.oid = c.conrelid
+JOIN pg_class r ON r.oid = c.confrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+WHERE c.contype = 'f' AND n.nspname = 'public'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	defer keys.Close()
+	for keys.Next() {
+		var key ForeignKey
+		if err := keys.Scan(&key.Table, &key.References); err != nil {
+			return nil, err
+		}
+		catalog.Keys = append(catalog.Keys, key)
+	}
+	return catalog, keys.Err()
+}
+
+// Plan returns the tables to truncate to empty the given ones, ordered so that every table comes before the
+// tables it references. Tables referencing a given table through a foreign key must be emptied with it: with
+// cascade they are added, recursively, and otherwise Plan fails naming them. Tables in a cycle of foreign
+// keys are ordered by name.
+func Plan(catalog *Catalog, tables []string, cascade bool) ([]string, error) {
+	selected := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		if !catalog.Tables[table] {
+			return nil, fmt.Errorf("table %s does not exist", table)
+		}
+		selected[table] = true
+	}
+
+	referencing := make(map[string][]string)
+	for _, key := range catalog.Keys {
+		if key.Table != key.References {
+			referencing[key.References] = append(referencing[key.References], key.Table)
+		}
+	}
+	for queue := append([]string(nil), tables...); len(queue) > 0; queue = queue[1:] {
+		for _, table := range referencing[queue[0]] {
+			if selected[table] {
+				continue
+			}
+			if !cascade {
+				return nil, fmt.Errorf("table %s references %s; truncate it too or pass --cascade", table, queue[0])
+			}
+			selected[table] = true
+			queue = append(queue, table)
+		}
+	}
+
+	// Repeatedly take the tables no other remaining table references, breaking cycles by name.
+	var ordered []string
+	for len(selected) > 0 {
+		referenced := make(map[string]bool)
+		for _, key := range catalog.Keys {
+			if key.Table != key.References && selected[key.Table] && selected[key.References] {
+				referenced[key.References] = true
+			}
+		}
+		remaining := make([]string, 0, len(selected))
+		for table := range selected {
+			remaining = append(remaining, table)
+		}
+		sort.Strings(remaining)
+		next := remaining[0]
+		for _, table := range remaining {
+			if !referenced[table] {
+				next = table
+				break
+			}
+		}
+		ordered = append(ordered, next)
+		delete(selected, next)
+	}
+	return ordered, nil
+}
+
+// SQL returns the statement truncating the tables. Postgres only truncates a referenced table together with
+// the tables referencing it, so they are truncated by a single statement. With restartIdentity the sequences
+// of their id columns start over.
+func SQL(tables []string, restartIdentity bool) string {
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = pq.QuoteIdentifier(table)
+	}
+	statement := "TRUNCATE TABLE " + strings.Join(quoted, ", ")
+	if restartIdentity {
+		statement += " RESTART IDENTITY"
+	}
+	return statement
+}
+
+// Truncate empties the tables of db, see SQL.
+func Truncate(ctx context.Context, db *sql.DB, tables []string, restartIdentity bool) error {
+	if len(tables) == 0 {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, SQL(tables, restartIdentity)); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", strings.Join(tables, ", "), err)
+	}
+	return nil
+}
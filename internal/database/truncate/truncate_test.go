@@ -0,0 +1,48 @@
+package truncate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCatalog() *Catalog {
+	return &Catalog{
+		Tables: map[string]bool{"users": true, "orders": true, "items": true, "tags": true, "a": true, "b": true},
+		Keys: []ForeignKey{
+			{Table: "orders", References: "users"},
+			{Table: "items", References: "orders"},
+			{Table: "users", References: "users"},
+			{Table: "a", References: "b"},
+			{Table: "b", References: "a"},
+		},
+	}
+}
+
+func TestPlan(t *testing.T) {
+	catalog := newTestCatalog()
+
+	tables, err := Plan(catalog, []string{"users", "items", "orders", "tags"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"items", "orders", "tags", "users"}, tables)
+
+	_, err = Plan(catalog, []string{"users"}, false)
+	assert.EqualError(t, err, "table orders references users; truncate it too or pass --cascade")
+
+	tables, err = Plan(catalog, []string{"users"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"items", "orders", "users"}, tables)
+
+	tables, err = Plan(catalog, []string{"a"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, tables, "cycles are broken by name")
+
+	_, err = Plan(catalog, []string{"posts"}, true)
+	assert.EqualError(t, err, "table posts does not exist")
+}
+
+func TestSQL(t *testing.T) {
+	assert.Equal(t, `TRUNCATE TABLE "items", "orders" RESTART IDENTITY`, SQL([]string{"items", "orders"}, true))
+	assert.Equal(t, `TRUNCATE TABLE "users"`, SQL([]string{"users"}, false))
+}
@@ -0,0 +1,240 @@
+// Package enforcement runs the policy checks an organization registers to block code generation and
+// migrations that break its rules, such as "no nullable booleans" or "money fields are decimals". Checks are
+// Go functions registered with Register, or Rego policies evaluated with the opa CLI.
+package enforcement
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// Operation is an operation policy checks run before.
+type Operation string
+
+// Operations checked by policies.
+const (
+	Generate Operation = "generate"
+	Migrate  Operation = "migrate"
+)
+
+// Migration is a pending migration, as policy checks see it before migrations are applied.
+type Migration struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase,omitempty"`
+	SQL   string `json:"sql"`
+}
+
+// Input is what policy checks are given: the operation about to run, the definitions of the models it
+// involves and, before migrations, the pending migrations.
+type Input struct {
+	Operation  Operation                `json:"operation"`
+	Models     []*model.ModelDefinition `json:"models"`
+	Migrations []Migration              `json:"migrations,omitempty"`
+}
+
+// Violation is a rule of a policy broken by the input.
+type Violation struct {
+	Policy  string `json:"policy"`
+	Model   string `json:"model,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// String formats the violation for display as "policy: Model.field: message".
+func (v Violation) String() string {
+	var subject string
+	switch {
+	case v.Model != "" && v.Field != "":
+		subject = v.Model + "." + v.Field + ": "
+	case v.Model != "":
+		subject = v.Model + ": "
+	}
+	return fmt.Sprintf("%s: %s%s", v.Policy, subject, v.Message)
+}
+
+// Error is returned by Enforce when policies block an operation.
+type Error struct {
+	Operation  Operation
+	Violations []Violation
+}
+
+// Error lists the violations, one per line.
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s blocked by %d policy violation(s):", e.Operation, len(e.Violations))
+	for _, violation := range e.Violations {
+		b.WriteString("\n  " + violation.String())
+	}
+	return b.String()
+}
+
+// Check is a policy check implemented in Go. It returns the violations of the input; their Policy is set to
+// the name the check is registered under. An error means the check could not run, and blocks the operation.
+type Check func(input Input) ([]Violation, error)
+
+var (
+	checksMu sync.RWMutex
+	checks   = map[string]Check{}
+)
+
+// Register makes a check run before every operation under the given name, replacing the check previously
+// registered under it. Programs embedding the CLI register their checks before running it.
+func Register(name string, check Check) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	checks[name] = check
+}
+
+// Options selects the Rego policies checked besides the registered checks.
+type Options struct {
+	// Rego lists the Rego files or directories of policies. They are evaluated with the opa CLI, which must
+	// be installed when any is given.
+	Rego []string
+	// Query is the Rego query returning the violations, by default DefaultQuery.
+	Query string
+}
+
+// DefaultQuery is the Rego query evaluated when none is configured: the deny rule of the grayv package.
+const DefaultQuery = "data.grayv.deny"
+
+// Enforce runs the registered checks, in name order, and the Rego policies on input. It returns an *Error
+// listing the violations if there are any, so the operation can be blocked.
+func Enforce(input Input, opts Options) error {
+	checksMu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	registered := make([]Check, len(names))
+	for i, name := range names {
+		registered[i] = checks[name]
+	}
+	checksMu.RUnlock()
+
+	var violations []Violation
+	for i, check := range registered {
+		found, err := check(input)
+		if err != nil {
+			return fmt.Errorf("policy %s failed: %w", names[i], err)
+		}
+		for _, violation := range found {
+			violation.Policy = names[i]
+			violations = append(violations, violation)
+		}
+	}
+
+	if len(opts.Rego) > 0 {
+		query := opts.Query
+		if query == "" {
+			query = DefaultQuery
+		}
+		found, err := evalRego(input, opts.Rego, query)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, found...)
+	}
+
+	if len(violations) > 0 {
+		return &Error{Operation: input.Operation, Violations: violations}
+	}
+	return nil
+}
+
+// opaEval evaluates a query against the policies at the given paths with the opa CLI and returns its JSON
+// output.
+var opaEval = func(input []byte, paths []string, query string) ([]byte, error) {
+	args := []string{"eval", "--format", "json", "--stdin-input"}
+	for _, path := range paths {
+		args = append(args, "--data", path)
+	}
+	cmd := exec.Command("opa", append(args, query)...)
+	cmd.Stdin = bytes.NewReader(input)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("opa eval: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("opa eval: %w", err)
+	}
+	return output, nil
+}
+
+// evalRego evaluates the Rego query on input and returns the violations it yields. The query evaluates to a
+// set of messages, or of objects with a msg (or message) and optionally policy, model and field keys.
+// Violations without a policy are attributed to the query.
+func evalRego(input Input, paths []string, query string) ([]Violation, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	output, err := opaEval(data, paths, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Result []struct {
+			Expressions []struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse opa output: %w", err)
+	}
+
+	var violations []Violation
+	for _, r := range result.Result {
+		for _, expression := range r.Expressions {
+			var values []json.RawMessage
+			if err := json.Unmarshal(expression.Value, &values); err != nil {
+				return nil, fmt.Errorf("%s must evaluate to a set of violations: %w", query, err)
+			}
+			for _, value := range values {
+				violation, err := regoViolation(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid violation %s from %s: %w", value, query, err)
+				}
+				if violation.Policy == "" {
+					violation.Policy = query
+				}
+				violations = append(violations, violation)
+			}
+		}
+	}
+	return violations, nil
+}
+
+// regoViolation decodes a violation yielded by a Rego policy: a message, or an object describing it.
+func regoViolation(value json.RawMessage) (Violation, error) {
+	var message string
+	if err := json.Unmarshal(value, &message); err == nil {
+		return Violation{Message: message}, nil
+	}
+	var object struct {
+		Msg     string `json:"msg"`
+		Message string `json:"message"`
+		Policy  string `json:"policy"`
+		Model   string `json:"model"`
+		Field   string `json:"field"`
+	}
+	if err := json.Unmarshal(value, &object); err != nil {
+		return Violation{}, err
+	}
+	if object.Message == "" {
+		object.Message = object.Msg
+	}
+	if object.Message == "" {
+		return Violation{}, fmt.Errorf("no msg")
+	}
+	return Violation{Policy: object.Policy, Model: object.Model, Field: object.Field, Message: object.Message}, nil
+}
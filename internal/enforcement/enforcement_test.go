@@ -0,0 +1,96 @@
+package enforcement
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// noNullableBooleans is a policy check rejecting nullable boolean fields.
+func noNullableBooleans(input Input) ([]Violation, error) {
+	var violations []Violation
+	for _, def := range input.Models {
+		for _, field := range def.Fields {
+			if field.IsNull && strings.TrimPrefix(field.Type, "*") == "bool" {
+				violations = append(violations, Violation{Model: def.Name, Field: field.Name, Message: "booleans must not be nullable"})
+			}
+		}
+	}
+	return violations, nil
+}
+
+func resetChecks(t *testing.T) {
+	t.Cleanup(func() {
+		checksMu.Lock()
+		checks = map[string]Check{}
+		checksMu.Unlock()
+	})
+}
+
+func TestEnforce_RegisteredChecks(t *testing.T) {
+	resetChecks(t)
+	Register("no-nullable-booleans", noNullableBooleans)
+
+	account := model.NewModelDefinition("Account", []model.Field{
+		model.NewField("active", "bool", "", true, false),
+		model.NewField("verified", "bool", "", false, false),
+	})
+	input := Input{Operation: Generate, Models: []*model.ModelDefinition{account}}
+
+	err := Enforce(input, Options{})
+	var enforcementErr *Error
+	assert.True(t, errors.As(err, &enforcementErr))
+	assert.Equal(t, []Violation{{Policy: "no-nullable-booleans", Model: "Account", Field: "active", Message: "booleans must not be nullable"}},
+		enforcementErr.Violations)
+	assert.Equal(t, "generate blocked by 1 policy violation(s):\n  no-nullable-booleans: Account.active: booleans must not be nullable", err.Error())
+
+	account.Fields[0].IsNull = false
+	assert.NoError(t, Enforce(input, Options{}))
+
+	Register("broken", func(Input) ([]Violation, error) { return nil, errors.New("boom") })
+	assert.EqualError(t, Enforce(input, Options{}), "policy broken failed: boom")
+}
+
+func TestEnforce_Rego(t *testing.T) {
+	resetChecks(t)
+	var gotInput Input
+	var gotPaths []string
+	var gotQuery string
+	original := opaEval
+	t.Cleanup(func() { opaEval = original })
+	opaEval = func(input []byte, paths []string, query string) ([]byte, error) {
+		assert.NoError(t, json.Unmarshal(input, &gotInput))
+		gotPaths, gotQuery = paths, query
+		return []byte(`{"result": [{"expressions": [{"value": [
+			"migration 2_drop drops a table",
+			{"msg": "money fields must be decimal", "model": "Invoice", "field": "total", "policy": "money"}
+		]}]}]}`), nil
+	}
+
+	input := Input{Operation: Migrate, Migrations: []Migration{{Name: "2_drop", Phase: "contract", SQL: "DROP TABLE t;"}}}
+	err := Enforce(input, Options{Rego: []string{"policies"}})
+	var enforcementErr *Error
+	assert.True(t, errors.As(err, &enforcementErr))
+	assert.Equal(t, []Violation{
+		{Policy: DefaultQuery, Message: "migration 2_drop drops a table"},
+		{Policy: "money", Model: "Invoice", Field: "total", Message: "money fields must be decimal"},
+	}, enforcementErr.Violations)
+	assert.Equal(t, Migrate, gotInput.Operation)
+	assert.Equal(t, input.Migrations, gotInput.Migrations)
+	assert.Equal(t, []string{"policies"}, gotPaths)
+	assert.Equal(t, DefaultQuery, gotQuery)
+
+	opaEval = func([]byte, []string, string) ([]byte, error) {
+		return []byte(`{"result": [{"expressions": [{"value": []}]}]}`), nil
+	}
+	assert.NoError(t, Enforce(input, Options{Rego: []string{"policies"}, Query: "data.org.deny"}))
+
+	opaEval = func([]byte, []string, string) ([]byte, error) {
+		return []byte(`{"result": [{"expressions": [{"value": [{"model": "Invoice"}]}]}]}`), nil
+	}
+	assert.ErrorContains(t, Enforce(input, Options{Rego: []string{"policies"}}), "no msg")
+}
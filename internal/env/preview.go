@@ -0,0 +1,379 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/lsm"
+	"github.com/ooyeku/grayv-lsm/internal/orm"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/ooyeku/grayv-lsm/pkg/logging"
+)
+
+// previewsDir is the directory, relative to the project root, holding the state of every preview environment.
+const previewsDir = ".grav/previews"
+
+// Preview describes a disposable preview environment: a dedicated database container and, optionally, a
+// running instance of a scaffolded app pointed at it.
+type Preview struct {
+	Name          string
+	Branch        string
+	ContainerName string
+	Database      config.DatabaseConfig
+	AppDir        string `json:",omitempty"`
+	AppBinary     string `json:",omitempty"`
+	AppPort       int    `json:",omitempty"`
+	AppPID        int    `json:",omitempty"`
+	CreatedAt     time.Time
+}
+
+// AppURL returns the URL the preview's app is served on, or an empty string when no app was started.
+func (p *Preview) AppURL() string {
+	if p.AppPort == 0 {
+		return ""
+	}
+	return fmt.Sprintf("http://localhost:%d", p.AppPort)
+}
+
+// DSN returns a connection string for the preview's database.
+func (p *Preview) DSN() string {
+	return p.dsn(p.Database.Password)
+}
+
+// RedactedDSN returns the connection string with the password masked, for display and logs.
+func (p *Preview) RedactedDSN() string {
+	return p.dsn("****")
+}
+
+func (p *Preview) dsn(password string) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
+		p.Database.User, password, p.Database.Host, p.Database.Port, p.Database.Name, p.Database.SSLMode)
+}
+
+// previewDatabase is the part of lsm.DBLifecycleManager used to manage a preview's database container.
+type previewDatabase interface {
+	EnsureImage() error
+	StartContainer() error
+	StopContainer() error
+	RemoveContainer() error
+}
+
+// newPreviewDatabase returns the container manager for a preview's database. It is a variable so tests can
+// substitute a fake.
+var newPreviewDatabase = func(cfg *config.Config) previewDatabase {
+	return lsm.NewDBLifecycleManager(cfg)
+}
+
+// processCommand returns the command line of a running process. It is a variable so tests can substitute a fake.
+var processCommand = func(pid int) (string, error) {
+	output, err := exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// PreviewManager provisions and tears down preview environments. The state of every preview is stored under
+// .grav/previews/<name> so that a later invocation can destroy it.
+type PreviewManager struct {
+	config *config.Config
+	fsys   filesystem.FS
+	logger *logging.ColorfulLogger
+}
+
+// NewPreviewManager creates a new PreviewManager that derives preview databases from the given configuration
+// and stores preview state in the current working directory.
+func NewPreviewManager(cfg *config.Config) *PreviewManager {
+	return &PreviewManager{
+		config: cfg,
+		fsys:   filesystem.NewOSFS(""),
+		logger: logging.NewColorfulLogger(),
+	}
+}
+
+// Create provisions a preview environment for the given branch. It starts a database container on a free port,
+// waits until the database accepts connections, runs provision against it (typically migrations and seeds), and,
+// when appDir is not empty, builds the app in appDir and starts it on another free port.
+// If any step fails, everything created so far is torn down again.
+func (pm *PreviewManager) Create(branch, appDir string, provision func(conn *orm.Connection) error) (*Preview, error) {
+	name := previewName(branch)
+	if _, err := pm.load(name); err == nil {
+		return nil, fmt.Errorf("preview %s already exists", name)
+	}
+
+	dbPort, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a free port for the database: %w", err)
+	}
+
+	preview := &Preview{
+		Name:          name,
+		Branch:        branch,
+		ContainerName: "grayv-preview-" + name,
+		Database:      pm.config.Database,
+		CreatedAt:     time.Now().UTC(),
+	}
+	preview.Database.Host = "localhost"
+	preview.Database.Port = dbPort
+	preview.Database.ContainerName = preview.ContainerName
+
+	if err := pm.fsys.MkdirAll(pm.dir(name), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create preview directory: %w", err)
+	}
+	if err := pm.save(preview); err != nil {
+		return nil, err
+	}
+
+	if err := pm.provision(preview, appDir, provision); err != nil {
+		if destroyErr := pm.Destroy(name); destroyErr != nil {
+			pm.logger.WithError(destroyErr).Error("failed to clean up preview after error")
+		}
+		return nil, err
+	}
+
+	return preview, pm.save(preview)
+}
+
+// provision starts the database and app of a freshly recorded preview.
+func (pm *PreviewManager) provision(preview *Preview, appDir string, provision func(conn *orm.Connection) error) error {
+	dbManager := pm.dbManager(preview)
+	if err := dbManager.EnsureImage(); err != nil {
+		return fmt.Errorf("failed to build database image: %w", err)
+	}
+	if err := dbManager.StartContainer(); err != nil {
+		return fmt.Errorf("failed to start preview database: %w", err)
+	}
+
+	conn, err := waitForDatabase(&preview.Database, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if provision != nil {
+		if err := provision(conn); err != nil {
+			return fmt.Errorf("failed to provision preview database: %w", err)
+		}
+	}
+
+	if appDir == "" {
+		return nil
+	}
+	return pm.startApp(preview, appDir)
+}
+
+// startApp builds the app in appDir into the preview directory and starts it in the background on a free port,
+// with the preview database passed through the DB_* environment variables.
+func (pm *PreviewManager) startApp(preview *Preview, appDir string) error {
+	appPort, err := freePort()
+	if err != nil {
+		return fmt.Errorf("failed to find a free port for the app: %w", err)
+	}
+
+	dir, err := filepath.Abs(filepath.FromSlash(pm.dir(preview.Name)))
+	if err != nil {
+		return fmt.Errorf("failed to resolve preview directory: %w", err)
+	}
+	binary := filepath.Join(dir, "app")
+
+	build := exec.Command("go", "build", "-o", binary, "./cmd")
+	build.Dir = appDir
+	if output, err := build.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to build app: %w\n%s", err, output)
+	}
+
+	logFile, err := os.Create(filepath.Join(dir, "app.log"))
+	if err != nil {
+		return fmt.Errorf("failed to create app log: %w", err)
+	}
+	defer logFile.Close()
+
+	app := exec.Command(binary)
+	app.Dir = appDir
+	app.Stdout = logFile
+	app.Stderr = logFile
+	app.Env = append(os.Environ(),
+		"PORT="+strconv.Itoa(appPort),
+		"DB_HOST="+preview.Database.Host,
+		"DB_PORT="+strconv.Itoa(preview.Database.Port),
+		"DB_USER="+preview.Database.User,
+		"DB_PASSWORD="+preview.Database.Password,
+		"DB_NAME="+preview.Database.Name,
+		"DB_SSLMODE="+preview.Database.SSLMode,
+	)
+	if err := app.Start(); err != nil {
+		return fmt.Errorf("failed to start app: %w", err)
+	}
+	// The app keeps running after the CLI exits; release it so it is not reaped with us.
+	if err := app.Process.Release(); err != nil {
+		pm.logger.WithError(err).Warn("failed to release app process")
+	}
+
+	preview.AppDir = appDir
+	preview.AppBinary = binary
+	preview.AppPort = appPort
+	preview.AppPID = app.Process.Pid
+	return nil
+}
+
+// Destroy stops the preview's app, removes its database container, and deletes its state. The name may be given
+// as the branch name; it is normalized the same way Create derives preview names.
+func (pm *PreviewManager) Destroy(name string) error {
+	name = previewName(name)
+	preview, err := pm.load(name)
+	if err != nil {
+		return err
+	}
+
+	if preview.AppPID != 0 {
+		pm.stopApp(preview)
+	}
+
+	dbManager := pm.dbManager(preview)
+	if err := dbManager.StopContainer(); err != nil {
+		pm.logger.WithError(err).Warn("failed to stop preview database")
+	}
+	if err := dbManager.RemoveContainer(); err != nil {
+		pm.logger.WithError(err).Warn("failed to remove preview database")
+	}
+
+	return pm.fsys.RemoveAll(pm.dir(name))
+}
+
+// stopApp kills the preview's app process. The recorded PID is only trusted while it still runs the binary the
+// preview built, so that a PID reused by an unrelated process after the app exited is left alone.
+func (pm *PreviewManager) stopApp(preview *Preview) {
+	command, err := processCommand(preview.AppPID)
+	if err != nil || preview.AppBinary == "" || !strings.HasPrefix(command, preview.AppBinary) {
+		pm.logger.Debugf("app process %d is no longer running, nothing to stop", preview.AppPID)
+		return
+	}
+
+	process, err := os.FindProcess(preview.AppPID)
+	if err != nil {
+		return
+	}
+	if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		pm.logger.WithError(err).Warnf("failed to stop app process %d", preview.AppPID)
+	}
+}
+
+// List returns every recorded preview environment.
+func (pm *PreviewManager) List() ([]*Preview, error) {
+	entries, err := pm.fsys.ReadDir(previewsDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read previews directory: %w", err)
+	}
+
+	var previews []*Preview
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		preview, err := pm.load(entry.Name())
+		if err != nil {
+			pm.logger.WithError(err).Warnf("skipping preview %s", entry.Name())
+			continue
+		}
+		previews = append(previews, preview)
+	}
+	return previews, nil
+}
+
+// dbManager returns a lifecycle manager for the preview's database container.
+func (pm *PreviewManager) dbManager(preview *Preview) previewDatabase {
+	cfg := *pm.config
+	cfg.Database = preview.Database
+	return newPreviewDatabase(&cfg)
+}
+
+func (pm *PreviewManager) dir(name string) string {
+	return path.Join(previewsDir, name)
+}
+
+func (pm *PreviewManager) save(preview *Preview) error {
+	data, err := json.MarshalIndent(preview, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal preview state: %w", err)
+	}
+	return pm.fsys.WriteFile(path.Join(pm.dir(preview.Name), "state.json"), data, 0644)
+}
+
+func (pm *PreviewManager) load(name string) (*Preview, error) {
+	data, err := pm.fsys.ReadFile(path.Join(pm.dir(name), "state.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("preview %s does not exist", name)
+		}
+		return nil, fmt.Errorf("failed to read preview state: %w", err)
+	}
+	var preview Preview
+	if err := json.Unmarshal(data, &preview); err != nil {
+		return nil, fmt.Errorf("failed to parse preview state: %w", err)
+	}
+	return &preview, nil
+}
+
+// waitForDatabase polls the database until it accepts connections or the timeout expires.
+func waitForDatabase(db *config.DatabaseConfig, timeout time.Duration) (*orm.Connection, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := orm.NewConnection(db)
+		if err == nil {
+			if err = conn.Ping(); err == nil {
+				return conn, nil
+			}
+			conn.Close()
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("database did not become ready in time: %w", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// freePort asks the kernel for an unused TCP port on the loopback interface.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+var invalidPreviewChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// previewName derives a container- and path-safe preview name from a branch name.
+func previewName(branch string) string {
+	name := invalidPreviewChars.ReplaceAllString(strings.ToLower(branch), "-")
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = "preview"
+	}
+	return name
+}
+
+// CurrentBranch returns the name of the git branch checked out in the current directory.
+func CurrentBranch() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine current git branch: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
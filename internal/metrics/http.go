@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPMetrics are the metrics of the requests served by a handler, see Instrument.
+type HTTPMetrics struct {
+	requests *Counter
+	duration *Histogram
+}
+
+// NewHTTPMetrics registers http_requests_total and http_request_duration_seconds, by method, route and status
+// code, with the given buckets, DefaultBuckets if empty.
+func NewHTTPMetrics(r *Registry, buckets []float64) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: r.Counter("http_requests_total", "HTTP requests served.", "method", "route", "code"),
+		duration: r.Histogram("http_request_duration_seconds", "Latency of the HTTP requests served.", buckets, "method", "route", "code"),
+	}
+}
+
+// Instrument wraps a handler, recording the requests it serves. route names the route of a request, e.g.
+// the pattern of the http.ServeMux serving it, so that paths holding IDs do not make a series each.
+func (m *HTTPMetrics) Instrument(handler http.Handler, route func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rw, r)
+		values := []string{r.Method, route(r), strconv.Itoa(rw.status)}
+		m.requests.Inc(values...)
+		m.duration.ObserveDuration(time.Since(start), values...)
+	})
+}
+
+// statusWriter records the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
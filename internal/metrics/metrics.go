@@ -0,0 +1,322 @@
+// Package metrics collects counters, histograms and gauges, and exposes them in the text format scraped by
+// Prometheus: served by a Registry's Handler, or pushed to a Pushgateway by short-lived commands with Push.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of histograms of durations, from 5ms to 10s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is a metric family of a Registry.
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry holds the metrics of a process.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register adds a metric, panicking if the name is taken, as registering twice is a programming error.
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+// WriteTo writes the metrics in the Prometheus text format, by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]metric, len(names))
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		m.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// Handler serves the metrics, e.g. on /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// series holds the values of a metric by label values.
+type series struct {
+	name, help, kind string
+	labels           []string
+	mu               sync.Mutex
+	values           map[string][]string
+}
+
+func newSeries(name, help, kind string, labels []string) series {
+	return series{name: name, help: help, kind: kind, labels: labels, values: make(map[string][]string)}
+}
+
+// key returns the key of the label values, checking their number.
+func (s *series) key(values []string) string {
+	if len(values) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", s.name, len(s.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	if _, ok := s.values[key]; !ok {
+		s.values[key] = append([]string(nil), values...)
+	}
+	return key
+}
+
+// sortedKeys returns the keys of the label values seen, sorted.
+func (s *series) sortedKeys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *series) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, escapeHelp(s.help), s.name, s.kind)
+}
+
+// labelPairs formats label values, with extra name and value pairs, as {name="value",...}, or "" without labels.
+func (s *series) labelPairs(values []string, extra ...string) string {
+	var pairs []string
+	for i, label := range s.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a counter, with values by label values.
+type Counter struct {
+	series
+	counts map[string]float64
+}
+
+// Counter registers a counter with the given label names. Counter names end with _total by convention.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{series: newSeries(name, help, "counter", labels), counts: make(map[string]float64)}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds 1 to the counter of the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the counter of the label values.
+func (c *Counter) Add(v float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.key(values)] += v
+}
+
+// Value returns the counter of the label values.
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[strings.Join(values, "\xff")]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, key := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(c.values[key]), formatFloat(c.counts[key]))
+	}
+}
+
+// Histogram counts observations, such as durations in seconds, in buckets, with values by label values.
+type Histogram struct {
+	series
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+}
+
+// Histogram registers a histogram with the given bucket upper bounds, DefaultBuckets if empty, and label names.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{series: newSeries(name, help, "histogram", labels), buckets: buckets, counts: make(map[string][]uint64), sums: make(map[string]float64)}
+	r.register(name, h)
+	return h
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := h.key(values)
+	counts := h.counts[key]
+	if counts == nil {
+		// The last count is the +Inf bucket.
+		counts = make([]uint64, len(h.buckets)+1)
+		h.counts[key] = counts
+	}
+	counts[sort.SearchFloat64s(h.buckets, v)]++
+	h.sums[key] += v
+}
+
+// ObserveDuration adds a duration, in seconds, to the histogram of the label values.
+func (h *Histogram) ObserveDuration(d time.Duration, values ...string) {
+	h.Observe(d.Seconds(), values...)
+}
+
+// Count returns the number of observations of the label values.
+func (h *Histogram) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var count uint64
+	for _, n := range h.counts[strings.Join(values, "\xff")] {
+		count += n
+	}
+	return count
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, key := range h.sortedKeys() {
+		values := h.values[key]
+		var cumulative uint64
+		for i, n := range h.counts[key] {
+			cumulative += n
+			bound := math.Inf(1)
+			if i < len(h.buckets) {
+				bound = h.buckets[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(values), formatFloat(h.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(values), cumulative)
+	}
+}
+
+// funcMetric is a metric without labels whose value is read when the metrics are written.
+type funcMetric struct {
+	series
+	value func() float64
+}
+
+// GaugeFunc registers a gauge whose value is returned by fn when the metrics are written.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{series: newSeries(name, help, "gauge", nil), value: fn})
+}
+
+// CounterFunc registers a counter whose value is returned by fn when the metrics are written, for counters
+// kept by other packages.
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{series: newSeries(name, help, "counter", nil), value: fn})
+}
+
+func (m *funcMetric) write(w io.Writer) {
+	m.header(w)
+	fmt.Fprintf(w, "%s %s\n", m.name, formatFloat(m.value()))
+}
+
+// RegisterDBStats registers the gauges and counters of the connection pool of db: db_connections_open,
+// db_connections_in_use, db_connections_idle, db_connections_max_open, db_connections_wait_total and
+// db_connections_wait_seconds_total.
+func RegisterDBStats(r *Registry, db *sql.DB) {
+	stat := func(fn func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(db.Stats()) }
+	}
+	r.GaugeFunc("db_connections_open", "Open connections to the database.", stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	r.GaugeFunc("db_connections_in_use", "Connections to the database in use.", stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	r.GaugeFunc("db_connections_idle", "Idle connections to the database.", stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	r.GaugeFunc("db_connections_max_open", "Maximum number of open connections to the database, 0 for unlimited.", stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	r.CounterFunc("db_connections_wait_total", "Connections waited for.", stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	r.CounterFunc("db_connections_wait_seconds_total", "Time spent waiting for connections.", stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+}
+
+// Push replaces the metrics of a job on a Prometheus Pushgateway with those of r, for commands that exit
+// before they could be scraped. The grouping labels, in name and value pairs, distinguish the pushes of a job.
+func Push(ctx context.Context, gateway, job string, r *Registry, grouping ...string) error {
+	path := "/metrics/job/" + url.PathEscape(job)
+	for i := 0; i+1 < len(grouping); i += 2 {
+		path += "/" + url.PathEscape(grouping[i]) + "/" + url.PathEscape(grouping[i+1])
+	}
+	var body bytes.Buffer
+	r.WriteTo(&body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(gateway, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("pushing metrics to %s: %s", gateway, resp.Status)
+	}
+	return nil
+}
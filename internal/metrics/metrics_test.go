@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	runs := r.Counter("runs_total", "Runs.", "command", "status")
+	runs.Inc("migrate", "success")
+	runs.Inc("migrate", "success")
+	runs.Inc("seed", `fail"ed`)
+	duration := r.Histogram("query_duration_seconds", "Query durations.", []float64{1, 0.1}, "table")
+	duration.Observe(0.05, "users")
+	duration.ObserveDuration(500*time.Millisecond, "users")
+	duration.Observe(3, "users")
+	r.GaugeFunc("up", "Whether it is up.", func() float64 { return 1 })
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP query_duration_seconds Query durations.
+# TYPE query_duration_seconds histogram
+query_duration_seconds_bucket{table="users",le="0.1"} 1
+query_duration_seconds_bucket{table="users",le="1"} 2
+query_duration_seconds_bucket{table="users",le="+Inf"} 3
+query_duration_seconds_sum{table="users"} 3.55
+query_duration_seconds_count{table="users"} 3
+# HELP runs_total Runs.
+# TYPE runs_total counter
+runs_total{command="migrate",status="success"} 2
+runs_total{command="seed",status="fail\"ed"} 1
+# HELP up Whether it is up.
+# TYPE up gauge
+up 1
+`, b.String())
+	assert.Equal(t, float64(2), runs.Value("migrate", "success"))
+	assert.Equal(t, uint64(3), duration.Count("users"))
+
+	assert.Panics(t, func() { r.Counter("up", "Again.") })
+	assert.Panics(t, func() { runs.Inc("migrate") })
+}
+
+func TestHTTPMetrics_Instrument(t *testing.T) {
+	r := NewRegistry()
+	m := NewHTTPMetrics(r, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("GET /metrics", r.Handler())
+	handler := m.Instrument(mux, func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	assert.Equal(t, float64(2), m.requests.Value("GET", "GET /users/{id}", "200"))
+	assert.Equal(t, float64(1), m.requests.Value("GET", "", "404"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `http_request_duration_seconds_count{method="GET",route="GET /users/{id}",code="200"} 2`)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+	}))
+	defer gateway.Close()
+
+	r := NewRegistry()
+	r.Counter("runs_total", "Runs.").Inc()
+	assert.NoError(t, Push(context.Background(), gateway.URL+"/", "grayv_lsm", r, "command", "db migrate"))
+	assert.Equal(t, "PUT", method)
+	assert.Equal(t, "/metrics/job/grayv_lsm/command/db migrate", path)
+	assert.Contains(t, body, "runs_total 1\n")
+}
@@ -0,0 +1,215 @@
+package mock
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+var (
+	firstNames = []string{"Alex", "Blake", "Casey", "Dana", "Eli", "Frankie", "Gray", "Harper", "Indy", "Jordan",
+		"Kai", "Logan", "Morgan", "Noel", "Oakley", "Parker", "Quinn", "Riley", "Sam", "Taylor"}
+	lastNames = []string{"Adams", "Brooks", "Carter", "Diaz", "Evans", "Foster", "Garcia", "Hughes", "Ito", "Jensen",
+		"Kim", "Lopez", "Miller", "Nguyen", "Okafor", "Patel", "Reyes", "Silva", "Turner", "Walsh"}
+	streets = []string{"Maple", "Oak", "Pine", "Cedar", "Elm", "Birch", "Willow", "Lake", "Hill", "Park"}
+	cities  = []string{"Springfield", "Riverton", "Fairview", "Lakewood", "Greenville", "Ashford", "Milton", "Bristol"}
+	words   = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do",
+		"eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua", "enim"}
+)
+
+// epoch is the time generated times precede, so that the records generated with a seed do not depend on the
+// day they are generated.
+var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Value returns a fake value of a field, as its generated model encodes it in JSON, drawn from rng. Values
+// are of the kind of the fake hint of the field or, without one, look like what its name suggests, e.g. an
+// address for Email, and references hold the ID of one of the records of the referenced model, of which there
+// are records. Nullable fields are null one time in ten.
+func Value(rng *rand.Rand, field model.Field, records int) interface{} {
+	if (field.IsNull || strings.HasPrefix(field.Type, "*")) && rng.Intn(10) == 0 {
+		return nil
+	}
+	if field.References != "" && records > 0 {
+		return rng.Intn(records) + 1
+	}
+	kind, n := nameKind(strings.ToLower(field.Name)), 0
+	if field.Fake != "" {
+		kind, n, _ = model.ParseFakeHint(field.Fake)
+	}
+	return typedValue(rng, kind, n, strings.TrimPrefix(field.Type, "*"))
+}
+
+// typedValue returns a fake value of a Go type, of the given kind for strings, see fakeString.
+func typedValue(rng *rand.Rand, kind string, n int, goType string) interface{} {
+	if values, ok := model.EnumValues(goType); ok {
+		return values[rng.Intn(len(values))]
+	}
+	if dims, ok := model.VectorDimensions(goType); ok {
+		vector := make([]float64, dims)
+		for i := range vector {
+			vector[i] = round(rng.Float64()*2-1, 4)
+		}
+		return vector
+	}
+	switch {
+	case goType == "[]byte":
+		b := make([]byte, 12)
+		rng.Read(b)
+		return base64.StdEncoding.EncodeToString(b)
+	case strings.HasPrefix(goType, "[]"):
+		items := make([]interface{}, rng.Intn(3)+1)
+		for i := range items {
+			items[i] = typedValue(rng, kind, n, strings.TrimPrefix(goType[2:], "*"))
+		}
+		return items
+	case strings.HasPrefix(goType, "map[string]"):
+		return map[string]interface{}{words[rng.Intn(len(words))]: typedValue(rng, kind, n, goType[len("map[string]"):])}
+	}
+
+	switch goType {
+	case "string":
+		return fakeString(rng, kind, n)
+	case "bool":
+		return rng.Intn(2) == 0
+	case "time.Time":
+		return epoch.Add(-time.Duration(rng.Int63n(int64(365 * 24 * time.Hour)))).Truncate(time.Second)
+	case "float32", "float64":
+		if kind == "amount" {
+			return round(rng.Float64()*500+1, 2)
+		}
+		return round(rng.Float64()*1000, 2)
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		switch {
+		case goType == "int8" || goType == "uint8":
+			return rng.Intn(100)
+		case kind == "age":
+			return rng.Intn(62) + 18
+		case kind == "year":
+			return epoch.Year() - rng.Intn(30)
+		}
+		return rng.Intn(1000) + 1
+	}
+	return map[string]interface{}{}
+}
+
+// nameKind returns the kind of the values a field of the given lowercase name holds: one of model.FakeHints,
+// "amount", "age" or "year" for numbers, or "" if the name suggests none.
+func nameKind(name string) string {
+	switch {
+	case hasAny(name, "email"):
+		return "email"
+	case hasAny(name, "url", "website", "link", "href"):
+		return "url"
+	case hasAny(name, "phone", "mobile"):
+		return "phone"
+	case hasAny(name, "firstname", "first_name", "given"):
+		return "first_name"
+	case hasAny(name, "lastname", "last_name", "surname", "family"):
+		return "last_name"
+	case hasAny(name, "username", "login", "handle"):
+		return "username"
+	case hasAny(name, "name", "author", "owner"):
+		return "name"
+	case hasAny(name, "address", "street"):
+		return "address"
+	case hasAny(name, "city", "town"):
+		return "city"
+	case hasAny(name, "country"):
+		return "country"
+	case hasAny(name, "zip", "postal"):
+		return "zip"
+	case hasAny(name, "color", "colour"):
+		return "color"
+	case hasAny(name, "token", "secret", "hash", "uuid", "key"):
+		return "token"
+	case hasAny(name, "slug"):
+		return "slug"
+	case hasAny(name, "title", "subject", "headline", "label"):
+		return "title"
+	case hasAny(name, "description", "body", "content", "text", "bio", "summary", "comment", "note", "message"):
+		return "text"
+	case hasAny(name, "price", "amount", "total", "cost", "balance"):
+		return "amount"
+	case hasAny(name, "age"):
+		return "age"
+	case hasAny(name, "year"):
+		return "year"
+	}
+	return ""
+}
+
+// fakeString returns a string of the given kind, of which lorem takes the number of words.
+func fakeString(rng *rand.Rand, kind string, n int) string {
+	first, last := firstNames[rng.Intn(len(firstNames))], lastNames[rng.Intn(len(lastNames))]
+	switch kind {
+	case "email":
+		return fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), rng.Intn(100))
+	case "url":
+		return fmt.Sprintf("https://example.com/%s/%d", lorem(rng, 1), rng.Intn(10000))
+	case "phone":
+		return fmt.Sprintf("+1555%07d", rng.Intn(10000000))
+	case "first_name":
+		return first
+	case "last_name":
+		return last
+	case "username":
+		return fmt.Sprintf("%s%d", strings.ToLower(first), rng.Intn(1000))
+	case "name":
+		return first + " " + last
+	case "address":
+		return fmt.Sprintf("%d %s St", rng.Intn(999)+1, streets[rng.Intn(len(streets))])
+	case "city":
+		return cities[rng.Intn(len(cities))]
+	case "country":
+		return []string{"US", "GB", "DE", "FR", "JP", "BR", "IN", "NG"}[rng.Intn(8)]
+	case "zip":
+		return fmt.Sprintf("%05d", rng.Intn(100000))
+	case "color":
+		return fmt.Sprintf("#%06x", rng.Intn(1<<24))
+	case "token":
+		b := make([]byte, 16)
+		rng.Read(b)
+		return fmt.Sprintf("%x", b)
+	case "slug":
+		return strings.ReplaceAll(lorem(rng, 3), " ", "-")
+	case "title":
+		title := lorem(rng, rng.Intn(3)+2)
+		return strings.ToUpper(title[:1]) + title[1:]
+	case "text":
+		sentence := lorem(rng, rng.Intn(12)+8)
+		return strings.ToUpper(sentence[:1]) + sentence[1:] + "."
+	case "word":
+		return lorem(rng, 1)
+	case "lorem":
+		return lorem(rng, n)
+	}
+	return lorem(rng, rng.Intn(2)+1)
+}
+
+// lorem returns n words of lorem ipsum.
+func lorem(rng *rand.Rand, n int) string {
+	picked := make([]string, n)
+	for i := range picked {
+		picked[i] = words[rng.Intn(len(words))]
+	}
+	return strings.Join(picked, " ")
+}
+
+func hasAny(name string, parts ...string) bool {
+	for _, part := range parts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func round(f float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(f*scale) / scale
+}
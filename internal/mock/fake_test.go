@@ -0,0 +1,63 @@
+package mock
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func TestValue(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	email := Value(rng, model.NewField("Email", "string", "", false, false), 10)
+	assert.True(t, strings.HasSuffix(email.(string), "@example.com"), email)
+	assert.Contains(t, []string{"draft", "published"}, Value(rng, model.NewField("Status", "enum(draft,published)", "", false, false), 10))
+	assert.Len(t, Value(rng, model.NewField("Embedding", "vector(3)", "", false, false), 10), 3)
+	assert.IsType(t, time.Time{}, Value(rng, model.NewField("PublishedAt", "time.Time", "", false, false), 10))
+
+	author := model.NewField("AuthorID", "int", "", false, false)
+	author.References = "User"
+	for i := 0; i < 20; i++ {
+		id := Value(rng, author, 5).(int)
+		assert.True(t, id >= 1 && id <= 5, "reference %d out of the records", id)
+	}
+
+	nulls := 0
+	for i := 0; i < 200; i++ {
+		if Value(rng, model.NewField("Bio", "*string", "", true, false), 10) == nil {
+			nulls++
+		}
+	}
+	assert.True(t, nulls > 0 && nulls < 50, "%d nulls", nulls)
+}
+
+func TestValue_FakeHints(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	contact := model.NewField("Contact", "string", "", false, false)
+	contact.Fake = "email"
+	assert.True(t, strings.HasSuffix(Value(rng, contact, 10).(string), "@example.com"))
+
+	bio := model.NewField("Bio", "string", "", false, false)
+	bio.Fake = "lorem(50)"
+	assert.Len(t, strings.Fields(Value(rng, bio, 10).(string)), 50)
+
+	links := model.NewField("Links", "[]string", "", false, false)
+	links.Fake = "url"
+	for _, link := range Value(rng, links, 10).([]interface{}) {
+		assert.True(t, strings.HasPrefix(link.(string), "https://example.com/"), link)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, check(model.NewField("Tags", "[]string", "", false, false), []interface{}{"a", "b"}))
+	assert.EqualError(t, check(model.NewField("Tags", "[]string", "", false, false), []interface{}{"a", 1.0}), "must be a string")
+	assert.EqualError(t, check(model.NewField("Views", "int", "", false, false), 1.5), "must be an integer")
+	assert.EqualError(t, check(model.NewField("Title", "string", "", false, false), nil), "cannot be null")
+	assert.NoError(t, check(model.NewField("Bio", "*string", "", true, false), nil))
+	assert.EqualError(t, check(model.NewField("Status", "enum(draft,published)", "", false, false), "gone"), "must be one of draft, published")
+	assert.EqualError(t, check(model.NewField("At", "time.Time", "", false, false), "yesterday"), "must be an RFC 3339 time")
+}
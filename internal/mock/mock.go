@@ -0,0 +1,483 @@
+// Package mock serves fake CRUD endpoints for models, backed by records generated in memory instead of a
+// database, so that clients can be built against the API of an app before its backend is deployed. Records are
+// encoded as the generated models encode them, and lists are pages like the ListPage of the generated
+// repositories.
+package mock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// DefaultRecords is the number of records generated per model unless Options set another.
+const DefaultRecords = 20
+
+// DefaultPageSize is the size of the pages listed without a limit, and MaxPageSize the largest page listed, as
+// in the generated repositories.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Options configure a Server.
+type Options struct {
+	// Records is the number of records generated per model, DefaultRecords if 0.
+	Records int
+	// Seed seeds the generated values: the same models and seed give the same records.
+	Seed int64
+	// Latency delays every response, to show the loading states of clients.
+	Latency time.Duration
+}
+
+// Server is the http.Handler of the fake endpoints. Every model is served under the name of its table:
+//
+//	GET    /posts             a page of records: ?limit=, ?offset= or ?cursor=
+//	POST   /posts             creates a record
+//	GET    /posts/{id}        a record
+//	PUT    /posts/{id}        replaces the fields of a record
+//	PATCH  /posts/{id}        updates the given fields of a record
+//	DELETE /posts/{id}        deletes a record
+//
+// Created and updated records are kept in memory until the server stops.
+type Server struct {
+	options Options
+	mux     *http.ServeMux
+
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+// table holds the records of a model by ID.
+type table struct {
+	def     *model.ModelDefinition
+	records map[uint]map[string]interface{}
+	nextID  uint
+}
+
+// NewServer creates the fake endpoints of the given models and generates their records.
+func NewServer(defs []*model.ModelDefinition, options Options) *Server {
+	if options.Records == 0 {
+		options.Records = DefaultRecords
+	}
+	s := &Server{options: options, mux: http.NewServeMux(), tables: make(map[string]*table, len(defs))}
+	for _, t := range generate(defs, options.Records, options.Seed) {
+		s.tables[model.TableName(t.def)] = t
+	}
+
+	s.mux.HandleFunc("GET /{$}", s.index)
+	s.mux.HandleFunc("GET /{table}", s.withTable(s.list))
+	s.mux.HandleFunc("POST /{table}", s.withTable(s.create))
+	s.mux.HandleFunc("GET /{table}/{id}", s.withRecord(s.get))
+	s.mux.HandleFunc("PUT /{table}/{id}", s.withRecord(s.update(true)))
+	s.mux.HandleFunc("PATCH /{table}/{id}", s.withRecord(s.update(false)))
+	s.mux.HandleFunc("DELETE /{table}/{id}", s.withRecord(s.delete))
+	return s
+}
+
+// generate generates the records of the models, whose IDs run from 1 to records, in tables sorted by model
+// name.
+func generate(defs []*model.ModelDefinition, records int, seed int64) []*table {
+	sorted := append([]*model.ModelDefinition{}, defs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	rng := rand.New(rand.NewSource(seed))
+	tables := make([]*table, len(sorted))
+	for i, def := range sorted {
+		t := &table{def: def, records: make(map[uint]map[string]interface{})}
+		for j := 0; j < records; j++ {
+			t.nextID++
+			record := map[string]interface{}{}
+			for _, field := range fields(def) {
+				record[model.JSONFieldName(field)] = Value(rng, field, records)
+			}
+			created := epoch.Add(-time.Duration(records-j) * time.Hour)
+			t.records[t.nextID] = withBase(record, t.nextID, created, created)
+		}
+		tables[i] = t
+	}
+	return tables
+}
+
+// Tables returns the tables served, sorted.
+func (s *Server) Tables() []string {
+	tables := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// ServeHTTP serves the endpoints, letting any origin call them from browsers.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	if s.options.Latency > 0 {
+		select {
+		case <-time.After(s.options.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// fields returns the fields of a model encoded besides those of DefaultModel.
+func fields(def *model.ModelDefinition) []model.Field {
+	var own []model.Field
+	for _, column := range model.StoredColumns(def) {
+		if column.Field != nil {
+			own = append(own, *column.Field)
+		}
+	}
+	return own
+}
+
+// withBase sets the fields of DefaultModel on a record.
+func withBase(record map[string]interface{}, id uint, created, updated time.Time) map[string]interface{} {
+	record["id"] = id
+	record["created_at"] = created
+	record["updated_at"] = updated
+	record["Name"] = ""
+	return record
+}
+
+func (s *Server) withTable(handler func(w http.ResponseWriter, r *http.Request, t *table)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := s.tables[r.PathValue("table")]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no model is served at /%s", r.PathValue("table")))
+			return
+		}
+		handler(w, r, t)
+	}
+}
+
+func (s *Server) withRecord(handler func(w http.ResponseWriter, r *http.Request, t *table, id uint)) http.HandlerFunc {
+	return s.withTable(func(w http.ResponseWriter, r *http.Request, t *table) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid id %q", r.PathValue("id")))
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := t.records[uint(id)]; !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("%s %d not found", t.def.Name, id))
+			return
+		}
+		handler(w, r, t, uint(id))
+	})
+}
+
+// index lists the models served with their paths.
+func (s *Server) index(w http.ResponseWriter, r *http.Request) {
+	type entry struct {
+		Model string `json:"model"`
+		Path  string `json:"path"`
+	}
+	entries := []entry{}
+	for _, name := range s.Tables() {
+		entries = append(entries, entry{Model: s.tables[name].def.Name, Path: "/" + name})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// page is a page of records, encoded as the Page of the generated repositories.
+type page struct {
+	Items      []map[string]interface{} `json:"items"`
+	Total      int64                    `json:"total"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, t *table) {
+	limit, offset, after, err := pageBounds(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]uint, 0, len(t.records))
+	for id := range t.records {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if offset > len(ids) {
+		offset = len(ids)
+	}
+	ids = ids[offset:]
+
+	result := page{Items: []map[string]interface{}{}, Total: int64(len(t.records))}
+	for i, id := range ids {
+		if i == limit {
+			result.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(ids[i-1]), 10)))
+			break
+		}
+		result.Items = append(result.Items, t.records[id])
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// pageBounds reads the page selected by the query of a request, as a PageRequest of the generated
+// repositories selects it.
+func pageBounds(r *http.Request) (limit, offset int, after uint, err error) {
+	query := r.URL.Query()
+	for name, value := range map[string]*int{"limit": &limit, "offset": &offset} {
+		if raw := query.Get(name); raw != "" {
+			if *value, err = strconv.Atoi(raw); err != nil || *value < 0 {
+				return 0, 0, 0, fmt.Errorf("invalid page request: invalid %s %q", name, raw)
+			}
+		}
+	}
+	cursor := query.Get("cursor")
+	if cursor != "" && offset > 0 {
+		return 0, 0, 0, errors.New("invalid page request: both a cursor and an offset")
+	}
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if cursor != "" {
+		id, err := base64.RawURLEncoding.DecodeString(cursor)
+		var n uint64
+		if err == nil {
+			n, err = strconv.ParseUint(string(id), 10, 64)
+		}
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid page request: malformed cursor %q", cursor)
+		}
+		after = uint(n)
+	}
+	return limit, offset, after, nil
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request, t *table) {
+	values, ok := readRecord(w, r, t.def)
+	if !ok {
+		return
+	}
+	record := zeroRecord(t.def)
+	for name, value := range values {
+		record[name] = value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.nextID++
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	t.records[t.nextID] = withBase(record, t.nextID, now, now)
+	writeJSON(w, http.StatusCreated, t.records[t.nextID])
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, t *table, id uint) {
+	writeJSON(w, http.StatusOK, t.records[id])
+}
+
+// update returns the handler replacing every field of a record when replace is set, as PUT does, or only the
+// fields given, as PATCH does.
+func (s *Server) update(replace bool) func(w http.ResponseWriter, r *http.Request, t *table, id uint) {
+	return func(w http.ResponseWriter, r *http.Request, t *table, id uint) {
+		values, ok := readRecord(w, r, t.def)
+		if !ok {
+			return
+		}
+		record := t.records[id]
+		if replace {
+			record = withBase(zeroRecord(t.def), id, record["created_at"].(time.Time), time.Time{})
+		}
+		for name, value := range values {
+			record[name] = value
+		}
+		record["updated_at"] = time.Now().UTC().Truncate(time.Microsecond)
+		t.records[id] = record
+		writeJSON(w, http.StatusOK, record)
+	}
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, t *table, id uint) {
+	delete(t.records, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// zeroRecord returns a record holding the value every field of a model decodes to when absent from JSON.
+func zeroRecord(def *model.ModelDefinition) map[string]interface{} {
+	record := map[string]interface{}{}
+	for _, field := range fields(def) {
+		record[model.JSONFieldName(field)] = zeroValue(field)
+	}
+	return record
+}
+
+func zeroValue(field model.Field) interface{} {
+	goType := field.Type
+	if _, ok := model.EnumValues(goType); ok {
+		return ""
+	}
+	if _, ok := model.VectorDimensions(goType); ok {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(goType, "*"), strings.HasPrefix(goType, "[]"), strings.HasPrefix(goType, "map["):
+		return nil
+	case goType == "string":
+		return ""
+	case goType == "bool":
+		return false
+	case goType == "time.Time":
+		return time.Time{}
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"), strings.HasPrefix(goType, "float"):
+		return 0
+	}
+	return nil
+}
+
+// readRecord decodes the JSON object of a request body and checks its fields against the model, answering
+// 400 Bad Request if it is malformed and 422 Unprocessable Entity if a field holds an invalid value. The fields
+// of DefaultModel are ignored, as the server sets them.
+func readRecord(w http.ResponseWriter, r *http.Request, def *model.ModelDefinition) (map[string]interface{}, bool) {
+	var values map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil || values == nil {
+		writeError(w, http.StatusBadRequest, errors.New("the body must be a JSON object"))
+		return nil, false
+	}
+	byName := map[string]model.Field{}
+	for _, field := range fields(def) {
+		byName[model.JSONFieldName(field)] = field
+	}
+	record := map[string]interface{}{}
+	for name, value := range values {
+		switch name {
+		case "id", "created_at", "updated_at", "Name":
+			continue
+		}
+		field, ok := byName[name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%s has no field %s", def.Name, name))
+			return nil, false
+		}
+		if err := check(field, value); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Errorf("invalid %s: %w", name, err))
+			return nil, false
+		}
+		record[name] = value
+	}
+	return record, true
+}
+
+// check returns an error if a decoded JSON value cannot be decoded into a field of the generated model.
+func check(field model.Field, value interface{}) error {
+	if value == nil {
+		if field.IsNull || strings.HasPrefix(field.Type, "*") || strings.HasPrefix(field.Type, "[]") ||
+			strings.HasPrefix(field.Type, "map[") {
+			return nil
+		}
+		return errors.New("cannot be null")
+	}
+	return checkType(strings.TrimPrefix(field.Type, "*"), value)
+}
+
+func checkType(goType string, value interface{}) error {
+	if values, ok := model.EnumValues(goType); ok {
+		for _, v := range values {
+			if value == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+	if dims, ok := model.VectorDimensions(goType); ok {
+		items, ok := value.([]interface{})
+		if !ok || len(items) != dims {
+			return fmt.Errorf("must be an array of %d numbers", dims)
+		}
+		goType = "[]float64"
+	}
+	switch {
+	case goType == "[]byte":
+		goType = "string"
+	case strings.HasPrefix(goType, "[]"):
+		items, ok := value.([]interface{})
+		if !ok {
+			return errors.New("must be an array")
+		}
+		for _, item := range items {
+			if err := checkType(strings.TrimPrefix(goType[2:], "*"), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.HasPrefix(goType, "map[string]"):
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.New("must be an object")
+		}
+		for _, entry := range entries {
+			if err := checkType(goType[len("map[string]"):], entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch goType {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return errors.New("must be a string")
+		}
+	case "time.Time":
+		s, ok := value.(string)
+		if _, err := time.Parse(time.RFC3339Nano, s); !ok || err != nil {
+			return errors.New("must be an RFC 3339 time")
+		}
+	case "bool":
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be a boolean")
+		}
+	case "float32", "float64":
+		if _, ok := value.(float64); !ok {
+			return errors.New("must be a number")
+		}
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) || strings.HasPrefix(goType, "uint") && n < 0 {
+			return errors.New("must be an integer")
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
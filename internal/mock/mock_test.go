@@ -0,0 +1,93 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func newTestServer() *Server {
+	post := model.NewModelDefinition("Post", []model.Field{
+		model.NewField("Title", "string", "", false, false),
+		model.NewField("Views", "int", "", false, false),
+		model.NewField("Status", "enum(draft,published)", "", false, false),
+	})
+	return NewServer([]*model.ModelDefinition{post}, Options{Records: 3, Seed: 7})
+}
+
+func serve(t *testing.T, s *Server, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var decoded map[string]interface{}
+	if w.Body.Len() > 0 && strings.HasPrefix(w.Body.String(), "{") {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &decoded))
+	}
+	return w.Code, decoded
+}
+
+func TestServer_List(t *testing.T) {
+	s := newTestServer()
+	assert.Equal(t, []string{"posts"}, s.Tables())
+
+	code, page := serve(t, s, "GET", "/posts?limit=2", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3.0, page["total"])
+	require.Len(t, page["items"], 2)
+	first := page["items"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, 1.0, first["id"])
+	assert.Contains(t, first, "title")
+	assert.Contains(t, []interface{}{"draft", "published"}, first["status"])
+
+	code, next := serve(t, s, "GET", "/posts?cursor="+page["next_cursor"].(string), "")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, next["items"], 1)
+	assert.Equal(t, 3.0, next["items"].([]interface{})[0].(map[string]interface{})["id"])
+	assert.NotContains(t, next, "next_cursor")
+
+	code, _ = serve(t, s, "GET", "/posts?cursor=x&offset=1", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = serve(t, s, "GET", "/comments", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	_, again := serve(t, newTestServer(), "GET", "/posts?limit=2", "")
+	assert.Equal(t, page["items"], again["items"], "the same seed must give the same records")
+}
+
+func TestServer_CRUD(t *testing.T) {
+	s := newTestServer()
+
+	code, created := serve(t, s, "POST", "/posts", `{"title":"Hello","status":"draft","id":99}`)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, 4.0, created["id"])
+	assert.Equal(t, 0.0, created["views"])
+
+	code, body := serve(t, s, "POST", "/posts", `{"title":"Hello","status":"gone"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "invalid status: must be one of draft, published", body["error"])
+	code, body = serve(t, s, "POST", "/posts", `{"subtitle":"x"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "Post has no field subtitle", body["error"])
+
+	code, patched := serve(t, s, "PATCH", "/posts/4", `{"views":10}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Hello", patched["title"])
+	assert.Equal(t, 10.0, patched["views"])
+
+	code, replaced := serve(t, s, "PUT", "/posts/4", `{"status":"published"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "", replaced["title"])
+	assert.Equal(t, created["created_at"], replaced["created_at"])
+
+	code, _ = serve(t, s, "DELETE", "/posts/4", "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = serve(t, s, "GET", "/posts/4", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
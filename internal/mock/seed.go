@@ -0,0 +1,109 @@
+package mock
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/seed"
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// Seed is a seed file inserting the fake records of a model.
+type Seed struct {
+	Model string
+	Table string
+	SQL   string
+}
+
+// Seeds returns seeds inserting the records the mock server generates for the models with the same number of
+// records and seed, sorted by model name, so that the database of an app and its mock serve the same data.
+// Records keep their IDs, which references hold, and the id sequences are moved past them: the seeds are
+// meant for empty tables. Models with encrypted fields cannot be seeded, as their values must be encrypted.
+func Seeds(defs []*model.ModelDefinition, records int, randSeed int64) ([]Seed, error) {
+	for _, def := range defs {
+		for _, field := range fields(def) {
+			if field.Encrypted {
+				return nil, fmt.Errorf("model %s cannot be seeded: its field %s is encrypted", def.Name, field.Name)
+			}
+		}
+	}
+	tables := generate(defs, records, randSeed)
+	seeds := make([]Seed, len(tables))
+	for i, t := range tables {
+		columns := model.StoredColumns(t.def)
+		names := make([]string, len(columns))
+		for j, column := range columns {
+			names[j] = column.Name
+		}
+		ids := make([]uint, 0, len(t.records))
+		for id := range t.records {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+		rows := make([][]string, len(ids))
+		for j, id := range ids {
+			record := t.records[id]
+			rows[j] = make([]string, len(columns))
+			for k, column := range columns {
+				key := column.Name
+				if column.Field != nil {
+					key = model.JSONFieldName(*column.Field)
+				}
+				rows[j][k] = sqlText(column.Type, record[key])
+			}
+		}
+
+		table := model.TableName(t.def)
+		sql := seed.InsertSQL(table, names, rows)
+		if len(rows) > 0 {
+			sql += fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), %d);\n", table, ids[len(ids)-1])
+		}
+		seeds[i] = Seed{Model: t.def.Name, Table: table, SQL: sql}
+	}
+	return seeds, nil
+}
+
+// sqlText returns a fake value of a column of the given field type as the text PostgreSQL converts to the
+// column type, or "" for NULL.
+func sqlText(goType string, value interface{}) string {
+	goType = strings.TrimPrefix(goType, "*")
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if goType == "[]byte" {
+			b, _ := base64.StdEncoding.DecodeString(v)
+			return `\x` + hex.EncodeToString(b)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []float64:
+		items := make([]string, len(v))
+		for i, f := range v {
+			items[i] = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			text := sqlText(goType[2:], item)
+			switch item.(type) {
+			case string, time.Time:
+				text = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+			}
+			items[i] = text
+		}
+		return "{" + strings.Join(items, ",") + "}"
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,50 @@
+package mock
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func TestSeeds(t *testing.T) {
+	author := model.NewField("AuthorID", "int", "", false, false)
+	author.References = "User"
+	defs := []*model.ModelDefinition{
+		model.NewModelDefinition("Post", []model.Field{model.NewField("Title", "string", "", false, false), author}),
+		model.NewModelDefinition("User", []model.Field{model.NewField("Email", "string", "", false, false)}),
+	}
+	seeds, err := Seeds(defs, 3, 1)
+	require.NoError(t, err)
+	require.Len(t, seeds, 2)
+	assert.Equal(t, "Post", seeds[0].Model)
+	assert.Equal(t, "posts", seeds[0].Table)
+	assert.True(t, strings.HasPrefix(seeds[0].SQL, "INSERT INTO posts (id, created_at, updated_at, title, authorid) VALUES\n  ('1', "), seeds[0].SQL)
+	assert.Contains(t, seeds[0].SQL, "SELECT setval(pg_get_serial_sequence('posts', 'id'), 3);\n")
+
+	// The seeds hold the records the server serves.
+	users := NewServer(defs, Options{Records: 3, Seed: 1}).tables["users"]
+	assert.Contains(t, seeds[1].SQL, "'"+users.records[2]["email"].(string)+"'")
+
+	encrypted := model.NewModelDefinition("Patient", []model.Field{model.NewField("SSN", "string", "", false, false)})
+	require.NoError(t, encrypted.EncryptField("SSN"))
+	_, err = Seeds([]*model.ModelDefinition{encrypted}, 3, 1)
+	assert.EqualError(t, err, "model Patient cannot be seeded: its field SSN is encrypted")
+}
+
+func TestSQLText(t *testing.T) {
+	assert.Equal(t, "", sqlText("*string", nil))
+	assert.Equal(t, "hello", sqlText("string", "hello"))
+	assert.Equal(t, `\x0102`, sqlText("[]byte", "AQI="))
+	assert.Equal(t, "2024-01-01T00:00:00Z", sqlText("time.Time", epoch))
+	assert.Equal(t, "[0.5,-1]", sqlText("vector(2)", []float64{0.5, -1}))
+	assert.Equal(t, `{"a \"b\"","c\\d"}`, sqlText("[]string", []interface{}{`a "b"`, `c\d`}))
+	assert.Equal(t, "{1,2}", sqlText("[]int", []interface{}{1, 2}))
+	assert.Equal(t, `{"2024-01-01T00:00:00Z"}`, sqlText("[]time.Time", []interface{}{epoch}))
+	assert.Equal(t, `{"k":1}`, sqlText("map[string]int", map[string]interface{}{"k": 1}))
+	assert.Equal(t, "true", sqlText("bool", true))
+	assert.Equal(t, "42", sqlText("uint", uint(42)))
+}
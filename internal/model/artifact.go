@@ -0,0 +1,184 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Generators recorded in the generation manifest.
+const (
+	// GeneratorGo renders the Go model struct and its repository.
+	GeneratorGo = "go"
+	// GeneratorTypeScript renders a TypeScript declaration file.
+	GeneratorTypeScript = "typescript"
+	// GeneratorProto renders a protobuf message.
+	GeneratorProto = "proto"
+	// GeneratorGRPC renders a protobuf message, a CRUD service, and its server implementation.
+	GeneratorGRPC = "grpc"
+	// GeneratorAuth renders the JWT authentication of the users of a model.
+	GeneratorAuth = "auth"
+	// GeneratorKV renders a repository storing the records of a model in an embedded file.
+	GeneratorKV = "kv"
+)
+
+// generatorTemplates lists the templates each generator renders from. Their versions are recorded in the
+// manifest so that a template change invalidates every artifact built from it.
+var generatorTemplates = map[string][]string{
+	GeneratorGo:   {"model", "model-base", "repository"},
+	GeneratorGRPC: {"service-proto", "grpc-server", "grpc-support"},
+	GeneratorAuth: {"auth"},
+	GeneratorKV:   {"kv-repository", "kv-store"},
+}
+
+// Artifact identifies one generator run for a model together with the parameters it was run with, which is
+// everything needed to render the same files again.
+type Artifact struct {
+	Generator string            `json:"generator"`
+	Model     string            `json:"model"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+// Key returns the key the artifact is recorded under in the manifest.
+func (a Artifact) Key() string {
+	return a.Generator + "/" + a.Model
+}
+
+// GoArtifact describes the Go model and repository generated into outputDir ("models" when empty).
+func GoArtifact(modelName, outputDir string) Artifact {
+	return newArtifact(GeneratorGo, modelName, map[string]string{"output_dir": outputDir})
+}
+
+// KVArtifact describes the KV repository generated into outputDir ("models" when empty), next to the Go model
+// and repository.
+func KVArtifact(modelName, outputDir string) Artifact {
+	return newArtifact(GeneratorKV, modelName, map[string]string{"output_dir": outputDir})
+}
+
+// TypeScriptArtifact describes the TypeScript declarations generated into outputDir.
+func TypeScriptArtifact(modelName, outputDir string) Artifact {
+	return newArtifact(GeneratorTypeScript, modelName, map[string]string{"output_dir": outputDir})
+}
+
+// ProtoArtifact describes the protobuf message generated into outputDir.
+func ProtoArtifact(modelName, outputDir, protoPackage, goPackage string) Artifact {
+	return newArtifact(GeneratorProto, modelName, map[string]string{
+		"output_dir": outputDir,
+		"package":    protoPackage,
+		"go_package": goPackage,
+	})
+}
+
+// GRPCArtifact describes the gRPC scaffolding generated with the given options.
+func GRPCArtifact(modelName string, opts GRPCOptions) Artifact {
+	return newArtifact(GeneratorGRPC, modelName, map[string]string{
+		"proto_dir":  opts.ProtoDir,
+		"server_dir": opts.ServerDir,
+		"package":    opts.ProtoPackage,
+		"module":     opts.GoModule,
+	})
+}
+
+// AuthArtifact describes the authentication of the users of a model generated with the given options.
+func AuthArtifact(modelName string, opts AuthOptions) Artifact {
+	opts = opts.withDefaults()
+	params := map[string]string{
+		"output_dir":  opts.OutputDir,
+		"issuer":      opts.Issuer,
+		"secret_env":  opts.SecretEnv,
+		"access_ttl":  opts.AccessTTL.String(),
+		"refresh_ttl": opts.RefreshTTL.String(),
+	}
+	if len(opts.Permissions) > 0 {
+		// Maps are encoded with sorted keys, so that the same permissions compare equal.
+		permissions, _ := json.Marshal(opts.Permissions)
+		params["permissions"] = string(permissions)
+	}
+	return newArtifact(GeneratorAuth, modelName, params)
+}
+
+// newArtifact builds an Artifact, dropping empty parameters so that defaults compare equal.
+func newArtifact(generator, modelName string, params map[string]string) Artifact {
+	for key, value := range params {
+		if strings.TrimSpace(value) == "" {
+			delete(params, key)
+		}
+	}
+	if len(params) == 0 {
+		params = nil
+	}
+	return Artifact{Generator: generator, Model: modelName, Params: params}
+}
+
+// RenderArtifact renders the files of an artifact from the given definition without writing them. Go,
+// TypeScript and protobuf files are stamped with the checksum of their content, see Manifest.Edited.
+func RenderArtifact(artifact Artifact, modelDef *ModelDefinition) ([]*GeneratedFile, error) {
+	files, err := renderArtifact(artifact, modelDef)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		stampChecksum(file)
+	}
+	return files, nil
+}
+
+func renderArtifact(artifact Artifact, modelDef *ModelDefinition) ([]*GeneratedFile, error) {
+	params := artifact.Params
+	switch artifact.Generator {
+	case GeneratorGo:
+		def := *modelDef
+		def.OutputDir = params["output_dir"]
+		return RenderModelFiles(&def)
+	case GeneratorKV:
+		def := *modelDef
+		def.OutputDir = params["output_dir"]
+		return RenderKVFiles(&def)
+	case GeneratorTypeScript:
+		return []*GeneratedFile{RenderTypeScript(modelDef, params["output_dir"])}, nil
+	case GeneratorProto:
+		file, err := RenderProto(modelDef, params["output_dir"], params["package"], params["go_package"])
+		if err != nil {
+			return nil, err
+		}
+		return []*GeneratedFile{file}, nil
+	case GeneratorGRPC:
+		opts := GRPCOptions{
+			ProtoDir:     params["proto_dir"],
+			ServerDir:    params["server_dir"],
+			ProtoPackage: params["package"],
+			GoModule:     params["module"],
+		}
+		files, err := RenderGRPCService(modelDef, opts)
+		if err != nil {
+			return nil, err
+		}
+		support, err := RenderGRPCSupport(opts)
+		if err != nil {
+			return nil, err
+		}
+		return append(files, support), nil
+	case GeneratorAuth:
+		opts := AuthOptions{OutputDir: params["output_dir"], Issuer: params["issuer"], SecretEnv: params["secret_env"]}
+		var err error
+		if opts.AccessTTL, err = time.ParseDuration(params["access_ttl"]); err != nil {
+			return nil, fmt.Errorf("invalid access_ttl of %s artifact: %w", artifact.Key(), err)
+		}
+		if opts.RefreshTTL, err = time.ParseDuration(params["refresh_ttl"]); err != nil {
+			return nil, fmt.Errorf("invalid refresh_ttl of %s artifact: %w", artifact.Key(), err)
+		}
+		if permissions := params["permissions"]; permissions != "" {
+			if err := json.Unmarshal([]byte(permissions), &opts.Permissions); err != nil {
+				return nil, fmt.Errorf("invalid permissions of %s artifact: %w", artifact.Key(), err)
+			}
+		}
+		file, err := RenderAuth(modelDef, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []*GeneratedFile{file}, nil
+	default:
+		return nil, fmt.Errorf("unknown generator %q", artifact.Generator)
+	}
+}
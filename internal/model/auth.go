@@ -0,0 +1,512 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Columns of the user model read by the generated authentication, see CheckUserModel. The roles column is
+// optional, and required by permissions only.
+const (
+	AuthEmailColumn    = "email"
+	AuthPasswordColumn = "passwordhash"
+	AuthRolesColumn    = "roles"
+)
+
+// envVarPattern matches the names of environment variables.
+var envVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// AuthOptions configure the authentication generated by RenderAuth. Zero values select the defaults.
+type AuthOptions struct {
+	// OutputDir is the directory of the generated package, "auth" by default.
+	OutputDir string
+	// Issuer is the "iss" claim of the tokens, "grayv" by default.
+	Issuer string
+	// SecretEnv is the environment variable holding the key tokens are signed with, "JWT_SECRET" by default.
+	SecretEnv string
+	// AccessTTL and RefreshTTL are how long access and refresh tokens are valid, 15 minutes and 30 days by
+	// default.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// Permissions are the roles allowed to perform each action on the records of each model, by model name and
+	// action, see ModelDefinition.SetPermission. Actions without roles are allowed to every user.
+	Permissions map[string]map[string][]string
+}
+
+func (o AuthOptions) withDefaults() AuthOptions {
+	if o.OutputDir == "" {
+		o.OutputDir = "auth"
+	}
+	if o.Issuer == "" {
+		o.Issuer = "grayv"
+	}
+	if o.SecretEnv == "" {
+		o.SecretEnv = "JWT_SECRET"
+	}
+	if o.AccessTTL <= 0 {
+		o.AccessTTL = 15 * time.Minute
+	}
+	if o.RefreshTTL <= 0 {
+		o.RefreshTTL = 30 * 24 * time.Hour
+	}
+	return o
+}
+
+// NewUserModel returns the definition of a user model logging in with an email address and a password: an
+// indexed, sensitive email field, the password hash, and the roles of the user.
+func NewUserModel(name string) *ModelDefinition {
+	email := NewField(AuthEmailColumn, "string", "", false, false)
+	email.Indexed = true
+	email.Sensitive = true
+	return NewModelDefinition(name, []Field{
+		email,
+		NewField(AuthPasswordColumn, "string", "", false, false),
+		NewField(AuthRolesColumn, "[]string", "", true, false),
+	})
+}
+
+// rolesField returns the roles field of a user model, or nil if it has none.
+func rolesField(def *ModelDefinition) *Field {
+	for i := range def.Fields {
+		if ColumnName(&def.Fields[i]) == AuthRolesColumn {
+			return &def.Fields[i]
+		}
+	}
+	return nil
+}
+
+// CheckUserModel checks that a model has the string fields the generated authentication reads, and that its
+// roles field, if any, is a []string.
+func CheckUserModel(def *ModelDefinition) error {
+	if roles := rolesField(def); roles != nil && (roles.Type != "[]string" || roles.Encrypted) {
+		return fmt.Errorf("field %s of model %s must be an unencrypted []string to hold the roles of its users", roles.Name, def.Name)
+	}
+	for _, name := range []string{AuthEmailColumn, AuthPasswordColumn} {
+		found := false
+		for i := range def.Fields {
+			if ColumnName(&def.Fields[i]) == name && def.Fields[i].Type == "string" {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("model %s has no %s string field, required to authenticate its users", def.Name, name)
+		}
+	}
+	return nil
+}
+
+// RenderAuth renders the authentication of the users of a model: a Go package, using the standard library and
+// the bcrypt package of golang.org/x/crypto, hashing passwords, serving login and refresh endpoints issuing
+// JWTs, and providing the middleware authenticating requests with them.
+func RenderAuth(def *ModelDefinition, opts AuthOptions) (*GeneratedFile, error) {
+	if err := CheckUserModel(def); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	if !envVarPattern.MatchString(opts.SecretEnv) {
+		return nil, fmt.Errorf("invalid environment variable name %q for the JWT secret", opts.SecretEnv)
+	}
+	rolesColumn := ""
+	if rolesField(def) != nil {
+		rolesColumn = AuthRolesColumn
+	}
+	permissions := permissionsLiteral(opts.Permissions)
+	if rolesColumn == "" && permissions != "" {
+		return nil, fmt.Errorf("model %s has no %s []string field, required by permissions", def.Name, AuthRolesColumn)
+	}
+	content, err := renderTemplate("auth", map[string]interface{}{
+		"Model":          def.Name,
+		"Table":          TableName(def),
+		"EmailColumn":    AuthEmailColumn,
+		"PasswordColumn": AuthPasswordColumn,
+		"RolesColumn":    rolesColumn,
+		"Issuer":         opts.Issuer,
+		"SecretEnv":      opts.SecretEnv,
+		"AccessTTL":      int64(opts.AccessTTL / time.Second),
+		"RefreshTTL":     int64(opts.RefreshTTL / time.Second),
+		"Permissions":    permissions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	content, err = formatGo(content)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting generated authentication: %w", err)
+	}
+	return &GeneratedFile{Path: path.Join(filepath.ToSlash(opts.OutputDir), "auth.go"), Content: content}, nil
+}
+
+// permissionsLiteral returns the entries of the Permissions map of the generated package, sorted by model and
+// action, skipping actions without roles.
+func permissionsLiteral(permissions map[string]map[string][]string) string {
+	models := make([]string, 0, len(permissions))
+	for model := range permissions {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	var b strings.Builder
+	for _, model := range models {
+		var entries []string
+		for _, action := range Actions {
+			if roles := permissions[model][action]; len(roles) > 0 {
+				quoted := make([]string, len(roles))
+				for i, role := range roles {
+					quoted[i] = fmt.Sprintf("%q", role)
+				}
+				entries = append(entries, fmt.Sprintf("%q: {%s}", action, strings.Join(quoted, ", ")))
+			}
+		}
+		if len(entries) > 0 {
+			fmt.Fprintf(&b, "\t%q: {%s},\n", model, strings.Join(entries, ", "))
+		}
+	}
+	return b.String()
+}
+
+// authTemplate is the template of the package rendered by RenderAuth.
+const authTemplate = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+// Package auth authenticates the users of the {{.Model}} model with JWTs. Users log in with their email and
+// password on POST /auth/login, which returns an access token and a refresh token, and trade the refresh token
+// for new tokens on POST /auth/refresh. Middleware authenticates requests bearing an access token.
+//
+// Passwords are hashed with bcrypt. Tokens are HS256 JWTs signed with the key in the {{.SecretEnv}} environment
+// variable. Refresh tokens are not
+// stored: they stay valid until they expire, or until the key changes. Access tokens carry the roles of the
+// user, which Require checks against the Permissions of each model.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Issuer is the "iss" claim of the tokens.
+	Issuer = {{printf "%q" .Issuer}}
+	// AccessTTL and RefreshTTL are how long access and refresh tokens are valid.
+	AccessTTL  = {{.AccessTTL}} * time.Second
+	RefreshTTL = {{.RefreshTTL}} * time.Second
+	// Cost is the bcrypt cost of new password hashes.
+	Cost = 12
+)
+
+// ErrInvalidToken is returned by Verify for tokens that are malformed, forged, expired, or of another type.
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// HashPassword returns the bcrypt hash of a password stored in the {{.PasswordColumn}} column. Passwords
+// longer than 72 bytes are refused.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), Cost)
+	return string(hash), err
+}
+
+// CheckPassword reports whether a password matches a hash returned by HashPassword.
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Claims are the claims of the tokens.
+type Claims struct {
+	Issuer    string   ` + "`json:\"iss\"`" + `
+	Subject   string   ` + "`json:\"sub\"`" + `
+	Type      string   ` + "`json:\"typ\"`" + `
+	IssuedAt  int64    ` + "`json:\"iat\"`" + `
+	ExpiresAt int64    ` + "`json:\"exp\"`" + `
+	Roles     []string ` + "`json:\"roles,omitempty\"`" + `
+}
+
+// HasRole reports whether the claims grant a role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Token types, the "typ" claim.
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+// Auth issues and verifies the tokens of the users stored in the {{.Table}} table.
+type Auth struct {
+	db     *sql.DB
+	secret []byte
+	now    func() time.Time
+	// lookup returns the ID and password hash of the user of an email address, or sql.ErrNoRows.
+	lookup func(ctx context.Context, email string) (id, hash string, err error)
+	// roles returns the roles of the user of an ID, read again when tokens are refreshed.
+	roles func(ctx context.Context, id string) ([]string, error)
+}
+
+// New creates the authentication of the users of db, with the signing key read from {{.SecretEnv}}, which
+// must hold at least 32 bytes.
+func New(db *sql.DB) (*Auth, error) {
+	secret := os.Getenv({{printf "%q" .SecretEnv}})
+	if len(secret) < 32 {
+		return nil, errors.New({{printf "%q" (printf "auth: set %s to a random key of at least 32 bytes" .SecretEnv)}})
+	}
+	a := &Auth{db: db, secret: []byte(secret), now: time.Now}
+	a.lookup = a.lookupUser
+	a.roles = a.lookupRoles
+	return a, nil
+}
+
+func (a *Auth) lookupUser(ctx context.Context, email string) (id, hash string, err error) {
+	err = a.db.QueryRowContext(ctx, {{printf "%q" (printf "SELECT id::text, %s FROM %s WHERE %s = $1" .PasswordColumn .Table .EmailColumn)}}, email).Scan(&id, &hash)
+	return id, hash, err
+}
+
+func (a *Auth) lookupRoles(ctx context.Context, id string) ([]string, error) {
+{{- if .RolesColumn}}
+	var roles string
+	err := a.db.QueryRowContext(ctx, {{printf "%q" (printf "SELECT COALESCE(array_to_string(%s, ','), '') FROM %s WHERE id = $1" .RolesColumn .Table)}}, id).Scan(&roles)
+	if err != nil || roles == "" {
+		return nil, err
+	}
+	return strings.Split(roles, ","), nil
+{{- else}}
+	// The {{.Model}} model has no roles field.
+	return nil, nil
+{{- end}}
+}
+
+// Sign returns a token of the given type for a user holding roles.
+func (a *Auth) Sign(subject, tokenType string, roles ...string) (string, error) {
+	ttl := AccessTTL
+	if tokenType == RefreshToken {
+		ttl = RefreshTTL
+	}
+	now := a.now()
+	claims, err := json.Marshal(Claims{Issuer: Issuer, Subject: subject, Type: tokenType, IssuedAt: now.Unix(), ExpiresAt: now.Add(ttl).Unix(), Roles: roles})
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	payload := encoding.EncodeToString([]byte(` + "`" + `{"alg":"HS256","typ":"JWT"}` + "`" + `)) + "." + encoding.EncodeToString(claims)
+	return payload + "." + encoding.EncodeToString(a.signature(payload)), nil
+}
+
+func (a *Auth) signature(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Verify returns the claims of a valid token of the given type, or ErrInvalidToken.
+func (a *Auth) Verify(token, tokenType string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	encoding := base64.RawURLEncoding
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, a.signature(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string ` + "`json:\"alg\"`" + `
+	}
+	data, err := encoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	data, err = encoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(data, &claims) != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Issuer != Issuer || claims.Type != tokenType || a.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// Tokens is the response of the login and refresh endpoints.
+type Tokens struct {
+	AccessToken  string ` + "`json:\"access_token\"`" + `
+	RefreshToken string ` + "`json:\"refresh_token\"`" + `
+	TokenType    string ` + "`json:\"token_type\"`" + `
+	ExpiresIn    int64  ` + "`json:\"expires_in\"`" + `
+}
+
+func (a *Auth) tokens(ctx context.Context, subject string) (*Tokens, error) {
+	roles, err := a.roles(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	access, err := a.Sign(subject, AccessToken, roles...)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := a.Sign(subject, RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{AccessToken: access, RefreshToken: refresh, TokenType: "Bearer", ExpiresIn: int64(AccessTTL / time.Second)}, nil
+}
+
+// Register registers the login and refresh endpoints on mux.
+func (a *Auth) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/auth/login", a.login)
+	mux.HandleFunc("/auth/refresh", a.refresh)
+}
+
+// dummyHash is checked against the password of unknown users, so that they take as long to reject as
+// wrong passwords.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("")
+	return hash
+})
+
+func (a *Auth) login(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email    string ` + "`json:\"email\"`" + `
+		Password string ` + "`json:\"password\"`" + `
+	}
+	if !decode(w, r, &request) {
+		return
+	}
+	id, hash, err := a.lookup(r.Context(), request.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err != nil {
+		hash = dummyHash()
+	}
+	if !CheckPassword(hash, request.Password) || err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid email or password")
+		return
+	}
+	a.writeTokens(w, r, id)
+}
+
+func (a *Auth) refresh(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string ` + "`json:\"refresh_token\"`" + `
+	}
+	if !decode(w, r, &request) {
+		return
+	}
+	claims, err := a.Verify(request.RefreshToken, RefreshToken)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	a.writeTokens(w, r, claims.Subject)
+}
+
+func (a *Auth) writeTokens(w http.ResponseWriter, r *http.Request, subject string) {
+	tokens, err := a.tokens(r.Context(), subject)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// decode decodes the JSON body of a POST request, or answers an error, and reports whether it succeeded.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+type claimsKey struct{}
+
+// Middleware lets through the requests bearing a valid access token in their Authorization header, with its
+// claims in their context, see FromContext, and answers the others with 401 Unauthorized.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims, err := a.Verify(token, AccessToken)
+		if !ok || err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid access token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
+
+// FromContext returns the claims of the token authenticating the request of ctx, set by Middleware.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Permissions are the roles allowed to perform each action on the records of each model, by model and action.
+// Actions missing are allowed to every authenticated user.
+var Permissions = map[string]map[string][]string{
+{{.Permissions}}}
+
+// Allowed reports whether the claims grant one of the roles an action on the records of a model requires.
+func Allowed(claims *Claims, model, action string) bool {
+	roles, restricted := Permissions[model][action]
+	if !restricted {
+		return true
+	}
+	for _, role := range roles {
+		if claims.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Require lets through the requests authenticated by Middleware whose user may perform an action on the
+// records of a model, see Allowed, and answers the others with 401 Unauthorized or 403 Forbidden:
+//
+//	mux.Handle("DELETE /posts/{id}", a.Middleware(auth.Require("Post", "delete", deletePost)))
+func Require(model, action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "missing or invalid access token")
+			return
+		}
+		if !Allowed(claims, model, action) {
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+`
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+func TestCheckUserModel(t *testing.T) {
+	assert.NoError(t, CheckUserModel(NewUserModel("Account")))
+	def := NewModelDefinition("Account", []Field{NewField("email", "string", "", false, false)})
+	assert.EqualError(t, CheckUserModel(def), "model Account has no passwordhash string field, required to authenticate its users")
+	_, err := RenderAuth(def, AuthOptions{})
+	assert.Error(t, err)
+	_, err = RenderAuth(NewUserModel("Account"), AuthOptions{SecretEnv: "JWT SECRET"})
+	assert.EqualError(t, err, `invalid environment variable name "JWT SECRET" for the JWT secret`)
+
+	withoutRoles := NewModelDefinition("Account", NewUserModel("Account").Fields[:2])
+	_, err = RenderAuth(withoutRoles, AuthOptions{})
+	assert.NoError(t, err)
+	_, err = RenderAuth(withoutRoles, AuthOptions{Permissions: map[string]map[string][]string{"Post": {"delete": {"admin"}}}})
+	assert.EqualError(t, err, "model Account has no roles []string field, required by permissions")
+	badRoles := NewModelDefinition("Account", append(NewUserModel("Account").Fields[:2], NewField("roles", "string", "", false, false)))
+	assert.EqualError(t, CheckUserModel(badRoles), "field roles of model Account must be an unencrypted []string to hold the roles of its users")
+}
+
+func TestAuthArtifact(t *testing.T) {
+	permissions := map[string]map[string][]string{"Post": {"create": {"editor", "admin"}, "delete": {"admin"}}}
+	artifact := AuthArtifact("User", AuthOptions{OutputDir: "app/internal/auth", AccessTTL: time.Hour, Permissions: permissions})
+	assert.Equal(t, map[string]string{
+		"output_dir": "app/internal/auth", "issuer": "grayv", "secret_env": "JWT_SECRET", "access_ttl": "1h0m0s", "refresh_ttl": "720h0m0s",
+		"permissions": `{"Post":{"create":["editor","admin"],"delete":["admin"]}}`,
+	}, artifact.Params)
+
+	files, err := RenderArtifact(artifact, NewUserModel("User"))
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "app/internal/auth/auth.go", files[0].Path)
+		assert.Contains(t, string(files[0].Content), "AccessTTL  = 3600 * time.Second")
+		assert.Contains(t, string(files[0].Content), `"SELECT id::text, passwordhash FROM users WHERE email = $1"`)
+		assert.Contains(t, string(files[0].Content), `"SELECT COALESCE(array_to_string(roles, ','), '') FROM users WHERE id = $1"`)
+		assert.Contains(t, string(files[0].Content), `"Post": {"create": {"editor", "admin"}, "delete": {"admin"}},`)
+	}
+}
+
+func TestRenderAuth_Compiles(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	dir := t.TempDir()
+	file, err := RenderAuth(NewUserModel("User"), AuthOptions{
+		OutputDir: filepath.Join(dir, "auth"), Issuer: "shop", SecretEnv: "SHOP_JWT_SECRET",
+		Permissions: map[string]map[string][]string{"Post": {"delete": {"admin"}}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, file.Write(filesystem.NewOSFS("")))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module shop_grav\n\ngo 1.22\n\nrequire golang.org/x/crypto v0.26.0\n"), 0644))
+	// The checksums of golang.org/x/crypto are those of this module, which requires the same version.
+	sums, err := os.ReadFile(filepath.Join("..", "..", "go.sum"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.sum"), sums, 0644))
+
+	authTest := `package auth
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuth(t *testing.T) {
+	if _, err := New(nil); err == nil || !strings.Contains(err.Error(), "SHOP_JWT_SECRET") {
+		t.Fatalf("New without a secret: %v", err)
+	}
+	t.Setenv("SHOP_JWT_SECRET", strings.Repeat("k", 32))
+	a, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := HashPassword("secret")
+	if err != nil || !CheckPassword(hash, "secret") || CheckPassword(hash, "Secret") || CheckPassword("x", "secret") {
+		t.Fatalf("hash %q, %v", hash, err)
+	}
+	a.lookup = func(ctx context.Context, email string) (string, string, error) {
+		if email != "ann@example.com" {
+			return "", "", sql.ErrNoRows
+		}
+		return "42", hash, nil
+	}
+	a.roles = func(ctx context.Context, id string) ([]string, error) {
+		return []string{"editor"}, nil
+	}
+	mux := http.NewServeMux()
+	a.Register(mux)
+	mux.Handle("/me", a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := FromContext(r.Context())
+		w.Write([]byte(claims.Subject + ":" + strings.Join(claims.Roles, ",")))
+	})))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/posts/delete", a.Middleware(Require("Post", "delete", ok)))
+	mux.Handle("/posts/update", a.Middleware(Require("Post", "update", ok)))
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+
+	for _, body := range []string{` + "`" + `{"email": "ann@example.com", "password": "wrong"}` + "`" + `, ` + "`" + `{"email": "bob@example.com", "password": "secret"}` + "`" + `} {
+		if w := post("/auth/login", body); w.Code != http.StatusUnauthorized {
+			t.Fatalf("login %s: %d", body, w.Code)
+		}
+	}
+	w := post("/auth/login", ` + "`" + `{"email": "ann@example.com", "password": "secret"}` + "`" + `)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), ` + "`" + `"token_type":"Bearer"` + "`" + `) {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	access, _ := a.Sign("42", AccessToken, "editor")
+	refresh, _ := a.Sign("42", RefreshToken)
+
+	getPath := func(path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	get := func(token string) *httptest.ResponseRecorder { return getPath("/me", token) }
+	if w := get(access); w.Code != http.StatusOK || w.Body.String() != "42:editor" {
+		t.Fatalf("me: %d %s", w.Code, w.Body)
+	}
+	if w := get(refresh); w.Code != http.StatusUnauthorized {
+		t.Fatalf("me with a refresh token: %d", w.Code)
+	}
+	if w := get(access[:len(access)-2] + "xx"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("me with a forged token: %d", w.Code)
+	}
+	if w := getPath("/posts/delete", access); w.Code != http.StatusForbidden {
+		t.Fatalf("delete as an editor: %d", w.Code)
+	}
+	if w := getPath("/posts/update", access); w.Code != http.StatusOK {
+		t.Fatalf("update as an editor: %d", w.Code)
+	}
+	if admin, _ := a.Sign("1", AccessToken, "admin"); getPath("/posts/delete", admin).Code != http.StatusOK {
+		t.Fatal("delete as an admin forbidden")
+	}
+	if w := post("/auth/refresh", ` + "`" + `{"refresh_token": "` + "`" + `+refresh+` + "`" + `"}` + "`" + `); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "access_token") {
+		t.Fatalf("refresh: %d %s", w.Code, w.Body)
+	}
+	if w := post("/auth/refresh", ` + "`" + `{"refresh_token": "` + "`" + `+access+` + "`" + `"}` + "`" + `); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh with an access token: %d", w.Code)
+	}
+
+	a.now = func() time.Time { return time.Now().Add(AccessTTL) }
+	if w := get(access); w.Code != http.StatusUnauthorized {
+		t.Fatalf("me with an expired token: %d", w.Code)
+	}
+}
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "auth", "auth_test.go"), []byte(authTest), 0644))
+
+	test := exec.Command(goBin, "test", "./...")
+	test.Dir = dir
+	test.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+	output, err := test.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	assert.False(t, strings.Contains(string(output), "FAIL"), string(output))
+}
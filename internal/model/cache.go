@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// The key strategies of the cache of a model's records, see SetCache.
+const (
+	// CacheKeyID keys cached records by their ID alone.
+	CacheKeyID = "id"
+	// CacheKeyTenant keys cached records by the tenant of the context and their ID.
+	CacheKeyTenant = "tenant"
+	// CacheKeySession keys cached records by the values of the session settings read by the model's row-level
+	// security policies, the tenant of the context and their ID.
+	CacheKeySession = "session"
+)
+
+// CacheKeyStrategies lists the key strategies SetCache accepts.
+var CacheKeyStrategies = []string{CacheKeyID, CacheKeyTenant, CacheKeySession}
+
+// CacheKeyDescription describes the key of the records cached with the given key strategy.
+func CacheKeyDescription(keyStrategy string) string {
+	switch keyStrategy {
+	case CacheKeyTenant:
+		return "tenant and ID"
+	case CacheKeySession:
+		return "tenant, session settings and ID"
+	}
+	return "ID"
+}
+
+// DefaultCacheTTL is the time records stay cached unless the model sets another.
+const DefaultCacheTTL = 5 * time.Minute
+
+// CacheOptions configures the cache of a model's records in the generated repository.
+type CacheOptions struct {
+	Enabled bool
+	// TTL is the time a record stays cached after it is read.
+	TTL time.Duration
+	// KeyStrategy is one of CacheKeyStrategies.
+	KeyStrategy string
+}
+
+// SetCache configures the cache of the model's records. The generated repository of a model with an enabled
+// cache keeps the records Get reads in memory for the TTL, and evicts them when it updates or deletes them;
+// records written by other processes may be read stale until their TTL expires. Records of models scoped to
+// tenants or restricted by row-level security policies are only visible in some contexts, so their keys
+// must include the tenant, or the session settings, of the context.
+//
+// An empty key strategy keeps the current one, or chooses the narrowest the model allows, and a zero ttl keeps
+// the current one, or DefaultCacheTTL.
+func (m *ModelDefinition) SetCache(enabled bool, ttl time.Duration, keyStrategy string) error {
+	cache := CacheOptions{TTL: DefaultCacheTTL}
+	if m.Options.Cache != nil {
+		cache = *m.Options.Cache
+	}
+	cache.Enabled = enabled
+	if ttl < 0 {
+		return fmt.Errorf("invalid cache TTL %s of model %s", ttl, m.Name)
+	}
+	if ttl > 0 {
+		cache.TTL = ttl
+	}
+	if keyStrategy != "" {
+		cache.KeyStrategy = keyStrategy
+	}
+	if cache.KeyStrategy == "" {
+		cache.KeyStrategy = defaultCacheKey(m)
+	}
+	if err := checkCacheKey(m, cache.KeyStrategy); err != nil {
+		return err
+	}
+	m.Options.Cache = &cache
+	return nil
+}
+
+// CacheEnabled reports whether the model's records are cached.
+func (m *ModelDefinition) CacheEnabled() bool {
+	return m.Options.Cache != nil && m.Options.Cache.Enabled
+}
+
+// defaultCacheKey returns the narrowest key strategy that keeps the records of the model visible only in the
+// contexts they are read in.
+func defaultCacheKey(m *ModelDefinition) string {
+	switch {
+	case len(m.Options.Policies) > 0:
+		return CacheKeySession
+	case m.Options.TenantField != "":
+		return CacheKeyTenant
+	}
+	return CacheKeyID
+}
+
+// checkCacheKey checks that the key strategy is known and keeps the records of the model visible only in the
+// contexts they are read in.
+func checkCacheKey(m *ModelDefinition, keyStrategy string) error {
+	switch keyStrategy {
+	case CacheKeyID, CacheKeyTenant, CacheKeySession:
+	default:
+		return fmt.Errorf("invalid cache key strategy %q: use one of %v", keyStrategy, CacheKeyStrategies)
+	}
+	if len(m.Options.Policies) > 0 && keyStrategy != CacheKeySession {
+		return fmt.Errorf("model %s has row-level security policies, so its cache must be keyed by %q", m.Name, CacheKeySession)
+	}
+	if m.Options.TenantField != "" && keyStrategy == CacheKeyID {
+		return fmt.Errorf("model %s is scoped to tenants, so its cache must be keyed by %q or %q", m.Name, CacheKeyTenant, CacheKeySession)
+	}
+	if keyStrategy == CacheKeyTenant && m.Options.TenantField == "" {
+		return fmt.Errorf("model %s is not scoped to tenants, so its cache cannot be keyed by %q", m.Name, CacheKeyTenant)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCache(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{NewField("Title", "string", "", false, false)})
+	require.NoError(t, def.SetCache(true, 0, ""))
+	assert.Equal(t, &CacheOptions{Enabled: true, TTL: DefaultCacheTTL, KeyStrategy: CacheKeyID}, def.Options.Cache)
+
+	require.NoError(t, def.SetCache(false, 0, ""))
+	assert.False(t, def.CacheEnabled())
+	assert.Equal(t, DefaultCacheTTL, def.Options.Cache.TTL, "disabling keeps the settings")
+
+	assert.EqualError(t, def.SetCache(true, 0, "tenant"), `model Post is not scoped to tenants, so its cache cannot be keyed by "tenant"`)
+	assert.EqualError(t, def.SetCache(true, 0, "lru"), `invalid cache key strategy "lru": use one of [id tenant session]`)
+	assert.Error(t, def.SetCache(true, -time.Second, ""))
+
+	require.NoError(t, def.SetTenantField("tenant_id"))
+	assert.Error(t, def.SetCache(true, time.Minute, CacheKeyID))
+	def.Options.Cache = nil
+	require.NoError(t, def.SetCache(true, time.Minute, ""))
+	assert.Equal(t, CacheKeyTenant, def.Options.Cache.KeyStrategy)
+
+	AddPolicy(def, Policy{Name: "own", Column: "title", Setting: "app.user_id"})
+	_, err := RenderRepositoryFile(def)
+	assert.EqualError(t, err, `model Post has row-level security policies, so its cache must be keyed by "session"`)
+}
+
+func TestRenderRepositoryFile_Cache(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{NewField("Title", "string", "", false, false)})
+	file, err := RenderRepositoryFile(def)
+	require.NoError(t, err)
+	assert.NotContains(t, string(file.Content), "postCache")
+
+	require.NoError(t, def.SetTenantField("tenant_id"))
+	AddPolicy(def, Policy{Name: "own", Column: "title", Setting: "app.user_id"})
+	require.NoError(t, def.SetCache(true, 90*time.Second, ""))
+	file, err = RenderRepositoryFile(def)
+	require.NoError(t, err)
+	content := string(file.Content)
+	assert.Contains(t, content, `var postCache = newRecordCache[Post]("Post", 90000*time.Millisecond)`)
+	assert.Contains(t, content, "scope := sessionScope(ctx, tenant, postSessionSettings)")
+	assert.Contains(t, content, "postCache.set(id, scope, m)")
+	assert.Contains(t, content, "postCache.evict(m.ID)")
+	assert.Contains(t, content, "postCache.evict(id)")
+}
@@ -0,0 +1,174 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ModelChangelog holds the schema changes of one model.
+type ModelChangelog struct {
+	Model   string   `json:"model"`
+	Status  string   `json:"status"` // "added", "removed", or "changed"
+	Table   string   `json:"table"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Changelog is the schema changes between two sets of model definitions, by model name.
+type Changelog []ModelChangelog
+
+// NewChangelog returns the changes from the old to the new definitions of a set of models. Models only in new
+// are added, models only in old are removed, and models in both are listed when their definition changed.
+func NewChangelog(old, new []*ModelDefinition) Changelog {
+	oldByName := make(map[string]*ModelDefinition, len(old))
+	for _, def := range old {
+		oldByName[def.Name] = def
+	}
+	newByName := make(map[string]*ModelDefinition, len(new))
+	for _, def := range new {
+		newByName[def.Name] = def
+	}
+
+	changelog := Changelog{}
+	for _, def := range new {
+		previous, existed := oldByName[def.Name]
+		if !existed {
+			changelog = append(changelog, ModelChangelog{Model: def.Name, Status: "added", Table: TableName(def), Changes: Changes(nil, def)})
+		} else if changes := Changes(previous, def); len(changes) > 0 {
+			changelog = append(changelog, ModelChangelog{Model: def.Name, Status: "changed", Table: TableName(def), Changes: changes})
+		}
+	}
+	for _, def := range old {
+		if _, exists := newByName[def.Name]; !exists {
+			changelog = append(changelog, ModelChangelog{Model: def.Name, Status: "removed", Table: TableName(def)})
+		}
+	}
+	sort.SliceStable(changelog, func(i, j int) bool { return changelog[i].Model < changelog[j].Model })
+	return changelog
+}
+
+// Markdown renders the changelog as a Markdown section for release notes, with new, removed and changed models
+// under their own headings. Index changes are described apart from the other changes of a field.
+func (c Changelog) Markdown(title string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n", title)
+	if len(c) == 0 {
+		b.WriteString("\nNo schema changes.\n")
+		return b.String()
+	}
+
+	for _, section := range []struct{ status, heading string }{
+		{"added", "New models"},
+		{"removed", "Removed models"},
+		{"changed", "Changed models"},
+	} {
+		var entries []ModelChangelog
+		for _, entry := range c {
+			if entry.Status == section.status {
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n", section.heading)
+		for _, entry := range entries {
+			switch entry.Status {
+			case "added":
+				fields := make([]string, len(entry.Changes))
+				for i, change := range entry.Changes {
+					fields[i] = fmt.Sprintf("`%s` (`%s`)", change.Name, change.Type)
+				}
+				fmt.Fprintf(&b, "\n- **%s** in table `%s`", entry.Model, entry.Table)
+				if len(fields) > 0 {
+					fmt.Fprintf(&b, " with %s", strings.Join(fields, ", "))
+				}
+				b.WriteString("\n")
+			case "removed":
+				fmt.Fprintf(&b, "\n- **%s** (table `%s`)\n", entry.Model, entry.Table)
+			default:
+				fmt.Fprintf(&b, "\n#### %s\n\n", entry.Model)
+				for _, line := range describeChanges(entry.Changes) {
+					fmt.Fprintf(&b, "- %s\n", line)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// indexAttributes are the field attributes describing its index.
+var indexAttributes = map[string]bool{"indexed": true, "vector metric": true}
+
+// describeChanges describes the changes of a model in sentences.
+func describeChanges(changes []Change) []string {
+	var lines []string
+	for _, change := range changes {
+		switch {
+		case change.Subject == "table":
+			a := change.Attributes[0]
+			lines = append(lines, fmt.Sprintf("Renamed table `%v` to `%v`", a.Old, a.New))
+		case change.Subject == "policy" && change.Op == "+":
+			lines = append(lines, fmt.Sprintf("Added row-level security policy `%s`", change.Name))
+		case change.Subject == "policy":
+			lines = append(lines, fmt.Sprintf("Removed row-level security policy `%s`", change.Name))
+		case change.Op == "+":
+			lines = append(lines, fmt.Sprintf("Added field `%s` (`%s`)", change.Name, change.Type))
+		case change.Op == "-":
+			lines = append(lines, fmt.Sprintf("Removed field `%s` (`%s`)", change.Name, change.Type))
+		default:
+			var attributes, indexes []string
+			for _, a := range change.Attributes {
+				switch {
+				case a.Name == "indexed" && a.New == true:
+					indexes = append(indexes, fmt.Sprintf("Added index on `%s`", change.Name))
+				case a.Name == "indexed":
+					indexes = append(indexes, fmt.Sprintf("Removed index on `%s`", change.Name))
+				case indexAttributes[a.Name]:
+					indexes = append(indexes, fmt.Sprintf("Changed index on `%s`: %s", change.Name, a))
+				default:
+					attributes = append(attributes, a.String())
+				}
+			}
+			if len(attributes) > 0 {
+				lines = append(lines, fmt.Sprintf("Changed field `%s`: %s", change.Name, strings.Join(attributes, ", ")))
+			}
+			lines = append(lines, indexes...)
+		}
+	}
+	return lines
+}
+
+// DecodeModels parses model definitions in the format ModelManager stores them in: a JSON object mapping
+// model names to definitions. The definitions are returned sorted by name.
+func DecodeModels(data []byte) ([]*ModelDefinition, error) {
+	var models map[string]*ModelDefinition
+	if err := json.Unmarshal(data, &models); err != nil {
+		return nil, err
+	}
+	defs := make([]*ModelDefinition, 0, len(models))
+	for name, def := range models {
+		if def.Name == "" {
+			def.Name = name
+		}
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs, nil
+}
+
+// EncodeModels returns the definitions in the format DecodeModels parses, indented and ending with a newline,
+// so that committed models files are diffed line by line. Map keys are sorted by encoding/json, so the output
+// is stable.
+func EncodeModels(defs []*ModelDefinition) ([]byte, error) {
+	models := make(map[string]*ModelDefinition, len(defs))
+	for _, def := range defs {
+		models[def.Name] = def
+	}
+	data, err := json.MarshalIndent(models, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangelog(t *testing.T) {
+	user := NewModelDefinition("User", []Field{
+		NewField("Name", "string", `json:"name"`, false, false),
+		NewField("Age", "int", `json:"age"`, false, false),
+	})
+	legacy := NewModelDefinition("Legacy", []Field{NewField("Data", "string", `json:"data"`, false, false)})
+
+	changedUser := NewModelDefinition("User", []Field{
+		NewField("Name", "string", `json:"name"`, true, false),
+		NewField("Email", "string", `json:"email"`, false, false),
+	})
+	assert.NoError(t, changedUser.IndexField("Name"))
+	assert.NoError(t, changedUser.SetTable("accounts"))
+	AddPolicy(changedUser, Policy{Name: "accounts_owner_only", Kind: PolicyOwner, Column: "id", Setting: "app.user_id"})
+	invoice := NewModelDefinition("Invoice", []Field{NewField("Total", "float64", `json:"total"`, false, false)})
+
+	changelog := NewChangelog([]*ModelDefinition{user, legacy}, []*ModelDefinition{changedUser, invoice})
+	assert.Equal(t, []string{"Invoice", "Legacy", "User"}, []string{changelog[0].Model, changelog[1].Model, changelog[2].Model})
+	assert.Equal(t, `## Release 1.2
+
+### New models
+
+- **Invoice** in table `+"`invoices`"+` with `+"`Total` (`float64`)"+`
+
+### Removed models
+
+- **Legacy** (table `+"`legacys`"+`)
+
+### Changed models
+
+#### User
+
+- Renamed table `+"`users` to `accounts`"+`
+- Removed field `+"`Age` (`int`)"+`
+- Changed field `+"`Name`"+`: nullable false -> true
+- Added index on `+"`Name`"+`
+- Added field `+"`Email` (`string`)"+`
+- Added row-level security policy `+"`accounts_owner_only`"+`
+`, changelog.Markdown("Release 1.2"))
+
+	assert.Equal(t, "## Schema changes\n\nNo schema changes.\n", NewChangelog([]*ModelDefinition{user}, []*ModelDefinition{user}).Markdown("Schema changes"))
+}
+
+func TestDecodeModels(t *testing.T) {
+	data, err := json.Marshal(map[string]*ModelDefinition{
+		"User": NewModelDefinition("User", []Field{NewField("Name", "string", "", false, false)}),
+		"Post": {Fields: []Field{NewField("Title", "string", "", false, false)}},
+	})
+	assert.NoError(t, err)
+
+	defs, err := DecodeModels(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Post", defs[0].Name)
+	assert.Equal(t, "User", defs[1].Name)
+
+	_, err = DecodeModels([]byte("["))
+	assert.Error(t, err)
+
+	encoded, err := EncodeModels(defs)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(encoded), "{\n    \"Post\": {\n"))
+	assert.True(t, strings.HasSuffix(string(encoded), "}\n"))
+	decoded, err := DecodeModels(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, defs, decoded)
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+// generatedHeader is the first line of the generated Go, TypeScript and protobuf files.
+const generatedHeader = "// Code generated by grayv-lsm. DO NOT EDIT."
+
+// checksumPrefix starts the line following generatedHeader in generated files, which holds the SHA-256 hash of
+// the rest of the file, so that edits made to it afterwards can be detected, see Edited.
+const checksumPrefix = "// Checksum: sha256:"
+
+// checksummedExtensions are the extensions of the files stamped with a checksum, whose comments start with //.
+var checksummedExtensions = map[string]bool{".go": true, ".ts": true, ".proto": true}
+
+// stampChecksum adds the checksum line of a generated file after its generatedHeader, adding the header first
+// when the template rendering it, e.g. an override, has none. Files of other kinds are left alone.
+func stampChecksum(file *GeneratedFile) {
+	if !checksummedExtensions[path.Ext(file.Path)] {
+		return
+	}
+	content := file.Content
+	if !bytes.HasPrefix(content, []byte(generatedHeader+"\n")) {
+		content = append([]byte(generatedHeader+"\n\n"), content...)
+	}
+	header := len(generatedHeader) + 1
+	stamped := make([]byte, 0, len(content)+len(checksumPrefix)+65)
+	stamped = append(stamped, content[:header]...)
+	stamped = append(stamped, checksumPrefix+hashBytes(content)+"\n"...)
+	file.Content = append(stamped, content[header:]...)
+}
+
+// checksum returns the checksum recorded in the checksum line of a generated file, and the hash of the file
+// without that line; ok is false for files without a checksum line.
+func checksum(content []byte) (recorded, actual string, ok bool) {
+	if !bytes.HasPrefix(content, []byte(generatedHeader+"\n"+checksumPrefix)) {
+		return "", "", false
+	}
+	start := len(generatedHeader) + 1
+	end := bytes.IndexByte(content[start:], '\n')
+	if end < 0 {
+		return "", "", false
+	}
+	line := string(content[start : start+end])
+	rest := append(append([]byte{}, content[:start]...), content[start+end+1:]...)
+	return strings.TrimPrefix(line, checksumPrefix), hashBytes(rest), true
+}
+
+// Edited reports whether the file at the given path, with the given content, was edited since it was
+// generated: its checksum line does not match the rest of it, or, for a file without one, such as those
+// written before checksums were added, its content is not the one the manifest records for the path. Files
+// neither stamped nor recorded were not written by the generator, so they count as edited too.
+func (m *Manifest) Edited(filePath string, content []byte) bool {
+	if recorded, actual, ok := checksum(content); ok {
+		return recorded != actual
+	}
+	for _, key := range m.Keys() {
+		for _, output := range m.Entries[key].Outputs {
+			if output.Path == filePath {
+				return output.Hash != hashBytes(content)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStampChecksum(t *testing.T) {
+	file := &GeneratedFile{Path: "models/user.go", Content: []byte(generatedHeader + "\n\npackage models\n")}
+	stampChecksum(file)
+	lines := strings.Split(string(file.Content), "\n")
+	assert.Equal(t, generatedHeader, lines[0])
+	assert.Equal(t, checksumPrefix+hashBytes([]byte(generatedHeader+"\n\npackage models\n")), lines[1])
+	assert.Equal(t, []string{"", "package models", ""}, lines[2:])
+
+	manifest := NewManifest()
+	assert.False(t, manifest.Edited(file.Path, file.Content))
+	assert.True(t, manifest.Edited(file.Path, append(file.Content, "\nvar Edited = true\n"...)))
+
+	override := &GeneratedFile{Path: "models/user.go", Content: []byte("package models\n")}
+	stampChecksum(override)
+	assert.True(t, strings.HasPrefix(string(override.Content), generatedHeader+"\n"+checksumPrefix))
+	assert.False(t, manifest.Edited(override.Path, override.Content))
+
+	page := &GeneratedFile{Path: "docs/user.md", Content: []byte("# User\n")}
+	stampChecksum(page)
+	assert.Equal(t, "# User\n", string(page.Content))
+}
+
+func TestManifestEditedUnstamped(t *testing.T) {
+	def := NewModelDefinition("User", []Field{NewField("email", "string", "", false, false)})
+	file := &GeneratedFile{Path: "types/user.d.ts", Content: []byte("export interface User {}\n")}
+	manifest := NewManifest()
+	require.NoError(t, manifest.Record(TypeScriptArtifact("User", "types"), def, file))
+
+	assert.False(t, manifest.Edited(file.Path, file.Content))
+	assert.True(t, manifest.Edited(file.Path, []byte("export interface User { edited: true }\n")))
+	assert.True(t, manifest.Edited("types/account.d.ts", file.Content), "files the generator did not write count as edited")
+}
+
+func TestRenderArtifactStampsChecksums(t *testing.T) {
+	def := NewModelDefinition("User", []Field{NewField("email", "string", "", false, false)})
+	files, err := RenderArtifact(GoArtifact("User", ""), def)
+	require.NoError(t, err)
+	manifest := NewManifest()
+	for _, file := range files {
+		assert.True(t, strings.HasPrefix(string(file.Content), generatedHeader+"\n"+checksumPrefix), file.Path)
+		assert.False(t, manifest.Edited(file.Path, file.Content), file.Path)
+	}
+}
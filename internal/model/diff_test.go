@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n")
+	new := []byte("a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nL\nm\nx\n")
+	assert.Equal(t, `--- a/models/user.go
++++ b/models/user.go
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,5 +9,6 @@
+ i
+ j
+ k
+-l
++L
+ m
++x
+`, UnifiedDiff("models/user.go", old, new))
+
+	assert.Equal(t, "--- /dev/null\n+++ b/models/user.go\n@@ -0,0 +1,2 @@\n+a\n+b\n", UnifiedDiff("models/user.go", nil, []byte("a\nb\n")))
+	assert.Equal(t, "--- a/models/user.go\n+++ b/models/user.go\n@@ -1,3 +1,3 @@\n a\n-b\n+c\n d\n", UnifiedDiff("models/user.go", []byte("a\nb\nd\n"), []byte("a\nc\nd\n")))
+	assert.Empty(t, UnifiedDiff("models/user.go", old, old))
+}
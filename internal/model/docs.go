@@ -0,0 +1,375 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Documentation formats supported by RenderDocs.
+const (
+	DocsMarkdown = "markdown"
+	DocsHTML     = "html"
+)
+
+// DocsGeneratedMarker starts every documentation page rendered by RenderDocs, so pages of deleted models can be
+// told apart from hand-written files.
+const DocsGeneratedMarker = "<!-- Code generated by grayv-lsm. DO NOT EDIT. -->"
+
+// DocsOptions controls the documentation rendered by RenderDocs.
+type DocsOptions struct {
+	// Format is DocsMarkdown (the default) or DocsHTML.
+	Format string
+	// OutputDir is the directory the pages are written to. It defaults to "docs/schema".
+	OutputDir string
+	// ProtoPackage is the protobuf package of the gRPC services whose routes are documented. It defaults to
+	// "models".
+	ProtoPackage string
+}
+
+func (o DocsOptions) withDefaults() DocsOptions {
+	if o.Format == "" {
+		o.Format = DocsMarkdown
+	}
+	if o.OutputDir == "" {
+		o.OutputDir = "docs/schema"
+	}
+	if o.ProtoPackage == "" {
+		o.ProtoPackage = "models"
+	}
+	return o
+}
+
+// docModel is the documentation of a model, shared by the Markdown and HTML templates.
+type docModel struct {
+	Name         string
+	Table        string
+	Page         string
+	Columns      []docColumn
+	References   []docRelation
+	ReferencedBy []docRelation
+	Indexes      []docIndex
+	Policies     []Policy
+	Routes       []GRPCRoute
+}
+
+type docColumn struct {
+	GoName   string
+	Name     string
+	GoType   string
+	SQLType  string
+	Nullable bool
+	Default  string
+	Notes    string
+}
+
+// docRelation is a field holding the ID of a record of another model.
+type docRelation struct {
+	Model  string
+	Page   string // empty when the other model is not documented
+	Column string
+}
+
+type docIndex struct {
+	Name   string
+	Column string
+	Kind   string
+}
+
+// RenderDocs renders documentation pages for the given models: an index listing every model and a page per
+// model describing its table, columns, relations in both directions, indexes, row-level security policies, and
+// the routes of its gRPC service. Models are listed by name, so the same definitions always render the same
+// pages.
+func RenderDocs(defs []*ModelDefinition, opts DocsOptions) ([]*GeneratedFile, error) {
+	opts = opts.withDefaults()
+	var ext string
+	var render func(name string, data interface{}) ([]byte, error)
+	switch opts.Format {
+	case DocsMarkdown:
+		ext, render = ".md", renderMarkdownDoc
+	case DocsHTML:
+		ext, render = ".html", renderHTMLDoc
+	default:
+		return nil, fmt.Errorf("unsupported documentation format %q (expected %s or %s)", opts.Format, DocsMarkdown, DocsHTML)
+	}
+
+	sorted := append([]*ModelDefinition(nil), defs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	pages := make(map[string]string, len(sorted))
+	for _, def := range sorted {
+		pages[def.Name] = strings.ToLower(def.Name) + ext
+	}
+
+	models := make([]*docModel, len(sorted))
+	for i, def := range sorted {
+		models[i] = newDocModel(def, pages, opts.ProtoPackage)
+	}
+	for _, doc := range models {
+		for _, reference := range doc.References {
+			for _, referenced := range models {
+				if referenced.Name == reference.Model {
+					referenced.ReferencedBy = append(referenced.ReferencedBy, docRelation{Model: doc.Name, Page: doc.Page, Column: reference.Column})
+				}
+			}
+		}
+	}
+
+	outputDir := filepath.ToSlash(opts.OutputDir)
+	index, err := render("index", map[string]interface{}{"Models": models})
+	if err != nil {
+		return nil, err
+	}
+	files := []*GeneratedFile{{Path: path.Join(outputDir, "index"+ext), Content: index}}
+	for _, doc := range models {
+		content, err := render("model", doc)
+		if err != nil {
+			return nil, fmt.Errorf("model %s: %w", doc.Name, err)
+		}
+		files = append(files, &GeneratedFile{Path: path.Join(outputDir, doc.Page), Content: content})
+	}
+	return files, nil
+}
+
+func newDocModel(def *ModelDefinition, pages map[string]string, protoPackage string) *docModel {
+	table := TableName(def)
+	doc := &docModel{
+		Name:     def.Name,
+		Table:    table,
+		Page:     pages[def.Name],
+		Policies: def.Options.Policies,
+		Routes:   GRPCRoutes(def.Name, protoPackage),
+	}
+	for _, c := range modelColumns(def) {
+		if c.Field == nil {
+			sqlType := "TIMESTAMP"
+			if c.Name == "id" {
+				sqlType = "SERIAL"
+			}
+			doc.Columns = append(doc.Columns, docColumn{GoName: c.GoName, Name: c.Name, GoType: c.GoType, SQLType: sqlType})
+			continue
+		}
+
+		field := c.Field
+		column := docColumn{
+			GoName:   c.GoName,
+			Name:     c.Name,
+			GoType:   field.Type,
+			SQLType:  columnSQLType(field),
+			Nullable: field.IsNull || strings.HasPrefix(field.Type, "*"),
+		}
+		if field.Default != "" {
+			column.Default = sqlDefault(field)
+		}
+		var notes []string
+		if field.IsPrimary {
+			notes = append(notes, "unique")
+		}
+		if field.Encrypted {
+			notes = append(notes, "encrypted")
+		}
+		if field.Sensitive {
+			notes = append(notes, "personal data")
+		}
+		column.Notes = strings.Join(notes, ", ")
+		doc.Columns = append(doc.Columns, column)
+
+		if field.References != "" {
+			doc.References = append(doc.References, docRelation{Model: field.References, Page: pages[field.References], Column: c.Name})
+		}
+		if field.IsPrimary {
+			doc.Indexes = append(doc.Indexes, docIndex{Name: table + "_" + c.Name + "_key", Column: c.Name, Kind: "unique"})
+		}
+		if field.Indexed {
+			kind := "btree"
+			if c.GoType == vectorGoType {
+				metric, ok := vectorMetrics[field.VectorMetric]
+				if !ok {
+					metric = vectorMetrics["l2"]
+				}
+				kind = "hnsw (" + metric.operatorClass + ")"
+			}
+			doc.Indexes = append(doc.Indexes, docIndex{Name: table + "_" + c.Name + "_idx", Column: c.Name, Kind: kind})
+		}
+	}
+	doc.Indexes = append([]docIndex{{Name: table + "_pkey", Column: "id", Kind: "primary key"}}, doc.Indexes...)
+	return doc
+}
+
+// markdownDocTemplates are the templates of the Markdown documentation, "index" and "model".
+const markdownDocTemplates = `{{define "index"}}
+# Models
+
+| Model | Table | Columns | References |
+| --- | --- | --- | --- |
+{{- range .Models}}
+| [{{.Name}}]({{.Page}}) | {{code .Table}} | {{len .Columns}} | {{range $i, $r := .References}}{{if $i}}, {{end}}{{template "relation" $r}}{{end}} |
+{{- end}}
+{{end}}
+
+{{- define "relation"}}{{if .Page}}[{{.Model}}]({{.Page}}){{else}}{{.Model}}{{end}}{{end}}
+
+{{- define "model"}}
+# {{.Name}}
+
+Stored in the {{code .Table}} table. [All models](index.md)
+
+## Columns
+
+| Field | Column | Go type | SQL type | Nullable | Default | Notes |
+| --- | --- | --- | --- | --- | --- | --- |
+{{- range .Columns}}
+| {{.GoName}} | {{code .Name}} | {{code .GoType}} | {{code .SQLType}} | {{if .Nullable}}yes{{else}}no{{end}} | {{if .Default}}{{code .Default}}{{end}} | {{.Notes}} |
+{{- end}}
+{{- if or .References .ReferencedBy}}
+
+## Relations
+{{range .References}}
+- {{code .Column}} references {{template "relation" .}}
+{{- end}}
+{{- range .ReferencedBy}}
+- Referenced by {{template "relation" .}} through {{code .Column}}
+{{- end}}
+{{- end}}
+
+## Indexes
+
+| Name | Column | Kind |
+| --- | --- | --- |
+{{- range .Indexes}}
+| {{code .Name}} | {{code .Column}} | {{.Kind}} |
+{{- end}}
+{{- if .Policies}}
+
+## Row-level security policies
+
+| Name | Kind | Column | Setting |
+| --- | --- | --- | --- |
+{{- range .Policies}}
+| {{code .Name}} | {{.Kind}} | {{code .Column}} | {{code .Setting}} |
+{{- end}}
+{{- end}}
+
+## API routes
+
+| gRPC route | Request | Response |
+| --- | --- | --- |
+{{- range .Routes}}
+| {{code .Path}} | {{code .Request}} | {{code .Response}} |
+{{- end}}
+{{end}}`
+
+// renderMarkdownDoc renders a Markdown documentation template.
+func renderMarkdownDoc(name string, data interface{}) ([]byte, error) {
+	tmpl, err := template.New("docs").Funcs(template.FuncMap{
+		"code": func(s string) string {
+			return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+		},
+	}).Parse(markdownDocTemplates)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(DocsGeneratedMarker + "\n")
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, fmt.Errorf("error executing template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// htmlDocTemplates are the templates of the HTML documentation, "index" and "model".
+const htmlDocTemplates = `{{define "header"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 70em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #f4f4f4; }
+code { font-size: 0.95em; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{- define "relation"}}{{if .Page}}<a href="{{.Page}}">{{.Model}}</a>{{else}}{{.Model}}{{end}}{{end}}
+
+{{- define "index"}}{{template "header" "Models"}}
+<h1>Models</h1>
+<table>
+<tr><th>Model</th><th>Table</th><th>Columns</th><th>References</th></tr>
+{{- range .Models}}
+<tr><td><a href="{{.Page}}">{{.Name}}</a></td><td><code>{{.Table}}</code></td><td>{{len .Columns}}</td><td>{{range $i, $r := .References}}{{if $i}}, {{end}}{{template "relation" $r}}{{end}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+{{end}}
+
+{{- define "model"}}{{template "header" .Name}}
+<h1>{{.Name}}</h1>
+<p>Stored in the <code>{{.Table}}</code> table. <a href="index.html">All models</a></p>
+<h2>Columns</h2>
+<table>
+<tr><th>Field</th><th>Column</th><th>Go type</th><th>SQL type</th><th>Nullable</th><th>Default</th><th>Notes</th></tr>
+{{- range .Columns}}
+<tr><td>{{.GoName}}</td><td><code>{{.Name}}</code></td><td><code>{{.GoType}}</code></td><td><code>{{.SQLType}}</code></td><td>{{if .Nullable}}yes{{else}}no{{end}}</td><td>{{if .Default}}<code>{{.Default}}</code>{{end}}</td><td>{{.Notes}}</td></tr>
+{{- end}}
+</table>
+{{- if or .References .ReferencedBy}}
+<h2>Relations</h2>
+<ul>
+{{- range .References}}
+<li><code>{{.Column}}</code> references {{template "relation" .}}</li>
+{{- end}}
+{{- range .ReferencedBy}}
+<li>Referenced by {{template "relation" .}} through <code>{{.Column}}</code></li>
+{{- end}}
+</ul>
+{{- end}}
+<h2>Indexes</h2>
+<table>
+<tr><th>Name</th><th>Column</th><th>Kind</th></tr>
+{{- range .Indexes}}
+<tr><td><code>{{.Name}}</code></td><td><code>{{.Column}}</code></td><td>{{.Kind}}</td></tr>
+{{- end}}
+</table>
+{{- if .Policies}}
+<h2>Row-level security policies</h2>
+<table>
+<tr><th>Name</th><th>Kind</th><th>Column</th><th>Setting</th></tr>
+{{- range .Policies}}
+<tr><td><code>{{.Name}}</code></td><td>{{.Kind}}</td><td><code>{{.Column}}</code></td><td><code>{{.Setting}}</code></td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>API routes</h2>
+<table>
+<tr><th>gRPC route</th><th>Request</th><th>Response</th></tr>
+{{- range .Routes}}
+<tr><td><code>{{.Path}}</code></td><td><code>{{.Request}}</code></td><td><code>{{.Response}}</code></td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+{{end}}`
+
+// renderHTMLDoc renders an HTML documentation template.
+func renderHTMLDoc(name string, data interface{}) ([]byte, error) {
+	tmpl, err := htmltemplate.New("docs").Parse(htmlDocTemplates)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(DocsGeneratedMarker + "\n")
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, fmt.Errorf("error executing template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDocsTestModels(t *testing.T) []*ModelDefinition {
+	user := NewModelDefinition("User", []Field{
+		NewField("Email", "string", `json:"email"`, false, true),
+		NewField("Bio", "*string", `json:"bio"`, false, false),
+	})
+	assert.NoError(t, user.SetDefault("Bio", "a|b"))
+	assert.NoError(t, user.MarkSensitive("Email"))
+
+	post := NewModelDefinition("Post", []Field{
+		NewField("AuthorID", "int", `json:"authorid"`, false, false),
+		NewField("Embedding", "vector(3)", `json:"embedding"`, true, false),
+	})
+	assert.NoError(t, post.SetReference("AuthorID", "User"))
+	assert.NoError(t, post.IndexVectorField("Embedding", "cosine"))
+	return []*ModelDefinition{user, post}
+}
+
+func TestRenderDocs_Markdown(t *testing.T) {
+	files, err := RenderDocs(newDocsTestModels(t), DocsOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+	assert.Equal(t, []string{"docs/schema/index.md", "docs/schema/post.md", "docs/schema/user.md"},
+		[]string{files[0].Path, files[1].Path, files[2].Path})
+
+	index := string(files[0].Content)
+	assert.True(t, strings.HasPrefix(index, DocsGeneratedMarker+"\n\n# Models\n"))
+	assert.Contains(t, index, "| [Post](post.md) | `posts` | 5 | [User](user.md) |\n")
+	assert.Contains(t, index, "| [User](user.md) | `users` | 5 |  |\n")
+
+	post := string(files[1].Content)
+	assert.Contains(t, post, "| Authorid | `authorid` | `int` | `INTEGER` | no |  |  |\n")
+	assert.Contains(t, post, "## Relations\n\n- `authorid` references [User](user.md)\n")
+	assert.Contains(t, post, "| `posts_embedding_idx` | `embedding` | hnsw (vector_cosine_ops) |\n")
+	assert.Contains(t, post, "| `/models.PostService/Delete` | `DeletePostRequest` | `google.protobuf.Empty` |\n")
+
+	user := string(files[2].Content)
+	assert.Contains(t, user, "| Email | `email` | `string` | `VARCHAR(255)` | no |  | unique, personal data |\n")
+	assert.Contains(t, user, "| Bio | `bio` | `*string` | `VARCHAR(255)` | yes | `'a\\|b'` |  |\n")
+	assert.Contains(t, user, "- Referenced by [Post](post.md) through `authorid`\n")
+	assert.Contains(t, user, "| `users_pkey` | `id` | primary key |\n| `users_email_key` | `email` | unique |\n")
+}
+
+func TestRenderDocs_HTML(t *testing.T) {
+	files, err := RenderDocs(newDocsTestModels(t), DocsOptions{Format: DocsHTML, OutputDir: "site", ProtoPackage: "blog"})
+	assert.NoError(t, err)
+	assert.Equal(t, "site/user.html", files[2].Path)
+
+	user := string(files[2].Content)
+	assert.True(t, strings.HasPrefix(user, DocsGeneratedMarker+"\n<!DOCTYPE html>"))
+	assert.Contains(t, user, "<li>Referenced by <a href=\"post.html\">Post</a> through <code>authorid</code></li>")
+	assert.Contains(t, user, "<code>/blog.UserService/Get</code>")
+	assert.Contains(t, user, "<code>&#39;a|b&#39;</code>")
+
+	_, err = RenderDocs(nil, DocsOptions{Format: "pdf"})
+	assert.Error(t, err)
+}
+
+func TestGRPCRoutes_MatchServiceProto(t *testing.T) {
+	def := NewModelDefinition("User", []Field{{Name: "Name", Type: "string", ProtoNumber: 1}})
+	files, err := RenderGRPCService(def, GRPCOptions{GoModule: "example.com/app", ProtoPackage: "blog"})
+	assert.NoError(t, err)
+	for _, route := range GRPCRoutes("User", "blog") {
+		assert.Contains(t, string(files[1].Content), "rpc "+route.Method+"("+route.Request+") returns ("+route.Response+");")
+		assert.Equal(t, "/blog.UserService/"+route.Method, route.Path)
+	}
+}
@@ -0,0 +1,169 @@
+package model
+
+import (
+	_ "embed"
+	"path"
+)
+
+// keyringSource is the source of the keyring package, whose declarations the encryption support of the
+// generated models includes.
+//
+//go:embed keyring/keyring.go
+var keyringSource string
+
+// encryptionTemplate is the source of the encryption support of the generated models, written next to the
+// models that have encrypted fields, see EncryptField: the declarations below, then those of the keyring
+// package, the Keyring that "grayv-lsm db rotate-keys" re-encrypts the values with. It has no template actions.
+var encryptionTemplate = encryptionSupportSource + packageDeclarations(keyringSource)
+
+// encryptionSupportSource is the part of encryptionTemplate encrypting the values of the encrypted fields
+// written by the repositories and decrypting those they read; it imports the packages of keyringSource too.
+const encryptionSupportSource = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrEncryptionDisabled is returned by repositories writing an encrypted field, or reading one that is
+// encrypted, until UseEncryption is called.
+var ErrEncryptionDisabled = errors.New("encryption is not enabled")
+
+var (
+	keyringMu sync.RWMutex
+	keyring   *Keyring
+)
+
+// UseEncryption makes repositories encrypt the values of encrypted fields they write with the primary key of k,
+// and decrypt those they read with whichever key of k they were encrypted with. To rotate a key, add the new
+// key to the keyring as its primary key, and run "grayv-lsm db rotate-keys" while the old key is still in it.
+func UseEncryption(k *Keyring) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	keyring = k
+}
+
+// currentKeyring returns the keyring of UseEncryption.
+func currentKeyring() (*Keyring, error) {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+	if keyring == nil {
+		return nil, ErrEncryptionDisabled
+	}
+	return keyring, nil
+}
+
+// EncryptionFromEnv returns the keyring configured by the environment: ENCRYPTION_KEYS, comma-separated
+// "<ID>:<base64 key>" pairs, and ENCRYPTION_PRIMARY_KEY, the ID of the key new values are encrypted with. It
+// returns nil when ENCRYPTION_KEYS is not set.
+func EncryptionFromEnv(getenv func(string) string) (*Keyring, error) {
+	spec := getenv("ENCRYPTION_KEYS")
+	if spec == "" {
+		return nil, nil
+	}
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		id, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid ENCRYPTION_KEYS entry %q: use <ID>:<base64 key>", entry)
+		}
+		keys[id] = key
+	}
+	return NewKeyring(keys, getenv("ENCRYPTION_PRIMARY_KEY"))
+}
+
+// encrypted is the value of an encrypted field written by repositories: the ciphertext of *value under the
+// primary key, or NULL when value is nil.
+type encrypted struct {
+	value *string
+}
+
+// Value implements driver.Valuer.
+func (e encrypted) Value() (driver.Value, error) {
+	if e.value == nil {
+		return nil, nil
+	}
+	k, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return k.Encrypt(*e.value)
+}
+
+// decrypted reads an encrypted field into dest, a *string or a **string, decrypting its ciphertext. NULL
+// leaves the field empty, and values stored before the field was encrypted, which "grayv-lsm db rotate-keys"
+// encrypts, are read as they are.
+type decrypted struct {
+	dest interface{}
+}
+
+// Scan implements sql.Scanner.
+func (d decrypted) Scan(src interface{}) error {
+	var value *string
+	switch src := src.(type) {
+	case nil:
+	case string:
+		value = &src
+	case []byte:
+		s := string(src)
+		value = &s
+	default:
+		return fmt.Errorf("cannot read an encrypted field from %T", src)
+	}
+	if value != nil {
+		if _, err := KeyID(*value); err == nil {
+			k, err := currentKeyring()
+			if err != nil {
+				return err
+			}
+			plaintext, err := k.Decrypt(*value)
+			if err != nil {
+				return err
+			}
+			value = &plaintext
+		}
+	}
+	switch dest := d.dest.(type) {
+	case *string:
+		*dest = ""
+		if value != nil {
+			*dest = *value
+		}
+	case **string:
+		*dest = value
+	default:
+		return fmt.Errorf("cannot read an encrypted field into %T", dest)
+	}
+	return nil
+}
+`
+
+// RenderEncryptionFile renders the encryption support of the models generated into the definition's output
+// directory: the Keyring, UseEncryption configuring the keyring of the repositories, and the values they
+// encrypt and decrypt encrypted fields with. It is generated along these models, see RenderModelFiles.
+func RenderEncryptionFile(modelDef *ModelDefinition) *GeneratedFile {
+	return &GeneratedFile{
+		Path:    path.Join(modelOutputDir(modelDef), "encryption.go"),
+		Content: []byte(templateSource("encryption")),
+	}
+}
+
+// hasEncryptedFields reports whether some field of the model is encrypted.
+func hasEncryptedFields(modelDef *ModelDefinition) bool {
+	for _, field := range modelDef.Fields {
+		if field.Encrypted {
+			return true
+		}
+	}
+	return false
+}
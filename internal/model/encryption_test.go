@@ -0,0 +1,234 @@
+package model
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderEncryptionFile(t *testing.T) {
+	def := NewModelDefinition("Patient", []Field{NewField("SSN", "string", "", false, false)})
+	files, err := RenderModelFiles(def)
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	require.NoError(t, def.EncryptField("ssn"))
+	files, err = RenderModelFiles(def)
+	require.NoError(t, err)
+	require.Len(t, files, 4)
+	assert.Equal(t, "encryption.go", filepath.Base(files[3].Path))
+	content := string(files[3].Content)
+	assert.Contains(t, content, "func UseEncryption(")
+	assert.Contains(t, content, packageDeclarations(keyringSource))
+	assert.NotContains(t, content, "package keyring")
+	assert.Contains(t, string(files[2].Content), "m.CreatedAt, m.UpdatedAt, encrypted{&m.Ssn}")
+	assert.Contains(t, string(files[2].Content), "decrypted{&m.Ssn}")
+
+	// The imports of the generated file are those both parts of it use.
+	formatted, err := formatGo(files[3].Content)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(formatted))
+
+	_, err = RenderKVFiles(def)
+	assert.ErrorContains(t, err, "field SSN is encrypted")
+}
+
+// TestRenderEncryptionFile_RoundTrip runs a generated repository against an in-memory database/sql driver,
+// writing and reading encrypted fields across a key rotation.
+func TestRenderEncryptionFile_RoundTrip(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	dir := t.TempDir()
+	def := NewModelDefinition("Patient", []Field{
+		NewField("Name", "string", "", false, false),
+		NewField("SSN", "string", "", false, false),
+		NewField("Notes", "*string", "", false, false),
+	})
+	require.NoError(t, def.EncryptField("ssn"))
+	require.NoError(t, def.EncryptField("notes"))
+	def.SetOutputDir(filepath.Join(dir, "models"))
+	files, err := RenderModelFiles(def)
+	require.NoError(t, err)
+	for _, file := range files {
+		require.NoError(t, file.Write(filesystem.NewOSFS("")))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module clinic_grav\n\ngo 1.22\n"), 0644))
+
+	encryptionTest := `package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver keeps the rows of the patients table, in the order of patientColumns, by ID.
+type fakeDriver struct {
+	mu     sync.Mutex
+	rows   map[int64][]driver.Value
+	nextID int64
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.d, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("transactions are not supported") }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("unsupported statement " + s.query)
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO patients (created_at, updated_at, name, ssn, notes) VALUES"):
+		s.d.nextID++
+		s.d.rows[s.d.nextID] = append([]driver.Value{s.d.nextID}, args...)
+		return &fakeRows{columns: []string{"id"}, rows: [][]driver.Value{{s.d.nextID}}}, nil
+	case s.query == "SELECT "+patientColumns+" FROM patients WHERE id = $1":
+		rows := &fakeRows{columns: strings.Split(patientColumns, ", ")}
+		if row, ok := s.d.rows[args[0].(int64)]; ok {
+			rows.rows = append(rows.rows, row)
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unsupported statement " + s.query)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func keys(t *testing.T, spec, primary string) *Keyring {
+	env := map[string]string{"ENCRYPTION_KEYS": spec, "ENCRYPTION_PRIMARY_KEY": primary}
+	k, err := EncryptionFromEnv(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptedFields(t *testing.T) {
+	d := &fakeDriver{rows: map[int64][]driver.Value{}}
+	sql.Register("fake", d)
+	db, err := sql.Open("fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewPatientRepository(db)
+	ctx := context.Background()
+	if k, err := EncryptionFromEnv(func(string) string { return "" }); k != nil || err != nil {
+		t.Fatalf("keyring without ENCRYPTION_KEYS: %v, %v", k, err)
+	}
+	if err := repo.Create(ctx, &Patient{Name: "Ann", Ssn: "123-45-6789"}); !errors.Is(err, ErrEncryptionDisabled) {
+		t.Fatalf("created without encryption: %v", err)
+	}
+
+	oldKey, _ := GenerateKey()
+	newKey, _ := GenerateKey()
+	UseEncryption(keys(t, "k1:"+oldKey, "k1"))
+	defer UseEncryption(nil)
+	notes := "allergic to penicillin"
+	ann := &Patient{Name: "Ann", Ssn: "123-45-6789", Notes: &notes}
+	if err := repo.Create(ctx, ann); err != nil {
+		t.Fatal(err)
+	}
+	stored := d.rows[int64(ann.ID)]
+	if ssn, _ := stored[4].(string); !strings.HasPrefix(ssn, "grv1:k1:") || strings.Contains(ssn, "123-45-6789") {
+		t.Fatalf("stored ssn %v", stored[4])
+	}
+	if stored[3] != "Ann" {
+		t.Fatalf("stored name %v", stored[3])
+	}
+
+	// The new key is the primary key; values encrypted with the old one are still read until they are rotated.
+	UseEncryption(keys(t, "k1:"+oldKey+", k2:"+newKey, "k2"))
+	got, err := repo.Get(ctx, ann.ID)
+	if err != nil || got.Ssn != "123-45-6789" || got.Notes == nil || *got.Notes != notes {
+		t.Fatalf("read %+v, %v", got, err)
+	}
+	bob := &Patient{Name: "Bob", Ssn: "987-65-4321"}
+	if err := repo.Create(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	if ssn, _ := d.rows[int64(bob.ID)][4].(string); !strings.HasPrefix(ssn, "grv1:k2:") || d.rows[int64(bob.ID)][5] != nil {
+		t.Fatalf("stored %v", d.rows[int64(bob.ID)])
+	}
+	if got, err := repo.Get(ctx, bob.ID); err != nil || got.Ssn != "987-65-4321" || got.Notes != nil {
+		t.Fatalf("read %+v, %v", got, err)
+	}
+
+	// Once the old values are rotated, the old key can be removed.
+	both := keys(t, "k1:"+oldKey+",k2:"+newKey, "k2")
+	for i := 4; i <= 5; i++ {
+		rotated, err := both.Rotate("k2", d.rows[int64(ann.ID)][i].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.rows[int64(ann.ID)][i] = rotated
+	}
+	UseEncryption(keys(t, "k2:"+newKey, "k2"))
+	if got, err := repo.Get(ctx, ann.ID); err != nil || got.Ssn != "123-45-6789" || *got.Notes != notes {
+		t.Fatalf("read rotated %+v, %v", got, err)
+	}
+	UseEncryption(keys(t, "k1:"+oldKey, "k1"))
+	if _, err := repo.Get(ctx, bob.ID); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("read with a removed key: %v", err)
+	}
+
+	// Values stored before the field was encrypted are read as they are.
+	d.rows[int64(bob.ID)][4] = "555-00-1234"
+	UseEncryption(nil)
+	if got, err := repo.Get(ctx, bob.ID); err != nil || got.Ssn != "555-00-1234" {
+		t.Fatalf("read plaintext %+v, %v", got, err)
+	}
+}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "models", "encryption_test.go"), []byte(encryptionTest), 0644))
+
+	test := exec.Command(goBin, "test", "./...")
+	test.Dir = dir
+	test.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+	output, err := test.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	assert.False(t, strings.Contains(string(output), "FAIL"), string(output))
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// enumValuePattern matches the values of enum fields, which also name the generated constants.
+var enumValuePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// EnumValues reports whether fieldType is an enum type of the form "enum(a,b,c)" and returns its values. The
+// values must be distinct and start with a letter, followed by letters, digits, underscores or hyphens.
+func EnumValues(fieldType string) ([]string, bool) {
+	if !strings.HasPrefix(fieldType, "enum(") || !strings.HasSuffix(fieldType, ")") {
+		return nil, false
+	}
+	values := strings.Split(fieldType[len("enum("):len(fieldType)-1], ",")
+	constants := make(map[string]bool, len(values))
+	for i, value := range values {
+		value = strings.TrimSpace(value)
+		if !enumValuePattern.MatchString(value) || constants[enumConstSuffix(value)] {
+			return nil, false
+		}
+		constants[enumConstSuffix(value)] = true
+		values[i] = value
+	}
+	return values, true
+}
+
+// enumType is an enum type generated for a field, see modelEnums.
+type enumType struct {
+	Model    string
+	Field    string
+	Type     string
+	Nullable bool
+	Values   []enumConst
+}
+
+// enumConst is a constant of a generated enum type.
+type enumConst struct {
+	Name  string
+	Value string
+}
+
+// enumTypeName returns the name of the Go type generated for an enum field: the model name followed by the
+// field name, e.g. OrderStatus for the status field of Order.
+func enumTypeName(modelName string, field Field) string {
+	return modelName + goFieldName(field.Name)
+}
+
+// enumConstSuffix returns the part of a constant name derived from an enum value, e.g. InProgress for
+// "in_progress".
+func enumConstSuffix(value string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(value, func(r rune) bool { return r == '_' || r == '-' }) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// modelEnums returns the enum types generated for the enum fields of a model.
+func modelEnums(def *ModelDefinition) []enumType {
+	var enums []enumType
+	for _, field := range def.Fields {
+		values, ok := EnumValues(field.Type)
+		if !ok {
+			continue
+		}
+		enum := enumType{Model: def.Name, Field: field.Name, Type: enumTypeName(def.Name, field), Nullable: field.IsNull}
+		for _, value := range values {
+			enum.Values = append(enum.Values, enumConst{Name: enum.Type + enumConstSuffix(value), Value: value})
+		}
+		enums = append(enums, enum)
+	}
+	return enums
+}
+
+// isEnumField reports whether a field is an enum field.
+func isEnumField(field *Field) bool {
+	_, ok := EnumValues(field.Type)
+	return ok
+}
+
+// hasEnumFields reports whether any of the fields is an enum field.
+func hasEnumFields(fields []Field) bool {
+	for i := range fields {
+		if isEnumField(&fields[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// enumCheck returns the CHECK constraint restricting a column to the values of an enum.
+func enumCheck(column string, values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + value + "'"
+	}
+	return fmt.Sprintf("CHECK (%s IN (%s))", column, strings.Join(quoted, ", "))
+}
+
+// validEnumValue returns an error unless value is one of the values of an enum.
+func validEnumValue(values []string, value string) error {
+	for _, v := range values {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected one of %s", strings.Join(values, ", "))
+}
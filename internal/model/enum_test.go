@@ -0,0 +1,66 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnumValues(t *testing.T) {
+	values, ok := EnumValues("enum(pending, active,in-review)")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"pending", "active", "in-review"}, values)
+
+	for _, fieldType := range []string{"enum", "enum()", "enum(a,)", "enum(1st)", "enum(a b)", "enum(a,a)", "enum(in_review,in-review)", "string"} {
+		_, ok := EnumValues(fieldType)
+		assert.False(t, ok, fieldType)
+	}
+}
+
+func TestEnumFields(t *testing.T) {
+	def := NewModelDefinition("Order", []Field{
+		NewField("Status", "enum(pending,in_progress,closed)", "", false, false),
+		NewField("Channel", "enum(web,store)", "", true, false),
+	})
+	assert.NoError(t, ValidateFieldType(def.Fields[0].Type))
+	assert.Error(t, ValidateFieldType("[]enum(a,b)"))
+	assert.Error(t, ValidateFieldType("enum(a,a)"))
+
+	assert.Error(t, def.SetDefault("status", "open"))
+	assert.NoError(t, def.SetDefault("status", "pending"))
+
+	migration := (&ModelManager{}).GenerateMigration(def)
+	assert.Contains(t, migration, "  status VARCHAR(255) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'in_progress', 'closed')),\n")
+	assert.Contains(t, migration, "  channel VARCHAR(255) CHECK (channel IN ('web', 'store'))\n")
+
+	modelFile, err := RenderModelFile(def)
+	assert.NoError(t, err)
+	content := string(modelFile.Content)
+	assert.Contains(t, content, "Status  OrderStatus  `json:\"status\"`")
+	assert.Contains(t, content, "\"database/sql/driver\"")
+	assert.Contains(t, content, "type OrderStatus string")
+	assert.Contains(t, content, "OrderStatusInProgress OrderStatus = \"in_progress\"")
+	assert.Contains(t, content, "var OrderStatusValues = []OrderStatus{OrderStatusPending, OrderStatusInProgress, OrderStatusClosed}")
+	assert.Contains(t, content, "func ParseOrderChannel(s string) (OrderChannel, error) {")
+	assert.Contains(t, content, "func (v *OrderStatus) Scan(src interface{}) error {")
+	assert.Contains(t, content, "func (v OrderStatus) Value() (driver.Value, error) {")
+	channelValue := content[strings.Index(content, "func (v OrderChannel) Value()"):]
+	assert.Contains(t, channelValue, "if v == \"\" {\n\t\treturn nil, nil\n\t}")
+
+	AssignProtoNumbers(def)
+	message, err := RenderProto(def, "", "models", "")
+	assert.NoError(t, err)
+	assert.Contains(t, string(message.Content), "string status = 4;")
+	assert.Contains(t, string(message.Content), "optional string channel = 5;")
+	assert.Contains(t, string(RenderTypeScript(def, "").Content), "status: \"pending\" | \"in_progress\" | \"closed\";")
+
+	files, err := RenderGRPCService(def, GRPCOptions{GoModule: "shop"})
+	if assert.NoError(t, err) && assert.Len(t, files, 3) {
+		server := string(files[2].Content)
+		assert.Contains(t, server, "string(m.Status)")
+		assert.Contains(t, server, "models.OrderStatus(in.Status)")
+		assert.Contains(t, server, "ptr(string(m.Channel))")
+		assert.Contains(t, server, "models.OrderChannel(deref(in.Channel))")
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FakeHints are the kinds of fake values a string field may be generated with by the mock server and the
+// seed generator, besides lorem(n) for n words of lorem ipsum. Fields without a hint get the kind their name
+// suggests.
+var FakeHints = []string{
+	"address", "city", "color", "country", "email", "first_name", "last_name", "name", "phone", "slug", "text",
+	"title", "token", "url", "username", "word", "zip",
+}
+
+// MaxLoremWords is the largest number of words of a lorem(n) hint.
+const MaxLoremWords = 1000
+
+var loremHintPattern = regexp.MustCompile(`^lorem\((\d+)\)$`)
+
+// ParseFakeHint returns the kind of a fake value hint and, for lorem(n), its number of words.
+func ParseFakeHint(hint string) (string, int, error) {
+	if match := loremHintPattern.FindStringSubmatch(hint); match != nil {
+		words, _ := strconv.Atoi(match[1])
+		if words < 1 || words > MaxLoremWords {
+			return "", 0, fmt.Errorf("invalid fake hint %s: lorem takes 1 to %d words", hint, MaxLoremWords)
+		}
+		return "lorem", words, nil
+	}
+	if i := sort.SearchStrings(FakeHints, hint); i < len(FakeHints) && FakeHints[i] == hint {
+		return hint, 0, nil
+	}
+	return "", 0, fmt.Errorf("unknown fake hint %q: expected one of %s or lorem(n)", hint, strings.Join(FakeHints, ", "))
+}
+
+// SetFakeHint sets the kind of the fake values generated for the named field, or removes it if hint is empty.
+// Hints apply to string fields and the items of string slices.
+func (m *ModelDefinition) SetFakeHint(name, hint string) error {
+	field := m.Field(name)
+	if field == nil {
+		return fmt.Errorf("model %s has no field %s", m.Name, name)
+	}
+	if hint != "" {
+		if elementType(field.Type) != "string" {
+			return fmt.Errorf("field %s of type %s cannot have a fake hint: only string fields can", name, field.Type)
+		}
+		if _, _, err := ParseFakeHint(hint); err != nil {
+			return err
+		}
+	}
+	field.Fake = hint
+	return nil
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFakeHint(t *testing.T) {
+	assert.True(t, sort.StringsAreSorted(FakeHints))
+
+	kind, words, err := ParseFakeHint("email")
+	assert.NoError(t, err)
+	assert.Equal(t, "email", kind)
+	assert.Zero(t, words)
+
+	kind, words, err = ParseFakeHint("lorem(50)")
+	assert.NoError(t, err)
+	assert.Equal(t, "lorem", kind)
+	assert.Equal(t, 50, words)
+
+	_, _, err = ParseFakeHint("lorem(0)")
+	assert.ErrorContains(t, err, "1 to 1000 words")
+	_, _, err = ParseFakeHint("lorem")
+	assert.ErrorContains(t, err, "unknown fake hint")
+	_, _, err = ParseFakeHint("ssn")
+	assert.ErrorContains(t, err, "unknown fake hint")
+}
+
+func TestSetFakeHint(t *testing.T) {
+	def := NewModelDefinition("User", []Field{
+		NewField("Contact", "string", "", false, false),
+		NewField("Links", "[]string", "", false, false),
+		NewField("Age", "int", "", false, false),
+	})
+	assert.NoError(t, def.SetFakeHint("contact", "email"))
+	assert.Equal(t, "email", def.Field("Contact").Fake)
+	assert.NoError(t, def.SetFakeHint("Links", "url"))
+	assert.EqualError(t, def.SetFakeHint("Age", "name"), "field Age of type int cannot have a fake hint: only string fields can")
+	assert.Error(t, def.SetFakeHint("Contact", "ssn"))
+	assert.Error(t, def.SetFakeHint("Missing", "email"))
+
+	assert.NoError(t, def.SetFakeHint("Contact", ""))
+	assert.Empty(t, def.Field("Contact").Fake)
+}
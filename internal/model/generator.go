@@ -1,74 +1,1803 @@
 package model
 
 import (
+	"bytes"
 	"fmt"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
-	"os"
-	"path/filepath"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"path"
+	"regexp"
 	"strings"
 	"text/template"
 )
 
 // modelTemplate is a constant that holds the template for generating a model file based on a `ModelDefinition`.
-// The template includes the necessary import statements and defines the struct fields using the provided `ModelDefinition` fields.
+// The template includes the imports required by the field types and defines the struct fields using the provided `ModelDefinition` fields.
 // The `{{.Name}}` placeholder is replaced with the name of the model. The field names are transformed to title case using the `title` function.
 // The `json` struct tag is generated using the field name transformed to lowercase.
-// The `TableName` method is defined to return the lowercase plural form of the model name followed by "s".
+// The `TableName` method is defined to return the name of the model's table, see TableName.
+// Every model embeds the DefaultModel declared in the base file generated next to it; fields colliding with it are
+// omitted, see ownFields.
+// New<Model> returns a model initialized with the defaults of its fields, see goDefault.
+// Enum fields are declared with a string type generated after the struct, with a constant per value and the
+// methods validating values when they are stored and scanned, see modelEnums.
 const modelTemplate = `package models
+{{- with imports .Fields}}
 
+import (
+{{- range .}}
+	"{{.}}"
+{{- end}}
+)
+{{- end}}
 
 type {{.Name}} struct {
-	model.DefaultModel
+	DefaultModel
 	{{- range .Fields}}
-	{{.Name | title}} {{.Type}} ` + "`json:\"{{.Name | toLower}}\"`" + `
+	{{.Name | title}} {{goType $.Name .}} ` + "`json:\"{{.Name | toLower}}\"`" + `
 	{{- end}}
 }
 
 func ({{.Name | firstLetter}} *{{.Name}}) TableName() string {
-	return "{{.Name | toLower}}s"
+	return "{{tableName .}}"
+}
+
+// New{{.Name}} returns a {{.Name}} holding the defaults of its fields. Pointer fields are left nil, and their
+// column default is stored when the {{.Name}} is created.
+func New{{.Name}}() *{{.Name}} {
+	{{- with defaults .}}
+	return &{{$.Name}}{
+	{{- range .}}
+		{{.GoName}}: {{.Value}},
+	{{- end}}
+	}
+	{{- else}}
+	return &{{.Name}}{}
+	{{- end}}
+}
+{{- range $enum := enums .}}
+
+// {{$enum.Type}} is the {{$enum.Field}} of a {{$enum.Model}}, one of the {{$enum.Type}} constants{{if $enum.Nullable}} or empty for NULL{{end}}.
+type {{$enum.Type}} string
+
+const (
+{{- range $enum.Values}}
+	{{.Name}} {{$enum.Type}} = {{printf "%q" .Value}}
+{{- end}}
+)
+
+// {{$enum.Type}}Values lists the values of {{$enum.Type}}.
+var {{$enum.Type}}Values = []{{$enum.Type}}{ {{- range $i, $v := $enum.Values}}{{if $i}}, {{end}}{{$v.Name}}{{end -}} }
+
+// Parse{{$enum.Type}} returns the {{$enum.Type}} with the given value, or an error if it is not one of its values.
+func Parse{{$enum.Type}}(s string) ({{$enum.Type}}, error) {
+	v := {{$enum.Type}}(s)
+	if !v.Valid() {
+		return "", fmt.Errorf("invalid {{$enum.Type}} %q", s)
+	}
+	return v, nil
+}
+
+// String implements fmt.Stringer.
+func (v {{$enum.Type}}) String() string {
+	return string(v)
+}
+
+// Valid reports whether v is one of the values of {{$enum.Type}}.
+func (v {{$enum.Type}}) Valid() bool {
+	for _, value := range {{$enum.Type}}Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan implements sql.Scanner, rejecting values that are not values of {{$enum.Type}}.
+func (v *{{$enum.Type}}) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	{{- if $enum.Nullable}}
+	case nil:
+		*v = ""
+		return nil
+	{{- end}}
+	default:
+		return fmt.Errorf("cannot scan %T into {{$enum.Type}}", src)
+	}
+	parsed, err := Parse{{$enum.Type}}(s)
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, rejecting values that are not values of {{$enum.Type}}{{if $enum.Nullable}} and storing the empty value as NULL{{end}}.
+func (v {{$enum.Type}}) Value() (driver.Value, error) {
+	{{- if $enum.Nullable}}
+	if v == "" {
+		return nil, nil
+	}
+	{{- end}}
+	if !v.Valid() {
+		return nil, fmt.Errorf("invalid {{$enum.Type}} %q", string(v))
+	}
+	return string(v), nil
+}
+{{- end}}
+`
+
+// modelBaseFile is the file generated next to the models declaring the DefaultModel they embed and the helpers
+// shared by their repositories. DefaultModel mirrors the fields of Model so generated models are stored and
+// serialized like the models managed by this tool, without the generated package having to import it.
+const modelBaseFile = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+package models
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultModel holds the fields every generated model is stored with.
+type DefaultModel struct {
+	ID        uint      ` + "`json:\"id\"`" + `
+	CreatedAt time.Time ` + "`json:\"created_at\"`" + `
+	UpdatedAt time.Time ` + "`json:\"updated_at\"`" + `
+	Name      string
+}
+
+// nullTime returns nil for the zero time, so that inserting it stores the column default instead.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sessionKey is the type of the context keys holding session settings.
+type sessionKey string
+
+// WithSessionSetting returns a context carrying a value for a Postgres session setting read by row-level
+// security policies. Repositories of models with policies set it for the statements they run with the context.
+func WithSessionSetting(ctx context.Context, setting, value string) context.Context {
+	return context.WithValue(ctx, sessionKey(setting), value)
+}
+
+// WithTenantID returns a context carrying the tenant read by tenant isolation policies.
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return WithSessionSetting(ctx, "app.tenant_id", tenantID)
+}
+
+// ErrNoTenant is returned by the repositories of models scoped to tenants for a context carrying no tenant.
+var ErrNoTenant = errors.New("no tenant in context")
+
+// TenantID returns the tenant carried by ctx, see WithTenantID.
+func TenantID(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(sessionKey("app.tenant_id")).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// requireTenant returns the tenant carried by ctx, or ErrNoTenant.
+func requireTenant(ctx context.Context) (string, error) {
+	tenantID, ok := TenantID(ctx)
+	if !ok {
+		return "", ErrNoTenant
+	}
+	return tenantID, nil
+}
+
+// ErrReadOnly is returned by the writes of the repositories while they are read-only, see SetReadOnly.
+var ErrReadOnly = errors.New("read-only mode: writes are disabled")
+
+// readOnly is set while the repositories are read-only, from the start when the READ_ONLY environment
+// variable is true, as parsed by strconv.ParseBool.
+var readOnly atomic.Bool
+
+func init() {
+	on, _ := strconv.ParseBool(os.Getenv("READ_ONLY"))
+	readOnly.Store(on)
+}
+
+// SetReadOnly makes the repositories read-only, failing their writes with ErrReadOnly before any hook or
+// statement runs, e.g. during a maintenance window or an incident, or writable again. Reads are unaffected.
+func SetReadOnly(on bool) {
+	readOnly.Store(on)
+}
+
+// ReadOnly reports whether the repositories are read-only, see SetReadOnly.
+func ReadOnly() bool {
+	return readOnly.Load()
+}
+
+// WithUserID returns a context carrying the user read by owner-only policies.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return WithSessionSetting(ctx, "app.user_id", userID)
+}
+
+// withSession runs fn, reading table, against db, or against a read replica of db, see UseReplicas. When
+// settings are given, fn runs in a transaction in which every setting holds the value carried by ctx, so the
+// row-level security policies reading them apply to fn's statements. A read failing on a replica that no
+// longer answers is run again on db.
+func withSession(ctx context.Context, db *sql.DB, table string, settings []string, fn func(q querier) error) error {
+	start := time.Now()
+	reader, replica := readerFor(ctx, db)
+	err := runSession(ctx, reader, settings, len(settings) > 0, fn)
+	if err != nil && replica != nil && ctx.Err() == nil && replica.db.PingContext(ctx) != nil {
+		replica.healthy.Store(false)
+		err = runSession(ctx, db, settings, len(settings) > 0, fn)
+	}
+	observe(table, false, time.Since(start), err)
+	return err
+}
+
+// replica is a read replica and whether its last health check passed.
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+var (
+	replicasMu  sync.RWMutex
+	replicas    []*replica
+	nextReplica atomic.Uint64
+)
+
+// primaryKey is the context key forcing reads to the primary database, see WithPrimary.
+type primaryKey struct{}
+
+// WithPrimary returns a context whose reads run on the primary database instead of a replica, for instance to
+// read a record just written before the replicas have caught up.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UseReplicas routes the reads of the repositories to the given read replicas of their database, in turn,
+// while writes, and reads with a context from WithPrimary, run on the primary database. Every interval, each
+// replica is pinged: replicas failing are skipped until they answer again, and reads run on the primary while
+// none does. It returns a function stopping the health checks and routing every read to the primary again:
+//
+//	stop := models.UseReplicas([]*sql.DB{replica1, replica2}, 5*time.Second)
+//	defer stop()
+func UseReplicas(dbs []*sql.DB, interval time.Duration) (stop func()) {
+	set := make([]*replica, len(dbs))
+	for i, db := range dbs {
+		set[i] = &replica{db: db}
+	}
+	checkReplicas(set, interval)
+	replicasMu.Lock()
+	replicas = set
+	replicasMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				checkReplicas(set, interval)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			replicasMu.Lock()
+			replicas = nil
+			replicasMu.Unlock()
+		})
+	}
+}
+
+// checkReplicas pings the replicas concurrently, each for up to timeout, and records whether they answered.
+func checkReplicas(set []*replica, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range set {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			r.healthy.Store(r.db.PingContext(ctx) == nil)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// readerFor returns the database the reads of ctx run on: the next healthy replica, or primary when ctx comes
+// from WithPrimary or no replica is healthy, together with the replica it belongs to, if any.
+func readerFor(ctx context.Context, primary *sql.DB) (*sql.DB, *replica) {
+	if forced, _ := ctx.Value(primaryKey{}).(bool); forced {
+		return primary, nil
+	}
+	replicasMu.RLock()
+	defer replicasMu.RUnlock()
+	if len(replicas) == 0 {
+		return primary, nil
+	}
+	n := nextReplica.Add(1)
+	for i := range replicas {
+		if r := replicas[(n+uint64(i))%uint64(len(replicas))]; r.healthy.Load() {
+			return r.db, r
+		}
+	}
+	return primary, nil
+}
+
+// withModelSession runs fn, writing m to table, like withSession, and in a transaction also when m implements a
+// hook, so that a hook failing after fn's statements rolls them back. It fails with ErrReadOnly while the
+// repositories are read-only.
+func withModelSession(ctx context.Context, db *sql.DB, table string, settings []string, m interface{}, fn func(q querier) error) error {
+	if ReadOnly() {
+		return ErrReadOnly
+	}
+	start := time.Now()
+	err := runSession(ctx, db, settings, len(settings) > 0 || hasHooks(m), fn)
+	observe(table, true, time.Since(start), err)
+	return err
+}
+
+// withBatchSession runs fn, writing a batch of records to table, like withSession but always in a
+// transaction, so that the batch is written entirely or not at all. It fails with ErrReadOnly while the
+// repositories are read-only.
+func withBatchSession(ctx context.Context, db *sql.DB, table string, settings []string, fn func(q querier) error) error {
+	if ReadOnly() {
+		return ErrReadOnly
+	}
+	start := time.Now()
+	err := runSession(ctx, db, settings, true, fn)
+	observe(table, true, time.Since(start), err)
+	return err
+}
+
+// MaxBatchRows is the number of rows CreateBatch and UpsertBatch insert per statement at most. Statements
+// of models with many columns hold fewer rows, as PostgreSQL binds at most 65535 parameters per statement.
+var MaxBatchRows = 1000
+
+// maxStatementParams is the number of parameters PostgreSQL binds per statement at most.
+const maxStatementParams = 65535
+
+// batchRows returns the number of rows of columns values a batch statement holds.
+func batchRows(columns int) int {
+	rows := maxStatementParams / columns
+	if MaxBatchRows > 0 && MaxBatchRows < rows {
+		rows = MaxBatchRows
+	}
+	return rows
+}
+
+// batchValues returns the VALUES list of a statement inserting rows rows. A row has a parameter per entry of
+// defaults, replaced by the default expression of the entry when NULL unless the entry is empty.
+func batchValues(rows int, defaults []string) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j, def := range defaults {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			n++
+			if def == "" {
+				b.WriteString("$" + strconv.Itoa(n))
+			} else {
+				b.WriteString("COALESCE($" + strconv.Itoa(n) + ", " + def + ")")
+			}
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// TableStats counts the reads and writes repositories ran on a table, and the time they took, see Stats. A
+// read or write is one session of a repository method: ListPage reads twice, to count and select records.
+type TableStats struct {
+	Table     string        ` + "`json:\"table\"`" + `
+	Reads     int64         ` + "`json:\"reads\"`" + `
+	Writes    int64         ` + "`json:\"writes\"`" + `
+	Errors    int64         ` + "`json:\"errors\"`" + `
+	ReadTime  time.Duration ` + "`json:\"read_time\"`" + `
+	WriteTime time.Duration ` + "`json:\"write_time\"`" + `
+}
+
+// MeanRead returns the mean duration of the reads.
+func (s TableStats) MeanRead() time.Duration {
+	if s.Reads == 0 {
+		return 0
+	}
+	return s.ReadTime / time.Duration(s.Reads)
+}
+
+// MeanWrite returns the mean duration of the writes.
+func (s TableStats) MeanWrite() time.Duration {
+	if s.Writes == 0 {
+		return 0
+	}
+	return s.WriteTime / time.Duration(s.Writes)
+}
+
+var (
+	statsMu    sync.Mutex
+	tableStats = make(map[string]*TableStats)
+)
+
+// QueryObserver, when set, is called after every read or write of a repository, for instance to record its
+// duration in a Prometheus histogram:
+//
+//	models.QueryObserver = func(table string, write bool, elapsed time.Duration, err error) {
+//		queryDuration.WithLabelValues(table, strconv.FormatBool(write)).Observe(elapsed.Seconds())
+//	}
+var QueryObserver func(table string, write bool, elapsed time.Duration, err error)
+
+// observe adds a read or write of table to its stats.
+func observe(table string, write bool, elapsed time.Duration, err error) {
+	if QueryObserver != nil {
+		QueryObserver(table, write, elapsed, err)
+	}
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats := tableStats[table]
+	if stats == nil {
+		stats = &TableStats{Table: table}
+		tableStats[table] = stats
+	}
+	if write {
+		stats.Writes++
+		stats.WriteTime += elapsed
+	} else {
+		stats.Reads++
+		stats.ReadTime += elapsed
+	}
+	if err != nil {
+		stats.Errors++
+	}
+}
+
+// Stats returns the stats of every table repositories ran operations on since the process started, or since
+// ResetStats, busiest table first. Compare stats taken some time apart, e.g. exported with expvar, to find the
+// hot tables worth indexing or caching.
+func Stats() []TableStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats := make([]TableStats, 0, len(tableStats))
+	for _, s := range tableStats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if a, b := stats[i].Reads+stats[i].Writes, stats[j].Reads+stats[j].Writes; a != b {
+			return a > b
+		}
+		return stats[i].Table < stats[j].Table
+	})
+	return stats
+}
+
+// ResetStats clears the stats of every table and the hit and miss counts of every model cache and of the
+// statement cache.
+func ResetStats() {
+	statsMu.Lock()
+	tableStats = make(map[string]*TableStats)
+	statsMu.Unlock()
+	for _, c := range registeredCaches() {
+		c.resetCounts()
+	}
+	statements.mu.Lock()
+	statements.hits, statements.misses, statements.evictions = 0, 0, 0
+	statements.mu.Unlock()
+}
+
+// CacheStats counts the reads of the records of a cached model, see ModelCacheStats. Evictions counts the
+// records evicted because they were written or expired, or to make room.
+type CacheStats struct {
+	Model     string ` + "`json:\"model\"`" + `
+	Hits      int64  ` + "`json:\"hits\"`" + `
+	Misses    int64  ` + "`json:\"misses\"`" + `
+	Evictions int64  ` + "`json:\"evictions\"`" + `
+	Size      int    ` + "`json:\"size\"`" + `
+}
+
+// HitRate returns the share of the reads served from the cache.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// CacheObserver, when set, is called after every read of the records of a cached model, for instance to count
+// hits in a Prometheus counter:
+//
+//	models.CacheObserver = func(model string, hit bool) {
+//		cacheReads.WithLabelValues(model, strconv.FormatBool(hit)).Inc()
+//	}
+var CacheObserver func(model string, hit bool)
+
+// MaxCachedRecords is the number of records the cache of a model holds at most.
+var MaxCachedRecords = 10000
+
+// modelCache is implemented by the caches of every model.
+type modelCache interface {
+	stats() CacheStats
+	resetCounts()
+	clear()
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   []modelCache
+)
+
+func registeredCaches() []modelCache {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	return append([]modelCache(nil), caches...)
+}
+
+// ModelCacheStats returns the stats of the cache of every cached model since the process started, or since
+// ResetStats, by model name.
+func ModelCacheStats() []CacheStats {
+	var stats []CacheStats
+	for _, c := range registeredCaches() {
+		stats = append(stats, c.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Model < stats[j].Model })
+	return stats
+}
+
+// ClearCaches evicts every cached record, for instance after changing records with SQL.
+func ClearCaches() {
+	for _, c := range registeredCaches() {
+		c.clear()
+	}
+}
+
+// recordCache holds the records of a model read by ID for a TTL. Records are keyed by their ID and a scope, the
+// tenant or session settings of the context they were read in, so that they are only served in contexts that
+// may read them. The cache stores and returns copies of the records.
+type recordCache[T any] struct {
+	model string
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[uint]map[string]cacheEntry[T]
+	size    int
+	counts  CacheStats
+}
+
+type cacheEntry[T any] struct {
+	record  T
+	expires time.Time
+}
+
+// newRecordCache returns the cache of the records of a model, registered for ModelCacheStats.
+func newRecordCache[T any](model string, ttl time.Duration) *recordCache[T] {
+	c := &recordCache[T]{model: model, ttl: ttl, entries: make(map[uint]map[string]cacheEntry[T])}
+	cachesMu.Lock()
+	caches = append(caches, c)
+	cachesMu.Unlock()
+	return c
+}
+
+// get returns a copy of the record with the given ID cached in the scope.
+func (c *recordCache[T]) get(id uint, scope string) (*T, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[id][scope]
+	if ok && time.Now().After(entry.expires) {
+		c.remove(id, scope)
+		ok = false
+	}
+	if ok {
+		c.counts.Hits++
+	} else {
+		c.counts.Misses++
+	}
+	c.mu.Unlock()
+	if CacheObserver != nil {
+		CacheObserver(c.model, ok)
+	}
+	if !ok {
+		return nil, false
+	}
+	record := entry.record
+	return &record, true
+}
+
+// set caches a copy of the record with the given ID in the scope.
+func (c *recordCache[T]) set(id uint, scope string, record *T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[id][scope]; !ok && c.size >= MaxCachedRecords {
+		c.makeRoom()
+		if c.size >= MaxCachedRecords {
+			return
+		}
+	}
+	if c.entries[id] == nil {
+		c.entries[id] = make(map[string]cacheEntry[T])
+	}
+	if _, ok := c.entries[id][scope]; !ok {
+		c.size++
+	}
+	c.entries[id][scope] = cacheEntry[T]{record: *record, expires: time.Now().Add(c.ttl)}
+}
+
+// evict removes the record with the given ID from every scope.
+func (c *recordCache[T]) evict(id uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for scope := range c.entries[id] {
+		c.remove(id, scope)
+	}
+}
+
+// remove removes a cached record. c.mu must be held.
+func (c *recordCache[T]) remove(id uint, scope string) {
+	delete(c.entries[id], scope)
+	if len(c.entries[id]) == 0 {
+		delete(c.entries, id)
+	}
+	c.size--
+	c.counts.Evictions++
+}
+
+// makeRoom removes the expired records, or a tenth of the records if none has expired. c.mu must be held.
+func (c *recordCache[T]) makeRoom() {
+	now := time.Now()
+	for id, scopes := range c.entries {
+		for scope, entry := range scopes {
+			if now.After(entry.expires) {
+				c.remove(id, scope)
+			}
+		}
+	}
+	for id, scopes := range c.entries {
+		if c.size < MaxCachedRecords*9/10 {
+			return
+		}
+		for scope := range scopes {
+			c.remove(id, scope)
+		}
+	}
+}
+
+func (c *recordCache[T]) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.counts
+	stats.Model, stats.Size = c.model, c.size
+	return stats
+}
+
+func (c *recordCache[T]) resetCounts() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts = CacheStats{}
+}
+
+func (c *recordCache[T]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[uint]map[string]cacheEntry[T])
+	c.size = 0
+}
+
+// sessionScope returns the scope of the records a context may read: its tenant and the values of the session
+// settings read by the row-level security policies of their table.
+func sessionScope(ctx context.Context, tenant string, settings []string) string {
+	values := []string{tenant}
+	for _, setting := range settings {
+		value, _ := ctx.Value(sessionKey(setting)).(string)
+		values = append(values, value)
+	}
+	return strings.Join(values, "\x00")
+}
+
+// StatementTimeout bounds how long the statements of a repository call may run, cancelling them and rolling
+// back their transaction once it elapses. A deadline of the context coming first still applies; 0, the
+// default, leaves calls bounded by their context only.
+var StatementTimeout time.Duration
+
+// runSession runs fn against db, in a transaction applying the settings when inTx is set, see withSession.
+func runSession(ctx context.Context, db *sql.DB, settings []string, inTx bool, fn func(q querier) error) error {
+	if StatementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, StatementTimeout)
+		defer cancel()
+		run := fn
+		fn = func(q querier) error { return run(timedQuerier{q: q, ctx: ctx}) }
+	}
+	if TagQueries {
+		tag, run := callerTag(), fn
+		fn = func(q querier) error { return run(taggedQuerier{q: q, tag: tag}) }
+	}
+	if !inTx {
+		return fn(preparedDB{db: db})
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, setting := range settings {
+		value, ok := ctx.Value(sessionKey(setting)).(string)
+		if !ok {
+			return fmt.Errorf("row-level security requires %s to be set in the context", setting)
+		}
+		if _, err := tx.ExecContext(ctx, "SELECT set_config($1, $2, true)", setting, value); err != nil {
+			return err
+		}
+	}
+	if err := fn(preparedTx{tx: tx, db: db}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// timedQuerier runs the statements it is given with the context of its session, which is bounded by
+// StatementTimeout.
+type timedQuerier struct {
+	q   querier
+	ctx context.Context
+}
+
+func (t timedQuerier) ExecContext(_ context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.q.ExecContext(t.ctx, query, args...)
+}
+
+func (t timedQuerier) QueryContext(_ context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.q.QueryContext(t.ctx, query, args...)
+}
+
+func (t timedQuerier) QueryRowContext(_ context.Context, query string, args ...interface{}) *sql.Row {
+	return t.q.QueryRowContext(t.ctx, query, args...)
+}
+
+// MaxCachedStatements is the number of prepared statements repositories keep, least recently used closed
+// first. Statements are prepared once per database and query text, then reused by every call running the
+// query; 0 disables the cache.
+var MaxCachedStatements = 256
+
+// StatementStats counts the statements repositories ran, see StatementCacheStats. Evictions counts the
+// statements closed to make room, or because running them failed.
+type StatementStats struct {
+	Hits      int64 ` + "`json:\"hits\"`" + `
+	Misses    int64 ` + "`json:\"misses\"`" + `
+	Evictions int64 ` + "`json:\"evictions\"`" + `
+	Size      int   ` + "`json:\"size\"`" + `
+}
+
+// HitRate returns the share of the statements run with a statement prepared earlier.
+func (s StatementStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// StatementCacheStats returns the counts of the statement cache since the process started, or since
+// ResetStats.
+func StatementCacheStats() StatementStats {
+	statements.mu.Lock()
+	defer statements.mu.Unlock()
+	return StatementStats{
+		Hits:      statements.hits,
+		Misses:    statements.misses,
+		Evictions: statements.evictions,
+		Size:      statements.order.Len(),
+	}
+}
+
+// statementKey identifies a prepared statement: statements belong to the database they were prepared on.
+type statementKey struct {
+	db    *sql.DB
+	query string
+}
+
+type cachedStatement struct {
+	key  statementKey
+	stmt *sql.Stmt
+}
+
+// statementCache is the LRU cache of the statements prepared by repositories.
+type statementCache struct {
+	mu                      sync.Mutex
+	entries                 map[statementKey]*list.Element
+	order                   *list.List // of *cachedStatement, most recently used first
+	hits, misses, evictions int64
+}
+
+var statements = &statementCache{entries: make(map[statementKey]*list.Element), order: list.New()}
+
+// prepare returns the statement of query on db, preparing it unless it is cached, or nil when the cache is
+// disabled.
+func (c *statementCache) prepare(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	if MaxCachedStatements <= 0 {
+		return nil, nil
+	}
+	key := statementKey{db: db, query: query}
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		c.hits++
+		c.mu.Unlock()
+		return e.Value.(*cachedStatement).stmt, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		// Prepared concurrently: keep the statement cached first.
+		stmt.Close()
+		c.order.MoveToFront(e)
+		return e.Value.(*cachedStatement).stmt, nil
+	}
+	c.entries[key] = c.order.PushFront(&cachedStatement{key: key, stmt: stmt})
+	for c.order.Len() > MaxCachedStatements {
+		c.remove(c.order.Back())
+	}
+	return stmt, nil
+}
+
+// evict closes the statement of query on db, after running it failed, e.g. because its table changed.
+func (c *statementCache) evict(db *sql.DB, query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[statementKey{db: db, query: query}]; ok {
+		c.remove(e)
+	}
+}
+
+func (c *statementCache) remove(e *list.Element) {
+	entry := c.order.Remove(e).(*cachedStatement)
+	delete(c.entries, entry.key)
+	entry.stmt.Close()
+	c.evictions++
+}
+
+// preparedDB runs the statements of repositories outside transactions with the statement cache.
+type preparedDB struct {
+	db *sql.DB
+}
+
+func (p preparedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := statements.prepare(ctx, p.db, query)
+	if stmt == nil || err != nil {
+		return p.db.ExecContext(ctx, query, args...)
+	}
+	result, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		statements.evict(p.db, query)
+	}
+	return result, err
+}
+
+func (p preparedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := statements.prepare(ctx, p.db, query)
+	if stmt == nil || err != nil {
+		return p.db.QueryContext(ctx, query, args...)
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		statements.evict(p.db, query)
+	}
+	return rows, err
+}
+
+func (p preparedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	stmt, err := statements.prepare(ctx, p.db, query)
+	if stmt == nil || err != nil {
+		return p.db.QueryRowContext(ctx, query, args...)
+	}
+	row := stmt.QueryRowContext(ctx, args...)
+	if row.Err() != nil {
+		statements.evict(p.db, query)
+	}
+	return row
+}
+
+// preparedTx runs the statements of repositories in a transaction of db with the statement cache, binding the
+// cached statements to the transaction.
+type preparedTx struct {
+	tx *sql.Tx
+	db *sql.DB
+}
+
+func (p preparedTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := statements.prepare(ctx, p.db, query)
+	if stmt == nil || err != nil {
+		return p.tx.ExecContext(ctx, query, args...)
+	}
+	result, err := p.tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+	if err != nil {
+		statements.evict(p.db, query)
+	}
+	return result, err
+}
+
+func (p preparedTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := statements.prepare(ctx, p.db, query)
+	if stmt == nil || err != nil {
+		return p.tx.QueryContext(ctx, query, args...)
+	}
+	rows, err := p.tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+	if err != nil {
+		statements.evict(p.db, query)
+	}
+	return rows, err
+}
+
+func (p preparedTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	stmt, err := statements.prepare(ctx, p.db, query)
+	if stmt == nil || err != nil {
+		return p.tx.QueryRowContext(ctx, query, args...)
+	}
+	row := p.tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+	if row.Err() != nil {
+		statements.evict(p.db, query)
+	}
+	return row
+}
+
+// TagQueries, when set, prefixes the statements of repositories with a comment naming the code calling the
+// repository, e.g. /* caller=main.handle:main.go:42 */, which shows in pg_stat_activity and the database logs
+// so that long transactions can be traced back to their caller, see MonitorTransactions.
+var TagQueries = false
+
+// taggedQuerier prefixes the statements it runs with a tag.
+type taggedQuerier struct {
+	q   querier
+	tag string
+}
+
+func (t taggedQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.q.ExecContext(ctx, t.tag+query, args...)
+}
+
+func (t taggedQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.q.QueryContext(ctx, t.tag+query, args...)
+}
+
+func (t taggedQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.q.QueryRowContext(ctx, t.tag+query, args...)
+}
+
+// callerTag returns the comment naming the first caller outside this package, or "" if there is none.
+func callerTag() string {
+	if caller := caller(); caller != "" {
+		return "/* caller=" + strings.ReplaceAll(caller, "*/", "") + " */ "
+	}
+	return ""
+}
+
+// caller returns the function, file and line of the first caller outside this package, as
+// main.handle:main.go:42, or "" if there is none.
+func caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	self, more := frames.Next()
+	pkg := strings.TrimSuffix(self.Function, "caller")
+	for more {
+		var frame runtime.Frame
+		frame, more = frames.Next()
+		if !strings.HasPrefix(frame.Function, pkg) {
+			return fmt.Sprintf("%s:%s:%d", frame.Function, filepath.Base(frame.File), frame.Line)
+		}
+	}
+	return ""
+}
+
+// LongTransaction is a transaction found by MonitorTransactions. Caller is read from the tag of its last
+// statement, see TagQueries.
+type LongTransaction struct {
+	PID             int
+	State           string
+	ApplicationName string
+	Age             time.Duration
+	Query           string
+	Caller          string
+}
+
+// MonitorTransactions checks the transactions of db's database every interval until ctx is done, and calls
+// report once for every transaction open for longer than threshold, e.g. one left open by a leaked *sql.Tx
+// ("idle in transaction"). It returns the error that stopped it, ctx.Err() when ctx is done.
+func MonitorTransactions(ctx context.Context, db *sql.DB, threshold, interval time.Duration, report func(LongTransaction)) error {
+	type key struct {
+		pid   int
+		start time.Time
+	}
+	reported := make(map[key]bool)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		rows, err := db.QueryContext(ctx, ` + "`" + `SELECT pid, COALESCE(state, ''), application_name, xact_start,
+			EXTRACT(EPOCH FROM now() - xact_start), COALESCE(query, '')
+			FROM pg_stat_activity
+			WHERE datname = current_database() AND pid <> pg_backend_pid() AND now() - xact_start > $1 * interval '1 second'` + "`" + `,
+			threshold.Seconds())
+		if err != nil {
+			return err
+		}
+		seen := make(map[key]bool)
+		for rows.Next() {
+			var tx LongTransaction
+			var start time.Time
+			var seconds float64
+			if err := rows.Scan(&tx.PID, &tx.State, &tx.ApplicationName, &start, &seconds, &tx.Query); err != nil {
+				rows.Close()
+				return err
+			}
+			k := key{tx.PID, start}
+			seen[k] = true
+			if reported[k] {
+				continue
+			}
+			reported[k] = true
+			tx.Age = time.Duration(seconds * float64(time.Second))
+			if i := strings.Index(tx.Query, "/* caller="); i >= 0 {
+				if end := strings.Index(tx.Query[i:], " */"); end >= 0 {
+					tx.Caller = tx.Query[i+len("/* caller=") : i+end]
+				}
+			}
+			report(tx)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for k := range reported {
+			if !seen[k] {
+				delete(reported, k)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// LeakDetector wraps a pool during development to find connections, transactions and rows that are never
+// released: it records the stack acquiring each of them, and reports the ones not released within a threshold
+// with that stack. Statements run through the embedded *sql.DB, including the repositories given DB, are not
+// tracked. Recording stacks is costly, so wrap the pool in development only.
+type LeakDetector struct {
+	*sql.DB
+	threshold time.Duration
+	report    func(Leak)
+}
+
+// Leak is a connection ("conn"), transaction ("tx") or result set ("rows") still checked out from a pool after
+// the threshold of a LeakDetector, with the stack that acquired it.
+type Leak struct {
+	Kind  string
+	Age   time.Duration
+	Stack string
+}
+
+// DetectLeaks wraps db in a LeakDetector reporting leaks with report, or logging them if report is nil.
+func DetectLeaks(db *sql.DB, threshold time.Duration, report func(Leak)) *LeakDetector {
+	if report == nil {
+		report = func(leak Leak) {
+			log.Printf("%s not released after %s, acquired at:\n%s", leak.Kind, leak.Age, leak.Stack)
+		}
+	}
+	return &LeakDetector{DB: db, threshold: threshold, report: report}
+}
+
+// track starts tracking a checkout of the given kind, and returns the function releasing it.
+func (d *LeakDetector) track(kind string) func() {
+	stack := string(debug.Stack())
+	timer := time.AfterFunc(d.threshold, func() {
+		d.report(Leak{Kind: kind, Age: d.threshold, Stack: stack})
+	})
+	return func() { timer.Stop() }
+}
+
+// Conn returns a connection of the pool, tracked until it is closed.
+func (d *LeakDetector) Conn(ctx context.Context) (*TrackedConn, error) {
+	conn, err := d.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &TrackedConn{Conn: conn, release: d.track("conn")}, nil
+}
+
+// Begin starts a transaction, tracked until it is committed or rolled back.
+func (d *LeakDetector) Begin() (*TrackedTx, error) {
+	return d.BeginTx(context.Background(), nil)
+}
+
+// BeginTx starts a transaction, tracked until it is committed or rolled back.
+func (d *LeakDetector) BeginTx(ctx context.Context, opts *sql.TxOptions) (*TrackedTx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TrackedTx{Tx: tx, release: d.track("tx")}, nil
+}
+
+// Query runs a query, whose rows are tracked until they are closed or read to the end.
+func (d *LeakDetector) Query(query string, args ...interface{}) (*TrackedRows, error) {
+	return d.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext runs a query, whose rows are tracked until they are closed or read to the end.
+func (d *LeakDetector) QueryContext(ctx context.Context, query string, args ...interface{}) (*TrackedRows, error) {
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &TrackedRows{Rows: rows, release: d.track("rows")}, nil
+}
+
+// TrackedConn is a connection checked out from a LeakDetector.
+type TrackedConn struct {
+	*sql.Conn
+	release func()
+}
+
+// Close returns the connection to the pool.
+func (c *TrackedConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
+
+// TrackedTx is a transaction started from a LeakDetector.
+type TrackedTx struct {
+	*sql.Tx
+	release func()
+}
+
+// Commit commits the transaction.
+func (t *TrackedTx) Commit() error {
+	t.release()
+	return t.Tx.Commit()
+}
+
+// Rollback rolls the transaction back.
+func (t *TrackedTx) Rollback() error {
+	t.release()
+	return t.Tx.Rollback()
+}
+
+// TrackedRows are the rows of a query run from a LeakDetector.
+type TrackedRows struct {
+	*sql.Rows
+	release func()
+}
+
+// Next prepares the next row; rows read to the end are closed, and released.
+func (r *TrackedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.release()
+	return false
+}
+
+// Close closes the rows.
+func (r *TrackedRows) Close() error {
+	r.release()
+	return r.Rows.Close()
+}
+
+// Hooks are methods a model may implement to run business logic around the statements of its repository,
+// without editing generated code. The repository calls the hooks a model implements with the context of the
+// operation; a hook returning an error aborts the operation with that error. Before hooks run before the
+// statement, which is not run if they fail. After hooks run in the transaction of the statement, which is
+// rolled back if they fail.
+type (
+	// BeforeSaveHook is called by Create and Update, before BeforeCreate and BeforeUpdate, and by Upsert.
+	BeforeSaveHook interface {
+		BeforeSave(ctx context.Context) error
+	}
+	// BeforeCreateHook is called by Create and CreateBatch before the record is inserted.
+	BeforeCreateHook interface {
+		BeforeCreate(ctx context.Context) error
+	}
+	// AfterCreateHook is called by Create and CreateBatch once the record is inserted and its ID set, and by
+	// Upsert once it inserted the record.
+	AfterCreateHook interface {
+		AfterCreate(ctx context.Context) error
+	}
+	// BeforeUpdateHook is called by Update before the record is written.
+	BeforeUpdateHook interface {
+		BeforeUpdate(ctx context.Context) error
+	}
+	// AfterUpdateHook is called by Update once the record is written, and by Upsert once it updated the
+	// record.
+	AfterUpdateHook interface {
+		AfterUpdate(ctx context.Context) error
+	}
+	// BeforeDeleteHook is called by Delete, on the record as stored, before it is deleted.
+	BeforeDeleteHook interface {
+		BeforeDelete(ctx context.Context) error
+	}
+	// AfterDeleteHook is called by Delete, on the record as stored, once it is deleted.
+	AfterDeleteHook interface {
+		AfterDelete(ctx context.Context) error
+	}
+)
+
+// hasHooks reports whether m implements any hook.
+func hasHooks(m interface{}) bool {
+	switch m.(type) {
+	case BeforeSaveHook, BeforeCreateHook, AfterCreateHook, BeforeUpdateHook, AfterUpdateHook:
+		return true
+	}
+	return hasDeleteHooks(m)
+}
+
+// hasDeleteHooks reports whether m implements a hook called by Delete, which then loads the record first.
+func hasDeleteHooks(m interface{}) bool {
+	switch m.(type) {
+	case BeforeDeleteHook, AfterDeleteHook:
+		return true
+	}
+	return false
+}
+
+// beforeCreate calls the BeforeSave and BeforeCreate hooks of m.
+func beforeCreate(ctx context.Context, m interface{}) error {
+	if h, ok := m.(BeforeSaveHook); ok {
+		if err := h.BeforeSave(ctx); err != nil {
+			return err
+		}
+	}
+	if h, ok := m.(BeforeCreateHook); ok {
+		return h.BeforeCreate(ctx)
+	}
+	return nil
+}
+
+// afterCreate calls the AfterCreate hook of m.
+func afterCreate(ctx context.Context, m interface{}) error {
+	if h, ok := m.(AfterCreateHook); ok {
+		return h.AfterCreate(ctx)
+	}
+	return nil
+}
+
+// beforeSave calls the BeforeSave hook of m.
+func beforeSave(ctx context.Context, m interface{}) error {
+	if h, ok := m.(BeforeSaveHook); ok {
+		return h.BeforeSave(ctx)
+	}
+	return nil
+}
+
+// beforeUpdate calls the BeforeSave and BeforeUpdate hooks of m.
+func beforeUpdate(ctx context.Context, m interface{}) error {
+	if h, ok := m.(BeforeSaveHook); ok {
+		if err := h.BeforeSave(ctx); err != nil {
+			return err
+		}
+	}
+	if h, ok := m.(BeforeUpdateHook); ok {
+		return h.BeforeUpdate(ctx)
+	}
+	return nil
+}
+
+// afterUpdate calls the AfterUpdate hook of m.
+func afterUpdate(ctx context.Context, m interface{}) error {
+	if h, ok := m.(AfterUpdateHook); ok {
+		return h.AfterUpdate(ctx)
+	}
+	return nil
+}
+
+// beforeDelete calls the BeforeDelete hook of m.
+func beforeDelete(ctx context.Context, m interface{}) error {
+	if h, ok := m.(BeforeDeleteHook); ok {
+		return h.BeforeDelete(ctx)
+	}
+	return nil
+}
+
+// afterDelete calls the AfterDelete hook of m.
+func afterDelete(ctx context.Context, m interface{}) error {
+	if h, ok := m.(AfterDeleteHook); ok {
+		return h.AfterDelete(ctx)
+	}
+	return nil
+}
+
+// Operations of the events published by repositories.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Event is a change of a record made by a repository, published to the subscribers once committed.
+type Event struct {
+	Table string
+	Op    string
+	ID    uint
+	// Record is the record created or updated, a pointer to its model, and nil for deletions.
+	Record interface{}
+}
+
+var (
+	subscribersMu  sync.RWMutex
+	subscribers    = make(map[int]func(context.Context, Event))
+	nextSubscriber int
+)
+
+// Subscribe calls fn with the events of every repository, after the change is committed, with the context
+// of the operation, until the returned function is called. Subscribers run synchronously, in no particular
+// order, and should hand slow work, such as calls to other services, to a queue.
+func Subscribe(fn func(ctx context.Context, e Event)) (unsubscribe func()) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	id := nextSubscriber
+	nextSubscriber++
+	subscribers[id] = fn
+	return func() {
+		subscribersMu.Lock()
+		defer subscribersMu.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+// publish calls the subscribers with an event.
+func publish(ctx context.Context, e Event) {
+	subscribersMu.RLock()
+	fns := make([]func(context.Context, Event), 0, len(subscribers))
+	for _, fn := range subscribers {
+		fns = append(fns, fn)
+	}
+	subscribersMu.RUnlock()
+	for _, fn := range fns {
+		fn(ctx, e)
+	}
+}
+
+// requireAffected returns sql.ErrNoRows if the statement producing result changed no rows.
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DefaultPageSize is the size of the pages selected by a PageRequest without a Limit, and MaxPageSize the
+// largest page a PageRequest may select. Applications may change them at startup.
+var (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// ErrInvalidPage is returned for a PageRequest that selects no valid page.
+var ErrInvalidPage = errors.New("invalid page request")
+
+// PageRequest selects a page of records ordered by ID. The following pages are selected with the NextCursor
+// of the previous page, which stays correct while records are inserted and deleted, or with an Offset. Limit
+// defaults to DefaultPageSize and is capped at MaxPageSize.
+type PageRequest struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// Page is a page of records. Total counts every record, and NextCursor selects the next page; it is empty on
+// the last page.
+type Page[T any] struct {
+	Items      []T    ` + "`json:\"items\"`" + `
+	Total      int64  ` + "`json:\"total\"`" + `
+	NextCursor string ` + "`json:\"next_cursor,omitempty\"`" + `
+}
+
+// bounds returns the number of records of the page, the number of records to skip, and the ID after which the
+// page starts.
+func (p PageRequest) bounds() (limit, offset int, after uint64, err error) {
+	switch {
+	case p.Limit < 0 || p.Offset < 0:
+		return 0, 0, 0, fmt.Errorf("%w: negative limit or offset", ErrInvalidPage)
+	case p.Cursor != "" && p.Offset > 0:
+		return 0, 0, 0, fmt.Errorf("%w: both a cursor and an offset", ErrInvalidPage)
+	}
+	limit = p.Limit
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if p.Cursor != "" {
+		id, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+		if err == nil {
+			after, err = strconv.ParseUint(string(id), 10, 64)
+		}
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("%w: malformed cursor %q", ErrInvalidPage, p.Cursor)
+		}
+	}
+	return limit, p.Offset, after, nil
+}
+
+// newPage returns the page of items selected with one record more than limit, which tells whether another page
+// follows.
+func newPage[T any](items []T, total int64, limit int, id func(T) uint) *Page[T] {
+	page := &Page[T]{Items: items, Total: total}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id(items[limit-1])), 10)))
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return page
+}
+
+// RowLimitAction is what repositories do when a query without pagination, such as List, reads more than
+// RowLimit rows.
+type RowLimitAction int
+
+const (
+	// RowLimitWarn logs the query with the code calling the repository, and returns every row.
+	RowLimitWarn RowLimitAction = iota
+	// RowLimitError fails the query with an error wrapping ErrTooManyRows.
+	RowLimitError
+	// RowLimitIgnore returns every row.
+	RowLimitIgnore
+)
+
+// RowLimit is the number of rows a query without pagination reads before OnRowLimit applies; 0 disables the
+// check. They catch accidental loads of whole tables, which ListPage reads a page at a time instead.
+// Applications may change them at startup, e.g. to fail in tests and warn in production.
+var (
+	RowLimit   = 10000
+	OnRowLimit = RowLimitWarn
+)
+
+// ErrTooManyRows is matched by the errors of queries reading more than RowLimit rows with RowLimitError.
+var ErrTooManyRows = errors.New("too many rows")
+
+// checkRowLimit applies OnRowLimit once a query of table without pagination has read rows rows.
+func checkRowLimit(table string, rows int) error {
+	if RowLimit <= 0 || rows != RowLimit+1 || OnRowLimit == RowLimitIgnore {
+		return nil
+	}
+	err := fmt.Errorf("%w: a query of %s read more than %d rows without pagination", ErrTooManyRows, table, RowLimit)
+	if OnRowLimit == RowLimitError {
+		return err
+	}
+	log.Printf("%v, called from %s", err, caller())
+	return nil
+}
+
+// ErrStaleObject is matched by the errors of updates of records modified concurrently, see StaleObjectError.
+var ErrStaleObject = errors.New("stale object")
+
+// StaleObjectError is returned by the Update method of repositories of models with optimistic locking when the
+// record was updated since it was read, so that writing it would lose that update. Reload the record and apply
+// the change again. It matches ErrStaleObject with errors.Is.
+type StaleObjectError struct {
+	Model   string
+	ID      uint
+	Version int
+}
+
+// Error describes the stale record.
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("%s %d was modified concurrently: version %d is stale", e.Model, e.ID, e.Version)
+}
+
+// Unwrap returns ErrStaleObject.
+func (e *StaleObjectError) Unwrap() error {
+	return ErrStaleObject
+}
+
+// requireVersion checks the result of an update conditioned on the version of a record. It returns
+// sql.ErrNoRows if the statement changed no rows because the record does not exist, as told by the exists query
+// run with args, and a *StaleObjectError if the record has another version.
+func requireVersion(ctx context.Context, q querier, result sql.Result, model string, id uint, version int, exists string, args ...interface{}) error {
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	var found bool
+	if err := q.QueryRowContext(ctx, exists, args...).Scan(&found); err != nil {
+		return err
+	}
+	if !found {
+		return sql.ErrNoRows
+	}
+	return &StaleObjectError{Model: model, ID: id, Version: version}
+}
+
+// Vector is a pgvector embedding. It is stored in vector(n) columns.
+type Vector []float32
+
+// Value implements driver.Valuer using the text representation of pgvector, e.g. "[1,2,3]".
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	parts := make([]string, len(v))
+	for i, x := range v {
+		parts[i] = strconv.FormatFloat(float64(x), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]", nil
+}
+
+// Scan implements sql.Scanner for the text representation of pgvector.
+func (v *Vector) Scan(src interface{}) error {
+	var text string
+	switch src := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		text = string(src)
+	case string:
+		text = src
+	default:
+		return fmt.Errorf("cannot scan %T into a Vector", src)
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "["), "]")
+	vector := Vector{}
+	if text != "" {
+		for _, part := range strings.Split(text, ",") {
+			x, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+			if err != nil {
+				return fmt.Errorf("invalid vector component %q: %w", part, err)
+			}
+			vector = append(vector, float32(x))
+		}
+	}
+	*v = vector
+	return nil
+}
+
+// DistanceMetric is a distance used by nearest-neighbor queries on vector fields. Searches are fastest with the
+// metric the field's index was created for.
+type DistanceMetric string
+
+// Distance metrics supported by pgvector.
+const (
+	DistanceL2           DistanceMetric = "l2"
+	DistanceCosine       DistanceMetric = "cosine"
+	DistanceInnerProduct DistanceMetric = "inner_product"
+)
+
+// distanceOperator returns the pgvector operator computing the given distance.
+func distanceOperator(metric DistanceMetric) (string, error) {
+	switch metric {
+	case DistanceL2:
+		return "<->", nil
+	case DistanceCosine:
+		return "<=>", nil
+	case DistanceInnerProduct:
+		return "<#>", nil
+	default:
+		return "", fmt.Errorf("unknown distance metric %q", metric)
+	}
 }
 `
 
+// typePackages maps the package qualifiers that may appear in field types to their import paths.
+var typePackages = map[string]string{
+	"json": "encoding/json",
+	"sql":  "database/sql",
+	"time": "time",
+}
+
+// fieldDefault is a field initialized by the generated constructor of a model.
+type fieldDefault struct {
+	GoName string
+	Value  string
+}
+
+// fieldDefaults returns the fields of a model initialized by its generated constructor, see goDefault.
+func fieldDefaults(def *ModelDefinition) []fieldDefault {
+	var defaults []fieldDefault
+	for _, field := range def.Fields {
+		if value := goDefault(def.Name, field); value != "" {
+			defaults = append(defaults, fieldDefault{GoName: goFieldName(field.Name), Value: value})
+		}
+	}
+	return defaults
+}
+
+// fieldImports returns the sorted import paths needed by the types of the given fields, including the
+// packages of registered custom types and those used by the methods of generated enum types.
+func fieldImports(fields []Field) []string {
+	seen := make(map[string]bool)
+	if hasEnumFields(fields) {
+		seen["database/sql/driver"] = true
+		seen["fmt"] = true
+	}
+	for _, field := range fields {
+		if t, ok := customTypes[elementType(field.Type)]; ok && t.Import != "" {
+			seen[t.Import] = true
+			continue
+		}
+		for qualifier, importPath := range typePackages {
+			if usesQualifier(field.Type, qualifier) {
+				seen[importPath] = true
+			}
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// usesQualifier reports whether a type expression refers to a type of the package with the given qualifier, so
+// that "sql." is found in "*sql.NullString" but not in "mysql.NullTime".
+func usesQualifier(goType, qualifier string) bool {
+	return regexp.MustCompile(`(^|[^A-Za-z0-9_])` + regexp.QuoteMeta(qualifier) + `\.`).MatchString(goType)
+}
+
 // GenerateModelFile generates a model file based on the provided model definition.
 // The function uses a template to define the structure and fields of the model.
 // The template includes necessary import statements and generates the necessary struct tags for JSON serialization.
 // The generated model file is saved in the specified output directory, or in the default "models" directory if no output directory is provided.
 // Returns an error if there is any issue parsing the template, creating the output directory, creating the file, executing the template, or any other related error.
 func GenerateModelFile(modelDef *ModelDefinition) error {
-	caser := cases.Title(language.English)
-	tmpl, err := template.New("model").Funcs(template.FuncMap{
-		"toLower": strings.ToLower,
-		"firstLetter": func(s string) string {
-			return strings.ToLower(s[:1])
-		},
-		"title": caser.String,
-	}).Parse(modelTemplate)
+	return GenerateModelFileFS(filesystem.NewOSFS(""), modelDef)
+}
+
+// GenerateModelFileFS behaves like GenerateModelFile but writes the generated file to the given file system.
+// The file declaring the embedded DefaultModel is written next to it. The template is rendered fully in memory
+// before anything is written, so a failing template never leaves a truncated file behind.
+func GenerateModelFileFS(fsys filesystem.FS, modelDef *ModelDefinition) error {
+	file, err := RenderModelFile(modelDef)
 	if err != nil {
-		return fmt.Errorf("error parsing template: %w", err)
+		return err
 	}
-
-	outputDir := modelDef.OutputDir
-	if outputDir == "" {
-		outputDir = "models"
+	if err := file.Write(fsys); err != nil {
+		return err
 	}
+	return RenderModelBaseFile(modelDef).Write(fsys)
+}
+
+// GeneratedFile is a rendered artifact that has not been written yet. Path is slash-separated and relative to
+// the project root unless the model's output directory is absolute.
+type GeneratedFile struct {
+	Path    string
+	Content []byte
+}
 
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
+// Write creates the parent directory of the generated file on the given file system and writes its content.
+func (f *GeneratedFile) Write(fsys filesystem.FS) error {
+	if err := fsys.MkdirAll(path.Dir(f.Path), 0755); err != nil {
 		return fmt.Errorf("error creating output directory: %w", err)
 	}
+	if err := fsys.WriteFile(f.Path, f.Content, 0644); err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	return nil
+}
 
-	fileName := filepath.Join(outputDir, strings.ToLower(modelDef.Name)+".go")
-	file, err := os.Create(fileName)
+// RenderModelFile renders the model template, or its override, for the given definition without touching any
+// file system.
+// Rendering is deterministic: the same definition and template always produce byte-identical output, which
+// is what the generation manifest relies on.
+func RenderModelFile(modelDef *ModelDefinition) (*GeneratedFile, error) {
+	tmpl, err := template.New("model").Funcs(templateFuncs).Parse(templateSource("model"))
 	if err != nil {
-		return fmt.Errorf("error creating file: %w", err)
+		return nil, fmt.Errorf("error parsing template: %w", err)
 	}
-	defer file.Close()
 
-	if err := tmpl.Execute(file, modelDef); err != nil {
-		return fmt.Errorf("error executing template: %w", err)
+	def := *modelDef
+	def.Fields = ownFields(modelDef)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &def); err != nil {
+		return nil, fmt.Errorf("error executing template: %w", err)
 	}
 
-	return nil
+	content, err := formatGo(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error formatting model: %w", err)
+	}
+
+	return &GeneratedFile{
+		Path:    path.Join(modelOutputDir(modelDef), strings.ToLower(modelDef.Name)+".go"),
+		Content: content,
+	}, nil
+}
+
+// RenderModelBaseFile renders the file declaring the DefaultModel embedded by the models generated into the
+// definition's output directory.
+func RenderModelBaseFile(modelDef *ModelDefinition) *GeneratedFile {
+	return &GeneratedFile{
+		Path:    path.Join(modelOutputDir(modelDef), "default_model.go"),
+		Content: []byte(templateSource("model-base")),
+	}
+}
+
+// RenderModelFiles renders every Go file generated for a model: the model struct, the DefaultModel it embeds,
+// its repository and, for models with search fields, the search support, and for models with encrypted fields,
+// the encryption support.
+func RenderModelFiles(modelDef *ModelDefinition) ([]*GeneratedFile, error) {
+	modelFile, err := RenderModelFile(modelDef)
+	if err != nil {
+		return nil, err
+	}
+	repositoryFile, err := RenderRepositoryFile(modelDef)
+	if err != nil {
+		return nil, err
+	}
+	files := []*GeneratedFile{modelFile, RenderModelBaseFile(modelDef), repositoryFile}
+	if len(modelDef.Options.SearchFields) > 0 {
+		files = append(files, RenderSearchFile(modelDef))
+	}
+	if hasEncryptedFields(modelDef) {
+		files = append(files, RenderEncryptionFile(modelDef))
+	}
+	return files, nil
+}
+
+// templateSources maps the name of every built-in generation template to its source. It is used to derive
+// template versions for the generation manifest.
+var templateSources = map[string]string{
+	"model":         modelTemplate,
+	"model-base":    modelBaseFile,
+	"repository":    repositoryTemplate,
+	"service-proto": serviceProtoTemplate,
+	"grpc-server":   grpcServerTemplate,
+	"grpc-support":  grpcSupportTemplate,
+	"auth":          authTemplate,
+	"search":        searchTemplate,
+	"encryption":    encryptionTemplate,
+	"kv-repository": kvRepositoryTemplate,
+	"kv-store":      kvStoreFile,
 }
 
 // LoadModelDefinition loads the definition of a model with the given name. It returns
@@ -0,0 +1,610 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// GRPCOptions controls where gRPC scaffolding is written and which packages the generated server imports.
+type GRPCOptions struct {
+	// ProtoDir is the directory the message and service .proto files are written to.
+	ProtoDir string
+	// ServerDir is the directory the server implementation is written to. Its package is named grpcserver.
+	ServerDir string
+	// ProtoPackage is the protobuf package of the generated files. It defaults to "models".
+	ProtoPackage string
+	// GoModule is the module path of the app. The server imports the generated models from
+	// <GoModule>/internal/models and the protoc output from <GoModule>/internal/pb.
+	GoModule string
+}
+
+// ModelsImportPath returns the import path of the package holding the generated models and repositories.
+func (o GRPCOptions) ModelsImportPath() string {
+	return o.GoModule + "/internal/models"
+}
+
+// PBImportPath returns the import path protoc is expected to write the generated Go code to.
+func (o GRPCOptions) PBImportPath() string {
+	return o.GoModule + "/internal/pb"
+}
+
+func (o GRPCOptions) withDefaults() GRPCOptions {
+	if o.ProtoDir == "" {
+		o.ProtoDir = "proto"
+	}
+	if o.ServerDir == "" {
+		o.ServerDir = "internal/grpcserver"
+	}
+	if o.ProtoPackage == "" {
+		o.ProtoPackage = "models"
+	}
+	return o
+}
+
+// serviceProtoTemplate is the template for the service definition generated next to a model's message. The
+// service exposes Create, Get, List, Update, and Delete RPCs that map onto the model's repository.
+const serviceProtoTemplate = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+syntax = "proto3";
+
+package {{.ProtoPackage}};
+
+import "google/protobuf/empty.proto";
+import "{{.MessageFile}}";
+
+option go_package = "{{.GoPackage}}";
+
+message Get{{.Name}}Request {
+    uint64 id = 1;
+}
+
+message List{{.Name}}Request {
+    int32 page_size = 1;
+    string page_token = 2;
+    int32 offset = 3;
+}
+
+message List{{.Name}}Response {
+    repeated {{.Name}} items = 1;
+    int64 total = 2;
+    string next_page_token = 3;
+}
+
+message Delete{{.Name}}Request {
+    uint64 id = 1;
+}
+
+service {{.Name}}Service {
+{{- range .RPCs}}
+    rpc {{.Method}}({{.Request}}) returns ({{.Response}});
+{{- end}}
+}
+`
+
+// GRPCRoute is an RPC of the service generated for a model.
+type GRPCRoute struct {
+	Method   string // method name, e.g. "Get"
+	Path     string // full method name gRPC routes calls by, e.g. "/models.UserService/Get"
+	Request  string // request message
+	Response string // response message
+}
+
+// GRPCRoutes returns the RPCs of the service generated for the named model in the given protobuf package.
+func GRPCRoutes(name, protoPackage string) []GRPCRoute {
+	routes := []GRPCRoute{
+		{Method: "Create", Request: name, Response: name},
+		{Method: "Get", Request: "Get" + name + "Request", Response: name},
+		{Method: "List", Request: "List" + name + "Request", Response: "List" + name + "Response"},
+		{Method: "Update", Request: name, Response: name},
+		{Method: "Delete", Request: "Delete" + name + "Request", Response: "google.protobuf.Empty"},
+	}
+	for i := range routes {
+		routes[i].Path = fmt.Sprintf("/%s.%sService/%s", protoPackage, name, routes[i].Method)
+	}
+	return routes
+}
+
+// grpcServerTemplate is the template for the server implementation of a model's service. It converts between the
+// protoc-generated message and the generated model and delegates every RPC to the model's repository.
+const grpcServerTemplate = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"{{.ModelsImport}}"
+	pb "{{.PBImport}}"
+)
+
+// {{.Name}}Server implements pb.{{.Name}}ServiceServer on top of models.{{.Name}}Repository.
+type {{.Name}}Server struct {
+	pb.Unimplemented{{.Name}}ServiceServer
+	repo *models.{{.Name}}Repository
+}
+
+// New{{.Name}}Server creates a {{.Name}}Server backed by the given repository.
+func New{{.Name}}Server(repo *models.{{.Name}}Repository) *{{.Name}}Server {
+	return &{{.Name}}Server{repo: repo}
+}
+
+// Create stores a new {{.Name}} and returns it with its ID and timestamps set.
+func (s *{{.Name}}Server) Create(ctx context.Context, in *pb.{{.Name}}) (*pb.{{.Name}}, error) {
+	m := {{.Var}}FromProto(in)
+	if err := s.repo.Create(ctx, m); err != nil {
+		return nil, statusFromError(err)
+	}
+	return {{.Var}}ToProto(m), nil
+}
+
+// Get returns the {{.Name}} with the requested ID.
+func (s *{{.Name}}Server) Get(ctx context.Context, in *pb.Get{{.Name}}Request) (*pb.{{.Name}}, error) {
+	m, err := s.repo.Get(ctx, uint(in.GetId()))
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+	return {{.Var}}ToProto(m), nil
+}
+
+// List returns a page of {{.Name}} records, continued with the next page token or skipped to with an offset.
+func (s *{{.Name}}Server) List(ctx context.Context, in *pb.List{{.Name}}Request) (*pb.List{{.Name}}Response, error) {
+	page, err := s.repo.ListPage(ctx, models.PageRequest{
+		Limit:  int(in.GetPageSize()),
+		Offset: int(in.GetOffset()),
+		Cursor: in.GetPageToken(),
+	})
+	if errors.Is(err, models.ErrInvalidPage) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+	resp := &pb.List{{.Name}}Response{
+		Items:         make([]*pb.{{.Name}}, 0, len(page.Items)),
+		Total:         page.Total,
+		NextPageToken: page.NextCursor,
+	}
+	for _, m := range page.Items {
+		resp.Items = append(resp.Items, {{.Var}}ToProto(m))
+	}
+	return resp, nil
+}
+
+// Update overwrites the {{.Name}} identified by the message's ID and returns the stored result. Updates of
+// records modified concurrently fail with codes.Aborted.
+func (s *{{.Name}}Server) Update(ctx context.Context, in *pb.{{.Name}}) (*pb.{{.Name}}, error) {
+	m := {{.Var}}FromProto(in)
+	if err := s.repo.Update(ctx, m); err != nil {
+		if errors.Is(err, models.ErrStaleObject) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		return nil, statusFromError(err)
+	}
+	stored, err := s.repo.Get(ctx, m.ID)
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+	return {{.Var}}ToProto(stored), nil
+}
+
+// Delete removes the {{.Name}} with the requested ID.
+func (s *{{.Name}}Server) Delete(ctx context.Context, in *pb.Delete{{.Name}}Request) (*emptypb.Empty, error) {
+	if err := s.repo.Delete(ctx, uint(in.GetId())); err != nil {
+		return nil, statusFromError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// {{.Var}}ToProto converts a models.{{.Name}} to its protobuf message.
+func {{.Var}}ToProto(m *models.{{.Name}}) *pb.{{.Name}} {
+	return &pb.{{.Name}}{
+{{- range .Conversions}}
+		{{.ProtoName}}: {{.ToProto}},
+{{- end}}
+	}
+}
+
+// {{.Var}}FromProto converts a protobuf message to a models.{{.Name}}.
+func {{.Var}}FromProto(in *pb.{{.Name}}) *models.{{.Name}} {
+	m := &models.{{.Name}}{}
+{{- range .Conversions}}
+	m.{{.GoName}} = {{.FromProto}}
+{{- end}}
+	return m
+}
+`
+
+// grpcSupportTemplate is the template for the file shared by every generated server in the grpcserver package.
+// It holds the conversion helpers used by the generated ToProto and FromProto functions, maps repository errors
+// to gRPC status codes, and provides the interceptor carrying the tenant of requests to the repositories.
+const grpcSupportTemplate = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+package grpcserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"{{.ModelsImport}}"
+)
+
+// statusFromError maps a repository error to a gRPC status error.
+func statusFromError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, models.ErrNoTenant):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, models.ErrReadOnly):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// TenantExtractor returns the tenant of an incoming request, or an error if the request carries none.
+type TenantExtractor func(ctx context.Context) (string, error)
+
+// TenantFromHeader returns a TenantExtractor reading the tenant from a metadata header, e.g. x-tenant-id.
+func TenantFromHeader(header string) TenantExtractor {
+	return func(ctx context.Context) (string, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(header); len(values) > 0 && values[0] != "" {
+			return values[0], nil
+		}
+		return "", fmt.Errorf("missing %s header", header)
+	}
+}
+
+// TenantFromClaim returns a TenantExtractor reading the tenant from a claim of the bearer token of the
+// authorization header. verify must check the token, including its signature, and return its claims.
+func TenantFromClaim(claim string, verify func(ctx context.Context, token string) (map[string]interface{}, error)) TenantExtractor {
+	return func(ctx context.Context) (string, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+			return "", errors.New("missing bearer token")
+		}
+		claims, err := verify(ctx, strings.TrimPrefix(values[0], "Bearer "))
+		if err != nil {
+			return "", fmt.Errorf("invalid bearer token: %w", err)
+		}
+		switch v := claims[claim].(type) {
+		case string:
+			if v != "" {
+				return v, nil
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+		return "", fmt.Errorf("missing %s claim", claim)
+	}
+}
+
+// TenantInterceptor returns a unary server interceptor carrying the tenant of every request in its context, see
+// models.WithTenantID. Requests without a tenant fail with codes.Unauthenticated.
+func TenantInterceptor(extract TenantExtractor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		tenantID, err := extract(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(models.WithTenantID(ctx, tenantID), req)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
+
+func convertPtr[A, B any](p *A, convert func(A) B) *B {
+	if p == nil {
+		return nil
+	}
+	v := convert(*p)
+	return &v
+}
+
+func convertSlice[A, B any](s []A, convert func(A) B) []B {
+	if s == nil {
+		return nil
+	}
+	out := make([]B, len(s))
+	for i, v := range s {
+		out[i] = convert(v)
+	}
+	return out
+}
+
+func timeFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func timestampFromPtr(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func timePtrFromProto(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+`
+
+// grpcConversion describes how one column is copied between a generated model and its protobuf message.
+type grpcConversion struct {
+	ProtoName string
+	GoName    string
+	ToProto   string
+	FromProto string
+}
+
+// RenderGRPCService renders the gRPC scaffolding for a model: its message .proto, a service .proto with CRUD
+// RPCs, and a server implementation backed by the model's repository. Every field must have been numbered with
+// AssignProtoNumbers first. The server is compiled against the Go code protoc generates from the .proto files.
+func RenderGRPCService(modelDef *ModelDefinition, opts GRPCOptions) ([]*GeneratedFile, error) {
+	opts = opts.withDefaults()
+	if opts.GoModule == "" {
+		return nil, fmt.Errorf("a Go module path is required to generate the gRPC server")
+	}
+
+	messageFile, err := RenderProto(modelDef, opts.ProtoDir, opts.ProtoPackage, opts.PBImportPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var conversions []grpcConversion
+	for _, c := range modelColumns(modelDef) {
+		conversion, err := newGRPCConversion(c)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of model %s: %w", c.Name, modelDef.Name, err)
+		}
+		conversions = append(conversions, conversion)
+	}
+
+	lower := strings.ToLower(modelDef.Name)
+	data := map[string]interface{}{
+		"Name":         modelDef.Name,
+		"Var":          lowerFirst(modelDef.Name),
+		"ProtoPackage": opts.ProtoPackage,
+		"MessageFile":  lower + ".proto",
+		"GoPackage":    opts.PBImportPath(),
+		"ModelsImport": opts.ModelsImportPath(),
+		"PBImport":     opts.PBImportPath(),
+		"Conversions":  conversions,
+		"RPCs":         GRPCRoutes(modelDef.Name, opts.ProtoPackage),
+	}
+
+	serviceProto, err := renderTemplate("service-proto", data)
+	if err != nil {
+		return nil, err
+	}
+	server, err := renderTemplate("grpc-server", data)
+	if err != nil {
+		return nil, err
+	}
+	server, err = formatGo(server)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting generated server: %w", err)
+	}
+
+	return []*GeneratedFile{
+		messageFile,
+		{Path: path.Join(filepath.ToSlash(opts.ProtoDir), lower+"_service.proto"), Content: serviceProto},
+		{Path: path.Join(filepath.ToSlash(opts.ServerDir), lower+"_server.go"), Content: server},
+	}, nil
+}
+
+// RenderGRPCSupport renders the helpers shared by every generated server in opts.ServerDir.
+func RenderGRPCSupport(opts GRPCOptions) (*GeneratedFile, error) {
+	opts = opts.withDefaults()
+	if opts.GoModule == "" {
+		return nil, fmt.Errorf("a Go module path is required to generate the gRPC server")
+	}
+	content, err := renderTemplate("grpc-support", map[string]interface{}{"ModelsImport": opts.ModelsImportPath()})
+	if err != nil {
+		return nil, err
+	}
+	content, err = formatGo(content)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting generated server support: %w", err)
+	}
+	return &GeneratedFile{
+		Path:    path.Join(filepath.ToSlash(opts.ServerDir), "support.go"),
+		Content: content,
+	}, nil
+}
+
+// newGRPCConversion derives the expressions converting a column between the model (m) and the protobuf
+// message (in). The protobuf side follows the types chosen by protoFieldType.
+func newGRPCConversion(c column) (grpcConversion, error) {
+	protoName := c.Name
+	if c.Field != nil {
+		protoName = ToSnakeCase(c.Field.Name)
+	}
+	conversion := grpcConversion{
+		ProtoName: protoGoName(protoName),
+		GoName:    c.GoName,
+	}
+	modelExpr := "m." + c.GoName
+	protoExpr := "in." + conversion.ProtoName
+	optional := c.Field != nil && c.Field.IsNull
+
+	goType := c.GoType
+	switch {
+	case goType == vectorGoType:
+		conversion.ToProto = "[]float32(" + modelExpr + ")"
+		conversion.FromProto = "models." + vectorGoType + "(" + protoExpr + ")"
+	case c.Field != nil && isEnumField(c.Field):
+		toProto, fromProto := "string("+modelExpr+")", protoExpr
+		if optional {
+			toProto, fromProto = "ptr("+toProto+")", "deref("+fromProto+")"
+		}
+		conversion.ToProto = toProto
+		conversion.FromProto = "models." + goType + "(" + fromProto + ")"
+	case goType == "time.Time":
+		conversion.ToProto = "timestamppb.New(" + modelExpr + ")"
+		conversion.FromProto = "timeFromProto(" + protoExpr + ")"
+	case goType == "*time.Time":
+		conversion.ToProto = "timestampFromPtr(" + modelExpr + ")"
+		conversion.FromProto = "timePtrFromProto(" + protoExpr + ")"
+	case goType == "[]byte":
+		conversion.ToProto = modelExpr
+		conversion.FromProto = protoExpr
+	case strings.HasPrefix(goType, "*"):
+		elem := goType[1:]
+		pbType, err := protoGoScalarType(elem)
+		if err != nil {
+			return conversion, err
+		}
+		if pbType == elem {
+			conversion.ToProto = modelExpr
+			conversion.FromProto = protoExpr
+		} else {
+			conversion.ToProto = fmt.Sprintf("convertPtr(%s, func(v %s) %s { return %s(v) })", modelExpr, elem, pbType, pbType)
+			conversion.FromProto = fmt.Sprintf("convertPtr(%s, func(v %s) %s { return %s(v) })", protoExpr, pbType, elem, elem)
+		}
+	case strings.HasPrefix(goType, "[]"):
+		elem := goType[2:]
+		if elem == "time.Time" {
+			conversion.ToProto = "convertSlice(" + modelExpr + ", timestamppb.New)"
+			conversion.FromProto = "convertSlice(" + protoExpr + ", timeFromProto)"
+			break
+		}
+		pbType, err := protoGoScalarType(elem)
+		if err != nil {
+			return conversion, err
+		}
+		if pbType == elem {
+			conversion.ToProto = modelExpr
+			conversion.FromProto = protoExpr
+		} else {
+			conversion.ToProto = fmt.Sprintf("convertSlice(%s, func(v %s) %s { return %s(v) })", modelExpr, elem, pbType, pbType)
+			conversion.FromProto = fmt.Sprintf("convertSlice(%s, func(v %s) %s { return %s(v) })", protoExpr, pbType, elem, elem)
+		}
+	case strings.HasPrefix(goType, "map[string]"):
+		elem := goType[len("map[string]"):]
+		pbType, err := protoGoScalarType(elem)
+		if err != nil {
+			return conversion, err
+		}
+		if pbType != elem {
+			return conversion, fmt.Errorf("unsupported type %s for gRPC generation", goType)
+		}
+		conversion.ToProto = modelExpr
+		conversion.FromProto = protoExpr
+	default:
+		pbType, err := protoGoScalarType(goType)
+		if err != nil {
+			return conversion, err
+		}
+		toProto, fromProto := modelExpr, protoExpr
+		if optional {
+			fromProto = "deref(" + fromProto + ")"
+		}
+		if pbType != goType {
+			toProto = pbType + "(" + toProto + ")"
+			fromProto = goType + "(" + fromProto + ")"
+		}
+		if optional {
+			toProto = "ptr(" + toProto + ")"
+		}
+		conversion.ToProto = toProto
+		conversion.FromProto = fromProto
+	}
+	return conversion, nil
+}
+
+// protoGoScalarType returns the Go type protoc-gen-go uses for the proto3 equivalent of a scalar Go type.
+func protoGoScalarType(goType string) (string, error) {
+	protoType, err := protoScalarType(goType)
+	if err != nil {
+		return "", err
+	}
+	switch protoType {
+	case "float":
+		return "float32", nil
+	case "double":
+		return "float64", nil
+	case "google.protobuf.Timestamp":
+		return "", fmt.Errorf("unsupported type %s for gRPC generation", goType)
+	default:
+		return protoType, nil
+	}
+}
+
+// protoGoName returns the Go field name protoc-gen-go generates for a snake_case protobuf field name.
+func protoGoName(name string) string {
+	var b strings.Builder
+	upperNext := true
+	for i, r := range name {
+		switch {
+		case r == '_' && i+1 < len(name) && unicode.IsLower(rune(name[i+1])):
+			upperNext = true
+		case upperNext:
+			b.WriteRune(unicode.ToUpper(r))
+			upperNext = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// lowerFirst lowercases the first letter of a Go identifier.
+func lowerFirst(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// renderTemplate executes the named generation template, or its override, with the given data.
+func renderTemplate(name string, data interface{}) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(templateSource(name))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error executing template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
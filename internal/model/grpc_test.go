@@ -0,0 +1,356 @@
+package model
+
+import (
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+func TestRenderRepositoryFile(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{
+		NewField("Title", "string", "", false, false),
+		NewField("Views", "int", "", true, false),
+		NewField("Tags", "[]string", "", false, false),
+	})
+
+	file, err := RenderRepositoryFile(def)
+	assert.NoError(t, err)
+	assert.Equal(t, "models/post_repository.go", file.Path)
+
+	content := string(file.Content)
+	assert.True(t, strings.Contains(content, `const postColumns = "id, created_at, updated_at, title, views, tags"`))
+	assert.True(t, strings.Contains(content, "INSERT INTO posts (created_at, updated_at, title, views, tags) VALUES ($1, $2, $3, $4, $5) RETURNING id"))
+	assert.True(t, strings.Contains(content, "UPDATE posts SET updated_at = $1, title = $2, views = $3, tags = $4 WHERE id = $5"))
+	assert.True(t, strings.Contains(content, "row.Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt, &m.Title, &nullViews, pq.Array(&m.Tags))"))
+	assert.True(t, strings.Contains(content, "m.Views = *nullViews"))
+	assert.True(t, strings.Contains(content, "err := withModelSession(ctx, r.db, \"posts\", postSessionSettings, m, func(q querier) error {\n\t\tif err := beforeCreate(ctx, m); err != nil {"))
+	assert.True(t, strings.Contains(content, "\tif err == nil {\n\t\tpublish(ctx, Event{Table: \"posts\", Op: OpDelete, ID: id})\n\t}\n"))
+	assert.True(t, strings.Contains(content, "\t\treturn afterUpdate(ctx, m)\n"))
+	assert.True(t, strings.Contains(content, "\t\tif hasDeleteHooks(m) {\n"))
+	assert.True(t, strings.Contains(content, `"SELECT "+postColumns+" FROM posts WHERE id > $1 ORDER BY id LIMIT $2 OFFSET $3", after, limit+1, offset)`))
+
+	formatted, err := format.Source(file.Content)
+	assert.NoError(t, err)
+	assert.Equal(t, string(formatted), content, "the repository must be gofmt-clean")
+}
+
+func TestRenderRepositoryFile_RejectsMaps(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{NewField("Meta", "map[string]string", "", false, false)})
+	_, err := RenderRepositoryFile(def)
+	assert.Error(t, err)
+}
+
+// TestRenderModelFiles_Compiles builds the generated models package as a module of its own, like the models of
+// a scaffolded app.
+func TestRenderModelFiles_Compiles(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+	goSum, err := os.ReadFile("../../go.sum")
+	if err != nil {
+		t.Skipf("go.sum not available: %v", err)
+	}
+
+	dir := t.TempDir()
+	def := NewModelDefinition("Post", []Field{
+		NewField("Title", "string", "", false, false),
+		NewField("Views", "int", "", true, false),
+		NewField("Tags", "[]string", "", false, false),
+		NewField("PublishedAt", "*time.Time", "", false, false),
+		NewField("ArchivedAt", "time.Time", "", true, false),
+		NewField("Body", "[]byte", "", true, false),
+		NewField("ID", "int", "", false, true),
+		NewField("CreatedAt", "time.Time", "", false, false),
+		NewField("Embedding", "vector(3)", "", true, false),
+		NewField("Status", "enum(draft,in_review,published)", "", false, false),
+		NewField("Visibility", "enum(public,private)", "", true, false),
+		NewField("Source", "*string", "", false, false),
+	})
+	def.SetOutputDir(filepath.Join(dir, "models"))
+	for name, value := range map[string]string{"status": "draft", "source": "web", "archivedat": "now", "views": "0"} {
+		assert.NoError(t, def.SetDefault(name, value))
+	}
+	assert.NoError(t, def.EnableLockVersion())
+	assert.NoError(t, def.SetTenantField("tenant_id"))
+	assert.NoError(t, def.SetSearchFields([]string{"title", "status"}))
+	assert.NoError(t, def.SetUpsertKeys([]string{"title"}))
+	policy, err := NewPolicy(def, PolicyTenant, "title", "")
+	assert.NoError(t, err)
+	AddPolicy(def, policy)
+
+	files, err := RenderModelFiles(def)
+	assert.NoError(t, err)
+	kvFiles, err := RenderKVFiles(def)
+	assert.NoError(t, err)
+	files = append(files, kvFiles...)
+	fsys := filesystem.NewOSFS("")
+	for _, file := range files {
+		assert.NoError(t, file.Write(fsys))
+	}
+	hooks := "package models\n\nimport \"context\"\n\n" +
+		"var _ interface {\n\tBeforeSaveHook\n\tAfterDeleteHook\n} = (*Post)(nil)\n\n" +
+		"func (p *Post) BeforeSave(ctx context.Context) error { return nil }\n\n" +
+		"func (p *Post) AfterDelete(ctx context.Context) error { return nil }\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "models", "post_hooks.go"), []byte(hooks), 0644))
+	goMod := "module blog_grav\n\ngo 1.21\n\nrequire github.com/lib/pq v1.10.9\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.sum"), goSum, 0644))
+
+	pages := "package models\n\nimport (\n\t\"context\"\n\t\"database/sql\"\n\t\"errors\"\n\t\"fmt\"\n\t\"strings\"\n\t\"testing\"\n\t\"time\"\n)\n\n" +
+		"func TestPages(t *testing.T) {\n" +
+		"\tlimit, _, _, err := PageRequest{Limit: MaxPageSize + 1}.bounds()\n" +
+		"\tif err != nil || limit != MaxPageSize {\n\t\tt.Fatalf(\"limit %d, %v\", limit, err)\n\t}\n" +
+		"\tpage := newPage([]uint{1, 2, 3}, 7, 2, func(id uint) uint { return id })\n" +
+		"\t_, _, after, err := PageRequest{Cursor: page.NextCursor}.bounds()\n" +
+		"\tif len(page.Items) != 2 || after != 2 || err != nil {\n\t\tt.Fatalf(\"page %+v, after %d, %v\", page, after, err)\n\t}\n" +
+		"\tif _, _, _, err := (PageRequest{Cursor: \"x\"}).bounds(); err == nil {\n\t\tt.Fatal(\"malformed cursor accepted\")\n\t}\n" +
+		"}\n\n" +
+		"func TestCallerTag(t *testing.T) {\n" +
+		"\tif tag := callerTag(); !strings.HasPrefix(tag, \"/* caller=testing.tRunner:testing.go:\") {\n\t\tt.Fatalf(\"tag %q\", tag)\n\t}\n" +
+		"}\n\n" +
+		"func TestRowLimit(t *testing.T) {\n" +
+		"\tRowLimit, OnRowLimit = 2, RowLimitError\n" +
+		"\tdefer func() { RowLimit, OnRowLimit = 10000, RowLimitWarn }()\n" +
+		"\tif err := checkRowLimit(\"posts\", 2); err != nil {\n\t\tt.Fatal(err)\n\t}\n" +
+		"\tif err := checkRowLimit(\"posts\", 3); !errors.Is(err, ErrTooManyRows) {\n\t\tt.Fatalf(\"err %v\", err)\n\t}\n" +
+		"}\n\n" +
+		"func TestStats(t *testing.T) {\n" +
+		"\tdefer ResetStats()\n" +
+		"\tvar writes int\n" +
+		"\tQueryObserver = func(table string, write bool, elapsed time.Duration, err error) {\n\t\tif write {\n\t\t\twrites++\n\t\t}\n\t}\n" +
+		"\tdefer func() { QueryObserver = nil }()\n" +
+		"\tobserve(\"tags\", false, time.Millisecond, nil)\n" +
+		"\tobserve(\"posts\", false, time.Millisecond, nil)\n" +
+		"\tobserve(\"posts\", true, 3*time.Millisecond, errors.New(\"boom\"))\n" +
+		"\tstats := Stats()\n" +
+		"\tif len(stats) != 2 || stats[0].Table != \"posts\" || stats[0].Errors != 1 || stats[0].MeanWrite() != 3*time.Millisecond || writes != 1 {\n\t\tt.Fatalf(\"stats %+v\", stats)\n\t}\n" +
+		"}\n\n" +
+		"func TestLeakDetector(t *testing.T) {\n" +
+		"\tleaks := make(chan Leak, 2)\n" +
+		"\td := DetectLeaks(nil, 10*time.Millisecond, func(leak Leak) { leaks <- leak })\n" +
+		"\td.track(\"conn\")()\n" +
+		"\td.track(\"rows\")\n" +
+		"\tif leak := <-leaks; leak.Kind != \"rows\" || !strings.Contains(leak.Stack, \"TestLeakDetector\") {\n\t\tt.Fatalf(\"leak %+v\", leak)\n\t}\n" +
+		"\tselect {\n\tcase leak := <-leaks:\n\t\tt.Fatalf(\"released %s reported\", leak.Kind)\n\tcase <-time.After(50 * time.Millisecond):\n\t}\n" +
+		"}\n\n" +
+		"type fakeSearch struct{ docs map[uint]map[string]interface{} }\n\n" +
+		"func (f *fakeSearch) Index(ctx context.Context, index string, docs []map[string]interface{}) error {\n" +
+		"\tfor _, doc := range docs {\n\t\tf.docs[doc[\"id\"].(uint)] = doc\n\t}\n\treturn nil\n}\n\n" +
+		"func (f *fakeSearch) Delete(ctx context.Context, index string, ids []uint) error {\n" +
+		"\tfor _, id := range ids {\n\t\tdelete(f.docs, id)\n\t}\n\treturn nil\n}\n\n" +
+		"func (f *fakeSearch) Search(ctx context.Context, index, query string, limit int) ([]uint, error) { return nil, nil }\n\n" +
+		"func TestSearch(t *testing.T) {\n" +
+		"\tctx := context.Background()\n" +
+		"\tif _, err := searchIDs(ctx, \"posts\", \"go\", 10); !errors.Is(err, ErrSearchDisabled) {\n\t\tt.Fatalf(\"err %v\", err)\n\t}\n" +
+		"\tbackend := &fakeSearch{docs: map[uint]map[string]interface{}{}}\n" +
+		"\tdisable := EnableSearch(backend, t.Logf)\n" +
+		"\tdefer disable()\n" +
+		"\tpost := &Post{Title: \"Go\", Status: \"draft\"}\n" +
+		"\tpost.ID = 1\n" +
+		"\tpublish(ctx, Event{Table: \"posts\", Op: OpCreate, ID: 1, Record: post})\n" +
+		"\tother := &Post{Title: \"SQL\"}\n" +
+		"\tother.ID = 2\n" +
+		"\tpublish(ctx, Event{Table: \"posts\", Op: OpCreate, ID: 2, Record: other})\n" +
+		"\tpublish(ctx, Event{Table: \"posts\", Op: OpDelete, ID: 2})\n" +
+		"\tif len(backend.docs) != 1 || backend.docs[1][\"title\"] != \"Go\" || fmt.Sprint(backend.docs[1][\"status\"]) != \"draft\" {\n\t\tt.Fatalf(\"docs %v\", backend.docs)\n\t}\n" +
+		"\tids := sortByIDs([]uint{1, 2}, []uint{2, 3, 1}, func(id uint) uint { return id })\n" +
+		"\tif len(ids) != 2 || ids[0] != 2 {\n\t\tt.Fatalf(\"ids %v\", ids)\n\t}\n" +
+		"}\n\n" +
+		"func TestReplicas(t *testing.T) {\n" +
+		"\tctx := context.Background()\n" +
+		"\tprimary, a, b := &sql.DB{}, &replica{db: &sql.DB{}}, &replica{db: &sql.DB{}}\n" +
+		"\ta.healthy.Store(true)\n" +
+		"\tb.healthy.Store(true)\n" +
+		"\treplicas = []*replica{a, b}\n" +
+		"\tdefer func() { replicas = nil }()\n" +
+		"\tfirst, _ := readerFor(ctx, primary)\n" +
+		"\tsecond, r := readerFor(ctx, primary)\n" +
+		"\tif first == primary || second == primary || first == second || r.db != second {\n\t\tt.Fatal(\"reads not spread over the replicas\")\n\t}\n" +
+		"\tif db, _ := readerFor(WithPrimary(ctx), primary); db != primary {\n\t\tt.Fatal(\"read forced to the primary ran on a replica\")\n\t}\n" +
+		"\tb.healthy.Store(false)\n" +
+		"\tif first, _ := readerFor(ctx, primary); first != a.db {\n\t\tt.Fatal(\"read ran on an unhealthy replica\")\n\t}\n" +
+		"\tif second, _ := readerFor(ctx, primary); second != a.db {\n\t\tt.Fatal(\"read ran on an unhealthy replica\")\n\t}\n" +
+		"\ta.healthy.Store(false)\n" +
+		"\tif db, r := readerFor(ctx, primary); db != primary || r != nil {\n\t\tt.Fatal(\"read without healthy replicas did not run on the primary\")\n\t}\n" +
+		"}\n" +
+		"\nfunc TestBatchValues(t *testing.T) {\n" +
+		"\tif values := batchValues(2, []string{\"\", \"'draft'\"}); values != \"($1, COALESCE($2, 'draft')), ($3, COALESCE($4, 'draft'))\" {\n\t\tt.Fatalf(\"values %q\", values)\n\t}\n" +
+		"\tif rows := batchRows(len(postInsertDefaults)); rows != MaxBatchRows {\n\t\tt.Fatalf(\"rows %d\", rows)\n\t}\n" +
+		"\tif rows := batchRows(100); rows != 655 {\n\t\tt.Fatalf(\"rows %d\", rows)\n\t}\n" +
+		"}\n" +
+		"\nfunc TestStatementTimeout(t *testing.T) {\n" +
+		"\tStatementTimeout = time.Millisecond\n" +
+		"\tdefer func() { StatementTimeout = 0 }()\n" +
+		"\terr := runSession(context.Background(), nil, nil, false, func(q querier) error {\n" +
+		"\t\tctx := q.(timedQuerier).ctx\n" +
+		"\t\t<-ctx.Done()\n" +
+		"\t\treturn ctx.Err()\n" +
+		"\t})\n" +
+		"\tif !errors.Is(err, context.DeadlineExceeded) {\n\t\tt.Fatalf(\"err %v\", err)\n\t}\n" +
+		"}\n" +
+		"\nfunc TestStatementCache(t *testing.T) {\n" +
+		"\tMaxCachedStatements = 0\n" +
+		"\tdefer func() { MaxCachedStatements = 256 }()\n" +
+		"\tif stmt, err := statements.prepare(context.Background(), nil, \"SELECT 1\"); stmt != nil || err != nil {\n\t\tt.Fatalf(\"disabled cache prepared %v, %v\", stmt, err)\n\t}\n" +
+		"\tstatements.hits, statements.misses = 3, 1\n" +
+		"\tif rate := StatementCacheStats().HitRate(); rate != 0.75 {\n\t\tt.Fatalf(\"hit rate %v\", rate)\n\t}\n" +
+		"\tResetStats()\n" +
+		"\tif stats := StatementCacheStats(); stats != (StatementStats{}) {\n\t\tt.Fatalf(\"stats %+v\", stats)\n\t}\n" +
+		"}\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "models", "page_test.go"), []byte(pages), 0644))
+	kv := `package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestKVRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	store, err := OpenKVStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repo PostStore = NewPostKVRepository(store)
+	ctx := WithTenantID(context.Background(), "acme")
+
+	post := NewPost()
+	post.Title = "Go"
+	if err := repo.Create(ctx, post); err != nil || post.ID != 1 || post.Tenant_id != "acme" || *post.Source != "web" {
+		t.Fatalf("created %+v, %v", post, err)
+	}
+	if err := repo.CreateBatch(ctx, []*Post{{Title: "A", Version: 1}, {Title: "B", Version: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(WithTenantID(ctx, "other"), 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("read another tenant's post: %v", err)
+	}
+	page, err := repo.ListPage(ctx, PageRequest{Limit: 2})
+	if err != nil || len(page.Items) != 2 || page.Total != 3 || page.NextCursor == "" {
+		t.Fatalf("page %+v, %v", page, err)
+	}
+	if page, err = repo.ListPage(ctx, PageRequest{Limit: 2, Cursor: page.NextCursor}); err != nil || len(page.Items) != 1 || page.Items[0].Title != "B" {
+		t.Fatalf("page %+v, %v", page, err)
+	}
+
+	stale := *post
+	post.Title = "Go 2"
+	if err := repo.Update(ctx, post); err != nil || post.Version != 2 {
+		t.Fatalf("updated version %d, %v", post.Version, err)
+	}
+	if err := repo.Update(ctx, &stale); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("stale update: %v", err)
+	}
+	if err := repo.Delete(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("deleted twice: %v", err)
+	}
+	SetReadOnly(true)
+	if err := repo.Delete(ctx, 1); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("deleted while read-only: %v", err)
+	}
+	if _, err := repo.Get(ctx, 1); err != nil {
+		t.Fatalf("read while read-only: %v", err)
+	}
+	SetReadOnly(false)
+	store.Close()
+	if _, err := repo.Get(ctx, 1); !errors.Is(err, ErrKVStoreClosed) {
+		t.Fatalf("read a closed store: %v", err)
+	}
+
+	if store, err = OpenKVStore(path); err != nil {
+		t.Fatal(err)
+	}
+	repo = NewPostKVRepository(store)
+	if post, err := repo.Get(ctx, 1); err != nil || post.Title != "Go 2" {
+		t.Fatalf("reopened %+v, %v", post, err)
+	}
+	next := &Post{Title: "C"}
+	if err := repo.Create(ctx, next); err != nil || next.ID != 4 {
+		t.Fatalf("created %d after reopening, %v", next.ID, err)
+	}
+}
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "models", "kv_test.go"), []byte(kv), 0644))
+
+	build := exec.Command(goBin, "build", "./...")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+	output, err := build.CombinedOutput()
+	assert.NoError(t, err, string(output))
+
+	test := exec.Command(goBin, "test", "./models")
+	test.Dir = dir
+	test.Env = build.Env
+	output, err = test.CombinedOutput()
+	assert.NoError(t, err, string(output))
+}
+
+func TestRenderGRPCService(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{
+		NewField("Title", "string", "", false, false),
+		NewField("Views", "int", "", true, false),
+		NewField("PublishedAt", "*time.Time", "", false, false),
+		NewField("ID", "int", "", false, true),
+	})
+	AssignProtoNumbers(def)
+
+	files, err := RenderGRPCService(def, GRPCOptions{GoModule: "blog_grav"})
+	assert.NoError(t, err)
+	if !assert.Len(t, files, 3) {
+		return
+	}
+	assert.Equal(t, "proto/post.proto", files[0].Path)
+	assert.Equal(t, "proto/post_service.proto", files[1].Path)
+	assert.Equal(t, "internal/grpcserver/post_server.go", files[2].Path)
+
+	message := string(files[0].Content)
+	assert.True(t, strings.Contains(message, `option go_package = "blog_grav/internal/pb";`))
+	assert.True(t, strings.Contains(message, "uint64 id = 1;"))
+	assert.False(t, strings.Contains(message, " int64 id ="), "a field named like a base field must not be emitted twice")
+
+	service := string(files[1].Content)
+	assert.True(t, strings.Contains(service, `import "post.proto";`))
+	assert.True(t, strings.Contains(service, "rpc Delete(DeletePostRequest) returns (google.protobuf.Empty);"))
+
+	server := string(files[2].Content)
+	assert.True(t, strings.Contains(server, `"blog_grav/internal/models"`))
+	assert.True(t, strings.Contains(server, "Views:       ptr(int64(m.Views)),"))
+	assert.True(t, strings.Contains(server, "m.Publishedat = timePtrFromProto(in.PublishedAt)"))
+	assert.True(t, strings.Contains(server, "page, err := s.repo.ListPage(ctx, models.PageRequest{"))
+
+	_, err = parser.ParseFile(token.NewFileSet(), files[2].Path, files[2].Content, 0)
+	assert.NoError(t, err)
+	support, err := RenderGRPCSupport(GRPCOptions{GoModule: "blog_grav"})
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(support.Content), "return handler(models.WithTenantID(ctx, tenantID), req)"))
+	_, err = parser.ParseFile(token.NewFileSet(), support.Path, support.Content, 0)
+	assert.NoError(t, err)
+}
+
+func TestRenderGRPCService_RequiresModule(t *testing.T) {
+	def := NewModelDefinition("Post", nil)
+	_, err := RenderGRPCService(def, GRPCOptions{})
+	assert.Error(t, err)
+}
+
+func TestProtoGoName(t *testing.T) {
+	assert.Equal(t, "PublishedAt", protoGoName("published_at"))
+	assert.Equal(t, "Id", protoGoName("id"))
+	assert.Equal(t, "Field_1", protoGoName("field_1"))
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change is a change from one definition of a model to the next, see Changes.
+type Change struct {
+	Op         string            `json:"op"`                   // "+" for an addition, "-" for a removal, "~" for a modification
+	Subject    string            `json:"subject"`              // "table", "field", or "policy"
+	Name       string            `json:"name,omitempty"`       // name of the field or policy
+	Type       string            `json:"type,omitempty"`       // type of an added or removed field
+	Attributes []AttributeChange `json:"attributes,omitempty"` // changed attributes of the table or of a field
+}
+
+// AttributeChange is an attribute of a table or field whose value changed.
+type AttributeChange struct {
+	Name string      `json:"name"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// String describes the change on one line: "~ table: old -> new" for a renamed table, "+ name type" for an
+// added field, "- name type" for a removed one, "~ name: ..." for a changed one, and "+ policy name" or
+// "- policy name" for policies.
+func (c Change) String() string {
+	switch {
+	case c.Subject == "policy":
+		return c.Op + " policy " + c.Name
+	case c.Op == "~":
+		attributes := make([]string, len(c.Attributes))
+		for i, attribute := range c.Attributes {
+			attributes[i] = attribute.String()
+		}
+		name := c.Name
+		if c.Subject == "table" {
+			name = "table"
+		}
+		return fmt.Sprintf("~ %s: %s", name, strings.Join(attributes, ", "))
+	default:
+		return fmt.Sprintf("%s %s %s", c.Op, c.Name, c.Type)
+	}
+}
+
+// String describes the attribute change as "name old -> new". The table name is described without its name.
+func (a AttributeChange) String() string {
+	if a.Name == "table" {
+		return fmt.Sprintf("%v -> %v", a.Old, a.New)
+	}
+	return fmt.Sprintf("%s %v -> %v", a.Name, quoteEmpty(a.Old), quoteEmpty(a.New))
+}
+
+// Changes returns the changes from one definition of a model to the next: a renamed table, removed, added and
+// changed fields, then added and removed policies. A nil old definition describes every field as added.
+func Changes(old, new *ModelDefinition) []Change {
+	var changes []Change
+	if old == nil {
+		old = &ModelDefinition{}
+	} else if TableName(old) != TableName(new) {
+		changes = append(changes, Change{Op: "~", Subject: "table",
+			Attributes: []AttributeChange{{Name: "table", Old: TableName(old), New: TableName(new)}}})
+	}
+	for i := range old.Fields {
+		if new.Field(old.Fields[i].Name) == nil {
+			changes = append(changes, Change{Op: "-", Subject: "field", Name: old.Fields[i].Name, Type: old.Fields[i].Type})
+		}
+	}
+	for i := range new.Fields {
+		field := &new.Fields[i]
+		previous := old.Field(field.Name)
+		if previous == nil {
+			changes = append(changes, Change{Op: "+", Subject: "field", Name: field.Name, Type: field.Type})
+			continue
+		}
+		if attributes := diffField(previous, field); len(attributes) > 0 {
+			changes = append(changes, Change{Op: "~", Subject: "field", Name: field.Name, Attributes: attributes})
+		}
+	}
+
+	oldPolicies, newPolicies := policyNames(old), policyNames(new)
+	for _, name := range oldPolicies {
+		if !containsString(newPolicies, name) {
+			changes = append(changes, Change{Op: "-", Subject: "policy", Name: name})
+		}
+	}
+	for _, name := range newPolicies {
+		if !containsString(oldPolicies, name) {
+			changes = append(changes, Change{Op: "+", Subject: "policy", Name: name})
+		}
+	}
+	return changes
+}
+
+// DiffDefinitions describes the changes from one definition of a model to the next, one line per change, see
+// Changes and Change.String.
+func DiffDefinitions(old, new *ModelDefinition) []string {
+	var lines []string
+	for _, change := range Changes(old, new) {
+		lines = append(lines, change.String())
+	}
+	return lines
+}
+
+// diffField returns the attributes that differ between two definitions of a field.
+func diffField(old, new *Field) []AttributeChange {
+	var attributes []AttributeChange
+	for _, attribute := range []AttributeChange{
+		{"name", old.Name, new.Name},
+		{"type", old.Type, new.Type},
+		{"tag", old.Tag, new.Tag},
+		{"nullable", old.IsNull, new.IsNull},
+		{"primary", old.IsPrimary, new.IsPrimary},
+		{"proto number", old.ProtoNumber, new.ProtoNumber},
+		{"encrypted", old.Encrypted, new.Encrypted},
+		{"sensitive", old.Sensitive, new.Sensitive},
+		{"references", old.References, new.References},
+		{"default", old.Default, new.Default},
+		{"indexed", old.Indexed, new.Indexed},
+		{"vector metric", old.VectorMetric, new.VectorMetric},
+	} {
+		if !reflect.DeepEqual(attribute.Old, attribute.New) {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+// quoteEmpty makes empty strings visible in a diff.
+func quoteEmpty(value interface{}) interface{} {
+	if value == "" {
+		return `""`
+	}
+	return value
+}
+
+func policyNames(def *ModelDefinition) []string {
+	names := make([]string, len(def.Options.Policies))
+	for i, policy := range def.Options.Policies {
+		names[i] = policy.Name
+	}
+	return names
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffDefinitions(t *testing.T) {
+	old := NewModelDefinition("User", []Field{
+		NewField("Name", "string", `json:"name"`, false, false),
+		NewField("Age", "int", `json:"age"`, false, false),
+	})
+	assert.Equal(t, []string{"+ Name string", "+ Age int"}, DiffDefinitions(nil, old))
+	assert.Empty(t, DiffDefinitions(old, old))
+
+	new := NewModelDefinition("User", []Field{
+		NewField("Name", "string", `json:"name"`, true, false),
+		NewField("Email", "string", `json:"email"`, false, false),
+	})
+	new.Fields[0].Default = "anonymous"
+	AddPolicy(new, Policy{Name: "users_owner_only", Kind: PolicyOwner, Column: "id", Setting: "app.user_id"})
+
+	assert.Equal(t, []string{
+		"- Age int",
+		`~ Name: nullable false -> true, default "" -> anonymous`,
+		"+ Email string",
+		"+ policy users_owner_only",
+	}, DiffDefinitions(old, new))
+	assert.Equal(t, []string{
+		"- Email string",
+		`~ Name: nullable true -> false, default anonymous -> ""`,
+		"+ Age int",
+		"- policy users_owner_only",
+	}, DiffDefinitions(new, old))
+
+	indexed := NewModelDefinition("Doc", []Field{NewField("Embedding", "vector(3)", "", false, false)})
+	reindexed := NewModelDefinition("Doc", []Field{NewField("Embedding", "vector(3)", "", false, false)})
+	assert.NoError(t, indexed.IndexVectorField("Embedding", "l2"))
+	assert.NoError(t, reindexed.IndexVectorField("Embedding", "cosine"))
+	assert.Equal(t, []string{"~ Embedding: vector metric l2 -> cosine"}, DiffDefinitions(indexed, reindexed))
+}
@@ -0,0 +1,237 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// knownPackages maps the package qualifiers generated code may use to their import paths, beyond typePackages
+// and the packages of registered custom types.
+var knownPackages = map[string]string{
+	"atomic":  "sync/atomic",
+	"bytes":   "bytes",
+	"context": "context",
+	"driver":  "database/sql/driver",
+	"errors":  "errors",
+	"fmt":     "fmt",
+	"http":    "net/http",
+	"io":      "io",
+	"math":    "math",
+	"os":      "os",
+	"pq":      "github.com/lib/pq",
+	"regexp":  "regexp",
+	"sort":    "sort",
+	"strconv": "strconv",
+	"strings": "strings",
+	"sync":    "sync",
+}
+
+// goimportsPath is the goimports binary generated Go code is run through after formatting, none when empty,
+// see UseGoimports.
+var goimportsPath string
+
+// UseGoimports runs the Go code rendered afterwards through goimports, found on the PATH, after its imports are
+// fixed and it is formatted, or stops doing so when enabled is false.
+func UseGoimports(enabled bool) error {
+	goimportsPath = ""
+	if !enabled {
+		return nil
+	}
+	found, err := exec.LookPath("goimports")
+	if err != nil {
+		return fmt.Errorf("goimports is not installed: %w", err)
+	}
+	goimportsPath = found
+	return nil
+}
+
+// formatGo fixes the imports of generated Go code, see fixImports, and formats it with gofmt, then goimports
+// if enabled with UseGoimports, so that it compiles whichever field types a model uses and whatever a template
+// override imports.
+func formatGo(src []byte) ([]byte, error) {
+	src, err := fixImports(src)
+	if err != nil {
+		return nil, err
+	}
+	if src, err = format.Source(src); err != nil {
+		return nil, err
+	}
+	if goimportsPath == "" {
+		return src, nil
+	}
+	cmd := exec.Command(goimportsPath)
+	cmd.Stdin = bytes.NewReader(src)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("goimports failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// fixImports removes the imports a Go file does not use, and adds the imports of the packages it uses without
+// importing them, when their import path is known: the packages of typePackages, of registered custom types,
+// and of knownPackages. The imports are rewritten as a single block, the standard library first.
+func fixImports(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if selector, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok && ident.Obj == nil {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+
+	paths := packagePaths()
+	imports := map[string]string{} // import path to the name it is imported with, empty for its own name
+	imported := map[string]bool{}
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		qualifier := name
+		if qualifier == "" {
+			qualifier = packageName(importPath, paths)
+		}
+		if used[qualifier] || qualifier == "_" || qualifier == "." {
+			imports[importPath] = name
+			imported[qualifier] = true
+		}
+	}
+	for qualifier := range used {
+		if importPath, ok := paths[qualifier]; ok && !imported[qualifier] {
+			imports[importPath] = ""
+			if packageName(importPath, nil) != qualifier {
+				imports[importPath] = qualifier
+			}
+		}
+	}
+	if len(imports) == len(file.Imports) && len(imports) == countKept(file, imports) {
+		return src, nil
+	}
+
+	// The import declarations are replaced by the new block, or the block is added after the package clause.
+	start, end := fset.Position(file.Name.End()).Offset, fset.Position(file.Name.End()).Offset
+	for i, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			break
+		}
+		if i == 0 {
+			start = fset.Position(gen.Pos()).Offset
+		}
+		end = fset.Position(gen.End()).Offset
+	}
+	var block bytes.Buffer
+	if start == end {
+		block.WriteString("\n")
+	}
+	block.WriteString(importBlock(imports))
+	return append(append(append([]byte{}, src[:start]...), block.Bytes()...), src[end:]...), nil
+}
+
+// countKept returns the number of imports of the file kept unchanged in imports.
+func countKept(file *ast.File, imports map[string]string) int {
+	kept := 0
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name, ok := imports[importPath]
+		if ok && (spec.Name == nil && name == "" || spec.Name != nil && spec.Name.Name == name) {
+			kept++
+		}
+	}
+	return kept
+}
+
+// importBlock renders the import declaration of the given imports, by path, standard library packages first;
+// it is empty without imports.
+func importBlock(imports map[string]string) string {
+	if len(imports) == 0 {
+		return ""
+	}
+	var std, other []string
+	for importPath, name := range imports {
+		line := "\t" + strconv.Quote(importPath)
+		if name != "" {
+			line = "\t" + name + " " + strconv.Quote(importPath)
+		}
+		if strings.Contains(strings.Split(importPath, "/")[0], ".") {
+			other = append(other, line)
+		} else {
+			std = append(std, line)
+		}
+	}
+	sort.Slice(std, func(i, j int) bool { return importLinePath(std[i]) < importLinePath(std[j]) })
+	sort.Slice(other, func(i, j int) bool { return importLinePath(other[i]) < importLinePath(other[j]) })
+	groups := []string{}
+	for _, group := range [][]string{std, other} {
+		if len(group) > 0 {
+			groups = append(groups, strings.Join(group, "\n"))
+		}
+	}
+	return "import (\n" + strings.Join(groups, "\n\n") + "\n)"
+}
+
+// importLinePath returns the import path of a line of an import block.
+func importLinePath(line string) string {
+	return line[strings.Index(line, `"`):]
+}
+
+// packagePaths returns the import paths of the packages generated code may use, by qualifier.
+func packagePaths() map[string]string {
+	paths := map[string]string{}
+	for qualifier, importPath := range knownPackages {
+		paths[qualifier] = importPath
+	}
+	for qualifier, importPath := range typePackages {
+		paths[qualifier] = importPath
+	}
+	for _, t := range customTypes {
+		if qualifier, _, qualified := strings.Cut(t.Name, "."); qualified && t.Import != "" {
+			paths[qualifier] = t.Import
+		}
+	}
+	return paths
+}
+
+// majorVersion matches the major version suffixes of import paths, such as v2 or .v3.
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// packageName returns the name a package is used with when imported without a name: the qualifier it is known
+// by in paths, or else the last element of its import path without a major version suffix, e.g. yaml for
+// gopkg.in/yaml.v3.
+func packageName(importPath string, paths map[string]string) string {
+	for qualifier, p := range paths {
+		if p == importPath {
+			return qualifier
+		}
+	}
+	name := path.Base(importPath)
+	if majorVersion.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	if dot := strings.Index(name, ".v"); dot > 0 && majorVersion.MatchString(name[dot+1:]) {
+		name = name[:dot]
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(name, "-go"), "go-")
+}
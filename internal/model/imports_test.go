@@ -0,0 +1,82 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatGo(t *testing.T) {
+	registerTestType(t, CustomType{Name: "decimal.Decimal", SQLType: "NUMERIC(20,4)", Import: "github.com/shopspring/decimal"})
+	registerTestType(t, CustomType{Name: "null.String", SQLType: "TEXT", Import: "gopkg.in/guregu/null.v4"})
+
+	src := `package models
+import (
+	"os"
+	yaml "gopkg.in/yaml.v3"
+	_ "embed"
+)
+type Order struct {
+	Total decimal.Decimal
+	Note null.String
+	PaidAt *time.Time
+}
+func (o *Order) Check(strings []string) error {
+	if len(strings) == 0 { return fmt.Errorf("no %s", yaml.Node{}.Value) }
+	return errors.New(strings[0])
+}
+`
+	formatted, err := formatGo([]byte(src))
+	require.NoError(t, err)
+	assert.Equal(t, `package models
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gopkg.in/guregu/null.v4"
+	yaml "gopkg.in/yaml.v3"
+)
+
+type Order struct {
+	Total  decimal.Decimal
+	Note   null.String
+	PaidAt *time.Time
+}
+
+func (o *Order) Check(strings []string) error {
+	if len(strings) == 0 {
+		return fmt.Errorf("no %s", yaml.Node{}.Value)
+	}
+	return errors.New(strings[0])
+}
+`, string(formatted))
+
+	formatted, err = formatGo([]byte("package models\n\nimport \"fmt\"\n\nvar Name = \"order\"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "package models\n\nvar Name = \"order\"\n", string(formatted))
+
+	formatted, err = formatGo([]byte("package models\n\nvar Max = math.MaxInt64\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "package models\n\nimport (\n\t\"math\"\n)\n\nvar Max = math.MaxInt64\n", string(formatted))
+
+	_, err = formatGo([]byte("package models\n\nfunc {"))
+	assert.Error(t, err)
+}
+
+func TestPackageName(t *testing.T) {
+	for importPath, name := range map[string]string{
+		"github.com/shopspring/decimal": "decimal",
+		"gopkg.in/yaml.v3":              "yaml",
+		"github.com/jackc/pgx/v5":       "pgx",
+		"github.com/mattn/go-sqlite3":   "sqlite3",
+		"database/sql/driver":           "driver",
+	} {
+		assert.Equal(t, name, packageName(importPath, nil), importPath)
+	}
+	assert.Equal(t, "null", packageName("gopkg.in/guregu/null.v4", map[string]string{"null": "gopkg.in/guregu/null.v4"}))
+}
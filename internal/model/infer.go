@@ -0,0 +1,341 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// InferOptions configures InferModels.
+type InferOptions struct {
+	// NestedAsJSON stores nested objects and arrays of objects in json.RawMessage fields instead of inferring
+	// related models for them.
+	NestedAsJSON bool
+	// Exists tells whether a model of the given name exists, so that related models are given other names. It
+	// may be nil.
+	Exists func(name string) bool
+}
+
+// InferModels infers the definition of the named model from a sample JSON document: an object, or an array of
+// objects whose keys are merged. Keys become fields named in Go style, with a json tag of the key, typed by
+// their values: strings, RFC 3339 times, int or float64 numbers, bools, and slices of them. Keys null or
+// missing in some objects give nullable fields, and keys of values of several types json.RawMessage fields.
+// The id, created_at and updated_at keys are left out, as every model has them.
+//
+// Nested objects give related models that the field <Key>ID of the model references, and arrays of objects
+// related models with a field <Model>ID referencing the model, unless options.NestedAsJSON is set. The related
+// models are returned first, in the order they are to be created.
+func InferModels(name string, sample []byte, options InferOptions) ([]*ModelDefinition, error) {
+	decoder := json.NewDecoder(bytes.NewReader(sample))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JSON sample: %w", err)
+	}
+	objects, ok := objectsOf(document)
+	if !ok {
+		return nil, fmt.Errorf("invalid JSON sample: expected an object or an array of objects")
+	}
+	in := &inference{options: options, names: map[string]bool{}}
+	in.names[name] = true
+	if _, err := in.model(name, objects, ""); err != nil {
+		return nil, err
+	}
+	return in.models, nil
+}
+
+type inference struct {
+	options InferOptions
+	// models are the inferred models, related models first.
+	models []*ModelDefinition
+	// names are the names of the inferred models.
+	names map[string]bool
+}
+
+// objectsOf returns the objects of a value that is an object or an array of objects.
+func objectsOf(value interface{}) ([]map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}, true
+	case []interface{}:
+		objects := make([]map[string]interface{}, 0, len(v))
+		for _, element := range v {
+			object, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			objects = append(objects, object)
+		}
+		return objects, len(objects) > 0
+	}
+	return nil, false
+}
+
+// model infers the model of the given name from the objects, after the related models of their nested objects.
+// parent is the model the objects are the elements of an array of, which the model references.
+func (in *inference) model(name string, objects []map[string]interface{}, parent string) (*ModelDefinition, error) {
+	def := NewModelDefinition(name, nil)
+	if parent != "" {
+		field := NewField(parent+"ID", "int", fmt.Sprintf(`json:"%s_id"`, ToSnakeCase(parent)), false, false)
+		field.References = parent
+		def.Fields = append(def.Fields, field)
+	}
+
+	var keys []string
+	seen := map[string]bool{}
+	for _, object := range objects {
+		for key := range object {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	// Keys are sorted, as the order of the keys of JSON objects is lost when decoding them.
+	sort.Strings(keys)
+
+	var children []func() error
+	for _, key := range keys {
+		fieldName := keyFieldName(key)
+		switch ToSnakeCase(fieldName) {
+		case "", "id", "created_at", "updated_at":
+			continue
+		}
+		if def.Field(fieldName) != nil {
+			return nil, fmt.Errorf("keys of the JSON sample give model %s two fields named %s", name, fieldName)
+		}
+		var values []interface{}
+		missing := false
+		for _, object := range objects {
+			value, ok := object[key]
+			if !ok || value == nil {
+				missing = true
+				continue
+			}
+			values = append(values, value)
+		}
+
+		kind := kindOf(values)
+		if !in.options.NestedAsJSON && kind == kindObject {
+			related := in.name(singularName(key), name)
+			field := NewField(fieldName+"ID", "int", fmt.Sprintf(`json:"%s_id"`, ToSnakeCase(fieldName)), missing, false)
+			field.References = related
+			def.Fields = append(def.Fields, field)
+			nested := make([]map[string]interface{}, len(values))
+			for i, v := range values {
+				nested[i] = v.(map[string]interface{})
+			}
+			// The related model is created before the model referencing it.
+			if _, err := in.model(related, nested, ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !in.options.NestedAsJSON && kind == kindArray {
+			if elements, ok := arrayObjects(values); ok {
+				related := in.name(singularName(key), name)
+				children = append(children, func() error {
+					_, err := in.model(related, elements, name)
+					return err
+				})
+				continue
+			}
+		}
+		def.Fields = append(def.Fields, NewField(fieldName, goTypeOf(kind, values), fmt.Sprintf(`json:"%s"`, key), missing, false))
+	}
+	if len(def.Fields) == 0 {
+		return nil, fmt.Errorf("the JSON sample gives model %s no fields", name)
+	}
+	in.models = append(in.models, def)
+	// Models of arrays of objects reference the model, so they are created after it.
+	for _, child := range children {
+		if err := child(); err != nil {
+			return nil, err
+		}
+	}
+	return def, nil
+}
+
+// name returns an unused name for a related model: the name derived from its key, or prefixed by the name of
+// the model it is nested in.
+func (in *inference) name(name, parent string) string {
+	exists := func(n string) bool {
+		return in.names[n] || (in.options.Exists != nil && in.options.Exists(n))
+	}
+	if exists(name) {
+		name = parent + name
+	}
+	for i := 2; exists(name); i++ {
+		name = fmt.Sprintf("%s%d", strings.TrimRight(name, "0123456789"), i)
+	}
+	in.names[name] = true
+	return name
+}
+
+// arrayObjects returns the elements of arrays of values, if they are all objects.
+func arrayObjects(values []interface{}) ([]map[string]interface{}, bool) {
+	var objects []map[string]interface{}
+	for _, value := range values {
+		for _, element := range value.([]interface{}) {
+			object, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, len(objects) > 0
+}
+
+// The kinds of JSON values, as inferred.
+const (
+	kindNone = iota
+	kindBool
+	kindInt
+	kindFloat
+	kindTime
+	kindString
+	kindObject
+	kindArray
+	// kindMixed is the kind of values of incompatible kinds.
+	kindMixed
+)
+
+func kindOf(values []interface{}) int {
+	kind := kindNone
+	for _, value := range values {
+		kind = mergeKinds(kind, valueKind(value))
+	}
+	return kind
+}
+
+func valueKind(value interface{}) int {
+	switch v := value.(type) {
+	case bool:
+		return kindBool
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return kindInt
+		}
+		return kindFloat
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return kindTime
+		}
+		return kindString
+	case map[string]interface{}:
+		return kindObject
+	case []interface{}:
+		return kindArray
+	}
+	return kindNone
+}
+
+// mergeKinds returns the kind of values of both kinds: integers and floats are floats, and times and other
+// strings strings.
+func mergeKinds(a, b int) int {
+	switch {
+	case a == kindNone || a == b:
+		return b
+	case b == kindNone:
+		return a
+	case (a == kindInt && b == kindFloat) || (a == kindFloat && b == kindInt):
+		return kindFloat
+	case (a == kindTime && b == kindString) || (a == kindString && b == kindTime):
+		return kindString
+	}
+	return kindMixed
+}
+
+// goTypeOf returns the Go type of values of the given kind. Arrays of scalars are slices of their type, and
+// other arrays, objects and values of mixed kinds are kept as JSON.
+func goTypeOf(kind int, values []interface{}) string {
+	switch kind {
+	case kindBool:
+		return "bool"
+	case kindInt:
+		return "int"
+	case kindFloat:
+		return "float64"
+	case kindTime:
+		return "time.Time"
+	case kindString, kindNone:
+		return "string"
+	case kindArray:
+		var elements []interface{}
+		for _, value := range values {
+			elements = append(elements, value.([]interface{})...)
+		}
+		switch elementKind := kindOf(elements); elementKind {
+		case kindBool, kindInt, kindFloat, kindTime, kindString:
+			return "[]" + goTypeOf(elementKind, nil)
+		}
+	}
+	return "json.RawMessage"
+}
+
+// initialisms are the words written in capitals in Go names.
+var initialisms = map[string]bool{
+	"api": true, "html": true, "http": true, "https": true, "id": true, "ip": true, "json": true, "sku": true,
+	"sql": true, "ui": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// keyFieldName returns the Go name of a field of the given JSON key: first_name and firstName become FirstName,
+// and user_id UserID.
+func keyFieldName(key string) string {
+	words := strings.FieldsFunc(ToSnakeCase(key), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, word := range words {
+		if initialisms[word] {
+			b.WriteString(strings.ToUpper(word))
+		} else {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	name := b.String()
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "F" + name
+	}
+	return name
+}
+
+// singularName returns the name of the model of a JSON key, singular: line_items gives LineItem.
+func singularName(key string) string {
+	snake := ToSnakeCase(key)
+	i := strings.LastIndex(snake, "_") + 1
+	return keyFieldName(snake[:i] + Singularize(snake[i:]))
+}
+
+// Singularize returns the singular of a lowercase English noun, inverting Pluralize where it can: categories
+// becomes category, addresses address, statuses status and people person.
+func Singularize(word string) string {
+	if irregularPlurals[word] == word {
+		return word
+	}
+	for singular, plural := range irregularPlurals {
+		if plural == word {
+			return singular
+		}
+	}
+	n := len(word)
+	switch {
+	case strings.HasSuffix(word, "ies") && n > 3 && !strings.ContainsRune("aeiou", rune(word[n-4])):
+		return word[:n-3] + "y"
+	case strings.HasSuffix(word, "yses"):
+		return word[:n-2] + "is"
+	case strings.HasSuffix(word, "uses") && n > 4 && !strings.ContainsRune("aeiou", rune(word[n-5])):
+		return word[:n-2]
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "zzes"),
+		strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"):
+		return word[:n-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && n > 1:
+		return word[:n-1]
+	}
+	return word
+}
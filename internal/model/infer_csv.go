@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVColumn maps a column of a CSV file to the field of the model inferred from it.
+type CSVColumn struct {
+	// Index is the position of the column in the CSV records.
+	Index  int
+	Header string
+	Field  string
+}
+
+// csvTimeLayouts are the layouts of the CSV values inferred as times, which PostgreSQL also accepts.
+var csvTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+var (
+	csvInt   = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)$`)
+	csvFloat = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+	csvBools = map[string]bool{"true": true, "false": true, "t": true, "f": true, "yes": true, "no": true}
+)
+
+// InferModelFromCSV infers the definition of the named model from the header and sample records of a CSV file.
+// Headers become fields named in Go style with a json tag of the header in snake case, typed by the values of
+// their column: int, float64, bool, time.Time or string. Integers with leading zeros, such as zip codes, and
+// integers beyond the range of an INTEGER column are strings. Columns with empty values give nullable fields.
+// The id, created_at and updated_at columns are left out, as every model has them.
+//
+// It returns the definition and the columns of the CSV file the fields are loaded from.
+func InferModelFromCSV(name string, header []string, records [][]string) (*ModelDefinition, []CSVColumn, error) {
+	if len(header) == 0 {
+		return nil, nil, fmt.Errorf("the CSV file has no header")
+	}
+	def := NewModelDefinition(name, nil)
+	var columns []CSVColumn
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		fieldName := keyFieldName(h)
+		switch ToSnakeCase(fieldName) {
+		case "", "id", "created_at", "updated_at":
+			continue
+		}
+		if def.Field(fieldName) != nil {
+			return nil, nil, fmt.Errorf("headers of the CSV file give model %s two fields named %s", name, fieldName)
+		}
+
+		kind := kindNone
+		missing := false
+		for _, record := range records {
+			if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+				missing = true
+				continue
+			}
+			kind = mergeKinds(kind, csvValueKind(strings.TrimSpace(record[i])))
+		}
+		goType := goTypeOf(kind, nil)
+		if kind == kindMixed {
+			goType = "string"
+		}
+		def.Fields = append(def.Fields, NewField(fieldName, goType, fmt.Sprintf(`json:"%s"`, ToSnakeCase(fieldName)), missing, false))
+		columns = append(columns, CSVColumn{Index: i, Header: h, Field: fieldName})
+	}
+	if len(def.Fields) == 0 {
+		return nil, nil, fmt.Errorf("the CSV file gives model %s no fields", name)
+	}
+	return def, columns, nil
+}
+
+// csvValueKind returns the kind of a non-empty CSV value.
+func csvValueKind(value string) int {
+	switch {
+	case csvInt.MatchString(value):
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return kindInt
+		}
+		return kindString
+	case csvFloat.MatchString(value):
+		if strings.HasPrefix(strings.TrimLeft(value, "+-"), "0") && !strings.HasPrefix(strings.TrimLeft(value, "+-"), "0.") {
+			return kindString
+		}
+		return kindFloat
+	case csvBools[strings.ToLower(value)]:
+		return kindBool
+	}
+	for _, layout := range csvTimeLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return kindTime
+		}
+	}
+	return kindString
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const orderSample = `[
+  {
+    "id": 1,
+    "number": "A-1001",
+    "total": 25,
+    "paid": true,
+    "placedAt": "2024-05-14T09:30:00Z",
+    "tags": ["gift", "express"],
+    "customer": {"id": 7, "name": "Ann", "email": "ann@example.com"},
+    "line_items": [{"sku": "T-1", "quantity": 2, "price": 9.5}],
+    "metadata": {"source": "web"},
+    "notes": null
+  },
+  {
+    "id": 2,
+    "number": "A-1002",
+    "total": 12.5,
+    "paid": false,
+    "placedAt": "2024-05-15T10:00:00Z",
+    "tags": [],
+    "customer": {"id": 8, "name": "Bob", "email": null},
+    "line_items": [{"sku": "M-2", "quantity": 1, "price": 12.5}],
+    "metadata": {"source": "app"},
+    "notes": "leave at the door",
+    "extra": [1, "two"]
+  }
+]`
+
+func TestInferModels(t *testing.T) {
+	defs, err := InferModels("Order", []byte(orderSample), InferOptions{})
+	require.NoError(t, err)
+
+	names := make([]string, len(defs))
+	for i, def := range defs {
+		names[i] = def.Name
+	}
+	assert.Equal(t, []string{"Customer", "Metadata", "Order", "LineItem"}, names)
+
+	customer := defs[0]
+	assert.Equal(t, []Field{
+		NewField("Email", "string", `json:"email"`, true, false),
+		NewField("Name", "string", `json:"name"`, false, false),
+	}, customer.Fields)
+
+	order := defs[2]
+	customerID := NewField("CustomerID", "int", `json:"customer_id"`, false, false)
+	customerID.References = "Customer"
+	metadataID := NewField("MetadataID", "int", `json:"metadata_id"`, false, false)
+	metadataID.References = "Metadata"
+	assert.Equal(t, []Field{
+		customerID,
+		NewField("Extra", "json.RawMessage", `json:"extra"`, true, false),
+		metadataID,
+		NewField("Notes", "string", `json:"notes"`, true, false),
+		NewField("Number", "string", `json:"number"`, false, false),
+		NewField("Paid", "bool", `json:"paid"`, false, false),
+		NewField("PlacedAt", "time.Time", `json:"placedAt"`, false, false),
+		NewField("Tags", "[]string", `json:"tags"`, false, false),
+		NewField("Total", "float64", `json:"total"`, false, false),
+	}, order.Fields)
+
+	lineItem := defs[3]
+	orderID := NewField("OrderID", "int", `json:"order_id"`, false, false)
+	orderID.References = "Order"
+	assert.Equal(t, []Field{
+		orderID,
+		NewField("Price", "float64", `json:"price"`, false, false),
+		NewField("Quantity", "int", `json:"quantity"`, false, false),
+		NewField("SKU", "string", `json:"sku"`, false, false),
+	}, lineItem.Fields)
+}
+
+func TestInferModels_NestedAsJSON(t *testing.T) {
+	exists := func(name string) bool { return name == "Customer" }
+	defs, err := InferModels("Order", []byte(orderSample), InferOptions{NestedAsJSON: true, Exists: exists})
+	require.NoError(t, err)
+	require.Len(t, defs, 1)
+	assert.Equal(t, "json.RawMessage", defs[0].Field("Customer").Type)
+	assert.Equal(t, "json.RawMessage", defs[0].Field("LineItems").Type)
+
+	defs, err = InferModels("Order", []byte(`{"customer": {"name": "Ann"}}`), InferOptions{Exists: exists})
+	require.NoError(t, err)
+	assert.Equal(t, "OrderCustomer", defs[0].Name)
+	assert.Equal(t, "OrderCustomer", defs[1].Field("CustomerID").References)
+
+	_, err = InferModels("Order", []byte(`[1, 2]`), InferOptions{})
+	assert.EqualError(t, err, "invalid JSON sample: expected an object or an array of objects")
+	_, err = InferModels("Order", []byte(`{"id": 1}`), InferOptions{})
+	assert.EqualError(t, err, "the JSON sample gives model Order no fields")
+	_, err = InferModels("Order", []byte(`{"user_id": 1, "userId": 2}`), InferOptions{})
+	assert.EqualError(t, err, "keys of the JSON sample give model Order two fields named UserID")
+}
+
+func TestSingularize(t *testing.T) {
+	for plural, singular := range map[string]string{
+		"categories": "category", "addresses": "address", "boxes": "box", "statuses": "status",
+		"analyses": "analysis", "people": "person", "items": "item", "data": "data", "keys": "key", "status": "status",
+	} {
+		assert.Equal(t, singular, Singularize(plural), plural)
+	}
+}
+
+func TestInferModelFromCSV(t *testing.T) {
+	header := []string{"id", "First Name", "zip", "score", "active", "joined", "note", "ref"}
+	records := [][]string{
+		{"1", "Ann", "02134", "12", "true", "2024-05-01", "", "3000000000"},
+		{"2", "Bob", "10001", "7.5", "F", "2024-05-02 10:00:00", "late", "4"},
+	}
+	def, columns, err := InferModelFromCSV("Member", header, records)
+	require.NoError(t, err)
+	assert.Equal(t, []Field{
+		NewField("FirstName", "string", `json:"first_name"`, false, false),
+		NewField("Zip", "string", `json:"zip"`, false, false),
+		NewField("Score", "float64", `json:"score"`, false, false),
+		NewField("Active", "bool", `json:"active"`, false, false),
+		NewField("Joined", "time.Time", `json:"joined"`, false, false),
+		NewField("Note", "string", `json:"note"`, true, false),
+		NewField("Ref", "string", `json:"ref"`, false, false),
+	}, def.Fields)
+	assert.Equal(t, CSVColumn{Index: 1, Header: "First Name", Field: "FirstName"}, columns[0])
+	assert.Len(t, columns, 7)
+
+	_, _, err = InferModelFromCSV("Member", []string{"id"}, nil)
+	assert.EqualError(t, err, "the CSV file gives model Member no fields")
+	_, _, err = InferModelFromCSV("Member", []string{"user_id", "UserID"}, nil)
+	assert.EqualError(t, err, "headers of the CSV file give model Member two fields named UserID")
+}
@@ -0,0 +1,171 @@
+// Package keyring encrypts the values of encrypted model fields with AES-256-GCM. Every ciphertext records the
+// ID of the key it was encrypted with, so a Keyring holding both the old and the new key reads values of either
+// while a key rotation is in progress. Package encryption exports it, and its declarations, after the import
+// block, are also the source of the keyring of the encryption support generated along the models with
+// encrypted fields, see model.RenderEncryptionFile, so that the generated repositories and "grayv-lsm db
+// rotate-keys" read and write the same ciphertext. It must therefore only use the packages it imports, and
+// declare nothing the generated models package declares.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ciphertextPrefix starts every ciphertext produced by a Keyring. The format is
+// "grv1:<key ID>:<base64(nonce|sealed)>".
+const ciphertextPrefix = "grv1:"
+
+// ErrUnknownKey is returned when a value was encrypted with a key the Keyring does not hold.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring holds the keys values are encrypted with. New values are encrypted with the primary key; values are
+// decrypted with the key recorded in them.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from base64-encoded 256-bit keys by ID. The primary key must be one of them.
+func NewKeyring(keys map[string]string, primary string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys configured")
+	}
+	k := &Keyring{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, encoded := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key ID %q: it must be non-empty and must not contain ':'", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s is not valid base64: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes long, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not configured", primary)
+	}
+	return k, nil
+}
+
+// GenerateKey returns a new random key, base64-encoded as expected by NewKeyring.
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Primary returns the ID of the key new values are encrypted with.
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// KeyIDs returns the IDs of every key in the keyring, sorted.
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// HasKey reports whether the keyring holds the key of the given ID.
+func (k *Keyring) HasKey(keyID string) bool {
+	_, ok := k.keys[keyID]
+	return ok
+}
+
+// Encrypt encrypts plaintext with the primary key.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	return k.EncryptWith(k.primary, plaintext)
+}
+
+// EncryptWith encrypts plaintext with the key of the given ID.
+func (k *Keyring) EncryptWith(keyID, plaintext string) (string, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(keyID))
+	return ciphertextPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt with whichever key of the keyring it was encrypted with.
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	keyID, err := KeyID(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext[len(ciphertextPrefix)+len(keyID)+1:])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed ciphertext")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value encrypted with key %s: %w", keyID, err)
+	}
+	return string(plaintext), nil
+}
+
+// Rotate re-encrypts a value under the key of the given ID. Values already encrypted with that key are
+// returned unchanged.
+func (k *Keyring) Rotate(keyID, ciphertext string) (string, error) {
+	current, err := KeyID(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if current == keyID {
+		return ciphertext, nil
+	}
+	plaintext, err := k.Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return k.EncryptWith(keyID, plaintext)
+}
+
+// KeyID returns the ID of the key a value was encrypted with.
+func KeyID(ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, ciphertextPrefix) {
+		return "", errors.New("value is not encrypted")
+	}
+	keyID, _, found := strings.Cut(ciphertext[len(ciphertextPrefix):], ":")
+	if !found {
+		return "", errors.New("malformed ciphertext")
+	}
+	return keyID, nil
+}
+
+// Prefix returns the prefix shared by every value encrypted with the key of the given ID. It lets SQL queries
+// select the values still encrypted with other keys.
+func Prefix(keyID string) string {
+	return ciphertextPrefix + keyID + ":"
+}
@@ -0,0 +1,563 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// kvStoreFile is the file generated next to the models with KV repositories declaring the KVStore they share.
+const kvStoreFile = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrKVStoreClosed is returned by the KV repositories of a closed KVStore.
+var ErrKVStoreClosed = errors.New("kv store is closed")
+
+// KVStore is an embedded store keeping the records of the KV repositories in a single JSON file, for
+// prototypes, demos and tools that run without a database server. Every write is saved before it returns, by
+// replacing the file, so the file always holds the last complete write. Only one process may use a file at a
+// time.
+type KVStore struct {
+	mu     sync.RWMutex
+	path   string
+	tables map[string]*kvTable
+	closed bool
+}
+
+// kvTable holds the records of a table, encoded as JSON, by ID.
+type kvTable struct {
+	NextID  uint                     ` + "`json:\"next_id\"`" + `
+	Records map[uint]json.RawMessage ` + "`json:\"records\"`" + `
+}
+
+// OpenKVStore opens the store kept in the file at path, which is created by the first write if it does not
+// exist.
+func OpenKVStore(path string) (*KVStore, error) {
+	s := &KVStore{path: path, tables: map[string]*kvTable{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.tables); err != nil {
+		return nil, fmt.Errorf("invalid kv store %s: %w", path, err)
+	}
+	for _, t := range s.tables {
+		if t.Records == nil {
+			t.Records = map[uint]json.RawMessage{}
+		}
+		for id := range t.Records {
+			if id >= t.NextID {
+				t.NextID = id + 1
+			}
+		}
+	}
+	return s, nil
+}
+
+// Close closes the store. Every write is already saved.
+func (s *KVStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// kvTx reads and changes the tables of a KVStore, see KVStore.view and KVStore.update.
+type kvTx struct {
+	s    *KVStore
+	undo []func()
+}
+
+// view runs fn with a transaction that only reads.
+func (s *KVStore) view(fn func(tx *kvTx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrKVStoreClosed
+	}
+	return fn(&kvTx{s: s})
+}
+
+// update runs fn with a transaction and saves its changes, which are undone if fn or the save fails. It fails
+// with ErrReadOnly while the repositories are read-only, see SetReadOnly.
+func (s *KVStore) update(fn func(tx *kvTx) error) error {
+	if ReadOnly() {
+		return ErrReadOnly
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrKVStoreClosed
+	}
+	tx := &kvTx{s: s}
+	err := fn(tx)
+	if err == nil && len(tx.undo) > 0 {
+		err = s.save()
+	}
+	if err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+	}
+	return err
+}
+
+// save writes the tables to a temporary file replacing the file of the store.
+func (s *KVStore) save() error {
+	data, err := json.MarshalIndent(s.tables, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// table returns the named table, creating it if needed.
+func (tx *kvTx) table(name string) *kvTable {
+	t, ok := tx.s.tables[name]
+	if !ok {
+		t = &kvTable{NextID: 1, Records: map[uint]json.RawMessage{}}
+		tx.s.tables[name] = t
+		tx.undo = append(tx.undo, func() { delete(tx.s.tables, name) })
+	}
+	return t
+}
+
+// nextID reserves the next ID of a table.
+func (tx *kvTx) nextID(table string) uint {
+	t := tx.table(table)
+	id := t.NextID
+	t.NextID++
+	tx.undo = append(tx.undo, func() { t.NextID = id })
+	return id
+}
+
+// get decodes the record of a table with the given ID into v, and reports whether it exists.
+func (tx *kvTx) get(table string, id uint, v interface{}) (bool, error) {
+	t, ok := tx.s.tables[table]
+	if !ok {
+		return false, nil
+	}
+	data, ok := t.Records[id]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// put stores v as the record of a table with the given ID.
+func (tx *kvTx) put(table string, id uint, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t := tx.table(table)
+	previous, existed := t.Records[id]
+	t.Records[id] = data
+	tx.undo = append(tx.undo, func() {
+		if existed {
+			t.Records[id] = previous
+		} else {
+			delete(t.Records, id)
+		}
+	})
+	return nil
+}
+
+// delete removes the record of a table with the given ID, and reports whether it existed.
+func (tx *kvTx) delete(table string, id uint) bool {
+	t, ok := tx.s.tables[table]
+	if !ok {
+		return false
+	}
+	previous, ok := t.Records[id]
+	if !ok {
+		return false
+	}
+	delete(t.Records, id)
+	tx.undo = append(tx.undo, func() { t.Records[id] = previous })
+	return true
+}
+
+// kvRecords decodes the records of a table in ID order, keeping those match accepts, or all of them when match
+// is nil.
+func kvRecords[T any](tx *kvTx, table string, match func(*T) bool) ([]*T, error) {
+	t, ok := tx.s.tables[table]
+	if !ok {
+		return nil, nil
+	}
+	ids := make([]uint, 0, len(t.Records))
+	for id := range t.Records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var records []*T
+	for _, id := range ids {
+		record := new(T)
+		if err := json.Unmarshal(t.Records[id], record); err != nil {
+			return nil, fmt.Errorf("invalid record %d of %s: %w", id, table, err)
+		}
+		if match == nil || match(record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+`
+
+// kvRepositoryTemplate is the template for the KV repository of a model, which stores its records in a KVStore
+// with the methods of its repository, and the interface both implement.
+const kvRepositoryTemplate = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// {{.Name}}Store provides the CRUD operations of {{.Name}} records, stored in a database by {{.Name}}Repository or
+// in a KVStore by {{.Name}}KVRepository, so that code written against it runs on either.
+type {{.Name}}Store interface {
+	Create(ctx context.Context, m *{{.Name}}) error
+	CreateBatch(ctx context.Context, ms []*{{.Name}}) error
+	Get(ctx context.Context, id uint) (*{{.Name}}, error)
+	List(ctx context.Context) ([]*{{.Name}}, error)
+	ListPage(ctx context.Context, req PageRequest) (*Page[*{{.Name}}], error)
+	Update(ctx context.Context, m *{{.Name}}) error
+	Delete(ctx context.Context, id uint) error
+}
+
+var (
+	_ {{.Name}}Store = (*{{.Name}}Repository)(nil)
+	_ {{.Name}}Store = (*{{.Name}}KVRepository)(nil)
+)
+
+// {{.Name}}KVRepository stores {{.Name}} records in the {{.Table}} table of a KVStore. It behaves like
+// {{.Name}}Repository, except that row-level security policies, read replicas and caches do not apply, and that
+// the hooks run outside the write, so that they may use the store: an error of an After hook is returned, but
+// the write is kept.
+type {{.Name}}KVRepository struct {
+	store *KVStore
+}
+
+// New{{.Name}}KVRepository creates a {{.Name}}KVRepository backed by the given store.
+func New{{.Name}}KVRepository(store *KVStore) *{{.Name}}KVRepository {
+	return &{{.Name}}KVRepository{store: store}
+}
+
+// Create stores m under the next ID and sets its ID, CreatedAt, and UpdatedAt fields.
+{{- if .DefaultedColumns}}
+// Unset {{.DefaultedColumns}} fields are stored with their default, which is set in m.
+{{- end}}
+func (r *{{.Name}}KVRepository) Create(ctx context.Context, m *{{.Name}}) error {
+	return r.CreateBatch(ctx, []*{{.Name}}{m})
+}
+
+// CreateBatch stores ms like Create, in one write: either every record is stored or none is.
+func (r *{{.Name}}KVRepository) CreateBatch(ctx context.Context, ms []*{{.Name}}) error {
+	if len(ms) == 0 {
+		return nil
+	}
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+{{- end}}
+	for _, m := range ms {
+{{- if .Tenant}}
+		m.{{.TenantGoName}} = tenant
+{{- end}}
+		if err := beforeCreate(ctx, m); err != nil {
+			return err
+		}
+	}
+	err {{if not .Tenant}}:{{end}}= r.store.update(func(tx *kvTx) error {
+		now := time.Now()
+		for _, m := range ms {
+{{- range .Defaults}}
+			{{.}}
+{{- end}}
+			m.ID = tx.nextID("{{.Table}}")
+			m.CreatedAt = now
+			m.UpdatedAt = now
+			if err := tx.put("{{.Table}}", m.ID, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		publish(ctx, Event{Table: "{{.Table}}", Op: OpCreate, ID: m.ID, Record: m})
+		if err := afterCreate(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the {{.Name}} with the given ID, or sql.ErrNoRows if it does not exist
+{{- if .Tenant}} for the tenant of ctx{{end}}.
+func (r *{{.Name}}KVRepository) Get(ctx context.Context, id uint) (*{{.Name}}, error) {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+	m := &{{.Name}}{}
+	err {{if not .Tenant}}:{{end}}= r.store.view(func(tx *kvTx) error {
+		found, err := tx.get("{{.Table}}", id, m)
+		if err != nil {
+			return err
+		}
+		if !found{{if .Tenant}} || m.{{.TenantGoName}} != tenant{{end}} {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// List returns every {{.Name}} ordered by ID, up to RowLimit records unless OnRowLimit allows more. Use
+// ListPage to read large tables a page at a time.
+func (r *{{.Name}}KVRepository) List(ctx context.Context) ([]*{{.Name}}, error) {
+	items, err := r.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRowLimit("{{.Table}}", len(items)); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListPage returns the page of {{.Name}} records ordered by ID selected by req, and the total number of
+// records. It returns an error wrapping ErrInvalidPage if req selects no valid page.
+func (r *{{.Name}}KVRepository) ListPage(ctx context.Context, req PageRequest) (*Page[*{{.Name}}], error) {
+	limit, offset, after, err := req.bounds()
+	if err != nil {
+		return nil, err
+	}
+	all, err := r.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var items []*{{.Name}}
+	for _, m := range all {
+		if uint64(m.ID) <= after {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if items = append(items, m); len(items) > limit {
+			break
+		}
+	}
+	return newPage(items, int64(len(all)), limit, func(m *{{.Name}}) uint { return m.ID }), nil
+}
+
+// records returns every {{.Name}}{{if .Tenant}} of the tenant of ctx{{end}} ordered by ID.
+func (r *{{.Name}}KVRepository) records(ctx context.Context) ([]*{{.Name}}, error) {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	match := func(m *{{.Name}}) bool { return m.{{.TenantGoName}} == tenant }
+{{- end}}
+	var items []*{{.Name}}
+	err {{if not .Tenant}}:{{end}}= r.store.view(func(tx *kvTx) error {
+		var err error
+		items, err = kvRecords[{{.Name}}](tx, "{{.Table}}", {{if .Tenant}}match{{else}}nil{{end}})
+		return err
+	})
+	return items, err
+}
+
+// Update writes every field of m and refreshes UpdatedAt. It returns sql.ErrNoRows if no record has m's ID.
+{{- if .LockVersion}}
+// The record is only written if its version is still m's Version, which is then incremented; otherwise a
+// *StaleObjectError is returned.
+{{- end}}
+{{- if .Tenant}}
+// Only records of the tenant of ctx are written.{{end}}
+func (r *{{.Name}}KVRepository) Update(ctx context.Context, m *{{.Name}}) error {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.{{.TenantGoName}} = tenant
+{{- end}}
+	if err := beforeUpdate(ctx, m); err != nil {
+		return err
+	}
+	err {{if not .Tenant}}:{{end}}= r.store.update(func(tx *kvTx) error {
+		stored := &{{.Name}}{}
+		found, err := tx.get("{{.Table}}", m.ID, stored)
+		if err != nil {
+			return err
+		}
+		if !found{{if .Tenant}} || stored.{{.TenantGoName}} != tenant{{end}} {
+			return sql.ErrNoRows
+		}
+{{- if .LockVersion}}
+		if stored.Version != m.Version {
+			return &StaleObjectError{Model: "{{.Name}}", ID: m.ID, Version: m.Version}
+		}
+		m.Version++
+{{- end}}
+		m.CreatedAt = stored.CreatedAt
+		m.UpdatedAt = time.Now()
+		return tx.put("{{.Table}}", m.ID, m)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, Event{Table: "{{.Table}}", Op: OpUpdate, ID: m.ID, Record: m})
+	return afterUpdate(ctx, m)
+}
+
+// Delete removes the {{.Name}} with the given ID. It returns sql.ErrNoRows if it does not exist. When
+// {{.Name}} implements BeforeDelete or AfterDelete, the record is loaded to call them.
+{{- if .Tenant}}
+// Only records of the tenant of ctx are deleted.
+{{- end}}
+func (r *{{.Name}}KVRepository) Delete(ctx context.Context, id uint) error {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+{{- end}}
+	m := &{{.Name}}{}
+	m.ID = id
+	if hasDeleteHooks(m) {
+		stored, err := r.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		m = stored
+	}
+	if err := beforeDelete(ctx, m); err != nil {
+		return err
+	}
+	err {{if not .Tenant}}:{{end}}= r.store.update(func(tx *kvTx) error {
+{{- if .Tenant}}
+		stored := &{{.Name}}{}
+		if found, err := tx.get("{{.Table}}", id, stored); err != nil || !found || stored.{{.TenantGoName}} != tenant {
+			if err == nil {
+				err = sql.ErrNoRows
+			}
+			return err
+		}
+{{- end}}
+		if !tx.delete("{{.Table}}", id) {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, Event{Table: "{{.Table}}", Op: OpDelete, ID: id})
+	return afterDelete(ctx, m)
+}
+`
+
+// kvRepositoryData is the view of a model definition consumed by kvRepositoryTemplate.
+type kvRepositoryData struct {
+	repositoryData
+	Defaults []string // statements setting the defaults of the unset defaulted columns of m, see kvDefaults
+}
+
+// kvDefaults returns the statements setting the unset fields of a record whose column has a default, which a
+// database would store: pointer fields with a default, and time fields defaulting to now.
+func kvDefaults(modelDef *ModelDefinition) []string {
+	var statements []string
+	for _, c := range modelColumns(modelDef) {
+		if c.Field == nil || c.Field.Default == "" {
+			continue
+		}
+		switch {
+		case c.GoType == "time.Time" && c.Field.Default == "now":
+			statements = append(statements, fmt.Sprintf("if m.%s.IsZero() {\nm.%s = now\n}", c.GoName, c.GoName))
+		case strings.HasPrefix(c.GoType, "*"):
+			element := *c.Field
+			element.Type = strings.TrimPrefix(element.Type, "*")
+			if value := goDefault(modelDef.Name, element); value != "" {
+				statements = append(statements, fmt.Sprintf("if m.%s == nil {\nv := %s(%s)\nm.%s = &v\n}",
+					c.GoName, strings.TrimPrefix(c.GoType, "*"), value, c.GoName))
+			}
+		}
+	}
+	return statements
+}
+
+// RenderKVFiles renders the KV repository of a model, storing its records in an embedded file instead of a
+// database, and the KVStore it is backed by. They are generated next to the model and its repository, see
+// RenderModelFiles, whose hooks, events and pages they share. Models with encrypted fields have none, as the
+// file holds the records unencrypted.
+func RenderKVFiles(modelDef *ModelDefinition) ([]*GeneratedFile, error) {
+	for _, field := range modelDef.Fields {
+		if field.Encrypted {
+			return nil, fmt.Errorf("model %s cannot have a KV repository: its field %s is encrypted", modelDef.Name, field.Name)
+		}
+	}
+	data, err := newRepositoryData(modelDef)
+	if err != nil {
+		return nil, err
+	}
+	content, err := renderTemplate("kv-repository", kvRepositoryData{repositoryData: data, Defaults: kvDefaults(modelDef)})
+	if err != nil {
+		return nil, err
+	}
+	content, err = formatGo(content)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting kv repository: %w", err)
+	}
+	return []*GeneratedFile{
+		{Path: path.Join(modelOutputDir(modelDef), strings.ToLower(modelDef.Name)+"_kv.go"), Content: content},
+		{Path: path.Join(modelOutputDir(modelDef), "kvstore.go"), Content: []byte(templateSource("kv-store"))},
+	}, nil
+}
@@ -0,0 +1,333 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LintSeverity is how serious a lint issue is. Errors make "model lint" fail; warnings only do with --strict.
+type LintSeverity string
+
+// Lint severities.
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// ParseLintSeverity returns the severity with the given name, or LintError if the name is empty.
+func ParseLintSeverity(name string) (LintSeverity, error) {
+	switch severity := LintSeverity(name); severity {
+	case "":
+		return LintError, nil
+	case LintError, LintWarning:
+		return severity, nil
+	default:
+		return "", fmt.Errorf("unknown severity %q (expected %s or %s)", name, LintError, LintWarning)
+	}
+}
+
+// LintIssue is a violation of a lint rule by a model definition.
+type LintIssue struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Model    string       `json:"model"`
+	Field    string       `json:"field,omitempty"`
+	Message  string       `json:"message"`
+}
+
+// String formats the issue for display as "severity: Model.field: message (rule)".
+func (i LintIssue) String() string {
+	subject := i.Model
+	if i.Field != "" {
+		subject += "." + i.Field
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", i.Severity, subject, i.Message, i.Rule)
+}
+
+// LintRule is a check of model definitions. Check returns the violations of a definition; the rule fills in
+// their Rule and Model, and their Severity unless the check chose one.
+type LintRule struct {
+	Name        string
+	Description string
+	Severity    LintSeverity
+	Check       func(def *ModelDefinition) []LintIssue
+}
+
+// Lint checks the definitions against the rules and returns the issues found, by model and then by rule.
+func Lint(defs []*ModelDefinition, rules []LintRule) []LintIssue {
+	sorted := append([]*ModelDefinition{}, defs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	issues := []LintIssue{}
+	for _, def := range sorted {
+		for _, rule := range rules {
+			for _, issue := range rule.Check(def) {
+				issue.Rule = rule.Name
+				issue.Model = def.Name
+				if issue.Severity == "" {
+					issue.Severity = rule.Severity
+				}
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues
+}
+
+// BuiltinLintRules returns the rules checked by default: every table has a usable primary key, reference
+// columns are indexed, tables and columns are not named after reserved words, and names follow conventions.
+func BuiltinLintRules() []LintRule {
+	return []LintRule{
+		{
+			Name:        "primary-key",
+			Description: "every table has an integer id primary key, and other fields are not marked primary",
+			Severity:    LintError,
+			Check:       lintPrimaryKey,
+		},
+		{
+			Name:        "fk-index",
+			Description: "fields referencing another model are indexed",
+			Severity:    LintError,
+			Check:       lintReferenceIndexes,
+		},
+		{
+			Name:        "reserved-word",
+			Description: "tables and columns are not named after SQL reserved words",
+			Severity:    LintError,
+			Check:       lintReservedWords,
+		},
+		{
+			Name:        "naming",
+			Description: "models are PascalCase, tables snake_case, and field names survive code generation",
+			Severity:    LintWarning,
+			Check:       lintNaming,
+		},
+	}
+}
+
+// SelectLintRules returns the built-in rules except the disabled ones, followed by the custom rules. Disabling
+// a rule that does not exist is an error, so a typo does not silently keep a rule enabled.
+func SelectLintRules(disabled []string, custom []LintRule) ([]LintRule, error) {
+	builtin := BuiltinLintRules()
+	names := make(map[string]bool, len(builtin))
+	for _, rule := range builtin {
+		names[rule.Name] = true
+	}
+	skip := make(map[string]bool, len(disabled))
+	for _, name := range disabled {
+		if !names[name] {
+			return nil, fmt.Errorf("unknown lint rule %q", name)
+		}
+		skip[name] = true
+	}
+
+	var rules []LintRule
+	for _, rule := range builtin {
+		if !skip[rule.Name] {
+			rules = append(rules, rule)
+		}
+	}
+	for _, rule := range custom {
+		if names[rule.Name] {
+			return nil, fmt.Errorf("lint rule %q is built in", rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// lintPrimaryKey checks that the id primary key backing DefaultModel is not redeclared with a non-integer
+// type, which the generated code would silently ignore, and warns about other fields marked primary, which are
+// only stored as unique columns.
+func lintPrimaryKey(def *ModelDefinition) []LintIssue {
+	var issues []LintIssue
+	for _, field := range def.Fields {
+		switch {
+		case ToSnakeCase(field.Name) == "id" && !isIntegerType(strings.TrimPrefix(field.Type, "*")):
+			issues = append(issues, LintIssue{Field: field.Name, Message: fmt.Sprintf(
+				"field of type %s is stored in the integer id primary key; remove it or declare it as an integer", field.Type)})
+		case field.IsPrimary && !isBaseColumn(ToSnakeCase(field.Name)):
+			issues = append(issues, LintIssue{Field: field.Name, Severity: LintWarning,
+				Message: "field is marked primary but the primary key is id; it is stored as a UNIQUE column"})
+		}
+	}
+	return issues
+}
+
+// isIntegerType reports whether goType is one of the integer types.
+func isIntegerType(goType string) bool {
+	return strings.HasPrefix(goType, "int") || strings.HasPrefix(goType, "uint")
+}
+
+// lintReferenceIndexes checks that the columns of fields referencing another model are indexed, so joins and
+// the checks of the referenced rows when they are deleted do not scan the table.
+func lintReferenceIndexes(def *ModelDefinition) []LintIssue {
+	var issues []LintIssue
+	for _, field := range ownFields(def) {
+		if field.References != "" && !field.Indexed {
+			issues = append(issues, LintIssue{Field: field.Name, Message: fmt.Sprintf(
+				"references %s but is not indexed; index it with model update %s --index-fields %s", field.References, def.Name, field.Name)})
+		}
+	}
+	return issues
+}
+
+// reservedWords are the PostgreSQL reserved key words, which cannot name tables or columns without quoting.
+// Generated SQL does not quote identifiers.
+var reservedWords = wordSet(`all analyse analyze and any array as asc asymmetric authorization binary
+	both case cast check collate collation column concurrently constraint create cross current_catalog
+	current_date current_role current_schema current_time current_timestamp current_user default deferrable
+	desc distinct do else end except false fetch for foreign freeze from full grant group having ilike in
+	initially inner intersect into is isnull join lateral leading left like limit localtime localtimestamp
+	natural not notnull null offset on only or order outer overlaps placing primary references returning
+	right select session_user similar some symmetric system_user table tablesample then to trailing true
+	union unique user using variadic verbose when where window with`)
+
+// wordSet returns the set of the whitespace-separated words of s.
+func wordSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(s) {
+		set[word] = true
+	}
+	return set
+}
+
+// lintReservedWords checks that the table and the columns of a model are not named after reserved words.
+func lintReservedWords(def *ModelDefinition) []LintIssue {
+	var issues []LintIssue
+	if table := TableName(def); reservedWords[table] {
+		issues = append(issues, LintIssue{Message: fmt.Sprintf(
+			"table %s is a reserved word; rename it with model update %s --table <name>", table, def.Name)})
+	}
+	for _, field := range ownFields(def) {
+		if column := ColumnName(&field); reservedWords[column] {
+			issues = append(issues, LintIssue{Field: field.Name, Message: fmt.Sprintf("column %s is a reserved word", column)})
+		}
+	}
+	return issues
+}
+
+var (
+	pascalCasePattern = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	snakeCasePattern  = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+)
+
+// lintNaming checks that model names are PascalCase, table names snake_case, and that field names are the Go
+// names generated for them, which title-case the name and lowercase the rest: a field named authorID is
+// generated as Authorid.
+func lintNaming(def *ModelDefinition) []LintIssue {
+	var issues []LintIssue
+	if !pascalCasePattern.MatchString(def.Name) {
+		issues = append(issues, LintIssue{Message: "model name should be PascalCase"})
+	}
+	if table := TableName(def); !snakeCasePattern.MatchString(table) {
+		issues = append(issues, LintIssue{Message: fmt.Sprintf("table %s should be snake_case", table)})
+	}
+	for _, field := range ownFields(def) {
+		goName := goFieldName(field.Name)
+		if (goName != field.Name && strings.ToLower(field.Name) != field.Name) || strings.ContainsAny(field.Name, "_-") {
+			issues = append(issues, LintIssue{Field: field.Name, Message: fmt.Sprintf(
+				"field is generated as %s with column %s; name it with letters and digits only, capitalized at most at the start", goName, ColumnName(&field))})
+		}
+	}
+	return issues
+}
+
+// Targets of pattern rules: the names a PatternRule checks.
+const (
+	LintTargetModel  = "model"
+	LintTargetTable  = "table"
+	LintTargetField  = "field"
+	LintTargetColumn = "column"
+)
+
+// PatternRule describes a user-defined lint rule: the names of its target must match Match and must not match
+// Forbid, and every model must have the fields of RequireFields.
+type PatternRule struct {
+	Name          string
+	Target        string // "model", "table", "field" or "column"; required with Match or Forbid
+	Match         string
+	Forbid        string
+	RequireFields []string
+	Severity      string // "error" (the default) or "warning"
+	Message       string // replaces the generated description of violations
+}
+
+// LintRule compiles the pattern rule.
+func (r PatternRule) LintRule() (LintRule, error) {
+	rule := LintRule{Name: r.Name}
+	if r.Name == "" {
+		return rule, fmt.Errorf("lint rule has no name")
+	}
+	severity, err := ParseLintSeverity(r.Severity)
+	if err != nil {
+		return rule, fmt.Errorf("lint rule %s: %w", r.Name, err)
+	}
+	rule.Severity = severity
+
+	match, err := compilePattern(r.Match)
+	if err != nil {
+		return rule, fmt.Errorf("lint rule %s: %w", r.Name, err)
+	}
+	forbid, err := compilePattern(r.Forbid)
+	if err != nil {
+		return rule, fmt.Errorf("lint rule %s: %w", r.Name, err)
+	}
+	switch {
+	case match == nil && forbid == nil && len(r.RequireFields) == 0:
+		return rule, fmt.Errorf("lint rule %s checks nothing: set match, forbid or require_fields", r.Name)
+	case (match != nil || forbid != nil) && !containsString([]string{LintTargetModel, LintTargetTable, LintTargetField, LintTargetColumn}, r.Target):
+		return rule, fmt.Errorf("lint rule %s has target %q (expected model, table, field or column)", r.Name, r.Target)
+	}
+
+	rule.Description = r.Message
+	rule.Check = func(def *ModelDefinition) []LintIssue {
+		var issues []LintIssue
+		report := func(field, message string) {
+			if r.Message != "" {
+				message = r.Message
+			}
+			issues = append(issues, LintIssue{Field: field, Message: message})
+		}
+		checkName := func(field, kind, name string) {
+			if match != nil && !match.MatchString(name) {
+				report(field, fmt.Sprintf("%s %s does not match %s", kind, name, match))
+			}
+			if forbid != nil && forbid.MatchString(name) {
+				report(field, fmt.Sprintf("%s %s matches %s", kind, name, forbid))
+			}
+		}
+		switch r.Target {
+		case LintTargetModel:
+			checkName("", "model", def.Name)
+		case LintTargetTable:
+			checkName("", "table", TableName(def))
+		case LintTargetField, LintTargetColumn:
+			for _, field := range ownFields(def) {
+				if r.Target == LintTargetField {
+					checkName(field.Name, "field", field.Name)
+				} else {
+					checkName(field.Name, "column", ColumnName(&field))
+				}
+			}
+		}
+		for _, name := range r.RequireFields {
+			if def.Field(name) == nil {
+				report("", fmt.Sprintf("model has no field %s", name))
+			}
+		}
+		return issues
+	}
+	return rule, nil
+}
+
+// compilePattern compiles a regular expression, or returns nil if it is empty.
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
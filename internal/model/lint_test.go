@@ -0,0 +1,82 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lintIssueSummaries(issues []LintIssue) []string {
+	summaries := make([]string, len(issues))
+	for i, issue := range issues {
+		summaries[i] = issue.Rule + " " + string(issue.Severity) + " " + issue.Model + "." + issue.Field
+	}
+	return summaries
+}
+
+func TestLint_BuiltinRules(t *testing.T) {
+	order := NewModelDefinition("Order", []Field{
+		NewField("ID", "string", "", false, true),
+		NewField("Code", "string", "", false, true),
+		NewField("user", "int", "", false, false),
+		NewField("authorID", "int", "", false, false),
+		NewField("customer", "int", "", false, false),
+	})
+	assert.NoError(t, order.SetTable("order"))
+	assert.NoError(t, order.SetReference("user", "User"))
+	assert.NoError(t, order.SetReference("customer", "User"))
+	assert.NoError(t, order.IndexField("customer"))
+	user := NewModelDefinition("User", []Field{NewField("email", "string", "", false, false)})
+
+	rules, err := SelectLintRules(nil, nil)
+	assert.NoError(t, err)
+	issues := Lint([]*ModelDefinition{user, order}, rules)
+	assert.Equal(t, []string{
+		"primary-key error Order.ID",
+		"primary-key warning Order.Code",
+		"fk-index error Order.user",
+		"reserved-word error Order.",
+		"reserved-word error Order.user",
+		"naming warning Order.authorID",
+	}, lintIssueSummaries(issues))
+	assert.Equal(t, "error: Order.user: references User but is not indexed; index it with model update Order --index-fields user (fk-index)", issues[2].String())
+
+	rules, err = SelectLintRules([]string{"naming", "reserved-word"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, Lint([]*ModelDefinition{order}, rules), 3)
+
+	_, err = SelectLintRules([]string{"nameing"}, nil)
+	assert.Error(t, err)
+}
+
+func TestPatternRule(t *testing.T) {
+	def := NewModelDefinition("TmpImport", []Field{NewField("Payload", "string", "", false, false)})
+	assert.NoError(t, def.SetTable(DefaultNamingStrategy.TableName(def.Name)))
+
+	rule, err := PatternRule{Name: "no-tmp", Target: LintTargetTable, Forbid: "^tmp_"}.LintRule()
+	assert.NoError(t, err)
+	audit, err := PatternRule{Name: "audit", RequireFields: []string{"createdby"}, Severity: "warning", Message: "models record their author"}.LintRule()
+	assert.NoError(t, err)
+	columns, err := PatternRule{Name: "short-columns", Target: LintTargetColumn, Match: "^.{1,5}$"}.LintRule()
+	assert.NoError(t, err)
+
+	rules, err := SelectLintRules(nil, []LintRule{rule, audit, columns})
+	assert.NoError(t, err)
+	issues := Lint([]*ModelDefinition{def}, rules)
+	assert.Equal(t, []string{"no-tmp error TmpImport.", "audit warning TmpImport.", "short-columns error TmpImport.Payload"}, lintIssueSummaries(issues))
+	assert.Equal(t, "table tmp_imports matches ^tmp_", issues[0].Message)
+	assert.Equal(t, "models record their author", issues[1].Message)
+
+	for _, invalid := range []PatternRule{
+		{Target: LintTargetTable, Forbid: "x"},
+		{Name: "nothing"},
+		{Name: "target", Target: "index", Match: "x"},
+		{Name: "pattern", Target: LintTargetField, Match: "("},
+		{Name: "severity", Target: LintTargetField, Match: "x", Severity: "fatal"},
+	} {
+		_, err := invalid.LintRule()
+		assert.Error(t, err, invalid.Name)
+	}
+	_, err = SelectLintRules(nil, []LintRule{{Name: "naming"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,277 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+// ManifestFile is the location of the generation manifest relative to the project root.
+const ManifestFile = ".grav/manifest.json"
+
+// manifestFormatVersion is bumped whenever the layout of the manifest changes incompatibly. Manifests written
+// in an older format are discarded, which simply causes every artifact to be regenerated once.
+const manifestFormatVersion = 2
+
+// Manifest records, for every generated artifact, a hash of the definition it was generated from, the versions of
+// the templates that were used, and a hash of every file that was written. Because generation is deterministic,
+// a build can regenerate the artifacts and compare them against the manifest to prove they are reproducible.
+//
+// The manifest deliberately contains no timestamps so that generating the same inputs twice produces a
+// byte-identical manifest.
+type Manifest struct {
+	FormatVersion int                       `json:"format_version"`
+	Entries       map[string]*ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry describes one generator run for a single model.
+type ManifestEntry struct {
+	Artifact
+	InputHash string            `json:"input_hash"`
+	Templates map[string]string `json:"templates,omitempty"`
+	Outputs   []ManifestOutput  `json:"outputs"`
+}
+
+// ManifestOutput is a single generated file and the SHA-256 hash of its content.
+type ManifestOutput struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// NewManifest returns an empty manifest.
+func NewManifest() *Manifest {
+	return &Manifest{
+		FormatVersion: manifestFormatVersion,
+		Entries:       make(map[string]*ManifestEntry),
+	}
+}
+
+// LoadManifest reads the manifest from the given file system. A missing manifest, or one written in an older
+// format, is not an error; an empty one is returned instead.
+func LoadManifest(fsys filesystem.FS) (*Manifest, error) {
+	data, err := fsys.ReadFile(ManifestFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return NewManifest(), nil
+		}
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	manifest := NewManifest()
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.FormatVersion < manifestFormatVersion {
+		return NewManifest(), nil
+	}
+	if manifest.FormatVersion != manifestFormatVersion {
+		return nil, fmt.Errorf("unsupported manifest format version %d", manifest.FormatVersion)
+	}
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]*ManifestEntry)
+	}
+	return manifest, nil
+}
+
+// Save writes the manifest to the given file system. Map keys are sorted by encoding/json, so the output is stable.
+func (m *Manifest) Save(fsys filesystem.FS) error {
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := fsys.MkdirAll(path.Dir(ManifestFile), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	return fsys.WriteFile(ManifestFile, append(data, '\n'), 0644)
+}
+
+// Record stores the generation of an artifact from the given definition and the files rendered for it,
+// replacing any previous entry for the same generator and model.
+func (m *Manifest) Record(artifact Artifact, modelDef *ModelDefinition, files ...*GeneratedFile) error {
+	entry, err := newManifestEntry(artifact, modelDef, files)
+	if err != nil {
+		return err
+	}
+	m.Entries[artifact.Key()] = entry
+	return nil
+}
+
+// newManifestEntry builds the manifest entry describing an artifact rendered from the given definition.
+func newManifestEntry(artifact Artifact, modelDef *ModelDefinition, files []*GeneratedFile) (*ManifestEntry, error) {
+	inputHash, err := HashDefinition(generatorInput(artifact.Generator, modelDef))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &ManifestEntry{
+		Artifact:  artifact,
+		InputHash: inputHash,
+		Templates: TemplateVersions(artifact.Generator),
+	}
+	for _, file := range files {
+		entry.Outputs = append(entry.Outputs, ManifestOutput{Path: file.Path, Hash: hashBytes(file.Content)})
+	}
+	return entry, nil
+}
+
+// Keys returns the keys of all entries recorded in the manifest in ascending order.
+func (m *Manifest) Keys() []string {
+	return sortedKeys(m.Entries)
+}
+
+// Verify checks that every output recorded in the manifest exists on the given file system with the recorded
+// hash. It returns one human-readable problem per mismatch; an empty result means the artifacts are intact.
+func (m *Manifest) Verify(fsys filesystem.FS) []string {
+	var problems []string
+	for _, key := range m.Keys() {
+		for _, output := range m.Entries[key].Outputs {
+			data, err := fsys.ReadFile(output.Path)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s: %v", key, output.Path, err))
+				continue
+			}
+			if hash := hashBytes(data); hash != output.Hash {
+				problems = append(problems, fmt.Sprintf("%s: %s: content hash %s does not match manifest hash %s", key, output.Path, hash, output.Hash))
+			}
+		}
+	}
+	return problems
+}
+
+// Reproduces reports whether rendering the entry's artifact from the given definition yields exactly the
+// recorded entry: the same input hash, template versions, output paths, and output hashes.
+func (m *Manifest) Reproduces(key string, modelDef *ModelDefinition) (bool, error) {
+	entry, exists := m.Entries[key]
+	if !exists {
+		return false, fmt.Errorf("no manifest entry for %s", key)
+	}
+	files, err := RenderArtifact(entry.Artifact, modelDef)
+	if err != nil {
+		return false, err
+	}
+	rendered, err := newManifestEntry(entry.Artifact, modelDef, files)
+	if err != nil {
+		return false, err
+	}
+	return sameEntry(rendered, entry), nil
+}
+
+// UpToDate reports whether the given artifact can be skipped during generation. It is true only when the
+// manifest holds an entry for it with the same parameters, whose input hash and template versions match the
+// current ones, and whose recorded outputs are all still present on the file system with their recorded hashes.
+func (m *Manifest) UpToDate(fsys filesystem.FS, artifact Artifact, modelDef *ModelDefinition) bool {
+	entry, exists := m.Entries[artifact.Key()]
+	if !exists || len(entry.Outputs) == 0 || !sameStrings(entry.Params, artifact.Params) {
+		return false
+	}
+
+	inputHash, err := HashDefinition(generatorInput(artifact.Generator, modelDef))
+	if err != nil || inputHash != entry.InputHash {
+		return false
+	}
+	if !sameStrings(entry.Templates, TemplateVersions(artifact.Generator)) {
+		return false
+	}
+
+	for _, output := range entry.Outputs {
+		data, err := fsys.ReadFile(output.Path)
+		if err != nil || hashBytes(data) != output.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// HashDefinition returns the SHA-256 hash of the canonical JSON encoding of a model definition. Where the
+// artifacts are written is not part of the definition's identity; it is recorded in the artifact's parameters.
+func HashDefinition(modelDef *ModelDefinition) (string, error) {
+	data, err := json.Marshal(modelDef)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal model definition: %w", err)
+	}
+	return hashBytes(data), nil
+}
+
+// generatorInput returns the part of a definition the given generator consumes. Protobuf field numbers and
+// reserved numbers only affect the protobuf and gRPC generators, and row-level security policies only affect the
+// Go generator, so they are stripped for every other generator; otherwise numbering fields with "model proto"
+// would make the Go and TypeScript artifacts look stale.
+func generatorInput(generator string, modelDef *ModelDefinition) *ModelDefinition {
+	input := *modelDef
+	if generator != GeneratorProto && generator != GeneratorGRPC {
+		input.Fields = make([]Field, len(modelDef.Fields))
+		for i, field := range modelDef.Fields {
+			field.ProtoNumber = 0
+			input.Fields[i] = field
+		}
+		input.Options.ProtoReserved = nil
+	}
+	if generator != GeneratorGo {
+		input.Options.Policies = nil
+	}
+	return &input
+}
+
+// TemplateVersions returns the version of every template used by the given generator, expressed as the SHA-256
+// hash of its source, which is the source of its override when one is loaded, see LoadTemplateOverrides. Generators that do not render from templates have no versions.
+func TemplateVersions(generator string) map[string]string {
+	names := generatorTemplates[generator]
+	if len(names) == 0 {
+		return nil
+	}
+	versions := make(map[string]string, len(names))
+	for _, name := range names {
+		versions[name] = hashBytes([]byte(templateSource(name)))
+	}
+	return versions
+}
+
+// sameEntry reports whether two manifest entries describe byte-identical generations.
+func sameEntry(a, b *ManifestEntry) bool {
+	if a.Key() != b.Key() || !sameStrings(a.Params, b.Params) || a.InputHash != b.InputHash ||
+		!sameStrings(a.Templates, b.Templates) || len(a.Outputs) != len(b.Outputs) {
+		return false
+	}
+	for i := range a.Outputs {
+		if a.Outputs[i] != b.Outputs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameStrings reports whether two string maps hold the same entries. A nil map equals an empty one.
+func sameStrings(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// hashBytes returns the hex-encoded SHA-256 hash of data.
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sortedKeys returns the keys of a string-keyed map in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
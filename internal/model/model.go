@@ -1,11 +1,16 @@
 package model
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"fmt"
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/ooyeku/grayv-lsm/pkg/logging"
 	"github.com/sirupsen/logrus"
-	"os"
+	"io/fs"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,6 +20,10 @@ import (
 // Example usage can be found in the loadModels() method of the ModelManager struct.
 var logger = logrus.New()
 
+func init() {
+	logging.Register(logger)
+}
+
 // Model represents a basic model structure for database entities.
 // It includes the following fields:
 //   - ID: The unique identifier for the model.
@@ -139,12 +148,30 @@ func (m *DefaultModel) AfterDelete() error {
 }
 
 // Field represents a database field in a model.
+// ProtoNumber is the protobuf field number assigned to the field the first time a .proto file is generated for
+// its model; it is stored with the definition so numbering stays stable across runs.
+// Encrypted marks a string field whose values are stored encrypted with the configured encryption keys, see
+// package encryption; its column holds the ciphertext and is TEXT.
+// Sensitive marks a field holding personal data, which privacy erasure anonymizes. References names the model
+// whose ID the field holds, relating the records of both models.
+// Default is the SQL default of the field's column, see SetDefault, and Indexed adds an index on the column.
+// Fields of type "vector(n)" hold pgvector embeddings of n dimensions; VectorMetric is the distance metric
+// their index supports, see IndexVectorField. Fake is the kind of the fake values generated for the field by
+// the mock server and the seed generator, see SetFakeHint.
 type Field struct {
-	Name      string
-	Type      string
-	Tag       string
-	IsNull    bool
-	IsPrimary bool
+	Name         string
+	Type         string
+	Tag          string
+	IsNull       bool
+	IsPrimary    bool
+	ProtoNumber  int    `json:",omitempty"`
+	Encrypted    bool   `json:",omitempty"`
+	Sensitive    bool   `json:",omitempty"`
+	References   string `json:",omitempty"`
+	Default      string `json:",omitempty"`
+	Indexed      bool   `json:",omitempty"`
+	VectorMetric string `json:",omitempty"`
+	Fake         string `json:",omitempty"`
 }
 
 // NewField creates a new instance of the Field struct with the provided name, fieldType, tag,
@@ -159,13 +186,38 @@ func NewField(name, fieldType, tag string, isNull, isPrimary bool) Field {
 	}
 }
 
-// ModelDefinition represents the definition of a model with its name, fields, and output directory.
+// ModelDefinition represents the definition of a model with its name, fields, model-level options, and output directory.
 type ModelDefinition struct {
 	Name      string
 	Fields    []Field
+	Options   ModelOptions
 	OutputDir string
 }
 
+// ModelOptions holds model-level settings that are not tied to a single field.
+//
+// It contains the following fields:
+//   - ProtoReserved: protobuf field numbers of removed fields, which must never be reused
+//   - Policies: row-level security policies on the model's table
+//   - Table: the name of the model's table, see TableName
+//   - LockVersion: optimistic locking of the model's records, see EnableLockVersion
+//   - TenantField: the field scoping the model's records to a tenant, see SetTenantField
+//   - Permissions: the roles allowed to perform each action on the model's records, see SetPermission
+//   - SearchFields: the text fields indexed in the search backend, see SetSearchFields
+//   - Cache: the cache of the model's records in the generated repository, see SetCache
+//   - UpsertKeys: the fields the generated repository upserts the model's records on, see SetUpsertKeys
+type ModelOptions struct {
+	ProtoReserved []int               `json:",omitempty"`
+	Policies      []Policy            `json:",omitempty"`
+	Table         string              `json:",omitempty"`
+	LockVersion   bool                `json:",omitempty"`
+	TenantField   string              `json:",omitempty"`
+	Permissions   map[string][]string `json:",omitempty"`
+	SearchFields  []string            `json:",omitempty"`
+	Cache         *CacheOptions       `json:",omitempty"`
+	UpsertKeys    []string            `json:",omitempty"`
+}
+
 // NewModelDefinition creates a new instance of ModelDefinition with the specified name and fields.
 // It returns a pointer to the newly created ModelDefinition.
 func NewModelDefinition(name string, fields []Field) *ModelDefinition {
@@ -178,15 +230,25 @@ func NewModelDefinition(name string, fields []Field) *ModelDefinition {
 // ModelManager is responsible for managing model definitions. It provides functionalities to create, update, delete,
 // retrieve, and list models. It also supports field validation and generating SQL migration scripts based on a model's
 // definition. The manager uses a map to store the models, where the key is the model's name and the value is a pointer
-// to a ModelDefinition struct. The manager can save and load models from a JSON file.
+// to a ModelDefinition struct. The manager saves its models to ModelsFile on its file system after every change, and
+// loads them from it.
 type ModelManager struct {
 	models map[string]*ModelDefinition
+	fsys   filesystem.FS
 }
 
-// NewModelManager returns a new instance of ModelManager. It initializes the models map and loads the models from storage.
+// NewModelManager returns a new instance of ModelManager. It initializes the models map and loads the models from storage
+// in the current working directory.
 func NewModelManager() *ModelManager {
+	return NewModelManagerFS(filesystem.NewOSFS(""))
+}
+
+// NewModelManagerFS returns a new instance of ModelManager that stores its models on the given file system.
+// Passing filesystem.NewMemFS() gives a manager that never touches the disk, which is useful in tests.
+func NewModelManagerFS(fsys filesystem.FS) *ModelManager {
 	mm := &ModelManager{
 		models: make(map[string]*ModelDefinition),
+		fsys:   fsys,
 	}
 	mm.loadModels()
 	return mm
@@ -207,34 +269,38 @@ func (mm *ModelManager) CreateModel(name string, fields []Field) error {
 		return fmt.Errorf("model %s already exists", name)
 	}
 
-	mm.models[name] = NewModelDefinition(name, fields)
+	modelDef := NewModelDefinition(name, fields)
+	modelDef.Options.Table = DefaultNamingStrategy.TableName(name)
+	mm.models[name] = modelDef
 	return mm.saveModels()
 }
 
 // UpdateModel updates the fields of an existing model. It first checks if the model exists in the model manager's
 // models map. If the model does not exist, an error is returned. Otherwise, the model's fields are updated with the
-// provided fields.
+// provided fields, and the models are saved to the storage file. Model-level options are preserved.
 func (mm *ModelManager) UpdateModel(name string, fields []Field) error {
-	if _, exists := mm.models[name]; !exists {
+	existing, exists := mm.models[name]
+	if !exists {
 		return fmt.Errorf("model %s does not exist", name)
 	}
 
-	mm.models[name] = NewModelDefinition(name, fields)
-	return nil
+	updated := NewModelDefinition(name, fields)
+	updated.Options = existing.Options
+	mm.models[name] = updated
+	return mm.saveModels()
 }
 
 // DeleteModel deletes a model from the ModelManager's models collection.
 // It takes the name of the model to be deleted as a parameter.
 // If the model does not exist in the collection, it returns an error.
-// Otherwise, the model is deleted from the collection.
-// It returns nil if the deletion is successful.
+// Otherwise, the model is deleted from the collection, and the models are saved to the storage file.
 func (mm *ModelManager) DeleteModel(name string) error {
 	if _, exists := mm.models[name]; !exists {
 		return fmt.Errorf("model %s does not exist", name)
 	}
 
 	delete(mm.models, name)
-	return nil
+	return mm.saveModels()
 }
 
 // GetModel retrieves a model definition by name from the ModelManager. It returns the model definition
@@ -258,44 +324,111 @@ func (mm *ModelManager) ListModels() []string {
 	return modelNames
 }
 
-// ValidateField validates the type of a field.
-// It checks if the field type is one of the valid types: string, int, bool, time.Time, float64, []byte.
-// If the field type is not valid, it returns an error indicating the invalid field type.
+// ValidateField validates the type of a field, see ValidateFieldType.
 func (mm *ModelManager) ValidateField(field Field) error {
-	validTypes := map[string]bool{
-		"string": true, "int": true, "bool": true, "time.Time": true,
-		"float64": true, "[]byte": true,
-	}
-
-	if !validTypes[field.Type] {
-		return fmt.Errorf("invalid field type: %s", field.Type)
-	}
-
-	return nil
+	return ValidateFieldType(field.Type)
 }
 
 // GenerateMigration generates a SQL migration statement for creating a table based on a given ModelDefinition.
-// The generated migration includes the table name, field names, data types, and any additional constraints (e.g., primary key, not null).
+// The table and its columns match what the generated repository reads and writes: the table is named like the
+// generated TableName method, and the id, created_at, and updated_at columns backing DefaultModel come first.
+// Own fields that collide with those columns are represented by them, and other fields marked primary become
+// unique since id is the primary key. Pointer fields and fields marked nullable may be NULL; slices other than
+// []byte become PostgreSQL arrays, encrypted fields TEXT, and vector fields pgvector columns, whose extension
+// is created first. Indexes on indexed fields (HNSW indexes for vector fields), the unique index of the
+// upsert keys and the model's row-level security policies are created after the table, see UpsertColumns and
+// GeneratePolicies.
 // The resulting migration statement is returned as a string.
 func (mm *ModelManager) GenerateMigration(model *ModelDefinition) string {
-	var migration strings.Builder
-
-	migration.WriteString(fmt.Sprintf("CREATE TABLE %s (\n", strings.ToLower(model.Name)))
-
-	for _, field := range model.Fields {
-		migration.WriteString(fmt.Sprintf("  %s %s", strings.ToLower(field.Name), getSQLType(field.Type)))
-		if field.IsPrimary {
-			migration.WriteString(" PRIMARY KEY")
+	columns := []string{
+		"  id SERIAL PRIMARY KEY",
+		"  created_at TIMESTAMP NOT NULL",
+		"  updated_at TIMESTAMP NOT NULL",
+	}
+	for _, c := range modelColumns(model) {
+		if c.Field == nil {
+			continue
 		}
-		if !field.IsNull {
-			migration.WriteString(" NOT NULL")
+		column := fmt.Sprintf("  %s %s", c.Name, columnSQLType(c.Field))
+		if c.Field.IsPrimary {
+			column += " UNIQUE"
 		}
-		migration.WriteString(",\n")
+		if !c.Field.IsNull && !strings.HasPrefix(c.GoType, "*") {
+			column += " NOT NULL"
+		}
+		if c.Field.Default != "" {
+			column += " DEFAULT " + sqlDefault(c.Field)
+		}
+		if values, ok := EnumValues(c.Field.Type); ok {
+			column += " " + enumCheck(c.Name, values)
+		}
+		columns = append(columns, column)
 	}
 
-	migration.WriteString(");\n")
+	migration := fmt.Sprintf("CREATE TABLE %s (\n%s\n);\n", TableName(model), strings.Join(columns, ",\n"))
+	if hasVectorFields(model) {
+		migration = "CREATE EXTENSION IF NOT EXISTS vector;\n" + migration
+	}
+	for _, c := range modelColumns(model) {
+		switch {
+		case c.Field == nil || !c.Field.Indexed:
+		case c.GoType == vectorGoType:
+			migration += vectorIndex(TableName(model), c.Name, c.Field)
+		default:
+			migration += fmt.Sprintf("CREATE INDEX %s_%s_idx ON %s (%s);\n", TableName(model), c.Name, TableName(model), c.Name)
+		}
+	}
+	return migration + UpsertIndexMigration(model) + GeneratePolicies(model)
+}
 
-	return migration.String()
+// columnSQLType returns the SQL type of the column storing a field: TEXT for encrypted fields, the pgvector type
+// for vector fields, and the type mapped from the field type otherwise, see getSQLType.
+func columnSQLType(field *Field) string {
+	if field.Encrypted {
+		return "TEXT"
+	}
+	if _, ok := VectorDimensions(field.Type); ok {
+		return field.Type
+	}
+	return getSQLType(field.Type)
+}
+
+// sqlDefault returns the SQL expression of a field's default: a quoted literal for strings and enums,
+// CURRENT_TIMESTAMP for "now", and the value as is otherwise.
+func sqlDefault(field *Field) string {
+	_, enum := EnumValues(field.Type)
+	switch {
+	case field.Default == "now":
+		return "CURRENT_TIMESTAMP"
+	case enum, strings.TrimPrefix(field.Type, "*") == "string":
+		return "'" + strings.ReplaceAll(field.Default, "'", "''") + "'"
+	default:
+		return field.Default
+	}
+}
+
+// SQLDefault returns the SQL expression of the default of a field that has one, as used by its migration.
+func SQLDefault(field *Field) string {
+	return sqlDefault(field)
+}
+
+// goDefault returns the Go expression a field of the named model is initialized with by the generated
+// constructor, or "" if it has no default or is a pointer field, which the repository leaves for the database
+// to default when it is nil.
+func goDefault(modelName string, field Field) string {
+	_, enum := EnumValues(field.Type)
+	switch {
+	case field.Default == "" || strings.HasPrefix(field.Type, "*"):
+		return ""
+	case enum:
+		return enumTypeName(modelName, field) + enumConstSuffix(field.Default)
+	case field.Default == "now":
+		return "time.Now()"
+	case field.Type == "string":
+		return strconv.Quote(field.Default)
+	default:
+		return field.Default
+	}
 }
 
 // getSQLType returns the SQL data type corresponding to a given Go type. It maps the following Go types to their SQL equivalents:
@@ -305,8 +438,25 @@ func (mm *ModelManager) GenerateMigration(model *ModelDefinition) string {
 // - time.Time: TIMESTAMP
 // - float64: DOUBLE PRECISION
 // - []byte: BYTEA
+// - json.RawMessage: JSONB
+// Pointers map to the type they point to, and other slices to an array of their element type. Registered
+// custom types map to their SQL type, see RegisterType.
 // If the given Go type does not match any of the above, it returns "VARCHAR(255)" as the default SQL type.
 func getSQLType(goType string) string {
+	switch {
+	case goType == "[]byte":
+		return "BYTEA"
+	case goType == "json.RawMessage":
+		return "JSONB"
+	case strings.HasPrefix(goType, "*"):
+		return getSQLType(goType[1:])
+	case strings.HasPrefix(goType, "[]"):
+		return getSQLType(goType[2:]) + "[]"
+	}
+	if t, ok := customTypes[goType]; ok {
+		return t.SQLType
+	}
+
 	switch goType {
 	case "string":
 		return "VARCHAR(255)"
@@ -318,61 +468,305 @@ func getSQLType(goType string) string {
 		return "TIMESTAMP"
 	case "float64":
 		return "DOUBLE PRECISION"
-	case "[]byte":
-		return "BYTEA"
 	default:
 		return "VARCHAR(255)"
 	}
 }
 
-// modelStorageFile is the file name of the JSON file used to store the models.
-const modelStorageFile = "models.json"
+// ModelsFile is the location, relative to the project root, of the file the model definitions are kept in, so
+// that they survive between runs and can be committed with the code generated from them.
+const ModelsFile = ".grav/models.json"
 
-// saveModels saves the models in the ModelManager to a JSON file.
-// It marshals the models into JSON format and writes the data to the
-// specified modelStorageFile. The file is created with read and write
-// permissions for the owner and readable by others. If there is an
-// error during the process, it is returned as an error.
-//
-// This method is called by CreateModel after adding a new model, UpdateModel
-// after updating a model, and DeleteModel after deleting a model.
-//
-// Example usage:
-//
-//	mm := &ModelManager{}
-//	// ... code to populate mm.models ...
-//	err := mm.saveModels()
-//	if err != nil {
-//	  fmt.Println("Failed to save models:", err)
-//	}
-//
-// Note: This method is not intended to be called directly by users of
-// this package.
-func (mm *ModelManager) saveModels() error {
-	data, err := json.Marshal(mm.models)
+// legacyModelsFile is where the models were stored before ModelsFile; it is read when ModelsFile does not exist.
+const legacyModelsFile = "models.json"
+
+// SaveModels writes the given definitions to ModelsFile on the given file system, in the format read by
+// DecodeModels, see EncodeModels. The file is left alone when it already holds them, so that tools watching
+// it only see actual changes.
+func SaveModels(fsys filesystem.FS, defs []*ModelDefinition) error {
+	data, err := EncodeModels(defs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal models: %w", err)
+	}
+	if current, err := fsys.ReadFile(ModelsFile); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	if err := fsys.MkdirAll(path.Dir(ModelsFile), 0755); err != nil {
+		return fmt.Errorf("failed to create models directory: %w", err)
+	}
+	return fsys.WriteFile(ModelsFile, data, 0644)
+}
+
+// LoadModels reads the definitions of ModelsFile on the given file system, or of the models.json file they
+// were kept in before when it does not exist, sorted by name. Without either file, there are no definitions.
+func LoadModels(fsys filesystem.FS) ([]*ModelDefinition, error) {
+	data, err := fsys.ReadFile(ModelsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = fsys.ReadFile(legacyModelsFile)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return DecodeModels(data)
+}
+
+// saveModels saves the models of the ModelManager to ModelsFile, see SaveModels. It is called by CreateModel,
+// UpdateModel and DeleteModel.
+func (mm *ModelManager) saveModels() error {
+	defs := make([]*ModelDefinition, 0, len(mm.models))
+	for _, name := range mm.ListModels() {
+		defs = append(defs, mm.models[name])
 	}
-	return os.WriteFile(modelStorageFile, data, 0644)
+	return SaveModels(mm.fsys, defs)
 }
 
-// loadModels reads the content of the models file, if it exists, and
-// unmarshals the data into the ModelManager's models map. If the file
-// does not exist, it logs a message and returns. If there is an error
-// while reading or unmarshaling the data, it logs an error message.
+// loadModels reads the models of the ModelManager from its file system, see LoadModels, logging the errors.
 func (mm *ModelManager) loadModels() {
-	data, err := os.ReadFile(modelStorageFile)
+	defs, err := LoadModels(mm.fsys)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			logger.WithError(err).Error("Failed to read models file")
-		}
+		logger.WithError(err).Error("Failed to load models")
 		return
 	}
+	for _, def := range defs {
+		mm.models[def.Name] = def
+	}
+}
+
+// EncryptField marks the named field of the model as encrypted. Only string fields without a default can be
+// encrypted, as the column default would be stored unencrypted.
+func (m *ModelDefinition) EncryptField(name string) error {
+	field := m.Field(name)
+	if field == nil {
+		return fmt.Errorf("model %s has no field %s", m.Name, name)
+	}
+	if strings.TrimPrefix(field.Type, "*") != "string" {
+		return fmt.Errorf("field %s of type %s cannot be encrypted: only string fields can", name, field.Type)
+	}
+	if field.Default != "" {
+		return fmt.Errorf("field %s cannot be encrypted: it has a default", name)
+	}
+	field.Encrypted = true
+	return nil
+}
+
+// MarkSensitive marks the named field of the model as holding personal data.
+func (m *ModelDefinition) MarkSensitive(name string) error {
+	field := m.Field(name)
+	if field == nil {
+		return fmt.Errorf("model %s has no field %s", m.Name, name)
+	}
+	field.Sensitive = true
+	return nil
+}
+
+// SetReference records that the named field of the model holds the ID of a record of the referenced model.
+func (m *ModelDefinition) SetReference(name, referenced string) error {
+	field := m.Field(name)
+	if field == nil {
+		return fmt.Errorf("model %s has no field %s", m.Name, name)
+	}
+	switch strings.TrimPrefix(field.Type, "*") {
+	case "int", "int32", "int64", "uint", "uint32", "uint64":
+	default:
+		return fmt.Errorf("field %s of type %s cannot reference %s: IDs are integers", name, field.Type, referenced)
+	}
+	field.References = referenced
+	return nil
+}
+
+// SetDefault sets the default value of the named field of the model, see Field.SetDefault.
+func (m *ModelDefinition) SetDefault(name, value string) error {
+	field := m.Field(name)
+	if field == nil {
+		return fmt.Errorf("model %s has no field %s", m.Name, name)
+	}
+	return field.SetDefault(value)
+}
 
-	err = json.Unmarshal(data, &mm.models)
+// SetDefault sets the default value of the field. The value must be valid for the field's type: any text for
+// strings, one of the values of enums, a number for numeric fields, true or false for booleans, and "now" for
+// time.Time fields, which defaults them to the time the row is inserted. Encrypted fields have no default.
+func (f *Field) SetDefault(value string) error {
+	var err error
+	values, enum := EnumValues(f.Type)
+	switch fieldType := strings.TrimPrefix(f.Type, "*"); {
+	case f.Encrypted:
+		err = errors.New("encrypted fields cannot have a default")
+	case fieldType == "string":
+	case enum:
+		err = validEnumValue(values, value)
+	case fieldType == "bool":
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			value = strconv.FormatBool(b)
+		}
+	case fieldType == "time.Time":
+		if value != "now" {
+			err = errors.New(`time fields only default to "now"`)
+		}
+	case strings.HasPrefix(fieldType, "uint"):
+		_, err = strconv.ParseUint(value, 10, 64)
+	case strings.HasPrefix(fieldType, "int"):
+		_, err = strconv.ParseInt(value, 10, 64)
+	case strings.HasPrefix(fieldType, "float"):
+		_, err = strconv.ParseFloat(value, 64)
+	default:
+		err = fmt.Errorf("fields of type %s cannot have a default", f.Type)
+	}
 	if err != nil {
-		logger.WithError(err).Error("Failed to unmarshal models")
+		return fmt.Errorf("invalid default %q for field %s: %w", value, f.Name, err)
 	}
+	f.Default = value
+	return nil
+}
+
+// IndexField adds an index on the column of the named field of the model.
+func (m *ModelDefinition) IndexField(name string) error {
+	field := m.Field(name)
+	if field == nil {
+		return fmt.Errorf("model %s has no field %s", m.Name, name)
+	}
+	field.Indexed = true
+	return nil
+}
+
+// LockVersionField is the name of the field holding the version of the records of models with optimistic
+// locking.
+const LockVersionField = "version"
+
+// EnableLockVersion enables optimistic locking of the model's records. The version field is added with the
+// default 1 unless the model has one, which must then be a non-nullable int. The generated repository
+// increments it on every update, and fails the update of a record whose version changed since it was read
+// with a StaleObjectError.
+func (m *ModelDefinition) EnableLockVersion() error {
+	if field := m.Field(LockVersionField); field != nil {
+		if field.Type != "int" || field.IsNull {
+			return fmt.Errorf("field %s of model %s must be a non-nullable int to hold the lock version", field.Name, m.Name)
+		}
+	} else {
+		field := NewField(LockVersionField, "int", "", false, false)
+		field.Default = "1"
+		m.Fields = append(m.Fields, field)
+	}
+	m.Options.LockVersion = true
+	return nil
+}
+
+// SetTenantField scopes the model's records to tenants by the named field, which is added as an indexed
+// non-nullable string unless the model has one, which must then be a non-nullable, unencrypted string. The
+// generated repository requires a tenant in the context of every operation, see WithTenantID, stores it in
+// the field of the records it creates, and only reads, updates and deletes the records of that tenant.
+func (m *ModelDefinition) SetTenantField(name string) error {
+	if isBaseColumn(ToSnakeCase(name)) {
+		return fmt.Errorf("field %s of model %s cannot hold the tenant", name, m.Name)
+	}
+	field := m.Field(name)
+	if field == nil {
+		if !tableNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid tenant field name %q: use lowercase letters, digits and underscores", name)
+		}
+		m.Fields = append(m.Fields, NewField(name, "string", "", false, false))
+		field = &m.Fields[len(m.Fields)-1]
+	} else if field.Type != "string" || field.IsNull || field.Encrypted {
+		return fmt.Errorf("field %s of model %s must be a non-nullable, unencrypted string to hold the tenant", field.Name, m.Name)
+	}
+	field.Indexed = true
+	m.Options.TenantField = field.Name
+	return nil
+}
+
+// TenantColumnMigration returns the statements adding the tenant column of a model to its existing table, see
+// SetTenantField. The column is added nullable so the tenant of existing rows can be set before it is made
+// NOT NULL.
+func TenantColumnMigration(m *ModelDefinition) []string {
+	field := m.Field(m.Options.TenantField)
+	if field == nil {
+		return nil
+	}
+	table, column := TableName(m), ColumnName(field)
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, columnSQLType(field)),
+		fmt.Sprintf("UPDATE %s SET %s = '<tenant>' WHERE %s IS NULL;", table, column, column),
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;", table, column),
+		fmt.Sprintf("CREATE INDEX %s_%s_idx ON %s (%s);", table, column, table, column),
+	}
+}
+
+// Actions are the actions on the records of a model that permissions restrict.
+var Actions = []string{"create", "read", "update", "delete"}
+
+// SetPermission restricts an action on the model's records to the users holding one of the given roles, or
+// lifts the restriction when roles is empty. The middleware of the generated authentication enforces it, see
+// RenderAuth.
+func (m *ModelDefinition) SetPermission(action string, roles []string) error {
+	known := false
+	for _, a := range Actions {
+		known = known || a == action
+	}
+	if !known {
+		return fmt.Errorf("invalid action %q: use one of %s", action, strings.Join(Actions, ", "))
+	}
+	for _, role := range roles {
+		if role == "" || strings.ContainsAny(role, ", \t") {
+			return fmt.Errorf("invalid role %q of the %s permission of model %s", role, action, m.Name)
+		}
+	}
+	if len(roles) == 0 {
+		delete(m.Options.Permissions, action)
+		if len(m.Options.Permissions) == 0 {
+			m.Options.Permissions = nil
+		}
+		return nil
+	}
+	if m.Options.Permissions == nil {
+		m.Options.Permissions = make(map[string][]string)
+	}
+	m.Options.Permissions[action] = roles
+	return nil
+}
+
+// SetSearchFields indexes the model's records in the search backend of the app by the given text fields, or
+// stops indexing them when names is empty. Repositories of indexed models keep the index in sync and have a
+// Search method, see RenderSearchFile. Encrypted and sensitive fields cannot be indexed, as the search backend
+// would hold their values in clear.
+func (m *ModelDefinition) SetSearchFields(names []string) error {
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		field := m.Field(name)
+		if field == nil {
+			return fmt.Errorf("model %s has no field %s", m.Name, name)
+		}
+		_, enum := EnumValues(field.Type)
+		switch strings.TrimPrefix(field.Type, "*") {
+		case "string", "[]string":
+		default:
+			if !enum {
+				return fmt.Errorf("field %s of type %s cannot be searched: only text fields can", field.Name, field.Type)
+			}
+		}
+		if field.Encrypted || field.Sensitive {
+			return fmt.Errorf("field %s of model %s holds encrypted or sensitive data and cannot be searched", field.Name, m.Name)
+		}
+		fields = append(fields, field.Name)
+	}
+	m.Options.SearchFields = nil
+	if len(fields) > 0 {
+		m.Options.SearchFields = fields
+	}
+	return nil
+}
+
+// Field returns the field of the model with the given name, matched case-insensitively, or nil.
+func (m *ModelDefinition) Field(name string) *Field {
+	for i := range m.Fields {
+		if strings.EqualFold(m.Fields[i].Name, name) {
+			return &m.Fields[i]
+		}
+	}
+	return nil
 }
 
 // SetOutputDir sets the output directory for the ModelDefinition.
@@ -0,0 +1,399 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelManager_PersistsToFS(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	mm := NewModelManagerFS(fsys)
+
+	fields := []Field{NewField("Name", "string", `json:"name"`, false, false)}
+	assert.NoError(t, mm.CreateModel("User", fields))
+	assert.Error(t, mm.CreateModel("User", fields))
+
+	reloaded := NewModelManagerFS(fsys)
+	assert.Equal(t, []string{"User"}, reloaded.ListModels())
+
+	def, err := reloaded.GetModel("User")
+	assert.NoError(t, err)
+	assert.Equal(t, fields, def.Fields)
+
+	_, err = fsys.ReadFile(ModelsFile)
+	assert.NoError(t, err)
+	updated := append(fields, NewField("Email", "string", `json:"email"`, false, false))
+	assert.NoError(t, reloaded.UpdateModel("User", updated))
+	def, err = NewModelManagerFS(fsys).GetModel("User")
+	assert.NoError(t, err)
+	assert.Equal(t, updated, def.Fields)
+	assert.Equal(t, "users", def.Options.Table)
+
+	assert.NoError(t, reloaded.DeleteModel("User"))
+	assert.Empty(t, NewModelManagerFS(fsys).ListModels())
+}
+
+func TestLoadModels_Legacy(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	defs, err := LoadModels(fsys)
+	assert.NoError(t, err)
+	assert.Empty(t, defs)
+
+	assert.NoError(t, fsys.WriteFile("models.json", []byte(`{"Post": {"Fields": [{"Name": "Title", "Type": "string"}]}}`), 0644))
+	mm := NewModelManagerFS(fsys)
+	assert.Equal(t, []string{"Post"}, mm.ListModels())
+	assert.NoError(t, mm.CreateModel("User", nil))
+	defs, err = LoadModels(fsys)
+	assert.NoError(t, err)
+	assert.Len(t, defs, 2, "the models are moved to ModelsFile")
+}
+
+func TestGenerateModelFileFS(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	def := NewModelDefinition("User", []Field{NewField("name", "string", `json:"name"`, false, false)})
+	def.SetOutputDir("app/models")
+
+	assert.NoError(t, GenerateModelFileFS(fsys, def))
+
+	data, err := fsys.ReadFile("app/models/user.go")
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), "type User struct"))
+	assert.True(t, strings.Contains(string(data), `return "users"`))
+}
+
+func TestGenerateMigration(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{
+		NewField("ID", "int", "", false, true),
+		NewField("Slug", "string", "", false, true),
+		NewField("Views", "int", "", true, false),
+		NewField("Tags", "[]string", "", false, false),
+		NewField("PublishedAt", "*time.Time", "", false, false),
+	})
+
+	assert.Equal(t, `CREATE TABLE posts (
+  id SERIAL PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  slug VARCHAR(255) UNIQUE NOT NULL,
+  views INTEGER,
+  tags VARCHAR(255)[] NOT NULL,
+  publishedat TIMESTAMP
+);
+`, (&ModelManager{}).GenerateMigration(def))
+}
+
+func TestManifest_RecordAndVerify(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	def := NewModelDefinition("User", []Field{NewField("name", "string", `json:"name"`, false, false)})
+	artifact := GoArtifact(def.Name, "")
+
+	files, err := RenderArtifact(artifact, def)
+	assert.NoError(t, err)
+	for _, file := range files {
+		assert.NoError(t, file.Write(fsys))
+	}
+
+	manifest := NewManifest()
+	assert.NoError(t, manifest.Record(artifact, def, files...))
+	assert.NoError(t, manifest.Save(fsys))
+
+	first, err := fsys.ReadFile(ManifestFile)
+	assert.NoError(t, err)
+
+	// Regenerating the same definition must produce a byte-identical manifest.
+	again, err := RenderArtifact(artifact, def)
+	assert.NoError(t, err)
+	regenerated := NewManifest()
+	assert.NoError(t, regenerated.Record(artifact, def, again...))
+	assert.NoError(t, regenerated.Save(fsys))
+	second, err := fsys.ReadFile(ManifestFile)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	loaded, err := LoadManifest(fsys)
+	assert.NoError(t, err)
+	assert.Empty(t, loaded.Verify(fsys))
+	reproduced, err := loaded.Reproduces(artifact.Key(), def)
+	assert.NoError(t, err)
+	assert.True(t, reproduced)
+
+	assert.NoError(t, fsys.WriteFile(files[0].Path, []byte("edited"), 0644))
+	assert.Len(t, loaded.Verify(fsys), 1)
+}
+
+func TestManifest_TracksEveryGenerator(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	def := NewModelDefinition("User", []Field{NewField("name", "string", `json:"name"`, false, false)})
+	AssignProtoNumbers(def)
+
+	manifest := NewManifest()
+	artifacts := []Artifact{
+		GoArtifact(def.Name, "app/internal/models"),
+		TypeScriptArtifact(def.Name, "web/types"),
+		ProtoArtifact(def.Name, "proto", "models", "example.com/app/pb"),
+		GRPCArtifact(def.Name, GRPCOptions{ProtoDir: "api", GoModule: "example.com/app"}),
+		KVArtifact(def.Name, "app/internal/models"),
+	}
+	for _, artifact := range artifacts {
+		files, err := RenderArtifact(artifact, def)
+		assert.NoError(t, err)
+		for _, file := range files {
+			assert.NoError(t, file.Write(fsys))
+		}
+		assert.NoError(t, manifest.Record(artifact, def, files...))
+	}
+
+	assert.Equal(t, []string{"go/User", "grpc/User", "kv/User", "proto/User", "typescript/User"}, manifest.Keys())
+	_, err := fsys.ReadFile("app/internal/models/kvstore.go")
+	assert.NoError(t, err)
+	assert.Empty(t, manifest.Verify(fsys))
+	for _, artifact := range artifacts {
+		assert.True(t, manifest.UpToDate(fsys, artifact, def), artifact.Key())
+		reproduced, err := manifest.Reproduces(artifact.Key(), def)
+		assert.NoError(t, err)
+		assert.True(t, reproduced, artifact.Key())
+	}
+
+	// Generating into a different directory is a different artifact.
+	assert.False(t, manifest.UpToDate(fsys, TypeScriptArtifact(def.Name, "types"), def))
+}
+
+func TestLoadManifest_DiscardsOlderFormat(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	assert.NoError(t, fsys.MkdirAll(".grav", 0755))
+	assert.NoError(t, fsys.WriteFile(ManifestFile, []byte(`{"format_version": 1, "models": {}}`), 0644))
+
+	manifest, err := LoadManifest(fsys)
+	assert.NoError(t, err)
+	assert.Empty(t, manifest.Entries)
+}
+
+func TestManifest_UpToDate(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	def := NewModelDefinition("User", []Field{NewField("name", "string", `json:"name"`, false, false)})
+	artifact := GoArtifact(def.Name, "")
+	manifest := NewManifest()
+	assert.False(t, manifest.UpToDate(fsys, artifact, def))
+
+	files, err := RenderArtifact(artifact, def)
+	assert.NoError(t, err)
+	for _, file := range files {
+		assert.NoError(t, file.Write(fsys))
+	}
+	assert.NoError(t, manifest.Record(artifact, def, files...))
+	assert.True(t, manifest.UpToDate(fsys, artifact, def))
+
+	changed := NewModelDefinition("User", append(def.Fields, NewField("age", "int", `json:"age"`, false, false)))
+	assert.False(t, manifest.UpToDate(fsys, artifact, changed))
+
+	assert.NoError(t, fsys.Remove(files[0].Path))
+	assert.False(t, manifest.UpToDate(fsys, artifact, def))
+}
+
+func TestManifest_ProtoNumbersDoNotInvalidateGoArtifacts(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	def := NewModelDefinition("User", []Field{NewField("name", "string", `json:"name"`, false, false)})
+	goArtifact := GoArtifact(def.Name, "")
+	protoArtifact := ProtoArtifact(def.Name, "", "", "")
+
+	manifest := NewManifest()
+	files, err := RenderArtifact(goArtifact, def)
+	assert.NoError(t, err)
+	for _, file := range files {
+		assert.NoError(t, file.Write(fsys))
+	}
+	assert.NoError(t, manifest.Record(goArtifact, def, files...))
+
+	// Running "model proto" numbers the fields and stores them in the definition.
+	assert.True(t, AssignProtoNumbers(def))
+	ReserveProtoNumber(def, Field{Name: "removed", ProtoNumber: 9})
+	assert.True(t, manifest.UpToDate(fsys, goArtifact, def))
+	reproduced, err := manifest.Reproduces(goArtifact.Key(), def)
+	assert.NoError(t, err)
+	assert.True(t, reproduced)
+
+	protoFiles, err := RenderArtifact(protoArtifact, def)
+	assert.NoError(t, err)
+	for _, file := range protoFiles {
+		assert.NoError(t, file.Write(fsys))
+	}
+	assert.NoError(t, manifest.Record(protoArtifact, def, protoFiles...))
+	def.Fields[0].ProtoNumber = 10
+	assert.False(t, manifest.UpToDate(fsys, protoArtifact, def))
+}
+
+func TestEncryptField(t *testing.T) {
+	def := NewModelDefinition("User", []Field{
+		NewField("SSN", "string", "", false, false),
+		NewField("Age", "int", "", false, false),
+	})
+
+	assert.NoError(t, def.EncryptField("ssn"))
+	assert.True(t, def.Field("SSN").Encrypted)
+	assert.Error(t, def.EncryptField("Age"))
+	assert.Error(t, def.EncryptField("Missing"))
+	assert.Error(t, def.SetDefault("ssn", "unknown"))
+	assert.Contains(t, (&ModelManager{}).GenerateMigration(def), "  ssn TEXT NOT NULL,\n")
+
+	def.Fields = append(def.Fields, NewField("Email", "string", "", false, false))
+	assert.NoError(t, def.SetDefault("email", "none"))
+	assert.Error(t, def.EncryptField("email"))
+}
+
+func TestSetDefaultAndIndexField(t *testing.T) {
+	def := NewModelDefinition("User", []Field{
+		NewField("Name", "string", "", false, false),
+		NewField("Age", "int", "", false, false),
+		NewField("Active", "bool", "", false, false),
+		NewField("JoinedAt", "time.Time", "", false, false),
+		NewField("Avatar", "[]byte", "", true, false),
+	})
+
+	assert.NoError(t, def.SetDefault("name", "o'brien"))
+	assert.NoError(t, def.SetDefault("age", "18"))
+	assert.NoError(t, def.SetDefault("active", "true"))
+	assert.NoError(t, def.SetDefault("joinedat", "now"))
+	assert.Error(t, def.SetDefault("age", "eighteen"))
+	assert.Error(t, def.SetDefault("joinedat", "yesterday"))
+	assert.Error(t, def.SetDefault("avatar", "x"))
+	assert.Error(t, def.SetDefault("missing", "x"))
+	assert.NoError(t, def.IndexField("Name"))
+	assert.Error(t, def.IndexField("missing"))
+
+	migration := (&ModelManager{}).GenerateMigration(def)
+	assert.Contains(t, migration, "  name VARCHAR(255) NOT NULL DEFAULT 'o''brien',\n")
+	assert.Contains(t, migration, "  age INTEGER NOT NULL DEFAULT 18,\n")
+	assert.Contains(t, migration, "  active BOOLEAN NOT NULL DEFAULT true,\n")
+	assert.Contains(t, migration, "  joinedat TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\n")
+	assert.Contains(t, migration, ");\nCREATE INDEX users_name_idx ON users (name);\n")
+}
+
+func TestFieldDefaults_Generated(t *testing.T) {
+	def := NewModelDefinition("Signup", []Field{
+		NewField("CreatedVia", "string", "", false, false),
+		NewField("Attempts", "uint", "", false, false),
+		NewField("Active", "bool", "", false, false),
+		NewField("Plan", "enum(free,pro)", "", false, false),
+		NewField("Referrer", "*string", "", false, false),
+		NewField("ConfirmedAt", "time.Time", "", false, false),
+		NewField("Note", "string", "", false, false),
+	})
+	assert.NoError(t, def.SetDefault("createdvia", "cli"))
+	assert.Error(t, def.SetDefault("attempts", "-1"))
+	assert.NoError(t, def.SetDefault("attempts", "3"))
+	assert.NoError(t, def.SetDefault("active", "T"))
+	assert.Equal(t, "true", def.Field("active").Default)
+	assert.NoError(t, def.SetDefault("plan", "free"))
+	assert.NoError(t, def.SetDefault("referrer", "organic"))
+	assert.NoError(t, def.SetDefault("confirmedat", "now"))
+
+	modelFile, err := RenderModelFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(modelFile.Content), `func NewSignup() *Signup {
+	return &Signup{
+		Createdvia:  "cli",
+		Attempts:    3,
+		Active:      true,
+		Plan:        SignupPlanFree,
+		Confirmedat: time.Now(),
+	}
+}`)
+
+	repository, err := RenderRepositoryFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(repository.Content),
+		`"INSERT INTO signups (created_at, updated_at, createdvia, attempts, active, plan, referrer, confirmedat, note) VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, 'organic'), COALESCE($8, CURRENT_TIMESTAMP), $9) RETURNING id, referrer, confirmedat",`)
+	assert.Contains(t, string(repository.Content), "m.Referrer, nullTime(m.Confirmedat), m.Note,\n\t\t).Scan(&m.ID, &m.Referrer, &m.Confirmedat)")
+
+	plain, err := RenderModelFile(NewModelDefinition("Tag", []Field{NewField("Label", "string", "", false, false)}))
+	assert.NoError(t, err)
+	assert.Contains(t, string(plain.Content), "func NewTag() *Tag {\n\treturn &Tag{}\n}")
+}
+
+func TestEnableLockVersion(t *testing.T) {
+	def := NewModelDefinition("Account", []Field{NewField("Balance", "int", "", false, false)})
+	assert.NoError(t, def.EnableLockVersion())
+	assert.NoError(t, def.EnableLockVersion())
+	assert.True(t, def.Options.LockVersion)
+	assert.Len(t, def.Fields, 2)
+	assert.Equal(t, "1", def.Field("version").Default)
+	assert.Contains(t, (&ModelManager{}).GenerateMigration(def), "  version INTEGER NOT NULL DEFAULT 1\n")
+
+	repository, err := RenderRepositoryFile(def)
+	assert.NoError(t, err)
+	content := string(repository.Content)
+	assert.Contains(t, content, `"UPDATE accounts SET updated_at = $1, balance = $2, version = version + 1 WHERE id = $3 AND version = $4",`)
+	assert.Contains(t, content, "m.UpdatedAt, m.Balance, m.ID, m.Version,\n")
+	assert.Contains(t, content, "requireVersion(ctx, q, result, \"Account\", m.ID, m.Version, \"SELECT EXISTS (SELECT 1 FROM accounts WHERE id = $1)\", m.ID); err != nil {\n\t\t\treturn err\n\t\t}\n\t\tm.Version++\n")
+
+	doc := NewModelDefinition("Doc", []Field{NewField("Version", "string", "", false, false)})
+	assert.Error(t, doc.EnableLockVersion())
+	assert.False(t, doc.Options.LockVersion)
+}
+
+func TestSetTenantField(t *testing.T) {
+	def := NewModelDefinition("Invoice", []Field{NewField("total", "int", "", false, false)})
+	assert.NoError(t, def.EnableLockVersion())
+	assert.NoError(t, def.SetTenantField("tenant_id"))
+	assert.Equal(t, "tenant_id", def.Options.TenantField)
+	assert.True(t, def.Field("tenant_id").Indexed)
+	migration := (&ModelManager{}).GenerateMigration(def)
+	assert.Contains(t, migration, "  tenant_id VARCHAR(255) NOT NULL\n")
+	assert.Contains(t, migration, "CREATE INDEX invoices_tenant_id_idx ON invoices (tenant_id);\n")
+	assert.Equal(t, "ALTER TABLE invoices ADD COLUMN tenant_id VARCHAR(255);", TenantColumnMigration(def)[0])
+
+	repository, err := RenderRepositoryFile(def)
+	assert.NoError(t, err)
+	content := string(repository.Content)
+	assert.Contains(t, content, "\ttenant, err := requireTenant(ctx)\n\tif err != nil {\n\t\treturn err\n\t}\n\tm.Tenant_id = tenant\n")
+	assert.Contains(t, content, `"SELECT "+invoiceColumns+" FROM invoices WHERE id = $1 AND tenant_id = $2", id, tenant))`)
+	assert.Contains(t, content, `"SELECT "+invoiceColumns+" FROM invoices WHERE tenant_id = $1 ORDER BY id", tenant)`)
+	assert.Contains(t, content, `"SELECT count(*) FROM invoices WHERE tenant_id = $1", tenant)`)
+	assert.Contains(t, content, `FROM invoices WHERE id > $1 AND tenant_id = $4 ORDER BY id LIMIT $2 OFFSET $3", after, limit+1, offset, tenant)`)
+	assert.Contains(t, content, `"UPDATE invoices SET updated_at = $1, total = $2, version = version + 1 WHERE id = $3 AND version = $4 AND tenant_id = $5",`)
+	assert.Contains(t, content, `"SELECT EXISTS (SELECT 1 FROM invoices WHERE id = $1 AND tenant_id = $2)", m.ID, tenant)`)
+	assert.Contains(t, content, `"DELETE FROM invoices WHERE id = $1 AND tenant_id = $2", id, tenant)`)
+
+	assert.Error(t, def.SetTenantField("id"))
+	assert.Error(t, def.SetTenantField("total"))
+	assert.Error(t, def.SetTenantField("Tenant-ID"))
+}
+
+func TestSetPermission(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{NewField("title", "string", "", false, false)})
+	assert.NoError(t, def.SetPermission("create", []string{"editor", "admin"}))
+	assert.NoError(t, def.SetPermission("delete", []string{"admin"}))
+	assert.Equal(t, map[string][]string{"create": {"editor", "admin"}, "delete": {"admin"}}, def.Options.Permissions)
+
+	assert.NoError(t, def.SetPermission("create", nil))
+	assert.NoError(t, def.SetPermission("delete", nil))
+	assert.Nil(t, def.Options.Permissions)
+
+	assert.EqualError(t, def.SetPermission("publish", []string{"admin"}), `invalid action "publish": use one of create, read, update, delete`)
+	assert.Error(t, def.SetPermission("read", []string{"a b"}))
+}
+
+func TestSetSearchFields(t *testing.T) {
+	email := NewField("email", "string", "", false, false)
+	email.Sensitive = true
+	def := NewModelDefinition("Post", []Field{
+		NewField("title", "string", "", false, false),
+		NewField("tags", "[]string", "", false, false),
+		NewField("status", "enum(draft,published)", "", false, false),
+		NewField("views", "int", "", false, false),
+		email,
+	})
+	assert.NoError(t, def.SetSearchFields([]string{"Title", "tags", "status"}))
+	assert.Equal(t, []string{"title", "tags", "status"}, def.Options.SearchFields)
+
+	assert.EqualError(t, def.SetSearchFields([]string{"views"}), "field views of type int cannot be searched: only text fields can")
+	assert.Error(t, def.SetSearchFields([]string{"email"}))
+	assert.Error(t, def.SetSearchFields([]string{"body"}))
+	assert.Equal(t, []string{"title", "tags", "status"}, def.Options.SearchFields)
+
+	assert.NoError(t, def.SetSearchFields(nil))
+	assert.Nil(t, def.Options.SearchFields)
+}
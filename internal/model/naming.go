@@ -0,0 +1,134 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NamingStrategy derives the table name of a model from its name. The table name is derived once, when the model
+// is created, and stored in its options, so changing the strategy of a project does not rename existing tables.
+type NamingStrategy string
+
+// Naming strategies, by the name they are configured with.
+const (
+	// NamingSnakePlural pluralizes the last word of the snake_case model name: UserProfile is stored in
+	// user_profiles and Person in people.
+	NamingSnakePlural NamingStrategy = "snake_plural"
+	// NamingSnake uses the snake_case model name as is: UserProfile is stored in user_profile.
+	NamingSnake NamingStrategy = "snake"
+	// NamingLowerPlural appends "s" to the lowercase model name, as table names were chosen before naming
+	// strategies: UserProfile is stored in userprofiles and Person in persons.
+	NamingLowerPlural NamingStrategy = "lower_plural"
+)
+
+// DefaultNamingStrategy is the naming strategy used when none is configured.
+const DefaultNamingStrategy = NamingSnakePlural
+
+// ParseNamingStrategy returns the naming strategy configured with the given name, or DefaultNamingStrategy if
+// the name is empty.
+func ParseNamingStrategy(name string) (NamingStrategy, error) {
+	switch strategy := NamingStrategy(name); strategy {
+	case "":
+		return DefaultNamingStrategy, nil
+	case NamingSnakePlural, NamingSnake, NamingLowerPlural:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown naming strategy %q (expected %s, %s or %s)", name, NamingSnakePlural, NamingSnake, NamingLowerPlural)
+	}
+}
+
+// TableName returns the name of the table of the named model.
+func (s NamingStrategy) TableName(modelName string) string {
+	switch s {
+	case NamingSnake:
+		return ToSnakeCase(modelName)
+	case NamingLowerPlural:
+		return strings.ToLower(modelName) + "s"
+	default:
+		name := ToSnakeCase(modelName)
+		i := strings.LastIndex(name, "_") + 1
+		return name[:i] + Pluralize(name[i:])
+	}
+}
+
+// irregularPlurals are the plurals of lowercase English nouns not formed by the regular rules of Pluralize.
+// Nouns mapped to themselves have no distinct plural.
+var irregularPlurals = map[string]string{
+	"person":      "people",
+	"man":         "men",
+	"woman":       "women",
+	"child":       "children",
+	"foot":        "feet",
+	"tooth":       "teeth",
+	"goose":       "geese",
+	"mouse":       "mice",
+	"ox":          "oxen",
+	"leaf":        "leaves",
+	"life":        "lives",
+	"knife":       "knives",
+	"wife":        "wives",
+	"half":        "halves",
+	"shelf":       "shelves",
+	"wolf":        "wolves",
+	"calf":        "calves",
+	"thief":       "thieves",
+	"criterion":   "criteria",
+	"datum":       "data",
+	"medium":      "media",
+	"index":       "indices",
+	"matrix":      "matrices",
+	"vertex":      "vertices",
+	"quiz":        "quizzes",
+	"sheep":       "sheep",
+	"fish":        "fish",
+	"deer":        "deer",
+	"series":      "series",
+	"species":     "species",
+	"news":        "news",
+	"equipment":   "equipment",
+	"information": "information",
+	"metadata":    "metadata",
+	"data":        "data",
+	"feedback":    "feedback",
+}
+
+// pluralSuffixes are the regular rules of Pluralize: a word ending with the pattern has the replacement
+// substituted for its ending. The first matching rule applies; other words take an "s".
+var pluralSuffixes = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`([^aeiou])y$`), "${1}ies"},
+	{regexp.MustCompile(`([^aeiou])is$`), "${1}es"},
+	{regexp.MustCompile(`(s|x|z|ch|sh)$`), "${1}es"},
+}
+
+// Pluralize returns the plural of a lowercase English noun: category becomes categories, address addresses,
+// analysis analyses and person people.
+func Pluralize(word string) string {
+	if word == "" {
+		return word
+	}
+	if plural, ok := irregularPlurals[word]; ok {
+		return plural
+	}
+	for _, suffix := range pluralSuffixes {
+		if suffix.pattern.MatchString(word) {
+			return suffix.pattern.ReplaceAllString(word, suffix.replacement)
+		}
+	}
+	return word + "s"
+}
+
+// tableNamePattern matches the table names SetTable accepts: unquoted lowercase SQL identifiers.
+var tableNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// SetTable sets the name of the model's table, overriding the name chosen by the naming strategy.
+func (m *ModelDefinition) SetTable(name string) error {
+	if !tableNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid table name %q: use lowercase letters, digits and underscores", name)
+	}
+	m.Options.Table = name
+	return nil
+}
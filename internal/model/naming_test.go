@@ -0,0 +1,65 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamingStrategies(t *testing.T) {
+	for _, tc := range []struct {
+		model                     string
+		snakePlural, snake, lower string
+	}{
+		{"User", "users", "user", "users"},
+		{"UserProfile", "user_profiles", "user_profile", "userprofiles"},
+		{"Person", "people", "person", "persons"},
+		{"SalesPerson", "sales_people", "sales_person", "salespersons"},
+		{"Category", "categories", "category", "categorys"},
+		{"Address", "addresses", "address", "addresss"},
+		{"Analysis", "analyses", "analysis", "analysiss"},
+		{"Day", "days", "day", "days"},
+		{"HTTPRequest", "http_requests", "http_request", "httprequests"},
+		{"OAuth2Token", "o_auth2_tokens", "o_auth2_token", "oauth2tokens"},
+		{"Order_item", "order_items", "order_item", "order_items"},
+		{"Sheep", "sheep", "sheep", "sheeps"},
+	} {
+		assert.Equal(t, tc.snakePlural, NamingSnakePlural.TableName(tc.model), tc.model)
+		assert.Equal(t, tc.snake, NamingSnake.TableName(tc.model), tc.model)
+		assert.Equal(t, tc.lower, NamingLowerPlural.TableName(tc.model), tc.model)
+	}
+}
+
+func TestParseNamingStrategy(t *testing.T) {
+	strategy, err := ParseNamingStrategy("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultNamingStrategy, strategy)
+
+	strategy, err = ParseNamingStrategy("snake")
+	assert.NoError(t, err)
+	assert.Equal(t, NamingSnake, strategy)
+
+	_, err = ParseNamingStrategy("camel")
+	assert.Error(t, err)
+}
+
+func TestTableName(t *testing.T) {
+	def := NewModelDefinition("UserProfile", []Field{NewField("Bio", "string", `json:"bio"`, false, false)})
+	assert.Equal(t, "userprofiles", TableName(def), "models without a recorded table keep the earlier naming")
+
+	assert.Error(t, def.SetTable("User Profiles"))
+	assert.NoError(t, def.SetTable("profiles"))
+	assert.Equal(t, "profiles", TableName(def))
+	assert.Contains(t, (&ModelManager{}).GenerateMigration(def), "CREATE TABLE profiles (")
+
+	file, err := RenderModelFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(file.Content), `return "profiles"`)
+	repository, err := RenderRepositoryFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(repository.Content), "INSERT INTO profiles")
+
+	renamed := *def
+	renamed.Options.Table = "user_profiles"
+	assert.Equal(t, []string{"~ table: profiles -> user_profiles"}, DiffDefinitions(def, &renamed))
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of row-level security policies a model can declare.
+const (
+	// PolicyTenant restricts rows to the tenant set for the session.
+	PolicyTenant = "tenant"
+	// PolicyOwner restricts rows to the user set for the session.
+	PolicyOwner = "owner"
+)
+
+// policyDefaults holds the default session setting and policy name suffix of every policy kind.
+var policyDefaults = map[string]struct {
+	Setting string
+	Suffix  string
+}{
+	PolicyTenant: {Setting: "app.tenant_id", Suffix: "tenant_isolation"},
+	PolicyOwner:  {Setting: "app.user_id", Suffix: "owner_only"},
+}
+
+// Policy is a Postgres row-level security policy on a model's table. Rows are visible and writable only when
+// Column equals the value of the session setting Setting, which the generated repositories set from the
+// request context.
+type Policy struct {
+	Name    string
+	Kind    string
+	Column  string
+	Setting string
+}
+
+// NewPolicy creates a policy of the given kind on a column of the model, using the default setting and name
+// of that kind when setting is empty.
+func NewPolicy(modelDef *ModelDefinition, kind, column, setting string) (Policy, error) {
+	defaults, ok := policyDefaults[kind]
+	if !ok {
+		return Policy{}, fmt.Errorf("unknown policy kind %q (expected %q or %q)", kind, PolicyTenant, PolicyOwner)
+	}
+	if !hasColumn(modelDef, column) {
+		return Policy{}, fmt.Errorf("model %s has no column %s", modelDef.Name, column)
+	}
+	if setting == "" {
+		setting = defaults.Setting
+	}
+	if !validSetting(setting) {
+		return Policy{}, fmt.Errorf("invalid session setting %q (expected a dotted name such as %q)", setting, defaults.Setting)
+	}
+	return Policy{
+		Name:    TableName(modelDef) + "_" + defaults.Suffix,
+		Kind:    kind,
+		Column:  column,
+		Setting: setting,
+	}, nil
+}
+
+// AddPolicy adds the policy to the model, replacing a policy with the same name.
+func AddPolicy(modelDef *ModelDefinition, policy Policy) {
+	for i, existing := range modelDef.Options.Policies {
+		if existing.Name == policy.Name {
+			modelDef.Options.Policies[i] = policy
+			return
+		}
+	}
+	modelDef.Options.Policies = append(modelDef.Options.Policies, policy)
+}
+
+// RemovePolicy removes the named policy from the model. It reports whether the policy existed.
+func RemovePolicy(modelDef *ModelDefinition, name string) bool {
+	for i, existing := range modelDef.Options.Policies {
+		if existing.Name == name {
+			modelDef.Options.Policies = append(modelDef.Options.Policies[:i], modelDef.Options.Policies[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// sessionSettings returns the session settings the model's policies read, in declaration order and without
+// duplicates.
+func sessionSettings(modelDef *ModelDefinition) []string {
+	var settings []string
+	for _, policy := range modelDef.Options.Policies {
+		if !containsString(settings, policy.Setting) {
+			settings = append(settings, policy.Setting)
+		}
+	}
+	return settings
+}
+
+// GeneratePolicies returns the SQL enabling row-level security on the model's table and creating its policies,
+// or an empty string when the model declares none. Every policy is restrictive, so a row must satisfy all of
+// them; a permissive policy allowing every row is created alongside because Postgres denies all access unless
+// at least one permissive policy passes. Row-level security is forced so it also applies to the table owner.
+func GeneratePolicies(modelDef *ModelDefinition) string {
+	if len(modelDef.Options.Policies) == 0 {
+		return ""
+	}
+
+	table := TableName(modelDef)
+	var b strings.Builder
+	fmt.Fprintf(&b, "ALTER TABLE %s ENABLE ROW LEVEL SECURITY;\n", table)
+	fmt.Fprintf(&b, "ALTER TABLE %s FORCE ROW LEVEL SECURITY;\n", table)
+	fmt.Fprintf(&b, "CREATE POLICY %s_rls_base ON %s USING (true) WITH CHECK (true);\n", table, table)
+	for _, policy := range modelDef.Options.Policies {
+		condition := fmt.Sprintf("%s::text = current_setting('%s', true)", policy.Column, policy.Setting)
+		fmt.Fprintf(&b, "CREATE POLICY %s ON %s AS RESTRICTIVE\n  USING (%s)\n  WITH CHECK (%s);\n",
+			policy.Name, table, condition, condition)
+	}
+	return b.String()
+}
+
+// hasColumn reports whether the model's table has the named column.
+func hasColumn(modelDef *ModelDefinition, name string) bool {
+	for _, c := range modelColumns(modelDef) {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validSetting reports whether name is a custom Postgres setting: two or more identifiers joined by dots.
+func validSetting(name string) bool {
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+		for _, r := range part {
+			if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPolicyTestModel() *ModelDefinition {
+	return NewModelDefinition("Post", []Field{
+		NewField("TenantID", "string", "", false, false),
+		NewField("AuthorID", "int", "", false, false),
+	})
+}
+
+func TestNewPolicy(t *testing.T) {
+	def := newPolicyTestModel()
+
+	policy, err := NewPolicy(def, PolicyTenant, "tenantid", "")
+	assert.NoError(t, err)
+	assert.Equal(t, Policy{Name: "posts_tenant_isolation", Kind: PolicyTenant, Column: "tenantid", Setting: "app.tenant_id"}, policy)
+
+	policy, err = NewPolicy(def, PolicyOwner, "authorid", "auth.uid")
+	assert.NoError(t, err)
+	assert.Equal(t, "posts_owner_only", policy.Name)
+	assert.Equal(t, "auth.uid", policy.Setting)
+
+	_, err = NewPolicy(def, "public", "tenantid", "")
+	assert.Error(t, err)
+	_, err = NewPolicy(def, PolicyTenant, "missing", "")
+	assert.Error(t, err)
+	_, err = NewPolicy(def, PolicyTenant, "tenantid", "tenant'; DROP TABLE posts; --")
+	assert.Error(t, err)
+}
+
+func TestAddAndRemovePolicy(t *testing.T) {
+	def := newPolicyTestModel()
+	AddPolicy(def, Policy{Name: "posts_tenant_isolation", Kind: PolicyTenant, Column: "tenantid", Setting: "app.tenant_id"})
+	AddPolicy(def, Policy{Name: "posts_tenant_isolation", Kind: PolicyTenant, Column: "tenantid", Setting: "app.org_id"})
+	assert.Len(t, def.Options.Policies, 1)
+	assert.Equal(t, "app.org_id", def.Options.Policies[0].Setting)
+
+	assert.True(t, RemovePolicy(def, "posts_tenant_isolation"))
+	assert.False(t, RemovePolicy(def, "posts_tenant_isolation"))
+	assert.Empty(t, def.Options.Policies)
+}
+
+func TestGeneratePolicies(t *testing.T) {
+	def := newPolicyTestModel()
+	assert.Equal(t, "", GeneratePolicies(def))
+
+	for _, p := range []struct{ kind, column string }{{PolicyTenant, "tenantid"}, {PolicyOwner, "authorid"}} {
+		policy, err := NewPolicy(def, p.kind, p.column, "")
+		assert.NoError(t, err)
+		AddPolicy(def, policy)
+	}
+
+	migration := (&ModelManager{}).GenerateMigration(def)
+	assert.True(t, strings.HasSuffix(migration, `ALTER TABLE posts ENABLE ROW LEVEL SECURITY;
+ALTER TABLE posts FORCE ROW LEVEL SECURITY;
+CREATE POLICY posts_rls_base ON posts USING (true) WITH CHECK (true);
+CREATE POLICY posts_tenant_isolation ON posts AS RESTRICTIVE
+  USING (tenantid::text = current_setting('app.tenant_id', true))
+  WITH CHECK (tenantid::text = current_setting('app.tenant_id', true));
+CREATE POLICY posts_owner_only ON posts AS RESTRICTIVE
+  USING (authorid::text = current_setting('app.user_id', true))
+  WITH CHECK (authorid::text = current_setting('app.user_id', true));
+`), migration)
+}
+
+func TestRenderRepositoryFile_SessionSettings(t *testing.T) {
+	def := newPolicyTestModel()
+	file, err := RenderRepositoryFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(file.Content), "var postSessionSettings []string")
+
+	AddPolicy(def, Policy{Name: "posts_tenant_isolation", Kind: PolicyTenant, Column: "tenantid", Setting: "app.tenant_id"})
+	AddPolicy(def, Policy{Name: "posts_owner_only", Kind: PolicyOwner, Column: "authorid", Setting: "app.user_id"})
+	file, err = RenderRepositoryFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(file.Content), `var postSessionSettings = []string{"app.tenant_id", "app.user_id"}`)
+	assert.Contains(t, string(file.Content), "withSession(ctx, r.db, \"posts\", postSessionSettings, func(q querier) error {")
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// baseProtoFields are the fields contributed by the embedded model.DefaultModel of every generated model.
+// They always occupy the first field numbers of a message.
+var baseProtoFields = []struct {
+	Name string
+	Type string
+}{
+	{"id", "uint64"},
+	{"created_at", "google.protobuf.Timestamp"},
+	{"updated_at", "google.protobuf.Timestamp"},
+}
+
+// firstProtoFieldNumber is the first field number handed out to a model's own fields.
+const firstProtoFieldNumber = 4
+
+// AssignProtoNumbers gives every field without a protobuf field number the next free number, never reusing a
+// number held by another field or reserved after a field was removed. It reports whether any number was
+// assigned, in which case the definition should be persisted so numbering is preserved across runs.
+func AssignProtoNumbers(modelDef *ModelDefinition) bool {
+	next := firstProtoFieldNumber
+	for _, field := range modelDef.Fields {
+		if field.ProtoNumber >= next {
+			next = field.ProtoNumber + 1
+		}
+	}
+	for _, number := range modelDef.Options.ProtoReserved {
+		if number >= next {
+			next = number + 1
+		}
+	}
+
+	changed := false
+	for i := range modelDef.Fields {
+		if modelDef.Fields[i].ProtoNumber == 0 {
+			modelDef.Fields[i].ProtoNumber = next
+			next++
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ReserveProtoNumber records the protobuf field number of a field that is being removed from the model so that
+// it is emitted as reserved and never handed out again.
+func ReserveProtoNumber(modelDef *ModelDefinition, field Field) {
+	if field.ProtoNumber == 0 {
+		return
+	}
+	for _, number := range modelDef.Options.ProtoReserved {
+		if number == field.ProtoNumber {
+			return
+		}
+	}
+	modelDef.Options.ProtoReserved = append(modelDef.Options.ProtoReserved, field.ProtoNumber)
+	sort.Ints(modelDef.Options.ProtoReserved)
+}
+
+// RenderProto renders a proto3 file containing a message for the given model definition. Every field must have
+// been numbered with AssignProtoNumbers first. The file is written to outputDir, or to "proto" when outputDir is
+// empty. goPackage sets the go_package option when it is not empty.
+func RenderProto(modelDef *ModelDefinition, outputDir, protoPackage, goPackage string) (*GeneratedFile, error) {
+	if protoPackage == "" {
+		protoPackage = "models"
+	}
+
+	var body strings.Builder
+	needsTimestamp := false
+	for i, base := range baseProtoFields {
+		if base.Type == "google.protobuf.Timestamp" {
+			needsTimestamp = true
+		}
+		fmt.Fprintf(&body, "    %s %s = %d;\n", base.Type, base.Name, i+1)
+	}
+
+	for _, field := range ownFields(modelDef) {
+		if field.ProtoNumber == 0 {
+			return nil, fmt.Errorf("field %s of model %s has no protobuf field number", field.Name, modelDef.Name)
+		}
+		protoType, err := protoFieldType(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of model %s: %w", field.Name, modelDef.Name, err)
+		}
+		if strings.Contains(protoType, "google.protobuf.Timestamp") {
+			needsTimestamp = true
+		}
+		fmt.Fprintf(&body, "    %s %s = %d;\n", protoType, ToSnakeCase(field.Name), field.ProtoNumber)
+	}
+
+	if len(modelDef.Options.ProtoReserved) > 0 {
+		reserved := make([]string, len(modelDef.Options.ProtoReserved))
+		for i, number := range modelDef.Options.ProtoReserved {
+			reserved[i] = fmt.Sprintf("%d", number)
+		}
+		fmt.Fprintf(&body, "    reserved %s;\n", strings.Join(reserved, ", "))
+	}
+
+	var b strings.Builder
+	b.WriteString("// Code generated by grayv-lsm. DO NOT EDIT.\n\n")
+	b.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&b, "package %s;\n\n", protoPackage)
+	if needsTimestamp {
+		b.WriteString("import \"google/protobuf/timestamp.proto\";\n\n")
+	}
+	if goPackage != "" {
+		fmt.Fprintf(&b, "option go_package = %q;\n\n", goPackage)
+	}
+	fmt.Fprintf(&b, "message %s {\n%s}\n", modelDef.Name, body.String())
+
+	if outputDir == "" {
+		outputDir = "proto"
+	}
+	return &GeneratedFile{
+		Path:    path.Join(filepath.ToSlash(outputDir), strings.ToLower(modelDef.Name)+".proto"),
+		Content: []byte(b.String()),
+	}, nil
+}
+
+// protoFieldType maps a field's Go type to a proto3 field type, including the optional/repeated label.
+func protoFieldType(field Field) (string, error) {
+	goType := field.Type
+	if _, ok := VectorDimensions(goType); ok {
+		goType = "[]float32"
+	}
+	if isEnumField(&field) {
+		goType = "string"
+	}
+	optional := field.IsNull
+	if strings.HasPrefix(goType, "*") {
+		goType = goType[1:]
+		optional = true
+	}
+
+	if goType != "[]byte" && strings.HasPrefix(goType, "[]") {
+		elem, err := protoScalarType(goType[2:])
+		if err != nil {
+			return "", err
+		}
+		return "repeated " + elem, nil
+	}
+
+	if strings.HasPrefix(goType, "map[string]") {
+		elem, err := protoScalarType(goType[len("map[string]"):])
+		if err != nil {
+			return "", err
+		}
+		return "map<string, " + elem + ">", nil
+	}
+
+	scalar, err := protoScalarType(goType)
+	if err != nil {
+		return "", err
+	}
+	if optional {
+		return "optional " + scalar, nil
+	}
+	return scalar, nil
+}
+
+// protoScalarType maps a non-composite Go type to its proto3 equivalent.
+func protoScalarType(goType string) (string, error) {
+	switch goType {
+	case "string":
+		return "string", nil
+	case "bool":
+		return "bool", nil
+	case "int", "int64":
+		return "int64", nil
+	case "int8", "int16", "int32":
+		return "int32", nil
+	case "uint", "uint64":
+		return "uint64", nil
+	case "uint8", "uint16", "uint32":
+		return "uint32", nil
+	case "float32":
+		return "float", nil
+	case "float64":
+		return "double", nil
+	case "[]byte":
+		return "bytes", nil
+	case "time.Time":
+		return "google.protobuf.Timestamp", nil
+	default:
+		return "", fmt.Errorf("unsupported type %s for protobuf generation", goType)
+	}
+}
+
+// ToSnakeCase converts a Go identifier such as "AuthorID" or "createdAt" to snake_case ("author_id",
+// "created_at"). Runs of capitals are treated as a single word.
+func ToSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' {
+				prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+					b.WriteRune('_')
+				}
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
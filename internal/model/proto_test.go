@@ -0,0 +1,49 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignProtoNumbers_PreservedAcrossRuns(t *testing.T) {
+	def := NewModelDefinition("User", []Field{
+		NewField("Name", "string", `json:"name"`, false, false),
+		NewField("Email", "string", `json:"email"`, false, false),
+	})
+
+	assert.True(t, AssignProtoNumbers(def))
+	assert.Equal(t, 4, def.Fields[0].ProtoNumber)
+	assert.Equal(t, 5, def.Fields[1].ProtoNumber)
+	assert.False(t, AssignProtoNumbers(def))
+
+	// Removing a field reserves its number; new fields never reuse it.
+	ReserveProtoNumber(def, def.Fields[1])
+	def.Fields = def.Fields[:1]
+	def.Fields = append(def.Fields, NewField("LastLoginAt", "*time.Time", "", false, false))
+	assert.True(t, AssignProtoNumbers(def))
+	assert.Equal(t, 6, def.Fields[1].ProtoNumber)
+
+	file, err := RenderProto(def, "", "", "example.com/app/pb")
+	assert.NoError(t, err)
+	content := string(file.Content)
+	assert.Equal(t, "proto/user.proto", file.Path)
+	assert.True(t, strings.Contains(content, "string name = 4;"))
+	assert.True(t, strings.Contains(content, "optional google.protobuf.Timestamp last_login_at = 6;"))
+	assert.True(t, strings.Contains(content, "reserved 5;"))
+	assert.True(t, strings.Contains(content, `import "google/protobuf/timestamp.proto";`))
+}
+
+func TestToSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"Name":        "name",
+		"AuthorID":    "author_id",
+		"createdAt":   "created_at",
+		"HTTPStatus":  "http_status",
+		"already_set": "already_set",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, ToSnakeCase(in), in)
+	}
+}
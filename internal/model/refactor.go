@@ -0,0 +1,281 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FieldTypeChange is a field whose type is changed by ChangeFieldType.
+type FieldTypeChange struct {
+	Model   string `json:"model"`
+	Field   string `json:"field"`
+	Table   string `json:"table"`
+	Column  string `json:"column"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	FromSQL string `json:"from_sql"`
+	ToSQL   string `json:"to_sql"`
+}
+
+// ChangeFieldType changes the type of every field of the definitions declared with type from, or with a
+// pointer or slice of it, to the same kind of type of to, e.g. *float64 to *decimal.Decimal when changing
+// float64 to decimal.Decimal. Fields stored in the base columns are left alone. It returns the changes made, by
+// model and then by field. Nothing is changed if any field cannot be: encrypted fields, which are stored as
+// text, enum and vector fields, whose columns have constraints a type change does not migrate, and fields whose
+// default is not a value of the new type.
+func ChangeFieldType(defs []*ModelDefinition, from, to string) ([]FieldTypeChange, error) {
+	for _, fieldType := range []string{from, to} {
+		if err := ValidateFieldType(fieldType); err != nil {
+			return nil, err
+		}
+		if _, ok := EnumValues(fieldType); ok {
+			return nil, fmt.Errorf("cannot change the type of enum fields: update the fields of their models instead")
+		}
+		if _, ok := VectorDimensions(fieldType); ok {
+			return nil, fmt.Errorf("cannot change the type of vector fields: update the fields of their models instead")
+		}
+	}
+	if from == to {
+		return nil, fmt.Errorf("the new type is the current type %s", from)
+	}
+
+	var changes []FieldTypeChange
+	updated := make(map[*Field]Field)
+	for _, def := range defs {
+		for i := range def.Fields {
+			field := &def.Fields[i]
+			if (field.Type != from && elementType(field.Type) != from) || isBaseColumn(ToSnakeCase(field.Name)) {
+				continue
+			}
+			changed := *field
+			changed.Type = field.Type[:len(field.Type)-len(from)] + to
+			if field.Encrypted {
+				return nil, fmt.Errorf("%s.%s is encrypted and stored as text", def.Name, field.Name)
+			}
+			if changed.Default != "" {
+				if err := changed.SetDefault(changed.Default); err != nil {
+					return nil, fmt.Errorf("default of %s.%s: %w", def.Name, field.Name, err)
+				}
+			}
+			updated[field] = changed
+			changes = append(changes, FieldTypeChange{
+				Model:   def.Name,
+				Field:   field.Name,
+				Table:   TableName(def),
+				Column:  ColumnName(field),
+				From:    field.Type,
+				To:      changed.Type,
+				FromSQL: columnSQLType(field),
+				ToSQL:   columnSQLType(&changed),
+			})
+		}
+	}
+	for field, changed := range updated {
+		*field = changed
+	}
+	return changes, nil
+}
+
+// FieldTypeMigrations returns the up and down SQL of the migrations changing the column types of the given
+// changes. Every migration alters the columns of up to batchSize tables, each with a single ALTER TABLE that
+// rewrites the table once, so applying a large change does not hold the locks of every table at once.
+func FieldTypeMigrations(changes []FieldTypeChange, batchSize int) (up, down []string) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	var tables []string
+	byTable := make(map[string][]FieldTypeChange)
+	for _, change := range changes {
+		if _, seen := byTable[change.Table]; !seen {
+			tables = append(tables, change.Table)
+		}
+		byTable[change.Table] = append(byTable[change.Table], change)
+	}
+
+	for start := 0; start < len(tables); start += batchSize {
+		end := start + batchSize
+		if end > len(tables) {
+			end = len(tables)
+		}
+		var upSQL, downSQL strings.Builder
+		for _, table := range tables[start:end] {
+			upSQL.WriteString(alterColumnTypes(table, byTable[table], true))
+			downSQL.WriteString(alterColumnTypes(table, byTable[table], false))
+		}
+		up = append(up, upSQL.String())
+		down = append(down, downSQL.String())
+	}
+	return up, down
+}
+
+// alterColumnTypes returns the statement changing the columns of a table to their new types, or back to their
+// previous types when forward is false. Values are converted with casts.
+func alterColumnTypes(table string, changes []FieldTypeChange, forward bool) string {
+	clauses := make([]string, len(changes))
+	for i, change := range changes {
+		sqlType := change.ToSQL
+		if !forward {
+			sqlType = change.FromSQL
+		}
+		clauses[i] = fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s", change.Column, sqlType, change.Column, sqlType)
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s;\n", table, strings.Join(clauses, ", "))
+}
+
+// Rename is a model or a field renamed by RenameModel or RenameField, with the SQL renaming its table or column.
+type Rename struct {
+	// Model is the name of the model, after the rename.
+	Model string `json:"model"`
+	// Field is the name of the renamed field, after the rename, empty when the model is renamed.
+	Field string `json:"field,omitempty"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	// References are the fields of the models referencing the renamed model, as Model.field, updated to its
+	// new name.
+	References []string `json:"references,omitempty"`
+	// Up renames the table or column, and the indexes named after it; Down renames them back. Both are empty
+	// when no name of the database changes.
+	Up   string `json:"up,omitempty"`
+	Down string `json:"down,omitempty"`
+}
+
+// identifierPattern matches the names models and fields can be renamed to.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// RenameModel renames a model of the definitions, and the references of every model to it. Its table is
+// renamed to the table the naming strategy derives for the new name, unless it was named otherwise, along with
+// its primary key, ID sequence and indexes, so the rows are kept.
+func RenameModel(defs []*ModelDefinition, name, newName string, strategy NamingStrategy) (*Rename, error) {
+	var def *ModelDefinition
+	for _, d := range defs {
+		switch {
+		case strings.EqualFold(d.Name, name):
+			def = d
+		case strings.EqualFold(d.Name, newName):
+			return nil, fmt.Errorf("model %s already exists", d.Name)
+		}
+	}
+	if def == nil {
+		return nil, fmt.Errorf("model %s not found", name)
+	}
+	if !identifierPattern.MatchString(newName) {
+		return nil, fmt.Errorf("invalid model name %q: use letters, digits and underscores, starting with a letter", newName)
+	}
+	if def.Name == newName {
+		return nil, fmt.Errorf("the new name is the current name %s", newName)
+	}
+
+	rename := &Rename{Model: newName, From: def.Name, To: newName}
+	table, indexes := TableName(def), indexNames(def)
+	if def.Options.Table == strategy.TableName(def.Name) {
+		if err := def.SetTable(strategy.TableName(newName)); err != nil {
+			return nil, err
+		}
+	}
+	def.Name = newName
+	for _, d := range defs {
+		for i := range d.Fields {
+			if strings.EqualFold(d.Fields[i].References, rename.From) {
+				d.Fields[i].References = newName
+				rename.References = append(rename.References, d.Name+"."+d.Fields[i].Name)
+			}
+		}
+	}
+
+	if newTable := TableName(def); newTable != table {
+		up := []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", table, newTable),
+			fmt.Sprintf("ALTER SEQUENCE IF EXISTS %s_id_seq RENAME TO %s_id_seq;", table, newTable),
+			fmt.Sprintf("ALTER INDEX IF EXISTS %s_pkey RENAME TO %s_pkey;", table, newTable),
+		}
+		down := []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", newTable, table),
+			fmt.Sprintf("ALTER SEQUENCE IF EXISTS %s_id_seq RENAME TO %s_id_seq;", newTable, table),
+			fmt.Sprintf("ALTER INDEX IF EXISTS %s_pkey RENAME TO %s_pkey;", newTable, table),
+		}
+		rename.Up, rename.Down = renameStatements(up, down, indexes, indexNames(def))
+	}
+	return rename, nil
+}
+
+// RenameField renames a field of a model, and the options naming it: the tenant field, the search fields, the
+// upsert keys and the columns of the policies. Its column is renamed along with its indexes, so the values are
+// kept.
+func RenameField(def *ModelDefinition, name, newName string) (*Rename, error) {
+	field := def.Field(name)
+	if field == nil {
+		return nil, fmt.Errorf("model %s has no field %s", def.Name, name)
+	}
+	if !identifierPattern.MatchString(newName) {
+		return nil, fmt.Errorf("invalid field name %q: use letters, digits and underscores, starting with a letter", newName)
+	}
+	if other := def.Field(newName); other != nil && other != field {
+		return nil, fmt.Errorf("model %s already has a field %s", def.Name, other.Name)
+	}
+	if field.Name == newName {
+		return nil, fmt.Errorf("the new name is the current name %s", newName)
+	}
+	if isBaseColumn(ToSnakeCase(field.Name)) || isBaseColumn(ToSnakeCase(newName)) {
+		return nil, fmt.Errorf("the base fields id, created_at and updated_at cannot be renamed")
+	}
+	if def.Options.LockVersion && strings.EqualFold(field.Name, LockVersionField) {
+		return nil, fmt.Errorf("field %s holds the lock version of model %s and cannot be renamed", field.Name, def.Name)
+	}
+
+	rename := &Rename{Model: def.Name, Field: newName, From: field.Name, To: newName}
+	table, column, indexes := TableName(def), ColumnName(field), indexNames(def)
+	renameOption := func(option *string) {
+		if strings.EqualFold(*option, field.Name) {
+			*option = newName
+		}
+	}
+	renameOption(&def.Options.TenantField)
+	for i := range def.Options.SearchFields {
+		renameOption(&def.Options.SearchFields[i])
+	}
+	for i := range def.Options.UpsertKeys {
+		renameOption(&def.Options.UpsertKeys[i])
+	}
+	field.Name = newName
+	for i := range def.Options.Policies {
+		if policy := &def.Options.Policies[i]; policy.Column == column {
+			policy.Column = ColumnName(field)
+		}
+	}
+
+	if newColumn := ColumnName(field); newColumn != column {
+		up := []string{fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", table, column, newColumn)}
+		down := []string{fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", table, newColumn, column)}
+		rename.Up, rename.Down = renameStatements(up, down, indexes, indexNames(def))
+	}
+	return rename, nil
+}
+
+// indexNames returns the names of the indexes GenerateMigration creates for a model: the indexes of its indexed
+// fields, then the unique index of its upsert keys.
+func indexNames(def *ModelDefinition) []string {
+	table := TableName(def)
+	var names []string
+	for _, c := range modelColumns(def) {
+		if c.Field != nil && c.Field.Indexed {
+			names = append(names, fmt.Sprintf("%s_%s_idx", table, c.Name))
+		}
+	}
+	if columns := UpsertColumns(def); len(columns) > 0 {
+		names = append(names, fmt.Sprintf("%s_%s_key", table, strings.Join(columns, "_")))
+	}
+	return names
+}
+
+// renameStatements returns the SQL of the up and down statements of a rename, followed by the statements
+// renaming the indexes whose names changed from before to after, and back in reverse order.
+func renameStatements(up, down, before, after []string) (string, string) {
+	for i := range before {
+		if i < len(after) && before[i] != after[i] {
+			up = append(up, fmt.Sprintf("ALTER INDEX IF EXISTS %s RENAME TO %s;", before[i], after[i]))
+			down = append([]string{fmt.Sprintf("ALTER INDEX IF EXISTS %s RENAME TO %s;", after[i], before[i])}, down...)
+		}
+	}
+	return strings.Join(up, "\n") + "\n", strings.Join(down, "\n") + "\n"
+}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeFieldType(t *testing.T) {
+	assert.NoError(t, RegisterType(CustomType{Name: "decimal.Decimal", SQLType: "NUMERIC(12,2)", Import: "github.com/shopspring/decimal"}))
+	t.Cleanup(func() { delete(customTypes, "decimal.Decimal") })
+
+	product := NewModelDefinition("Product", []Field{
+		NewField("price", "float64", "", false, false),
+		NewField("discount", "*float64", "", false, false),
+		NewField("name", "string", "", false, false),
+	})
+	invoice := NewModelDefinition("Invoice", []Field{NewField("totals", "[]float64", "", false, false)})
+	user := NewModelDefinition("User", []Field{NewField("email", "string", "", false, false)})
+
+	changes, err := ChangeFieldType([]*ModelDefinition{product, invoice, user}, "float64", "decimal.Decimal")
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldTypeChange{
+		{Model: "Product", Field: "price", Table: "products", Column: "price", From: "float64", To: "decimal.Decimal", FromSQL: "DOUBLE PRECISION", ToSQL: "NUMERIC(12,2)"},
+		{Model: "Product", Field: "discount", Table: "products", Column: "discount", From: "*float64", To: "*decimal.Decimal", FromSQL: "DOUBLE PRECISION", ToSQL: "NUMERIC(12,2)"},
+		{Model: "Invoice", Field: "totals", Table: "invoices", Column: "totals", From: "[]float64", To: "[]decimal.Decimal", FromSQL: "DOUBLE PRECISION[]", ToSQL: "NUMERIC(12,2)[]"},
+	}, changes)
+	assert.Equal(t, "decimal.Decimal", product.Fields[0].Type)
+	assert.Equal(t, "string", product.Fields[2].Type)
+
+	up, down := FieldTypeMigrations(changes, 1)
+	assert.Equal(t, []string{
+		"ALTER TABLE products ALTER COLUMN price TYPE NUMERIC(12,2) USING price::NUMERIC(12,2), ALTER COLUMN discount TYPE NUMERIC(12,2) USING discount::NUMERIC(12,2);\n",
+		"ALTER TABLE invoices ALTER COLUMN totals TYPE NUMERIC(12,2)[] USING totals::NUMERIC(12,2)[];\n",
+	}, up)
+	assert.Equal(t, "ALTER TABLE invoices ALTER COLUMN totals TYPE DOUBLE PRECISION[] USING totals::DOUBLE PRECISION[];\n", down[1])
+	up, _ = FieldTypeMigrations(changes, 10)
+	assert.Len(t, up, 1)
+}
+
+func TestChangeFieldType_Rejects(t *testing.T) {
+	secret := NewModelDefinition("Secret", []Field{
+		NewField("count", "int", "", false, false),
+		NewField("value", "string", "", false, false),
+	})
+	assert.NoError(t, secret.EncryptField("value"))
+
+	_, err := ChangeFieldType([]*ModelDefinition{secret}, "string", "[]byte")
+	assert.ErrorContains(t, err, "Secret.value is encrypted")
+	_, err = ChangeFieldType([]*ModelDefinition{secret}, "int", "money")
+	assert.ErrorContains(t, err, "unknown field type money")
+	_, err = ChangeFieldType([]*ModelDefinition{secret}, "string", "enum(a,b)")
+	assert.ErrorContains(t, err, "enum fields")
+
+	assert.NoError(t, secret.SetDefault("count", "3"))
+	_, err = ChangeFieldType([]*ModelDefinition{secret}, "int", "bool")
+	assert.ErrorContains(t, err, "default of Secret.count")
+	assert.Equal(t, "int", secret.Fields[0].Type, "nothing is changed when a field cannot be")
+}
+
+func TestRenameModel(t *testing.T) {
+	order := NewModelDefinition("Order", []Field{NewField("number", "string", "", false, false)})
+	assert.NoError(t, order.SetTable(NamingSnakePlural.TableName("Order")))
+	assert.NoError(t, order.IndexField("number"))
+	item := NewModelDefinition("LineItem", []Field{{Name: "order_id", Type: "int64", References: "Order"}})
+	defs := []*ModelDefinition{item, order}
+
+	rename, err := RenameModel(defs, "order", "Purchase", NamingSnakePlural)
+	assert.NoError(t, err)
+	assert.Equal(t, &Rename{
+		Model:      "Purchase",
+		From:       "Order",
+		To:         "Purchase",
+		References: []string{"LineItem.order_id"},
+		Up: "ALTER TABLE orders RENAME TO purchases;\n" +
+			"ALTER SEQUENCE IF EXISTS orders_id_seq RENAME TO purchases_id_seq;\n" +
+			"ALTER INDEX IF EXISTS orders_pkey RENAME TO purchases_pkey;\n" +
+			"ALTER INDEX IF EXISTS orders_number_idx RENAME TO purchases_number_idx;\n",
+		Down: "ALTER INDEX IF EXISTS purchases_number_idx RENAME TO orders_number_idx;\n" +
+			"ALTER TABLE purchases RENAME TO orders;\n" +
+			"ALTER SEQUENCE IF EXISTS purchases_id_seq RENAME TO orders_id_seq;\n" +
+			"ALTER INDEX IF EXISTS purchases_pkey RENAME TO orders_pkey;\n",
+	}, rename)
+	assert.Equal(t, "Purchase", order.Name)
+	assert.Equal(t, "purchases", TableName(order))
+	assert.Equal(t, "Purchase", item.Fields[0].References)
+
+	// A table named otherwise than by the naming strategy is kept.
+	assert.NoError(t, order.SetTable("legacy_orders"))
+	rename, err = RenameModel(defs, "Purchase", "Sale", NamingSnakePlural)
+	assert.NoError(t, err)
+	assert.Empty(t, rename.Up)
+	assert.Equal(t, "legacy_orders", TableName(order))
+}
+
+func TestRenameModel_Rejects(t *testing.T) {
+	defs := []*ModelDefinition{
+		NewModelDefinition("Order", nil),
+		NewModelDefinition("User", nil),
+	}
+	for newName, message := range map[string]string{
+		"user":      "model User already exists",
+		"2fa":       `invalid model name "2fa": use letters, digits and underscores, starting with a letter`,
+		"Order":     "the new name is the current name Order",
+		"Purchase;": `invalid model name "Purchase;": use letters, digits and underscores, starting with a letter`,
+	} {
+		_, err := RenameModel(defs, "Order", newName, NamingSnakePlural)
+		assert.EqualError(t, err, message, newName)
+	}
+	_, err := RenameModel(defs, "Invoice", "Bill", NamingSnakePlural)
+	assert.EqualError(t, err, "model Invoice not found")
+}
+
+func TestRenameField(t *testing.T) {
+	post := NewModelDefinition("Post", []Field{
+		NewField("body", "string", "", false, false),
+		NewField("slug", "string", "", false, false),
+	})
+	assert.NoError(t, post.IndexField("body"))
+	assert.NoError(t, post.SetSearchFields([]string{"body"}))
+	assert.NoError(t, post.SetUpsertKeys([]string{"slug", "body"}))
+
+	rename, err := RenameField(post, "Body", "content")
+	assert.NoError(t, err)
+	assert.Equal(t, &Rename{
+		Model: "Post",
+		Field: "content",
+		From:  "body",
+		To:    "content",
+		Up: "ALTER TABLE posts RENAME COLUMN body TO content;\n" +
+			"ALTER INDEX IF EXISTS posts_body_idx RENAME TO posts_content_idx;\n" +
+			"ALTER INDEX IF EXISTS posts_slug_body_key RENAME TO posts_slug_content_key;\n",
+		Down: "ALTER INDEX IF EXISTS posts_slug_content_key RENAME TO posts_slug_body_key;\n" +
+			"ALTER INDEX IF EXISTS posts_content_idx RENAME TO posts_body_idx;\n" +
+			"ALTER TABLE posts RENAME COLUMN content TO body;\n",
+	}, rename)
+	assert.Equal(t, []string{"content"}, post.Options.SearchFields)
+	assert.Equal(t, []string{"slug", "content"}, post.Options.UpsertKeys)
+	assert.NotNil(t, post.Field("content"))
+
+	_, err = RenameField(post, "content", "slug")
+	assert.EqualError(t, err, "model Post already has a field slug")
+	_, err = RenameField(post, "content", "created_at")
+	assert.EqualError(t, err, "the base fields id, created_at and updated_at cannot be renamed")
+	_, err = RenameField(post, "title", "headline")
+	assert.EqualError(t, err, "model Post has no field title")
+	assert.NoError(t, post.EnableLockVersion())
+	_, err = RenameField(post, "version", "revision")
+	assert.EqualError(t, err, "field version holds the lock version of model Post and cannot be renamed")
+}
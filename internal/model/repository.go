@@ -0,0 +1,841 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// column describes how a model field is stored and accessed by generated code.
+type column struct {
+	Name   string // SQL column name
+	GoName string // Go struct field name in the generated model
+	GoType string
+	Field  *Field // nil for the columns contributed by DefaultModel
+}
+
+// baseColumns are the columns backing the fields of the embedded DefaultModel.
+var baseColumns = []column{
+	{Name: "id", GoName: "ID", GoType: "uint"},
+	{Name: "created_at", GoName: "CreatedAt", GoType: "time.Time"},
+	{Name: "updated_at", GoName: "UpdatedAt", GoType: "time.Time"},
+}
+
+// goFieldName returns the name of the Go struct field generated for a model field. It must stay in sync with the
+// "title" function used by the model template.
+func goFieldName(name string) string {
+	return cases.Title(language.English).String(name)
+}
+
+// ownFields returns the fields a model declares on top of DefaultModel. A field whose snake_case name collides
+// with a base column is represented by the base field and omitted. Every generator applies this rule, so the Go
+// model, its repository and migration, the protobuf message, and the TypeScript interface agree on the fields.
+func ownFields(modelDef *ModelDefinition) []Field {
+	var fields []Field
+	for _, field := range modelDef.Fields {
+		if !isBaseColumn(ToSnakeCase(field.Name)) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// modelColumns returns the base columns followed by the columns of the model's own fields, see ownFields.
+func modelColumns(modelDef *ModelDefinition) []column {
+	columns := append([]column{}, baseColumns...)
+	fields := ownFields(modelDef)
+	for i := range fields {
+		field := &fields[i]
+		columns = append(columns, column{
+			Name:   ColumnName(field),
+			GoName: goFieldName(field.Name),
+			GoType: fieldGoType(modelDef.Name, *field),
+			Field:  field,
+		})
+	}
+	return columns
+}
+
+// StoredColumn is a column of a model's table and the type of the values it stores: the field type for the
+// columns of the model's fields, and the Go type of the base field for the base columns.
+type StoredColumn struct {
+	Name  string
+	Type  string
+	Field *Field // nil for the columns contributed by DefaultModel
+}
+
+// StoredColumns returns the columns of a model's table in the order the generated code and migration use.
+func StoredColumns(modelDef *ModelDefinition) []StoredColumn {
+	var columns []StoredColumn
+	for _, c := range modelColumns(modelDef) {
+		stored := StoredColumn{Name: c.Name, Type: c.GoType, Field: c.Field}
+		if c.Field != nil {
+			stored.Type = c.Field.Type
+		}
+		columns = append(columns, stored)
+	}
+	return columns
+}
+
+// ColumnName returns the SQL column a model field is stored in.
+func ColumnName(field *Field) string {
+	return strings.ToLower(field.Name)
+}
+
+// isArrayType reports whether goType is stored as a PostgreSQL array, which database/sql can only read and
+// write through pq.Array. []byte is stored as BYTEA and handled by the driver directly.
+func isArrayType(goType string) bool {
+	return strings.HasPrefix(goType, "[]") && goType != "[]byte"
+}
+
+// isBaseColumn reports whether name is one of the columns contributed by DefaultModel.
+func isBaseColumn(name string) bool {
+	for _, base := range baseColumns {
+		if base.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TableName returns the table a generated model is stored in. It matches the TableName method generated by
+// the model template. The name is chosen when the model is created, see NamingStrategy, or set with SetTable;
+// models created before table names were recorded keep the lowercase model name followed by "s".
+func TableName(modelDef *ModelDefinition) string {
+	if modelDef.Options.Table != "" {
+		return modelDef.Options.Table
+	}
+	return NamingLowerPlural.TableName(modelDef.Name)
+}
+
+// repositoryTemplate is the template for the repository generated next to every model. It provides
+// context-aware Create, CreateBatch, Get, List, ListPage, Update, and Delete methods backed by database/sql,
+// which call the hooks the model implements, Upsert and UpsertBatch methods for models with upsert keys, and
+// a nearest-neighbor search for every vector field. Reads run on the read
+// replicas of the database once UseReplicas is called.
+const repositoryTemplate = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+{{- if or .UsesArrays .SearchDocument}}
+
+	"github.com/lib/pq"
+{{- end}}
+)
+
+// {{.Name}}Repository provides CRUD operations for {{.Name}} records stored in the {{.Table}} table.
+type {{.Name}}Repository struct {
+	db *sql.DB
+}
+
+// New{{.Name}}Repository creates a {{.Name}}Repository backed by the given database.
+func New{{.Name}}Repository(db *sql.DB) *{{.Name}}Repository {
+	return &{{.Name}}Repository{db: db}
+}
+
+{{if .Cache -}}
+// {{.Var}}Cache holds the {{.Name}} records read by Get for {{.CacheTTL}}, keyed by {{.CacheKeyDoc}}.
+var {{.Var}}Cache = newRecordCache[{{.Name}}]("{{.Name}}", {{.CacheTTLExpr}})
+
+{{end -}}
+// {{.Var}}Columns lists the columns of the {{.Table}} table in scan order.
+const {{.Var}}Columns = "{{.ColumnList}}"
+
+{{if .SessionSettings -}}
+// {{.Var}}SessionSettings lists the session settings read by the row-level security policies of the {{.Table}}
+// table. Every repository method requires them to be set in its context, see WithSessionSetting.
+var {{.Var}}SessionSettings = []string{ {{- .SessionSettings -}} }
+{{- else -}}
+// {{.Var}}SessionSettings is empty as the {{.Table}} table has no row-level security policies.
+var {{.Var}}SessionSettings []string
+{{- end}}
+
+// scan{{.Name}} scans a single row selected with {{.Var}}Columns into a {{.Name}}.
+func scan{{.Name}}(row rowScanner) (*{{.Name}}, error) {
+	m := &{{.Name}}{}
+{{- range .NullableScans}}
+	var {{.Var}} *{{.GoType}}
+{{- end}}
+	if err := row.Scan({{.ScanArgs}}); err != nil {
+		return nil, err
+	}
+{{- range .NullableScans}}
+	if {{.Var}} != nil {
+		m.{{.GoName}} = *{{.Var}}
+	}
+{{- end}}
+	return m, nil
+}
+
+// Create inserts m and sets its ID, CreatedAt, and UpdatedAt fields.
+{{- if .DefaultedColumns}}
+// Unset {{.DefaultedColumns}} fields are stored with their column default, which is read back into m.
+{{- end}}
+{{- if .Tenant}}
+// The tenant of ctx is stored in {{.TenantGoName}}.{{end}} The hooks m implements are called around the insert.
+func (r *{{.Name}}Repository) Create(ctx context.Context, m *{{.Name}}) error {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.{{.TenantGoName}} = tenant
+{{- end}}
+	err {{if not .Tenant}}:{{end}}= withModelSession(ctx, r.db, "{{.Table}}", {{.Var}}SessionSettings, m, func(q querier) error {
+		if err := beforeCreate(ctx, m); err != nil {
+			return err
+		}
+		now := time.Now()
+		m.CreatedAt = now
+		m.UpdatedAt = now
+		err := q.QueryRowContext(ctx,
+			"INSERT INTO {{.Table}} ({{.InsertColumnList}}) VALUES ({{.InsertPlaceholders}}) RETURNING {{.ReturningColumnList}}",
+			{{.InsertArgs}},
+		).Scan({{.ReturningArgs}})
+		if err != nil {
+			return err
+		}
+		return afterCreate(ctx, m)
+	})
+	if err == nil {
+		publish(ctx, Event{Table: "{{.Table}}", Op: OpCreate, ID: m.ID, Record: m})
+	}
+	return err
+}
+
+// CreateBatch inserts ms and sets their ID, CreatedAt, and UpdatedAt fields like Create, with multi-row
+// INSERT statements of up to MaxBatchRows rows run in one transaction: either every record is inserted or
+// none is.
+func (r *{{.Name}}Repository) CreateBatch(ctx context.Context, ms []*{{.Name}}) error {
+	return r.insertBatch(ctx, ms, false)
+}
+{{if .UpsertColumnList}}
+// Upsert inserts m, or updates the record conflicting on ({{.UpsertColumnList}}) instead, and sets its ID,
+// CreatedAt, and UpdatedAt fields as stored. The BeforeSave hook m implements is called before the statement,
+// and AfterCreate or AfterUpdate after it, depending on whether the record was inserted or updated.
+func (r *{{.Name}}Repository) Upsert(ctx context.Context, m *{{.Name}}) error {
+	return r.insertBatch(ctx, []*{{.Name}}{m}, true)
+}
+
+// UpsertBatch upserts ms like Upsert, in statements like CreateBatch. No two records of a batch may conflict
+// on ({{.UpsertColumnList}}).
+func (r *{{.Name}}Repository) UpsertBatch(ctx context.Context, ms []*{{.Name}}) error {
+	return r.insertBatch(ctx, ms, true)
+}
+{{end}}
+// {{.Var}}InsertDefaults holds, for every column inserted by CreateBatch, the default stored when its value is
+// unset, or "".
+var {{.Var}}InsertDefaults = []string{ {{- .InsertDefaults -}} }
+
+// insertBatch inserts ms in statements of up to MaxBatchRows rows, or upserts them when upsert is set.
+func (r *{{.Name}}Repository) insertBatch(ctx context.Context, ms []*{{.Name}}, upsert bool) error {
+	if len(ms) == 0 {
+		return nil
+	}
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		m.{{.TenantGoName}} = tenant
+	}
+{{- end}}
+	inserted := make([]bool, len(ms))
+	err {{if not .Tenant}}:{{end}}= withBatchSession(ctx, r.db, "{{.Table}}", {{.Var}}SessionSettings, func(q querier) error {
+		before := beforeCreate
+		if upsert {
+			before = beforeSave
+		}
+		now := time.Now()
+		for _, m := range ms {
+			if err := before(ctx, m); err != nil {
+				return err
+			}
+			m.CreatedAt = now
+			m.UpdatedAt = now
+		}
+		suffix := " RETURNING {{.BatchReturningColumnList}}, true"
+{{- if .UpsertColumnList}}
+		if upsert {
+			// xmax is 0 for the rows inserted, and set for the rows updated.
+			suffix = " ON CONFLICT ({{.UpsertColumnList}}) DO UPDATE SET {{.UpsertAssignments}} RETURNING {{.BatchReturningColumnList}}, xmax = 0"
+		}
+{{- end}}
+		size := batchRows(len({{.Var}}InsertDefaults))
+		for start := 0; start < len(ms); start += size {
+			end := start + size
+			if end > len(ms) {
+				end = len(ms)
+			}
+			args := make([]interface{}, 0, (end-start)*len({{.Var}}InsertDefaults))
+			for _, m := range ms[start:end] {
+				args = append(args, {{.InsertArgs}})
+			}
+			rows, err := q.QueryContext(ctx, "INSERT INTO {{.Table}} ({{.InsertColumnList}}) VALUES "+batchValues(end-start, {{.Var}}InsertDefaults)+suffix, args...)
+			if err != nil {
+				return err
+			}
+			// The rows are returned in the order of the VALUES list.
+			for i := start; rows.Next(); i++ {
+				m := ms[i]
+				if err := rows.Scan({{.BatchReturningArgs}}, &inserted[i]); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+		for i, m := range ms {
+			after := afterCreate
+			if !inserted[i] {
+				after = afterUpdate
+			}
+			if err := after(ctx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+{{- if .Cache}}
+	if upsert {
+		for _, m := range ms {
+			{{.Var}}Cache.evict(m.ID)
+		}
+	}
+{{- end}}
+	if err == nil {
+		for i, m := range ms {
+			op := OpCreate
+			if !inserted[i] {
+				op = OpUpdate
+			}
+			publish(ctx, Event{Table: "{{.Table}}", Op: op, ID: m.ID, Record: m})
+		}
+	}
+	return err
+}
+
+// Get returns the {{.Name}} with the given ID, or sql.ErrNoRows if it does not exist
+{{- if .Tenant}} for the tenant of ctx{{end}}.
+{{- if .Cache}}
+// Records are served from {{.Var}}Cache while cached.
+{{- end}}
+func (r *{{.Name}}Repository) Get(ctx context.Context, id uint) (*{{.Name}}, error) {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+{{- if .Cache}}
+	scope := {{.CacheScope}}
+	if m, ok := {{.Var}}Cache.get(id, scope); ok {
+		return m, nil
+	}
+{{- end}}
+	var m *{{.Name}}
+	err {{if not .Tenant}}:{{end}}= withSession(ctx, r.db, "{{.Table}}", {{.Var}}SessionSettings, func(q querier) error {
+		var err error
+		m, err = scan{{.Name}}(q.QueryRowContext(ctx, "SELECT "+{{.Var}}Columns+" FROM {{.Table}} WHERE id = $1{{.TenantCondition 2}}", id{{.TenantArg}}))
+		return err
+	})
+{{- if .Cache}}
+	if err == nil {
+		{{.Var}}Cache.set(id, scope, m)
+	}
+{{- end}}
+	return m, err
+}
+
+// List returns every {{.Name}} ordered by ID, up to RowLimit records unless OnRowLimit allows more. Use
+// ListPage to read large tables a page at a time.
+func (r *{{.Name}}Repository) List(ctx context.Context) ([]*{{.Name}}, error) {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+	return r.query(ctx, false, "SELECT "+{{.Var}}Columns+" FROM {{.Table}}{{.TenantFilter 1}} ORDER BY id"{{.TenantArg}})
+}
+
+// ListPage returns the page of {{.Name}} records ordered by ID selected by req, and the total number of
+// records. It returns an error wrapping ErrInvalidPage if req selects no valid page.
+func (r *{{.Name}}Repository) ListPage(ctx context.Context, req PageRequest) (*Page[*{{.Name}}], error) {
+	limit, offset, after, err := req.bounds()
+	if err != nil {
+		return nil, err
+	}
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+	var total int64
+	err = withSession(ctx, r.db, "{{.Table}}", {{.Var}}SessionSettings, func(q querier) error {
+		return q.QueryRowContext(ctx, "SELECT count(*) FROM {{.Table}}{{.TenantFilter 1}}"{{.TenantArg}}).Scan(&total)
+	})
+	if err != nil {
+		return nil, err
+	}
+	items, err := r.query(ctx, true, "SELECT "+{{.Var}}Columns+" FROM {{.Table}} WHERE id > $1{{.TenantCondition 4}} ORDER BY id LIMIT $2 OFFSET $3", after, limit+1, offset{{.TenantArg}})
+	if err != nil {
+		return nil, err
+	}
+	return newPage(items, total, limit, func(m *{{.Name}}) uint { return m.ID }), nil
+}
+{{range .VectorColumns}}
+// NearestBy{{.GoName}} returns up to limit records whose {{.Name}} is closest to v under the given metric,
+// closest first.
+func (r *{{$.Name}}Repository) NearestBy{{.GoName}}(ctx context.Context, v Vector, metric DistanceMetric, limit int) ([]*{{$.Name}}, error) {
+	operator, err := distanceOperator(metric)
+	if err != nil {
+		return nil, err
+	}
+{{- if $.Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+	return r.query(ctx, true, "SELECT "+{{$.Var}}Columns+" FROM {{$.Table}}{{$.TenantFilter 3}} ORDER BY {{.Name}} "+operator+" $1 LIMIT $2", v, limit{{$.TenantArg}})
+}
+{{end}}
+{{- if .SearchDocument}}
+func init() {
+	registerSearchIndex("{{.Table}}", func(record interface{}) map[string]interface{} {
+		m := record.(*{{.Name}})
+		return map[string]interface{}{"id": m.ID, {{.SearchDocument}}}
+	})
+}
+
+// Search returns up to limit {{.Name}} records whose {{.SearchFieldList}} match query in the search index,
+// best match first. It returns ErrSearchDisabled until EnableSearch is called.
+func (r *{{.Name}}Repository) Search(ctx context.Context, query string, limit int) ([]*{{.Name}}, error) {
+	ids, err := searchIDs(ctx, "{{.Table}}", query, limit)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+	items, err := r.query(ctx, true, "SELECT "+{{.Var}}Columns+" FROM {{.Table}} WHERE id = ANY($1){{.TenantCondition 2}}", pq.Array(ids){{.TenantArg}})
+	if err != nil {
+		return nil, err
+	}
+	return sortByIDs(items, ids, func(m *{{.Name}}) uint { return m.ID }), nil
+}
+{{end}}
+// query returns the {{.Name}} records selected by a query on {{.Var}}Columns. The rows of queries without a
+// LIMIT are checked against RowLimit.
+func (r *{{.Name}}Repository) query(ctx context.Context, limited bool, query string, args ...interface{}) ([]*{{.Name}}, error) {
+	var items []*{{.Name}}
+	err := withSession(ctx, r.db, "{{.Table}}", {{.Var}}SessionSettings, func(q querier) error {
+		// A read failing on a replica runs again on the primary, see withSession.
+		items = nil
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			m, err := scan{{.Name}}(rows)
+			if err != nil {
+				return err
+			}
+			items = append(items, m)
+			if !limited {
+				if err := checkRowLimit("{{.Table}}", len(items)); err != nil {
+					return err
+				}
+			}
+		}
+		return rows.Err()
+	})
+	return items, err
+}
+
+// Update writes every field of m and refreshes UpdatedAt. It returns sql.ErrNoRows if no row has m's ID.
+{{- if .LockVersion}}
+// The row is only written if its version is still m's Version, which is then incremented; otherwise a
+// *StaleObjectError is returned.
+{{- end}}
+{{- if .Tenant}}
+// Only records of the tenant of ctx are written.{{end}} The hooks m implements are called around the update.
+func (r *{{.Name}}Repository) Update(ctx context.Context, m *{{.Name}}) error {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.{{.TenantGoName}} = tenant
+{{- end}}
+	err {{if not .Tenant}}:{{end}}= withModelSession(ctx, r.db, "{{.Table}}", {{.Var}}SessionSettings, m, func(q querier) error {
+		if err := beforeUpdate(ctx, m); err != nil {
+			return err
+		}
+		m.UpdatedAt = time.Now()
+		result, err := q.ExecContext(ctx,
+{{- if .LockVersion}}
+			"UPDATE {{.Table}} SET {{.UpdateAssignments}} WHERE id = ${{.UpdateIDIndex}} AND version = ${{.LockVersionIndex}}{{.TenantCondition .TenantIndex}}",
+			{{.UpdateArgs}}, m.ID, m.Version{{.TenantArg}},
+{{- else}}
+			"UPDATE {{.Table}} SET {{.UpdateAssignments}} WHERE id = ${{.UpdateIDIndex}}{{.TenantCondition .TenantIndex}}",
+			{{.UpdateArgs}}, m.ID{{.TenantArg}},
+{{- end}}
+		)
+		if err != nil {
+			return err
+		}
+{{- if .LockVersion}}
+		if err := requireVersion(ctx, q, result, "{{.Name}}", m.ID, m.Version, "SELECT EXISTS (SELECT 1 FROM {{.Table}} WHERE id = $1{{.TenantCondition 2}})", m.ID{{.TenantArg}}); err != nil {
+			return err
+		}
+		m.Version++
+{{- else}}
+		if err := requireAffected(result); err != nil {
+			return err
+		}
+{{- end}}
+		return afterUpdate(ctx, m)
+	})
+{{- if .Cache}}
+	{{.Var}}Cache.evict(m.ID)
+{{- end}}
+	if err == nil {
+		publish(ctx, Event{Table: "{{.Table}}", Op: OpUpdate, ID: m.ID, Record: m})
+	}
+	return err
+}
+
+// Delete removes the {{.Name}} with the given ID. It returns sql.ErrNoRows if it does not exist. When
+// {{.Name}} implements BeforeDelete or AfterDelete, the record is loaded to call them.
+{{- if .Tenant}}
+// Only records of the tenant of ctx are deleted.
+{{- end}}
+func (r *{{.Name}}Repository) Delete(ctx context.Context, id uint) error {
+{{- if .Tenant}}
+	tenant, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+{{- end}}
+	m := &{{.Name}}{}
+	m.ID = id
+	err {{if not .Tenant}}:{{end}}= withModelSession(ctx, r.db, "{{.Table}}", {{.Var}}SessionSettings, m, func(q querier) error {
+		if hasDeleteHooks(m) {
+			stored, err := scan{{.Name}}(q.QueryRowContext(ctx, "SELECT "+{{.Var}}Columns+" FROM {{.Table}} WHERE id = $1{{.TenantCondition 2}}", id{{.TenantArg}}))
+			if err != nil {
+				return err
+			}
+			m = stored
+		}
+		if err := beforeDelete(ctx, m); err != nil {
+			return err
+		}
+		result, err := q.ExecContext(ctx, "DELETE FROM {{.Table}} WHERE id = $1{{.TenantCondition 2}}", id{{.TenantArg}})
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(result); err != nil {
+			return err
+		}
+		return afterDelete(ctx, m)
+	})
+{{- if .Cache}}
+	{{.Var}}Cache.evict(id)
+{{- end}}
+	if err == nil {
+		publish(ctx, Event{Table: "{{.Table}}", Op: OpDelete, ID: id})
+	}
+	return err
+}
+`
+
+// repositoryData is the view of a model definition consumed by repositoryTemplate.
+type repositoryData struct {
+	Name                     string
+	Var                      string
+	Table                    string
+	ColumnList               string
+	ScanArgs                 string
+	NullableScans            []nullableScan
+	InsertColumnList         string
+	InsertPlaceholders       string
+	InsertArgs               string
+	ReturningColumnList      string
+	ReturningArgs            string
+	DefaultedColumns         string
+	UpdateAssignments        string
+	UpdateArgs               string
+	UpdateIDIndex            int
+	LockVersion              bool
+	LockVersionIndex         int
+	Tenant                   string // column of the tenant field, see SetTenantField
+	TenantGoName             string
+	TenantIndex              int
+	UsesArrays               bool
+	SessionSettings          string
+	VectorColumns            []column
+	SearchDocument           string // entries of the search document of a record, see SetSearchFields
+	SearchFieldList          string
+	Cache                    bool
+	CacheTTL                 time.Duration
+	CacheKey                 string // key strategy of the cache, see SetCache
+	InsertDefaults           string // entries of the defaults of the inserted columns, see batchValues
+	BatchReturningColumnList string
+	BatchReturningArgs       string
+	UpsertColumnList         string // conflict target of upserts, see UpsertColumns
+	UpsertAssignments        string
+}
+
+// CacheTTLExpr returns the Go expression of the TTL of the cache.
+func (d repositoryData) CacheTTLExpr() string {
+	return fmt.Sprintf("%d * time.Millisecond", d.CacheTTL.Milliseconds())
+}
+
+// CacheKeyDoc describes the key of the cached records.
+func (d repositoryData) CacheKeyDoc() string {
+	return CacheKeyDescription(d.CacheKey)
+}
+
+// CacheScope returns the expression of the scope records are cached in, see CacheKeyStrategies.
+func (d repositoryData) CacheScope() string {
+	switch d.CacheKey {
+	case CacheKeyTenant:
+		return "tenant"
+	case CacheKeySession:
+		tenant := `""`
+		if d.Tenant != "" {
+			tenant = "tenant"
+		}
+		return fmt.Sprintf("sessionScope(ctx, %s, %sSessionSettings)", tenant, d.Var)
+	}
+	return `""`
+}
+
+// TenantCondition returns the condition restricting a WHERE clause to the tenant, passed as the n-th argument,
+// or "" if the model is not scoped to tenants.
+func (d repositoryData) TenantCondition(n int) string {
+	if d.Tenant == "" {
+		return ""
+	}
+	return fmt.Sprintf(" AND %s = $%d", d.Tenant, n)
+}
+
+// TenantFilter returns the WHERE clause restricting a query to the tenant, passed as the n-th argument, or ""
+// if the model is not scoped to tenants.
+func (d repositoryData) TenantFilter(n int) string {
+	if d.Tenant == "" {
+		return ""
+	}
+	return fmt.Sprintf(" WHERE %s = $%d", d.Tenant, n)
+}
+
+// TenantArg returns the argument passing the tenant to a statement, or "" if the model is not scoped to tenants.
+func (d repositoryData) TenantArg() string {
+	if d.Tenant == "" {
+		return ""
+	}
+	return ", tenant"
+}
+
+// nullableScan is a nullable column backed by a non-pointer Go field. It is scanned into a pointer first so
+// that NULL leaves the field at its zero value instead of failing the scan.
+type nullableScan struct {
+	Var    string
+	GoName string
+	GoType string
+}
+
+// newRepositoryData derives the SQL fragments and argument lists used by the repository template. Map fields
+// have no column type the generated code can read or write and are rejected.
+func newRepositoryData(modelDef *ModelDefinition) (repositoryData, error) {
+	data := repositoryData{
+		Name:  modelDef.Name,
+		Var:   lowerFirst(modelDef.Name),
+		Table: TableName(modelDef),
+	}
+
+	var names, scanArgs, insertNames, placeholders, insertArgs, insertDefaults, assignments, updateArgs []string
+	returning, returningArgs, defaulted := []string{"id"}, []string{"&m.ID"}, []string{}
+	for _, c := range modelColumns(modelDef) {
+		if strings.HasPrefix(c.GoType, "map[") {
+			return data, fmt.Errorf("unsupported type %s for field %s in repository generation", c.GoType, c.Field.Name)
+		}
+
+		scanArg := "&m." + c.GoName
+		valueArg := "m." + c.GoName
+		switch {
+		case c.Field != nil && c.Field.Encrypted:
+			if c.Field.Default != "" {
+				return data, fmt.Errorf("encrypted field %s cannot have a default", c.Field.Name)
+			}
+			scanArg = "decrypted{" + scanArg + "}"
+			if strings.HasPrefix(c.GoType, "*") {
+				valueArg = "encrypted{" + valueArg + "}"
+			} else {
+				valueArg = "encrypted{&" + valueArg + "}"
+			}
+		case isArrayType(c.GoType):
+			scanArg = "pq.Array(" + scanArg + ")"
+			valueArg = "pq.Array(" + valueArg + ")"
+			data.UsesArrays = true
+		case c.Field != nil && c.Field.IsNull && !strings.HasPrefix(c.GoType, "*") && c.GoType != "[]byte":
+			scan := nullableScan{Var: "null" + c.GoName, GoName: c.GoName, GoType: c.GoType}
+			data.NullableScans = append(data.NullableScans, scan)
+			scanArg = "&" + scan.Var
+		}
+
+		if c.GoType == vectorGoType {
+			data.VectorColumns = append(data.VectorColumns, c)
+		}
+		names = append(names, c.Name)
+		scanArgs = append(scanArgs, scanArg)
+		if c.Name == "id" {
+			continue
+		}
+		insertNames = append(insertNames, c.Name)
+		placeholder, insertArg, insertDefault := fmt.Sprintf("$%d", len(placeholders)+1), valueArg, ""
+		if c.Field != nil && c.Field.Default != "" && (strings.HasPrefix(c.GoType, "*") || c.GoType == "time.Time") {
+			insertDefault = sqlDefault(c.Field)
+			placeholder = fmt.Sprintf("COALESCE(%s, %s)", placeholder, insertDefault)
+			if c.GoType == "time.Time" {
+				insertArg = "nullTime(" + insertArg + ")"
+			}
+			defaulted = append(defaulted, c.GoName)
+			returning = append(returning, c.Name)
+			returningArgs = append(returningArgs, "&m."+c.GoName)
+		}
+		placeholders = append(placeholders, placeholder)
+		insertArgs = append(insertArgs, insertArg)
+		insertDefaults = append(insertDefaults, fmt.Sprintf("%q", insertDefault))
+		if c.Name == "created_at" || (modelDef.Options.LockVersion && c.Name == LockVersionField) {
+			continue
+		}
+		if c.Field != nil && modelDef.Options.TenantField != "" && strings.EqualFold(c.Field.Name, modelDef.Options.TenantField) {
+			data.Tenant, data.TenantGoName = c.Name, c.GoName
+			continue
+		}
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", c.Name, len(updateArgs)+1))
+		updateArgs = append(updateArgs, valueArg)
+	}
+	if modelDef.Options.LockVersion {
+		assignments = append(assignments, LockVersionField+" = "+LockVersionField+" + 1")
+		data.LockVersion = true
+		data.LockVersionIndex = len(updateArgs) + 2
+	}
+
+	data.ColumnList = strings.Join(names, ", ")
+	data.ScanArgs = strings.Join(scanArgs, ", ")
+	data.InsertColumnList = strings.Join(insertNames, ", ")
+	data.InsertPlaceholders = strings.Join(placeholders, ", ")
+	data.InsertArgs = strings.Join(insertArgs, ", ")
+	data.ReturningColumnList = strings.Join(returning, ", ")
+	data.ReturningArgs = strings.Join(returningArgs, ", ")
+	data.DefaultedColumns = strings.Join(defaulted, ", ")
+	data.InsertDefaults = strings.Join(insertDefaults, ", ")
+	data.UpdateAssignments = strings.Join(assignments, ", ")
+	data.UpdateArgs = strings.Join(updateArgs, ", ")
+	data.UpdateIDIndex = len(updateArgs) + 1
+	data.TenantIndex = data.UpdateIDIndex + 1
+	if data.LockVersion {
+		data.TenantIndex++
+	}
+
+	batchReturning, batchReturningArgs := returning, returningArgs
+	if upsertColumns := UpsertColumns(modelDef); len(upsertColumns) > 0 {
+		batchReturning = append(append([]string{}, returning...), "created_at")
+		batchReturningArgs = append(append([]string{}, returningArgs...), "&m.CreatedAt")
+		var upserted []string
+		for _, name := range insertNames {
+			switch {
+			case name == "created_at" || containsString(upsertColumns, name) || name == data.Tenant:
+			case data.LockVersion && name == LockVersionField:
+				upserted = append(upserted, fmt.Sprintf("%s = %s.%s + 1", name, data.Table, name))
+				batchReturning = append(batchReturning, name)
+				batchReturningArgs = append(batchReturningArgs, "&m.Version")
+			default:
+				upserted = append(upserted, fmt.Sprintf("%s = EXCLUDED.%s", name, name))
+			}
+		}
+		data.UpsertColumnList = strings.Join(upsertColumns, ", ")
+		data.UpsertAssignments = strings.Join(upserted, ", ")
+	}
+	data.BatchReturningColumnList = strings.Join(batchReturning, ", ")
+	data.BatchReturningArgs = strings.Join(batchReturningArgs, ", ")
+
+	var entries, searchFields []string
+	for _, name := range modelDef.Options.SearchFields {
+		field := modelDef.Field(name)
+		if field == nil {
+			return data, fmt.Errorf("search field %s is not a field of model %s", name, modelDef.Name)
+		}
+		entries = append(entries, fmt.Sprintf("%q: m.%s", ColumnName(field), goFieldName(field.Name)))
+		searchFields = append(searchFields, field.Name)
+	}
+	data.SearchDocument = strings.Join(entries, ", ")
+	data.SearchFieldList = strings.Join(searchFields, ", ")
+
+	if modelDef.CacheEnabled() {
+		if err := checkCacheKey(modelDef, modelDef.Options.Cache.KeyStrategy); err != nil {
+			return data, err
+		}
+		data.Cache, data.CacheTTL, data.CacheKey = true, modelDef.Options.Cache.TTL, modelDef.Options.Cache.KeyStrategy
+	}
+
+	settings := sessionSettings(modelDef)
+	for i, setting := range settings {
+		settings[i] = fmt.Sprintf("%q", setting)
+	}
+	data.SessionSettings = strings.Join(settings, ", ")
+	return data, nil
+}
+
+// RenderRepositoryFile renders the repository for the given model definition. The file is placed next to the
+// generated model file.
+func RenderRepositoryFile(modelDef *ModelDefinition) (*GeneratedFile, error) {
+	data, err := newRepositoryData(modelDef)
+	if err != nil {
+		return nil, err
+	}
+	content, err := renderTemplate("repository", data)
+	if err != nil {
+		return nil, err
+	}
+	content, err = formatGo(content)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting repository: %w", err)
+	}
+
+	return &GeneratedFile{
+		Path:    path.Join(modelOutputDir(modelDef), strings.ToLower(modelDef.Name)+"_repository.go"),
+		Content: content,
+	}, nil
+}
+
+// modelOutputDir returns the slash-separated directory generated Go files for a model are written to.
+func modelOutputDir(modelDef *ModelDefinition) string {
+	if modelDef.OutputDir == "" {
+		return "models"
+	}
+	return filepath.ToSlash(modelDef.OutputDir)
+}
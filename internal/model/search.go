@@ -0,0 +1,146 @@
+package model
+
+import (
+	_ "embed"
+	"path"
+	"strings"
+)
+
+// searchBackendSource is the source of the searchbackend package, whose declarations the search support of the
+// generated models includes.
+//
+//go:embed searchbackend/backend.go
+var searchBackendSource string
+
+// searchTemplate is the source of the search support of the generated models, written next to the models
+// that have search fields, see SetSearchFields: the declarations below, then those of the searchbackend
+// package, the SearchBackend interface and its Meilisearch and Elasticsearch implementations, which "grayv-lsm
+// search reindex" indexes the same documents with. It has no template actions.
+var searchTemplate = searchSupportSource + packageDeclarations(searchBackendSource)
+
+// packageDeclarations returns the declarations of the source of a package, following its import block.
+func packageDeclarations(source string) string {
+	_, declarations, _ := strings.Cut(source, "\n)\n")
+	return declarations
+}
+
+// searchSupportSource is the part of searchTemplate syncing the indexes with the records of the repositories;
+// it imports the packages of searchBackendSource too.
+const searchSupportSource = `// Code generated by grayv-lsm. DO NOT EDIT.
+
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSearchDisabled is returned by the Search methods of repositories until EnableSearch is called.
+var ErrSearchDisabled = errors.New("search is not enabled")
+
+var (
+	searchMu      sync.RWMutex
+	searchBackend SearchBackend
+	// searchIndexes returns the document of a record of an indexed table, by table.
+	searchIndexes = make(map[string]func(record interface{}) map[string]interface{})
+)
+
+// registerSearchIndex declares the search index of a table, registered by the repositories of indexed models.
+func registerSearchIndex(table string, document func(record interface{}) map[string]interface{}) {
+	searchIndexes[table] = document
+}
+
+// EnableSearch makes the Search methods of repositories query backend, and keeps its indexes in sync with the
+// records repositories create, update and delete, by subscribing to their events. Records changed otherwise,
+// e.g. by migrations, are indexed again with "grayv-lsm search reindex". Indexing errors, such as the backend
+// being down, do not fail the repository operations: they are logged with logf, if set.
+func EnableSearch(backend SearchBackend, logf func(format string, args ...interface{})) (disable func()) {
+	searchMu.Lock()
+	searchBackend = backend
+	searchMu.Unlock()
+	unsubscribe := Subscribe(func(ctx context.Context, e Event) {
+		document, ok := searchIndexes[e.Table]
+		if !ok {
+			return
+		}
+		var err error
+		if e.Op == OpDelete {
+			err = backend.Delete(ctx, e.Table, []uint{e.ID})
+		} else {
+			err = backend.Index(ctx, e.Table, []map[string]interface{}{document(e.Record)})
+		}
+		if err != nil && logf != nil {
+			logf("search: indexing %s %d: %v", e.Table, e.ID, err)
+		}
+	})
+	return func() {
+		unsubscribe()
+		searchMu.Lock()
+		searchBackend = nil
+		searchMu.Unlock()
+	}
+}
+
+// searchIDs returns the IDs of the records of table matching query, best match first.
+func searchIDs(ctx context.Context, table, query string, limit int) ([]uint, error) {
+	searchMu.RLock()
+	backend := searchBackend
+	searchMu.RUnlock()
+	if backend == nil {
+		return nil, ErrSearchDisabled
+	}
+	return backend.Search(ctx, table, query, limit)
+}
+
+// sortByIDs orders the records in the order of ids, as returned by the search backend.
+func sortByIDs[T any](items []T, ids []uint, id func(T) uint) []T {
+	byID := make(map[uint]T, len(items))
+	for _, item := range items {
+		byID[id(item)] = item
+	}
+	sorted := make([]T, 0, len(items))
+	for _, i := range ids {
+		if item, ok := byID[i]; ok {
+			sorted = append(sorted, item)
+		}
+	}
+	return sorted
+}
+
+// SearchFromEnv returns the backend configured by the environment: SEARCH_BACKEND, "meilisearch" or
+// "elasticsearch", SEARCH_URL and SEARCH_API_KEY. It returns nil when SEARCH_URL is not set.
+func SearchFromEnv(getenv func(string) string) (SearchBackend, error) {
+	u := getenv("SEARCH_URL")
+	if u == "" {
+		return nil, nil
+	}
+	switch backend := getenv("SEARCH_BACKEND"); backend {
+	case "", "meilisearch":
+		return NewMeilisearch(u, getenv("SEARCH_API_KEY")), nil
+	case "elasticsearch":
+		return NewElasticsearch(u, getenv("SEARCH_API_KEY")), nil
+	default:
+		return nil, fmt.Errorf("invalid SEARCH_BACKEND %q: use meilisearch or elasticsearch", backend)
+	}
+}
+`
+
+// RenderSearchFile renders the search support of the models generated into the definition's output
+// directory: the SearchBackend interface, its Meilisearch and Elasticsearch implementations, and EnableSearch
+// syncing the indexes of the models with search fields. It is generated along these models, see
+// RenderModelFiles.
+func RenderSearchFile(modelDef *ModelDefinition) *GeneratedFile {
+	return &GeneratedFile{
+		Path:    path.Join(modelOutputDir(modelDef), "search.go"),
+		Content: []byte(templateSource("search")),
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderSearchFile(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{NewField("Title", "string", "", false, false)})
+	file := RenderSearchFile(def)
+	content := string(file.Content)
+	assert.Contains(t, content, "package models\n")
+	assert.Contains(t, content, "func EnableSearch(")
+	assert.Contains(t, content, packageDeclarations(searchBackendSource))
+	assert.NotContains(t, content, "package searchbackend")
+
+	// The imports of the generated file are those both parts of it use.
+	formatted, err := formatGo(file.Content)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(formatted))
+}
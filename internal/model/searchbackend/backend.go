@@ -0,0 +1,218 @@
+// Package searchbackend holds the clients of the Meilisearch and Elasticsearch servers indexing the records of
+// the models with search fields. "grayv-lsm search reindex" uses it, and its declarations, after the import
+// block, are also the source of the backends of the search support generated along these models, see
+// model.RenderSearchFile, so that both index documents the same way. It must therefore only use the packages it
+// imports, and declare nothing the generated models package declares.
+package searchbackend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchBackend indexes documents, maps of the search fields of a record and its "id", in one index per
+// table, and searches them.
+type SearchBackend interface {
+	// Index adds the documents to the index, replacing those with the same IDs.
+	Index(ctx context.Context, index string, docs []map[string]interface{}) error
+	// Delete removes the documents of the given IDs from the index.
+	Delete(ctx context.Context, index string, ids []uint) error
+	// Search returns the IDs of the documents of the index matching query, best match first.
+	Search(ctx context.Context, index, query string, limit int) ([]uint, error)
+}
+
+// searchClient sends the requests of a search backend.
+type searchClient struct {
+	url, apiKey string
+	// authScheme prefixes the API key in the Authorization header.
+	authScheme string
+	http       *http.Client
+}
+
+func newSearchClient(url, apiKey, authScheme string) *searchClient {
+	return &searchClient{url: strings.TrimSuffix(url, "/"), apiKey: apiKey, authScheme: authScheme, http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// do sends a request with a body of the given content type and decodes the JSON response into out, if set.
+// Responses with a status in ignore are not errors.
+func (c *searchClient) do(ctx context.Context, method, path, contentType string, body []byte, out interface{}, ignore ...int) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", c.authScheme+" "+c.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, status := range ignore {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	if resp.StatusCode >= 300 {
+		var message bytes.Buffer
+		message.ReadFrom(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(message.String()))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *searchClient) json(ctx context.Context, method, path string, in, out interface{}, ignore ...int) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, method, path, "application/json", body, out, ignore...)
+}
+
+// Meilisearch is a SearchBackend of a Meilisearch server, whose indexes are named like the tables. Its writes
+// are queued by the server and applied asynchronously.
+type Meilisearch struct {
+	client *searchClient
+}
+
+// NewMeilisearch creates a backend of the Meilisearch server at url, authenticated with apiKey if set.
+func NewMeilisearch(url, apiKey string) *Meilisearch {
+	return &Meilisearch{newSearchClient(url, apiKey, "Bearer")}
+}
+
+// Clear removes every document of the index.
+func (m *Meilisearch) Clear(ctx context.Context, index string) error {
+	return m.client.do(ctx, http.MethodDelete, "/indexes/"+url.PathEscape(index)+"/documents", "application/json", nil, nil)
+}
+
+// Index implements SearchBackend.
+func (m *Meilisearch) Index(ctx context.Context, index string, docs []map[string]interface{}) error {
+	return m.client.json(ctx, http.MethodPost, "/indexes/"+url.PathEscape(index)+"/documents?primaryKey=id", docs, nil)
+}
+
+// Delete implements SearchBackend.
+func (m *Meilisearch) Delete(ctx context.Context, index string, ids []uint) error {
+	return m.client.json(ctx, http.MethodPost, "/indexes/"+url.PathEscape(index)+"/documents/delete-batch", ids, nil)
+}
+
+// Search implements SearchBackend.
+func (m *Meilisearch) Search(ctx context.Context, index, query string, limit int) ([]uint, error) {
+	var result struct {
+		Hits []struct {
+			ID uint
+		}
+	}
+	request := map[string]interface{}{"q": query, "limit": limit, "attributesToRetrieve": []string{"id"}}
+	if err := m.client.json(ctx, http.MethodPost, "/indexes/"+url.PathEscape(index)+"/search", request, &result); err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(result.Hits))
+	for i, hit := range result.Hits {
+		ids[i] = hit.ID
+	}
+	return ids, nil
+}
+
+// Elasticsearch is a SearchBackend of an Elasticsearch or OpenSearch cluster, whose indexes are named like the
+// tables.
+type Elasticsearch struct {
+	client *searchClient
+}
+
+// NewElasticsearch creates a backend of the Elasticsearch cluster at url, authenticated with the API key
+// apiKey if set.
+func NewElasticsearch(url, apiKey string) *Elasticsearch {
+	return &Elasticsearch{newSearchClient(url, apiKey, "ApiKey")}
+}
+
+// bulk sends actions, each followed by its document if any, to the bulk API, and fails if any failed.
+func (e *Elasticsearch) bulk(ctx context.Context, lines []interface{}) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	var result struct {
+		Errors bool
+		Items  []map[string]struct {
+			Error json.RawMessage
+		}
+	}
+	if err := e.client.do(ctx, http.MethodPost, "/_bulk?refresh=wait_for", "application/x-ndjson", body.Bytes(), &result); err != nil {
+		return err
+	}
+	if result.Errors {
+		for _, item := range result.Items {
+			for action, status := range item {
+				if len(status.Error) > 0 {
+					return fmt.Errorf("elasticsearch %s: %s", action, status.Error)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Clear removes every document of the index. An index that does not exist yet is empty.
+func (e *Elasticsearch) Clear(ctx context.Context, index string) error {
+	query := map[string]interface{}{"query": map[string]interface{}{"match_all": struct{}{}}}
+	return e.client.json(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_delete_by_query?refresh=true", query, nil, http.StatusNotFound)
+}
+
+// Index implements SearchBackend.
+func (e *Elasticsearch) Index(ctx context.Context, index string, docs []map[string]interface{}) error {
+	var lines []interface{}
+	for _, doc := range docs {
+		action := map[string]string{"_index": index, "_id": fmt.Sprint(doc["id"])}
+		lines = append(lines, map[string]interface{}{"index": action}, doc)
+	}
+	return e.bulk(ctx, lines)
+}
+
+// Delete implements SearchBackend.
+func (e *Elasticsearch) Delete(ctx context.Context, index string, ids []uint) error {
+	var lines []interface{}
+	for _, id := range ids {
+		action := map[string]string{"_index": index, "_id": strconv.FormatUint(uint64(id), 10)}
+		lines = append(lines, map[string]interface{}{"delete": action})
+	}
+	return e.bulk(ctx, lines)
+}
+
+// Search implements SearchBackend.
+func (e *Elasticsearch) Search(ctx context.Context, index, query string, limit int) ([]uint, error) {
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			}
+		}
+	}
+	match := map[string]interface{}{"query": query}
+	request := map[string]interface{}{"size": limit, "_source": false, "query": map[string]interface{}{"multi_match": match}}
+	if err := e.client.json(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_search", request, &result); err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		id, err := strconv.ParseUint(hit.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document ID %q in index %s", hit.ID, index)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+// TemplateDir is the directory, relative to the project root, holding the templates that override the built-in
+// generation templates.
+const TemplateDir = ".grav/templates"
+
+// templateOverrides maps the names of built-in templates to the sources overriding them, see
+// LoadTemplateOverrides.
+var templateOverrides = map[string]string{}
+
+// templateFuncs are the functions available to every generation template, built-in or overriding.
+var templateFuncs = template.FuncMap{
+	"toLower": strings.ToLower,
+	"firstLetter": func(s string) string {
+		return strings.ToLower(s[:1])
+	},
+	"title":     goFieldName,
+	"goType":    fieldGoType,
+	"imports":   fieldImports,
+	"enums":     modelEnums,
+	"defaults":  fieldDefaults,
+	"tableName": TableName,
+	"camelCase": camelCase,
+	"plural":    Pluralize,
+	"sqlType":   templateSQLType,
+}
+
+// LoadTemplateOverrides reads the templates of TemplateDir in fsys, which replace the built-in templates of
+// the same name with a .tmpl extension, e.g. repository.tmpl, for every later rendering. Overrides are parsed
+// with the functions of the built-in templates, plus camelCase, plural and sqlType; model-base.tmpl and
+// kv-store.tmpl are copied as is. Overrides loaded before are dropped, so a missing directory restores the
+// built-in templates. It returns the names of the templates overridden, sorted.
+func LoadTemplateOverrides(fsys filesystem.FS) ([]string, error) {
+	entries, err := fsys.ReadDir(TemplateDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		templateOverrides = map[string]string{}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", TemplateDir, err)
+	}
+
+	overrides := map[string]string{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".tmpl")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		if _, builtIn := templateSources[name]; !builtIn {
+			return nil, fmt.Errorf("%s/%s overrides no template: use one of %s", TemplateDir, entry.Name(), strings.Join(sortedKeys(templateSources), ", "))
+		}
+		source, err := fsys.ReadFile(path.Join(TemplateDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if name != "model-base" && name != "kv-store" {
+			if _, err := template.New(name).Funcs(templateFuncs).Parse(string(source)); err != nil {
+				return nil, fmt.Errorf("failed to parse %s/%s: %w", TemplateDir, entry.Name(), err)
+			}
+		}
+		overrides[name] = string(source)
+	}
+	templateOverrides = overrides
+	return sortedKeys(overrides), nil
+}
+
+// templateSource returns the source of the named template: its override if one is loaded, and the built-in
+// template otherwise.
+func templateSource(name string) string {
+	if source, ok := templateOverrides[name]; ok {
+		return source
+	}
+	return templateSources[name]
+}
+
+// camelCase returns a name in camelCase: published_at becomes publishedAt, and UserID userID.
+func camelCase(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, part := range parts {
+		if i == 0 {
+			parts[i] = lowerFirst(part)
+		} else {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// templateSQLType returns the SQL type of the column storing a field, given as a Field, a *Field, or a Go type.
+func templateSQLType(field interface{}) (string, error) {
+	switch field := field.(type) {
+	case Field:
+		return columnSQLType(&field), nil
+	case *Field:
+		return columnSQLType(field), nil
+	case string:
+		return getSQLType(field), nil
+	default:
+		return "", fmt.Errorf("sqlType takes a field or a Go type, not %T", field)
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+func TestLoadTemplateOverrides(t *testing.T) {
+	defer LoadTemplateOverrides(filesystem.NewMemFS())
+
+	def := NewModelDefinition("Category", []Field{
+		NewField("display_name", "string", "", false, false),
+		NewField("score", "int", "", false, false),
+	})
+	builtIn := TemplateVersions(GeneratorGo)
+
+	fsys := filesystem.NewMemFS()
+	override := "package models\n\n// {{.Name}} is stored in {{plural (toLower .Name)}}.\n{{range .Fields}}" +
+		"// {{camelCase .Name}} {{sqlType .}}\n{{end}}type {{.Name}} struct{}\n"
+	assert.NoError(t, fsys.WriteFile(TemplateDir+"/model.tmpl", []byte(override), 0644))
+	assert.NoError(t, fsys.WriteFile(TemplateDir+"/README.md", []byte("notes"), 0644))
+	names, err := LoadTemplateOverrides(fsys)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"model"}, names)
+
+	file, err := RenderModelFile(def)
+	assert.NoError(t, err)
+	assert.Equal(t, "package models\n\n// Category is stored in categories.\n"+
+		"// displayName VARCHAR(255)\n// score INTEGER\ntype Category struct{}\n", string(file.Content))
+	assert.NotEqual(t, builtIn["model"], TemplateVersions(GeneratorGo)["model"])
+	assert.Equal(t, builtIn["repository"], TemplateVersions(GeneratorGo)["repository"])
+
+	assert.NoError(t, fsys.WriteFile(TemplateDir+"/handler.tmpl", []byte(""), 0644))
+	_, err = LoadTemplateOverrides(fsys)
+	assert.ErrorContains(t, err, "handler.tmpl overrides no template")
+
+	assert.NoError(t, fsys.Remove(TemplateDir+"/handler.tmpl"))
+	assert.NoError(t, fsys.WriteFile(TemplateDir+"/repository.tmpl", []byte("{{.Name"), 0644))
+	_, err = LoadTemplateOverrides(fsys)
+	assert.ErrorContains(t, err, "failed to parse .grav/templates/repository.tmpl")
+	file, err = RenderModelFile(def)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(file.Content), "Category is stored in categories"), "a failed load keeps the loaded overrides")
+
+	names, err = LoadTemplateOverrides(filesystem.NewMemFS())
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+	assert.Equal(t, builtIn, TemplateVersions(GeneratorGo))
+}
+
+func TestCamelCase(t *testing.T) {
+	assert.Equal(t, "publishedAt", camelCase("published_at"))
+	assert.Equal(t, "userID", camelCase("UserID"))
+	assert.Equal(t, "title", camelCase("title"))
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CustomType is a Go type, beyond the built-in ones, that model fields may have. Fields of the type are
+// declared with it in generated models, which import its package, and stored in columns of its SQL type. The
+// type must implement sql.Scanner and driver.Valuer unless database/sql handles it natively.
+type CustomType struct {
+	// Name is the type as written in field definitions, e.g. "decimal.Decimal", or an unqualified name for
+	// types declared in the package of the generated models.
+	Name string
+	// SQLType is the type of the columns storing values of the type, e.g. "NUMERIC(20,4)".
+	SQLType string
+	// Import is the import path of the package declaring the type, e.g. "github.com/shopspring/decimal". It
+	// may be omitted for unqualified names and for the packages of typePackages.
+	Import string
+}
+
+// customTypes are the registered custom types, by name.
+var customTypes = map[string]CustomType{}
+
+// builtinTypes are the types fields may have without being registered, besides vector(n) types and the
+// pointers and slices of any accepted type.
+var builtinTypes = map[string]bool{
+	"string": true, "bool": true, "byte": true, "rune": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+	"time.Time": true, "json.RawMessage": true,
+	"sql.NullString": true, "sql.NullBool": true, "sql.NullByte": true, "sql.NullInt16": true,
+	"sql.NullInt32": true, "sql.NullInt64": true, "sql.NullFloat64": true, "sql.NullTime": true,
+}
+
+// typeNamePattern matches the names of custom types: an identifier, optionally qualified by a package name.
+var typeNamePattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*\.)?[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RegisterType registers a custom field type. Registering a type again replaces its mapping.
+func RegisterType(t CustomType) error {
+	switch {
+	case !typeNamePattern.MatchString(t.Name):
+		return fmt.Errorf("invalid type name %q: expected a Go type name such as decimal.Decimal", t.Name)
+	case builtinTypes[t.Name]:
+		return fmt.Errorf("type %s is built in", t.Name)
+	case t.SQLType == "":
+		return fmt.Errorf("type %s has no SQL type", t.Name)
+	}
+	if qualifier, _, qualified := strings.Cut(t.Name, "."); qualified && t.Import == "" && typePackages[qualifier] == "" {
+		return fmt.Errorf("type %s needs the import path of package %s", t.Name, qualifier)
+	}
+	customTypes[t.Name] = t
+	return nil
+}
+
+// RegisteredTypes returns the registered custom types, sorted by name.
+func RegisteredTypes() []CustomType {
+	types := make([]CustomType, 0, len(customTypes))
+	for _, t := range customTypes {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// ValidateFieldType returns an error unless fields may have the given type: a built-in type, a registered
+// custom type, a pointer or slice of one of them, a vector(n) type, or an enum(a,b,...) type.
+func ValidateFieldType(fieldType string) error {
+	if _, ok := VectorDimensions(fieldType); ok {
+		return nil
+	}
+	if _, ok := EnumValues(fieldType); ok {
+		return nil
+	}
+	if strings.Contains(fieldType, "enum(") {
+		return fmt.Errorf("invalid enum type %q: expected enum(a,b,...) with distinct values starting with a letter", fieldType)
+	}
+	base := elementType(fieldType)
+	if base == "" {
+		return fmt.Errorf("invalid field type %q", fieldType)
+	}
+	if !builtinTypes[base] && customTypes[base].Name == "" {
+		return fmt.Errorf("unknown field type %s: register it as a custom type to use it", base)
+	}
+	return nil
+}
+
+// elementType strips the pointer and slice prefixes of a field type.
+func elementType(fieldType string) string {
+	for {
+		switch {
+		case strings.HasPrefix(fieldType, "*"):
+			fieldType = fieldType[1:]
+		case strings.HasPrefix(fieldType, "[]"):
+			fieldType = fieldType[2:]
+		default:
+			return fieldType
+		}
+	}
+}
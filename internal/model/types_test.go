@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func registerTestType(t *testing.T, custom CustomType) {
+	assert.NoError(t, RegisterType(custom))
+	t.Cleanup(func() { delete(customTypes, custom.Name) })
+}
+
+func TestRegisterType(t *testing.T) {
+	assert.Error(t, RegisterType(CustomType{Name: "decimal Decimal", SQLType: "NUMERIC"}))
+	assert.Error(t, RegisterType(CustomType{Name: "time.Time", SQLType: "TIMESTAMPTZ"}))
+	assert.Error(t, RegisterType(CustomType{Name: "Money"}))
+	assert.Error(t, RegisterType(CustomType{Name: "decimal.Decimal", SQLType: "NUMERIC"}), "qualified types need an import path")
+
+	registerTestType(t, CustomType{Name: "decimal.Decimal", SQLType: "NUMERIC(20,4)", Import: "github.com/shopspring/decimal"})
+	registerTestType(t, CustomType{Name: "Status", SQLType: "TEXT"})
+	assert.Equal(t, []string{"Status", "decimal.Decimal"}, func() []string {
+		var names []string
+		for _, custom := range RegisteredTypes() {
+			names = append(names, custom.Name)
+		}
+		return names
+	}())
+}
+
+func TestValidateFieldType(t *testing.T) {
+	registerTestType(t, CustomType{Name: "pq.StringArray", SQLType: "TEXT[]", Import: "github.com/lib/pq"})
+
+	for _, valid := range []string{"string", "*int64", "[]byte", "[]string", "time.Time", "sql.NullString", "vector(3)", "pq.StringArray", "*pq.StringArray"} {
+		assert.NoError(t, ValidateFieldType(valid), valid)
+	}
+	for _, invalid := range []string{"", "decimal.Decimal", "[]Money", "map[string]string"} {
+		assert.Error(t, ValidateFieldType(invalid), invalid)
+	}
+}
+
+func TestCustomTypeGeneration(t *testing.T) {
+	registerTestType(t, CustomType{Name: "decimal.Decimal", SQLType: "NUMERIC(20,4)", Import: "github.com/shopspring/decimal"})
+	registerTestType(t, CustomType{Name: "mysql.NullTime", SQLType: "TIMESTAMP", Import: "github.com/go-sql-driver/mysql"})
+
+	def := NewModelDefinition("Invoice", []Field{
+		NewField("Total", "decimal.Decimal", `json:"total"`, false, false),
+		NewField("Refunds", "[]decimal.Decimal", `json:"refunds"`, false, false),
+		NewField("PaidAt", "*mysql.NullTime", `json:"paidat"`, false, false),
+	})
+	migration := (&ModelManager{}).GenerateMigration(def)
+	assert.Contains(t, migration, "  total NUMERIC(20,4) NOT NULL,\n")
+	assert.Contains(t, migration, "  refunds NUMERIC(20,4)[] NOT NULL,\n")
+	assert.Contains(t, migration, "  paidat TIMESTAMP\n")
+
+	assert.Equal(t, []string{"github.com/go-sql-driver/mysql", "github.com/shopspring/decimal"}, fieldImports(def.Fields))
+	file, err := RenderModelFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(file.Content), "\t\"github.com/shopspring/decimal\"\n")
+	assert.Contains(t, string(file.Content), "Total   decimal.Decimal")
+}
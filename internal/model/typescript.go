@@ -0,0 +1,116 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// baseTypeScriptFields are the JSON fields contributed by the embedded DefaultModel of every generated model,
+// including its untagged Name field. They are emitted ahead of the model's own fields, see ownFields, so the
+// interface matches what the API serializes.
+var baseTypeScriptFields = []struct {
+	Name string
+	Type string
+}{
+	{"id", "number"},
+	{"created_at", "string"},
+	{"updated_at", "string"},
+	{"Name", "string"},
+}
+
+// RenderTypeScript renders a TypeScript declaration file (.d.ts) containing an exported interface for the given
+// model definition. Property names are the JSON names the generated Go model serializes, see JSONFieldName.
+// Nullable fields become optional and accept null. The file is written to outputDir, or to "types" when
+// outputDir is empty.
+func RenderTypeScript(modelDef *ModelDefinition, outputDir string) *GeneratedFile {
+	var b strings.Builder
+
+	b.WriteString("// Code generated by grayv-lsm. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "export interface %s {\n", modelDef.Name)
+	for _, base := range baseTypeScriptFields {
+		fmt.Fprintf(&b, "    %s: %s;\n", typeScriptPropertyName(base.Name), base.Type)
+	}
+	for _, field := range ownFields(modelDef) {
+		tsType := typeScriptType(field.Type)
+		optional := ""
+		if field.IsNull {
+			optional = "?"
+			if !strings.HasSuffix(tsType, "| null") {
+				tsType += " | null"
+			}
+		}
+		fmt.Fprintf(&b, "    %s%s: %s;\n", typeScriptPropertyName(JSONFieldName(field)), optional, tsType)
+	}
+	b.WriteString("}\n")
+
+	if outputDir == "" {
+		outputDir = "types"
+	}
+	return &GeneratedFile{
+		Path:    path.Join(filepath.ToSlash(outputDir), strings.ToLower(modelDef.Name)+".d.ts"),
+		Content: []byte(b.String()),
+	}
+}
+
+// JSONFieldName returns the JSON property name the generated Go model serializes a field under. The model
+// template always tags fields with json:"<lowercase name>" and does not use Field.Tag, so neither does this.
+func JSONFieldName(field Field) string {
+	return strings.ToLower(field.Name)
+}
+
+// typeScriptType maps a Go type expression to the TypeScript type of its JSON encoding. Enums map to a union of
+// their values. Unknown types map to unknown so that the declaration still compiles.
+func typeScriptType(goType string) string {
+	if _, ok := VectorDimensions(goType); ok {
+		return "number[]"
+	}
+	if values, ok := EnumValues(goType); ok {
+		literals := make([]string, len(values))
+		for i, value := range values {
+			literals[i] = fmt.Sprintf("%q", value)
+		}
+		return strings.Join(literals, " | ")
+	}
+	switch {
+	case strings.HasPrefix(goType, "*"):
+		return typeScriptType(goType[1:]) + " | null"
+	case goType == "[]byte":
+		return "string"
+	case strings.HasPrefix(goType, "[]"):
+		elem := typeScriptType(goType[2:])
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case strings.HasPrefix(goType, "map[string]"):
+		return "Record<string, " + typeScriptType(goType[len("map[string]"):]) + ">"
+	}
+
+	switch goType {
+	case "string", "time.Time":
+		return "string"
+	case "bool":
+		return "boolean"
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64":
+		return "number"
+	case "interface{}", "any", "json.RawMessage":
+		return "unknown"
+	default:
+		return "unknown"
+	}
+}
+
+// typeScriptPropertyName quotes a property name when it is not a valid TypeScript identifier.
+func typeScriptPropertyName(name string) string {
+	for i, r := range name {
+		isLetter := r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (i == 0 || r < '0' || r > '9') {
+			return fmt.Sprintf("%q", name)
+		}
+	}
+	return name
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTypeScript(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{
+		NewField("Title", "string", `json:"title"`, false, false),
+		NewField("AuthorID", "int", `json:"authorId"`, false, false),
+		NewField("Summary", "string", `json:"summary"`, true, false),
+		NewField("Tags", "[]string", `json:"tags,omitempty"`, false, false),
+		NewField("PublishedAt", "*time.Time", "", false, false),
+	})
+
+	file := RenderTypeScript(def, "")
+	assert.Equal(t, "types/post.d.ts", file.Path)
+	// Property names follow the json tags the model template emits, not Field.Tag.
+	assert.Equal(t, `// Code generated by grayv-lsm. DO NOT EDIT.
+
+export interface Post {
+    id: number;
+    created_at: string;
+    updated_at: string;
+    Name: string;
+    title: string;
+    authorid: number;
+    summary?: string | null;
+    tags: string[];
+    publishedat: string | null;
+}
+`, string(file.Content))
+
+	// The property names must be exactly the json tags of the generated Go model.
+	goFile, err := RenderModelFile(def)
+	assert.NoError(t, err)
+	for _, field := range def.Fields {
+		assert.Contains(t, string(goFile.Content), "`json:\""+JSONFieldName(field)+"\"`")
+	}
+}
+
+func TestRenderTypeScript_BaseFieldsWin(t *testing.T) {
+	def := NewModelDefinition("Post", []Field{
+		NewField("ID", "string", "", false, true),
+		NewField("CreatedAt", "*time.Time", "", false, false),
+		NewField("Title", "string", "", false, false),
+	})
+
+	assert.Equal(t, `// Code generated by grayv-lsm. DO NOT EDIT.
+
+export interface Post {
+    id: number;
+    created_at: string;
+    updated_at: string;
+    Name: string;
+    title: string;
+}
+`, string(RenderTypeScript(def, "").Content))
+
+	// The Go model omits the same fields.
+	goFile, err := RenderModelFile(def)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(goFile.Content), `json:"id"`)
+	assert.NotContains(t, string(goFile.Content), `json:"createdat"`)
+}
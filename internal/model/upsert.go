@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetUpsertKeys sets the fields identifying the model's records for upserts, or removes them when names is
+// empty. The generated repository of a model with upsert keys has Upsert and UpsertBatch methods, which update
+// the record conflicting on the keys instead of failing, and the table a unique index on their columns, see
+// UpsertColumns. Encrypted fields cannot be keys, as their stored values differ for equal values.
+func (m *ModelDefinition) SetUpsertKeys(names []string) error {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		field := m.Field(name)
+		if field == nil {
+			return fmt.Errorf("model %s has no field %s", m.Name, name)
+		}
+		if field.Encrypted {
+			return fmt.Errorf("field %s of model %s is encrypted and cannot be an upsert key", field.Name, m.Name)
+		}
+		if strings.HasPrefix(field.Type, "map[") || isArrayType(field.Type) {
+			return fmt.Errorf("field %s of type %s cannot be an upsert key", field.Name, field.Type)
+		}
+		if _, ok := VectorDimensions(field.Type); ok {
+			return fmt.Errorf("field %s of type %s cannot be an upsert key", field.Name, field.Type)
+		}
+		keys = append(keys, field.Name)
+	}
+	m.Options.UpsertKeys = nil
+	if len(keys) > 0 {
+		m.Options.UpsertKeys = keys
+	}
+	return nil
+}
+
+// UpsertColumns returns the columns of the conflict target of the model's upserts: the columns of its upsert
+// keys, preceded by the tenant column of models scoped to tenants so that an upsert never updates the record
+// of another tenant. It returns nil if the model has no upsert keys.
+func UpsertColumns(m *ModelDefinition) []string {
+	if len(m.Options.UpsertKeys) == 0 {
+		return nil
+	}
+	var columns []string
+	if m.Options.TenantField != "" {
+		if tenant := m.Field(m.Options.TenantField); tenant != nil {
+			columns = append(columns, ColumnName(tenant))
+		}
+	}
+	for _, name := range m.Options.UpsertKeys {
+		field := m.Field(name)
+		if field == nil {
+			continue
+		}
+		if column := ColumnName(field); !containsString(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// UpsertIndexMigration returns the statement creating the unique index the upserts of the model conflict on,
+// or "" if the model has no upsert keys.
+func UpsertIndexMigration(m *ModelDefinition) string {
+	columns := UpsertColumns(m)
+	if len(columns) == 0 {
+		return ""
+	}
+	table := TableName(m)
+	return fmt.Sprintf("CREATE UNIQUE INDEX %s_%s_key ON %s (%s);\n", table, strings.Join(columns, "_"), table,
+		strings.Join(columns, ", "))
+}
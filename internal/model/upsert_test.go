@@ -0,0 +1,53 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetUpsertKeys(t *testing.T) {
+	def := NewModelDefinition("Product", []Field{
+		NewField("SKU", "string", "", false, false),
+		NewField("Tags", "[]string", "", false, false),
+		NewField("Secret", "string", "", false, false),
+	})
+	require.NoError(t, def.EncryptField("secret"))
+
+	assert.EqualError(t, def.SetUpsertKeys([]string{"code"}), "model Product has no field code")
+	assert.EqualError(t, def.SetUpsertKeys([]string{"tags"}), "field Tags of type []string cannot be an upsert key")
+	assert.EqualError(t, def.SetUpsertKeys([]string{"secret"}), "field Secret of model Product is encrypted and cannot be an upsert key")
+	assert.Nil(t, UpsertColumns(def))
+	assert.Empty(t, UpsertIndexMigration(def))
+
+	require.NoError(t, def.SetUpsertKeys([]string{"sku"}))
+	assert.Equal(t, []string{"SKU"}, def.Options.UpsertKeys)
+	assert.Equal(t, []string{"sku"}, UpsertColumns(def))
+	require.NoError(t, def.SetTenantField("tenant_id"))
+	assert.Equal(t, []string{"tenant_id", "sku"}, UpsertColumns(def), "upserts never cross tenants")
+	assert.Contains(t, NewModelManager().GenerateMigration(def),
+		"CREATE UNIQUE INDEX products_tenant_id_sku_key ON products (tenant_id, sku);\n")
+
+	require.NoError(t, def.SetUpsertKeys(nil))
+	assert.Nil(t, def.Options.UpsertKeys)
+}
+
+func TestRenderRepositoryFile_Batches(t *testing.T) {
+	def := NewModelDefinition("Product", []Field{
+		NewField("SKU", "string", "", false, false),
+		NewField("Price", "float64", "", false, false),
+	})
+	file, err := RenderRepositoryFile(def)
+	require.NoError(t, err)
+	content := string(file.Content)
+	assert.Contains(t, content, "func (r *ProductRepository) CreateBatch(ctx context.Context, ms []*Product) error {")
+	assert.NotContains(t, content, "Upsert")
+
+	require.NoError(t, def.SetUpsertKeys([]string{"sku"}))
+	file, err = RenderRepositoryFile(def)
+	require.NoError(t, err)
+	content = string(file.Content)
+	assert.Contains(t, content, "func (r *ProductRepository) UpsertBatch(ctx context.Context, ms []*Product) error {")
+	assert.Contains(t, content, `" ON CONFLICT (sku) DO UPDATE SET updated_at = EXCLUDED.updated_at, price = EXCLUDED.price RETURNING id, created_at, xmax = 0"`)
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// vectorGoType is the Go type of vector fields. It is declared by the base file generated next to the models
+// and holds the components of a pgvector vector.
+const vectorGoType = "Vector"
+
+// vectorMetric describes a pgvector distance metric.
+type vectorMetric struct {
+	operator      string // distance operator used to order nearest-neighbor queries
+	operatorClass string // operator class of the HNSW index supporting the operator
+}
+
+// vectorMetrics are the distance metrics vector fields can be indexed and searched with, by name.
+var vectorMetrics = map[string]vectorMetric{
+	"l2":            {operator: "<->", operatorClass: "vector_l2_ops"},
+	"cosine":        {operator: "<=>", operatorClass: "vector_cosine_ops"},
+	"inner_product": {operator: "<#>", operatorClass: "vector_ip_ops"},
+}
+
+// VectorDimensions reports whether fieldType is a pgvector type of the form "vector(n)" and returns n.
+func VectorDimensions(fieldType string) (int, bool) {
+	if !strings.HasPrefix(fieldType, "vector(") || !strings.HasSuffix(fieldType, ")") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(fieldType[len("vector(") : len(fieldType)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// fieldGoType returns the Go type of the struct field generated for a field of the named model.
+func fieldGoType(modelName string, field Field) string {
+	if _, ok := VectorDimensions(field.Type); ok {
+		return vectorGoType
+	}
+	if _, ok := EnumValues(field.Type); ok {
+		return enumTypeName(modelName, field)
+	}
+	return field.Type
+}
+
+// IndexVectorField adds an HNSW index on the column of the named vector field of the model, supporting
+// nearest-neighbor queries with the given distance metric: "l2", "cosine" or "inner_product".
+func (m *ModelDefinition) IndexVectorField(name, metric string) error {
+	field := m.Field(name)
+	if field == nil {
+		return fmt.Errorf("model %s has no field %s", m.Name, name)
+	}
+	if _, ok := VectorDimensions(field.Type); !ok {
+		return fmt.Errorf("field %s of type %s is not a vector field", name, field.Type)
+	}
+	if _, ok := vectorMetrics[metric]; !ok {
+		return fmt.Errorf("unknown distance metric %q (expected one of %s)", metric, strings.Join(VectorMetrics(), ", "))
+	}
+	field.Indexed = true
+	field.VectorMetric = metric
+	return nil
+}
+
+// VectorMetrics returns the names of the supported distance metrics, sorted.
+func VectorMetrics() []string {
+	names := make([]string, 0, len(vectorMetrics))
+	for name := range vectorMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// vectorIndex returns the statement creating the HNSW index of an indexed vector field. Fields indexed without
+// a metric use the L2 distance.
+func vectorIndex(table, column string, field *Field) string {
+	metric, ok := vectorMetrics[field.VectorMetric]
+	if !ok {
+		metric = vectorMetrics["l2"]
+	}
+	return fmt.Sprintf("CREATE INDEX %s_%s_idx ON %s USING hnsw (%s %s);\n", table, column, table, column, metric.operatorClass)
+}
+
+// hasVectorFields reports whether any own field of the model is a vector field.
+func hasVectorFields(modelDef *ModelDefinition) bool {
+	for _, field := range ownFields(modelDef) {
+		if _, ok := VectorDimensions(field.Type); ok {
+			return true
+		}
+	}
+	return false
+}
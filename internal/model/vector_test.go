@@ -0,0 +1,50 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVectorDimensions(t *testing.T) {
+	n, ok := VectorDimensions("vector(1536)")
+	assert.True(t, ok)
+	assert.Equal(t, 1536, n)
+
+	for _, fieldType := range []string{"vector", "vector()", "vector(0)", "vector(x)", "[]float32"} {
+		_, ok := VectorDimensions(fieldType)
+		assert.False(t, ok, fieldType)
+	}
+}
+
+func TestVectorFields(t *testing.T) {
+	def := NewModelDefinition("Document", []Field{
+		NewField("Title", "string", "", false, false),
+		NewField("Embedding", "vector(3)", "", false, false),
+	})
+	assert.Error(t, def.IndexVectorField("title", "cosine"))
+	assert.Error(t, def.IndexVectorField("embedding", "manhattan"))
+	assert.NoError(t, def.IndexVectorField("embedding", "cosine"))
+
+	migration := (&ModelManager{}).GenerateMigration(def)
+	assert.True(t, strings.HasPrefix(migration, "CREATE EXTENSION IF NOT EXISTS vector;\nCREATE TABLE documents ("))
+	assert.Contains(t, migration, "  embedding vector(3) NOT NULL\n")
+	assert.Contains(t, migration, "CREATE INDEX documents_embedding_idx ON documents USING hnsw (embedding vector_cosine_ops);\n")
+
+	modelFile, err := RenderModelFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(modelFile.Content), "Embedding Vector `json:\"embedding\"`")
+
+	repository, err := RenderRepositoryFile(def)
+	assert.NoError(t, err)
+	assert.Contains(t, string(repository.Content),
+		"func (r *DocumentRepository) NearestByEmbedding(ctx context.Context, v Vector, metric DistanceMetric, limit int) ([]*Document, error) {")
+	assert.Contains(t, string(repository.Content), `"SELECT "+documentColumns+" FROM documents ORDER BY embedding "+operator+" $1 LIMIT $2", v, limit`)
+
+	AssignProtoNumbers(def)
+	message, err := RenderProto(def, "", "models", "")
+	assert.NoError(t, err)
+	assert.Contains(t, string(message.Content), "repeated float embedding = 5;")
+	assert.Contains(t, string(RenderTypeScript(def, "").Content), "embedding: number[];")
+}
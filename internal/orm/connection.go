@@ -3,37 +3,101 @@ package orm
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/ooyeku/grayv-lsm/pkg/config"
 )
 
 type Connection struct {
-	db *sql.DB
+	db     *sql.DB
+	stmts  *StatementCache
+	driver string
 }
 
 func NewConnection(cfg *config.DatabaseConfig) (*Connection, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
+	dsn, err := connectionString(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var slowThreshold time.Duration
+	if cfg.SlowQueryThreshold != "" {
+		if slowThreshold, err = time.ParseDuration(cfg.SlowQueryThreshold); err != nil {
+			return nil, fmt.Errorf("invalid Database.SlowQueryThreshold: %w", err)
+		}
+	}
 
 	db, err := sql.Open(cfg.Driver, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	return &Connection{db: db}, nil
+	size := cfg.StatementCacheSize
+	if size == 0 {
+		size = DefaultStatementCacheSize
+	}
+	stmts := NewStatementCache(db, size)
+	stmts.slowThreshold = slowThreshold
+	return &Connection{db: db, stmts: stmts, driver: cfg.Driver}, nil
+}
+
+// connectionString returns the libpq connection string of the database, whose values are quoted, as the
+// passwords kept in secret stores may hold spaces, quotes or backslashes.
+func connectionString(cfg *config.DatabaseConfig) (string, error) {
+	params := []string{
+		"host=" + quoteConnValue(cfg.Host),
+		"port=" + strconv.Itoa(cfg.Port),
+		"user=" + quoteConnValue(cfg.User),
+		"password=" + quoteConnValue(cfg.Password),
+		"dbname=" + quoteConnValue(cfg.Name),
+		"sslmode=" + quoteConnValue(cfg.SSLMode),
+	}
+	if cfg.StatementTimeout != "" {
+		timeout, err := time.ParseDuration(cfg.StatementTimeout)
+		if err != nil {
+			return "", fmt.Errorf("invalid Database.StatementTimeout: %w", err)
+		}
+		// Parameters the driver does not know are set on every session it opens.
+		params = append(params, fmt.Sprintf("statement_timeout=%d", timeout.Milliseconds()))
+	}
+	return strings.Join(params, " "), nil
+}
+
+// quoteConnValue quotes a value of a libpq connection string, escaping its quotes and backslashes.
+func quoteConnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
 
 func (c *Connection) Close() error {
+	if c.db == nil {
+		return nil
+	}
+	if c.stmts != nil {
+		c.stmts.Close()
+	}
 	return c.db.Close()
 }
 
+// Statements returns the cache of the statements prepared by the CRUD operations of the connection, whose
+// Stats report its hit rate.
+func (c *Connection) Statements() *StatementCache {
+	return c.stmts
+}
+
 func (c *Connection) Ping() error {
 	return c.db.Ping()
 }
 
 func (c *Connection) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return c.db.Query(query, args...)
+	start := time.Now()
+	rows, err := c.db.Query(query, args...)
+	if c.stmts != nil {
+		observe(c.stmts.slowThreshold, query, start, err)
+	}
+	return rows, err
 }
 
 func (c *Connection) GetDB() *sql.DB {
@@ -73,14 +137,14 @@ func (c *Connection) CountTables() (int, error) {
 }
 
 type DatabaseMetrics struct {
-	TableCount        int
-	DatabaseSize      string
-	ActiveConnections int
-	Uptime            string
-	Commits           int
-	Rollbacks         int
-	CacheHitRatio     float64
-	SlowQueryCount    int
+	TableCount        int     `json:"table_count"`
+	DatabaseSize      string  `json:"database_size"`
+	ActiveConnections int     `json:"active_connections"`
+	Uptime            string  `json:"uptime"`
+	Commits           int     `json:"commits"`
+	Rollbacks         int     `json:"rollbacks"`
+	CacheHitRatio     float64 `json:"cache_hit_ratio"`
+	SlowQueryCount    int     `json:"slow_query_count"`
 }
 
 func (c *Connection) GetDatabaseMetrics() (*DatabaseMetrics, error) {
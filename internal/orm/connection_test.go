@@ -0,0 +1,33 @@
+package orm
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConnection_StatementTimeout(t *testing.T) {
+	_, err := NewConnection(&config.DatabaseConfig{Driver: "postgres", StatementTimeout: "30"})
+	assert.ErrorContains(t, err, "invalid Database.StatementTimeout")
+
+	conn, err := NewConnection(&config.DatabaseConfig{Driver: "postgres", StatementTimeout: "30s"})
+	require.NoError(t, err)
+	assert.NoError(t, conn.Close())
+}
+
+func TestConnectionString(t *testing.T) {
+	dsn, err := connectionString(&config.DatabaseConfig{Host: "localhost", Port: 5432, User: "app",
+		Password: `p@ss word' sslmode=disable \x`, Name: "app", SSLMode: "require", StatementTimeout: "2s"})
+	require.NoError(t, err)
+	assert.Equal(t, `host='localhost' port=5432 user='app' password='p@ss word\' sslmode=disable \\x' `+
+		`dbname='app' sslmode='require' statement_timeout=2000`, dsn)
+	_, err = pq.NewConnector(dsn)
+	assert.NoError(t, err)
+
+	dsn, err = connectionString(&config.DatabaseConfig{Port: 5432})
+	require.NoError(t, err)
+	assert.Equal(t, "host='' port=5432 user='' password='' dbname='' sslmode=''", dsn)
+}
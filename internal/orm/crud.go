@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -8,7 +9,8 @@ import (
 	"github.com/ooyeku/grayv-lsm/internal/model"
 )
 
-// CRUD provides basic CRUD operations for models
+// CRUD provides basic CRUD operations for models. Its statements are prepared once per query text and reused,
+// see Connection.Statements.
 type CRUD struct {
 	conn *Connection
 }
@@ -37,7 +39,7 @@ func (c *CRUD) Create(m model.ModelInterface) error {
 	q := NewQuery(m.TableName()).Insert(fields...)
 	query, _ := q.Build()
 
-	_, err := c.conn.db.Exec(query, values...)
+	_, err := c.conn.stmts.Exec(context.Background(), query, values...)
 	return err
 }
 
@@ -46,7 +48,7 @@ func (c *CRUD) Read(m model.ModelInterface, id interface{}) error {
 	q := NewQuery(m.TableName()).Where(fmt.Sprintf("%s = ?", m.PrimaryKey()), id)
 	query, params := q.Build()
 
-	row := c.conn.db.QueryRow(query, params...)
+	row := c.conn.stmts.QueryRow(context.Background(), query, params...)
 
 	v := reflect.ValueOf(m).Elem()
 	fields := make([]interface{}, v.NumField())
@@ -78,7 +80,7 @@ func (c *CRUD) Update(m model.ModelInterface) error {
 	query, _ := q.Build()
 
 	values = append(values, id)
-	_, err := c.conn.db.Exec(query, values...)
+	_, err := c.conn.stmts.Exec(context.Background(), query, values...)
 	return err
 }
 
@@ -87,16 +89,16 @@ func (c *CRUD) Delete(m model.ModelInterface, id interface{}) error {
 	q := NewQuery(m.TableName()).Delete().Where(fmt.Sprintf("%s = ?", m.PrimaryKey()), id)
 	query, params := q.Build()
 
-	_, err := c.conn.db.Exec(query, params...)
+	_, err := c.conn.stmts.Exec(context.Background(), query, params...)
 	return err
 }
 
 // Query executes a custom query and returns the rows
 func (c *CRUD) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return c.conn.db.Query(query, args...)
+	return c.conn.stmts.Query(context.Background(), query, args...)
 }
 
 // Exec executes a custom query without returning any rows
 func (c *CRUD) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return c.conn.db.Exec(query, args...)
+	return c.conn.stmts.Exec(context.Background(), query, args...)
 }
@@ -0,0 +1,89 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ExplainOptions control the plan returned by Explain.
+type ExplainOptions struct {
+	// Analyze runs the statement to report the actual times and rows of the plan. Statements other than
+	// queries run in a transaction that is rolled back.
+	Analyze bool
+	// JSON returns the plan as indented JSON rather than text.
+	JSON bool
+}
+
+// Explain returns the execution plan of a statement as PostgreSQL formats it with EXPLAIN.
+func (c *Connection) Explain(ctx context.Context, statement string, options ExplainOptions) (string, error) {
+	statement = strings.TrimRight(strings.TrimSpace(statement), ";")
+	if statement == "" {
+		return "", fmt.Errorf("no statement to explain")
+	}
+	explain, err := explainStatement(c.driver, statement, options)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	// EXPLAIN ANALYZE runs the statement, whose writes must not be kept.
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, explain)
+	if err != nil {
+		return "", fmt.Errorf("failed to explain the statement: %w", err)
+	}
+	defer rows.Close()
+	plan, err := formatPlan(rows)
+	if err != nil {
+		return "", err
+	}
+	if options.JSON {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(plan), "", "  "); err == nil {
+			plan = indented.String()
+		}
+	}
+	return plan, nil
+}
+
+// explainStatement returns the statement explaining statement on the database of driver, which must be
+// PostgreSQL, the only database connections are opened to.
+func explainStatement(driver, statement string, options ExplainOptions) (string, error) {
+	if driver != "postgres" && driver != "" {
+		return "", fmt.Errorf("cannot explain statements of the %s driver", driver)
+	}
+	explainOptions := []string{}
+	if options.Analyze {
+		explainOptions = append(explainOptions, "ANALYZE", "BUFFERS")
+	}
+	if options.JSON {
+		explainOptions = append(explainOptions, "FORMAT JSON")
+	}
+	if len(explainOptions) == 0 {
+		return "EXPLAIN " + statement, nil
+	}
+	return "EXPLAIN (" + strings.Join(explainOptions, ", ") + ") " + statement, nil
+}
+
+// formatPlan returns the rows of a plan as text, one line per row of its single QUERY PLAN column.
+func formatPlan(rows *sql.Rows) (string, error) {
+	var lines []string
+	for rows.Next() {
+		var line sql.NullString
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line.String)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
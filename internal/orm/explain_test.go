@@ -0,0 +1,40 @@
+package orm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainStatement(t *testing.T) {
+	tests := []struct {
+		driver  string
+		options ExplainOptions
+		want    string
+		wantErr string
+	}{
+		{driver: "postgres", want: "EXPLAIN SELECT 1"},
+		{driver: "postgres", options: ExplainOptions{Analyze: true, JSON: true}, want: "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) SELECT 1"},
+		{driver: "mysql", wantErr: "cannot explain statements of the mysql driver"},
+	}
+	for _, tt := range tests {
+		got, err := explainStatement(tt.driver, "SELECT 1", tt.options)
+		if tt.wantErr != "" {
+			assert.EqualError(t, err, tt.wantErr, tt.driver)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestFormatPlan(t *testing.T) {
+	rows, err := openFake(t).Query("plan")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer rows.Close()
+	plan, err := formatPlan(rows)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", plan)
+}
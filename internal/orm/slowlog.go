@@ -0,0 +1,28 @@
+package orm
+
+import (
+	"time"
+)
+
+// SlowQuery is a statement of a connection that ran for longer than its slow query threshold. Elapsed is the
+// time until the statement returned, and for queries until their first rows were returned.
+type SlowQuery struct {
+	Query   string
+	Elapsed time.Duration
+	Err     error
+}
+
+// SlowQueryHook receives the slow queries of the connections configured with a slow query threshold. It is
+// nil, ignoring them, until a program sets it, e.g. to log them.
+var SlowQueryHook func(SlowQuery)
+
+// observe passes a statement started at start to SlowQueryHook if it ran for longer than threshold. A
+// threshold of 0 or less disables it.
+func observe(threshold time.Duration, query string, start time.Time, err error) {
+	if threshold <= 0 || SlowQueryHook == nil {
+		return
+	}
+	if elapsed := time.Since(start); elapsed > threshold {
+		SlowQueryHook(SlowQuery{Query: query, Elapsed: elapsed, Err: err})
+	}
+}
@@ -0,0 +1,32 @@
+package orm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowQueryHook(t *testing.T) {
+	var slow []SlowQuery
+	SlowQueryHook = func(q SlowQuery) { slow = append(slow, q) }
+	defer func() { SlowQueryHook = nil }()
+
+	cache := NewStatementCache(openFake(t), 2)
+	defer cache.Close()
+	ctx := context.Background()
+	_, err := cache.Exec(ctx, "slow")
+	require.NoError(t, err)
+	assert.Empty(t, slow, "statements are not timed without a threshold")
+
+	cache.slowThreshold = 5 * time.Millisecond
+	for _, query := range []string{"a", "slow"} {
+		_, err := cache.Exec(ctx, query)
+		require.NoError(t, err)
+	}
+	require.Len(t, slow, 1)
+	assert.Equal(t, "slow", slow[0].Query)
+	assert.GreaterOrEqual(t, slow[0].Elapsed, 10*time.Millisecond)
+}
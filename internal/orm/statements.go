@@ -0,0 +1,177 @@
+package orm
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// DefaultStatementCacheSize is the number of prepared statements a connection keeps unless its configuration
+// sets another size.
+const DefaultStatementCacheSize = 256
+
+// StatementStats counts the statements run through a StatementCache. Evictions counts the statements closed to
+// make room, or because running them failed.
+type StatementStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Size      int   `json:"size"`
+}
+
+// HitRate returns the share of the statements run with a statement prepared earlier.
+func (s StatementStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// StatementCache keeps the statements prepared on a database by query text, so that running a query again
+// reuses its statement rather than preparing it anew. It holds up to its size statements and closes the least
+// recently used one to make room.
+type StatementCache struct {
+	db   *sql.DB
+	size int
+	// slowThreshold is the duration past which statements are passed to SlowQueryHook.
+	slowThreshold time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // of *cachedStatement, most recently used first
+	stats   StatementStats
+}
+
+type cachedStatement struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+// NewStatementCache returns a cache of up to size statements prepared on db. A size of 0 or less disables it.
+func NewStatementCache(db *sql.DB, size int) *StatementCache {
+	return &StatementCache{db: db, size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Prepare returns the statement of query, preparing it unless it is cached. It returns nil, and no error,
+// when the cache is disabled.
+func (c *StatementCache) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if c.size <= 0 {
+		return nil, nil
+	}
+	c.mu.Lock()
+	if e, ok := c.entries[query]; ok {
+		c.order.MoveToFront(e)
+		c.stats.Hits++
+		c.mu.Unlock()
+		return e.Value.(*cachedStatement).stmt, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// Prepare outside the lock: a query prepared concurrently is cached once, and the other statement closed.
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[query]; ok {
+		stmt.Close()
+		c.order.MoveToFront(e)
+		return e.Value.(*cachedStatement).stmt, nil
+	}
+	c.entries[query] = c.order.PushFront(&cachedStatement{query: query, stmt: stmt})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return stmt, nil
+}
+
+// Evict closes the statement of query, for instance after running it failed because the table it reads
+// changed.
+func (c *StatementCache) Evict(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[query]; ok {
+		c.remove(e)
+	}
+}
+
+func (c *StatementCache) remove(e *list.Element) {
+	entry := c.order.Remove(e).(*cachedStatement)
+	delete(c.entries, entry.query)
+	entry.stmt.Close()
+	c.stats.Evictions++
+}
+
+// Stats returns the counts of the cache.
+func (c *StatementCache) Stats() StatementStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.order.Len()
+	return stats
+}
+
+// Close closes every cached statement.
+func (c *StatementCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.entries {
+		e.Value.(*cachedStatement).stmt.Close()
+	}
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Exec runs query with a cached statement, or directly on the database when the cache is disabled.
+func (c *StatementCache) Exec(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
+	defer func(start time.Time) { observe(c.slowThreshold, query, start, err) }(time.Now())
+	stmt, err := c.Prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return c.db.ExecContext(ctx, query, args...)
+	}
+	result, err = stmt.ExecContext(ctx, args...)
+	if err != nil {
+		c.Evict(query)
+	}
+	return result, err
+}
+
+// Query runs query with a cached statement, or directly on the database when the cache is disabled.
+func (c *StatementCache) Query(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	defer func(start time.Time) { observe(c.slowThreshold, query, start, err) }(time.Now())
+	stmt, err := c.Prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return c.db.QueryContext(ctx, query, args...)
+	}
+	rows, err = stmt.QueryContext(ctx, args...)
+	if err != nil {
+		c.Evict(query)
+	}
+	return rows, err
+}
+
+// QueryRow runs query with a cached statement, or directly on the database when the cache is disabled. Errors
+// are deferred to the Scan of the row, as with sql.DB.
+func (c *StatementCache) QueryRow(ctx context.Context, query string, args ...interface{}) (row *sql.Row) {
+	defer func(start time.Time) { observe(c.slowThreshold, query, start, row.Err()) }(time.Now())
+	stmt, err := c.Prepare(ctx, query)
+	if stmt == nil || err != nil {
+		// A statement that cannot be prepared reports its error from the row of the unprepared query.
+		return c.db.QueryRowContext(ctx, query, args...)
+	}
+	row = stmt.QueryRowContext(ctx, args...)
+	if row.Err() != nil {
+		c.Evict(query)
+	}
+	return row
+}
@@ -0,0 +1,126 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// prepares counts the statements prepared by the fake driver, which fails the statements of "fail" and takes
+// 10ms to run those of "slow".
+var prepares atomic.Int64
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	prepares.Add(1)
+	return fakeStmt{query: query}, nil
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt struct{ query string }
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if s.query == "fail" {
+		return nil, errors.New("failed")
+	}
+	if s.query == "slow" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return driver.RowsAffected(1), nil
+}
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) { return &fakeRows{}, nil }
+
+type fakeRows struct{ done bool }
+
+func (*fakeRows) Columns() []string { return []string{"n"} }
+func (*fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func init() {
+	sql.Register("orm_fake", fakeDriver{})
+}
+
+func openFake(t *testing.T) *sql.DB {
+	db, err := sql.Open("orm_fake", "")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestStatementCache_ReusesStatements(t *testing.T) {
+	cache := NewStatementCache(openFake(t), 2)
+	defer cache.Close()
+	ctx := context.Background()
+	before := prepares.Load()
+
+	for i := 0; i < 3; i++ {
+		_, err := cache.Exec(ctx, "a")
+		require.NoError(t, err)
+	}
+	var n int
+	require.NoError(t, cache.QueryRow(ctx, "b").Scan(&n))
+	assert.Equal(t, 1, n)
+
+	stats := cache.Stats()
+	assert.Equal(t, StatementStats{Hits: 2, Misses: 2, Size: 2}, stats)
+	assert.Equal(t, 0.5, stats.HitRate())
+	assert.Equal(t, int64(2), prepares.Load()-before)
+}
+
+func TestStatementCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewStatementCache(openFake(t), 2)
+	defer cache.Close()
+	ctx := context.Background()
+
+	for _, query := range []string{"a", "b", "a", "c", "a", "b"} {
+		_, err := cache.Exec(ctx, query)
+		require.NoError(t, err)
+	}
+	// c evicted b, and b evicted c, while a stayed in use.
+	assert.Equal(t, StatementStats{Hits: 2, Misses: 4, Evictions: 2, Size: 2}, cache.Stats())
+
+	_, err := cache.Exec(ctx, "fail")
+	assert.Error(t, err)
+	// fail evicted a, then was evicted itself.
+	assert.Equal(t, StatementStats{Hits: 2, Misses: 5, Evictions: 4, Size: 1}, cache.Stats())
+}
+
+func TestStatementCache_Disabled(t *testing.T) {
+	cache := NewStatementCache(openFake(t), 0)
+	ctx := context.Background()
+
+	stmt, err := cache.Prepare(ctx, "a")
+	assert.NoError(t, err)
+	assert.Nil(t, stmt)
+	_, err = cache.Exec(ctx, "a")
+	assert.NoError(t, err)
+	rows, err := cache.Query(ctx, "a")
+	require.NoError(t, err)
+	rows.Close()
+	assert.Equal(t, StatementStats{}, cache.Stats())
+	assert.Zero(t, cache.Stats().HitRate())
+}
@@ -0,0 +1,154 @@
+// Package plugin runs plugins: executables named grayv-lsm-<name> on the PATH, like kubectl plugins. A plugin
+// runs as the "grayv-lsm <name>" command, and may generate code from the model definitions it receives as JSON
+// on its standard input, see Plugin.Generate.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// Prefix is the prefix of the names of plugin executables.
+const Prefix = "grayv-lsm-"
+
+// ProtocolVersion is the version of the generation protocol, see GenerateRequest.
+const ProtocolVersion = 1
+
+// Plugin is a plugin executable.
+type Plugin struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Lookup finds the plugin of the given name on the PATH.
+func Lookup(name string) (Plugin, error) {
+	p, err := exec.LookPath(Prefix + name)
+	if err != nil {
+		return Plugin{}, fmt.Errorf("plugin %s not found: no %s%s executable on the PATH", name, Prefix, name)
+	}
+	return Plugin{Name: name, Path: p}, nil
+}
+
+// List returns the plugins in the directories of a PATH list, sorted by name. A plugin found in several
+// directories is the one run, in the first directory.
+func List(pathList string) []Plugin {
+	found := make(map[string]Plugin)
+	for _, dir := range filepath.SplitList(pathList) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), Prefix)
+			if !ok || name == "" || entry.IsDir() {
+				continue
+			}
+			if info, err := entry.Info(); err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			if _, seen := found[name]; !seen {
+				found[name] = Plugin{Name: name, Path: filepath.Join(dir, entry.Name())}
+			}
+		}
+	}
+	plugins := make([]Plugin, 0, len(found))
+	for _, p := range found {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// Run runs the plugin with the given arguments and standard streams, and returns its error, an *exec.ExitError
+// when it exits with a non-zero status.
+func (p Plugin) Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	command := exec.CommandContext(ctx, p.Path, args...)
+	command.Stdin, command.Stdout, command.Stderr = stdin, stdout, stderr
+	return command.Run()
+}
+
+// GenerateRequest is written as JSON to the standard input of a plugin run with the "generate" argument.
+type GenerateRequest struct {
+	Version int     `json:"version"`
+	Models  []Model `json:"models"`
+	// Options are the options given to the generation, as key=value pairs.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Model is a model definition, as stored in .grav/models.json, with the table it is stored in.
+type Model struct {
+	Definition *model.ModelDefinition `json:"definition"`
+	Table      string                 `json:"table"`
+	Columns    []Column               `json:"columns"`
+	// Schema is the migration creating the table of the model, see model.ModelManager.GenerateMigration.
+	Schema string `json:"schema"`
+}
+
+// Column is a column of the table of a model, with the Go type of its values.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// NewGenerateRequest returns the request generating code for the given models.
+func NewGenerateRequest(defs []*model.ModelDefinition, options map[string]string) GenerateRequest {
+	request := GenerateRequest{Version: ProtocolVersion, Models: make([]Model, len(defs)), Options: options}
+	for i, def := range defs {
+		m := Model{Definition: def, Table: model.TableName(def), Schema: (&model.ModelManager{}).GenerateMigration(def)}
+		for _, column := range model.StoredColumns(def) {
+			m.Columns = append(m.Columns, Column{Name: column.Name, Type: column.Type})
+		}
+		request.Models[i] = m
+	}
+	return request
+}
+
+// GenerateResponse is read as JSON from the standard output of a plugin run with the "generate" argument.
+type GenerateResponse struct {
+	Files []File `json:"files"`
+}
+
+// File is a file generated by a plugin. Its path is slash-separated and relative to the output directory.
+type File struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// Generate runs the plugin with the "generate" argument and the request on its standard input, and returns the
+// files it generated, in outputDir. What the plugin writes to its standard error is copied to stderr. Files
+// outside outputDir are refused.
+func (p Plugin) Generate(ctx context.Context, request GenerateRequest, outputDir string, stderr io.Writer) ([]*model.GeneratedFile, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var output bytes.Buffer
+	if err := p.Run(ctx, []string{"generate"}, bytes.NewReader(input), &output, stderr); err != nil {
+		return nil, fmt.Errorf("plugin %s failed: %w", p.Name, err)
+	}
+
+	var response GenerateResponse
+	if err := json.Unmarshal(output.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("plugin %s returned an invalid response: %w", p.Name, err)
+	}
+	files := make([]*model.GeneratedFile, len(response.Files))
+	for i, file := range response.Files {
+		clean := path.Clean(file.Path)
+		if file.Path == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("plugin %s generated %q outside the output directory", p.Name, file.Path)
+		}
+		files[i] = &model.GeneratedFile{Path: path.Join(filepath.ToSlash(outputDir), clean), Content: []byte(file.Content)}
+	}
+	return files, nil
+}
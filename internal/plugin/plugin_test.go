@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+// writePlugin writes an executable shell script named like a plugin to dir.
+func writePlugin(t *testing.T, dir, name, script string) Plugin {
+	t.Helper()
+	p := filepath.Join(dir, Prefix+name)
+	assert.NoError(t, os.WriteFile(p, []byte("#!/bin/sh\n"+script), 0755))
+	return Plugin{Name: name, Path: p}
+}
+
+func TestList(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writePlugin(t, first, "sqlc", "")
+	writePlugin(t, second, "sqlc", "")
+	writePlugin(t, second, "terraform", "")
+	assert.NoError(t, os.WriteFile(filepath.Join(second, Prefix+"notes"), nil, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(second, "other"), nil, 0755))
+
+	assert.Equal(t, []Plugin{
+		{Name: "sqlc", Path: filepath.Join(first, Prefix+"sqlc")},
+		{Name: "terraform", Path: filepath.Join(second, Prefix+"terraform")},
+	}, List(first+string(os.PathListSeparator)+second+string(os.PathListSeparator)+"/missing"))
+}
+
+func TestGenerate(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	dir := t.TempDir()
+	// The plugin echoes its request back as the content of one file.
+	p := writePlugin(t, dir, "echo", `test "$1" = generate || exit 2
+request=$(cat)
+printf '{"files": [{"path": "schema/request.json", "content": %s}]}' "$(printf '%s' "$request" | sed 's/\\/\\\\/g; s/"/\\"/g; s/^/"/; s/$/"/')"
+`)
+
+	def := model.NewModelDefinition("Post", []model.Field{model.NewField("title", "string", "", false, false)})
+	request := NewGenerateRequest([]*model.ModelDefinition{def}, map[string]string{"engine": "postgresql"})
+	assert.Equal(t, "posts", request.Models[0].Table)
+	assert.Equal(t, []Column{{"id", "uint"}, {"created_at", "time.Time"}, {"updated_at", "time.Time"}, {"title", "string"}}, request.Models[0].Columns)
+	assert.True(t, strings.HasPrefix(request.Models[0].Schema, "CREATE TABLE posts ("))
+
+	files, err := p.Generate(context.Background(), request, "gen", os.Stderr)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "gen/schema/request.json", files[0].Path)
+		assert.Contains(t, string(files[0].Content), `"version":1`)
+		assert.Contains(t, string(files[0].Content), `"options":{"engine":"postgresql"}`)
+	}
+
+	escaping := writePlugin(t, dir, "escape", `cat >/dev/null; echo '{"files": [{"path": "../main.go", "content": ""}]}'`)
+	_, err = escaping.Generate(context.Background(), request, "gen", os.Stderr)
+	assert.EqualError(t, err, `plugin escape generated "../main.go" outside the output directory`)
+
+	failing := writePlugin(t, dir, "fail", "exit 3")
+	_, err = failing.Generate(context.Background(), request, "gen", os.Stderr)
+	assert.EqualError(t, err, "plugin fail failed: exit status 3")
+}
@@ -0,0 +1,313 @@
+// Package privacy exports and erases the personal data of a data subject, such as a user, across the tables of
+// the models related to it. Fields holding personal data are marked sensitive and relations are declared with
+// field references, see model.Field.
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/encryption"
+)
+
+// Erasure modes.
+const (
+	// Anonymize overwrites the sensitive fields of the subject and its related records and keeps the records.
+	Anonymize = "anonymize"
+	// Delete deletes the subject and its related records.
+	Delete = "delete"
+)
+
+// ErrSubjectNotFound is returned when the data subject does not exist.
+var ErrSubjectNotFound = errors.New("data subject not found")
+
+// Relation is a model whose records refer to the data subject through one of its fields.
+type Relation struct {
+	Model *model.ModelDefinition
+	Field *model.Field
+}
+
+// Plan lists the tables holding the personal data of the subjects of a model.
+type Plan struct {
+	Subject   *model.ModelDefinition
+	Relations []Relation
+}
+
+// NewPlan creates the plan for the subjects of the named model. Every model with a field referencing it is a
+// relation; references are followed one level deep.
+func NewPlan(subject string, defs []*model.ModelDefinition) (*Plan, error) {
+	plan := &Plan{}
+	for _, def := range defs {
+		if strings.EqualFold(def.Name, subject) {
+			plan.Subject = def
+		}
+	}
+	if plan.Subject == nil {
+		return nil, fmt.Errorf("model %s not found", subject)
+	}
+	for _, def := range defs {
+		for i := range def.Fields {
+			if strings.EqualFold(def.Fields[i].References, plan.Subject.Name) {
+				plan.Relations = append(plan.Relations, Relation{Model: def, Field: &def.Fields[i]})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Bundle is the personal data of a subject, as exported for a data subject access request.
+type Bundle struct {
+	Model      string    `json:"model"`
+	ID         int64     `json:"id"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Records holds the rows of the subject and of its related records, by table.
+	Records map[string][]map[string]interface{} `json:"records"`
+}
+
+// Export collects the subject's row and the rows referring to it. Encrypted fields are decrypted when a
+// keyring is given. The export is recorded in the audit table.
+func (p *Plan) Export(ctx context.Context, db *sql.DB, id int64, keyring *encryption.Keyring, actor string) (*Bundle, error) {
+	bundle := &Bundle{Model: p.Subject.Name, ID: id, ExportedAt: time.Now().UTC(), Records: map[string][]map[string]interface{}{}}
+
+	subject, err := queryRows(ctx, db, p.Subject, `"id"`, id, keyring)
+	if err != nil {
+		return nil, err
+	}
+	if len(subject) == 0 {
+		return nil, fmt.Errorf("%w: %s %d", ErrSubjectNotFound, p.Subject.Name, id)
+	}
+	bundle.Records[model.TableName(p.Subject)] = subject
+
+	for _, relation := range p.Relations {
+		rows, err := queryRows(ctx, db, relation.Model, columnName(relation.Field), id, keyring)
+		if err != nil {
+			return nil, err
+		}
+		table := model.TableName(relation.Model)
+		bundle.Records[table] = append(bundle.Records[table], rows...)
+	}
+
+	if err := recordAudit(ctx, db, "export", p.Subject.Name, id, counts(bundle.Records), actor); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// queryRows returns the rows of a model's table whose column equals id, as JSON objects keyed by column.
+func queryRows(ctx context.Context, db *sql.DB, def *model.ModelDefinition, column string, id int64, keyring *encryption.Keyring) ([]map[string]interface{}, error) {
+	table := model.TableName(def)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT row_to_json(t) FROM %s t WHERE %s = $1 ORDER BY id", tableName(def), column), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("failed to decode row of %s: %w", table, err)
+		}
+		if keyring != nil {
+			if err := decryptFields(def, record, keyring); err != nil {
+				return nil, fmt.Errorf("%s: %w", table, err)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// decryptFields replaces the ciphertext of the model's encrypted fields in record by the plaintext.
+func decryptFields(def *model.ModelDefinition, record map[string]interface{}, keyring *encryption.Keyring) error {
+	for i := range def.Fields {
+		field := &def.Fields[i]
+		value, ok := record[model.ColumnName(field)].(string)
+		if !field.Encrypted || !ok {
+			continue
+		}
+		if _, err := encryption.KeyID(value); err != nil {
+			continue
+		}
+		plaintext, err := keyring.Decrypt(value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", field.Name, err)
+		}
+		record[model.ColumnName(field)] = plaintext
+	}
+	return nil
+}
+
+// statement is a statement of an erasure, run with the subject's ID as its only argument.
+type statement struct {
+	Table string
+	SQL   string
+}
+
+// erasureStatements returns the statements erasing a subject in the given mode: the related records first,
+// then the subject. In anonymize mode, models without sensitive fields are left alone.
+func (p *Plan) erasureStatements(mode string) ([]statement, error) {
+	var statements []statement
+	switch mode {
+	case Delete:
+		for _, relation := range p.Relations {
+			statements = append(statements, statement{model.TableName(relation.Model),
+				fmt.Sprintf("DELETE FROM %s WHERE %s = $1", tableName(relation.Model), columnName(relation.Field))})
+		}
+		statements = append(statements, statement{model.TableName(p.Subject),
+			fmt.Sprintf("DELETE FROM %s WHERE id = $1", tableName(p.Subject))})
+	case Anonymize:
+		if len(AnonymizedAssignments(p.Subject)) == 0 {
+			return nil, fmt.Errorf("model %s has no sensitive fields to anonymize; mark them with \"model update %s --sensitive-fields\"",
+				p.Subject.Name, p.Subject.Name)
+		}
+		for _, relation := range p.Relations {
+			if assignments := AnonymizedAssignments(relation.Model); len(assignments) > 0 {
+				statements = append(statements, statement{model.TableName(relation.Model),
+					fmt.Sprintf("UPDATE %s SET %s, updated_at = now() WHERE %s = $1",
+						tableName(relation.Model), strings.Join(assignments, ", "), columnName(relation.Field))})
+			}
+		}
+		statements = append(statements, statement{model.TableName(p.Subject),
+			fmt.Sprintf("UPDATE %s SET %s, updated_at = now() WHERE id = $1",
+				tableName(p.Subject), strings.Join(AnonymizedAssignments(p.Subject), ", "))})
+	default:
+		return nil, fmt.Errorf("unknown erasure mode %q (expected %q or %q)", mode, Anonymize, Delete)
+	}
+	return statements, nil
+}
+
+// AnonymizedAssignments returns the SQL assignments overwriting the sensitive fields of a model, which refer to
+// the row's id column.
+func AnonymizedAssignments(def *model.ModelDefinition) []string {
+	var assignments []string
+	for i := range def.Fields {
+		field := &def.Fields[i]
+		if field.Sensitive {
+			assignments = append(assignments, columnName(field)+" = "+anonymizedValue(field))
+		}
+	}
+	return assignments
+}
+
+// anonymizedValue returns the SQL expression a sensitive field is overwritten with: NULL when the column is
+// nullable, otherwise a value of its type carrying no personal data. Strings become "erased-<id>" so unique
+// columns stay unique.
+func anonymizedValue(field *model.Field) string {
+	if field.IsNull || strings.HasPrefix(field.Type, "*") {
+		return "NULL"
+	}
+	switch {
+	case field.Type == "string" || field.Encrypted:
+		return "'erased-' || id::text"
+	case field.Type == "[]byte":
+		return "''::bytea"
+	case strings.HasPrefix(field.Type, "[]"):
+		return "'{}'"
+	case field.Type == "bool":
+		return "false"
+	case field.Type == "time.Time":
+		return "'epoch'"
+	case strings.HasPrefix(field.Type, "int"), strings.HasPrefix(field.Type, "uint"), strings.HasPrefix(field.Type, "float"):
+		return "0"
+	default:
+		return "DEFAULT"
+	}
+}
+
+// Erasure reports the rows an erasure affected, by table.
+type Erasure struct {
+	Mode     string         `json:"mode"`
+	Affected map[string]int `json:"affected"`
+}
+
+// Erase anonymizes or deletes the subject and its related records in a single transaction, which also records
+// the erasure in the audit table.
+func (p *Plan) Erase(ctx context.Context, db *sql.DB, id int64, mode, actor string) (*Erasure, error) {
+	statements, err := p.erasureStatements(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)", tableName(p.Subject)), id).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up %s %d: %w", p.Subject.Name, id, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s %d", ErrSubjectNotFound, p.Subject.Name, id)
+	}
+
+	erasure := &Erasure{Mode: mode, Affected: map[string]int{}}
+	for _, s := range statements {
+		result, err := tx.ExecContext(ctx, s.SQL, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to erase from %s: %w", s.Table, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		erasure.Affected[s.Table] += int(affected)
+	}
+
+	if err := recordAudit(ctx, tx, "erase:"+mode, p.Subject.Name, id, erasure.Affected, actor); err != nil {
+		return nil, err
+	}
+	return erasure, tx.Commit()
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordAudit stores an export or erasure in the privacy_audit table created by the embedded migrations.
+func recordAudit(ctx context.Context, db execer, action, subject string, id int64, affected map[string]int, actor string) error {
+	data, err := json.Marshal(affected)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO privacy_audit (action, model, subject_id, affected, actor, performed_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		action, subject, id, data, actor, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry (run \"db migrate\" to create the privacy_audit table): %w", err)
+	}
+	return nil
+}
+
+func counts(records map[string][]map[string]interface{}) map[string]int {
+	counts := make(map[string]int, len(records))
+	for table, rows := range records {
+		counts[table] = len(rows)
+	}
+	return counts
+}
+
+// tableName returns the quoted name of a model's table.
+func tableName(def *model.ModelDefinition) string {
+	return pq.QuoteIdentifier(model.TableName(def))
+}
+
+// columnName returns the quoted name of a field's column.
+func columnName(field *model.Field) string {
+	return pq.QuoteIdentifier(model.ColumnName(field))
+}
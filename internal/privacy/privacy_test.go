@@ -0,0 +1,96 @@
+package privacy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+)
+
+func newPrivacyTestModels(t *testing.T) []*model.ModelDefinition {
+	user := model.NewModelDefinition("User", []model.Field{
+		model.NewField("Email", "string", "", false, false),
+		model.NewField("Nickname", "string", "", true, false),
+		model.NewField("Age", "int", "", false, false),
+	})
+	assert.NoError(t, user.MarkSensitive("email"))
+	assert.NoError(t, user.MarkSensitive("nickname"))
+	assert.NoError(t, user.MarkSensitive("age"))
+
+	post := model.NewModelDefinition("Post", []model.Field{
+		model.NewField("Title", "string", "", false, false),
+		model.NewField("AuthorID", "int", "", false, false),
+	})
+	assert.NoError(t, post.SetReference("authorid", "User"))
+
+	comment := model.NewModelDefinition("Comment", []model.Field{
+		model.NewField("Body", "string", "", false, false),
+		model.NewField("UserID", "int64", "", false, false),
+	})
+	assert.NoError(t, comment.MarkSensitive("body"))
+	assert.NoError(t, comment.SetReference("userid", "user"))
+
+	tag := model.NewModelDefinition("Tag", []model.Field{model.NewField("Name", "string", "", false, false)})
+	return []*model.ModelDefinition{user, post, comment, tag}
+}
+
+func TestNewPlan(t *testing.T) {
+	defs := newPrivacyTestModels(t)
+
+	plan, err := NewPlan("user", defs)
+	assert.NoError(t, err)
+	assert.Equal(t, "User", plan.Subject.Name)
+	if assert.Len(t, plan.Relations, 2) {
+		assert.Equal(t, "Post", plan.Relations[0].Model.Name)
+		assert.Equal(t, "AuthorID", plan.Relations[0].Field.Name)
+		assert.Equal(t, "Comment", plan.Relations[1].Model.Name)
+	}
+
+	_, err = NewPlan("Account", defs)
+	assert.Error(t, err)
+}
+
+func TestErasureStatements(t *testing.T) {
+	plan, err := NewPlan("User", newPrivacyTestModels(t))
+	assert.NoError(t, err)
+
+	statements, err := plan.erasureStatements(Delete)
+	assert.NoError(t, err)
+	assert.Equal(t, []statement{
+		{"posts", `DELETE FROM "posts" WHERE "authorid" = $1`},
+		{"comments", `DELETE FROM "comments" WHERE "userid" = $1`},
+		{"users", `DELETE FROM "users" WHERE id = $1`},
+	}, statements)
+
+	statements, err = plan.erasureStatements(Anonymize)
+	assert.NoError(t, err)
+	assert.Equal(t, []statement{
+		{"comments", `UPDATE "comments" SET "body" = 'erased-' || id::text, updated_at = now() WHERE "userid" = $1`},
+		{"users", `UPDATE "users" SET "email" = 'erased-' || id::text, "nickname" = NULL, "age" = 0, updated_at = now() WHERE id = $1`},
+	}, statements)
+
+	_, err = plan.erasureStatements("shred")
+	assert.Error(t, err)
+
+	plan, err = NewPlan("Tag", newPrivacyTestModels(t))
+	assert.NoError(t, err)
+	_, err = plan.erasureStatements(Anonymize)
+	assert.Error(t, err)
+}
+
+func TestAnonymizedValue(t *testing.T) {
+	for typ, expected := range map[string]string{
+		"string":    "'erased-' || id::text",
+		"*string":   "NULL",
+		"[]byte":    "''::bytea",
+		"[]string":  "'{}'",
+		"bool":      "false",
+		"time.Time": "'epoch'",
+		"uint32":    "0",
+		"float64":   "0",
+	} {
+		field := model.NewField("Value", typ, "", false, false)
+		assert.Equal(t, expected, anonymizedValue(&field), typ)
+	}
+}
@@ -0,0 +1,133 @@
+// Package search rebuilds the search indexes of the models with search fields, see
+// model.ModelDefinition.SetSearchFields. The generated repositories keep the indexes in sync with the records
+// they change; records changed otherwise, by migrations, seeds or SQL, are indexed again with Reindex.
+package search
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/internal/model/searchbackend"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// DefaultBatchSize is the number of records Reindex reads and indexes at once.
+const DefaultBatchSize = 500
+
+// Backend is a search server holding one index per table. Its documents are the search fields of a record,
+// by column, and its "id", as indexed by the generated repositories.
+type Backend interface {
+	// Clear removes every document of the index.
+	Clear(ctx context.Context, index string) error
+	// Index adds the documents to the index, replacing those with the same IDs.
+	Index(ctx context.Context, index string, docs []map[string]interface{}) error
+}
+
+// New returns the backend of the search configuration.
+func New(cfg config.SearchConfig) (Backend, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("no search backend configured: set Search.URL")
+	}
+	switch cfg.Backend {
+	case "", "meilisearch":
+		return NewMeilisearch(cfg.URL, cfg.APIKey), nil
+	case "elasticsearch":
+		return NewElasticsearch(cfg.URL, cfg.APIKey), nil
+	default:
+		return nil, fmt.Errorf("invalid search backend %q: use meilisearch or elasticsearch", cfg.Backend)
+	}
+}
+
+// Reindex replaces the documents of the index of a model with its records, read by ID in batches of
+// batchSize, DefaultBatchSize if not positive. The index is empty until the first batch is indexed. It returns
+// the number of records indexed.
+func Reindex(ctx context.Context, db *sql.DB, backend Backend, def *model.ModelDefinition, batchSize int) (int, error) {
+	if len(def.Options.SearchFields) == 0 {
+		return 0, fmt.Errorf("model %s has no search fields", def.Name)
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	table := model.TableName(def)
+	entries := []string{"'id', id"}
+	for _, name := range def.Options.SearchFields {
+		field := def.Field(name)
+		if field == nil {
+			return 0, fmt.Errorf("model %s has no search field %s", def.Name, name)
+		}
+		column := model.ColumnName(field)
+		entries = append(entries, pq.QuoteLiteral(column)+", "+pq.QuoteIdentifier(column))
+	}
+	query := fmt.Sprintf("SELECT id, json_build_object(%s) FROM %s WHERE id > $1 ORDER BY id LIMIT $2",
+		strings.Join(entries, ", "), pq.QuoteIdentifier(table))
+
+	if err := backend.Clear(ctx, table); err != nil {
+		return 0, fmt.Errorf("failed to clear index %s: %w", table, err)
+	}
+	var after int64
+	indexed := 0
+	for {
+		docs, last, err := readDocuments(ctx, db, query, after, batchSize)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		if len(docs) == 0 {
+			return indexed, nil
+		}
+		if err := backend.Index(ctx, table, docs); err != nil {
+			return indexed, fmt.Errorf("failed to index %s: %w", table, err)
+		}
+		indexed += len(docs)
+		after = last
+	}
+}
+
+// readDocuments reads the documents of the batch of records following the ID after, and returns the ID of
+// the last one.
+func readDocuments(ctx context.Context, db *sql.DB, query string, after int64, limit int) ([]map[string]interface{}, int64, error) {
+	rows, err := db.QueryContext(ctx, query, after, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var docs []map[string]interface{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&after, &data); err != nil {
+			return nil, 0, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, 0, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, after, rows.Err()
+}
+
+// Meilisearch and Elasticsearch are the backends of the generated models, which index documents the same way.
+type (
+	Meilisearch   = searchbackend.Meilisearch
+	Elasticsearch = searchbackend.Elasticsearch
+)
+
+// NewMeilisearch creates a backend of the Meilisearch server at url, authenticated with apiKey if set.
+func NewMeilisearch(url, apiKey string) *Meilisearch {
+	return searchbackend.NewMeilisearch(url, apiKey)
+}
+
+// NewElasticsearch creates a backend of the Elasticsearch cluster at url, authenticated with the API key
+// apiKey if set.
+func NewElasticsearch(url, apiKey string) *Elasticsearch {
+	return searchbackend.NewElasticsearch(url, apiKey)
+}
@@ -0,0 +1,83 @@
+package search
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/internal/model"
+	"github.com/ooyeku/grayv-lsm/pkg/config"
+)
+
+// request is a request received by a fake search server.
+type request struct {
+	method, uri, auth, body string
+}
+
+func newSearchServer(t *testing.T, status int, response string) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), string(body)})
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestNew(t *testing.T) {
+	backend, err := New(config.SearchConfig{URL: "http://localhost:7700"})
+	assert.NoError(t, err)
+	assert.IsType(t, &Meilisearch{}, backend)
+	backend, err = New(config.SearchConfig{Backend: "elasticsearch", URL: "http://localhost:9200"})
+	assert.NoError(t, err)
+	assert.IsType(t, &Elasticsearch{}, backend)
+	_, err = New(config.SearchConfig{Backend: "solr", URL: "http://localhost:8983"})
+	assert.Error(t, err)
+	_, err = New(config.SearchConfig{})
+	assert.Error(t, err)
+}
+
+func TestMeilisearch(t *testing.T) {
+	server, requests := newSearchServer(t, http.StatusAccepted, `{"taskUid":1}`)
+	m := NewMeilisearch(server.URL+"/", "key")
+	ctx := context.Background()
+
+	assert.NoError(t, m.Clear(ctx, "posts"))
+	assert.NoError(t, m.Index(ctx, "posts", []map[string]interface{}{{"id": 1, "title": "Go"}}))
+	assert.Equal(t, []request{
+		{"DELETE", "/indexes/posts/documents", "Bearer key", ""},
+		{"POST", "/indexes/posts/documents?primaryKey=id", "Bearer key", `[{"id":1,"title":"Go"}]`},
+	}, *requests)
+}
+
+func TestElasticsearch(t *testing.T) {
+	server, requests := newSearchServer(t, http.StatusNotFound, `{"error":"index_not_found_exception"}`)
+	e := NewElasticsearch(server.URL, "")
+	ctx := context.Background()
+	assert.NoError(t, e.Clear(ctx, "posts"))
+	assert.Equal(t, "/posts/_delete_by_query?refresh=true", (*requests)[0].uri)
+
+	server, requests = newSearchServer(t, http.StatusOK,
+		`{"errors":true,"items":[{"index":{"status":201}},{"index":{"error":{"type":"mapper_parsing_exception"}}}]}`)
+	e = NewElasticsearch(server.URL, "key")
+	err := e.Index(ctx, "posts", []map[string]interface{}{{"id": 1, "title": "Go"}, {"id": 2, "title": "SQL"}})
+	assert.EqualError(t, err, `elasticsearch index: {"type":"mapper_parsing_exception"}`)
+	assert.Equal(t, "ApiKey key", (*requests)[0].auth)
+	assert.Equal(t, `{"index":{"_id":"1","_index":"posts"}}
+{"id":1,"title":"Go"}
+{"index":{"_id":"2","_index":"posts"}}
+{"id":2,"title":"SQL"}
+`, (*requests)[0].body)
+}
+
+func TestReindex_NoSearchFields(t *testing.T) {
+	def := model.NewModelDefinition("Post", []model.Field{model.NewField("Title", "string", "", false, false)})
+	_, err := Reindex(context.Background(), nil, NewMeilisearch("http://localhost:7700", ""), def, 0)
+	assert.EqualError(t, err, "model Post has no search fields")
+}
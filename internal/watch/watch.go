@@ -0,0 +1,104 @@
+// Package watch polls files and directories for changes, so that generated code can be kept in sync with
+// the files it is generated from while they are edited.
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+// Snapshot holds the content hash of every file under a set of paths, by file path.
+type Snapshot map[string][sha256.Size]byte
+
+// Take takes a snapshot of the given files, and of the files under the given directories. Missing paths are
+// left out, so that a file created later shows up as a change.
+func Take(fsys filesystem.FS, paths []string) (Snapshot, error) {
+	snapshot := Snapshot{}
+	for _, root := range paths {
+		err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			data, err := fsys.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			snapshot[p] = sha256.Sum256(data)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// Changed returns the sorted paths of the files added, removed or modified from s to next.
+func (s Snapshot) Changed(next Snapshot) []string {
+	var changed []string
+	for p, sum := range next {
+		if previous, ok := s[p]; !ok || previous != sum {
+			changed = append(changed, p)
+		}
+	}
+	for p := range s {
+		if _, ok := next[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Poll takes a snapshot of the paths every interval until ctx is done, and calls onChange with the files
+// changed since the previous snapshot. Changes are reported once the files have stopped changing for an
+// interval, so that a file being written is not read half-way. onChange returning an error stops Poll with
+// that error; Poll otherwise returns ctx.Err().
+func Poll(ctx context.Context, fsys filesystem.FS, paths []string, interval time.Duration, onChange func(changed []string) error) error {
+	current, err := Take(fsys, paths)
+	if err != nil {
+		return err
+	}
+	var pending Snapshot
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		next, err := Take(fsys, paths)
+		if err != nil {
+			return err
+		}
+		if pending != nil && len(pending.Changed(next)) == 0 {
+			changed := current.Changed(next)
+			current, pending = next, nil
+			if len(changed) > 0 {
+				if err := onChange(changed); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if len(current.Changed(next)) > 0 {
+			pending = next
+		} else {
+			pending = nil
+		}
+	}
+}
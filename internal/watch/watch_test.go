@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ooyeku/grayv-lsm/pkg/filesystem"
+)
+
+func TestSnapshot_Changed(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	assert.NoError(t, fsys.WriteFile("models.json", []byte("{}"), 0644))
+	assert.NoError(t, fsys.WriteFile("templates/model.tmpl", []byte("a"), 0644))
+	assert.NoError(t, fsys.WriteFile("templates/repository.tmpl", []byte("b"), 0644))
+
+	before, err := Take(fsys, []string{"models.json", "templates", "missing.json"})
+	assert.NoError(t, err)
+	assert.Len(t, before, 3)
+
+	assert.NoError(t, fsys.WriteFile("models.json", []byte("{}"), 0644))
+	assert.NoError(t, fsys.WriteFile("templates/model.tmpl", []byte("c"), 0644))
+	assert.NoError(t, fsys.Remove("templates/repository.tmpl"))
+	assert.NoError(t, fsys.WriteFile("missing.json", []byte("{}"), 0644))
+
+	after, err := Take(fsys, []string{"models.json", "templates", "missing.json"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing.json", "templates/model.tmpl", "templates/repository.tmpl"}, before.Changed(after))
+	assert.Empty(t, after.Changed(after))
+}
+
+func TestPoll(t *testing.T) {
+	fsys := filesystem.NewMemFS()
+	assert.NoError(t, fsys.WriteFile("models.json", []byte("{}"), 0644))
+
+	stop := errors.New("stop")
+	changes := make(chan []string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- Poll(context.Background(), fsys, []string{"models.json"}, 5*time.Millisecond, func(changed []string) error {
+			changes <- changed
+			return stop
+		})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, fsys.WriteFile("models.json", []byte(`{"Post": {}}`), 0644))
+	select {
+	case changed := <-changes:
+		assert.Equal(t, []string{"models.json"}, changed)
+	case <-time.After(time.Second):
+		t.Fatal("change not reported")
+	}
+	assert.Equal(t, stop, <-done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, Poll(ctx, fsys, []string{"models.json"}, time.Millisecond, nil))
+}
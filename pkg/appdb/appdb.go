@@ -0,0 +1,147 @@
+// Package appdb migrates and seeds the database of an app scaffolded by "grayv-lsm app new", so that the app's
+// own binary can do it in production without the grayv-lsm tool installed. The migrations of the tables
+// grayv-lsm provides, such as the jobs and notifications tables, are applied together with the app's.
+package appdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ooyeku/grayv-lsm/embedded"
+	"github.com/ooyeku/grayv-lsm/internal/database/migration"
+	"github.com/ooyeku/grayv-lsm/internal/database/seed"
+	"github.com/ooyeku/grayv-lsm/pkg/schema"
+)
+
+// Migration is a migration of an app and whether it was applied.
+type Migration struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+// migrator returns the migrator of the migrations of grayv-lsm, of the "migrations" directory of fsys and of
+// those written in Go, registered with schema.Register, which are rendered in the dialect of db's driver.
+func migrator(db *sql.DB, fsys fs.FS) (*migration.Migrator, error) {
+	m := migration.NewMigratorFS(db, logrus.New(), layers{fsys, embedded.EmbeddedFiles})
+	m.SetDialect(dialectOf(db))
+	if err := m.LoadMigrations(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Migrate applies the pending migrations of the "migrations" directory of fsys, and of grayv-lsm, in version
+// order. Cancelling ctx rolls back the migration running and leaves the following ones pending.
+func Migrate(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	m, err := migrator(db, fsys)
+	if err != nil {
+		return err
+	}
+	return m.Migrate(ctx)
+}
+
+// Rollback rolls back the last steps migrations applied.
+func Rollback(ctx context.Context, db *sql.DB, fsys fs.FS, steps int) error {
+	m, err := migrator(db, fsys)
+	if err != nil {
+		return err
+	}
+	return m.Rollback(ctx, steps)
+}
+
+// Migrations returns the migrations Migrate applies, in version order, and whether they were applied.
+func Migrations(ctx context.Context, db *sql.DB, fsys fs.FS) ([]Migration, error) {
+	m, err := migrator(db, fsys)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := m.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	isPending := make(map[int64]bool, len(pending))
+	for _, p := range pending {
+		isPending[p.Version] = true
+	}
+	var migrations []Migration
+	for _, loaded := range m.Migrations() {
+		migrations = append(migrations, Migration{Version: loaded.Version, Name: loaded.Name, Applied: !isPending[loaded.Version]})
+	}
+	return migrations, nil
+}
+
+// dialectOf returns the SQL dialect of the driver of db: MySQL or SQLite for their drivers, Postgres otherwise.
+func dialectOf(db *sql.DB) schema.Dialect {
+	if db == nil {
+		return schema.Postgres
+	}
+	driver := strings.ToLower(fmt.Sprintf("%T", db.Driver()))
+	switch {
+	case strings.Contains(driver, "mysql"):
+		return schema.MySQL
+	case strings.Contains(driver, "sqlite"):
+		return schema.SQLite
+	default:
+		return schema.Postgres
+	}
+}
+
+// Seed executes the seed files of the "seeds" directory of fsys in order of file name: SQL files, and YAML
+// files fetching rows from HTTP APIs into tables. Cancelling ctx rolls back the seed running and skips the
+// following ones.
+func Seed(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	seeder := seed.NewSeederFS(db, fsys)
+	if err := seeder.LoadSeeds(); err != nil {
+		return err
+	}
+	return seeder.Seed(ctx)
+}
+
+// layers is a file system reading files from the first of its file systems holding them, whose directories
+// list the entries of the directories of all of them.
+type layers []fs.FS
+
+func (l layers) Open(name string) (fs.File, error) {
+	for _, fsys := range l {
+		f, err := fsys.Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (l layers) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]bool)
+	found := false
+	for _, fsys := range l {
+		layer, err := fs.ReadDir(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		found = true
+		for _, entry := range layer {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
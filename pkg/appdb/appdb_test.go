@@ -0,0 +1,54 @@
+package appdb
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayers(t *testing.T) {
+	app := fstest.MapFS{
+		"migrations/20250101000000_create_orders.sql": {Data: []byte("app")},
+		"migrations/shared.sql":                       {Data: []byte("app shared")},
+	}
+	base := fstest.MapFS{
+		"migrations/20230601000000_create_users.sql": {Data: []byte("base")},
+		"migrations/shared.sql":                      {Data: []byte("base shared")},
+		"seeds/01_users.sql":                         {Data: []byte("seed")},
+	}
+	fsys := layers{app, base}
+
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if assert.NoError(t, err) {
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+		assert.Equal(t, []string{"20230601000000_create_users.sql", "20250101000000_create_orders.sql", "shared.sql"}, names)
+	}
+	data, err := fs.ReadFile(fsys, "migrations/shared.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, "app shared", string(data), "the first layer wins")
+	data, err = fs.ReadFile(fsys, "seeds/01_users.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, "seed", string(data))
+
+	_, err = fs.ReadDir(fsys, "missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fsys.Open("missing.sql")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestMigrations_LoadsBothLayers(t *testing.T) {
+	app := fstest.MapFS{
+		"migrations/20990101000000_create_orders.sql": {Data: []byte("-- Up\nCREATE TABLE orders (id SERIAL);\n-- Down\nDROP TABLE orders;\n")},
+	}
+	m, err := migrator(nil, app)
+	if assert.NoError(t, err) {
+		loaded := m.Migrations()
+		assert.Greater(t, len(loaded), 1, "the migrations of grayv-lsm are loaded too")
+		assert.Equal(t, int64(20990101000000), loaded[len(loaded)-1].Version)
+	}
+}
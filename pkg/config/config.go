@@ -1,39 +1,241 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 
 	"github.com/ooyeku/grayv-lsm/embedded"
 )
 
 // Config represents the configuration settings for the application.
 // It contains settings for the database, server, and logging.
+// Databases holds additional named databases (for example per-environment or per-tenant databases) that
+// multi-database commands can target alongside the primary Database.
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	Logging  LoggingConfig
+	Database    DatabaseConfig
+	Databases   map[string]DatabaseConfig `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Server      ServerConfig
+	Logging     LoggingConfig
+	Encryption  EncryptionConfig
+	Naming      NamingConfig
+	Types       []TypeConfig `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Lint        LintConfig
+	Enforcement EnforcementConfig
+	Auth        AuthConfig
+	Metrics     MetricsConfig
+	Search      SearchConfig
+
+	// secrets holds the secret references resolved by LoadConfig, keyed by the path of the field.
+	secrets map[string]resolvedSecret
+	// overrides holds the settings LoadConfig read from the environment, keyed by path.
+	overrides map[string]envOverride
 }
 
+// DefaultDatabaseName is the name under which the primary Database is addressed by multi-database commands.
+const DefaultDatabaseName = "default"
+
 // DatabaseConfig represents the configuration for connecting to a database.
 // It contains the driver, host, port, user, password, database name, and SSL mode.
+// User and Password may be references to secrets kept elsewhere, see SecretResolver, and PasswordFile names a
+// file holding the password, such as a Docker or Kubernetes secret, which is read when Password is empty.
 type DatabaseConfig struct {
 	Driver        string
 	Host          string
 	Port          int
 	User          string
 	Password      string
+	PasswordFile  string `json:",omitempty" yaml:"password_file,omitempty" toml:"password_file,omitempty"`
 	Name          string
 	SSLMode       string
 	ContainerName string
 	Image         string
+	// StatementCacheSize is the number of prepared statements a connection keeps, least recently used evicted
+	// first: 256 when 0, and none when negative.
+	StatementCacheSize int `json:",omitempty" yaml:"statement_cache_size,omitempty" toml:"statement_cache_size,omitempty"`
+	// StatementTimeout is how long a statement may run before the database cancels it, as a Go duration, e.g.
+	// "30s", without limit by default.
+	StatementTimeout string `json:",omitempty" yaml:"statement_timeout,omitempty" toml:"statement_timeout,omitempty"`
+	// SlowQueryThreshold is the duration past which the statements of the ORM are logged as slow, as a Go
+	// duration, e.g. "200ms"; none are by default.
+	SlowQueryThreshold string `json:",omitempty" yaml:"slow_query_threshold,omitempty" toml:"slow_query_threshold,omitempty"`
+	// Replicas lists the read replicas of the database, see ReplicaConfigs.
+	Replicas []ReplicaConfig `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
 }
 
-// ServerConfig represents the configuration for a server, including the host and port it is running on.
-type ServerConfig struct {
+// ReplicaConfig represents a read replica of a database, reached at its own host and port with the user,
+// password, and database name of the primary.
+type ReplicaConfig struct {
 	Host string
-	Port int
+	Port int `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// ReplicaConfigs returns the connection configurations of the replicas of the database: the configuration of
+// the primary with the host and port of each replica, its port defaulting to the primary's.
+func (db *DatabaseConfig) ReplicaConfigs() []DatabaseConfig {
+	configs := make([]DatabaseConfig, len(db.Replicas))
+	for i, replica := range db.Replicas {
+		configs[i] = *db
+		configs[i].Replicas = nil
+		configs[i].Host = replica.Host
+		if replica.Port != 0 {
+			configs[i].Port = replica.Port
+		}
+	}
+	return configs
+}
+
+// ServerConfig represents the configuration for a server, including the host and port it is running on, and
+// the middleware of the servers of apps scaffolded by "app new".
+type ServerConfig struct {
+	Host       string
+	Port       int
+	Middleware MiddlewareConfig `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// MiddlewareConfig configures the middleware chain of the servers of new apps, which the environment of an app
+// overrides at runtime.
+//
+// It contains the following fields:
+//   - Disable: the middleware used by default not to use: "request_id", "logging" or "recovery"
+//   - Gzip: compress responses with gzip
+//   - CORSOrigins: the origins allowed to call the servers from browsers, "*" for any; CORS is disabled when empty
+type MiddlewareConfig struct {
+	Disable     []string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Gzip        bool     `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	CORSOrigins []string `json:",omitempty" yaml:"cors_origins,omitempty" toml:"cors_origins,omitempty"`
+}
+
+// EncryptionConfig holds the keys encrypted model fields are encrypted with.
+//
+// It contains the following fields:
+//   - Keys: base64-encoded 256-bit keys by ID, which may be secret references, see SecretResolver
+//   - Primary: the ID of the key new values are encrypted with
+//
+// Keys that values may still be encrypted with must stay configured until "db rotate-keys" has moved every
+// value to the primary key.
+type EncryptionConfig struct {
+	Keys    map[string]string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Primary string            `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// NamingConfig controls how the database names of new models are derived.
+//
+// It contains the following fields:
+//   - Tables: the naming strategy of table names, "snake_plural" (the default), "snake", or "lower_plural"
+//
+// The table name of a model is recorded when the model is created, so changing the strategy only affects
+// models created afterwards.
+type NamingConfig struct {
+	Tables string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// TypeConfig registers a custom Go type model fields may have, beyond the built-in types.
+//
+// It contains the following fields:
+//   - Name: the type as written in field definitions, e.g. "decimal.Decimal"
+//   - SQLType: the type of the columns storing it, e.g. "NUMERIC(20,4)"
+//   - Import: the import path of the package declaring it, e.g. "github.com/shopspring/decimal"
+type TypeConfig struct {
+	Name    string
+	SQLType string `yaml:"sql_type" toml:"sql_type"`
+	Import  string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// LintConfig configures the rules "model lint" checks model definitions against.
+//
+// It contains the following fields:
+//   - Disable: the names of built-in rules not to check, e.g. "naming"
+//   - Rules: additional rules, see LintRuleConfig
+type LintConfig struct {
+	Disable []string         `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Rules   []LintRuleConfig `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// LintRuleConfig is a lint rule defined in the configuration.
+//
+// It contains the following fields:
+//   - Name: the name the rule is reported with
+//   - Target: the names checked by Match and Forbid: "model", "table", "field" or "column"
+//   - Match: a regular expression the names must match
+//   - Forbid: a regular expression the names must not match
+//   - RequireFields: fields every model must have
+//   - Severity: "error" (the default) or "warning"
+//   - Message: the message reported for violations, instead of a generated one
+type LintRuleConfig struct {
+	Name          string
+	Target        string   `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Match         string   `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Forbid        string   `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	RequireFields []string `json:",omitempty" yaml:"require_fields,omitempty" toml:"require_fields,omitempty"`
+	Severity      string   `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Message       string   `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// EnforcementConfig configures the Rego policies checked before code generation and migrations. Policies
+// implemented in Go are registered with enforcement.Register instead.
+//
+// It contains the following fields:
+//   - Rego: the Rego files or directories of policies, evaluated with the opa CLI
+//   - Query: the query returning the violations, "data.grayv.deny" by default
+type EnforcementConfig struct {
+	Rego  []string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Query string   `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// AuthConfig configures the JWT authentication generated by "auth generate".
+//
+// It contains the following fields:
+//   - Model: the model of the users, "User" by default
+//   - Issuer: the issuer of the tokens, their "iss" claim, "grayv" by default
+//   - SecretEnv: the environment variable the generated code reads the signing key from, "JWT_SECRET" by default
+//   - AccessTTL: how long access tokens are valid, as a Go duration, "15m" by default
+//   - RefreshTTL: how long refresh tokens are valid, as a Go duration, "720h" by default
+//   - Permissions: the roles allowed to perform each action on the records of a model, by model or table name and
+//     action, as comma-separated roles, e.g. {posts: {create: "editor,admin", delete: admin}}; they take
+//     precedence over the permissions of the model
+type AuthConfig struct {
+	Model       string                       `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Issuer      string                       `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	SecretEnv   string                       `json:",omitempty" yaml:"secret_env,omitempty" toml:"secret_env,omitempty"`
+	AccessTTL   string                       `json:",omitempty" yaml:"access_ttl,omitempty" toml:"access_ttl,omitempty"`
+	RefreshTTL  string                       `json:",omitempty" yaml:"refresh_ttl,omitempty" toml:"refresh_ttl,omitempty"`
+	Permissions map[string]map[string]string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// MetricsConfig configures the Prometheus metrics of grayv-lsm.
+//
+// It contains the following fields:
+//   - Enabled: serve the metrics of the admin UI, its requests, queries and database connections
+//   - Path: the path the admin UI serves the metrics on, "/metrics" by default
+//   - Buckets: the upper bounds, in seconds, of the buckets of the latency histograms, 5ms to 10s by default
+//   - Pushgateway: the URL of a Pushgateway the migration and seed commands push their run counts to
+type MetricsConfig struct {
+	Enabled     bool      `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Path        string    `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Buckets     []float64 `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Pushgateway string    `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// SearchConfig configures the search backend "search reindex" indexes the models with search fields in.
+//
+// It contains the following fields:
+//   - Backend: "meilisearch", the default, or "elasticsearch"
+//   - URL: the URL of the search server
+//   - APIKey: the API key of the search server, if it requires one
+type SearchConfig struct {
+	Backend string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	URL     string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	APIKey  string `json:",omitempty" yaml:"api_key,omitempty" toml:"api_key,omitempty"`
 }
 
 // LoggingConfig represents the configuration for logging.
@@ -41,22 +243,44 @@ type ServerConfig struct {
 // It contains the following fields:
 //   - Level: the logging level, which can be "debug", "info", "warn", or "error"
 //   - File: the file path where the logs will be written, if specified
+//   - Format: the format of the lines of File, "text" (the default) or "json"; without a File, "json" writes
+//     JSON lines to stderr
+//   - MaxSize: the size in megabytes past which File is rotated, never by default
+//   - MaxAge: how long rotated files are kept, as a Go duration, e.g. "168h", forever by default
+//   - MaxBackups: the number of rotated files kept, all by default
+//   - Commands: the levels of commands and their subcommands, overriding Level, e.g. {"db migrate": "debug"}
 type LoggingConfig struct {
-	Level string
-	File  string
+	Level      string
+	File       string
+	Format     string            `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	MaxSize    int               `json:",omitempty" yaml:"max_size,omitempty" toml:"max_size,omitempty"`
+	MaxAge     string            `json:",omitempty" yaml:"max_age,omitempty" toml:"max_age,omitempty"`
+	MaxBackups int               `json:",omitempty" yaml:"max_backups,omitempty" toml:"max_backups,omitempty"`
+	Commands   map[string]string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
 }
 
-// LoadConfig reads the embedded config.json file and parses it into a Config object.
+// configFiles are the configuration files looked for in the current directory, in order of precedence. The
+// format of each is detected from its extension.
+var configFiles = []string{"config.yaml", "config.yml", "config.toml", "config.json"}
+
+// LoadConfig reads the first configuration file found in the current directory (config.yaml, config.yml,
+// config.toml, or config.json) and parses it into a Config object. When none exists, the embedded config.json
+// is used as a last resort. Settings are then overridden by the environment variables named after them, e.g.
+// GRAYV_DATABASE_HOST, see EnvName, and secret references in database credentials are resolved, see
+// SecretResolver.
 // It returns a pointer to the Config object and an error if any occurs during the process.
 // The Config object holds the configuration for the program, including the database, server, and logging configurations.
 func LoadConfig() (*Config, error) {
 	var cfg Config
 
 	// Try to load from local file first
-	localConfig, err := os.ReadFile("config.json")
-	if err == nil {
-		if err := json.Unmarshal(localConfig, &cfg); err != nil {
-			return nil, fmt.Errorf("failed to parse local config file: %w", err)
+	if file, found := findConfigFile(); found {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read local config file: %w", err)
+		}
+		if err := decodeConfig(file, data, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse local config file %s: %w", file, err)
 		}
 	} else {
 		// If local file doesn't exist, load from embedded
@@ -69,23 +293,83 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	if err := applyEnvironment(&cfg); err != nil {
+		return nil, err
+	}
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, err
+	}
 	setDefaults(&cfg)
 	return &cfg, nil
 }
 
-// setDefaults sets default values for the given Config object if any of the fields are empty or zero valued.
-func setDefaults(config *Config) {
-	if config.Database.Driver == "" {
-		config.Database.Driver = "postgres"
+// findConfigFile returns the local configuration file LoadConfig reads. GetConfigPath names either the file
+// itself or the directory the files of configFiles are looked for in. When no file exists it returns the file
+// SaveConfig creates, config.json unless GetConfigPath names another file, and found is false.
+func findConfigFile() (file string, found bool) {
+	configPath := GetConfigPath()
+	if isConfigFile(configPath) {
+		_, err := os.Stat(configPath)
+		return configPath, !errors.Is(err, fs.ErrNotExist)
+	}
+	for _, name := range configFiles {
+		file := filepath.Join(configPath, name)
+		if _, err := os.Stat(file); !errors.Is(err, fs.ErrNotExist) {
+			return file, true
+		}
 	}
-	if config.Database.Host == "" {
-		config.Database.Host = "localhost"
+	return filepath.Join(configPath, "config.json"), false
+}
+
+// isConfigFile reports whether the path names a file in one of the supported configuration formats.
+func isConfigFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".toml", ".json":
+		return true
+	default:
+		return false
 	}
-	if config.Database.Port == 0 {
-		config.Database.Port = 5432
+}
+
+// decodeConfig parses data in the format indicated by the file's extension.
+func decodeConfig(file string, data []byte, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, cfg)
+	case ".toml":
+		_, err := toml.Decode(string(data), cfg)
+		return err
+	case ".json":
+		return json.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format %q", filepath.Ext(file))
+	}
+}
+
+// encodeConfig renders the configuration in the format indicated by the file's extension.
+func encodeConfig(file string, cfg *Config) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return yaml.Marshal(cfg)
+	case ".toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case ".json":
+		return json.MarshalIndent(cfg, "", "    ")
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q", filepath.Ext(file))
 	}
-	if config.Database.SSLMode == "" {
-		config.Database.SSLMode = "disable"
+}
+
+// setDefaults sets default values for the given Config object if any of the fields are empty or zero valued.
+func setDefaults(config *Config) {
+	setDatabaseDefaults(&config.Database)
+	for name, db := range config.Databases {
+		setDatabaseDefaults(&db)
+		config.Databases[name] = db
 	}
 	if config.Server.Host == "" {
 		config.Server.Host = "0.0.0.0"
@@ -104,10 +388,51 @@ func setDefaults(config *Config) {
 	}
 }
 
+// setDatabaseDefaults sets the connection defaults shared by the primary and every named database.
+func setDatabaseDefaults(db *DatabaseConfig) {
+	if db.Driver == "" {
+		db.Driver = "postgres"
+	}
+	if db.Host == "" {
+		db.Host = "localhost"
+	}
+	if db.Port == 0 {
+		db.Port = 5432
+	}
+	if db.SSLMode == "" {
+		db.SSLMode = "disable"
+	}
+}
+
+// LookupDatabase returns the configuration of the named database. The name "default" (or an empty name)
+// refers to the primary Database; any other name must be a key of Databases.
+func (c *Config) LookupDatabase(name string) (*DatabaseConfig, error) {
+	if name == "" || name == DefaultDatabaseName {
+		return &c.Database, nil
+	}
+	db, exists := c.Databases[name]
+	if !exists {
+		return nil, fmt.Errorf("database %q is not configured", name)
+	}
+	return &db, nil
+}
+
+// DatabaseNames returns "default" followed by the names of all additional databases in ascending order.
+func (c *Config) DatabaseNames() []string {
+	names := make([]string, 0, len(c.Databases))
+	for name := range c.Databases {
+		if name != DefaultDatabaseName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultDatabaseName}, names...)
+}
+
 // GetConfigPath retrieves the path to the configuration file. It first checks if the
 // environment variable "GRAVORM_CONFIG_PATH" is set, and if so, returns its value.
 // If the environment variable is not set, the function returns the path "." indicating
-// the current directory.
+// the current directory. The path may name a configuration file or the directory holding one.
 func GetConfigPath() string {
 	if configPath := os.Getenv("GRAVORM_CONFIG_PATH"); configPath != "" {
 		return configPath
@@ -115,19 +440,71 @@ func GetConfigPath() string {
 	return "."
 }
 
-// SaveConfig saves the given configuration to a file specified by GetConfigPath.
-// It creates a new file using os.Create and closes it using defer file.Close().
-// It then encodes the config using json.NewEncoder and returns any error encountered.
+// SaveConfig saves the given configuration to the local configuration file LoadConfig reads, in that file's
+// format, so that editing a config.yaml or config.toml keeps it in place. When no local file exists yet, a
+// config.json is created. Credentials resolved from secret references are written back as the references, and
+// settings overridden by environment variables as they were in the file.
 func SaveConfig(cfg *Config) error {
-	data, err := json.MarshalIndent(cfg, "", "    ")
+	file, _ := findConfigFile()
+	data, err := encodeConfig(file, cfg.withSecretReferences().withoutEnvironment())
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	err = os.WriteFile("config.json", data, 0644)
+	err = os.WriteFile(file, data, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
 	return nil
 }
+
+// InitConfig writes a starter configuration, holding the embedded defaults, to GetConfigPath(). When that names
+// a directory the file is config.<format> inside it; format is "json", "yaml", or "toml" and defaults to
+// "json". When it names a file, the file's extension decides the format and format must be empty or agree.
+// An existing file is only replaced when force is set. It returns the path of the written file.
+func InitConfig(format string, force bool) (string, error) {
+	file := GetConfigPath()
+	if isConfigFile(file) {
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+		if format != "" && format != ext && !(format == "yaml" && ext == "yml") {
+			return "", fmt.Errorf("format %q does not match config file %s", format, file)
+		}
+	} else {
+		if format == "" {
+			format = "json"
+		}
+		if !isConfigFile("config." + format) {
+			return "", fmt.Errorf("unsupported config format %q (expected json, yaml, or toml)", format)
+		}
+		file = filepath.Join(file, "config."+format)
+	}
+
+	if _, err := os.Stat(file); err == nil && !force {
+		return "", fmt.Errorf("config file %s already exists", file)
+	}
+
+	var cfg Config
+	embeddedConfig, err := embedded.EmbeddedFiles.ReadFile("config.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to read embedded config file: %w", err)
+	}
+	if err := json.Unmarshal(embeddedConfig, &cfg); err != nil {
+		return "", fmt.Errorf("failed to parse embedded config file: %w", err)
+	}
+	setDefaults(&cfg)
+
+	data, err := encodeConfig(file, &cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if dir := filepath.Dir(file); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create config directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write config file: %w", err)
+	}
+	return file, nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -98,3 +99,193 @@ func TestSetDefaults(t *testing.T) {
 		t.Fatalf("Default config not set correctly")
 	}
 }
+
+func TestLookupDatabase(t *testing.T) {
+	config := &Config{
+		Database: DatabaseConfig{Name: "primary"},
+		Databases: map[string]DatabaseConfig{
+			"tenant_b": {Name: "b"},
+			"tenant_a": {Name: "a", Port: 6543},
+		},
+	}
+	setDefaults(config)
+
+	db, err := config.LookupDatabase(DefaultDatabaseName)
+	if err != nil || db.Name != "primary" {
+		t.Fatalf("expected primary database, got %+v (%v)", db, err)
+	}
+
+	db, err = config.LookupDatabase("tenant_a")
+	if err != nil || db.Name != "a" || db.Port != 6543 || db.Host != "localhost" {
+		t.Fatalf("expected tenant_a with defaults applied, got %+v (%v)", db, err)
+	}
+
+	if _, err := config.LookupDatabase("missing"); err == nil {
+		t.Fatalf("expected an error for an unknown database")
+	}
+
+	if names := config.DatabaseNames(); !reflect.DeepEqual(names, []string{"default", "tenant_a", "tenant_b"}) {
+		t.Fatalf("unexpected database names %v", names)
+	}
+}
+
+func TestReplicaConfigs(t *testing.T) {
+	db := DatabaseConfig{Host: "primary", Port: 5432, User: "app", Name: "shop",
+		Replicas: []ReplicaConfig{{Host: "replica-1"}, {Host: "replica-2", Port: 6432}}}
+
+	replicas := db.ReplicaConfigs()
+	if len(replicas) != 2 {
+		t.Fatalf("expected 2 replicas, got %+v", replicas)
+	}
+	if r := replicas[0]; r.Host != "replica-1" || r.Port != 5432 || r.User != "app" || r.Name != "shop" || r.Replicas != nil {
+		t.Fatalf("unexpected replica config %+v", r)
+	}
+	if r := replicas[1]; r.Host != "replica-2" || r.Port != 6432 {
+		t.Fatalf("unexpected replica config %+v", r)
+	}
+}
+
+// chdirTemp changes into a fresh temporary directory for the duration of the test.
+func chdirTemp(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("GRAVORM_CONFIG_PATH", "")
+	return dir
+}
+
+func TestLoadConfig_YAMLAndTOML(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "database:\n  host: yaml-host\n  port: 6000\n  sslmode: require\ndatabases:\n  tenant_a:\n    name: a\n",
+		"config.yml":  "database:\n  host: yml-host\n",
+		"config.toml": "[Database]\nHost = \"toml-host\"\nPort = 7000\nstatement_cache_size = 7\n\n[Databases.tenant_a]\nName = \"a\"\n",
+	}
+	hosts := map[string]string{"config.yaml": "yaml-host", "config.yml": "yml-host", "config.toml": "toml-host"}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			dir := chdirTemp(t)
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("wanted nil but got %v", err)
+			}
+			if cfg.Database.Host != hosts[name] || cfg.Database.Driver != "postgres" {
+				t.Fatalf("unexpected database config %+v", cfg.Database)
+			}
+			if name == "config.toml" && cfg.Database.StatementCacheSize != 7 {
+				t.Fatalf("expected statement_cache_size to be loaded, got %d", cfg.Database.StatementCacheSize)
+			}
+			if name != "config.yml" {
+				if db, err := cfg.LookupDatabase("tenant_a"); err != nil || db.Name != "a" {
+					t.Fatalf("expected tenant_a to be loaded, got %+v (%v)", db, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	dir := chdirTemp(t)
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"Database": {"Host": "json-host"}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "config.toml"), []byte("[Database]\nHost = \"toml-host\"\n"), 0644)
+
+	cfg, err := LoadConfig()
+	if err != nil || cfg.Database.Host != "toml-host" {
+		t.Fatalf("expected config.toml to take precedence over config.json, got %+v (%v)", cfg, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("database:\n  host: yaml-host\n"), 0644)
+	cfg, err = LoadConfig()
+	if err != nil || cfg.Database.Host != "yaml-host" {
+		t.Fatalf("expected config.yaml to take precedence, got %+v (%v)", cfg, err)
+	}
+}
+
+func TestLoadConfig_EmbeddedFallback(t *testing.T) {
+	chdirTemp(t)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if cfg.Database.Name == "" {
+		t.Fatalf("expected the embedded config to be loaded, got %+v", cfg.Database)
+	}
+}
+
+func TestSaveConfig_KeepsFormat(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		t.Run(name, func(t *testing.T) {
+			dir := chdirTemp(t)
+			os.WriteFile(filepath.Join(dir, name), []byte(""), 0644)
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("wanted nil but got %v", err)
+			}
+			cfg.Database.Host = "saved-host"
+			if err := SaveConfig(cfg); err != nil {
+				t.Fatalf("wanted nil but got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "config.json")); err == nil {
+				t.Fatalf("SaveConfig must not create config.json next to %s", name)
+			}
+
+			reloaded, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("wanted nil but got %v", err)
+			}
+			if !reflect.DeepEqual(cfg, reloaded) {
+				t.Errorf("Saved and loaded configs do not match")
+				t.Errorf("Original: %+v", cfg)
+				t.Errorf("Loaded: %+v", reloaded)
+			}
+		})
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	dir := chdirTemp(t)
+
+	file, err := InitConfig("yaml", false)
+	if err != nil || file != "config.yaml" {
+		t.Fatalf("expected config.yaml to be written, got %q (%v)", file, err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil || cfg.Database.Name != "grayv" || cfg.Server.Port != 8080 {
+		t.Fatalf("expected the starter config to be loaded, got %+v (%v)", cfg, err)
+	}
+
+	if _, err := InitConfig("yaml", false); err == nil {
+		t.Fatalf("expected an existing config file not to be overwritten")
+	}
+	if _, err := InitConfig("yaml", true); err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if _, err := InitConfig("ini", false); err == nil {
+		t.Fatalf("expected an unsupported format to be rejected")
+	}
+
+	t.Setenv("GRAVORM_CONFIG_PATH", filepath.Join(dir, "conf", "grayv.toml"))
+	file, err = InitConfig("", false)
+	if err != nil || file != filepath.Join(dir, "conf", "grayv.toml") {
+		t.Fatalf("expected the file named by GRAVORM_CONFIG_PATH to be written, got %q (%v)", file, err)
+	}
+	if _, err := InitConfig("json", true); err == nil {
+		t.Fatalf("expected a format contradicting the file extension to be rejected")
+	}
+	cfg, err = LoadConfig()
+	if err != nil || cfg.Database.Name != "grayv" {
+		t.Fatalf("expected the config named by GRAVORM_CONFIG_PATH to be loaded, got %+v (%v)", cfg, err)
+	}
+}
@@ -0,0 +1,352 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment is the configuration of another environment, such as production, to compare the local one with.
+type Environment struct {
+	// Name describes where the configuration was read from.
+	Name string
+	// Settings are the settings of the environment, see Config.Settings. When EnvNames is set, they are keyed
+	// by the name of their environment variable instead, see EnvName, as read from a .env file.
+	Settings map[string]string
+	EnvNames bool
+}
+
+// LoadEnvironment reads the configuration of another environment from source, which is one of:
+//   - an http:// or https:// URL serving a configuration file, fetched with token as bearer token if not empty
+//   - k8s:[NAMESPACE/]SECRET[#KEY], the configuration file held by KEY of a Kubernetes secret, read with
+//     kubectl; without KEY, the secret must hold a single config.* key, or else environment variables
+//   - the path of a configuration file, or of a .env file holding environment variables
+//   - the name of an environment, e.g. prod, whose configuration file is config.prod.yaml, .yml, .toml or .json,
+//     or .env.prod, next to the local configuration
+//
+// The configuration is not resolved: secret references are compared as references. Defaults are applied.
+func LoadEnvironment(source, token string) (*Environment, error) {
+	switch {
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		return fetchEnvironment(source, token)
+	case strings.HasPrefix(source, "k8s:"):
+		return kubernetesEnvironment(strings.TrimPrefix(source, "k8s:"))
+	}
+	file := source
+	if !isConfigFile(file) && !isEnvFile(file) {
+		var found bool
+		if file, found = findEnvironmentFile(source); !found {
+			return nil, fmt.Errorf("no configuration of environment %q: looked for config.%[1]s.{yaml,yml,toml,json} and .env.%[1]s in %s",
+				source, configDir())
+		}
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the configuration of %s: %w", source, err)
+	}
+	return decodeEnvironment(file, file, data)
+}
+
+// configDir returns the directory of the local configuration.
+func configDir() string {
+	if configPath := GetConfigPath(); isConfigFile(configPath) {
+		return filepath.Dir(configPath)
+	}
+	return GetConfigPath()
+}
+
+// findEnvironmentFile returns the configuration file of the named environment.
+func findEnvironmentFile(name string) (string, bool) {
+	for _, file := range []string{"config." + name + ".yaml", "config." + name + ".yml", "config." + name + ".toml",
+		"config." + name + ".json", ".env." + name} {
+		file = filepath.Join(configDir(), file)
+		if _, err := os.Stat(file); err == nil {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// isEnvFile reports whether the path names a .env file: .env, .env.<name> or <name>.env.
+func isEnvFile(file string) bool {
+	base := filepath.Base(file)
+	return base == ".env" || strings.HasPrefix(base, ".env.") || strings.HasSuffix(base, ".env")
+}
+
+// decodeEnvironment decodes the configuration of an environment held by data, in the format indicated by the
+// extension of file.
+func decodeEnvironment(name, file string, data []byte) (*Environment, error) {
+	if isEnvFile(file) {
+		settings, err := parseEnvFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .env file %s: %w", name, err)
+		}
+		return &Environment{Name: name, Settings: settings, EnvNames: true}, nil
+	}
+	var cfg Config
+	if err := decodeConfig(file, data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse the configuration of %s: %w", name, err)
+	}
+	setDefaults(&cfg)
+	return &Environment{Name: name, Settings: cfg.Settings()}, nil
+}
+
+// parseEnvFile returns the variables of a .env file whose name starts with EnvPrefix. Lines hold NAME=VALUE,
+// optionally after "export", with the value optionally in single quotes, taken literally, or double quotes,
+// with Go escapes.
+func parseEnvFile(data []byte) (map[string]string, error) {
+	settings := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected NAME=VALUE", line)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+		if strings.HasPrefix(name, EnvPrefix) && value != "" {
+			settings[name] = value
+		}
+	}
+	return settings, scanner.Err()
+}
+
+// environmentClient is used to fetch the configuration of environments served over HTTP.
+var environmentClient = &http.Client{Timeout: 30 * time.Second}
+
+// fetchEnvironment fetches a configuration file, whose format is given by the extension of the path of the URL,
+// or else by the content type of the response, JSON by default.
+func fetchEnvironment(source, token string) (*Environment, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := environmentClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", u.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", u.Redacted(), resp.Status)
+	}
+
+	file := path.Base(u.Path)
+	if !isConfigFile(file) && !isEnvFile(file) {
+		file = "config.json"
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		switch {
+		case strings.Contains(mediaType, "yaml"):
+			file = "config.yaml"
+		case strings.Contains(mediaType, "toml"):
+			file = "config.toml"
+		}
+	}
+	return decodeEnvironment(u.Redacted(), file, body)
+}
+
+// kubectlGetSecret returns the data of a Kubernetes secret, base64-encoded by key.
+var kubectlGetSecret = func(namespace, name string) (map[string]string, error) {
+	args := []string{"get", "secret", name, "-o", "json"}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	output, err := exec.Command("kubectl", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("kubectl: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("kubectl: %w", err)
+	}
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(output, &secret); err != nil {
+		return nil, fmt.Errorf("failed to parse secret %s: %w", name, err)
+	}
+	return secret.Data, nil
+}
+
+// kubernetesEnvironment reads the configuration held by a Kubernetes secret, referenced as
+// [NAMESPACE/]SECRET[#KEY].
+func kubernetesEnvironment(reference string) (*Environment, error) {
+	secret, key, _ := strings.Cut(reference, "#")
+	namespace, name, found := strings.Cut(secret, "/")
+	if !found {
+		namespace, name = "", secret
+	}
+	data, err := kubectlGetSecret(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	decode := func(key string) ([]byte, error) {
+		value, err := base64.StdEncoding.DecodeString(data[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s of secret %s: %w", key, secret, err)
+		}
+		return value, nil
+	}
+
+	if key == "" {
+		for k := range data {
+			if isConfigFile(k) || isEnvFile(k) {
+				if key != "" {
+					return nil, fmt.Errorf("secret %s holds several configuration files: name one with #KEY", secret)
+				}
+				key = k
+			}
+		}
+	}
+	if key == "" {
+		// The secret holds the settings as environment variables.
+		settings := map[string]string{}
+		for k := range data {
+			if !strings.HasPrefix(k, EnvPrefix) {
+				continue
+			}
+			value, err := decode(k)
+			if err != nil {
+				return nil, err
+			}
+			if len(value) > 0 {
+				settings[k] = string(value)
+			}
+		}
+		return &Environment{Name: "k8s:" + reference, Settings: settings, EnvNames: true}, nil
+	}
+	if _, ok := data[key]; !ok {
+		return nil, fmt.Errorf("secret %s has no key %s", secret, key)
+	}
+	value, err := decode(key)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEnvironment("k8s:"+reference, key, value)
+}
+
+// The statuses of the differences returned by Diff.
+const (
+	// DiffChanged is the status of a setting with different values.
+	DiffChanged = "changed"
+	// DiffLocalOnly is the status of a setting only the local configuration has.
+	DiffLocalOnly = "local_only"
+	// DiffOtherOnly is the status of a setting only the other environment has.
+	DiffOtherOnly = "other_only"
+)
+
+// Difference is a setting whose value differs between the local configuration and another environment. The
+// values of secret settings are Redacted.
+type Difference struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Local  string `json:"local,omitempty"`
+	Other  string `json:"other,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// Diff returns the settings whose values differ between the local configuration and another environment,
+// sorted by key, leaving out those matching any of the ignore patterns (see path.Match, with "." separating
+// the elements of the paths, e.g. "Databases.*.Host"). Settings are keyed by environment variable when the
+// environment is.
+func Diff(local *Config, other *Environment, ignore []string) ([]Difference, error) {
+	for _, pattern := range ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	localSettings := local.Settings()
+	if other.EnvNames {
+		byEnv := make(map[string]string, len(localSettings))
+		for key, value := range localSettings {
+			byEnv[EnvName(key)] = value
+		}
+		localSettings = byEnv
+	}
+
+	keys := map[string]bool{}
+	for key := range localSettings {
+		keys[key] = true
+	}
+	for key := range other.Settings {
+		keys[key] = true
+	}
+	var differences []Difference
+	for key := range keys {
+		if ignored(key, ignore) {
+			continue
+		}
+		localValue, inLocal := localSettings[key]
+		otherValue, inOther := other.Settings[key]
+		d := Difference{Key: key, Local: localValue, Other: otherValue, Secret: IsSecretSetting(key)}
+		switch {
+		case localValue == otherValue:
+			continue
+		case !inOther:
+			d.Status = DiffLocalOnly
+		case !inLocal:
+			d.Status = DiffOtherOnly
+		default:
+			d.Status = DiffChanged
+		}
+		if d.Secret {
+			for _, value := range []*string{&d.Local, &d.Other} {
+				if *value != "" {
+					*value = Redacted
+				}
+			}
+		}
+		differences = append(differences, d)
+	}
+	sort.Slice(differences, func(i, j int) bool { return differences[i].Key < differences[j].Key })
+	return differences, nil
+}
+
+// ignored reports whether a key matches any of the patterns, with "." as separator.
+func ignored(key string, patterns []string) bool {
+	slashed := strings.ReplaceAll(key, ".", "/")
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ReplaceAll(pattern, ".", "/"), slashed); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadEnvironment_Name(t *testing.T) {
+	dir := chdirTemp(t)
+	os.WriteFile(filepath.Join(dir, "config.prod.yaml"), []byte("database:\n  host: db.prod\n  password: vault:secret/data/grayv#password\n"), 0644)
+
+	env, err := LoadEnvironment("prod", "")
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if env.EnvNames || env.Settings["Database.Host"] != "db.prod" || env.Settings["Database.Port"] != "5432" {
+		t.Fatalf("expected the settings of config.prod.yaml with defaults, got %+v", env)
+	}
+	if env.Settings["Database.Password"] != "vault:secret/data/grayv#password" {
+		t.Fatalf("expected the secret reference to be kept, got %q", env.Settings["Database.Password"])
+	}
+
+	if _, err := LoadEnvironment("staging", ""); err == nil {
+		t.Fatal("expected an error for an environment without configuration")
+	}
+}
+
+func TestLoadEnvironment_EnvFile(t *testing.T) {
+	dir := chdirTemp(t)
+	os.WriteFile(filepath.Join(dir, ".env.prod"), []byte(`# production
+export GRAYV_DATABASE_HOST=db.prod
+GRAYV_DATABASE_PASSWORD="s3cr\"et"
+GRAYV_LOGGING_LEVEL='warn'
+OTHER_VARIABLE=ignored
+`), 0644)
+
+	env, err := LoadEnvironment("prod", "")
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	want := map[string]string{"GRAYV_DATABASE_HOST": "db.prod", "GRAYV_DATABASE_PASSWORD": `s3cr"et`, "GRAYV_LOGGING_LEVEL": "warn"}
+	if !env.EnvNames || !reflect.DeepEqual(env.Settings, want) {
+		t.Fatalf("expected %v, got %+v", want, env)
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken.env"), []byte("GRAYV_DATABASE_HOST\n"), 0644)
+	if _, err := LoadEnvironment("broken.env", ""); err == nil {
+		t.Fatal("expected an error for a line without =")
+	}
+}
+
+func TestLoadEnvironment_HTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write([]byte("server:\n  port: 9090\n"))
+	}))
+	defer server.Close()
+
+	env, err := LoadEnvironment(server.URL+"/config", "token")
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if env.Settings["Server.Port"] != "9090" {
+		t.Fatalf("expected the fetched settings, got %v", env.Settings)
+	}
+	if _, err := LoadEnvironment(server.URL+"/config", ""); err == nil {
+		t.Fatal("expected an error without the token")
+	}
+}
+
+func TestLoadEnvironment_Kubernetes(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	secrets := map[string]map[string]string{
+		"prod/grayv-config": {"config.json": encode(`{"Database": {"Host": "db.prod"}}`)},
+		"/grayv-env":        {"GRAYV_DATABASE_HOST": encode("db.env"), "UNRELATED": encode("x")},
+	}
+	saved := kubectlGetSecret
+	kubectlGetSecret = func(namespace, name string) (map[string]string, error) {
+		return secrets[namespace+"/"+name], nil
+	}
+	t.Cleanup(func() { kubectlGetSecret = saved })
+
+	env, err := LoadEnvironment("k8s:prod/grayv-config", "")
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if env.EnvNames || env.Settings["Database.Host"] != "db.prod" {
+		t.Fatalf("expected the settings of config.json, got %+v", env)
+	}
+
+	env, err = LoadEnvironment("k8s:grayv-env", "")
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if !env.EnvNames || !reflect.DeepEqual(env.Settings, map[string]string{"GRAYV_DATABASE_HOST": "db.env"}) {
+		t.Fatalf("expected the environment variables of the secret, got %+v", env)
+	}
+
+	if _, err := LoadEnvironment("k8s:prod/grayv-config#config.yaml", ""); err == nil {
+		t.Fatal("expected an error for a missing key")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	local := &Config{
+		Database: DatabaseConfig{Host: "localhost", Port: 5432, Password: "local-secret", SSLMode: "disable"},
+		Logging:  LoggingConfig{Level: "debug", File: "app.log"},
+	}
+	other := &Environment{Settings: map[string]string{
+		"Database.Host":     "db.prod",
+		"Database.Port":     "5432",
+		"Database.Password": "prod-secret",
+		"Database.SSLMode":  "require",
+		"Logging.Level":     "warn",
+		"Search.URL":        "http://search",
+	}}
+
+	differences, err := Diff(local, other, []string{"Database.SSL*"})
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	want := []Difference{
+		{Key: "Database.Host", Status: DiffChanged, Local: "localhost", Other: "db.prod"},
+		{Key: "Database.Password", Status: DiffChanged, Local: Redacted, Other: Redacted, Secret: true},
+		{Key: "Logging.File", Status: DiffLocalOnly, Local: "app.log"},
+		{Key: "Logging.Level", Status: DiffChanged, Local: "debug", Other: "warn"},
+		{Key: "Search.URL", Status: DiffOtherOnly, Other: "http://search"},
+	}
+	if !reflect.DeepEqual(differences, want) {
+		t.Fatalf("expected %+v, got %+v", want, differences)
+	}
+
+	differences, _ = Diff(local, &Environment{EnvNames: true, Settings: map[string]string{
+		"GRAYV_DATABASE_HOST": "localhost", "GRAYV_DATABASE_PORT": "5432", "GRAYV_DATABASE_PASSWORD": "local-secret",
+		"GRAYV_DATABASE_SSLMODE": "disable", "GRAYV_LOGGING_LEVEL": "debug", "GRAYV_LOGGING_FILE": "app.log",
+	}}, nil)
+	if len(differences) != 0 {
+		t.Fatalf("expected no differences, got %+v", differences)
+	}
+
+	if _, err := Diff(local, other, []string{"["}); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyEnvironment overrides the settings of the configuration with the environment variables named after
+// them, see EnvName, e.g. GRAYV_DATABASE_HOST for Database.Host. Lists of values are given comma-separated.
+// The entries of maps and lists of structs can be overridden but not added, as their keys cannot be told
+// apart in the variable names.
+func applyEnvironment(cfg *Config) error {
+	return walkSettings("", reflect.ValueOf(cfg).Elem(), func(path string, v reflect.Value) error {
+		value, ok := os.LookupEnv(EnvName(path))
+		if !ok {
+			return nil
+		}
+		original := reflect.New(v.Type()).Elem()
+		original.Set(v)
+		if err := parseSetting(v, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvName(path), err)
+		}
+		if cfg.overrides == nil {
+			cfg.overrides = make(map[string]envOverride)
+		}
+		cfg.overrides[path] = envOverride{original: original, value: v.Interface()}
+		return nil
+	})
+}
+
+// envOverride is a setting applyEnvironment overrode: its value in the configuration file and its value from
+// the environment.
+type envOverride struct {
+	original reflect.Value
+	value    interface{}
+}
+
+// withoutEnvironment returns a copy of the configuration in which every setting overridden by the environment
+// and not changed since loading is given its value in the configuration file again.
+func (c *Config) withoutEnvironment() *Config {
+	if len(c.overrides) == 0 {
+		return c
+	}
+	out := *c
+	walkSettings("", reflect.ValueOf(&out).Elem(), func(path string, v reflect.Value) error {
+		if override, ok := c.overrides[path]; ok && reflect.DeepEqual(v.Interface(), override.value) {
+			v.Set(override.original)
+		}
+		return nil
+	})
+	return &out
+}
+
+// walkSettings calls visit with every setting of v, the settable value at the given path: the strings,
+// numbers, booleans and lists of them it holds. The maps and lists of structs of v are replaced by copies, so
+// that visit can set the settings of a shallow copy of a configuration without changing the original.
+func walkSettings(path string, v reflect.Value, visit func(path string, v reflect.Value) error) error {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+	switch {
+	case v.Kind() == reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() {
+				if err := walkSettings(join(field.Name), v.Field(i), visit); err != nil {
+					return err
+				}
+			}
+		}
+	case v.Kind() == reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := walkSettings(join(key.String()), elem, visit); err != nil {
+				return err
+			}
+			copied.SetMapIndex(key, elem)
+		}
+		v.Set(copied)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		if v.IsNil() {
+			return nil
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		for i := 0; i < copied.Len(); i++ {
+			if err := walkSettings(join(strconv.Itoa(i)), copied.Index(i), visit); err != nil {
+				return err
+			}
+		}
+		v.Set(copied)
+	default:
+		return visit(path, v)
+	}
+	return nil
+}
+
+// parseSetting sets a setting from its text, a comma-separated list for lists.
+func parseSetting(v reflect.Value, text string) error {
+	if v.Kind() != reflect.Slice {
+		return parseScalar(v, text)
+	}
+	var fields []string
+	if text != "" {
+		fields = strings.Split(text, ",")
+	}
+	values := reflect.MakeSlice(v.Type(), len(fields), len(fields))
+	for i, field := range fields {
+		if err := parseScalar(values.Index(i), strings.TrimSpace(field)); err != nil {
+			return err
+		}
+	}
+	v.Set(values)
+	return nil
+}
+
+// parseScalar sets a string, number or boolean from its text.
+func parseScalar(v reflect.Value, text string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// EnvVar is a setting of the configuration as an environment variable.
+type EnvVar struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// EnvVars returns the settings of the configuration as environment variables, sorted by name, which LoadConfig
+// reads back over the configuration file. Secrets are given as configured, as references where they are,
+// unless resolved is set, in which case they are given as LoadConfig resolved them.
+func (c *Config) EnvVars(resolved bool) []EnvVar {
+	settings := c.Settings()
+	if resolved {
+		settings = map[string]string{}
+		flatten(settings, "", reflect.ValueOf(*c))
+	}
+	vars := make([]EnvVar, 0, len(settings))
+	for key, value := range settings {
+		vars = append(vars, EnvVar{Name: EnvName(key), Key: key, Value: value, Secret: IsSecretSetting(key)})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// plainEnvValue matches the values written to .env files without quotes.
+var plainEnvValue = regexp.MustCompile(`^[A-Za-z0-9_./:@,+=-]*$`)
+
+// RenderDotenv renders environment variables as a .env file, quoting the values that need it.
+func RenderDotenv(vars []EnvVar) string {
+	var b strings.Builder
+	for _, v := range vars {
+		value := v.Value
+		if !plainEnvValue.MatchString(value) {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", v.Name, value)
+	}
+	return b.String()
+}
+
+// kubernetesObject is a Kubernetes ConfigMap or Secret.
+type kubernetesObject struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   kubernetesMetadata `yaml:"metadata"`
+	Type       string             `yaml:"type,omitempty"`
+	Data       map[string]string  `yaml:"data,omitempty"`
+	StringData map[string]string  `yaml:"stringData,omitempty"`
+}
+
+type kubernetesMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// RenderKubernetes renders environment variables as the YAML of a Kubernetes ConfigMap holding the settings,
+// and of a Secret holding the secrets, if any, both called name, to load into a container with envFrom.
+func RenderKubernetes(vars []EnvVar, name, namespace string) (string, error) {
+	configMap := kubernetesObject{APIVersion: "v1", Kind: "ConfigMap", Metadata: kubernetesMetadata{name, namespace},
+		Data: map[string]string{}}
+	secret := kubernetesObject{APIVersion: "v1", Kind: "Secret", Metadata: kubernetesMetadata{name, namespace},
+		Type: "Opaque", StringData: map[string]string{}}
+	for _, v := range vars {
+		if v.Secret {
+			secret.StringData[v.Name] = v.Value
+		} else {
+			configMap.Data[v.Name] = v.Value
+		}
+	}
+
+	var docs []string
+	for _, object := range []kubernetesObject{configMap, secret} {
+		if object.Kind == "Secret" && len(object.StringData) == 0 {
+			continue
+		}
+		out, err := yaml.Marshal(object)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, string(out))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_Environment(t *testing.T) {
+	chdirTemp(t)
+	data := "database:\n  host: db\n  port: 5432\ndatabases:\n  tenant_a:\n    host: tenant-db\nserver:\n  middleware:\n    cors_origins: [https://a.example]\n"
+	if err := os.WriteFile("config.yaml", []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GRAYV_DATABASE_HOST", "prod-db")
+	t.Setenv("GRAYV_DATABASE_PORT", "6543")
+	t.Setenv("GRAYV_DATABASES_TENANT_A_HOST", "prod-tenant-db")
+	t.Setenv("GRAYV_SERVER_MIDDLEWARE_CORSORIGINS", "https://a.example, https://b.example")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if cfg.Database.Host != "prod-db" || cfg.Database.Port != 6543 || cfg.Databases["tenant_a"].Host != "prod-tenant-db" {
+		t.Fatalf("environment not applied: %+v", cfg)
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !reflect.DeepEqual(cfg.Server.Middleware.CORSOrigins, want) {
+		t.Fatalf("expected %v, got %v", want, cfg.Server.Middleware.CORSOrigins)
+	}
+
+	// Saving keeps the values of the file, except for the settings changed since loading.
+	cfg.Database.Port = 7000
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if cfg.Databases["tenant_a"].Host != "prod-tenant-db" {
+		t.Fatalf("saving changed the configuration: %+v", cfg.Databases)
+	}
+	for _, name := range []string{"GRAYV_DATABASE_HOST", "GRAYV_DATABASE_PORT", "GRAYV_DATABASES_TENANT_A_HOST", "GRAYV_SERVER_MIDDLEWARE_CORSORIGINS"} {
+		os.Unsetenv(name)
+	}
+	saved, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if saved.Database.Host != "db" || saved.Database.Port != 7000 || saved.Databases["tenant_a"].Host != "tenant-db" {
+		t.Fatalf("unexpected saved configuration: %+v", saved)
+	}
+
+	t.Setenv("GRAYV_DATABASE_PORT", "not-a-port")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "GRAYV_DATABASE_PORT") {
+		t.Fatalf("expected an error naming GRAYV_DATABASE_PORT, got %v", err)
+	}
+}
+
+func TestConfig_EnvVars(t *testing.T) {
+	cfg := &Config{Database: DatabaseConfig{Host: "db", Password: "secret"}}
+	cfg.recordSecret("Database.Password", "env:DB_PASSWORD", "secret")
+
+	want := []EnvVar{
+		{Name: "GRAYV_DATABASE_HOST", Key: "Database.Host", Value: "db"},
+		{Name: "GRAYV_DATABASE_PASSWORD", Key: "Database.Password", Value: "env:DB_PASSWORD", Secret: true},
+	}
+	if got := cfg.EnvVars(false); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got := cfg.EnvVars(true); got[1].Value != "secret" {
+		t.Fatalf("expected the resolved password, got %q", got[1].Value)
+	}
+}
+
+func TestRenderDotenv(t *testing.T) {
+	got := RenderDotenv([]EnvVar{
+		{Name: "GRAYV_DATABASE_HOST", Value: "db.example.com"},
+		{Name: "GRAYV_LOGGING_COMMANDS_DB_MIGRATE", Value: "debug level"},
+		{Name: "GRAYV_DATABASE_PASSWORD", Value: `p"w`, Secret: true},
+	})
+	want := "GRAYV_DATABASE_HOST=db.example.com\nGRAYV_LOGGING_COMMANDS_DB_MIGRATE=\"debug level\"\nGRAYV_DATABASE_PASSWORD=\"p\\\"w\"\n"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	// The .env file reads back.
+	settings, err := parseEnvFile([]byte(got))
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if settings["GRAYV_DATABASE_PASSWORD"] != `p"w` || settings["GRAYV_LOGGING_COMMANDS_DB_MIGRATE"] != "debug level" {
+		t.Fatalf("unexpected settings %v", settings)
+	}
+}
+
+func TestRenderKubernetes(t *testing.T) {
+	got, err := RenderKubernetes([]EnvVar{
+		{Name: "GRAYV_DATABASE_PORT", Value: "5432"},
+		{Name: "GRAYV_DATABASE_PASSWORD", Value: "secret", Secret: true},
+	}, "grayv", "prod")
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+    name: grayv
+    namespace: prod
+data:
+    GRAYV_DATABASE_PORT: "5432"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+    name: grayv
+    namespace: prod
+type: Opaque
+stringData:
+    GRAYV_DATABASE_PASSWORD: secret
+`
+	if got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	got, err = RenderKubernetes([]EnvVar{{Name: "GRAYV_DATABASE_PORT", Value: "5432"}}, "grayv", "")
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if strings.Contains(got, "Secret") {
+		t.Fatalf("expected no Secret without secrets, got\n%s", got)
+	}
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretResolver resolves references to secrets kept outside the configuration file. A database User or
+// Password, or an encryption key, of the form "<scheme>:<reference>" is resolved by the resolver registered for
+// the scheme when the configuration is loaded. The built-in schemes are:
+//   - env:NAME reads the environment variable NAME
+//   - file:PATH reads the file at PATH, without its trailing newline
+//   - vault:PATH#KEY reads KEY of the HashiCorp Vault secret at PATH, using VAULT_ADDR and VAULT_TOKEN
+//   - aws-sm:ID[#KEY] reads the AWS Secrets Manager secret ID, or KEY of it when it holds a JSON object, using
+//     the aws CLI and its credentials
+type SecretResolver interface {
+	Resolve(reference string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to the SecretResolver interface.
+type SecretResolverFunc func(reference string) (string, error)
+
+// Resolve calls f(reference).
+func (f SecretResolverFunc) Resolve(reference string) (string, error) {
+	return f(reference)
+}
+
+var (
+	secretResolversMu sync.RWMutex
+	secretResolvers   = map[string]SecretResolver{
+		"env":    SecretResolverFunc(resolveEnvSecret),
+		"file":   SecretResolverFunc(resolveFileSecret),
+		"vault":  SecretResolverFunc(resolveVaultSecret),
+		"aws-sm": SecretResolverFunc(resolveAWSSecret),
+	}
+)
+
+// RegisterSecretResolver makes a resolver available under the given scheme, replacing the resolver previously
+// registered for it.
+func RegisterSecretResolver(scheme string, resolver SecretResolver) {
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+	secretResolvers[scheme] = resolver
+}
+
+// lookupSecretResolver returns the resolver for the scheme a value refers to, if the value is a secret
+// reference. Values with an unregistered scheme are not references and are used literally.
+func lookupSecretResolver(value string) (resolver SecretResolver, reference string, ok bool) {
+	scheme, reference, found := strings.Cut(value, ":")
+	if !found {
+		return nil, "", false
+	}
+	secretResolversMu.RLock()
+	defer secretResolversMu.RUnlock()
+	resolver, ok = secretResolvers[scheme]
+	return resolver, reference, ok
+}
+
+// resolvedSecret remembers the configured form of a resolved value so SaveConfig writes the reference back
+// instead of the secret.
+type resolvedSecret struct {
+	configured string
+	value      string
+}
+
+// resolveSecrets resolves the secret references of the primary and every named database and of the
+// encryption keys.
+func resolveSecrets(cfg *Config) error {
+	for id, key := range cfg.Encryption.Keys {
+		resolver, reference, ok := lookupSecretResolver(key)
+		if !ok {
+			continue
+		}
+		resolved, err := resolver.Resolve(reference)
+		if err != nil {
+			return fmt.Errorf("failed to resolve Encryption.Keys.%s: %w", id, err)
+		}
+		cfg.recordSecret("Encryption.Keys."+id, key, resolved)
+		cfg.Encryption.Keys[id] = resolved
+	}
+
+	if err := resolveDatabaseSecrets(cfg, "Database", &cfg.Database); err != nil {
+		return err
+	}
+	for name, db := range cfg.Databases {
+		if err := resolveDatabaseSecrets(cfg, "Databases."+name, &db); err != nil {
+			return err
+		}
+		cfg.Databases[name] = db
+	}
+	return nil
+}
+
+// resolveDatabaseSecrets resolves the User and Password of a database. A PasswordFile is read when no Password
+// is configured.
+func resolveDatabaseSecrets(cfg *Config, key string, db *DatabaseConfig) error {
+	if db.Password == "" && db.PasswordFile != "" {
+		password, err := resolveFileSecret(db.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s.PasswordFile: %w", key, err)
+		}
+		cfg.recordSecret(key+".Password", "", password)
+		db.Password = password
+	}
+
+	for field, value := range map[string]*string{"User": &db.User, "Password": &db.Password} {
+		resolver, reference, ok := lookupSecretResolver(*value)
+		if !ok {
+			continue
+		}
+		resolved, err := resolver.Resolve(reference)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s.%s: %w", key, field, err)
+		}
+		cfg.recordSecret(key+"."+field, *value, resolved)
+		*value = resolved
+	}
+	return nil
+}
+
+func (c *Config) recordSecret(key, configured, value string) {
+	if c.secrets == nil {
+		c.secrets = make(map[string]resolvedSecret)
+	}
+	c.secrets[key] = resolvedSecret{configured: configured, value: value}
+}
+
+// withSecretReferences returns a copy of the configuration in which every resolved value that was not changed
+// since loading is replaced by its configured form.
+func (c *Config) withSecretReferences() *Config {
+	if len(c.secrets) == 0 {
+		return c
+	}
+	out := *c
+	out.Databases = make(map[string]DatabaseConfig, len(c.Databases))
+	for name, db := range c.Databases {
+		restoreSecrets(c.secrets, "Databases."+name, &db)
+		out.Databases[name] = db
+	}
+	if c.Databases == nil {
+		out.Databases = nil
+	}
+	restoreSecrets(c.secrets, "Database", &out.Database)
+	if c.Encryption.Keys != nil {
+		out.Encryption.Keys = make(map[string]string, len(c.Encryption.Keys))
+		for id, key := range c.Encryption.Keys {
+			if secret, ok := c.secrets["Encryption.Keys."+id]; ok && secret.value == key {
+				key = secret.configured
+			}
+			out.Encryption.Keys[id] = key
+		}
+	}
+	return &out
+}
+
+func restoreSecrets(secrets map[string]resolvedSecret, key string, db *DatabaseConfig) {
+	for field, value := range map[string]*string{"User": &db.User, "Password": &db.Password} {
+		if secret, ok := secrets[key+"."+field]; ok && secret.value == *value {
+			*value = secret.configured
+		}
+	}
+}
+
+func resolveEnvSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func resolveFileSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// vaultClient is used for requests to Vault.
+var vaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// resolveVaultSecret reads a key of a secret from Vault. Secrets of both KV version 1 and version 2 engines
+// are supported; the path of a version 2 secret includes "data/", e.g. "secret/data/grayv#password".
+func resolveVaultSecret(reference string) (string, error) {
+	path, key, found := strings.Cut(reference, "#")
+	if !found || key == "" {
+		return "", fmt.Errorf("vault reference %q must name a key, e.g. secret/data/grayv#password", reference)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from vault: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from vault: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read %s from vault: %s", path, resp.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse vault secret %s: %w", path, err)
+	}
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	return secretKey(data, key, path)
+}
+
+// awsGetSecretValue returns the SecretString of an AWS Secrets Manager secret.
+var awsGetSecretValue = func(secretID string) (string, error) {
+	output, err := exec.Command("aws", "secretsmanager", "get-secret-value",
+		"--secret-id", secretID, "--query", "SecretString", "--output", "text").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("aws secretsmanager: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("aws secretsmanager: %w", err)
+	}
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// resolveAWSSecret reads a secret from AWS Secrets Manager. With a key, the secret must hold a JSON object,
+// such as the ones RDS creates, and the key's value is returned.
+func resolveAWSSecret(reference string) (string, error) {
+	secretID, key, hasKey := strings.Cut(reference, "#")
+	value, err := awsGetSecretValue(secretID)
+	if err != nil {
+		return "", err
+	}
+	if !hasKey {
+		return value, nil
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return "", fmt.Errorf("secret %s does not hold a JSON object: %w", secretID, err)
+	}
+	return secretKey(data, key, secretID)
+}
+
+func secretKey(data map[string]interface{}, key, secret string) (string, error) {
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", secret, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_ResolvesSecrets(t *testing.T) {
+	dir := chdirTemp(t)
+	passwordFile := filepath.Join(dir, "db_password")
+	os.WriteFile(passwordFile, []byte("from-file\n"), 0600)
+	t.Setenv("TEST_DB_USER", "from-env")
+	os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`database:
+  user: env:TEST_DB_USER
+  password_file: `+passwordFile+`
+databases:
+  reporting:
+    password: file:`+passwordFile+`
+encryption:
+  primary: k1
+  keys:
+    k1: env:TEST_ENCRYPTION_KEY
+`), 0644)
+	t.Setenv("TEST_ENCRYPTION_KEY", "from-env-key")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if cfg.Database.User != "from-env" || cfg.Database.Password != "from-file" {
+		t.Fatalf("expected resolved credentials, got %+v", cfg.Database)
+	}
+	if db, _ := cfg.LookupDatabase("reporting"); db.Password != "from-file" {
+		t.Fatalf("expected the reporting password to be resolved, got %q", db.Password)
+	}
+	if cfg.Encryption.Keys["k1"] != "from-env-key" {
+		t.Fatalf("expected the encryption key to be resolved, got %+v", cfg.Encryption)
+	}
+
+	// Saving keeps the references instead of writing the secrets to the file.
+	cfg.Database.Host = "saved-host"
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "config.yaml"))
+	if strings.Contains(string(data), "from-") || !strings.Contains(string(data), "env:TEST_DB_USER") ||
+		!strings.Contains(string(data), "env:TEST_ENCRYPTION_KEY") {
+		t.Fatalf("expected secret references to be saved, got:\n%s", data)
+	}
+	if cfg.Database.User != "from-env" {
+		t.Fatalf("SaveConfig must not modify the loaded config, got %+v", cfg.Database)
+	}
+
+	// A changed value replaces the reference.
+	cfg.Database.User = "literal"
+	SaveConfig(cfg)
+	if reloaded, err := LoadConfig(); err != nil || reloaded.Database.User != "literal" || reloaded.Database.Password != "from-file" {
+		t.Fatalf("expected the changed user to be saved, got %+v (%v)", reloaded, err)
+	}
+}
+
+func TestLoadConfig_PasswordFileTOML(t *testing.T) {
+	dir := chdirTemp(t)
+	passwordFile := filepath.Join(dir, "db_password")
+	os.WriteFile(passwordFile, []byte("from-file\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "config.toml"), []byte("[Database]\npassword_file = \""+passwordFile+"\"\n"), 0644)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("wanted nil but got %v", err)
+	}
+	if cfg.Database.Password != "from-file" {
+		t.Fatalf("expected the password of password_file, got %q", cfg.Database.Password)
+	}
+}
+
+func TestLoadConfig_UnresolvableSecret(t *testing.T) {
+	dir := chdirTemp(t)
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"Database": {"Password": "env:TEST_DB_MISSING"}}`), 0644)
+
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "TEST_DB_MISSING") {
+		t.Fatalf("expected an error naming the missing variable, got %v", err)
+	}
+}
+
+func TestRegisterSecretResolver(t *testing.T) {
+	dir := chdirTemp(t)
+	RegisterSecretResolver("test", SecretResolverFunc(func(reference string) (string, error) {
+		return strings.ToUpper(reference), nil
+	}))
+	t.Cleanup(func() {
+		secretResolversMu.Lock()
+		delete(secretResolvers, "test")
+		secretResolversMu.Unlock()
+	})
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"Database": {"Password": "test:secret", "User": "plain:user"}}`), 0644)
+
+	cfg, err := LoadConfig()
+	if err != nil || cfg.Database.Password != "SECRET" || cfg.Database.User != "plain:user" {
+		t.Fatalf("expected only registered schemes to be resolved, got %+v (%v)", cfg, err)
+	}
+}
+
+func TestResolveVaultSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/grayv":
+			w.Write([]byte(`{"data": {"data": {"password": "kv2"}, "metadata": {}}}`))
+		case "/v1/kv/grayv":
+			w.Write([]byte(`{"data": {"password": "kv1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+
+	for reference, want := range map[string]string{"secret/data/grayv#password": "kv2", "kv/grayv#password": "kv1"} {
+		if got, err := resolveVaultSecret(reference); err != nil || got != want {
+			t.Fatalf("resolveVaultSecret(%q) = %q, %v; want %q", reference, got, err, want)
+		}
+	}
+	for _, reference := range []string{"secret/data/grayv", "secret/data/grayv#user", "secret/data/missing#password"} {
+		if _, err := resolveVaultSecret(reference); err == nil {
+			t.Fatalf("expected resolveVaultSecret(%q) to fail", reference)
+		}
+	}
+}
+
+func TestResolveAWSSecret(t *testing.T) {
+	original := awsGetSecretValue
+	t.Cleanup(func() { awsGetSecretValue = original })
+	awsGetSecretValue = func(secretID string) (string, error) {
+		if secretID == "rds/grayv" {
+			return `{"username": "grayv", "password": "aws"}`, nil
+		}
+		return "plain", nil
+	}
+
+	if got, err := resolveAWSSecret("rds/grayv#password"); err != nil || got != "aws" {
+		t.Fatalf("expected the password key, got %q (%v)", got, err)
+	}
+	if got, err := resolveAWSSecret("other"); err != nil || got != "plain" {
+		t.Fatalf("expected the whole secret, got %q (%v)", got, err)
+	}
+	if _, err := resolveAWSSecret("other#password"); err == nil {
+		t.Fatalf("expected a key of a non-JSON secret to fail")
+	}
+}
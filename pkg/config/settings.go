@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix prefixes the names of the environment variables of settings, see EnvName.
+const EnvPrefix = "GRAYV_"
+
+// Redacted replaces the values of secret settings wherever they are shown.
+const Redacted = "[redacted]"
+
+// Settings returns the settings of the configuration by dotted path, e.g. "Database.Host" or
+// "Databases.tenant_a.Port", with the keys of maps and the indexes of lists of structs as path elements, and
+// lists of values joined with commas. Settings with a zero value are left out. Secrets resolved by LoadConfig
+// are given in their configured form, so the settings hold references rather than the secrets they resolved
+// to.
+func (c *Config) Settings() map[string]string {
+	settings := map[string]string{}
+	flatten(settings, "", reflect.ValueOf(*c.withSecretReferences()))
+	return settings
+}
+
+// flatten adds the settings of v, a value at the given path, to settings.
+func flatten(settings map[string]string, path string, v reflect.Value) {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() {
+				flatten(settings, join(field.Name), v.Field(i))
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			flatten(settings, join(key.String()), v.MapIndex(key))
+		}
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return
+		}
+		if v.Type().Elem().Kind() == reflect.Struct {
+			for i := 0; i < v.Len(); i++ {
+				flatten(settings, join(strconv.Itoa(i)), v.Index(i))
+			}
+			return
+		}
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = scalar(v.Index(i))
+		}
+		settings[path] = strings.Join(values, ",")
+	default:
+		if !v.IsZero() {
+			settings[path] = scalar(v)
+		}
+	}
+}
+
+// scalar formats a string, number or boolean.
+func scalar(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// EnvName returns the name of the environment variable of a setting: its path in upper case, prefixed with
+// EnvPrefix, with the characters other than letters and digits replaced with underscores, e.g.
+// GRAYV_DATABASE_HOST for Database.Host.
+func EnvName(key string) string {
+	return EnvPrefix + strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToUpper(key), "_"), "_")
+}
+
+// IsSecretSetting reports whether a setting, named by its path or its environment variable, holds a secret: a
+// database password, an encryption key or an API key. Their values are redacted wherever they are shown.
+func IsSecretSetting(key string) bool {
+	name := strings.TrimPrefix(EnvName(strings.TrimPrefix(key, EnvPrefix)), EnvPrefix)
+	return strings.HasSuffix(name, "_PASSWORD") || strings.HasSuffix(name, "_APIKEY") ||
+		strings.HasPrefix(name, "ENCRYPTION_KEYS_")
+}
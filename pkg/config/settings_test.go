@@ -0,0 +1,65 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfig_Settings(t *testing.T) {
+	cfg := &Config{
+		Database: DatabaseConfig{Driver: "postgres", Host: "db", Port: 5432, Password: "secret",
+			Replicas: []ReplicaConfig{{Host: "replica-1"}}},
+		Databases: map[string]DatabaseConfig{"tenant_a": {Name: "tenant_a"}},
+		Server:    ServerConfig{Middleware: MiddlewareConfig{Gzip: true, CORSOrigins: []string{"https://a.example", "https://b.example"}}},
+		Metrics:   MetricsConfig{Buckets: []float64{0.005, 1}},
+		Logging:   LoggingConfig{Commands: map[string]string{"db migrate": "debug"}},
+	}
+	cfg.recordSecret("Database.Password", "env:DB_PASSWORD", "secret")
+
+	want := map[string]string{
+		"Database.Driver":               "postgres",
+		"Database.Host":                 "db",
+		"Database.Port":                 "5432",
+		"Database.Password":             "env:DB_PASSWORD",
+		"Database.Replicas.0.Host":      "replica-1",
+		"Databases.tenant_a.Name":       "tenant_a",
+		"Server.Middleware.Gzip":        "true",
+		"Server.Middleware.CORSOrigins": "https://a.example,https://b.example",
+		"Metrics.Buckets":               "0.005,1",
+		"Logging.Commands.db migrate":   "debug",
+	}
+	if got := cfg.Settings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for key, want := range map[string]string{
+		"Database.Host":               "GRAYV_DATABASE_HOST",
+		"Databases.tenant_a.Port":     "GRAYV_DATABASES_TENANT_A_PORT",
+		"Logging.Commands.db migrate": "GRAYV_LOGGING_COMMANDS_DB_MIGRATE",
+	} {
+		if got := EnvName(key); got != want {
+			t.Errorf("EnvName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestIsSecretSetting(t *testing.T) {
+	for key, want := range map[string]bool{
+		"Database.Password":           true,
+		"Databases.tenant_a.Password": true,
+		"GRAYV_DATABASE_PASSWORD":     true,
+		"Encryption.Keys.k1":          true,
+		"GRAYV_ENCRYPTION_KEYS_K1":    true,
+		"Search.APIKey":               true,
+		"Database.PasswordFile":       false,
+		"Database.User":               false,
+		"Encryption.Primary":          false,
+		"GRAYV_SEARCH_URL":            false,
+	} {
+		if got := IsSecretSetting(key); got != want {
+			t.Errorf("IsSecretSetting(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
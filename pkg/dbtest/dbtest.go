@@ -0,0 +1,138 @@
+// Package dbtest gives the integration tests of apps scaffolded by "grayv-lsm app new" a database of their
+// own: a temporary Postgres database migrated like the app's, filled with YAML fixtures keyed by model name,
+// and dropped when the test ends.
+//
+//	func TestPosts(t *testing.T) {
+//		db := dbtest.New(t, dbtest.Options{Migrations: myapp.Files})
+//		dbtest.Load(t, db, "testdata/posts.yaml", &models.User{}, &models.Post{})
+//		repo := models.NewPostRepository(db)
+//		...
+//	}
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ooyeku/grayv-lsm/internal/database/ephemeral"
+	"github.com/ooyeku/grayv-lsm/pkg/appdb"
+)
+
+// URLEnv is the environment variable holding the URL of the Postgres server test databases are created on,
+// unless Options name one.
+const URLEnv = "TEST_DATABASE_URL"
+
+// DefaultImage is the image of the Postgres container started when no server is configured.
+const DefaultImage = ephemeral.DefaultImage
+
+// Options configure the databases created by New.
+type Options struct {
+	// URL is the postgres:// URL of a server the test may create databases on, the value of URLEnv if empty.
+	// Without either, a container of Image is started with docker for the test, and the test is skipped if
+	// docker is not installed.
+	URL string
+	// Image is the image of the container, DefaultImage if empty.
+	Image string
+	// Migrations holds the "migrations" directory applied to the database, such as the Files of the app,
+	// with the migrations of grayv-lsm; only the latter are applied when nil.
+	Migrations fs.FS
+	// Timeout bounds the start of the container and the migrations, a minute if 0.
+	Timeout time.Duration
+}
+
+// New creates an empty database, applies the migrations to it and returns it. The database is dropped, and
+// the container started for it stopped, when the test ends. New fails the test if the database cannot be
+// created or migrated.
+func New(t testing.TB, options Options) *sql.DB {
+	t.Helper()
+	if options.Timeout == 0 {
+		options.Timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
+	defer cancel()
+
+	serverURL := options.URL
+	if serverURL == "" {
+		serverURL = os.Getenv(URLEnv)
+	}
+	if serverURL == "" {
+		serverURL = startContainer(ctx, t, options.Image)
+	}
+	server, err := sql.Open("postgres", serverURL)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	name := "grayv_test_" + randomSuffix()
+	if _, err := server.ExecContext(ctx, "CREATE DATABASE "+pq.QuoteIdentifier(name)); err != nil {
+		t.Fatalf("dbtest: failed to create the test database: %v", err)
+	}
+	testURL, err := withDatabase(serverURL, name)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	db, err := sql.Open("postgres", testURL)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	// Cleanups run last in, first out: the pool is closed before its database is dropped.
+	t.Cleanup(func() {
+		if _, err := server.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(name)); err != nil {
+			t.Errorf("dbtest: failed to drop the test database %s: %v", name, err)
+		}
+	})
+	t.Cleanup(func() { db.Close() })
+
+	migrations := options.Migrations
+	if migrations == nil {
+		migrations = fstest.MapFS{}
+	}
+	if err := appdb.Migrate(ctx, db, migrations); err != nil {
+		t.Fatalf("dbtest: failed to migrate the test database: %v", err)
+	}
+	return db
+}
+
+// withDatabase returns a postgres:// URL naming another database of the same server.
+func withDatabase(serverURL, name string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return "", fmt.Errorf("the server URL must be a postgres:// URL, got %q", serverURL)
+	}
+	u.Path = "/" + name
+	return u.String(), nil
+}
+
+// startContainer starts a Postgres container stopped when the test ends, and returns the URL of its server
+// once it accepts connections. It skips the test if docker is not installed.
+func startContainer(ctx context.Context, t testing.TB, image string) string {
+	t.Helper()
+	container, err := ephemeral.Start(ctx, image)
+	if errors.Is(err, ephemeral.ErrNoDocker) {
+		t.Skipf("dbtest: set %s or install docker to run database tests", URLEnv)
+	}
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	t.Cleanup(func() { container.Stop() })
+	return container.URL()
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
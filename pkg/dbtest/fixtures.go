@@ -0,0 +1,162 @@
+package dbtest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+)
+
+// Table is implemented by the generated models, whose tables fixtures fill.
+type Table interface {
+	TableName() string
+}
+
+// fixture holds the rows of a model, in the order of the file.
+type fixture struct {
+	Model string
+	Rows  []map[string]interface{}
+}
+
+// Load inserts the rows of a YAML file of fixtures into db. The file maps model names to lists of rows, each
+// a map of column names to values:
+//
+//	User:
+//	  - id: 1
+//	    email: ada@example.com
+//	Post:
+//	  - title: Hello
+//	    user_id: 1
+//	    tags: [go, sql]
+//
+// Models are inserted in the order of the file, so that the rows they reference exist. The table of a model
+// is that of the given model of the same name, otherwise the lowercase plural of the name, as grayv-lsm names
+// tables by default. Maps and lists are stored as JSON. The sequences of id columns are moved past the ids of
+// the fixtures, so that the rows created by the test do not collide with them. Load fails the test if the
+// file cannot be read or a row cannot be inserted.
+func Load(t testing.TB, db *sql.DB, path string, models ...Table) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	fixtures, err := parseFixtures(data)
+	if err != nil {
+		t.Fatalf("dbtest: %s: %v", path, err)
+	}
+	tables := tableNames(models)
+	for _, f := range fixtures {
+		table, ok := tables[f.Model]
+		if !ok {
+			table = strings.ToLower(f.Model) + "s"
+		}
+		for i, row := range f.Rows {
+			statement, args, err := insertStatement(table, row)
+			if err == nil {
+				_, err = db.Exec(statement, args...)
+			}
+			if err != nil {
+				t.Fatalf("dbtest: %s: row %d of %s: %v", path, i+1, f.Model, err)
+			}
+		}
+		if len(f.Rows) > 0 && hasColumn(f.Rows, "id") {
+			if err := resetSequence(db, table); err != nil {
+				t.Fatalf("dbtest: %s: failed to reset the id sequence of %s: %v", path, table, err)
+			}
+		}
+	}
+}
+
+// parseFixtures decodes a file of fixtures, keeping the order of its models.
+func parseFixtures(data []byte) ([]fixture, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("fixtures must map model names to lists of rows")
+	}
+	fixtures := make([]fixture, 0, len(root.Content)/2)
+	for i := 0; i < len(root.Content); i += 2 {
+		name := root.Content[i].Value
+		var rows []map[string]interface{}
+		if err := root.Content[i+1].Decode(&rows); err != nil {
+			return nil, fmt.Errorf("the fixtures of %s must be a list of rows: %w", name, err)
+		}
+		fixtures = append(fixtures, fixture{Model: name, Rows: rows})
+	}
+	return fixtures, nil
+}
+
+// tableNames maps the type names of models to their tables.
+func tableNames(models []Table) map[string]string {
+	tables := make(map[string]string, len(models))
+	for _, m := range models {
+		typ := reflect.TypeOf(m)
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		tables[typ.Name()] = m.TableName()
+	}
+	return tables
+}
+
+// insertStatement returns the statement inserting a row into table, with its columns sorted.
+func insertStatement(table string, row map[string]interface{}) (string, []interface{}, error) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		quoted[i] = pq.QuoteIdentifier(column)
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		value := row[column]
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("column %s: %w", column, err)
+			}
+			value = string(encoded)
+		}
+		args[i] = value
+	}
+	if len(columns) == 0 {
+		return "INSERT INTO " + pq.QuoteIdentifier(table) + " DEFAULT VALUES", nil, nil
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", pq.QuoteIdentifier(table),
+		strings.Join(quoted, ", "), strings.Join(placeholders, ", ")), args, nil
+}
+
+// resetSequence moves the sequence of the id column of table, if it has one, past its largest id.
+func resetSequence(db *sql.DB, table string) error {
+	_, err := db.Exec(fmt.Sprintf(
+		"SELECT setval(s, (SELECT MAX(id) FROM %s)) FROM pg_get_serial_sequence($1, 'id') AS s WHERE s IS NOT NULL",
+		pq.QuoteIdentifier(table)), pq.QuoteIdentifier(table))
+	return err
+}
+
+func hasColumn(rows []map[string]interface{}, column string) bool {
+	for _, row := range rows {
+		if _, ok := row[column]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct{}
+
+func (user) TableName() string { return "accounts" }
+
+type Post struct{}
+
+func (*Post) TableName() string { return "blog_posts" }
+
+func TestParseFixtures_KeepsModelOrder(t *testing.T) {
+	fixtures, err := parseFixtures([]byte(`
+User:
+  - id: 1
+    email: ada@example.com
+Post:
+  - title: Hello
+    user_id: 1
+Comment: []
+`))
+	require.NoError(t, err)
+	require.Len(t, fixtures, 3)
+	assert.Equal(t, "User", fixtures[0].Model)
+	assert.Equal(t, []map[string]interface{}{{"id": 1, "email": "ada@example.com"}}, fixtures[0].Rows)
+	assert.Equal(t, "Post", fixtures[1].Model)
+	assert.Equal(t, "Comment", fixtures[2].Model)
+	assert.Empty(t, fixtures[2].Rows)
+}
+
+func TestParseFixtures_Invalid(t *testing.T) {
+	_, err := parseFixtures([]byte("- id: 1"))
+	assert.Error(t, err)
+	_, err = parseFixtures([]byte("User:\n  id: 1"))
+	assert.ErrorContains(t, err, "User")
+
+	fixtures, err := parseFixtures(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, fixtures)
+}
+
+func TestTableNames(t *testing.T) {
+	assert.Equal(t, map[string]string{"user": "accounts", "Post": "blog_posts"},
+		tableNames([]Table{user{}, &Post{}}))
+}
+
+func TestInsertStatement(t *testing.T) {
+	statement, args, err := insertStatement("posts", map[string]interface{}{
+		"title":    "Hello",
+		"tags":     []interface{}{"go", "sql"},
+		"metadata": map[string]interface{}{"draft": true},
+		"user_id":  1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "posts" ("metadata", "tags", "title", "user_id") VALUES ($1, $2, $3, $4)`, statement)
+	assert.Equal(t, []interface{}{`{"draft":true}`, `["go","sql"]`, "Hello", 1}, args)
+
+	statement, args, err = insertStatement("posts", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "posts" DEFAULT VALUES`, statement)
+	assert.Empty(t, args)
+}
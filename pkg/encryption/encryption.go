@@ -0,0 +1,35 @@
+// Package encryption encrypts the values of encrypted model fields with AES-256-GCM. Every ciphertext records
+// the ID of the key it was encrypted with, so a Keyring holding both the old and the new key reads values of
+// either while a key rotation is in progress. The generated repositories encrypt and decrypt these fields with
+// the same keyring, see model.RenderEncryptionFile.
+package encryption
+
+import "github.com/ooyeku/grayv-lsm/internal/model/keyring"
+
+// ErrUnknownKey is returned when a value was encrypted with a key the Keyring does not hold.
+var ErrUnknownKey = keyring.ErrUnknownKey
+
+// Keyring holds the keys values are encrypted with. New values are encrypted with the primary key; values are
+// decrypted with the key recorded in them.
+type Keyring = keyring.Keyring
+
+// NewKeyring creates a keyring from base64-encoded 256-bit keys by ID. The primary key must be one of them.
+func NewKeyring(keys map[string]string, primary string) (*Keyring, error) {
+	return keyring.NewKeyring(keys, primary)
+}
+
+// GenerateKey returns a new random key, base64-encoded as expected by NewKeyring.
+func GenerateKey() (string, error) {
+	return keyring.GenerateKey()
+}
+
+// KeyID returns the ID of the key a value was encrypted with.
+func KeyID(ciphertext string) (string, error) {
+	return keyring.KeyID(ciphertext)
+}
+
+// Prefix returns the prefix shared by every value encrypted with the key of the given ID. It lets SQL queries
+// select the values still encrypted with other keys.
+func Prefix(keyID string) string {
+	return keyring.Prefix(keyID)
+}
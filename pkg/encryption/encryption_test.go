@@ -0,0 +1,62 @@
+package encryption
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring(t *testing.T) {
+	oldKey, err := GenerateKey()
+	assert.NoError(t, err)
+	newKey, err := GenerateKey()
+	assert.NoError(t, err)
+
+	old, err := NewKeyring(map[string]string{"2024": oldKey}, "2024")
+	assert.NoError(t, err)
+	ciphertext, err := old.Encrypt("123-45-6789")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(ciphertext, Prefix("2024")))
+	assert.NotContains(t, ciphertext, "123-45-6789")
+
+	// During a rotation both keys are configured and values of either are readable.
+	both, err := NewKeyring(map[string]string{"2024": oldKey, "2025": newKey}, "2025")
+	assert.NoError(t, err)
+	plaintext, err := both.Decrypt(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "123-45-6789", plaintext)
+
+	rotated, err := both.Rotate("2025", ciphertext)
+	assert.NoError(t, err)
+	keyID, err := KeyID(rotated)
+	assert.NoError(t, err)
+	assert.Equal(t, "2025", keyID)
+	unchanged, err := both.Rotate("2025", rotated)
+	assert.NoError(t, err)
+	assert.Equal(t, rotated, unchanged)
+
+	_, err = old.Decrypt(rotated)
+	assert.True(t, errors.Is(err, ErrUnknownKey))
+
+	// A value moved to another key ID does not decrypt.
+	tampered := Prefix("2025") + strings.TrimPrefix(ciphertext, Prefix("2024"))
+	_, err = both.Decrypt(tampered)
+	assert.Error(t, err)
+}
+
+func TestNewKeyring_Invalid(t *testing.T) {
+	key, _ := GenerateKey()
+	for name, keys := range map[string]map[string]string{
+		"no keys":         {},
+		"short key":       {"k": "c2hvcnQ="},
+		"invalid base64":  {"k": "not base64"},
+		"colon in key ID": {"a:b": key},
+	} {
+		_, err := NewKeyring(keys, "k")
+		assert.Error(t, err, name)
+	}
+	_, err := NewKeyring(map[string]string{"k": key}, "missing")
+	assert.Error(t, err)
+}
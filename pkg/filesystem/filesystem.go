@@ -0,0 +1,235 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// FS is a writable file system abstraction used by the seeder, the model manager, and the code generator.
+// It extends the read-only fs.FS interface with the handful of write operations those components need,
+// so that they can operate on the real disk, an in-memory tree, or a read-only source such as an embed.FS
+// through the same code path.
+type FS interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.StatFS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+}
+
+// ErrReadOnly is returned by write operations on a file system created with ReadOnly.
+var ErrReadOnly = errors.New("file system is read-only")
+
+// OSFS is an FS backed by the operating system's file system. Paths are resolved relative to Root,
+// or used as-is when Root is empty or the path is absolute.
+type OSFS struct {
+	Root string
+}
+
+// NewOSFS returns an OSFS rooted at the given directory. An empty root resolves paths relative to the
+// current working directory.
+func NewOSFS(root string) *OSFS {
+	return &OSFS{Root: root}
+}
+
+// resolve converts a slash-separated name into an OS path relative to the file system root.
+func (o *OSFS) resolve(name string) string {
+	p := filepath.FromSlash(name)
+	if o.Root == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(o.Root, p)
+}
+
+// Open opens the named file for reading.
+func (o *OSFS) Open(name string) (fs.File, error) {
+	return os.Open(o.resolve(name))
+}
+
+// ReadDir reads the named directory and returns its entries sorted by filename.
+func (o *OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(o.resolve(name))
+}
+
+// ReadFile reads the named file and returns its contents.
+func (o *OSFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(o.resolve(name))
+}
+
+// Stat returns a FileInfo describing the named file.
+func (o *OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(o.resolve(name))
+}
+
+// WriteFile writes data to the named file, creating it if necessary.
+func (o *OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(o.resolve(name), data, perm)
+}
+
+// MkdirAll creates the named directory along with any necessary parents.
+func (o *OSFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(o.resolve(name), perm)
+}
+
+// Remove removes the named file or empty directory.
+func (o *OSFS) Remove(name string) error {
+	return os.Remove(o.resolve(name))
+}
+
+// RemoveAll removes the named file or directory and everything it contains. A missing path is not an error.
+func (o *OSFS) RemoveAll(name string) error {
+	return os.RemoveAll(o.resolve(name))
+}
+
+// MemFS is an in-memory FS intended for unit tests and dry runs. It is safe for concurrent use.
+type MemFS struct {
+	mu    sync.RWMutex
+	files fstest.MapFS
+}
+
+// NewMemFS returns an empty in-memory file system.
+func NewMemFS() *MemFS {
+	return &MemFS{files: fstest.MapFS{}}
+}
+
+// clean normalizes a name to the unrooted, slash-separated form used as a key in the underlying map.
+func clean(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	if len(name) > 0 && name[0] == '/' {
+		name = name[1:]
+	}
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// Open opens the named file for reading.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Open(clean(name))
+}
+
+// ReadDir reads the named directory and returns its entries sorted by filename.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.ReadDir(clean(name))
+}
+
+// ReadFile reads the named file and returns a copy of its contents.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.ReadFile(clean(name))
+}
+
+// Stat returns a FileInfo describing the named file.
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Stat(clean(name))
+}
+
+// WriteFile stores a copy of data under the named file.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	m.files[clean(name)] = &fstest.MapFile{Data: buf, Mode: perm, ModTime: time.Now()}
+	return nil
+}
+
+// MkdirAll records the named directory. Parent directories are implied by their children.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	name = clean(name)
+	if name == "." {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.files[name]; !exists {
+		m.files[name] = &fstest.MapFile{Mode: fs.ModeDir | perm, ModTime: time.Now()}
+	}
+	return nil
+}
+
+// Remove deletes the named file. It returns an error wrapping fs.ErrNotExist if the file does not exist.
+func (m *MemFS) Remove(name string) error {
+	name = clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.files[name]; !exists {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// RemoveAll deletes the named file or directory and everything below it. A missing path is not an error.
+func (m *MemFS) RemoveAll(name string) error {
+	name = clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := name + "/"
+	for key := range m.files {
+		if key == name || name == "." || strings.HasPrefix(key, prefix) {
+			delete(m.files, key)
+		}
+	}
+	return nil
+}
+
+// readOnlyFS adapts an arbitrary fs.FS to the FS interface, rejecting every write.
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+// ReadOnly wraps a read-only source such as an embed.FS or os.DirFS so that it can be passed where an FS
+// is expected. All write operations return ErrReadOnly.
+func ReadOnly(fsys fs.FS) FS {
+	return &readOnlyFS{fsys: fsys}
+}
+
+func (r *readOnlyFS) Open(name string) (fs.File, error) {
+	return r.fsys.Open(name)
+}
+
+func (r *readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(r.fsys, name)
+}
+
+func (r *readOnlyFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(r.fsys, name)
+}
+
+func (r *readOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(r.fsys, name)
+}
+
+func (r *readOnlyFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return &fs.PathError{Op: "write", Path: name, Err: ErrReadOnly}
+}
+
+func (r *readOnlyFS) MkdirAll(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: ErrReadOnly}
+}
+
+func (r *readOnlyFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+func (r *readOnlyFS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "removeall", Path: name, Err: ErrReadOnly}
+}
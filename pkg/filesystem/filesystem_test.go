@@ -0,0 +1,80 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemFS_WriteAndRead(t *testing.T) {
+	m := NewMemFS()
+
+	assert.NoError(t, m.MkdirAll("models", 0755))
+	assert.NoError(t, m.WriteFile("models/user.go", []byte("package models"), 0644))
+
+	data, err := m.ReadFile("models/user.go")
+	assert.NoError(t, err)
+	assert.Equal(t, "package models", string(data))
+
+	entries, err := m.ReadDir("models")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "user.go", entries[0].Name())
+
+	info, err := m.Stat("models")
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestMemFS_Remove(t *testing.T) {
+	m := NewMemFS()
+	assert.NoError(t, m.WriteFile("models.json", []byte("{}"), 0644))
+	assert.NoError(t, m.Remove("models.json"))
+
+	_, err := m.ReadFile("models.json")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.True(t, errors.Is(m.Remove("models.json"), fs.ErrNotExist))
+}
+
+func TestMemFS_RemoveAll(t *testing.T) {
+	m := NewMemFS()
+	assert.NoError(t, m.MkdirAll(".grav/previews/main", 0755))
+	assert.NoError(t, m.WriteFile(".grav/previews/main/state.json", []byte("{}"), 0644))
+	assert.NoError(t, m.WriteFile(".grav/previews/mainline/state.json", []byte("{}"), 0644))
+
+	assert.NoError(t, m.RemoveAll(".grav/previews/main"))
+	_, err := m.Stat(".grav/previews/main")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	_, err = m.ReadFile(".grav/previews/mainline/state.json")
+	assert.NoError(t, err, "siblings sharing a name prefix must survive")
+
+	assert.NoError(t, m.RemoveAll("missing"))
+}
+
+func TestOSFS_RootedPaths(t *testing.T) {
+	dir := t.TempDir()
+	o := NewOSFS(dir)
+
+	assert.NoError(t, o.MkdirAll("seeds", 0755))
+	assert.NoError(t, o.WriteFile("seeds/01_users.sql", []byte("SELECT 1;"), 0644))
+
+	data, err := o.ReadFile("seeds/01_users.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT 1;", string(data))
+	assert.FileExists(t, filepath.Join(dir, "seeds", "01_users.sql"))
+}
+
+func TestReadOnly_RejectsWrites(t *testing.T) {
+	ro := ReadOnly(fstest.MapFS{"config.json": {Data: []byte("{}")}})
+
+	data, err := ro.ReadFile("config.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+
+	err = ro.WriteFile("config.json", nil, 0644)
+	assert.True(t, errors.Is(err, ErrReadOnly))
+}
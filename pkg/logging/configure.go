@@ -0,0 +1,172 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configures the registered loggers, see Configure.
+type Options struct {
+	// Level is the minimum level logged: "debug", "info", "warn" or "error". Levels are left alone when empty.
+	Level string
+	// Format is the format of the lines written to File, FormatText or FormatJSON. Without a File, FormatJSON
+	// switches the loggers to JSON lines on standard error, as SetJSONOutput does.
+	Format string
+	// File is the file every log line is also written to, rotated as Rotate says.
+	File   string
+	Rotate RotateOptions
+}
+
+var (
+	configMu sync.Mutex
+	// level is the level set by Configure, applied to the loggers registered later.
+	level    logrus.Level
+	levelSet bool
+	// scope holds the fields added to the lines of structured outputs, see Scope.
+	scope logrus.Fields
+	// fileOutput is the hook of every registered logger writing to the file of the configuration, if any.
+	fileOutput = &fileHook{}
+)
+
+// Configure applies the options to every registered logger, including the ones registered later. The log
+// file of a previous configuration is closed.
+func Configure(options Options) error {
+	var parsed logrus.Level
+	if options.Level != "" {
+		var err error
+		if parsed, err = logrus.ParseLevel(options.Level); err != nil {
+			return fmt.Errorf("invalid log level %q: use debug, info, warn or error", options.Level)
+		}
+	}
+	var formatter logrus.Formatter
+	switch options.Format {
+	case "", FormatText:
+		formatter = scopedFormatter{&logrus.TextFormatter{DisableColors: true, FullTimestamp: true}}
+	case FormatJSON:
+		formatter = scopedFormatter{&logrus.JSONFormatter{}}
+	default:
+		return fmt.Errorf("invalid log format %q: use %s or %s", options.Format, FormatText, FormatJSON)
+	}
+
+	var file *RotatingFile
+	if options.File != "" {
+		var err error
+		if file, err = OpenRotatingFile(options.File, options.Rotate); err != nil {
+			return err
+		}
+	}
+	if err := fileOutput.set(file, formatter); err != nil {
+		return err
+	}
+
+	configMu.Lock()
+	level, levelSet = parsed, options.Level != ""
+	configMu.Unlock()
+	jsonMu.Lock()
+	for _, logger := range loggers {
+		if options.Level != "" {
+			logger.SetLevel(parsed)
+		}
+	}
+	jsonMu.Unlock()
+	if options.File == "" && options.Format == FormatJSON {
+		SetJSONOutput(os.Stderr)
+	}
+	return nil
+}
+
+func configuredLevel() (logrus.Level, bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return level, levelSet
+}
+
+// Scope adds fields, such as the command being run, to every line of the log file and of JSON outputs, so
+// that the lines of a run can be told apart from those of others. Text lines on the console are left alone.
+func Scope(fields logrus.Fields) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	scope = fields
+}
+
+// LevelFor returns the level configured for a command, e.g. "db migrate": the level of the longest command
+// of levels it is or is a subcommand of, or fallback.
+func LevelFor(levels map[string]string, command, fallback string) string {
+	matched := ""
+	for name, level := range levels {
+		if (command == name || strings.HasPrefix(command, name+" ")) && len(name) >= len(matched) {
+			matched, fallback = name, level
+		}
+	}
+	return fallback
+}
+
+// scopedFormatter adds the fields of Scope to the entries it formats, without overriding their own fields.
+type scopedFormatter struct {
+	logrus.Formatter
+}
+
+func (f scopedFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	configMu.Lock()
+	fields := scope
+	configMu.Unlock()
+	if len(fields) == 0 {
+		return f.Formatter.Format(entry)
+	}
+	scoped := *entry
+	scoped.Data = make(logrus.Fields, len(entry.Data)+len(fields))
+	for k, v := range fields {
+		scoped.Data[k] = v
+	}
+	for k, v := range entry.Data {
+		scoped.Data[k] = v
+	}
+	return f.Formatter.Format(&scoped)
+}
+
+// fileHook writes the entries of the loggers it is added to to a log file, when one is configured.
+type fileHook struct {
+	mu        sync.Mutex
+	file      *RotatingFile
+	formatter logrus.Formatter
+}
+
+// set replaces the file of the hook, closing the previous one. A nil file stops the hook.
+func (h *fileHook) set(file *RotatingFile, formatter logrus.Formatter) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	previous := h.file
+	h.file, h.formatter = file, formatter
+	if previous != nil {
+		return previous.Close()
+	}
+	return nil
+}
+
+func (h *fileHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fileHook) Fire(entry *logrus.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	line, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(line)
+	return err
+}
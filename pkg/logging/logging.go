@@ -5,6 +5,16 @@ import (
 	"github.com/sirupsen/logrus"
 	"io"
 	"os"
+	"sync"
+)
+
+var (
+	jsonMu sync.Mutex
+	// jsonOutput is the writer every registered logger writes JSON lines to, once SetJSONOutput was called.
+	jsonOutput io.Writer
+	// loggers are the ColorfulLoggers created so far and the loggers passed to Register, which SetJSONOutput
+	// and Configure reconfigure.
+	loggers []*logrus.Logger
 )
 
 // ColorfulLogger is a custom logger implementation based on logrus.Logger.
@@ -61,9 +71,43 @@ func NewColorfulLogger() *ColorfulLogger {
 	logger.SetOutput(os.Stdout)
 	logger.SetLevel(logrus.InfoLevel)
 
+	Register(logger.Logger)
 	return logger
 }
 
+// Register makes SetJSONOutput and Configure apply to a logger, as they do to every ColorfulLogger, so that
+// the loggers of the packages of a program log alike.
+func Register(logger *logrus.Logger) {
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	loggers = append(loggers, logger)
+	logger.AddHook(fileOutput)
+	if jsonOutput != nil {
+		useJSON(logger, jsonOutput)
+	}
+	if level, ok := configuredLevel(); ok {
+		logger.SetLevel(level)
+	}
+}
+
+// SetJSONOutput switches every registered logger, including the ones registered later, to writing JSON lines
+// to w and stops the colored echo of messages on standard output. Commands printing machine-readable results
+// on standard output call it so the results are not interleaved with log lines.
+func SetJSONOutput(w io.Writer) {
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	jsonOutput = w
+	color.Output = io.Discard
+	for _, logger := range loggers {
+		useJSON(logger, w)
+	}
+}
+
+func useJSON(logger *logrus.Logger, w io.Writer) {
+	logger.SetOutput(w)
+	logger.SetFormatter(scopedFormatter{&logrus.JSONFormatter{}})
+}
+
 // SetLevel sets the log level of the ColorfulLogger.
 // It updates the log level of the underlying Logger instance with the provided "level" parameter.
 func (cl *ColorfulLogger) SetLevel(level logrus.Level) {
@@ -2,8 +2,14 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/fatih/color"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -84,3 +90,73 @@ func TestColorfulLogger_Panic(t *testing.T) {
 
 	logger.Panic("panic message")
 }
+
+func TestSetJSONOutput(t *testing.T) {
+	originalColorOutput := color.Output
+	t.Cleanup(func() {
+		jsonMu.Lock()
+		jsonOutput = nil
+		jsonMu.Unlock()
+		color.Output = originalColorOutput
+	})
+
+	existing := NewColorfulLogger()
+	var buf bytes.Buffer
+	SetJSONOutput(&buf)
+	created := NewColorfulLogger()
+
+	existing.Info("before")
+	created.Warnf("after %d", 1)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	for i, want := range []string{"before", "after 1"} {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[i]), &entry))
+		assert.Equal(t, want, entry["msg"])
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, Configure(Options{Level: "info"}))
+		Scope(nil)
+	})
+
+	logger := logrus.New()
+	var console bytes.Buffer
+	logger.SetOutput(&console)
+	Register(logger)
+
+	path := filepath.Join(t.TempDir(), "grayv.log")
+	assert.NoError(t, Configure(Options{Level: "warn", Format: FormatJSON, File: path}))
+	Scope(logrus.Fields{"command": "db migrate"})
+	logger.Info("hidden")
+	logger.WithField("table", "users").Warn("slow")
+	later := logrus.New()
+	later.SetOutput(io.Discard)
+	Register(later)
+	assert.Equal(t, logrus.WarnLevel, later.GetLevel())
+
+	assert.NotContains(t, console.String(), "hidden")
+	assert.Contains(t, console.String(), "slow")
+	assert.NotContains(t, console.String(), "command")
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, "slow", entry["msg"])
+	assert.Equal(t, "db migrate", entry["command"])
+	assert.Equal(t, "users", entry["table"])
+
+	assert.Error(t, Configure(Options{Level: "loud"}))
+	assert.Error(t, Configure(Options{Format: "xml"}))
+}
+
+func TestLevelFor(t *testing.T) {
+	levels := map[string]string{"db": "warn", "db migrate": "debug"}
+	assert.Equal(t, "debug", LevelFor(levels, "db migrate", "info"))
+	assert.Equal(t, "warn", LevelFor(levels, "db seed", "info"))
+	assert.Equal(t, "info", LevelFor(levels, "dbx", "info"))
+	assert.Equal(t, "info", LevelFor(nil, "model list", "info"))
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "grayv.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10, MaxBackups: 2})
+	assert.NoError(t, err)
+	defer f.Close()
+	now := time.Date(2024, 11, 10, 9, 30, 0, 0, time.Local)
+	f.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "logs"))
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"grayv-20241110T093200.000.log", "grayv-20241110T093300.000.log", "grayv.log"}, names)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "fourth\n", string(data))
+	data, err = os.ReadFile(filepath.Join(dir, "logs", "grayv-20241110T093300.000.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "third\n", string(data))
+}
+
+func TestRotatingFile_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "grayv.log")
+	old := filepath.Join(dir, "grayv-"+time.Now().Add(-48*time.Hour).Format(backupTimeFormat)+".log")
+	recent := filepath.Join(dir, "grayv-"+time.Now().Add(-time.Hour).Format(backupTimeFormat)+".log")
+	other := filepath.Join(dir, "grayv-notes.log")
+	for _, name := range []string{old, recent, other} {
+		assert.NoError(t, os.WriteFile(name, nil, 0644))
+	}
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxAge: 24 * time.Hour})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, recent)
+	assert.FileExists(t, other)
+	_, err = f.Write([]byte("closed"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
@@ -0,0 +1,76 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Migration is a migration written in Go.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(s *Schema)
+	// Down undoes Up. When nil, the operations of Up are undone in reverse order.
+	Down func(s *Schema)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[int64]Migration{}
+)
+
+// Register registers a migration written in Go, to apply after the migrations of lower versions, usually from
+// the init function of the file declaring it. down may be nil when every operation of up can be undone, see
+// Schema.Reverse. Register panics if a migration of the same version is already registered.
+func Register(version int64, name string, up, down func(s *Schema)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if existing, ok := registry[version]; ok {
+		panic(fmt.Sprintf("schema: migrations %s and %s both have version %d", existing.Name, name, version))
+	}
+	registry[version] = Migration{Version: version, Name: name, Up: up, Down: down}
+}
+
+// Migrations returns the registered migrations in version order.
+func Migrations() []Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	migrations := make([]Migration, 0, len(registry))
+	for _, m := range registry {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
+
+// FileName returns the name the migration is listed under, like that of a SQL migration file:
+// <version>_<name>.go.
+func (m Migration) FileName() string {
+	return fmt.Sprintf("%d_%s.go", m.Version, m.Name)
+}
+
+// SQL renders the up and down SQL of the migration for a dialect, as scripts of statements terminated by
+// semicolons.
+func (m Migration) SQL(d Dialect) (up, down string, err error) {
+	upSchema := &Schema{}
+	m.Up(upSchema)
+	downSchema := &Schema{}
+	if m.Down != nil {
+		m.Down(downSchema)
+	} else if downSchema, err = upSchema.Reverse(); err != nil {
+		return "", "", fmt.Errorf("migration %s has no down function and %w", m.FileName(), err)
+	}
+	return script(upSchema.Statements(d)), script(downSchema.Statements(d)), nil
+}
+
+// script joins statements into a script.
+func script(statements []string) string {
+	var b strings.Builder
+	for _, statement := range statements {
+		b.WriteString(statement)
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,548 @@
+// Package schema writes migrations in Go rather than SQL: a Schema records operations such as CreateTable,
+// AddColumn and AddIndex, and renders them as the SQL of a database engine, so the same migration applies to
+// Postgres, MySQL and SQLite databases. Migrations registered with Register are applied by the migrator of
+// apps scaffolded by "grayv-lsm app new" together with their SQL migrations, see the appdb package.
+//
+//	func init() {
+//		schema.Register(20240601000000, "create_posts", func(s *schema.Schema) {
+//			s.CreateTable("posts", func(t *schema.Table) {
+//				t.ID()
+//				t.Column("title", schema.String(200)).NotNull()
+//				t.Column("published", schema.Boolean).NotNull().Default(false)
+//				t.Timestamps()
+//			})
+//			s.AddIndex("posts", "published")
+//		}, nil)
+//	}
+//
+// Migrations built only of reversible operations need no down function: it is derived by undoing the up
+// operations in reverse order.
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect is the SQL dialect of a database engine.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite"
+)
+
+// ParseDialect returns the dialect of a database driver name, such as the Driver of a database configuration.
+func ParseDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(driver) {
+	case "postgres", "postgresql", "pgx":
+		return Postgres, nil
+	case "mysql":
+		return MySQL, nil
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	default:
+		return "", fmt.Errorf("unsupported driver %q (expected postgres, mysql or sqlite)", driver)
+	}
+}
+
+// QuoteIdentifier quotes a table, column or index name.
+func (d Dialect) QuoteIdentifier(name string) string {
+	if d == MySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// literal renders a default value as a SQL literal.
+func (d Dialect) literal(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		switch {
+		case d == SQLite && v:
+			return "1"
+		case d == SQLite:
+			return "0"
+		case v:
+			return "TRUE"
+		default:
+			return "FALSE"
+		}
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		quoted := strings.ReplaceAll(v, "'", "''")
+		if d == MySQL {
+			quoted = strings.ReplaceAll(quoted, `\`, `\\`)
+		}
+		return "'" + quoted + "'"
+	default:
+		return d.literal(fmt.Sprint(v))
+	}
+}
+
+// ColumnType is the portable type of a column, rendered as the type of each dialect that stores its values.
+type ColumnType struct {
+	kind  string
+	size  int
+	scale int
+}
+
+// The column types without parameters.
+var (
+	// Text holds strings of any length.
+	Text = ColumnType{kind: "text"}
+	// Integer holds 32-bit integers.
+	Integer = ColumnType{kind: "integer"}
+	// BigInt holds 64-bit integers.
+	BigInt = ColumnType{kind: "bigint"}
+	// Boolean holds booleans, as 0 or 1 in SQLite.
+	Boolean = ColumnType{kind: "boolean"}
+	// Float holds double precision floating point numbers.
+	Float = ColumnType{kind: "float"}
+	// Timestamp holds points in time: with the time zone in Postgres, with microseconds in MySQL, and as text in
+	// SQLite.
+	Timestamp = ColumnType{kind: "timestamp"}
+	// Date holds calendar dates.
+	Date = ColumnType{kind: "date"}
+	// JSON holds JSON documents: JSONB in Postgres, and text in SQLite.
+	JSON = ColumnType{kind: "json"}
+	// UUID holds UUIDs, as text outside Postgres.
+	UUID = ColumnType{kind: "uuid"}
+	// Binary holds byte strings.
+	Binary = ColumnType{kind: "binary"}
+)
+
+// String holds strings of at most size characters.
+func String(size int) ColumnType {
+	return ColumnType{kind: "string", size: size}
+}
+
+// Decimal holds exact numbers of precision digits, scale of them after the decimal point.
+func Decimal(precision, scale int) ColumnType {
+	return ColumnType{kind: "decimal", size: precision, scale: scale}
+}
+
+// sqlType renders a column type.
+func (d Dialect) sqlType(t ColumnType) string {
+	switch t.kind {
+	case "string":
+		return fmt.Sprintf("VARCHAR(%d)", t.size)
+	case "text":
+		return "TEXT"
+	case "integer":
+		return "INTEGER"
+	case "bigint":
+		if d == SQLite {
+			return "INTEGER"
+		}
+		return "BIGINT"
+	case "boolean":
+		if d == SQLite {
+			return "INTEGER"
+		}
+		return "BOOLEAN"
+	case "float":
+		switch d {
+		case Postgres:
+			return "DOUBLE PRECISION"
+		case MySQL:
+			return "DOUBLE"
+		default:
+			return "REAL"
+		}
+	case "decimal":
+		if d == MySQL {
+			return fmt.Sprintf("DECIMAL(%d,%d)", t.size, t.scale)
+		}
+		return fmt.Sprintf("NUMERIC(%d,%d)", t.size, t.scale)
+	case "timestamp":
+		switch d {
+		case Postgres:
+			return "TIMESTAMP WITH TIME ZONE"
+		case MySQL:
+			return "DATETIME(6)"
+		default:
+			return "TEXT"
+		}
+	case "date":
+		if d == SQLite {
+			return "TEXT"
+		}
+		return "DATE"
+	case "json":
+		switch d {
+		case Postgres:
+			return "JSONB"
+		case MySQL:
+			return "JSON"
+		default:
+			return "TEXT"
+		}
+	case "uuid":
+		switch d {
+		case Postgres:
+			return "UUID"
+		case MySQL:
+			return "CHAR(36)"
+		default:
+			return "TEXT"
+		}
+	case "binary":
+		switch d {
+		case Postgres:
+			return "BYTEA"
+		case MySQL:
+			return "LONGBLOB"
+		default:
+			return "BLOB"
+		}
+	default:
+		return "TEXT"
+	}
+}
+
+// currentTimestamp renders the current time, as the default of a Timestamp column.
+func (d Dialect) currentTimestamp() string {
+	if d == MySQL {
+		return "CURRENT_TIMESTAMP(6)"
+	}
+	return "CURRENT_TIMESTAMP"
+}
+
+// Column is a column of a table created or added by a Schema. Its methods set its constraints and return it,
+// so they can be chained.
+type Column struct {
+	name       string
+	columnType ColumnType
+	primary    bool
+	notNull    bool
+	unique     bool
+	hasDefault bool
+	value      interface{}
+	now        bool
+	references string
+	onDelete   string
+}
+
+// NotNull makes the column reject NULL.
+func (c *Column) NotNull() *Column {
+	c.notNull = true
+	return c
+}
+
+// Unique makes the values of the column unique.
+func (c *Column) Unique() *Column {
+	c.unique = true
+	return c
+}
+
+// Default sets the value the column takes when an insert leaves it out: nil, a boolean, a number or a string.
+func (c *Column) Default(value interface{}) *Column {
+	c.hasDefault, c.value, c.now = true, value, false
+	return c
+}
+
+// DefaultNow makes the column default to the current time.
+func (c *Column) DefaultNow() *Column {
+	c.hasDefault, c.value, c.now = true, nil, true
+	return c
+}
+
+// References makes the column a foreign key to the id column of table.
+func (c *Column) References(table string) *Column {
+	c.references = table
+	return c
+}
+
+// OnDelete sets what deleting the referenced row does: "CASCADE", "SET NULL" or "RESTRICT".
+func (c *Column) OnDelete(action string) *Column {
+	c.onDelete = strings.ToUpper(action)
+	return c
+}
+
+// sql renders the definition of the column.
+func (c *Column) sql(d Dialect) string {
+	if c.primary {
+		switch d {
+		case Postgres:
+			return d.QuoteIdentifier(c.name) + " BIGSERIAL PRIMARY KEY"
+		case MySQL:
+			return d.QuoteIdentifier(c.name) + " BIGINT AUTO_INCREMENT PRIMARY KEY"
+		default:
+			return d.QuoteIdentifier(c.name) + " INTEGER PRIMARY KEY AUTOINCREMENT"
+		}
+	}
+	definition := d.QuoteIdentifier(c.name) + " " + d.sqlType(c.columnType)
+	if c.notNull {
+		definition += " NOT NULL"
+	}
+	if c.unique {
+		definition += " UNIQUE"
+	}
+	switch {
+	case c.now:
+		definition += " DEFAULT " + d.currentTimestamp()
+	case c.hasDefault:
+		definition += " DEFAULT " + d.literal(c.value)
+	}
+	if c.references != "" {
+		definition += fmt.Sprintf(" REFERENCES %s (%s)", d.QuoteIdentifier(c.references), d.QuoteIdentifier("id"))
+		if c.onDelete != "" {
+			definition += " ON DELETE " + c.onDelete
+		}
+	}
+	return definition
+}
+
+// Table is a table created by Schema.CreateTable.
+type Table struct {
+	name    string
+	columns []*Column
+	indexes []*Index
+}
+
+// ID adds the id column: an auto-incremented 64-bit integer primary key.
+func (t *Table) ID() *Column {
+	column := &Column{name: "id", columnType: BigInt, primary: true}
+	t.columns = append(t.columns, column)
+	return column
+}
+
+// Column adds a column.
+func (t *Table) Column(name string, columnType ColumnType) *Column {
+	column := &Column{name: name, columnType: columnType}
+	t.columns = append(t.columns, column)
+	return column
+}
+
+// Timestamps adds the created_at and updated_at columns, defaulting to the current time.
+func (t *Table) Timestamps() {
+	t.Column("created_at", Timestamp).NotNull().DefaultNow()
+	t.Column("updated_at", Timestamp).NotNull().DefaultNow()
+}
+
+// Index adds an index of the given columns, created with the table.
+func (t *Table) Index(columns ...string) *Index {
+	index := &Index{table: t.name, columns: columns}
+	t.indexes = append(t.indexes, index)
+	return index
+}
+
+// Index is an index added by Schema.AddIndex or Table.Index.
+type Index struct {
+	table   string
+	name    string
+	columns []string
+	unique  bool
+}
+
+// Unique makes the index reject duplicate values.
+func (i *Index) Unique() *Index {
+	i.unique = true
+	return i
+}
+
+// Name names the index, table_column_idx by default, e.g. posts_author_id_idx.
+func (i *Index) Name(name string) *Index {
+	i.name = name
+	return i
+}
+
+// indexName returns the name of the index.
+func (i *Index) indexName() string {
+	if i.name != "" {
+		return i.name
+	}
+	return i.table + "_" + strings.Join(i.columns, "_") + "_idx"
+}
+
+// sql renders the statement creating the index.
+func (i *Index) sql(d Dialect) string {
+	columns := make([]string, len(i.columns))
+	for n, column := range i.columns {
+		columns[n] = d.QuoteIdentifier(column)
+	}
+	unique := ""
+	if i.unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, d.QuoteIdentifier(i.indexName()), d.QuoteIdentifier(i.table),
+		strings.Join(columns, ", "))
+}
+
+// dropIndex renders the statement dropping an index of a table.
+func (d Dialect) dropIndex(table, name string) string {
+	if d == MySQL {
+		return fmt.Sprintf("DROP INDEX %s ON %s", d.QuoteIdentifier(name), d.QuoteIdentifier(table))
+	}
+	return "DROP INDEX " + d.QuoteIdentifier(name)
+}
+
+// operation is a change recorded by a Schema.
+type operation struct {
+	// name describes the operation in errors.
+	name string
+	// sql renders the statements of the operation.
+	sql func(d Dialect) []string
+	// reverse records the operation undoing this one on s, and is nil when the operation cannot be undone.
+	reverse func(s *Schema)
+}
+
+// Schema records the operations of a migration, to render as the SQL of a dialect with Statements.
+type Schema struct {
+	operations []operation
+}
+
+func (s *Schema) add(op operation) {
+	s.operations = append(s.operations, op)
+}
+
+// CreateTable creates a table, whose columns and indexes build adds. It is undone by dropping the table.
+func (s *Schema) CreateTable(name string, build func(t *Table)) {
+	t := &Table{name: name}
+	build(t)
+	s.add(operation{
+		name: "CreateTable(" + name + ")",
+		sql: func(d Dialect) []string {
+			columns := make([]string, len(t.columns))
+			for i, column := range t.columns {
+				columns[i] = "  " + column.sql(d)
+			}
+			statements := []string{fmt.Sprintf("CREATE TABLE %s (\n%s\n)", d.QuoteIdentifier(name), strings.Join(columns, ",\n"))}
+			for _, index := range t.indexes {
+				statements = append(statements, index.sql(d))
+			}
+			return statements
+		},
+		reverse: func(r *Schema) { r.DropTable(name) },
+	})
+}
+
+// DropTable drops a table. It cannot be undone.
+func (s *Schema) DropTable(name string) {
+	s.add(operation{
+		name: "DropTable(" + name + ")",
+		sql:  func(d Dialect) []string { return []string{"DROP TABLE " + d.QuoteIdentifier(name)} },
+	})
+}
+
+// RenameTable renames a table. It is undone by renaming it back.
+func (s *Schema) RenameTable(from, to string) {
+	s.add(operation{
+		name: "RenameTable(" + from + ")",
+		sql: func(d Dialect) []string {
+			if d == MySQL {
+				return []string{fmt.Sprintf("RENAME TABLE %s TO %s", d.QuoteIdentifier(from), d.QuoteIdentifier(to))}
+			}
+			return []string{fmt.Sprintf("ALTER TABLE %s RENAME TO %s", d.QuoteIdentifier(from), d.QuoteIdentifier(to))}
+		},
+		reverse: func(r *Schema) { r.RenameTable(to, from) },
+	})
+}
+
+// AddColumn adds a column to a table. It is undone by dropping the column.
+func (s *Schema) AddColumn(table, name string, columnType ColumnType) *Column {
+	column := &Column{name: name, columnType: columnType}
+	s.add(operation{
+		name: "AddColumn(" + table + "." + name + ")",
+		sql: func(d Dialect) []string {
+			return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", d.QuoteIdentifier(table), column.sql(d))}
+		},
+		reverse: func(r *Schema) { r.DropColumn(table, name) },
+	})
+	return column
+}
+
+// DropColumn drops a column of a table. It cannot be undone.
+func (s *Schema) DropColumn(table, name string) {
+	s.add(operation{
+		name: "DropColumn(" + table + "." + name + ")",
+		sql: func(d Dialect) []string {
+			return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", d.QuoteIdentifier(table), d.QuoteIdentifier(name))}
+		},
+	})
+}
+
+// RenameColumn renames a column of a table. It is undone by renaming it back.
+func (s *Schema) RenameColumn(table, from, to string) {
+	s.add(operation{
+		name: "RenameColumn(" + table + "." + from + ")",
+		sql: func(d Dialect) []string {
+			return []string{fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", d.QuoteIdentifier(table),
+				d.QuoteIdentifier(from), d.QuoteIdentifier(to))}
+		},
+		reverse: func(r *Schema) { r.RenameColumn(table, to, from) },
+	})
+}
+
+// AddIndex adds an index of the given columns of a table. It is undone by dropping the index.
+func (s *Schema) AddIndex(table string, columns ...string) *Index {
+	index := &Index{table: table, columns: columns}
+	s.add(operation{
+		name:    "AddIndex(" + table + ")",
+		sql:     func(d Dialect) []string { return []string{index.sql(d)} },
+		reverse: func(r *Schema) { r.DropIndex(table, index.indexName()) },
+	})
+	return index
+}
+
+// DropIndex drops the named index of a table. It cannot be undone.
+func (s *Schema) DropIndex(table, name string) {
+	s.add(operation{
+		name: "DropIndex(" + name + ")",
+		sql:  func(d Dialect) []string { return []string{d.dropIndex(table, name)} },
+	})
+}
+
+// Exec runs a statement as written, for the changes the other operations do not cover. It cannot be undone.
+func (s *Schema) Exec(statement string) {
+	s.add(operation{
+		name: "Exec",
+		sql:  func(d Dialect) []string { return []string{statement} },
+	})
+}
+
+// ExecFor runs a statement as written on databases of the given dialect only. It cannot be undone.
+func (s *Schema) ExecFor(dialect Dialect, statement string) {
+	s.add(operation{
+		name: "ExecFor(" + string(dialect) + ")",
+		sql: func(d Dialect) []string {
+			if d != dialect {
+				return nil
+			}
+			return []string{statement}
+		},
+	})
+}
+
+// Statements renders the recorded operations as the statements of a dialect, in order.
+func (s *Schema) Statements(d Dialect) []string {
+	var statements []string
+	for _, op := range s.operations {
+		statements = append(statements, op.sql(d)...)
+	}
+	return statements
+}
+
+// Reverse returns a Schema undoing the recorded operations, in reverse order, or an error naming the first
+// operation that cannot be undone.
+func (s *Schema) Reverse() (*Schema, error) {
+	reversed := &Schema{}
+	for i := len(s.operations) - 1; i >= 0; i-- {
+		op := s.operations[i]
+		if op.reverse == nil {
+			return nil, fmt.Errorf("%s cannot be undone", op.name)
+		}
+		op.reverse(reversed)
+	}
+	return reversed, nil
+}
@@ -0,0 +1,132 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createPosts(s *Schema) {
+	s.CreateTable("posts", func(t *Table) {
+		t.ID()
+		t.Column("title", String(200)).NotNull()
+		t.Column("published", Boolean).NotNull().Default(false)
+		t.Column("author_id", BigInt).References("users").OnDelete("cascade")
+		t.Column("created_at", Timestamp).NotNull().DefaultNow()
+		t.Index("author_id")
+	})
+}
+
+func TestSchema_CreateTable(t *testing.T) {
+	s := &Schema{}
+	createPosts(s)
+
+	assert.Equal(t, []string{
+		"CREATE TABLE \"posts\" (\n" +
+			"  \"id\" BIGSERIAL PRIMARY KEY,\n" +
+			"  \"title\" VARCHAR(200) NOT NULL,\n" +
+			"  \"published\" BOOLEAN NOT NULL DEFAULT FALSE,\n" +
+			"  \"author_id\" BIGINT REFERENCES \"users\" (\"id\") ON DELETE CASCADE,\n" +
+			"  \"created_at\" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP\n)",
+		`CREATE INDEX "posts_author_id_idx" ON "posts" ("author_id")`,
+	}, s.Statements(Postgres))
+
+	assert.Equal(t, []string{
+		"CREATE TABLE `posts` (\n" +
+			"  `id` BIGINT AUTO_INCREMENT PRIMARY KEY,\n" +
+			"  `title` VARCHAR(200) NOT NULL,\n" +
+			"  `published` BOOLEAN NOT NULL DEFAULT FALSE,\n" +
+			"  `author_id` BIGINT REFERENCES `users` (`id`) ON DELETE CASCADE,\n" +
+			"  `created_at` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)\n)",
+		"CREATE INDEX `posts_author_id_idx` ON `posts` (`author_id`)",
+	}, s.Statements(MySQL))
+
+	assert.Equal(t, []string{
+		"CREATE TABLE \"posts\" (\n" +
+			"  \"id\" INTEGER PRIMARY KEY AUTOINCREMENT,\n" +
+			"  \"title\" VARCHAR(200) NOT NULL,\n" +
+			"  \"published\" INTEGER NOT NULL DEFAULT 0,\n" +
+			"  \"author_id\" INTEGER REFERENCES \"users\" (\"id\") ON DELETE CASCADE,\n" +
+			"  \"created_at\" TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP\n)",
+		`CREATE INDEX "posts_author_id_idx" ON "posts" ("author_id")`,
+	}, s.Statements(SQLite))
+}
+
+func TestSchema_Reverse(t *testing.T) {
+	s := &Schema{}
+	createPosts(s)
+	s.AddColumn("posts", "slug", String(100)).Default("it's")
+	s.AddIndex("posts", "slug").Unique()
+	s.RenameColumn("posts", "title", "headline")
+
+	assert.Equal(t, []string{
+		`ALTER TABLE "posts" ADD COLUMN "slug" VARCHAR(100) DEFAULT 'it''s'`,
+		`CREATE UNIQUE INDEX "posts_slug_idx" ON "posts" ("slug")`,
+		`ALTER TABLE "posts" RENAME COLUMN "title" TO "headline"`,
+	}, s.Statements(Postgres)[2:])
+
+	reversed, err := s.Reverse()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"ALTER TABLE `posts` RENAME COLUMN `headline` TO `title`",
+		"DROP INDEX `posts_slug_idx` ON `posts`",
+		"ALTER TABLE `posts` DROP COLUMN `slug`",
+		"DROP TABLE `posts`",
+	}, reversed.Statements(MySQL))
+
+	s.DropColumn("posts", "body")
+	_, err = s.Reverse()
+	assert.EqualError(t, err, "DropColumn(posts.body) cannot be undone")
+}
+
+func TestSchema_ExecFor(t *testing.T) {
+	s := &Schema{}
+	s.ExecFor(Postgres, "CREATE EXTENSION IF NOT EXISTS pg_trgm")
+	s.Exec("UPDATE posts SET published = published")
+	assert.Len(t, s.Statements(Postgres), 2)
+	assert.Equal(t, []string{"UPDATE posts SET published = published"}, s.Statements(SQLite))
+}
+
+func TestMigration_SQL(t *testing.T) {
+	m := Migration{Version: 20240601000000, Name: "create_posts", Up: func(s *Schema) {
+		s.CreateTable("tags", func(t *Table) { t.ID() })
+	}}
+	assert.Equal(t, "20240601000000_create_posts.go", m.FileName())
+
+	up, down, err := m.SQL(SQLite)
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE \"tags\" (\n  \"id\" INTEGER PRIMARY KEY AUTOINCREMENT\n);\n", up)
+	assert.Equal(t, "DROP TABLE \"tags\";\n", down)
+
+	m.Up = func(s *Schema) { s.DropTable("tags") }
+	_, _, err = m.SQL(Postgres)
+	assert.EqualError(t, err, "migration 20240601000000_create_posts.go has no down function and DropTable(tags) cannot be undone")
+
+	m.Down = func(s *Schema) { s.Exec("CREATE TABLE tags (id INTEGER)") }
+	_, down, err = m.SQL(Postgres)
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE tags (id INTEGER);\n", down)
+}
+
+func TestRegister(t *testing.T) {
+	up := func(s *Schema) { s.CreateTable("b", func(t *Table) { t.ID() }) }
+	Register(20240602000000, "create_b", up, nil)
+	Register(20240601000000, "create_a", up, nil)
+
+	migrations := Migrations()
+	require.Len(t, migrations, 2)
+	assert.Equal(t, "create_a", migrations[0].Name)
+	assert.Equal(t, "create_b", migrations[1].Name)
+	assert.Panics(t, func() { Register(20240601000000, "again", up, nil) })
+}
+
+func TestParseDialect(t *testing.T) {
+	for driver, want := range map[string]Dialect{"postgres": Postgres, "mysql": MySQL, "sqlite3": SQLite} {
+		d, err := ParseDialect(driver)
+		require.NoError(t, err)
+		assert.Equal(t, want, d)
+	}
+	_, err := ParseDialect("oracle")
+	assert.Error(t, err)
+}